@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/penwern/curate-preservation-core/internal/aipstore"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	aipStoreLocation string
+	aipStoreDest     string
+	aipStoreWait     bool
+	aipStoreLayout   string
+)
+
+// aipVerification is the result of the verification of a stored AIP in the JSON output of aip-store verify.
+type aipVerification struct {
+	*aipstore.FixityReport
+	Status string `json:"status"`
+}
+
+// aipRestoration is the result of the restore of an AIP in the JSON output of aip-store restore.
+type aipRestoration struct {
+	*aipstore.RestoreStatus
+	State string `json:"state"`
+}
+
+var aipStoreCmd = &cobra.Command{
+	Use:     "aip-store",
+	Aliases: []string{"store"},
+	Short:   "Work with AIPs in the AIP storage locations",
+	Long: `Work with AIPs in the AIP storage locations.
+
+The storage locations are configured in the file set by CA4M_AIP_STORAGE_CONFIG_PATH.
+Without --location, the first location is used.`,
+}
+
+var aipStoreListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored AIPs",
+	Args:  cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx := context.Background()
+		svc := newCommandService(ctx)
+		defer svc.Close()
+
+		uuids, err := svc.ListStoredAIPs(ctx, aipStoreLocation)
+		if err != nil {
+			fatal(err, "Error listing AIPs: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"aips": orEmpty(uuids)})
+			return
+		}
+		for _, uuid := range uuids {
+			//nolint:forbidigo // Command output is written to stdout
+			fmt.Println(uuid)
+		}
+	},
+}
+
+var aipStoreFetchCmd = &cobra.Command{
+	Use:   "fetch <aip-uuid>",
+	Short: "Fetch and verify an AIP for reingest",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		svc := newCommandService(ctx)
+		defer svc.Close()
+
+		if dryRun {
+			actions, err := svc.PlanFetchAIP(ctx, aipStoreLocation, args[0], aipStoreDest)
+			if err != nil {
+				fatal(err, "Error planning the fetch of AIP: %v", err)
+			}
+			printPlanned(actions, nil)
+			return
+		}
+		path, err := svc.FetchAIP(ctx, aipStoreLocation, args[0], aipStoreDest)
+		if err != nil {
+			fatal(err, "Error fetching AIP: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(map[string]string{"path": path})
+			return
+		}
+		//nolint:forbidigo // Command output is written to stdout
+		fmt.Println(path)
+	},
+}
+
+var aipStoreVerifyCmd = &cobra.Command{
+	Use:   "verify <aip-uuid>...",
+	Short: "Check the fixity of stored AIPs",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		svc := newCommandService(ctx)
+
+		var verifications []aipVerification
+		var errs commandErrors
+		for _, aipUUID := range args {
+			report, err := svc.VerifyAIP(ctx, aipStoreLocation, aipUUID)
+			if err != nil {
+				errs.add("Error verifying AIP %s: %v", aipUUID, err)
+				continue
+			}
+			for _, failure := range report.Failures {
+				logger.Error("Fixity failure in AIP %s: %s (expected %s, got %s) %s", aipUUID, failure.Path, failure.Expected, failure.Actual, failure.Error)
+			}
+			status := "OK"
+			if !report.Success() {
+				status = "FAILED"
+			}
+			verifications = append(verifications, aipVerification{FixityReport: report, Status: status})
+			if !jsonOutput() {
+				//nolint:forbidigo // Command output is written to stdout
+				fmt.Printf("%s\t%s\t%d files\t%d failures\n", aipUUID, status, report.Files, len(report.Failures))
+			}
+		}
+		// Close before exiting so fixity failures are notified
+		svc.Close()
+		failed := len(errs) > 0
+		// AIPs that could not be verified fail without a fixity failure
+		code := ExitFailure
+		for _, verification := range verifications {
+			failed = failed || !verification.Success()
+			if len(verification.Failures) > 0 {
+				code = ExitIntegrity
+			}
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"aips": orEmpty(verifications), "errors": orEmpty(errs)})
+		}
+		if failed {
+			logger.Error("Fixity check failed")
+			os.Exit(code)
+		}
+	},
+}
+
+var aipStoreRestoreCmd = &cobra.Command{
+	Use:   "restore <aip-uuid>...",
+	Short: "Restore AIPs from an archive tier",
+	Long: `Restore AIPs from an archive tier (S3 GLACIER or DEEP_ARCHIVE) so they can be fetched or verified.
+
+Restores are requested for the archived files that are not restored yet, so the command
+can be run again to check the progress. fetch and verify restore archived AIPs themselves
+and wait for them; restore lets the restore run ahead, e.g. before a planned reingest.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		svc := newCommandService(ctx)
+		defer svc.Close()
+
+		if dryRun {
+			var actions []preservation.PlannedAction
+			var errs commandErrors
+			for _, aipUUID := range args {
+				planned, err := svc.PlanRestoreAIP(ctx, aipStoreLocation, aipUUID, aipStoreWait)
+				if err != nil {
+					errs.add("Error planning the restore of AIP %s: %v", aipUUID, err)
+					continue
+				}
+				actions = append(actions, planned...)
+			}
+			printPlanned(actions, errs)
+			if len(errs) > 0 {
+				svc.Close()
+				logger.Error("Restore failed")
+				os.Exit(ExitFailure)
+			}
+			return
+		}
+		var restorations []aipRestoration
+		var errs commandErrors
+		for _, aipUUID := range args {
+			status, err := svc.RestoreAIP(ctx, aipStoreLocation, aipUUID, aipStoreWait, func(st *aipstore.RestoreStatus) {
+				if !st.Ready() {
+					logger.Info("Restore of AIP %s in progress, %d of %d files pending", st.AIPUUID, st.Pending, st.Archived)
+				}
+			})
+			if err != nil {
+				errs.add("Error restoring AIP %s: %v", aipUUID, err)
+				continue
+			}
+			state := "restoring"
+			switch {
+			case status.Archived == 0:
+				state = "available"
+			case status.Ready():
+				state = "restored"
+			}
+			restorations = append(restorations, aipRestoration{RestoreStatus: status, State: state})
+			if jsonOutput() {
+				continue
+			}
+			if state == "restored" {
+				state += " until " + status.ExpiresAt.Format("2006-01-02 15:04")
+			}
+			//nolint:forbidigo // Command output is written to stdout
+			fmt.Printf("%s\t%s\t%d files\t%d archived\t%d pending\n", aipUUID, state, status.Files, status.Archived, status.Pending)
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"aips": orEmpty(restorations), "errors": orEmpty(errs)})
+		}
+		if len(errs) > 0 {
+			svc.Close()
+			logger.Error("Restore failed")
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+var aipStoreMigrateCmd = &cobra.Command{
+	Use:   "migrate --to <layout> [aip-uuid...]",
+	Short: "Move the stored AIPs to another layout",
+	Long: `Move the AIPs of a storage location to another layout (flat or quad), or only the given AIPs.
+
+Each file is read back, verified against the manifest of its AIP and stored below the key
+prefix of the new layout. Once every file and the manifest are stored, the AIP is removed
+from its old layout and the replica of its package records is updated. AIPs can be fetched
+and verified while they are moved, from whichever layout holds their manifest.
+
+An interrupted migration is resumed by running the command again: AIPs already in the new
+layout are left in place and files already copied are not copied again. Once every AIP is
+moved, set the layout of the location in the AIP storage configuration to the new layout.`,
+	Run: func(_ *cobra.Command, args []string) {
+		if !slices.Contains(config.StorageLayouts, aipStoreLayout) {
+			logger.Exit(ExitUsage, "Invalid --to %q, expected one of %s", aipStoreLayout, strings.Join(config.StorageLayouts, ", "))
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		svc := newCommandService(ctx)
+		defer svc.Close()
+
+		if dryRun {
+			actions, err := svc.PlanMigrateLayout(ctx, aipStoreLocation, aipStoreLayout, args)
+			if err != nil {
+				svc.Close()
+				fatal(err, "Error planning the migration: %v", err)
+			}
+			printPlanned(actions, nil)
+			return
+		}
+		results, err := svc.MigrateLayout(ctx, aipStoreLocation, aipStoreLayout, args, func(aipUUID string, n, total int) {
+			logger.Info("Migrating AIP %s (%d of %d)", aipUUID, n, total)
+		})
+		if results == nil && err != nil {
+			svc.Close()
+			fatal(err, "Error migrating AIPs: %v", err)
+		}
+		var errs commandErrors
+		for _, result := range results {
+			if result.Error != "" {
+				errs.add("Error migrating AIP %s: %s", result.AIPUUID, result.Error)
+			}
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"aips": orEmpty(results), "errors": orEmpty(errs)})
+		} else {
+			printMigrations(results)
+		}
+		if err != nil {
+			svc.Close()
+			if len(errs) == 0 {
+				fatal(err, "Migration interrupted, run it again to resume: %v", err)
+			}
+			fatal(err, "%d AIPs could not be migrated, run the migration again to resume", len(errs))
+		}
+	},
+}
+
+// printMigrations prints a table of the migrations of the AIPs and their totals.
+func printMigrations(results []*preservation.MigrationResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "AIP\tSTATUS\tFILES\tCOPIED\tKEY")
+	moved := 0
+	for _, result := range results {
+		status := "in place"
+		switch {
+		case result.Error != "":
+			status = "failed"
+		case result.Moved():
+			status = "moved from " + result.From
+			moved++
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", result.AIPUUID, status, result.Files, result.Copied, orDash(result.Key))
+	}
+	_ = w.Flush()
+	//nolint:forbidigo // Command output is written to stdout
+	fmt.Printf("%d of %d AIPs moved\n", moved, len(results))
+}
+
+func init() {
+	aipStoreMigrateCmd.Flags().StringVar(&aipStoreLayout, "to", "", "Layout the AIPs are moved to: flat or quad")
+	_ = aipStoreMigrateCmd.MarkFlagRequired("to")
+	_ = aipStoreMigrateCmd.RegisterFlagCompletionFunc("to", cobra.FixedCompletions(config.StorageLayouts, cobra.ShellCompDirectiveNoFileComp))
+	aipStoreFetchCmd.Flags().StringVarP(&aipStoreDest, "dest", "o", ".", "Directory the AIP is fetched to")
+	aipStoreRestoreCmd.Flags().BoolVar(&aipStoreWait, "wait", false, "Wait until the AIPs are restored")
+
+	aipStoreCmd.PersistentFlags().StringVar(&aipStoreLocation, "location", "", "Storage location name (defaults to the first location)")
+	aipStoreCmd.PersistentFlags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	aipStoreCmd.AddCommand(aipStoreListCmd, aipStoreFetchCmd, aipStoreVerifyCmd, aipStoreRestoreCmd, aipStoreMigrateCmd)
+	RootCmd.AddCommand(aipStoreCmd)
+}
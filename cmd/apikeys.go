@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/internal/apikeys"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	apiKeysName    string
+	apiKeysRole    string
+	apiKeysTenant  string
+	apiKeysExpires time.Duration
+)
+
+var apiKeysCmd = &cobra.Command{
+	Use:   "api-keys",
+	Short: "Manage the API keys of the HTTP API",
+	Long: `Manage the API keys of the HTTP API.
+
+Keys are kept in the database set by CA4M_AUTH_API_KEYS_PATH, shared with the running service:
+created keys can be used and revoked keys are rejected at once. Use these commands to create
+the first admin key, further keys can be managed through the /admin/api-keys endpoints.`,
+}
+
+var apiKeysCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API key",
+	Long: `Create an API key granting a role: viewer, submitter, operator or admin.
+Keys bound to a tenant only see the jobs and packages of the tenant.
+
+The key is printed once, only its hash is stored.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx := context.Background()
+		cfg := loadAPIKeysConfig()
+
+		if apiKeysTenant != "" {
+			tenants, err := config.LoadTenantsConfig(cfg.Tenants.ConfigPath)
+			if err != nil {
+				logger.Fatal("Error loading tenants: %v", err)
+			}
+			if tenants.Tenant(apiKeysTenant) == nil {
+				logger.Fatal("Unknown tenant %q, tenants are read from %s", apiKeysTenant, cfg.Tenants.ConfigPath)
+			}
+		}
+		var expiresAt time.Time
+		if apiKeysExpires > 0 {
+			expiresAt = time.Now().Add(apiKeysExpires)
+		}
+		if dryRun {
+			if err := apikeys.Validate(apiKeysName, apiKeysRole, expiresAt); err != nil {
+				logger.Fatal("Error creating API key: %v", err)
+			}
+			action := fmt.Sprintf("Create API key %q with role %s", apiKeysName, apiKeysRole)
+			if apiKeysTenant != "" {
+				action += " for tenant " + apiKeysTenant
+			}
+			if !expiresAt.IsZero() {
+				action += ", expiring at " + formatKeyTime(&expiresAt)
+			}
+			printPlanned([]preservation.PlannedAction{{Action: action}}, nil)
+			return
+		}
+		store, err := apikeys.Open(ctx, cfg)
+		if err != nil {
+			logger.Fatal("Error opening API keys: %v", err)
+		}
+		defer func() { _ = store.Close() }()
+		key, value, err := store.Create(ctx, apiKeysName, apiKeysRole, apiKeysTenant, os.Getenv("USER"), expiresAt)
+		if err != nil {
+			logger.Fatal("Error creating API key: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(internal.CreateAPIKeyResponse{Key: key, Value: value})
+			return
+		}
+		//nolint:forbidigo // Command output is written to stdout
+		fmt.Println(value)
+	},
+}
+
+var apiKeysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the API keys",
+	Args:  cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx := context.Background()
+		store, _ := openAPIKeys(ctx)
+		defer func() { _ = store.Close() }()
+
+		keys, err := store.List(ctx)
+		if err != nil {
+			logger.Fatal("Error listing API keys: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"keys": orEmpty(keys)})
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ID\tNAME\tROLE\tTENANT\tCREATED\tEXPIRES\tLAST USED\tREVOKED")
+		for _, key := range keys {
+			tenant := key.Tenant
+			if tenant == "" {
+				tenant = "-"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Role, tenant, formatKeyTime(&key.CreatedAt),
+				formatKeyTime(key.ExpiresAt), formatKeyTime(key.LastUsedAt), formatKeyTime(key.RevokedAt))
+		}
+		_ = w.Flush()
+	},
+}
+
+var apiKeysRevokeCmd = &cobra.Command{
+	Use:   "revoke <key-id>...",
+	Short: "Revoke API keys",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		store, _ := openAPIKeys(ctx)
+
+		var errs commandErrors
+		if dryRun {
+			var actions []preservation.PlannedAction
+			for _, id := range args {
+				key, err := store.Get(ctx, id)
+				if err != nil {
+					errs.add("Error revoking API key %s: %v", id, err)
+					continue
+				}
+				action := fmt.Sprintf("Revoke API key %s (%s)", key.ID, key.Name)
+				if key.RevokedAt != nil {
+					action = fmt.Sprintf("Keep API key %s (%s) revoked since %s", key.ID, key.Name, formatKeyTime(key.RevokedAt))
+				}
+				actions = append(actions, preservation.PlannedAction{Action: action})
+			}
+			_ = store.Close()
+			printPlanned(actions, errs)
+			if len(errs) > 0 {
+				os.Exit(ExitFailure)
+			}
+			return
+		}
+		var revoked []*apikeys.Key
+		for _, id := range args {
+			key, err := store.Revoke(ctx, id)
+			if err != nil {
+				errs.add("Error revoking API key %s: %v", id, err)
+				continue
+			}
+			logger.Info("Revoked API key %s (%s)", key.ID, key.Name)
+			revoked = append(revoked, key)
+		}
+		_ = store.Close()
+		if jsonOutput() {
+			writeJSON(map[string]any{"keys": orEmpty(revoked), "errors": orEmpty(errs)})
+		}
+		if len(errs) > 0 {
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+// openAPIKeys loads the configuration and opens the API key database for a subcommand.
+func openAPIKeys(ctx context.Context) (*apikeys.Store, *config.Config) {
+	cfg := loadAPIKeysConfig()
+	store, err := apikeys.Open(ctx, cfg)
+	if err != nil {
+		logger.Fatal("Error opening API keys: %v", err)
+	}
+	return store, cfg
+}
+
+// loadAPIKeysConfig loads the configuration for a subcommand, warning if the API keys are disabled.
+func loadAPIKeysConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		fatalConfig(err)
+	}
+	initLogger(cfg)
+	if !cfg.Auth.APIKeys.Enabled {
+		logger.Warn("API keys are disabled, the service will not accept them until CA4M_AUTH_API_KEYS_ENABLED is set")
+	}
+	return cfg
+}
+
+// formatKeyTime formats an optional time of an API key.
+func formatKeyTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func init() {
+	apiKeysCreateCmd.Flags().StringVar(&apiKeysName, "name", "", "Name of the key, e.g. the client using it (required)")
+	apiKeysCreateCmd.Flags().StringVar(&apiKeysRole, "role", config.RoleViewer, "Role granted by the key: viewer, submitter, operator or admin")
+	apiKeysCreateCmd.Flags().StringVar(&apiKeysTenant, "tenant", "", "Tenant the key is bound to (default the whole service)")
+	apiKeysCreateCmd.Flags().DurationVar(&apiKeysExpires, "expires-in", 0, "Lifetime of the key, e.g. 720h (default no expiry)")
+	_ = apiKeysCreateCmd.MarkFlagRequired("name")
+
+	apiKeysCmd.AddCommand(apiKeysCreateCmd, apiKeysListCmd, apiKeysRevokeCmd)
+	RootCmd.AddCommand(apiKeysCmd)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/audit"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditSince    string
+	auditUntil    string
+	auditUsername string
+	auditAction   string
+	auditOutcome  string
+	auditFormat   string
+	auditOutput   string
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Read the audit log of the HTTP API",
+	Long: `Read the audit log of the HTTP API.
+
+Entries are appended to a file per day in the directory set by CA4M_AUDIT_DIR, shared with the
+running service. Files older than CA4M_AUDIT_RETENTION_DAYS are removed.`,
+}
+
+var auditExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the entries of the audit log",
+	Long: `Export the entries of the audit log, oldest first, as JSON lines or CSV.
+
+Entries can be filtered by time, user, action and outcome, e.g. to hand the denied requests of a
+month to a security review.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		cfg, err := config.Load()
+		if err != nil {
+			fatalConfig(err)
+		}
+		initLogger(cfg)
+		if !cfg.Audit.Enabled {
+			logger.Warn("The audit log is disabled, the service does not record actions until CA4M_AUDIT_ENABLED is set")
+		}
+		filter := audit.Filter{Username: auditUsername, Action: auditAction, Outcome: auditOutcome}
+		filter.Since = parseAuditTime("since", auditSince)
+		filter.Until = parseAuditTime("until", auditUntil)
+		log, err := audit.Open(cfg)
+		if err != nil {
+			logger.Fatal("Error opening audit log: %v", err)
+		}
+		defer func() { _ = log.Close() }()
+
+		toFile := auditOutput != "" && auditOutput != "-"
+		if jsonOutput() && !toFile {
+			entries := []*audit.Entry{}
+			err := log.Each(filter, func(entry *audit.Entry) error {
+				entries = append(entries, entry)
+				return nil
+			})
+			if err != nil {
+				logger.Fatal("Error exporting audit log: %v", err)
+			}
+			writeJSON(map[string]any{"entries": entries})
+			return
+		}
+		out := os.Stdout
+		if toFile {
+			if out, err = os.Create(auditOutput); err != nil {
+				logger.Fatal("Error creating %s: %v", auditOutput, err)
+			}
+		}
+		w := bufio.NewWriter(out)
+		if err := log.Export(w, filter, auditFormat); err != nil {
+			logger.Fatal("Error exporting audit log: %v", err)
+		}
+		if err := w.Flush(); err != nil {
+			logger.Fatal("Error writing export: %v", err)
+		}
+		if err := out.Close(); err != nil {
+			logger.Fatal("Error writing export: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(map[string]string{"file": auditOutput})
+		}
+	},
+}
+
+// parseAuditTime parses the RFC 3339 time of a flag, zero if the flag is not set.
+func parseAuditTime(flag, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logger.Exit(ExitUsage, "Invalid --%s %q, expected an RFC 3339 time", flag, value)
+	}
+	return t
+}
+
+func init() {
+	auditExportCmd.Flags().StringVar(&auditSince, "since", "", "Export the entries from this RFC 3339 time")
+	auditExportCmd.Flags().StringVar(&auditUntil, "until", "", "Export the entries before this RFC 3339 time")
+	auditExportCmd.Flags().StringVar(&auditUsername, "username", "", "Export the entries of a user")
+	auditExportCmd.Flags().StringVar(&auditAction, "action", "", "Export the entries of an operation of the API, e.g. cancelJob")
+	auditExportCmd.Flags().StringVar(&auditOutcome, "outcome", "", "Export the entries of an outcome: success, denied or failure")
+	auditExportCmd.Flags().StringVar(&auditFormat, "format", audit.FormatJSONLines, "Format of the export: jsonl or csv")
+	auditExportCmd.Flags().StringVarP(&auditOutput, "file", "o", "", "File the export is written to (default stdout)")
+
+	auditCmd.AddCommand(auditExportCmd)
+	RootCmd.AddCommand(auditCmd)
+}
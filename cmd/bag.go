@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/penwern/curate-preservation-core/internal/bagit"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/validation"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bagMD5    bool
+	bagSHA1   bool
+	bagSHA256 bool
+	bagSHA512 bool
+	bagInfo   []string
+)
+
+var bagCmd = &cobra.Command{
+	Use:   "bag",
+	Short: "Create and validate BagIt bags",
+}
+
+var bagCreateCmd = &cobra.Command{
+	Use:   "create <src> <dest>",
+	Short: "Create a BagIt bag from a file or directory",
+	Long: `Create a BagIt bag (RFC 8493) at dest with a copy of src, a file or a directory, as its payload.
+
+The destination must not exist or be an empty directory. A manifest and a tag manifest are written
+for each checksum algorithm selected, sha256 if none is. bag-info.txt records the bagging date, the
+Payload-Oxum and the software agent, with the tags given by --info Name=Value, which can be repeated.
+No configuration is needed.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(_ *cobra.Command, args []string) {
+		opts := bagit.CreateOptions{DryRun: dryRun}
+		for i, selected := range []bool{bagMD5, bagSHA1, bagSHA256, bagSHA512} {
+			if selected {
+				opts.Algorithms = append(opts.Algorithms, utils.SupportedChecksumAlgorithms[i])
+			}
+		}
+		for _, s := range bagInfo {
+			tag, err := bagit.ParseTag(s)
+			if err != nil {
+				logger.Fatal("%v", err)
+			}
+			opts.Info = append(opts.Info, tag)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		bag, err := bagit.Create(ctx, args[0], args[1], opts)
+		if err != nil {
+			logger.Fatal("Error creating bag: %v", err)
+		}
+		if dryRun {
+			printPlanned([]preservation.PlannedAction{
+				{Stage: catalog.EventPackaging, Action: fmt.Sprintf("Copy %s to the payload of bag %s: %d files, %d bytes", args[0], bag.Path, bag.Files, bag.Size)},
+				{Stage: catalog.EventFixity, Action: "Write manifests and tag manifests: " + strings.Join(bag.Algorithms, ", ")},
+				{Stage: catalog.EventPackaging, Action: "Write bagit.txt and bag-info.txt"},
+			}, nil)
+			return
+		}
+		if jsonOutput() {
+			writeJSON(bag)
+			return
+		}
+		//nolint:forbidigo // Command output is written to stdout
+		fmt.Printf("Created bag %s: %d files, %d bytes\n", bag.Path, bag.Files, bag.Size)
+	},
+}
+
+var bagValidateCmd = &cobra.Command{
+	Use:   "validate <path>...",
+	Short: "Validate BagIt bags",
+	Long: `Validate BagIt bags, as directories or archives (zip, tar or 7z).
+
+The BagIt declaration, the completeness and checksums of the payload, the tag manifests and the
+Payload-Oxum are checked, as by the bagit check of the validate command. A JSON report is written
+per bag, one per line, or a single document with every report with --output json. The command exits
+with status 6 if a payload does not match its checksums or Payload-Oxum, or 3 if any bag is otherwise
+invalid or cannot be read.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		encoder := json.NewEncoder(os.Stdout)
+		valid := true
+		code := ExitValidation
+		var reports []*validation.Report
+		for _, path := range args {
+			report, err := validation.Validate(ctx, path, validation.CheckBagIt)
+			if ctx.Err() != nil {
+				logger.Fatal("Validation interrupted")
+			}
+			if err != nil {
+				report = &validation.Report{
+					Path:   path,
+					Checks: []string{validation.CheckBagIt},
+					Errors: []validation.Issue{{Check: "read", Message: err.Error()}},
+				}
+			}
+			valid = valid && report.Valid
+			if report.Mismatched() {
+				code = ExitIntegrity
+			}
+			if jsonOutput() {
+				reports = append(reports, report)
+				continue
+			}
+			if err := encoder.Encode(report); err != nil {
+				logger.Fatal("Error writing report: %v", err)
+			}
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"valid": valid, "reports": reports})
+		}
+		if !valid {
+			os.Exit(code)
+		}
+	},
+}
+
+func init() {
+	bagCreateCmd.Flags().BoolVar(&bagMD5, "md5", false, "Write an MD5 manifest")
+	bagCreateCmd.Flags().BoolVar(&bagSHA1, "sha1", false, "Write a SHA-1 manifest")
+	bagCreateCmd.Flags().BoolVar(&bagSHA256, "sha256", false, "Write a SHA-256 manifest (the default if no algorithm is selected)")
+	bagCreateCmd.Flags().BoolVar(&bagSHA512, "sha512", false, "Write a SHA-512 manifest")
+	bagCreateCmd.Flags().StringArrayVar(&bagInfo, "info", nil, "Tag added to bag-info.txt as Name=Value, can be repeated")
+
+	bagCmd.AddCommand(bagCreateCmd, bagValidateCmd)
+	RootCmd.AddCommand(bagCmd)
+}
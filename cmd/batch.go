@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchFormat    string
+	batchUsername  string
+	batchProfile   string
+	batchReference string
+	batchParallel  int
+	batchResults   string
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <manifest>",
+	Short: "Preserve the packages listed in a CSV or JSON manifest",
+	Long: `Preserve the packages listed in a batch manifest, a few at a time, and write the outcome of each to a results CSV.
+
+A CSV manifest has a header row naming its columns: path, and optionally source, profile and
+metadata keys such as dc.title or isadg.reference_code. Each following row is a package: a resolved
+Cells path, or a path in the transfer source of the row, preserved with the profile and metadata of
+the row. A JSON manifest has the shape of a POST /batches request. Manifests ending in .json are read
+as JSON, others as CSV, unless --format is set.
+
+The batch is recorded like the batches submitted to the API, and its packages are preserved by this
+process rather than by the job queue, up to --parallel at a time within the global concurrency limit.
+When interrupted, packages not started are skipped and running ones are drained. The results CSV has
+the path, source, profile, status, package ID, AIP UUID, state and error of each package, in the
+order of the manifest. The command exits with status 1 if any package was not preserved.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		manifest := args[0]
+		format := batchFormat
+		if format == "" {
+			format = "csv"
+			if strings.EqualFold(filepath.Ext(manifest), ".json") {
+				format = "json"
+			}
+		}
+		file, err := os.Open(filepath.Clean(manifest))
+		if err != nil {
+			fatal(err, "Error opening manifest: %v", err)
+		}
+		req, err := internal.ParseBatchManifest(file, format)
+		_ = file.Close()
+		if err != nil {
+			logger.Exit(ExitValidation, "Error reading manifest %s: %v", manifest, err)
+		}
+		flags := cmd.Flags()
+		if flags.Changed("cells-username") {
+			req.Username = batchUsername
+		}
+		if flags.Changed("profile") {
+			req.Profile = batchProfile
+		}
+		if flags.Changed("reference") {
+			req.Reference = batchReference
+		}
+		if batchParallel < 1 {
+			logger.Exit(ExitUsage, "Invalid parallelism %d, at least 1 package is preserved at a time", batchParallel)
+		}
+		if err := req.Validate(); err != nil {
+			logger.Exit(ExitValidation, "Invalid manifest %s:\n%v", manifest, err)
+		}
+		results := batchResults
+		if results == "" {
+			results = strings.TrimSuffix(manifest, filepath.Ext(manifest)) + "-results.csv"
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			fatalConfig(err)
+		}
+		var display *progressDisplay
+		if !dryRun {
+			display = newProgressDisplay()
+		}
+		initLogger(cfg)
+		if err := utils.SetUUIDVersion(cfg.UUIDVersion); err != nil {
+			fatal(err, "Error configuring identifiers: %v", err)
+		}
+		if allowInsecureTLS {
+			cfg.AllowInsecureTLS = allowInsecureTLS
+		}
+		svc, err := internal.NewService(ctx, cfg)
+		if err != nil {
+			fatal(err, "Error creating service: %v", err)
+		}
+		defer svc.Close()
+
+		if dryRun {
+			actions, err := svc.PlanBatch(ctx, req)
+			if err != nil {
+				svc.Close()
+				fatal(err, "Error planning batch: %v", err)
+			}
+			printPlanned(append(actions, preservation.PlannedAction{Action: "Write the results to " + results}), nil)
+			return
+		}
+
+		// Running preservations are drained when interrupted, like in watch mode
+		runCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		finished := make(chan struct{})
+		go func() {
+			select {
+			case <-finished:
+			case <-runCtx.Done():
+				drainCtx, cancel := context.WithTimeout(ctx, cfg.Shutdown.DrainTimeout)
+				defer cancel()
+				logger.Info("Interrupted, running preservations have %s to complete", cfg.Shutdown.DrainTimeout)
+				if err := svc.Shutdown(drainCtx); err != nil {
+					logger.Error("Error shutting down: %v", err)
+				}
+			}
+		}()
+		stopProgress := display.Follow(svc.Catalog())
+		batch, err := svc.RunBatch(runCtx, req, "", batchParallel)
+		stopProgress()
+		close(finished)
+		if err != nil {
+			svc.Close()
+			fatal(err, "Error running batch: %v", err)
+		}
+
+		if err := writeBatchResults(results, batch); err != nil {
+			svc.Close()
+			fatal(err, "Error writing results: %v", err)
+		}
+		logger.Info("Batch %s %s: %d of %d packages completed, results written to %s",
+			batch.ID, batch.Status, batch.Counts[catalog.BatchEntryCompleted], len(batch.Entries), results)
+		if jsonOutput() {
+			writeJSON(map[string]any{"batch": batch, "results": results})
+		}
+		if batch.Status != catalog.BatchCompleted {
+			svc.Close()
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+// writeBatchResults writes the outcome of each package of a batch to a CSV file.
+func writeBatchResults(path string, batch *catalog.Batch) error {
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	w := csv.NewWriter(file)
+	_ = w.Write([]string{"path", "source", "profile", "status", "package_id", "aip_uuid", "state", "error", "updated_at"})
+	for _, entry := range batch.Entries {
+		_ = w.Write([]string{
+			entry.Path, entry.Source, entry.Profile, entry.Status, entry.PackageID, entry.AIPUUID,
+			string(entry.State), entry.Error, entry.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func init() {
+	batchCmd.Flags().StringVar(&batchFormat, "format", "", "Manifest format: csv or json (default from the file extension)")
+	batchCmd.Flags().StringVarP(&batchUsername, "cells-username", "u", "", "Cells user the packages are preserved as (required unless set in a JSON manifest)")
+	batchCmd.Flags().StringVar(&batchProfile, "profile", "", "Processing profile of the packages without one (default the profile of their path)")
+	batchCmd.Flags().StringVar(&batchReference, "reference", "", "Reference of the batch, e.g. an accession number")
+	batchCmd.Flags().IntVar(&batchParallel, "parallel", 2, "Packages preserved at a time")
+	batchCmd.Flags().StringVar(&batchResults, "results", "", "Results CSV file (default <manifest>-results.csv)")
+	batchCmd.Flags().BoolVar(&noProgress, "no-progress", false, "Log plainly instead of showing the progress of the stages in a terminal")
+	batchCmd.Flags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+
+	_ = batchCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"csv", "json"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = batchCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	RootCmd.AddCommand(batchCmd)
+}
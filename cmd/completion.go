@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/client"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds the requests to the service API completing job IDs, so that a shell never hangs.
+const completionTimeout = 5 * time.Second
+
+var completionCmd = &cobra.Command{
+	Use:   "completion <bash|zsh|fish>",
+	Short: "Generate the shell completion script",
+	Long: `Generate the completion script of a shell, completing the commands, flags and their values.
+
+Job IDs are completed from the jobs of the running service, as listed by jobs list, and profile
+names from the profiles file. Load the script in the current shell, or install it for every session:
+
+  # bash
+  source <(ca4m completion bash)
+  ca4m completion bash > /etc/bash_completion.d/ca4m
+
+  # zsh, with compinit enabled
+  ca4m completion zsh > "${fpath[1]}/_ca4m"
+
+  # fish
+  ca4m completion fish > ~/.config/fish/completions/ca4m.fish`,
+	Args:                  cobra.ExactArgs(1),
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		switch args[0] {
+		case "bash":
+			err = cmd.Root().GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			err = cmd.Root().GenZshCompletion(os.Stdout)
+		case "fish":
+			err = cmd.Root().GenFishCompletion(os.Stdout, true)
+		default:
+			logger.Exit(ExitUsage, "Unsupported shell %q, expected bash, zsh or fish", args[0])
+		}
+		if err != nil {
+			fatal(err, "Error generating completion script: %v", err)
+		}
+	},
+}
+
+// completeProfiles completes the names of the processing profiles of the profiles file.
+func completeProfiles(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	names, err := config.ProfileNames()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeJobIDs completes the IDs of the jobs of the running service with one of the statuses, or any status if
+// none is given, described by their status. Jobs already given as arguments are left out.
+func completeJobIDs(statuses ...string) cobra.CompletionFunc {
+	return func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+		c, err := jobsClient()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+		jobs, err := c.ListJobs(ctx, &client.ListJobsParams{})
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		var ids []string
+		for _, job := range jobs {
+			if len(statuses) > 0 && !slices.Contains(statuses, job.Status) || slices.Contains(args, job.ID) {
+				continue
+			}
+			ids = append(ids, job.ID+"\t"+job.Status)
+		}
+		return ids, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(completionCmd)
+}
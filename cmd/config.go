@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/internal/health"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configFormat string
+	configProbe  bool
+)
+
+// configCheck is the result of a check of the config validate command.
+type configCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// statusNotConfigured is the status of the configuration files that don't exist.
+const statusNotConfigured = "not configured"
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Validate and show the configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the settings and configuration files",
+	Long: `Validate the settings from the environment variables and .env file, and the configuration files they
+reference, without starting the service.
+
+Every problem is reported, not only the first: the settings are checked like at startup, then each
+configuration file is loaded and validated, or reported as not configured if it does not exist. With
+--probe, a3m and Cells are connected to, and so are AtoM, the Storage Service and the AIP storage
+locations when their files are configured, each within CA4M_HEALTH_TIMEOUT. Results are printed as
+a table, or as JSON with --format json or --output json. The command exits with status 3 if any check failed.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		if configFormat != "table" && configFormat != "json" {
+			logger.Exit(ExitUsage, "Invalid format %q, expected table or json", configFormat)
+		}
+		cfg, err := config.Read()
+		if err != nil {
+			logger.Fatal("Error reading configuration: %v", err)
+		}
+		if allowInsecureTLS {
+			cfg.AllowInsecureTLS = allowInsecureTLS
+		}
+
+		checks := []configCheck{{Name: "settings", Status: health.StatusOK}}
+		if err := cfg.Validate(); err != nil {
+			checks[0].Status = health.StatusFail
+			checks[0].Error = err.Error()
+		}
+		files := config.Files(cfg)
+		for _, file := range files {
+			check := configCheck{Name: "file:" + file.Name, Status: health.StatusOK, Detail: file.Path}
+			switch {
+			case file.Err != nil:
+				check.Status = health.StatusFail
+				check.Error = file.Err.Error()
+			case !file.Configured():
+				check.Status = statusNotConfigured
+			}
+			checks = append(checks, check)
+		}
+		if configProbe {
+			probes := internal.ProbeChecks(cfg, files)
+			report := health.Run(context.Background(), probes, max(cfg.Health.Timeout, time.Second))
+			for _, probe := range probes {
+				result := report.Checks[probe.Name]
+				detail := fmt.Sprintf("%dms", result.Duration)
+				if result.Detail != "" {
+					detail = result.Detail + " (" + detail + ")"
+				}
+				checks = append(checks, configCheck{Name: "probe:" + probe.Name, Status: result.Status, Detail: detail, Error: result.Error})
+			}
+		}
+
+		failed := false
+		for _, check := range checks {
+			failed = failed || check.Status == health.StatusFail
+		}
+		printConfigChecks(checks, failed)
+		if failed {
+			os.Exit(ExitValidation)
+		}
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration, with secrets redacted",
+	Long: `Show the effective configuration as JSON: the settings merged from their defaults, the .env file and
+the environment variables, keyed by their names in the CA4M_* variables, and the configuration
+files they reference that exist.
+
+Secret references are resolved, and the values of secrets, such as tokens, passwords and API
+keys, and the passwords of URLs are replaced by REDACTED. The settings are shown even if they are
+invalid, while configuration files that cannot be loaded are skipped with a warning. Use config
+validate to check them.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		cfg, err := config.Read()
+		if err != nil {
+			logger.Fatal("Error reading configuration: %v", err)
+		}
+		shown := map[string]any{"settings": cfg.Settings()}
+		files := map[string]any{}
+		for _, file := range config.Files(cfg) {
+			if file.Err != nil {
+				logger.Warn("Configuration file %s of %s not shown: %v", file.Path, file.Name, file.Err)
+				continue
+			}
+			if file.Config == nil {
+				continue
+			}
+			redacted, err := config.Redact(file.Config)
+			if err != nil {
+				logger.Fatal("Error showing %s: %v", file.Path, err)
+			}
+			files[file.Name] = redacted
+		}
+		shown["files"] = files
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(shown); err != nil {
+			logger.Fatal("Error writing configuration: %v", err)
+		}
+	},
+}
+
+// printConfigChecks prints the results of the configuration checks as a table, or as JSON.
+func printConfigChecks(checks []configCheck, failed bool) {
+	if configFormat == "json" || jsonOutput() {
+		status := health.StatusOK
+		if failed {
+			status = health.StatusFail
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(map[string]any{"status": status, "checks": checks}); err != nil {
+			logger.Fatal("Error writing results: %v", err)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	for _, check := range checks {
+		detail := check.Detail
+		if check.Error != "" {
+			// Validation errors have a line per field
+			errText := strings.ReplaceAll(strings.TrimSpace(check.Error), "\n", "; ")
+			if detail != "" {
+				detail += ": "
+			}
+			detail += errText
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, check.Status, orDash(detail))
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	configValidateCmd.Flags().StringVar(&configFormat, "format", "table", "Output format: table or json")
+	configValidateCmd.Flags().BoolVar(&configProbe, "probe", false, "Check that a3m, Cells, AtoM, the Storage Service and the AIP storage locations can be reached")
+	configValidateCmd.Flags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	_ = configValidateCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"table", "json"}, cobra.ShellCompDirectiveNoFileComp))
+	configCmd.AddCommand(configValidateCmd, configShowCmd)
+	RootCmd.AddCommand(configCmd)
+}
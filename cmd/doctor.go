@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/internal/health"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var doctorSf string
+
+// statusWarn is the status of the failed diagnostics that only disable a feature.
+const statusWarn = "warn"
+
+// doctorCheck is the result of a diagnostic of the doctor command.
+type doctorCheck struct {
+	configCheck
+	Fix string `json:"fix,omitempty"`
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the external dependencies and directories of the service",
+	Long: `Check that the external dependencies of preservations are installed and reachable, and that the
+directories have the permissions and free space they need, with the fix of each problem found.
+
+The settings are validated, then a3m, Cells and the services of the configured files are connected
+to, and the ClamAV daemon is asked for the version of its signatures. The versions of cec, of the
+thumbnail tools (convert, pdftoppm and ffmpeg), and of siegfried (CA4M_PRONOM_SF_PATH, or --sf)
+with its signature file are reported, and so are rsync for AtoM deliveries and rclone for rclone
+storage locations when they are configured. AIPs compressed with 7-Zip are extracted in process, no
+7z binary is needed. The processing, data and A3M completed and dips directories must be writable,
+with CA4M_HEALTH_MIN_FREE_SPACE_GB free.
+
+Each check runs within CA4M_HEALTH_TIMEOUT. Optional dependencies, which only disable a feature,
+are reported as warn. The command exits with status 1 if any other check failed.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		cfg, err := config.Read()
+		if err != nil {
+			logger.Fatal("Error reading configuration: %v", err)
+		}
+		if allowInsecureTLS {
+			cfg.AllowInsecureTLS = allowInsecureTLS
+		}
+
+		settings := doctorCheck{configCheck: configCheck{Name: "settings", Status: health.StatusOK}}
+		if err := cfg.Validate(); err != nil {
+			settings.Status = health.StatusFail
+			settings.Error = err.Error()
+			settings.Fix = "Fix the settings reported, see config validate"
+		}
+		checks := []doctorCheck{settings}
+		if doctorSf == "" {
+			doctorSf = cfg.PRONOM.SfPath
+		}
+
+		diagnostics := internal.Diagnostics(cfg, config.Files(cfg), doctorSf)
+		probes := make([]health.Check, len(diagnostics))
+		for i, diagnostic := range diagnostics {
+			probes[i] = diagnostic.Check
+		}
+		report := health.Run(context.Background(), probes, max(cfg.Health.Timeout, time.Second))
+		for _, diagnostic := range diagnostics {
+			result := report.Checks[diagnostic.Name]
+			check := doctorCheck{configCheck: configCheck{Name: diagnostic.Name, Status: result.Status, Detail: result.Detail, Error: result.Error}}
+			if result.Status == health.StatusFail {
+				check.Fix = diagnostic.Fix
+				if diagnostic.Optional {
+					check.Status = statusWarn
+				}
+			}
+			checks = append(checks, check)
+		}
+
+		failed := false
+		for _, check := range checks {
+			failed = failed || check.Status == health.StatusFail
+		}
+		printDoctorChecks(checks, failed)
+		if failed {
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+// printDoctorChecks prints the results of the diagnostics as a table followed by the fixes, or as JSON.
+func printDoctorChecks(checks []doctorCheck, failed bool) {
+	if jsonOutput() {
+		status := health.StatusOK
+		if failed {
+			status = health.StatusFail
+		}
+		writeJSON(map[string]any{"status": status, "checks": checks})
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	var fixes []string
+	for _, check := range checks {
+		detail := check.Detail
+		if check.Error != "" {
+			// Validation errors have a line per field
+			errText := strings.ReplaceAll(strings.TrimSpace(check.Error), "\n", "; ")
+			if detail != "" {
+				detail += ": "
+			}
+			detail += errText
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, check.Status, orDash(detail))
+		if check.Fix != "" {
+			fixes = append(fixes, fmt.Sprintf("  %s: %s", check.Name, check.Fix))
+		}
+	}
+	_ = w.Flush()
+	if len(fixes) > 0 {
+		//nolint:forbidigo // Command output is written to stdout
+		fmt.Printf("\nFixes:\n%s\n", strings.Join(fixes, "\n"))
+	}
+}
+
+func init() {
+	doctorCmd.Flags().StringVar(&doctorSf, "sf", "", "siegfried binary (defaults to CA4M_PRONOM_SF_PATH)")
+	doctorCmd.Flags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	RootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+)
+
+// printPlanned prints the actions a command would take in a dry run as a table, under the stage they belong to.
+// Nothing is printed if there are none. With JSON output, they are written with the errors planning them.
+func printPlanned(actions []preservation.PlannedAction, errs commandErrors) {
+	if jsonOutput() {
+		writeJSON(map[string]any{"actions": orEmpty(actions), "errors": orEmpty(errs)})
+		return
+	}
+	if len(actions) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STAGE\tACTION")
+	for _, action := range actions {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", orDash(action.Stage), action.Action)
+	}
+	_ = w.Flush()
+}
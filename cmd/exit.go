@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Exit statuses of the commands, so that scripts branch on the kind of failure. Failures without a class exit with
+// ExitFailure.
+const (
+	ExitOK         = 0
+	ExitFailure    = 1
+	ExitUsage      = 2 // Invalid command line arguments or flags
+	ExitValidation = 3 // Invalid settings, configuration files, profiles, manifests or packages
+	ExitStorage    = 4 // Packages could not be stored, uploaded or fetched
+	ExitNetwork    = 5 // A service could not be reached
+	ExitIntegrity  = 6 // Checksum, fixity or manifest mismatch
+	ExitPolicy     = 7 // Package refused: infected, duplicate, over quota, not accessible to the tenant, or maintenance
+)
+
+// exitCodes maps the failure classes to the exit statuses.
+var exitCodes = map[error]int{
+	utils.ErrValidation: ExitValidation,
+	utils.ErrStorage:    ExitStorage,
+	utils.ErrNetwork:    ExitNetwork,
+	utils.ErrIntegrity:  ExitIntegrity,
+	utils.ErrPolicy:     ExitPolicy,
+}
+
+// exitCode returns the exit status of a command failing with an error, from its failure class.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if code, ok := exitCodes[utils.FailureClass(err)]; ok {
+		return code
+	}
+	return ExitFailure
+}
+
+// fatal logs an error message like logger.Fatal, and exits with the status of the failure class of err.
+func fatal(err error, msg string, args ...any) {
+	logger.Exit(exitCode(err), msg, args...)
+}
+
+// fatalConfig logs an error loading the configuration, and exits with ExitValidation.
+func fatalConfig(err error) {
+	fatal(utils.Classify(utils.ErrValidation, err), "Error loading configuration:\n%v", err)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	extractInclude        []string
+	extractExclude        []string
+	extractMaxFiles       int
+	extractMaxFileSizeMB  int64
+	extractMaxTotalSizeMB int64
+)
+
+var extractCmd = &cobra.Command{
+	Use:   "extract <src> <dest>",
+	Short: "Extract a zip, tar or 7z archive",
+	Long: `Extract a zip, tar or 7z archive, with the path safety of the service.
+
+An entry outside the destination stops the extraction, whether it is selected or not.
+Entries can be selected with --include and --exclude, paths or glob patterns relative to the archive root:
+patterns without a slash also match base names at any depth, and a matching directory selects its contents.
+Extraction stops when a limit is exceeded, the entries extracted before are kept.
+Selected entries are listed as they are extracted, with their size; --dry-run only lists them.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if _, err := os.Stat(args[0]); err != nil {
+			logger.Fatal("Error reading archive: %v", err)
+		}
+		entries := []utils.ArchiveEntry{}
+		opts := utils.ExtractOptions{
+			Include:      extractInclude,
+			Exclude:      extractExclude,
+			MaxFiles:     extractMaxFiles,
+			MaxFileSize:  extractMaxFileSizeMB << 20,
+			MaxTotalSize: extractMaxTotalSizeMB << 20,
+			DryRun:       dryRun,
+			OnEntry: func(entry utils.ArchiveEntry) {
+				if jsonOutput() {
+					entries = append(entries, entry)
+					return
+				}
+				name := entry.Name
+				if entry.Dir {
+					name += "/"
+				}
+				//nolint:forbidigo // Command output is written to stdout
+				fmt.Printf("%d\t%s\n", entry.Size, name)
+			},
+		}
+		_, err := utils.ExtractArchiveWithOptions(ctx, args[0], args[1], opts)
+		if jsonOutput() {
+			// The entries extracted before an error are kept, so they are listed with it
+			result := map[string]any{"entries": entries}
+			if err != nil {
+				result["error"] = fmt.Sprintf("Error extracting %s: %v", args[0], err)
+			}
+			writeJSON(result)
+		}
+		if err != nil {
+			if jsonOutput() {
+				logger.Error("Error extracting %s: %v", args[0], err)
+				os.Exit(exitCode(err))
+			}
+			fatal(err, "Error extracting %s: %v", args[0], err)
+		}
+	},
+}
+
+func init() {
+	extractCmd.Flags().StringSliceVar(&extractInclude, "include", nil, "Extract only the entries matching these patterns")
+	extractCmd.Flags().StringSliceVar(&extractExclude, "exclude", nil, "Skip the entries matching these patterns")
+	extractCmd.Flags().IntVar(&extractMaxFiles, "max-files", 0, "Maximum number of files extracted (0 for no limit)")
+	extractCmd.Flags().Int64Var(&extractMaxFileSizeMB, "max-file-size-mb", 0, "Maximum size of a file in MiB (0 for the 5 GiB default, which truncates larger files)")
+	extractCmd.Flags().Int64Var(&extractMaxTotalSizeMB, "max-total-size-mb", 0, "Maximum size of the extracted files in MiB (0 for no limit)")
+
+	RootCmd.AddCommand(extractCmd)
+}
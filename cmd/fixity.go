@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var fixityAll bool
+
+var fixityCmd = &cobra.Command{
+	Use:   "fixity",
+	Short: "Check the fixity of preserved packages",
+}
+
+var fixityCheckCmd = &cobra.Command{
+	Use:   "check [package-id...|--all]",
+	Short: "Check the fixity of the stored AIPs of packages",
+	Long: `Check the fixity of the stored AIPs of packages.
+
+The AIP of each package is verified against its stored manifest in every storage location it was
+replicated to. Each check is recorded as a fixity event in the package timeline and in the PREMIS
+fixity events of the package (premis-fixity.xml), and failures are notified.
+A summary is printed per package and location. The command exits with status 6 if any AIP fails,
+or 1 if an AIP cannot be checked, so it can be run from cron.`,
+	Args: func(_ *cobra.Command, args []string) error {
+		if fixityAll == (len(args) > 0) {
+			return fmt.Errorf("pass package IDs or --all")
+		}
+		return nil
+	},
+	Run: func(_ *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		svc := newCommandService(ctx)
+
+		if dryRun {
+			planFixity(svc, args)
+			return
+		}
+		var results []*preservation.FixityResult
+		var errs commandErrors
+		if fixityAll {
+			var err error
+			if results, err = svc.CheckAllFixity(ctx); err != nil {
+				errs.add("Error checking fixity: %v", err)
+			}
+		}
+		for _, id := range args {
+			checked, err := svc.CheckPackageFixity(ctx, id)
+			results = append(results, checked...)
+			if err != nil {
+				errs.add("Error checking fixity of package %s: %v", id, err)
+			}
+		}
+		// Close before exiting so fixity failures are notified
+		svc.Close()
+
+		failed := len(errs) > 0
+		// Packages that could not be checked fail without a fixity failure
+		code := ExitFailure
+		for _, result := range results {
+			failed = failed || !result.Success()
+			if result.Failures > 0 {
+				code = ExitIntegrity
+			}
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"results": orEmpty(results), "errors": orEmpty(errs)})
+			if failed {
+				logger.Error("Fixity check failed")
+				os.Exit(code)
+			}
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "PACKAGE\tAIP\tLOCATION\tFILES\tFAILURES\tSTATUS")
+		for _, result := range results {
+			status := "OK"
+			switch {
+			case result.Error != "":
+				status = "ERROR: " + result.Error
+			case !result.Success():
+				status = "FAILED"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", result.PackageID, result.AIPUUID, result.Location, result.Files, result.Failures, status)
+		}
+		_ = w.Flush()
+		if failed {
+			logger.Exit(code, "Fixity check failed")
+		}
+	},
+}
+
+// planFixity prints the checks fixity check would make and record, exiting with status 1 if a package cannot be checked.
+func planFixity(svc *internal.Service, ids []string) {
+	var actions []preservation.PlannedAction
+	var errs commandErrors
+	if fixityAll {
+		var err error
+		if actions, err = svc.PlanAllFixity(); err != nil {
+			errs.add("Error planning fixity checks: %v", err)
+		}
+	}
+	for _, id := range ids {
+		planned, err := svc.PlanPackageFixity(id)
+		if err != nil {
+			errs.add("Error planning the fixity check of package %s: %v", id, err)
+			continue
+		}
+		actions = append(actions, planned...)
+	}
+	svc.Close()
+	printPlanned(actions, errs)
+	if len(errs) > 0 {
+		logger.Error("Fixity check failed")
+		os.Exit(ExitFailure)
+	}
+}
+
+func init() {
+	fixityCheckCmd.Flags().BoolVar(&fixityAll, "all", false, "Check every package with a stored AIP")
+
+	fixityCmd.PersistentFlags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	fixityCmd.AddCommand(fixityCheckCmd)
+	RootCmd.AddCommand(fixityCmd)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/penwern/curate-preservation-core/internal/processor"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	identifyFormat string
+	identifySf     string
+)
+
+var identifyCmd = &cobra.Command{
+	Use:   "identify <path>...",
+	Short: "Identify the formats of files",
+	Long: `Identify the formats of files, or of the files of directories, to assess transfers before they are submitted.
+
+The MIME type of each file is detected from its content signature, or its extension when the
+signature is not recognized. With siegfried installed (sf, or the binary set by --sf), the PRONOM
+format is identified as A3M does, with the basis of the match and any warning, e.g. an extension
+mismatch. Results are printed as a table, as JSON lines with --format json, or as a single JSON
+document with --output json. No configuration is needed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		if identifyFormat != "table" && identifyFormat != "json" {
+			logger.Exit(ExitUsage, "Invalid format %q, expected table or json", identifyFormat)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		sf, err := exec.LookPath(identifySf)
+		if err != nil {
+			// Written to stderr, the output may be read by scripts
+			_, _ = fmt.Fprintf(os.Stderr, "siegfried (%s) not found, PRONOM formats are not identified\n", identifySf)
+			sf = ""
+		}
+		var files []processor.FileFormat
+		for _, path := range args {
+			identified, err := processor.IdentifyFiles(ctx, path, sf)
+			if err != nil {
+				fatal(err, "Error identifying %s: %v", path, err)
+			}
+			files = append(files, identified...)
+		}
+
+		if jsonOutput() {
+			writeJSON(map[string]any{"files": orEmpty(files)})
+			return
+		}
+		if identifyFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			for _, file := range files {
+				if err := encoder.Encode(file); err != nil {
+					fatal(err, "Error writing results: %v", err)
+				}
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "PATH\tSIZE\tMIME TYPE\tPUID\tFORMAT\tWARNING")
+		for _, file := range files {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", file.Path, file.Size, file.MIMEType, orDash(file.PUID), orDash(file.Format), file.Warning)
+		}
+		_ = w.Flush()
+	},
+}
+
+// orDash returns the value, or - if it is empty.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func init() {
+	identifyCmd.Flags().StringVar(&identifyFormat, "format", "table", "Output format: table or json")
+	identifyCmd.Flags().StringVar(&identifySf, "sf", "sf", "siegfried binary used to identify PRONOM formats")
+	_ = identifyCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"table", "json"}, cobra.ShellCompDirectiveNoFileComp))
+
+	RootCmd.AddCommand(identifyCmd)
+}
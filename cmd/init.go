@@ -0,0 +1,633 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/internal/health"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var initFile string
+
+// errInitAborted is returned when the input of the init wizard ends before the configuration is written.
+var errInitAborted = errors.New("input ended, nothing was written")
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the configuration interactively",
+	Long: `Create the configuration of a new installation interactively, step by step: the processing and
+data directories, the a3m address and shared directories, the Cells address, admin token and cec
+binary, and optionally the AtoM configuration file and a local AIP storage location.
+
+Each answer is validated before the next question, and the services are connected to as soon as
+their settings are known, so that a wrong address or token is reported at the step it was entered.
+Missing directories can be created. The values of an existing settings file, or of the environment
+variables, are proposed as defaults, and secrets are read without echo from a terminal.
+
+Nothing is written before the summary is confirmed. The settings are then written to --file, keeping
+its other lines and comments, and the configuration files to the paths of their settings. Run
+doctor afterwards to check the external tools.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		if jsonOutput() {
+			logger.Exit(ExitUsage, "init is interactive and has no JSON output")
+		}
+		// The settings are read again at each check, which only the answers should show
+		logger.SetConsoleLevel("warn")
+
+		wizard, err := newInitWizard(initFile)
+		if err != nil {
+			fatal(err, "Error reading %s: %v", initFile, err)
+		}
+		if err := wizard.run(); err != nil {
+			if errors.Is(err, errInitAborted) {
+				logger.Exit(ExitUsage, "Configuration not created: %v", err)
+			}
+			fatal(err, "Error creating the configuration: %v", err)
+		}
+	},
+}
+
+// initWizard asks for the settings of a new installation.
+type initWizard struct {
+	in       *bufio.Reader
+	out      io.Writer
+	terminal bool   // Standard input is a terminal, secrets are read without echo
+	path     string // Settings file the answers are written to
+
+	settings map[string]string // Answered settings, by environment variable
+	names    []string          // Answered environment variables, in the order they were asked
+	secret   map[string]bool   // Environment variables holding secrets, not shown in the summary
+	files    []initConfigFile  // Configuration files to write
+}
+
+// initConfigFile is a configuration file created by the init wizard.
+type initConfigFile struct {
+	path   string
+	config any
+}
+
+// initQuestion is a question of the init wizard setting a field of a configuration file.
+type initQuestion struct {
+	prompt string
+	value  *string
+	secret bool
+	tag    string // Validator tag of the answer
+	msg    string // Message of an invalid answer
+}
+
+// newInitWizard creates the wizard writing the settings to a file. The settings of an existing file are loaded in
+// the environment, without overriding the environment variables, so that they are the defaults of the answers.
+func newInitWizard(path string) (*initWizard, error) {
+	if _, err := os.Stat(path); err == nil {
+		if err := godotenv.Load(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return &initWizard{
+		in:       bufio.NewReader(os.Stdin),
+		out:      os.Stdout,
+		terminal: isTerminal(os.Stdin),
+		path:     path,
+		settings: map[string]string{},
+		secret:   map[string]bool{},
+	}, nil
+}
+
+// run asks for the settings step by step, then writes them once the summary is confirmed.
+func (w *initWizard) run() error {
+	fmt.Fprintf(w.out, "This wizard creates the configuration of the preservation service in %s.\n", w.path)
+	fmt.Fprintln(w.out, "Press Enter to keep the value in brackets.")
+	for _, step := range []func() error{w.directories, w.a3m, w.cells, w.atom, w.aipStorage} {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return w.finish()
+}
+
+// directories asks for the directories of the service.
+func (w *initWizard) directories() error {
+	w.section("Directories")
+	if _, err := w.setting("Processing directory of the packages", "processing_base_dir", false, w.directory); err != nil {
+		return err
+	}
+	_, err := w.setting("Data directory of the package records and reports", "data_dir", false, w.directory)
+	return err
+}
+
+// a3m asks for the address of a3m, checking that it is reachable, and for its shared directories.
+func (w *initWizard) a3m() error {
+	w.section("a3m")
+	for {
+		if _, err := w.setting("a3m gRPC address (host:port)", "a3m.address", false,
+			validateVar("hostname_port", "expected a host:port address")); err != nil {
+			return err
+		}
+		ok, err := w.check(probe("a3m"))
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+	}
+	if _, err := w.setting("a3m completed directory", "a3m.completed_dir", false, w.directory); err != nil {
+		return err
+	}
+	_, err := w.setting("a3m DIPs directory", "a3m.dips_dir", false, w.directory)
+	return err
+}
+
+// cells asks for the address and admin token of Cells, checking that they are accepted, and for the cec binary.
+func (w *initWizard) cells() error {
+	w.section("Cells")
+	for {
+		if _, err := w.setting("Cells address", "cells.address", false,
+			validateVar("http_url", "expected an http:// or https:// URL")); err != nil {
+			return err
+		}
+		if _, err := w.setting("Cells admin token (or a secret reference)", "cells.admin_token", true,
+			validateVar("required", "a token is required")); err != nil {
+			return err
+		}
+		ok, err := w.check(probe("cells"))
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+	}
+	for {
+		if _, err := w.setting("Path of the Cells client cec", "cells.cec_path", false,
+			validateVar("file", "no such file")); err != nil {
+			return err
+		}
+		ok, err := w.check(diagnostic("tool:cec"))
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+	}
+	_, err := w.setting("Cells workspace of the archived AIPs", "cells.archive_workspace", false,
+		validateVar("required", "a workspace is required"))
+	return err
+}
+
+// atom asks for the AtoM configuration file, proposing the values of an existing file, and checks that AtoM accepts
+// its credentials.
+func (w *initWizard) atom() error {
+	w.section("AtoM")
+	path := config.Setting("atom.config_path")
+	_, err := os.Stat(path)
+	deposit, err := w.confirm("Deposit the DIPs in AtoM", err == nil)
+	if err != nil || !deposit {
+		return err
+	}
+	if path, err = w.setting("AtoM configuration file", "atom.config_path", false,
+		validateVar("required", "a path is required")); err != nil {
+		return err
+	}
+	atomCfg := config.DefaultAtomConfig()
+	if data, err := os.ReadFile(filepath.Clean(path)); err == nil {
+		if err := json.Unmarshal(data, atomCfg); err != nil {
+			fmt.Fprintf(w.out, "  %s is not valid, its values are not proposed: %v\n", path, err)
+			atomCfg = config.DefaultAtomConfig()
+		}
+	}
+
+	for {
+		questions := []initQuestion{
+			{"AtoM URL", &atomCfg.Host, false, "url", "expected a URL"},
+			{"AtoM API key (or a secret reference)", &atomCfg.APIKey, true, "required", "an API key is required"},
+			{"AtoM login email", &atomCfg.LoginEmail, false, "email", "expected an email address"},
+			{"AtoM login password (or a secret reference)", &atomCfg.LoginPassword, true, "required", "a password is required"},
+			{"Slug of the AtoM description the DIPs are deposited under", &atomCfg.Slug, false, "required", "a slug is required"},
+		}
+		// SFTP deliveries are kept as configured in the file, rsync is the default
+		if atomCfg.DeliveryMethod != "sftp" {
+			questions = append(questions, initQuestion{"rsync target of the DIPs (user@host:/path)", &atomCfg.RsyncTarget, false,
+				"required", "an rsync target is required"})
+		}
+		for _, q := range questions {
+			if *q.value, err = w.ask(q.prompt, *q.value, q.secret, validateVar(q.tag, q.msg)); err != nil {
+				return err
+			}
+		}
+		if err := atomCfg.Validate(); err != nil {
+			fmt.Fprintf(w.out, "  Invalid AtoM configuration: %v\n", err)
+			continue
+		}
+		ok, err := w.check(func(cfg *config.Config) (health.Check, error) {
+			resolved := atomCfg.Clone()
+			if err := secrets.Resolve(resolved); err != nil {
+				return health.Check{}, err
+			}
+			return findCheck(internal.ProbeChecks(cfg, []config.File{{Name: "atom", Path: path, Config: resolved}}), "atom")
+		})
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+	}
+	w.files = append(w.files, initConfigFile{path: path, config: atomCfg})
+	return nil
+}
+
+// aipStorage checks the locations of an existing AIP storage file, or asks for a local directory the AIPs are
+// replicated to. The other backends are added to the file afterwards.
+func (w *initWizard) aipStorage() error {
+	w.section("AIP storage")
+	path := config.Setting("aip_storage.config_path")
+	storage, err := config.LoadAIPStorageConfig(path)
+	switch {
+	case err != nil:
+		fmt.Fprintf(w.out, "  %s is not valid: %v\n", path, err)
+	case storage != nil:
+		keep, err := w.confirm(fmt.Sprintf("Keep the %d storage locations of %s", len(storage.Locations), path), true)
+		if err != nil {
+			return err
+		}
+		for _, location := range storage.Locations {
+			if !keep {
+				break
+			}
+			if keep, err = w.check(probe("storage:"+location.Name, config.File{Name: "aip_storage", Path: path, Config: storage})); err != nil {
+				return err
+			}
+		}
+		if keep {
+			return nil
+		}
+	}
+
+	replicate, err := w.confirm("Replicate the AIPs to a local directory", false)
+	if err != nil || !replicate {
+		return err
+	}
+	if path, err = w.setting("AIP storage configuration file", "aip_storage.config_path", false,
+		validateVar("required", "a path is required")); err != nil {
+		return err
+	}
+	for {
+		name, err := w.ask("Name of the storage location", "local", false, validateVar("required", "a name is required"))
+		if err != nil {
+			return err
+		}
+		dir, err := w.ask("Directory the AIPs are stored in", "", false, w.directory)
+		if err != nil {
+			return err
+		}
+		storage = &config.AIPStorageConfig{Locations: []*config.StorageLocation{{
+			Name:    name,
+			Backend: config.StorageBackendLocal,
+			Local:   &config.LocalStorageConfig{Dir: dir},
+		}}}
+		if err := storage.Validate(); err != nil {
+			fmt.Fprintf(w.out, "  Invalid storage location: %v\n", err)
+			continue
+		}
+		ok, err := w.check(probe("storage:"+name, config.File{Name: "aip_storage", Path: path, Config: storage}))
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+	}
+	w.files = append(w.files, initConfigFile{path: path, config: storage})
+	return nil
+}
+
+// finish validates the answered settings, shows them, and writes them once confirmed.
+func (w *initWizard) finish() error {
+	w.section("Summary")
+	cfg, err := config.Read()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(w.out, "The settings are not valid yet:\n  %v\n", err)
+		write, err := w.confirm("Write them anyway", false)
+		if err != nil {
+			return err
+		}
+		if !write {
+			return utils.Classify(utils.ErrValidation, errors.New("the settings are not valid, nothing was written"))
+		}
+	}
+
+	for _, name := range w.names {
+		value := w.settings[name]
+		if w.secret[name] && value != "" && !secrets.IsReference(value) {
+			value = config.Redacted
+		}
+		fmt.Fprintf(w.out, "  %s=%s\n", name, value)
+	}
+	for _, file := range w.files {
+		fmt.Fprintf(w.out, "  %s\n", file.path)
+	}
+	write, err := w.confirm(fmt.Sprintf("Write the settings to %s", w.path), true)
+	if err != nil {
+		return err
+	}
+	if !write {
+		fmt.Fprintln(w.out, "Nothing was written.")
+		return nil
+	}
+
+	for _, file := range w.files {
+		data, err := json.MarshalIndent(file.config, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(file.path, append(data, '\n'), 0o600); err != nil {
+			return fmt.Errorf("error writing %s: %w", file.path, err)
+		}
+		fmt.Fprintf(w.out, "Wrote %s\n", file.path)
+	}
+	if err := w.writeSettings(); err != nil {
+		return fmt.Errorf("error writing %s: %w", w.path, err)
+	}
+	fmt.Fprintf(w.out, "Wrote %s\n", w.path)
+	fmt.Fprintln(w.out, "Run 'ca4m doctor' to check the external tools and directories of the service.")
+	return nil
+}
+
+// writeSettings writes the answered settings to the settings file. The lines of the settings already in the file are
+// replaced, the others are appended, and the other lines, comments included, are kept as they are.
+func (w *initWizard) writeSettings() error {
+	data, err := os.ReadFile(filepath.Clean(w.path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var lines []string
+	if trimmed := strings.TrimRight(string(data), "\n"); trimmed != "" {
+		lines = strings.Split(trimmed, "\n")
+	}
+	written := map[string]bool{}
+	for i, line := range lines {
+		name := settingName(line)
+		value, ok := w.settings[name]
+		if !ok {
+			continue
+		}
+		if lines[i], err = godotenv.Marshal(map[string]string{name: value}); err != nil {
+			return err
+		}
+		written[name] = true
+	}
+	for _, name := range w.names {
+		if written[name] {
+			continue
+		}
+		line, err := godotenv.Marshal(map[string]string{name: w.settings[name]})
+		if err != nil {
+			return err
+		}
+		lines = append(lines, line)
+	}
+	return os.WriteFile(w.path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// settingName returns the environment variable set by a line of a settings file, or an empty string for comments
+// and blank lines.
+func settingName(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		return ""
+	}
+	name, _, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
+
+// section prints the title of a step.
+func (w *initWizard) section(title string) {
+	fmt.Fprintf(w.out, "\n%s\n%s\n", title, strings.Repeat("-", len(title)))
+}
+
+// setting asks for a setting, proposing its current value, and sets it in the environment so that the checks of the
+// next steps use it.
+func (w *initWizard) setting(prompt, key string, secret bool, validate func(string) error) (string, error) {
+	value, err := w.ask(prompt, config.Setting(key), secret, validate)
+	if err != nil {
+		return "", err
+	}
+	name := config.EnvName(key)
+	if _, ok := w.settings[name]; !ok {
+		w.names = append(w.names, name)
+	}
+	w.settings[name] = value
+	w.secret[name] = secret
+	if err := os.Setenv(name, value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// ask prompts for a value until it is valid. An empty answer selects the default value, which is not shown for
+// secrets.
+func (w *initWizard) ask(prompt, def string, secret bool, validate func(string) error) (string, error) {
+	for {
+		switch {
+		case def == "":
+			fmt.Fprintf(w.out, "%s: ", prompt)
+		case secret:
+			fmt.Fprintf(w.out, "%s [keep current]: ", prompt)
+		default:
+			fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+		}
+		answer, err := w.readLine(secret)
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			answer = def
+		}
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				if errors.Is(err, errInitAborted) {
+					return "", err
+				}
+				fmt.Fprintf(w.out, "  %v\n", err)
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+// confirm asks a yes or no question.
+func (w *initWizard) confirm(prompt string, def bool) (bool, error) {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		fmt.Fprintf(w.out, "%s? [%s]: ", prompt, choices)
+		answer, err := w.readLine(false)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(w.out, "  Answer y or n")
+	}
+}
+
+// readLine reads an answer. Secrets are read without echo from a terminal.
+func (w *initWizard) readLine(secret bool) (string, error) {
+	if secret && w.terminal {
+		line, err := term.ReadPassword(int(os.Stdin.Fd())) //nolint:gosec // File descriptors fit in an int
+		fmt.Fprintln(w.out)
+		if err != nil {
+			return "", errInitAborted
+		}
+		return strings.TrimSpace(string(line)), nil
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		if line == "" {
+			fmt.Fprintln(w.out)
+			return "", errInitAborted
+		}
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// directory validates a directory, offering to create it if it does not exist. Directories that are not writable
+// are accepted with a warning, they may be written by another user such as a3m.
+func (w *initWizard) directory(dir string) error {
+	if dir == "" {
+		return errors.New("a directory is required")
+	}
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		create, err := w.confirm(fmt.Sprintf("  %s does not exist, create it", dir), true)
+		if err != nil {
+			return err
+		}
+		if !create {
+			return fmt.Errorf("%s does not exist", dir)
+		}
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !info.IsDir():
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if _, err := health.Writable(dir, dir).Run(context.Background()); err != nil {
+		fmt.Fprintf(w.out, "  Warning: %v\n", err)
+	}
+	return nil
+}
+
+// check runs a check of the answered settings, and asks whether to keep them if it fails. Returns false if they are
+// to be asked again.
+func (w *initWizard) check(newCheck func(cfg *config.Config) (health.Check, error)) (bool, error) {
+	cfg, err := config.Read()
+	var result *health.Result
+	if err == nil {
+		if allowInsecureTLS {
+			cfg.AllowInsecureTLS = allowInsecureTLS
+		}
+		var check health.Check
+		if check, err = newCheck(cfg); err == nil {
+			fmt.Fprintf(w.out, "  Checking %s... ", check.Name)
+			result = health.Run(context.Background(), []health.Check{check}, max(cfg.Health.Timeout, time.Second)).Checks[check.Name]
+		}
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintf(w.out, "  Check failed: %v\n", err)
+	case result.Status == health.StatusOK:
+		fmt.Fprintf(w.out, "ok (%s)\n", orDash(result.Detail))
+		return true, nil
+	default:
+		fmt.Fprintf(w.out, "fail\n  %s\n", result.Error)
+	}
+	return w.confirm("Keep these settings anyway", false)
+}
+
+// probe returns the reachability check of a service of the settings, see internal.ProbeChecks.
+func probe(name string, files ...config.File) func(cfg *config.Config) (health.Check, error) {
+	return func(cfg *config.Config) (health.Check, error) {
+		return findCheck(internal.ProbeChecks(cfg, files), name)
+	}
+}
+
+// diagnostic returns a diagnostic of the environment of the settings, see internal.Diagnostics.
+func diagnostic(name string) func(cfg *config.Config) (health.Check, error) {
+	return func(cfg *config.Config) (health.Check, error) {
+		for _, diagnostic := range internal.Diagnostics(cfg, nil, "") {
+			if diagnostic.Name == name {
+				return diagnostic.Check, nil
+			}
+		}
+		return health.Check{}, fmt.Errorf("no %s check", name)
+	}
+}
+
+// findCheck returns the check with a name.
+func findCheck(checks []health.Check, name string) (health.Check, error) {
+	for _, check := range checks {
+		if check.Name == name {
+			return check, nil
+		}
+	}
+	return health.Check{}, fmt.Errorf("no %s check", name)
+}
+
+// validateVar returns a validation of an answer with a validator tag, failing with a message.
+func validateVar(tag, msg string) func(string) error {
+	return func(value string) error {
+		if err := validator.New().Var(value, tag); err != nil {
+			return errors.New(msg)
+		}
+		return nil
+	}
+}
+
+func init() {
+	initCmd.Flags().StringVar(&initFile, "file", ".env", "Settings file the answers are written to")
+	RootCmd.AddCommand(initCmd)
+}
@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/client"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jobsServer   string
+	jobsToken    string
+	jobsInsecure bool
+	jobsFormat   string
+	jobsStatus   string
+	jobsLimit    int
+	jobsWait     int
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Manage the jobs of a running service",
+	Long: `Manage the jobs of a running service.
+
+Commands are sent to the HTTP API of the service started with --serve, at CA4M_CLIENT_SERVER or --server.
+With API authentication enabled, pass a bearer token or API key with --token, CA4M_API_TOKEN or CA4M_CLIENT_TOKEN:
+listing jobs needs the viewer role, cancelling and retrying them the operator role.`,
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the queued and recent jobs",
+	Long: `List the jobs of the queue, pending first in the order they were queued, then the jobs that started,
+most recent first, from the records of their packages.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		checkJobsFormat()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		jobs, err := newJobsClient().ListJobs(ctx, &client.ListJobsParams{Status: jobsStatus, Limit: jobsLimit})
+		if err != nil {
+			logger.Fatal("Error listing jobs: %v", err)
+		}
+		printJobs(jobs, nil)
+	},
+}
+
+var jobsStatusCmd = &cobra.Command{
+	Use:   "status <job-id>...",
+	Short: "Show the status of jobs",
+	Long: `Show the status of jobs: pending, running, completed, failed or cancelled, with the package
+preserved by each job once it has started. With --wait, waits up to that many seconds (60 at most)
+for each unfinished job to change.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeJobIDs(),
+	Run: func(_ *cobra.Command, args []string) {
+		checkJobsFormat()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		c := newJobsClient()
+		var params *client.GetJobParams
+		if jobsWait > 0 {
+			params = &client.GetJobParams{Wait: strconv.Itoa(jobsWait)}
+		}
+		var jobs []client.JobStatus
+		var errs commandErrors
+		for _, id := range args {
+			job, err := c.GetJob(ctx, id, params)
+			if err != nil {
+				errs.add("Error reading job %s: %v", id, err)
+				continue
+			}
+			jobs = append(jobs, *job)
+		}
+		printJobs(jobs, errs)
+		if len(errs) > 0 {
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+var jobsCancelCmd = &cobra.Command{
+	Use:   "cancel <job-id>...",
+	Short: "Cancel queued or running jobs",
+	Long: `Cancel queued or running jobs.
+
+Queued jobs are removed from the queue. Running preservations stop at their next step,
+remove their partial outputs and record their package as cancelled.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeJobIDs("pending", "running"),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := newJobsClient()
+
+		if dryRun {
+			planJobs(ctx, c, args, func(job *client.JobStatus) (string, error) {
+				switch job.Status {
+				case "pending":
+					return "Remove job " + job.ID + " from the queue", nil
+				case "running":
+					return "Stop job " + job.ID + " at its next step, removing its partial outputs", nil
+				}
+				return "", fmt.Errorf("job %s is %s, only pending and running jobs are cancelled", job.ID, job.Status)
+			})
+			return
+		}
+		var cancellations []*client.JobCancellation
+		var errs commandErrors
+		for _, id := range args {
+			cancellation, err := c.CancelJob(ctx, id)
+			if err != nil {
+				errs.add("Error cancelling job %s: %v", id, err)
+				continue
+			}
+			cancellations = append(cancellations, cancellation)
+			if !jsonOutput() {
+				//nolint:forbidigo // Command output is written to stdout
+				fmt.Printf("%s\t%s\n", id, cancellation.Status)
+			}
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"jobs": orEmpty(cancellations), "errors": orEmpty(errs)})
+		}
+		if len(errs) > 0 {
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+var jobsRetryCmd = &cobra.Command{
+	Use:   "retry <job-id>...",
+	Short: "Queue failed or cancelled jobs again",
+	Long: `Queue failed or cancelled jobs again, with the same job ID.
+
+The package of each job is preserved again as it was submitted: as the same user, with the profile,
+deselections and metadata of its latest attempt. Transfers pulled from a source are preserved from
+their copy in Cells, and completion callbacks are not sent again.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeJobIDs("failed", "cancelled"),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := newJobsClient()
+
+		if dryRun {
+			planJobs(ctx, c, args, func(job *client.JobStatus) (string, error) {
+				if job.Status != "failed" && job.Status != "cancelled" {
+					return "", fmt.Errorf("job %s is %s, only failed and cancelled jobs are retried", job.ID, job.Status)
+				}
+				return "Queue job " + job.ID + " again to preserve " + orDash(job.CellsPath), nil
+			})
+			return
+		}
+		var jobs []*client.JobStatus
+		var errs commandErrors
+		for _, id := range args {
+			job, err := c.RetryJob(ctx, id)
+			if err != nil {
+				errs.add("Error retrying job %s: %v", id, err)
+				continue
+			}
+			jobs = append(jobs, job)
+			if !jsonOutput() {
+				//nolint:forbidigo // Command output is written to stdout
+				fmt.Printf("%s\t%s\n", job.ID, job.Status)
+			}
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"jobs": orEmpty(jobs), "errors": orEmpty(errs)})
+		}
+		if len(errs) > 0 {
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+// planJobs prints the actions a dry run of a command would take on jobs, as returned by plan from their status,
+// exiting with status 1 if a job cannot be read or planned.
+func planJobs(ctx context.Context, c *client.Client, ids []string, plan func(job *client.JobStatus) (string, error)) {
+	var actions []preservation.PlannedAction
+	var errs commandErrors
+	for _, id := range ids {
+		job, err := c.GetJob(ctx, id, nil)
+		if err == nil {
+			var action string
+			if action, err = plan(job); err == nil {
+				actions = append(actions, preservation.PlannedAction{Action: action})
+				continue
+			}
+		}
+		errs.add("Error planning job %s: %v", id, err)
+	}
+	printPlanned(actions, errs)
+	if len(errs) > 0 {
+		os.Exit(ExitFailure)
+	}
+}
+
+// newJobsClient returns a client of the API of the service, from the flags or the client settings.
+func newJobsClient() *client.Client {
+	c, err := jobsClient()
+	if err != nil {
+		fatalConfig(err)
+	}
+	return c
+}
+
+// jobsClient returns a client of the API of the service, or the error loading the client settings.
+func jobsClient() (*client.Client, error) {
+	cfg, err := config.LoadClient()
+	if err != nil {
+		return nil, err
+	}
+	server := jobsServer
+	if server == "" {
+		server = cfg.Client.Server
+	}
+	token := jobsToken
+	if token == "" {
+		token = os.Getenv("CA4M_API_TOKEN")
+	}
+	if token == "" {
+		token = cfg.Client.Token
+	}
+	hc := &http.Client{
+		Timeout: 30*time.Second + time.Duration(jobsWait)*time.Second,
+		Transport: &http.Transport{
+			// #nosec G402 -- InsecureSkipVerify is configurable via --allow-insecure-tls for development/testing environments
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: jobsInsecure || cfg.AllowInsecureTLS},
+		},
+	}
+	return client.New(server, client.WithToken(token), client.WithHTTPClient(hc)), nil
+}
+
+// checkJobsFormat exits if the output format is not supported.
+func checkJobsFormat() {
+	if jobsFormat != "table" && jobsFormat != "json" {
+		logger.Exit(ExitUsage, "Invalid format %q, expected table or json", jobsFormat)
+	}
+}
+
+// printJobs prints the status of jobs as a table, or as JSON lines. With JSON output, they are written with the
+// errors reading them.
+func printJobs(jobs []client.JobStatus, errs commandErrors) {
+	if jsonOutput() {
+		writeJSON(map[string]any{"jobs": orEmpty(jobs), "errors": orEmpty(errs)})
+		return
+	}
+	if jobsFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, job := range jobs {
+			if err := encoder.Encode(job); err != nil {
+				logger.Fatal("Error writing jobs: %v", err)
+			}
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tSTATUS\tSTATE\tPACKAGE\tUPDATED\tERROR")
+	for _, job := range jobs {
+		updated := "-"
+		if !job.UpdatedAt.IsZero() {
+			updated = job.UpdatedAt.Local().Format(time.DateTime)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Status, orDash(job.State), orDash(job.PackageID), updated, job.Error)
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	for _, c := range []*cobra.Command{jobsListCmd, jobsStatusCmd} {
+		c.Flags().StringVar(&jobsFormat, "format", "table", "Output format: table or json")
+		_ = c.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"table", "json"}, cobra.ShellCompDirectiveNoFileComp))
+	}
+	jobsListCmd.Flags().StringVar(&jobsStatus, "status", "", "Only list the jobs with this status: pending, running, completed, failed or cancelled")
+	_ = jobsListCmd.RegisterFlagCompletionFunc("status", cobra.FixedCompletions([]string{"pending", "running", "completed", "failed", "cancelled"}, cobra.ShellCompDirectiveNoFileComp))
+	jobsListCmd.Flags().IntVar(&jobsLimit, "limit", 0, "Maximum number of jobs listed (default 100)")
+	jobsStatusCmd.Flags().IntVar(&jobsWait, "wait", 0, "Seconds to wait for each unfinished job to change, up to 60")
+
+	jobsCmd.PersistentFlags().StringVar(&jobsServer, "server", "", "URL of the service API (default $CA4M_CLIENT_SERVER, or http://localhost:6905)")
+	jobsCmd.PersistentFlags().StringVar(&jobsToken, "token", "", "Bearer token for the service API (default $CA4M_API_TOKEN, or $CA4M_CLIENT_TOKEN)")
+	jobsCmd.PersistentFlags().BoolVar(&jobsInsecure, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	jobsCmd.AddCommand(jobsListCmd, jobsStatusCmd, jobsCancelCmd, jobsRetryCmd)
+	RootCmd.AddCommand(jobsCmd)
+}
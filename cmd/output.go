@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// Output formats of the commands, selected with the global --output flag.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var outputFormat string
+
+// commandErrors collects the errors on the items of a command, such as jobs or AIPs, that don't stop it: they are
+// logged as they happen, and listed under errors in its JSON output.
+type commandErrors []string
+
+// add logs an error and collects it.
+func (e *commandErrors) add(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	logger.Error("%s", msg)
+	*e = append(*e, msg)
+}
+
+// initOutput checks the output format. With JSON output, logs are written to stderr so that stdout only carries the
+// JSON document of the command, and fatal errors are written to stdout as {"error": "..."}.
+func initOutput() {
+	switch outputFormat {
+	case outputText:
+	case outputJSON:
+		logger.SetConsole(os.Stderr)
+		logger.OnFatal(func(msg string) {
+			writeJSON(map[string]string{"error": msg})
+		})
+	default:
+		logger.Exit(ExitUsage, "Invalid output %q, expected text or json", outputFormat)
+	}
+}
+
+// jsonOutput reports whether the output of the commands is JSON.
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// writeJSON writes the JSON output of a command to stdout.
+func writeJSON(v any) {
+	if err := encodeJSON(os.Stdout, v); err != nil {
+		// Not fatal, which would write the error as another JSON document
+		logger.Error("Error writing output: %v", err)
+		os.Exit(ExitFailure)
+	}
+}
+
+// orEmpty returns an empty slice for a nil one, so that lists are written as [] rather than null in JSON output.
+func orEmpty[S ~[]E, E any](s S) S {
+	if s == nil {
+		return S{}
+	}
+	return s
+}
+
+// preservationResult is the JSON output of a command preserving packages: their paths, and whether the preservation
+// completed or failed, with its error.
+func preservationResult(paths []string, err error) map[string]any {
+	result := map[string]any{"paths": paths, "status": internal.JobStatusCompleted}
+	if err != nil {
+		result["status"] = internal.JobStatusFailed
+		result["error"] = err.Error()
+	}
+	return result
+}
+
+// encodeJSON writes a value as indented JSON.
+func encodeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// noProgress selects plain logs over the progress display in a terminal.
+var noProgress bool
+
+const (
+	// progressInterval is the interval at which the progress display is redrawn.
+	progressInterval = 200 * time.Millisecond
+	// progressBarWidth is the number of cells of a progress bar.
+	progressBarWidth = 24
+	// defaultTerminalWidth is the width lines are cut to when COLUMNS is not set.
+	defaultTerminalWidth = 80
+)
+
+// spinnerFrames animate the stages without a known total.
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// progressDisplay shows the running stages of the preservations of the command in a terminal, with a bar and an ETA
+// when the number of files of a stage is known, and prints each stage as it completes. It is the console of the
+// logger while it runs, so that warnings and errors are printed above the stages rather than through them.
+type progressDisplay struct {
+	mu       sync.Mutex
+	out      io.Writer
+	width    int
+	lines    int // Lines drawn below the printed output
+	frame    int
+	packages []*packageProgress
+	finished map[string]bool // Packages whose outcome was printed
+	quiet    bool            // Whether info entries are left out of the console
+
+	unsubscribe func()
+	done        chan struct{}
+}
+
+// packageProgress is the progress of the preservation of a package.
+type packageProgress struct {
+	id     string
+	name   string
+	start  time.Time
+	stages []*stageProgress // Running stages, in the order they started
+}
+
+// stageProgress is the progress of a running stage.
+type stageProgress struct {
+	stage     string
+	detail    string
+	start     time.Time
+	current   string
+	group     string
+	completed int
+	total     int
+	implicit  bool // Only known from its progress events, such as the A3M processing within packaging
+}
+
+// newProgressDisplay returns the progress display of a preservation command, or nil if the command logs plainly: with
+// --no-progress or JSON output, or when stdout is not a terminal. The display becomes the console of the logger,
+// which must be initialized after.
+func newProgressDisplay() *progressDisplay {
+	if noProgress || jsonOutput() || os.Getenv("TERM") == "dumb" || !isTerminal(os.Stdout) {
+		return nil
+	}
+	width := defaultTerminalWidth
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		width = columns
+	}
+	d := &progressDisplay{out: os.Stdout, width: width, finished: make(map[string]bool)}
+	logger.SetConsole(d)
+	return d
+}
+
+// isTerminal reports whether a file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Follow shows the progress events of the package records until the returned function is called. Once the first
+// package starts, only warnings and errors are logged to the console, the log file keeps every entry. Nothing is
+// shown without package records.
+func (d *progressDisplay) Follow(store *catalog.Store) func() {
+	if d == nil || store == nil {
+		return func() {}
+	}
+	events, unsubscribe := store.Subscribe("")
+	d.unsubscribe = unsubscribe
+	d.done = make(chan struct{})
+	go d.run(events)
+	return d.stop
+}
+
+// run applies the progress events and redraws the stages until the events end.
+func (d *progressDisplay) run(events <-chan catalog.ProgressEvent) {
+	defer close(d.done)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			d.apply(&event)
+		case <-ticker.C:
+			d.mu.Lock()
+			d.frame++
+			d.redraw()
+			d.mu.Unlock()
+		}
+	}
+}
+
+// stop ends the display once the events already published are shown, and restores the console.
+func (d *progressDisplay) stop() {
+	d.unsubscribe()
+	<-d.done
+	d.mu.Lock()
+	d.clear()
+	d.packages = nil
+	d.mu.Unlock()
+	logger.SetConsoleLevel("")
+}
+
+// Write prints a console entry of the logger above the stages.
+func (d *progressDisplay) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clear()
+	n, err := d.out.Write(p)
+	d.draw()
+	return n, err
+}
+
+// apply updates the stages of a package with a progress event, printing the stages and packages that end.
+func (d *progressDisplay) apply(event *catalog.ProgressEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.finished[event.PackageID] {
+		return
+	}
+	if !d.quiet {
+		logger.SetConsoleLevel("warn")
+		d.quiet = true
+	}
+	pkg := d.pkg(event)
+	switch event.Kind {
+	case catalog.ProgressStage:
+		if event.Status == catalog.StageStarted {
+			pkg.stages = append(pkg.stages, &stageProgress{stage: event.Stage, detail: event.Detail, start: event.Time})
+			break
+		}
+		d.completeStage(pkg, event)
+	case catalog.ProgressUpdate:
+		stage := pkg.stage(event.Stage)
+		if stage == nil {
+			stage = &stageProgress{stage: event.Stage, start: event.Time, implicit: true}
+			pkg.stages = append(pkg.stages, stage)
+		}
+		stage.current, stage.group = event.Current, event.Group
+		stage.completed, stage.total = event.Completed, event.Total
+		// Updates can come per file, they are drawn at the next tick
+		return
+	case catalog.ProgressFinished:
+		d.finish(pkg, event)
+	}
+	d.redraw()
+}
+
+// pkg returns the progress of the package of an event, added if it is new.
+func (d *progressDisplay) pkg(event *catalog.ProgressEvent) *packageProgress {
+	for _, pkg := range d.packages {
+		if pkg.id == event.PackageID {
+			return pkg
+		}
+	}
+	pkg := &packageProgress{id: event.PackageID, name: path.Base(event.CellsPath), start: event.Time}
+	d.packages = append(d.packages, pkg)
+	return pkg
+}
+
+// stage returns the running stage of a package, the latest to start if several have the same event type.
+func (p *packageProgress) stage(eventType string) *stageProgress {
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		if p.stages[i].stage == eventType {
+			return p.stages[i]
+		}
+	}
+	return nil
+}
+
+// completeStage prints a stage that completed and stops showing it, with the stages only known from their progress
+// that ran within it.
+func (d *progressDisplay) completeStage(pkg *packageProgress, event *catalog.ProgressEvent) {
+	mark := "✓"
+	switch event.Outcome {
+	case catalog.OutcomeFailure:
+		mark = "✗"
+	case catalog.OutcomeWarning:
+		mark = "!"
+	}
+	line := fmt.Sprintf("%s %s  %-16s ", mark, pkg.name, event.Stage)
+	// Events added without a start, such as appraisal warnings, have no duration
+	if event.DurationMs > 0 {
+		line += formatElapsed(time.Duration(event.DurationMs)*time.Millisecond) + "  "
+	}
+	d.clear()
+	_, _ = fmt.Fprintln(d.out, d.cut(line+event.Detail))
+
+	stage := pkg.stage(event.Stage)
+	pkg.stages = slices.DeleteFunc(pkg.stages, func(s *stageProgress) bool {
+		return s == stage || s.implicit && stage != nil && !s.start.Before(stage.start)
+	})
+}
+
+// finish prints the outcome of a package and stops showing it.
+func (d *progressDisplay) finish(pkg *packageProgress, event *catalog.ProgressEvent) {
+	d.clear()
+	elapsed := time.Since(pkg.start)
+	if event.DurationMs > 0 {
+		elapsed = time.Duration(event.DurationMs) * time.Millisecond
+	}
+	line := fmt.Sprintf("✓ %s preserved in %s", pkg.name, formatElapsed(elapsed))
+	if event.Outcome != catalog.OutcomeSuccess {
+		line = fmt.Sprintf("✗ %s %s after %s", pkg.name, event.Outcome, formatElapsed(elapsed))
+		if event.Detail != "" {
+			line += ": " + event.Detail
+		}
+	}
+	_, _ = fmt.Fprintln(d.out, d.cut(line))
+	d.finished[pkg.id] = true
+	d.packages = slices.DeleteFunc(d.packages, func(p *packageProgress) bool { return p == pkg })
+}
+
+// redraw draws the running stages again.
+func (d *progressDisplay) redraw() {
+	d.clear()
+	d.draw()
+}
+
+// clear erases the lines drawn below the printed output.
+func (d *progressDisplay) clear() {
+	if d.lines > 0 {
+		_, _ = fmt.Fprintf(d.out, "\x1b[%dA\x1b[J", d.lines)
+		d.lines = 0
+	}
+}
+
+// draw draws a line per running stage, or per package between two stages.
+func (d *progressDisplay) draw() {
+	spinner := spinnerFrames[d.frame%len(spinnerFrames)]
+	var b strings.Builder
+	for _, pkg := range d.packages {
+		if len(pkg.stages) == 0 {
+			b.WriteString(d.cut(fmt.Sprintf("%s %s  %s", spinner, pkg.name, formatElapsed(time.Since(pkg.start)))))
+			b.WriteByte('\n')
+			d.lines++
+		}
+		for _, stage := range pkg.stages {
+			b.WriteString(d.cut(fmt.Sprintf("%s %s  %-16s %s", spinner, pkg.name, stage.stage, stage.status())))
+			b.WriteByte('\n')
+			d.lines++
+		}
+	}
+	_, _ = io.WriteString(d.out, b.String())
+}
+
+// status describes the progress of a stage: a bar with the ETA when its total is known, its count otherwise.
+func (s *stageProgress) status() string {
+	elapsed := time.Since(s.start)
+	switch {
+	case s.total > 0:
+		done := min(s.completed, s.total)
+		filled := done * progressBarWidth / s.total
+		eta := "--:--"
+		if done > 0 {
+			eta = formatElapsed(time.Duration(float64(elapsed) / float64(done) * float64(s.total-done)))
+		}
+		return fmt.Sprintf("[%s%s] %3d%%  %d/%d  ETA %s  %s", strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+			done*100/s.total, done, s.total, eta, s.current)
+	case s.group != "":
+		// A3M lists its jobs as they start, the microservice group shows the stage, e.g. Normalize
+		return fmt.Sprintf("%s  %d jobs  %s", formatElapsed(elapsed), s.completed, s.group)
+	case s.completed > 0:
+		return fmt.Sprintf("%s  %d files  %s", formatElapsed(elapsed), s.completed, s.current)
+	}
+	return formatElapsed(elapsed) + "  " + s.detail
+}
+
+// cut cuts a line to the width of the terminal, so that it never wraps and the lines drawn can be erased.
+func (d *progressDisplay) cut(line string) string {
+	runes := []rune(line)
+	if len(runes) >= d.width {
+		return string(runes[:d.width-1])
+	}
+	return line
+}
+
+// formatElapsed formats a duration as minutes and seconds, or hours, minutes and seconds.
+func formatElapsed(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
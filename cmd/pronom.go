@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/penwern/curate-preservation-core/internal/pronom"
+	"github.com/spf13/cobra"
+)
+
+var pronomSince string
+
+var pronomCmd = &cobra.Command{
+	Use:   "pronom",
+	Short: "Keep the format policies in step with PRONOM",
+	Long: `Keep the format policies in step with PRONOM.
+
+The siegfried binary is set by CA4M_PRONOM_SF_PATH, the format policy registry by
+CA4M_FORMAT_POLICIES_CONFIG_PATH, and the PRONOM releases are downloaded from CA4M_PRONOM_RELEASE_URL.`,
+}
+
+var pronomShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the signature file siegfried loads",
+	Args:  cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx := context.Background()
+		svc := newCommandService(ctx)
+		defer svc.Close()
+
+		signatures, err := svc.PronomSignatures(ctx)
+		if err != nil {
+			fatal(err, "Error reading the siegfried signatures: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(signatures)
+			return
+		}
+		printSignatures(signatures)
+	},
+}
+
+var pronomSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Update the signature file to the latest PRONOM release and flag new formats without a policy",
+	Long: `Update the siegfried signature file to the latest PRONOM release with sf -update, and list the
+formats added since the release of the previous signature file, or since the --since release, with
+their policy in the format policy registry. Formats without a policy are flagged.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		svc := newCommandService(ctx)
+		defer svc.Close()
+
+		if dryRun {
+			actions, err := svc.PlanSyncPronom(ctx, pronomSince)
+			if err != nil {
+				fatal(err, "Error planning the PRONOM sync: %v", err)
+			}
+			printPlanned(actions, nil)
+			return
+		}
+		result, err := svc.SyncPronom(ctx, pronomSince)
+		if err != nil {
+			fatal(err, "Error syncing PRONOM: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(result)
+			return
+		}
+		printSignatures(result.After)
+		if !result.Updated {
+			//nolint:forbidigo // Command output is written to stdout
+			fmt.Println("The signature file is already the latest")
+		}
+		//nolint:forbidigo // Command output is written to stdout
+		fmt.Printf("%d new formats since %s, %d without a policy\n", len(result.NewFormats), result.Since, len(result.Unpoliced))
+		for _, format := range result.NewFormats {
+			//nolint:forbidigo // Command output is written to stdout
+			fmt.Printf("%s\t%s\t%s\t%s\n", format.PUID, policyOrFlag(format.Policy), format.Name, format.Version)
+		}
+	},
+}
+
+// printSignatures prints the signature file siegfried loads.
+//
+//nolint:forbidigo // Command output is written to stdout
+func printSignatures(signatures *pronom.Signatures) {
+	fmt.Printf("siegfried:      %s\n", signatures.Version)
+	fmt.Printf("signature file: %s\n", signatures.File)
+	fmt.Printf("PRONOM release: %s\n", signatures.Release)
+	if signatures.Container != "" {
+		fmt.Printf("container:      %s\n", signatures.Container)
+	}
+}
+
+// policyOrFlag returns the action of a format policy, or flags a format without a policy.
+func policyOrFlag(action string) string {
+	if action == "" {
+		return "NO POLICY"
+	}
+	return action
+}
+
+func init() {
+	pronomSyncCmd.Flags().StringVar(&pronomSince, "since", "", "Release the new formats are listed since, e.g. DROID_SignatureFile_V118.xml (defaults to the release of the signature file before the update)")
+
+	pronomCmd.AddCommand(pronomShowCmd, pronomSyncCmd)
+	RootCmd.AddCommand(pronomCmd)
+}
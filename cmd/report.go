@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/report"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportFormat string
+	reportDir    string
+)
+
+// generatedReport is a report written by the report command.
+type generatedReport struct {
+	PackageID string `json:"package_id"`
+	Path      string `json:"path"`
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report <package-id|job-id>...",
+	Short: "Generate the preservation reports of packages as HTML or PDF",
+	Long: `Generate a human-readable preservation report per package for depositors and auditors, as HTML or
+PDF.
+
+The report is built from the data the pipeline already recorded for the package: its outcome and
+identifiers (package, job, AIP UUID, storage replicas, AtoM and ArchivesSpace descriptions, deposits
+and DOIs), its descriptive metadata, a summary of its contents from the manifest of the files
+submitted and their comparison to the AIP, a chart of its file formats identified in the METS of the
+AIP, its fixity status with the latest fixity check of each replica, and the timeline of its events.
+
+Each argument is a package ID, or a job ID whose latest package is reported. The reports are written
+to the --dir directory as <package-id>.html or <package-id>.pdf. PDF reports are printed from the
+HTML report by the command set by CA4M_REPORTS_PDF_COMMAND, a headless Chromium by default.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeReportPackages,
+	Run: func(_ *cobra.Command, args []string) {
+		if !slices.Contains(report.Formats, reportFormat) {
+			logger.Exit(ExitUsage, "Invalid --format %q, expected html or pdf", reportFormat)
+		}
+		// Only the data directory and the PDF command are needed, not the settings of the services
+		cfg, err := config.Read()
+		if err != nil {
+			fatalConfig(err)
+		}
+		initLogger(cfg)
+		store, err := catalog.NewStore(cfg.DataDir)
+		if err != nil {
+			fatal(err, "Error opening package records: %v", err)
+		}
+		if err := os.MkdirAll(reportDir, 0o750); err != nil {
+			fatal(err, "Error creating %s: %v", reportDir, err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		reports := []generatedReport{}
+		var errs commandErrors
+		for _, id := range args {
+			rec, err := store.Get(id)
+			if errors.Is(err, catalog.ErrNotFound) {
+				rec, err = store.FindJob(id)
+			}
+			if err != nil {
+				errs.add("Error reading package %s: %v", id, err)
+				continue
+			}
+			path := filepath.Join(reportDir, rec.ID+"."+reportFormat)
+			if err := writeReport(ctx, cfg, store, rec, path); err != nil {
+				errs.add("Error generating the report of package %s: %v", rec.ID, err)
+				continue
+			}
+			reports = append(reports, generatedReport{PackageID: rec.ID, Path: path})
+		}
+
+		if jsonOutput() {
+			writeJSON(map[string]any{"reports": reports, "errors": orEmpty(errs)})
+		} else {
+			for _, generated := range reports {
+				//nolint:forbidigo // Command output is written to stdout
+				fmt.Printf("%s\t%s\n", generated.PackageID, generated.Path)
+			}
+		}
+		if len(errs) > 0 {
+			logger.Error("Report generation failed")
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+// writeReport writes the preservation report of a package in the format of the command.
+func writeReport(ctx context.Context, cfg *config.Config, store *catalog.Store, rec *catalog.Record, path string) error {
+	r, err := report.Build(rec, store.Dir(rec.ID))
+	if err != nil {
+		return err
+	}
+	if reportFormat == report.FormatPDF {
+		return r.WritePDF(ctx, cfg.Reports.PDFCommand, path)
+	}
+	f, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	if err := r.WriteHTML(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// completeReportPackages completes the IDs of the packages with a record, described by their Cells path.
+func completeReportPackages(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return completePackages(func(*catalog.Record) bool { return true })
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&reportFormat, "format", report.FormatHTML, "Format of the reports: html or pdf")
+	reportCmd.Flags().StringVarP(&reportDir, "dir", "d", ".", "Directory the reports are written to")
+	_ = reportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(report.Formats, cobra.ShellCompDirectiveNoFileComp))
+	_ = reportCmd.MarkFlagDirname("dir")
+	RootCmd.AddCommand(reportCmd)
+}
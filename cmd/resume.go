@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume <job-id|package-id>",
+	Short: "Resume a failed package from its last good stage",
+	Long: `Resume a failed package from its checkpoint, the last stage of the pipeline it completed, rather
+than preserving it again from scratch.
+
+A package records a checkpoint once its transfer is preprocessed, once A3M has produced its AIP, and
+once the AIP is extracted, exported and compressed. The outputs of a failed package are kept in the
+processing directory while CA4M_KEEP_FAILED is enabled, unless it was cancelled, interrupted, or
+failed with an error that happens again, such as an infected or duplicate transfer. Resuming runs
+only the stages after the checkpoint on these outputs, as the same user and job, with the profile
+and deselections of the package.
+
+The argument is a package ID, or a job ID whose latest package is resumed. The resumed package is
+recorded as a new package, and can be resumed in turn if it fails. The command runs where the
+outputs are kept, and exits with the status of its failure if the package is not preserved.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeResumablePackages,
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		var display *progressDisplay
+		if !dryRun {
+			display = newProgressDisplay()
+		}
+		svc := newCommandService(ctx)
+
+		rec, err := svc.ResumablePackage(ctx, args[0])
+		if err != nil {
+			svc.Close()
+			fatal(err, "Error resuming %s: %v", args[0], err)
+		}
+		if dryRun {
+			svc.Close()
+			printPlanned(internal.PlanResume(rec), nil)
+			return
+		}
+		stopProgress := display.Follow(svc.Catalog())
+		resumed, err := svc.ResumePackage(ctx, rec)
+		stopProgress()
+		// Close before exiting so the outcomes are notified
+		svc.Close()
+		if jsonOutput() {
+			result := preservationResult([]string{rec.CellsPath}, err)
+			result["resumed_from"] = rec.ID
+			if resumed != nil {
+				result["package_id"] = resumed.ID
+			}
+			writeJSON(result)
+		} else if resumed != nil {
+			//nolint:forbidigo // Command output is written to stdout
+			fmt.Printf("%s\t%s\n", resumed.ID, resumed.Outcome)
+		}
+		if err != nil {
+			logger.Error("Error resuming package %s: %v", rec.ID, err)
+			os.Exit(exitCode(err))
+		}
+	},
+}
+
+// completeResumablePackages completes the IDs of the failed packages of the package records that can be resumed,
+// described by their Cells path.
+func completeResumablePackages(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completePackages(func(rec *catalog.Record) bool {
+		return rec.Outcome == catalog.OutcomeFailure && rec.Checkpoint != nil
+	})
+}
+
+// completePackages completes the IDs of the package records matching keep, described by their Cells path.
+func completePackages(keep func(rec *catalog.Record) bool) ([]string, cobra.ShellCompDirective) {
+	dataDir, err := config.DataDir()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	// The store is not created by a completion
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	store, err := catalog.NewStore(dataDir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	records, err := store.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var ids []string
+	for _, rec := range records {
+		if keep(rec) {
+			ids = append(ids, rec.ID+"\t"+rec.CellsPath)
+		}
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	resumeCmd.Flags().BoolVar(&noProgress, "no-progress", false, "Log plainly instead of showing the progress of the stages in a terminal")
+	resumeCmd.Flags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	RootCmd.AddCommand(resumeCmd)
+}
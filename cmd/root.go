@@ -7,27 +7,41 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	transferservice "github.com/penwern/curate-preservation-core/common/proto/a3m/gen/go/a3m/api/transferservice/v1beta1"
 	"github.com/penwern/curate-preservation-core/internal"
 	"github.com/penwern/curate-preservation-core/pkg/config"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	addr             string
 	cleanup          bool
 	serve            bool
+	watch            bool
+	agent            bool
+	dryRun           bool
 	allowInsecureTLS bool
 
 	// Pydio Cells
 	cellsArchiveDir string
 	cellsPaths      []string
 	cellsUsername   string
+	deselect        []string
+	parallel        int
 
 	// Preservations Config
+	profile                                         string
 	compressAip                                     bool
 	a3mAssignUuidsToDirectories                     bool
 	a3mExamineContents                              bool
@@ -66,26 +80,51 @@ var RootCmd = &cobra.Command{
 
 Integrates with Pydio Cells and A3M to provide functionality to Cells for preserving packages.
 If the --serve flag is provided, the tool will start a HTTP server.
+If the --watch flag is provided, the tool preserves packages uploaded into the watched Cells folders.
+If the --agent flag is provided, the tool runs the queued jobs of a coordinator started with --serve, as a remote worker agent.
 Otherwise, the tool can be used in the CLI to preserve packages by providing the --path and --username flags.
-Environment configuration is loaded from the environment variables.`,
-	Run: func(_ *cobra.Command, _ []string) {
+Several paths, or glob patterns such as 'personal-files/box-*', are preserved with one configuration load,
+--parallel at a time, and summarized once every package is done.
+Environment configuration is loaded from the environment variables.
+
+Commands exit with a status per kind of failure: 1 unclassified, 2 invalid arguments or flags,
+3 validation, 4 storage, 5 network, 6 integrity and 7 policy.`,
+	Run: func(cmd *cobra.Command, _ []string) {
 		// Create a root context
 		ctx := context.Background()
 
 		startTime := time.Now()
 
+		if dryRun && (serve || watch || agent) {
+			logger.Exit(ExitUsage, "--dry-run cannot be used with --serve, --watch or --agent")
+		}
+		if parallel < 0 {
+			logger.Exit(ExitUsage, "Invalid parallelism %d, use 0 to preserve every package at once", parallel)
+		}
+
 		cfg, err := config.Load()
 		if err != nil {
-			logger.Fatal("Error loading configuration:\n%v", err)
+			fatalConfig(err)
+		}
+
+		// Preservations show the progress of their stages in a terminal
+		var display *progressDisplay
+		if !serve && !watch && !agent && !dryRun {
+			display = newProgressDisplay()
 		}
 
 		// Initialize the logger
-		logger.Initialize(cfg.LogLevel, cfg.LogFilePath)
+		initLogger(cfg)
 		// Only log the execution time once the logger is initialized
 		defer func() {
 			logger.Debug("Execution time: %vs", time.Since(startTime).Seconds())
 		}()
 
+		// Configure the identifier format
+		if err := utils.SetUUIDVersion(cfg.UUIDVersion); err != nil {
+			logger.Fatal("Error configuring identifiers: %v", err)
+		}
+
 		// Override config with CLI flag if provided
 		if allowInsecureTLS {
 			cfg.AllowInsecureTLS = allowInsecureTLS
@@ -113,60 +152,182 @@ Environment configuration is loaded from the environment variables.`,
 
 		svc, err := internal.NewService(ctx, cfg)
 		if err != nil {
-			logger.Fatal("Error creating service: %v", err)
+			fatal(err, "Error creating service: %v", err)
 		}
 		defer svc.Close()
 
+		// Handle watch mode, packages uploaded into the watched folders are preserved until interrupted
+		if watch {
+			watchCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if err := svc.OpenQueue(watchCtx); err != nil {
+				svc.Close()
+				logger.Fatal("Error opening job queue: %v", err)
+			}
+			go svc.ProcessJobs(watchCtx)
+			go svc.MonitorMetrics(watchCtx)
+			internal.NewEventWatcher(svc).Run(watchCtx)
+
+			drainCtx, cancel := context.WithTimeout(ctx, cfg.Shutdown.DrainTimeout)
+			defer cancel()
+			logger.Info("Shutting down, running preservations have %s to complete", cfg.Shutdown.DrainTimeout)
+			if err := svc.Shutdown(drainCtx); err != nil {
+				logger.Error("Error shutting down: %v", err)
+			}
+			return
+		}
+
+		// Handle agent mode, the jobs of the coordinator are run until interrupted
+		if agent {
+			agentCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go svc.MonitorMetrics(agentCtx)
+			if err := svc.RunAgent(agentCtx); err != nil {
+				svc.Close()
+				logger.Fatal("Error running agent: %v", err)
+			}
+
+			drainCtx, cancel := context.WithTimeout(ctx, cfg.Shutdown.DrainTimeout)
+			defer cancel()
+			logger.Info("Shutting down, running preservations have %s to complete", cfg.Shutdown.DrainTimeout)
+			if err := svc.Shutdown(drainCtx); err != nil {
+				logger.Error("Error shutting down: %v", err)
+			}
+			return
+		}
+
 		// Handle serve mode
 		if serve {
+			// The server shuts down gracefully when interrupted
+			serveCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			// Watched uploads and intake transfers are preserved from the job queue
+			if err := svc.OpenQueue(serveCtx); err != nil {
+				svc.Close()
+				logger.Fatal("Error opening job queue: %v", err)
+			}
+			// Remote worker agents pull the queued jobs over the gRPC API when enabled
+			if !cfg.Agents.Enabled {
+				go svc.ProcessJobs(serveCtx)
+			}
+			go svc.MonitorMetrics(serveCtx)
+			// New jobs use the configuration reloaded on SIGHUP or when its files change
+			go svc.WatchConfig(serveCtx)
+			if cfg.Events.Enabled {
+				go internal.NewEventWatcher(svc).Run(serveCtx)
+			}
+			if cfg.HotFolder.Enabled {
+				go func() {
+					if err := internal.NewHotFolder(svc).Run(serveCtx); err != nil {
+						logger.Error("Error watching hot folder: %v", err)
+					}
+				}()
+			}
 			logger.Info("Starting HTTP server on %s", addr)
-			if err := internal.Serve(svc, addr); err != nil {
-				logger.Fatal("Error starting HTTP server: %v", err)
+			if err := internal.Serve(serveCtx, svc, addr); err != nil {
+				svc.Close()
+				logger.Fatal("Error running HTTP server: %v", err)
 			}
 			return
 		}
 
-		preservationCfg := config.PreservationConfig{
-			CompressAip: compressAip,
-			A3mConfig: &transferservice.ProcessingConfig{
-				AssignUuidsToDirectories:                     a3mAssignUuidsToDirectories,
-				ExamineContents:                              a3mExamineContents,
-				GenerateTransferStructureReport:              a3mGenerateTransferStructureReport,
-				DocumentEmptyDirectories:                     a3mDocumentEmptyDirectories,
-				ExtractPackages:                              a3mExtractPackages,
-				DeletePackagesAfterExtraction:                a3mDeletePackagesAfterExtraction,
-				IdentifyTransfer:                             a3mIdentifyTransfer,
-				IdentifySubmissionAndMetadata:                a3mIdentifySubmissionAndMetadata,
-				IdentifyBeforeNormalization:                  a3mIdentifyBeforeNormalization,
-				Normalize:                                    a3mNormalize,
-				TranscribeFiles:                              a3mTranscribeFiles,
-				PerformPolicyChecksOnOriginals:               a3mPerformPolicyChecksOnOriginals,
-				PerformPolicyChecksOnPreservationDerivatives: a3mPerformPolicyChecksOnPreservationDerivatives,
-				PerformPolicyChecksOnAccessDerivatives:       a3mPerformPolicyChecksOnAccessDerivatives,
-				ThumbnailMode:                                a3mThumbnailMode,
-				AipCompressionLevel:                          a3mAipCompressionLevel,
-				AipCompressionAlgorithm:                      a3mAipCompressionAlgorithm,
-			},
+		// Processing options come from the selected profile unless overridden with flags
+		var preservationCfg *config.PreservationConfig
+		if preservationFlagsChanged(cmd) {
+			preservationCfg = &config.PreservationConfig{
+				CompressAip: compressAip,
+				A3mConfig: &transferservice.ProcessingConfig{
+					AssignUuidsToDirectories:                     a3mAssignUuidsToDirectories,
+					ExamineContents:                              a3mExamineContents,
+					GenerateTransferStructureReport:              a3mGenerateTransferStructureReport,
+					DocumentEmptyDirectories:                     a3mDocumentEmptyDirectories,
+					ExtractPackages:                              a3mExtractPackages,
+					DeletePackagesAfterExtraction:                a3mDeletePackagesAfterExtraction,
+					IdentifyTransfer:                             a3mIdentifyTransfer,
+					IdentifySubmissionAndMetadata:                a3mIdentifySubmissionAndMetadata,
+					IdentifyBeforeNormalization:                  a3mIdentifyBeforeNormalization,
+					Normalize:                                    a3mNormalize,
+					TranscribeFiles:                              a3mTranscribeFiles,
+					PerformPolicyChecksOnOriginals:               a3mPerformPolicyChecksOnOriginals,
+					PerformPolicyChecksOnPreservationDerivatives: a3mPerformPolicyChecksOnPreservationDerivatives,
+					PerformPolicyChecksOnAccessDerivatives:       a3mPerformPolicyChecksOnAccessDerivatives,
+					ThumbnailMode:                                a3mThumbnailMode,
+					AipCompressionLevel:                          a3mAipCompressionLevel,
+					AipCompressionAlgorithm:                      a3mAipCompressionAlgorithm,
+				},
+			}
+		}
+
+		// Glob patterns are expanded to the packages they match
+		paths, err := svc.ExpandPaths(ctx, cellsUsername, cellsPaths)
+		if err != nil {
+			fatal(err, "Error expanding paths: %v", err)
 		}
 
 		svcArgs := internal.ServiceArgs{
 			AllowInsecureTLS: allowInsecureTLS,
 			CellsArchiveDir:  cellsArchiveDir,
-			CellsPaths:       cellsPaths,
+			CellsPaths:       paths,
 			CellsUsername:    cellsUsername,
 			Cleanup:          cleanup,
-			PreservationCfg:  &preservationCfg,
+			PreservationCfg:  preservationCfg,
+			Profile:          profile,
+			Deselect:         deselect,
 			AtomCfg:          finalAtomConfig,
 		}
 
-		if err := svc.RunArgs(ctx, &svcArgs); err != nil {
+		if dryRun {
+			plans, err := svc.PlanArgs(ctx, &svcArgs)
+			if err != nil {
+				fatal(err, "Error planning preservation: %v", err)
+			}
+			if jsonOutput() {
+				writeJSON(map[string]any{"plans": plans})
+				return
+			}
+			if err := encodeJSON(os.Stdout, plans); err != nil {
+				logger.Fatal("Error writing plans: %v", err)
+			}
+			return
+		}
+		stopProgress := display.Follow(svc.Catalog())
+		results, err := svc.PreserveArgs(ctx, &svcArgs, parallel)
+		stopProgress()
+		if err != nil {
 			logger.Debug("Error running preservation: %v", err)
 		}
+		if jsonOutput() {
+			result := preservationResult(paths, err)
+			result["results"] = orEmpty(results)
+			writeJSON(result)
+		} else if len(results) > 1 {
+			printPackageResults(results)
+		}
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
 	},
 }
 
+// printPackageResults prints the outcome of each package preserved by the command, and the number preserved.
+func printPackageResults(results []*internal.PackageResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PATH\tSTATUS\tPACKAGE\tDURATION\tERROR")
+	completed := 0
+	for _, result := range results {
+		if result.Status == internal.JobStatusCompleted {
+			completed++
+		}
+		duration := (time.Duration(result.DurationMs) * time.Millisecond).Round(time.Second)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.Path, result.Status, orDash(result.PackageID), duration, orDash(result.Error))
+	}
+	_ = w.Flush()
+	//nolint:forbidigo // Command output is written to stdout
+	fmt.Printf("\n%d of %d packages preserved\n", completed, len(results))
+}
+
 func init() {
-	cobra.OnInitialize(config.Init)
+	cobra.OnInitialize(config.Init, initOutput)
 
 	defaultPreservationCfg := config.DefaultPreservationConfig()
 	defaultAtomCfg := config.DefaultAtomConfig()
@@ -176,15 +337,25 @@ func init() {
 
 	RootCmd.Flags().BoolVar(&serve, "serve", false, "Start HTTP server")
 	RootCmd.Flags().StringVar(&addr, "addr", ":6905", "HTTP listen address (with --serve)")
+	RootCmd.Flags().BoolVar(&watch, "watch", false, "Preserve packages uploaded into the Cells folders set in CA4M_EVENTS_PATHS")
+	RootCmd.Flags().BoolVar(&agent, "agent", false, "Run the queued jobs of the coordinator set in CA4M_AGENT_COORDINATOR")
+	RootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Report the planned actions of the command without modifying anything")
+	RootCmd.PersistentFlags().StringVar(&outputFormat, "output", outputText, "Output format: text or json")
+	_ = RootCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{outputText, outputJSON}, cobra.ShellCompDirectiveNoFileComp))
 	RootCmd.Flags().BoolVar(&cleanup, "cleanup", true, "Cleanup after run")
 	RootCmd.Flags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	RootCmd.Flags().BoolVar(&noProgress, "no-progress", false, "Log plainly instead of showing the progress of the stages in a terminal")
 
 	// Cells
-	RootCmd.Flags().StringSliceVarP(&cellsPaths, "cells-path", "p", nil, "Cells paths to preserve. can provide multiple.")
+	RootCmd.Flags().StringSliceVarP(&cellsPaths, "cells-path", "p", nil, "Cells paths, or glob patterns such as personal-files/box-*, to preserve. can provide multiple.")
 	RootCmd.Flags().StringVarP(&cellsUsername, "cells-username", "u", "", "Cells username (required)")
 	RootCmd.Flags().StringVarP(&cellsArchiveDir, "cells-archive-dir", "a", "common-files", "Cells archive directory")
+	RootCmd.Flags().IntVar(&parallel, "parallel", 0, "Packages preserved at a time, within the global concurrency limit (0 for every package at once)")
+	RootCmd.Flags().StringSliceVar(&deselect, "deselect", nil, "Paths or glob patterns, relative to the package, to remove before packaging. can provide multiple.")
 
 	// Preservation
+	RootCmd.Flags().StringVar(&profile, "profile", "", "Processing profile name (defaults to the workspace or default profile)")
+	_ = RootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
 	RootCmd.Flags().BoolVar(&compressAip, "compress-aip", defaultPreservationCfg.CompressAip, "Compress AIP")
 	// A3M
 	RootCmd.Flags().BoolVar(&a3mAssignUuidsToDirectories, "a3m-assign-uuids-to-directories", defaultPreservationCfg.A3mConfig.AssignUuidsToDirectories, "Assign UUIDs to directories")
@@ -232,7 +403,7 @@ func init() {
 
 	// Conditionally mark flags as required
 	RootCmd.PreRun = func(cmd *cobra.Command, _ []string) {
-		if !serve {
+		if !serve && !watch && !agent {
 			if err := cmd.MarkFlagRequired("cells-username"); err != nil {
 				logger.Fatal("Error marking username as required: %v", err)
 			}
@@ -242,3 +413,26 @@ func init() {
 		}
 	}
 }
+
+// preservationFlagsChanged reports whether any preservation config flag was set on the command line.
+func preservationFlagsChanged(cmd *cobra.Command) bool {
+	changed := false
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name == "compress-aip" || strings.HasPrefix(f.Name, "a3m-") {
+			changed = true
+		}
+	})
+	return changed
+}
+
+// initLogger initializes the logger with the configured outputs.
+func initLogger(cfg *config.Config) {
+	var outputs []logger.Output
+	if cfg.LogSyslogAddress != "" {
+		outputs = append(outputs, logger.Syslog(cfg.LogSyslogAddress, cfg.LogSyslogFacility, cfg.LogSyslogAppName))
+	}
+	if cfg.LogJournald {
+		outputs = append(outputs, logger.Journald(cfg.LogSyslogAppName))
+	}
+	logger.Initialize(cfg.LogLevel, cfg.LogFilePath, outputs...)
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sourceUsername string
+	sourcePreserve bool
+	sourceProfile  string
+)
+
+var sourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Pull transfers from SFTP, FTPS, WebDAV and S3 servers",
+	Long: `Pull transfers from SFTP, FTPS, WebDAV and S3 servers.
+
+The transfer sources are configured in the file set by CA4M_SOURCES_CONFIG_PATH.
+Pulled transfers are verified and uploaded to the destination Cells folder of the source.`,
+}
+
+var sourceListCmd = &cobra.Command{
+	Use:   "list <source> [path]",
+	Short: "List a directory of a transfer source",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		svc := newCommandService(ctx)
+		defer svc.Close()
+
+		dir := ""
+		if len(args) == 2 {
+			dir = args[1]
+		}
+		entries, err := svc.ListSource(ctx, args[0], dir)
+		if err != nil {
+			fatal(err, "Error listing transfer source: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"entries": orEmpty(entries)})
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Path
+			if entry.IsDir {
+				name += "/"
+			}
+			//nolint:forbidigo // Command output is written to stdout
+			fmt.Printf("%d\t%s\t%s\n", entry.Size, entry.ModTime.Format("2006-01-02 15:04"), name)
+		}
+	},
+}
+
+var sourcePullCmd = &cobra.Command{
+	Use:   "pull <source> <path>...",
+	Short: "Pull transfers into Cells, and optionally preserve them",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		var display *progressDisplay
+		if sourcePreserve && !dryRun {
+			display = newProgressDisplay()
+		}
+		svc := newCommandService(ctx)
+
+		if dryRun {
+			actions, err := svc.PlanPullTransfers(ctx, args[0], args[1:], sourcePreserve, sourceProfile)
+			svc.Close()
+			var errs commandErrors
+			if err != nil {
+				errs.add("%v", err)
+			}
+			printPlanned(actions, errs)
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+			return
+		}
+		if sourcePreserve {
+			stopProgress := display.Follow(svc.Catalog())
+			err := svc.PreserveFromSource(ctx, sourceUsername, args[0], args[1:], sourceProfile)
+			stopProgress()
+			// Close before exiting so the outcomes are notified
+			svc.Close()
+			if jsonOutput() {
+				writeJSON(preservationResult(args[1:], err))
+			}
+			if err != nil {
+				logger.Error("%v", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		}
+		paths, err := svc.PullTransfers(ctx, sourceUsername, args[0], args[1:])
+		svc.Close()
+		if jsonOutput() {
+			result := map[string]any{"paths": orEmpty(paths)}
+			if err != nil {
+				result["error"] = err.Error()
+			}
+			writeJSON(result)
+		} else {
+			for _, path := range paths {
+				//nolint:forbidigo // Command output is written to stdout
+				fmt.Println(path)
+			}
+		}
+		if err != nil {
+			logger.Error("%v", err)
+			os.Exit(exitCode(err))
+		}
+	},
+}
+
+func init() {
+	sourcePullCmd.Flags().StringVarP(&sourceUsername, "cells-username", "u", "", "Cells username (required)")
+	sourcePullCmd.Flags().BoolVar(&sourcePreserve, "preserve", false, "Preserve the transfers once pulled")
+	sourcePullCmd.Flags().BoolVar(&noProgress, "no-progress", false, "Log plainly instead of showing the progress of the stages in a terminal (with --preserve)")
+	sourcePullCmd.Flags().StringVar(&sourceProfile, "profile", "", "Processing profile name (defaults to the profile of the destination folder)")
+	_ = sourcePullCmd.MarkFlagRequired("cells-username")
+	_ = sourcePullCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	sourceCmd.PersistentFlags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	sourceCmd.AddCommand(sourceListCmd, sourcePullCmd)
+	RootCmd.AddCommand(sourceCmd)
+}
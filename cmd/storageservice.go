@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	storageServicePipeline string
+	storageServiceUsername string
+)
+
+var storageServiceCmd = &cobra.Command{
+	Use:   "storage-service",
+	Short: "Work with AIPs in the Archivematica Storage Service",
+	Long: `Work with AIPs in the Archivematica Storage Service.
+
+The Storage Service is configured in the file set by CA4M_STORAGE_SERVICE_CONFIG_PATH.`,
+}
+
+var storageServiceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored AIPs",
+	Args:  cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx := context.Background()
+		svc := newCommandService(ctx)
+		defer svc.Close()
+
+		aips, err := svc.ListStorageServiceAIPs(ctx, storageServicePipeline)
+		if err != nil {
+			fatal(err, "Error listing AIPs: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"aips": orEmpty(aips)})
+			return
+		}
+		for _, aip := range aips {
+			//nolint:forbidigo // Command output is written to stdout
+			fmt.Printf("%s\t%d\t%s\t%s\n", aip.UUID, aip.Size, aip.StoredDate, aip.Name())
+		}
+	},
+}
+
+var storageServiceMirrorCmd = &cobra.Command{
+	Use:   "mirror <aip-uuid>...",
+	Short: "Fetch, verify and mirror AIPs into the archive workspace",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		ctx := context.Background()
+		svc := newCommandService(ctx)
+
+		if dryRun {
+			actions, err := svc.PlanMirrorAIPs(ctx, args)
+			svc.Close()
+			var errs commandErrors
+			if err != nil {
+				errs.add("%v", err)
+			}
+			printPlanned(actions, errs)
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+			return
+		}
+		paths, err := svc.MirrorAIPs(ctx, storageServiceUsername, args)
+		svc.Close()
+		if jsonOutput() {
+			result := map[string]any{"paths": orEmpty(paths)}
+			if err != nil {
+				result["error"] = err.Error()
+			}
+			writeJSON(result)
+		} else {
+			for _, path := range paths {
+				//nolint:forbidigo // Command output is written to stdout
+				fmt.Println(path)
+			}
+		}
+		if err != nil {
+			logger.Error("%v", err)
+			os.Exit(exitCode(err))
+		}
+	},
+}
+
+// newCommandService loads the configuration and creates the preservation service for a subcommand.
+func newCommandService(ctx context.Context) *internal.Service {
+	cfg, err := config.Load()
+	if err != nil {
+		fatalConfig(err)
+	}
+	initLogger(cfg)
+	if err := utils.SetUUIDVersion(cfg.UUIDVersion); err != nil {
+		logger.Fatal("Error configuring identifiers: %v", err)
+	}
+	if allowInsecureTLS {
+		cfg.AllowInsecureTLS = allowInsecureTLS
+	}
+	svc, err := internal.NewService(ctx, cfg)
+	if err != nil {
+		fatal(err, "Error creating service: %v", err)
+	}
+	return svc
+}
+
+func init() {
+	storageServiceListCmd.Flags().StringVar(&storageServicePipeline, "pipeline", "", "Only list AIPs from this pipeline UUID")
+	storageServiceMirrorCmd.Flags().StringVarP(&storageServiceUsername, "cells-username", "u", "", "Cells username (required)")
+	_ = storageServiceMirrorCmd.MarkFlagRequired("cells-username")
+
+	storageServiceCmd.PersistentFlags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+	storageServiceCmd.AddCommand(storageServiceListCmd, storageServiceMirrorCmd)
+	RootCmd.AddCommand(storageServiceCmd)
+}
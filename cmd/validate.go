@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/penwern/curate-preservation-core/internal/validation"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateChecks []string
+	validateOutput string
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <path>...",
+	Short: "Validate packages and bags",
+	Long: `Validate packages and bags, as directories or archives (zip, tar or 7z).
+
+The checks are run against each package:
+  structure  The layout of an A3M AIP: a single METS.<uuid>.xml file, objects and logs
+  bagit      The BagIt declaration, the completeness and checksums of the payload, the tag manifests and Payload-Oxum
+  mets       The files, checksums and identifiers referenced by the METS file
+
+A JSON report is written per package, one per line, with the errors and warnings found, or a single
+document with every report with --output json.
+The command exits with status 3 if any package has errors or cannot be read, so it can be used
+in the acceptance scripts of vendor deliveries. No configuration is needed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		for _, check := range validateChecks {
+			if !slices.Contains(validation.Checks, check) {
+				logger.Exit(ExitUsage, "Invalid check %q, expected one of %s", check, strings.Join(validation.Checks, ", "))
+			}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		out := os.Stdout
+		var err error
+		toFile := validateOutput != "" && validateOutput != "-"
+		if toFile {
+			if out, err = os.Create(validateOutput); err != nil {
+				logger.Fatal("Error creating %s: %v", validateOutput, err)
+			}
+		}
+		w := bufio.NewWriter(out)
+		encoder := json.NewEncoder(w)
+
+		valid := true
+		var reports []*validation.Report
+		for _, path := range args {
+			report, err := validation.Validate(ctx, path, validateChecks...)
+			if ctx.Err() != nil {
+				logger.Fatal("Validation interrupted")
+			}
+			if err != nil {
+				// Unreadable packages are reported like invalid ones, for the scripts reading the reports
+				report = &validation.Report{
+					Path:   path,
+					Checks: validateChecks,
+					Errors: []validation.Issue{{Check: "read", Message: err.Error()}},
+				}
+			}
+			valid = valid && report.Valid
+			reports = append(reports, report)
+			if jsonOutput() && !toFile {
+				continue
+			}
+			if err := encoder.Encode(report); err != nil {
+				logger.Fatal("Error writing report: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			logger.Fatal("Error writing reports: %v", err)
+		}
+		if err := out.Close(); err != nil {
+			logger.Fatal("Error writing reports: %v", err)
+		}
+		if jsonOutput() {
+			writeJSON(map[string]any{"valid": valid, "reports": reports})
+		}
+		if !valid {
+			os.Exit(ExitValidation)
+		}
+	},
+}
+
+func init() {
+	validateCmd.Flags().StringSliceVar(&validateChecks, "checks", validation.Checks, "Checks to run: structure, bagit and mets")
+	validateCmd.Flags().StringVarP(&validateOutput, "report-file", "o", "", "File the reports are written to (default stdout)")
+
+	RootCmd.AddCommand(validateCmd)
+}
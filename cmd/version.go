@@ -13,6 +13,17 @@ var versionCmd = &cobra.Command{
 	Short: "Print version information",
 	Long:  `Display version, build time, and commit information for the Curate Preservation System.`,
 	Run: func(_ *cobra.Command, _ []string) {
+		if jsonOutput() {
+			writeJSON(map[string]string{
+				"version":    version.Version(),
+				"commit":     version.Commit(),
+				"build_date": version.BuildTime(),
+				"go_version": runtime.Version(),
+				"os":         runtime.GOOS,
+				"arch":       runtime.GOARCH,
+			})
+			return
+		}
 		//nolint:forbidigo // Version command needs to output directly to stdout
 		fmt.Printf("Curate Preservation System\n")
 		//nolint:forbidigo // Version command needs to output directly to stdout
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchDestination string
+	watchUsername    string
+	watchProfile     string
+	watchSettle      time.Duration
+	watchInterval    time.Duration
+	watchProcessed   string
+	watchFailed      string
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <dir>",
+	Short: "Preserve the transfers dropped into a hot folder",
+	Long: `Preserve the transfers dropped into a local hot folder until interrupted.
+
+Every folder or file created directly inside the directory is a transfer. Once it stayed unchanged
+during the settle delay, it is copied to the Cells destination folder and preserved from there, as
+the given user and with the given profile. Preserved transfers are moved to the processed directory,
+and transfers that failed to be submitted or preserved to the failed directory. Hidden entries are
+ignored, so copy transfers under a hidden name and rename them once complete.
+
+Settings not given as flags come from the CA4M_HOT_FOLDER_* variables. The same hot folder is watched
+alongside the HTTP API of --serve with CA4M_HOT_FOLDER_ENABLED.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		cfg, err := config.Load()
+		if err != nil {
+			fatalConfig(err)
+		}
+		initLogger(cfg)
+		if err := utils.SetUUIDVersion(cfg.UUIDVersion); err != nil {
+			logger.Fatal("Error configuring identifiers: %v", err)
+		}
+		if allowInsecureTLS {
+			cfg.AllowInsecureTLS = allowInsecureTLS
+		}
+
+		hotFolder := &cfg.HotFolder
+		hotFolder.Dir = args[0]
+		flags := cmd.Flags()
+		if flags.Changed("destination") {
+			hotFolder.Destination = watchDestination
+		}
+		if flags.Changed("cells-username") {
+			hotFolder.Username = watchUsername
+		}
+		if flags.Changed("profile") {
+			hotFolder.Profile = watchProfile
+		}
+		if flags.Changed("settle") {
+			hotFolder.SettleDelay = watchSettle
+		}
+		if flags.Changed("interval") {
+			hotFolder.PollInterval = watchInterval
+		}
+		if flags.Changed("processed") {
+			hotFolder.ProcessedDir = watchProcessed
+		}
+		if flags.Changed("failed") {
+			hotFolder.FailedDir = watchFailed
+		}
+		if hotFolder.Destination == "" || hotFolder.Username == "" {
+			logger.Fatal("The Cells destination and username are required, with --destination and --cells-username or CA4M_HOT_FOLDER_DESTINATION and CA4M_HOT_FOLDER_USERNAME")
+		}
+
+		svc, err := internal.NewService(ctx, cfg)
+		if err != nil {
+			fatal(err, "Error creating service: %v", err)
+		}
+		defer svc.Close()
+
+		if dryRun {
+			actions, err := internal.NewHotFolder(svc).Plan()
+			if err != nil {
+				svc.Close()
+				logger.Fatal("Error planning hot folder: %v", err)
+			}
+			printPlanned(actions, nil)
+			return
+		}
+
+		watchCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := svc.OpenQueue(watchCtx); err != nil {
+			svc.Close()
+			logger.Fatal("Error opening job queue: %v", err)
+		}
+		go svc.ProcessJobs(watchCtx)
+		go svc.MonitorMetrics(watchCtx)
+		if err := internal.NewHotFolder(svc).Run(watchCtx); err != nil {
+			svc.Close()
+			logger.Fatal("Error watching hot folder: %v", err)
+		}
+
+		drainCtx, cancel := context.WithTimeout(ctx, cfg.Shutdown.DrainTimeout)
+		defer cancel()
+		logger.Info("Shutting down, running preservations have %s to complete", cfg.Shutdown.DrainTimeout)
+		if err := svc.Shutdown(drainCtx); err != nil {
+			logger.Error("Error shutting down: %v", err)
+		}
+	},
+}
+
+func init() {
+	watchCmd.Flags().StringVar(&watchDestination, "destination", "", "Cells folder the transfers are copied to and preserved from (default $CA4M_HOT_FOLDER_DESTINATION)")
+	watchCmd.Flags().StringVarP(&watchUsername, "cells-username", "u", "", "Cells user the transfers are copied and preserved as (default $CA4M_HOT_FOLDER_USERNAME)")
+	watchCmd.Flags().StringVar(&watchProfile, "profile", "", "Processing profile of the transfers (default $CA4M_HOT_FOLDER_PROFILE, or the profile of the path)")
+	watchCmd.Flags().DurationVar(&watchSettle, "settle", 0, "Time a transfer must stay unchanged before it is submitted (default $CA4M_HOT_FOLDER_SETTLE_DELAY, or 1m)")
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 0, "Interval at which the hot folder is scanned (default $CA4M_HOT_FOLDER_POLL_INTERVAL, or 10s)")
+	watchCmd.Flags().StringVar(&watchProcessed, "processed", "", "Directory preserved transfers are moved to (default $CA4M_HOT_FOLDER_PROCESSED_DIR, or <dir>/processed)")
+	watchCmd.Flags().StringVar(&watchFailed, "failed", "", "Directory failed transfers are moved to (default $CA4M_HOT_FOLDER_FAILED_DIR, or <dir>/failed)")
+	watchCmd.Flags().BoolVar(&allowInsecureTLS, "allow-insecure-tls", false, "Allow insecure TLS connections (for testing only)")
+
+	_ = watchCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	RootCmd.AddCommand(watchCmd)
+}
@@ -0,0 +1,489 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: curate/preservation/v1/agents.proto
+
+package preservationv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// JobResult is the result of a job run by an agent.
+type JobResult int32
+
+const (
+	JobResult_JOB_RESULT_UNSPECIFIED JobResult = 0
+	JobResult_JOB_RESULT_COMPLETED   JobResult = 1
+	JobResult_JOB_RESULT_FAILED      JobResult = 2
+	JobResult_JOB_RESULT_CANCELLED   JobResult = 3
+	// Interrupted by the shutdown of the agent, the job is queued again.
+	JobResult_JOB_RESULT_INTERRUPTED JobResult = 4
+)
+
+// Enum value maps for JobResult.
+var (
+	JobResult_name = map[int32]string{
+		0: "JOB_RESULT_UNSPECIFIED",
+		1: "JOB_RESULT_COMPLETED",
+		2: "JOB_RESULT_FAILED",
+		3: "JOB_RESULT_CANCELLED",
+		4: "JOB_RESULT_INTERRUPTED",
+	}
+	JobResult_value = map[string]int32{
+		"JOB_RESULT_UNSPECIFIED": 0,
+		"JOB_RESULT_COMPLETED":   1,
+		"JOB_RESULT_FAILED":      2,
+		"JOB_RESULT_CANCELLED":   3,
+		"JOB_RESULT_INTERRUPTED": 4,
+	}
+)
+
+func (x JobResult) Enum() *JobResult {
+	p := new(JobResult)
+	*p = x
+	return p
+}
+
+func (x JobResult) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JobResult) Descriptor() protoreflect.EnumDescriptor {
+	return file_curate_preservation_v1_agents_proto_enumTypes[0].Descriptor()
+}
+
+func (JobResult) Type() protoreflect.EnumType {
+	return &file_curate_preservation_v1_agents_proto_enumTypes[0]
+}
+
+func (x JobResult) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JobResult.Descriptor instead.
+func (JobResult) EnumDescriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_agents_proto_rawDescGZIP(), []int{0}
+}
+
+type AcquireJobRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name of the agent, e.g. its host name.
+	Agent         string `protobuf:"bytes,1,opt,name=agent,proto3" json:"agent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AcquireJobRequest) Reset() {
+	*x = AcquireJobRequest{}
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AcquireJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AcquireJobRequest) ProtoMessage() {}
+
+func (x *AcquireJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AcquireJobRequest.ProtoReflect.Descriptor instead.
+func (*AcquireJobRequest) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_agents_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AcquireJobRequest) GetAgent() string {
+	if x != nil {
+		return x.Agent
+	}
+	return ""
+}
+
+type AcquireJobResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Lease of the job, empty if no job was queued.
+	Lease string `protobuf:"bytes,1,opt,name=lease,proto3" json:"lease,omitempty"`
+	// Job as queued on the coordinator, encoded in JSON. Agents run the jobs of coordinators of the same version.
+	Job []byte `protobuf:"bytes,2,opt,name=job,proto3" json:"job,omitempty"`
+	// Time without renewal after which the job is queued again.
+	LeaseTimeoutMs int64 `protobuf:"varint,3,opt,name=lease_timeout_ms,json=leaseTimeoutMs,proto3" json:"lease_timeout_ms,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *AcquireJobResponse) Reset() {
+	*x = AcquireJobResponse{}
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AcquireJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AcquireJobResponse) ProtoMessage() {}
+
+func (x *AcquireJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AcquireJobResponse.ProtoReflect.Descriptor instead.
+func (*AcquireJobResponse) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_agents_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AcquireJobResponse) GetLease() string {
+	if x != nil {
+		return x.Lease
+	}
+	return ""
+}
+
+func (x *AcquireJobResponse) GetJob() []byte {
+	if x != nil {
+		return x.Job
+	}
+	return nil
+}
+
+func (x *AcquireJobResponse) GetLeaseTimeoutMs() int64 {
+	if x != nil {
+		return x.LeaseTimeoutMs
+	}
+	return 0
+}
+
+type RenewLeaseRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Lease string                 `protobuf:"bytes,1,opt,name=lease,proto3" json:"lease,omitempty"`
+	// Package record of the job, encoded in JSON, once the preservation started.
+	Record        []byte `protobuf:"bytes,2,opt,name=record,proto3" json:"record,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenewLeaseRequest) Reset() {
+	*x = RenewLeaseRequest{}
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenewLeaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenewLeaseRequest) ProtoMessage() {}
+
+func (x *RenewLeaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenewLeaseRequest.ProtoReflect.Descriptor instead.
+func (*RenewLeaseRequest) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_agents_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RenewLeaseRequest) GetLease() string {
+	if x != nil {
+		return x.Lease
+	}
+	return ""
+}
+
+func (x *RenewLeaseRequest) GetRecord() []byte {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+type RenewLeaseResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Set once the job is cancelled, the agent stops it and completes it as cancelled.
+	Cancelled     bool `protobuf:"varint,1,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenewLeaseResponse) Reset() {
+	*x = RenewLeaseResponse{}
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenewLeaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenewLeaseResponse) ProtoMessage() {}
+
+func (x *RenewLeaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenewLeaseResponse.ProtoReflect.Descriptor instead.
+func (*RenewLeaseResponse) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_agents_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RenewLeaseResponse) GetCancelled() bool {
+	if x != nil {
+		return x.Cancelled
+	}
+	return false
+}
+
+type CompleteJobRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Lease  string                 `protobuf:"bytes,1,opt,name=lease,proto3" json:"lease,omitempty"`
+	Result JobResult              `protobuf:"varint,2,opt,name=result,proto3,enum=curate.preservation.v1.JobResult" json:"result,omitempty"`
+	// Error of a failed job.
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// Package record of the job, encoded in JSON, if the preservation started.
+	Record        []byte `protobuf:"bytes,4,opt,name=record,proto3" json:"record,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompleteJobRequest) Reset() {
+	*x = CompleteJobRequest{}
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompleteJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompleteJobRequest) ProtoMessage() {}
+
+func (x *CompleteJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompleteJobRequest.ProtoReflect.Descriptor instead.
+func (*CompleteJobRequest) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_agents_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CompleteJobRequest) GetLease() string {
+	if x != nil {
+		return x.Lease
+	}
+	return ""
+}
+
+func (x *CompleteJobRequest) GetResult() JobResult {
+	if x != nil {
+		return x.Result
+	}
+	return JobResult_JOB_RESULT_UNSPECIFIED
+}
+
+func (x *CompleteJobRequest) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CompleteJobRequest) GetRecord() []byte {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+type CompleteJobResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompleteJobResponse) Reset() {
+	*x = CompleteJobResponse{}
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompleteJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompleteJobResponse) ProtoMessage() {}
+
+func (x *CompleteJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_agents_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompleteJobResponse.ProtoReflect.Descriptor instead.
+func (*CompleteJobResponse) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_agents_proto_rawDescGZIP(), []int{5}
+}
+
+var File_curate_preservation_v1_agents_proto protoreflect.FileDescriptor
+
+const file_curate_preservation_v1_agents_proto_rawDesc = "" +
+	"\n" +
+	"#curate/preservation/v1/agents.proto\x12\x16curate.preservation.v1\")\n" +
+	"\x11AcquireJobRequest\x12\x14\n" +
+	"\x05agent\x18\x01 \x01(\tR\x05agent\"f\n" +
+	"\x12AcquireJobResponse\x12\x14\n" +
+	"\x05lease\x18\x01 \x01(\tR\x05lease\x12\x10\n" +
+	"\x03job\x18\x02 \x01(\fR\x03job\x12(\n" +
+	"\x10lease_timeout_ms\x18\x03 \x01(\x03R\x0eleaseTimeoutMs\"A\n" +
+	"\x11RenewLeaseRequest\x12\x14\n" +
+	"\x05lease\x18\x01 \x01(\tR\x05lease\x12\x16\n" +
+	"\x06record\x18\x02 \x01(\fR\x06record\"2\n" +
+	"\x12RenewLeaseResponse\x12\x1c\n" +
+	"\tcancelled\x18\x01 \x01(\bR\tcancelled\"\x93\x01\n" +
+	"\x12CompleteJobRequest\x12\x14\n" +
+	"\x05lease\x18\x01 \x01(\tR\x05lease\x129\n" +
+	"\x06result\x18\x02 \x01(\x0e2!.curate.preservation.v1.JobResultR\x06result\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x16\n" +
+	"\x06record\x18\x04 \x01(\fR\x06record\"\x15\n" +
+	"\x13CompleteJobResponse*\x8e\x01\n" +
+	"\tJobResult\x12\x1a\n" +
+	"\x16JOB_RESULT_UNSPECIFIED\x10\x00\x12\x18\n" +
+	"\x14JOB_RESULT_COMPLETED\x10\x01\x12\x15\n" +
+	"\x11JOB_RESULT_FAILED\x10\x02\x12\x18\n" +
+	"\x14JOB_RESULT_CANCELLED\x10\x03\x12\x1a\n" +
+	"\x16JOB_RESULT_INTERRUPTED\x10\x042\xc0\x02\n" +
+	"\fAgentService\x12c\n" +
+	"\n" +
+	"AcquireJob\x12).curate.preservation.v1.AcquireJobRequest\x1a*.curate.preservation.v1.AcquireJobResponse\x12c\n" +
+	"\n" +
+	"RenewLease\x12).curate.preservation.v1.RenewLeaseRequest\x1a*.curate.preservation.v1.RenewLeaseResponse\x12f\n" +
+	"\vCompleteJob\x12*.curate.preservation.v1.CompleteJobRequest\x1a+.curate.preservation.v1.CompleteJobResponseBnZlgithub.com/penwern/curate-preservation-core/common/proto/curate/gen/go/curate/preservation/v1;preservationv1b\x06proto3"
+
+var (
+	file_curate_preservation_v1_agents_proto_rawDescOnce sync.Once
+	file_curate_preservation_v1_agents_proto_rawDescData []byte
+)
+
+func file_curate_preservation_v1_agents_proto_rawDescGZIP() []byte {
+	file_curate_preservation_v1_agents_proto_rawDescOnce.Do(func() {
+		file_curate_preservation_v1_agents_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_curate_preservation_v1_agents_proto_rawDesc), len(file_curate_preservation_v1_agents_proto_rawDesc)))
+	})
+	return file_curate_preservation_v1_agents_proto_rawDescData
+}
+
+var file_curate_preservation_v1_agents_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_curate_preservation_v1_agents_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_curate_preservation_v1_agents_proto_goTypes = []any{
+	(JobResult)(0),              // 0: curate.preservation.v1.JobResult
+	(*AcquireJobRequest)(nil),   // 1: curate.preservation.v1.AcquireJobRequest
+	(*AcquireJobResponse)(nil),  // 2: curate.preservation.v1.AcquireJobResponse
+	(*RenewLeaseRequest)(nil),   // 3: curate.preservation.v1.RenewLeaseRequest
+	(*RenewLeaseResponse)(nil),  // 4: curate.preservation.v1.RenewLeaseResponse
+	(*CompleteJobRequest)(nil),  // 5: curate.preservation.v1.CompleteJobRequest
+	(*CompleteJobResponse)(nil), // 6: curate.preservation.v1.CompleteJobResponse
+}
+var file_curate_preservation_v1_agents_proto_depIdxs = []int32{
+	0, // 0: curate.preservation.v1.CompleteJobRequest.result:type_name -> curate.preservation.v1.JobResult
+	1, // 1: curate.preservation.v1.AgentService.AcquireJob:input_type -> curate.preservation.v1.AcquireJobRequest
+	3, // 2: curate.preservation.v1.AgentService.RenewLease:input_type -> curate.preservation.v1.RenewLeaseRequest
+	5, // 3: curate.preservation.v1.AgentService.CompleteJob:input_type -> curate.preservation.v1.CompleteJobRequest
+	2, // 4: curate.preservation.v1.AgentService.AcquireJob:output_type -> curate.preservation.v1.AcquireJobResponse
+	4, // 5: curate.preservation.v1.AgentService.RenewLease:output_type -> curate.preservation.v1.RenewLeaseResponse
+	6, // 6: curate.preservation.v1.AgentService.CompleteJob:output_type -> curate.preservation.v1.CompleteJobResponse
+	4, // [4:7] is the sub-list for method output_type
+	1, // [1:4] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_curate_preservation_v1_agents_proto_init() }
+func file_curate_preservation_v1_agents_proto_init() {
+	if File_curate_preservation_v1_agents_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_curate_preservation_v1_agents_proto_rawDesc), len(file_curate_preservation_v1_agents_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_curate_preservation_v1_agents_proto_goTypes,
+		DependencyIndexes: file_curate_preservation_v1_agents_proto_depIdxs,
+		EnumInfos:         file_curate_preservation_v1_agents_proto_enumTypes,
+		MessageInfos:      file_curate_preservation_v1_agents_proto_msgTypes,
+	}.Build()
+	File_curate_preservation_v1_agents_proto = out.File
+	file_curate_preservation_v1_agents_proto_goTypes = nil
+	file_curate_preservation_v1_agents_proto_depIdxs = nil
+}
@@ -0,0 +1,1042 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: curate/preservation/v1/jobs.proto
+
+package preservationv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Priority orders the queued jobs: jobs with a higher priority run first.
+type Priority int32
+
+const (
+	// Normal priority.
+	Priority_PRIORITY_UNSPECIFIED Priority = 0
+	// Background work, e.g. the ingest of a backlog.
+	Priority_PRIORITY_LOW    Priority = 1
+	Priority_PRIORITY_NORMAL Priority = 2
+	Priority_PRIORITY_HIGH   Priority = 3
+	// e.g. the reprocessing of a package needed now.
+	Priority_PRIORITY_URGENT Priority = 4
+)
+
+// Enum value maps for Priority.
+var (
+	Priority_name = map[int32]string{
+		0: "PRIORITY_UNSPECIFIED",
+		1: "PRIORITY_LOW",
+		2: "PRIORITY_NORMAL",
+		3: "PRIORITY_HIGH",
+		4: "PRIORITY_URGENT",
+	}
+	Priority_value = map[string]int32{
+		"PRIORITY_UNSPECIFIED": 0,
+		"PRIORITY_LOW":         1,
+		"PRIORITY_NORMAL":      2,
+		"PRIORITY_HIGH":        3,
+		"PRIORITY_URGENT":      4,
+	}
+)
+
+func (x Priority) Enum() *Priority {
+	p := new(Priority)
+	*p = x
+	return p
+}
+
+func (x Priority) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Priority) Descriptor() protoreflect.EnumDescriptor {
+	return file_curate_preservation_v1_jobs_proto_enumTypes[0].Descriptor()
+}
+
+func (Priority) Type() protoreflect.EnumType {
+	return &file_curate_preservation_v1_jobs_proto_enumTypes[0]
+}
+
+func (x Priority) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Priority.Descriptor instead.
+func (Priority) EnumDescriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{0}
+}
+
+// JobStatus is the status of a job.
+type JobStatus int32
+
+const (
+	JobStatus_JOB_STATUS_UNSPECIFIED JobStatus = 0
+	// Queued, or not started yet.
+	JobStatus_JOB_STATUS_PENDING   JobStatus = 1
+	JobStatus_JOB_STATUS_RUNNING   JobStatus = 2
+	JobStatus_JOB_STATUS_COMPLETED JobStatus = 3
+	JobStatus_JOB_STATUS_FAILED    JobStatus = 4
+	JobStatus_JOB_STATUS_CANCELLED JobStatus = 5
+)
+
+// Enum value maps for JobStatus.
+var (
+	JobStatus_name = map[int32]string{
+		0: "JOB_STATUS_UNSPECIFIED",
+		1: "JOB_STATUS_PENDING",
+		2: "JOB_STATUS_RUNNING",
+		3: "JOB_STATUS_COMPLETED",
+		4: "JOB_STATUS_FAILED",
+		5: "JOB_STATUS_CANCELLED",
+	}
+	JobStatus_value = map[string]int32{
+		"JOB_STATUS_UNSPECIFIED": 0,
+		"JOB_STATUS_PENDING":     1,
+		"JOB_STATUS_RUNNING":     2,
+		"JOB_STATUS_COMPLETED":   3,
+		"JOB_STATUS_FAILED":      4,
+		"JOB_STATUS_CANCELLED":   5,
+	}
+)
+
+func (x JobStatus) Enum() *JobStatus {
+	p := new(JobStatus)
+	*p = x
+	return p
+}
+
+func (x JobStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JobStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_curate_preservation_v1_jobs_proto_enumTypes[1].Descriptor()
+}
+
+func (JobStatus) Type() protoreflect.EnumType {
+	return &file_curate_preservation_v1_jobs_proto_enumTypes[1]
+}
+
+func (x JobStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JobStatus.Descriptor instead.
+func (JobStatus) EnumDescriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{1}
+}
+
+type SubmitJobsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Cells user the packages are preserved as.
+	Username string `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	// Resolved Cells paths, e.g. common-files/preserve/box-12, or paths in the transfer source.
+	Paths []string `protobuf:"bytes,2,rep,name=paths,proto3" json:"paths,omitempty"`
+	// Transfer source the paths are pulled from, Cells if empty.
+	Source string `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"`
+	// Processing profile, the profile of the folder if empty.
+	Profile string `protobuf:"bytes,4,opt,name=profile,proto3" json:"profile,omitempty"`
+	// Paths or patterns removed during appraisal.
+	Deselect []string `protobuf:"bytes,5,rep,name=deselect,proto3" json:"deselect,omitempty"`
+	// Dublin Core and ISAD(G) metadata of the packages, keyed as in metadata.json, e.g. dc.rights.
+	Metadata map[string]string `protobuf:"bytes,6,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Priority Priority          `protobuf:"varint,7,opt,name=priority,proto3,enum=curate.preservation.v1.Priority" json:"priority,omitempty"`
+	// Reference of the submission, e.g. the ID of the run of the caller. Packages are queued once per reference, and
+	// the reference is returned in the callbacks.
+	Reference string `protobuf:"bytes,8,opt,name=reference,proto3" json:"reference,omitempty"`
+	// Receives the result of each package once it is preserved, fails or is cancelled. Must start with one of the
+	// allowed callback URLs.
+	CallbackUrl   string `protobuf:"bytes,9,opt,name=callback_url,json=callbackUrl,proto3" json:"callback_url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitJobsRequest) Reset() {
+	*x = SubmitJobsRequest{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobsRequest) ProtoMessage() {}
+
+func (x *SubmitJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobsRequest.ProtoReflect.Descriptor instead.
+func (*SubmitJobsRequest) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitJobsRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *SubmitJobsRequest) GetPaths() []string {
+	if x != nil {
+		return x.Paths
+	}
+	return nil
+}
+
+func (x *SubmitJobsRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *SubmitJobsRequest) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *SubmitJobsRequest) GetDeselect() []string {
+	if x != nil {
+		return x.Deselect
+	}
+	return nil
+}
+
+func (x *SubmitJobsRequest) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *SubmitJobsRequest) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+func (x *SubmitJobsRequest) GetReference() string {
+	if x != nil {
+		return x.Reference
+	}
+	return ""
+}
+
+func (x *SubmitJobsRequest) GetCallbackUrl() string {
+	if x != nil {
+		return x.CallbackUrl
+	}
+	return ""
+}
+
+type SubmitJobsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*SubmittedJob        `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitJobsResponse) Reset() {
+	*x = SubmitJobsResponse{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitJobsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobsResponse) ProtoMessage() {}
+
+func (x *SubmitJobsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobsResponse.ProtoReflect.Descriptor instead.
+func (*SubmitJobsResponse) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SubmitJobsResponse) GetJobs() []*SubmittedJob {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+// SubmittedJob is a package queued by SubmitJobs.
+type SubmittedJob struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Path  string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	// False if the package was already queued with the same reference.
+	Queued        bool `protobuf:"varint,3,opt,name=queued,proto3" json:"queued,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmittedJob) Reset() {
+	*x = SubmittedJob{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmittedJob) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmittedJob) ProtoMessage() {}
+
+func (x *SubmittedJob) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmittedJob.ProtoReflect.Descriptor instead.
+func (*SubmittedJob) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SubmittedJob) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SubmittedJob) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SubmittedJob) GetQueued() bool {
+	if x != nil {
+		return x.Queued
+	}
+	return false
+}
+
+type GetJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobRequest) Reset() {
+	*x = GetJobRequest{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobRequest) ProtoMessage() {}
+
+func (x *GetJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobRequest.ProtoReflect.Descriptor instead.
+func (*GetJobRequest) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// Job is the status of a job and of the package it preserves, once started.
+type Job struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Id     string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status JobStatus              `protobuf:"varint,2,opt,name=status,proto3,enum=curate.preservation.v1.JobStatus" json:"status,omitempty"`
+	// Package record, once the preservation started.
+	PackageId string `protobuf:"bytes,3,opt,name=package_id,json=packageId,proto3" json:"package_id,omitempty"`
+	CellsPath string `protobuf:"bytes,4,opt,name=cells_path,json=cellsPath,proto3" json:"cells_path,omitempty"`
+	// Lifecycle state of the package, e.g. packaged.
+	State          string                 `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	AipUuid        string                 `protobuf:"bytes,6,opt,name=aip_uuid,json=aipUuid,proto3" json:"aip_uuid,omitempty"`
+	Error          string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	ReviewRequired bool                   `protobuf:"varint,8,opt,name=review_required,json=reviewRequired,proto3" json:"review_required,omitempty"`
+	UpdatedAt      *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetStatus() JobStatus {
+	if x != nil {
+		return x.Status
+	}
+	return JobStatus_JOB_STATUS_UNSPECIFIED
+}
+
+func (x *Job) GetPackageId() string {
+	if x != nil {
+		return x.PackageId
+	}
+	return ""
+}
+
+func (x *Job) GetCellsPath() string {
+	if x != nil {
+		return x.CellsPath
+	}
+	return ""
+}
+
+func (x *Job) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Job) GetAipUuid() string {
+	if x != nil {
+		return x.AipUuid
+	}
+	return ""
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetReviewRequired() bool {
+	if x != nil {
+		return x.ReviewRequired
+	}
+	return false
+}
+
+func (x *Job) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type WatchJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchJobRequest) Reset() {
+	*x = WatchJobRequest{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchJobRequest) ProtoMessage() {}
+
+func (x *WatchJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchJobRequest.ProtoReflect.Descriptor instead.
+func (*WatchJobRequest) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *WatchJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// JobEvent is a change of the status of a job, or the progress of its package.
+type JobEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Status of the job after the event.
+	Job *Job `protobuf:"bytes,1,opt,name=job,proto3" json:"job,omitempty"`
+	// Progress of the package, unset for the changes of status.
+	Progress      *Progress `protobuf:"bytes,2,opt,name=progress,proto3" json:"progress,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobEvent) Reset() {
+	*x = JobEvent{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobEvent) ProtoMessage() {}
+
+func (x *JobEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobEvent.ProtoReflect.Descriptor instead.
+func (*JobEvent) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *JobEvent) GetJob() *Job {
+	if x != nil {
+		return x.Job
+	}
+	return nil
+}
+
+func (x *JobEvent) GetProgress() *Progress {
+	if x != nil {
+		return x.Progress
+	}
+	return nil
+}
+
+// Progress is a progress event of a package, as streamed by the HTTP API.
+type Progress struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Kind of the event: stage, progress, state or finished.
+	Kind string                 `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	Time *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// Event type of the stage, e.g. download.
+	Stage string `protobuf:"bytes,3,opt,name=stage,proto3" json:"stage,omitempty"`
+	// started or completed, for stage events.
+	Status     string `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	Outcome    string `protobuf:"bytes,5,opt,name=outcome,proto3" json:"outcome,omitempty"`
+	Detail     string `protobuf:"bytes,6,opt,name=detail,proto3" json:"detail,omitempty"`
+	DurationMs int64  `protobuf:"varint,7,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	// Current A3M job or file.
+	Current string `protobuf:"bytes,8,opt,name=current,proto3" json:"current,omitempty"`
+	// Current A3M microservice group.
+	Group     string `protobuf:"bytes,9,opt,name=group,proto3" json:"group,omitempty"`
+	Completed int32  `protobuf:"varint,10,opt,name=completed,proto3" json:"completed,omitempty"`
+	Failed    int32  `protobuf:"varint,11,opt,name=failed,proto3" json:"failed,omitempty"`
+	Total     int32  `protobuf:"varint,12,opt,name=total,proto3" json:"total,omitempty"`
+	// Set when the total is known.
+	Percent *int32 `protobuf:"varint,13,opt,name=percent,proto3,oneof" json:"percent,omitempty"`
+	// New lifecycle state, for state events.
+	State         string `protobuf:"bytes,14,opt,name=state,proto3" json:"state,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Progress) Reset() {
+	*x = Progress{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Progress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Progress) ProtoMessage() {}
+
+func (x *Progress) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Progress.ProtoReflect.Descriptor instead.
+func (*Progress) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Progress) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *Progress) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Progress) GetStage() string {
+	if x != nil {
+		return x.Stage
+	}
+	return ""
+}
+
+func (x *Progress) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Progress) GetOutcome() string {
+	if x != nil {
+		return x.Outcome
+	}
+	return ""
+}
+
+func (x *Progress) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+func (x *Progress) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *Progress) GetCurrent() string {
+	if x != nil {
+		return x.Current
+	}
+	return ""
+}
+
+func (x *Progress) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Progress) GetCompleted() int32 {
+	if x != nil {
+		return x.Completed
+	}
+	return 0
+}
+
+func (x *Progress) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *Progress) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Progress) GetPercent() int32 {
+	if x != nil && x.Percent != nil {
+		return *x.Percent
+	}
+	return 0
+}
+
+func (x *Progress) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+type CancelJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelJobRequest) Reset() {
+	*x = CancelJobRequest{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJobRequest) ProtoMessage() {}
+
+func (x *CancelJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJobRequest.ProtoReflect.Descriptor instead.
+func (*CancelJobRequest) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CancelJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CancelJobResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// cancelled once a queued job is removed, or cancelling while a running job stops.
+	Status        string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelJobResponse) Reset() {
+	*x = CancelJobResponse{}
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJobResponse) ProtoMessage() {}
+
+func (x *CancelJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_curate_preservation_v1_jobs_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJobResponse.ProtoReflect.Descriptor instead.
+func (*CancelJobResponse) Descriptor() ([]byte, []int) {
+	return file_curate_preservation_v1_jobs_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CancelJobResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CancelJobResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+var File_curate_preservation_v1_jobs_proto protoreflect.FileDescriptor
+
+const file_curate_preservation_v1_jobs_proto_rawDesc = "" +
+	"\n" +
+	"!curate/preservation/v1/jobs.proto\x12\x16curate.preservation.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa4\x03\n" +
+	"\x11SubmitJobsRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x14\n" +
+	"\x05paths\x18\x02 \x03(\tR\x05paths\x12\x16\n" +
+	"\x06source\x18\x03 \x01(\tR\x06source\x12\x18\n" +
+	"\aprofile\x18\x04 \x01(\tR\aprofile\x12\x1a\n" +
+	"\bdeselect\x18\x05 \x03(\tR\bdeselect\x12S\n" +
+	"\bmetadata\x18\x06 \x03(\v27.curate.preservation.v1.SubmitJobsRequest.MetadataEntryR\bmetadata\x12<\n" +
+	"\bpriority\x18\a \x01(\x0e2 .curate.preservation.v1.PriorityR\bpriority\x12\x1c\n" +
+	"\treference\x18\b \x01(\tR\treference\x12!\n" +
+	"\fcallback_url\x18\t \x01(\tR\vcallbackUrl\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"N\n" +
+	"\x12SubmitJobsResponse\x128\n" +
+	"\x04jobs\x18\x01 \x03(\v2$.curate.preservation.v1.SubmittedJobR\x04jobs\"J\n" +
+	"\fSubmittedJob\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x16\n" +
+	"\x06queued\x18\x03 \x01(\bR\x06queued\"\x1f\n" +
+	"\rGetJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xb9\x02\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x129\n" +
+	"\x06status\x18\x02 \x01(\x0e2!.curate.preservation.v1.JobStatusR\x06status\x12\x1d\n" +
+	"\n" +
+	"package_id\x18\x03 \x01(\tR\tpackageId\x12\x1d\n" +
+	"\n" +
+	"cells_path\x18\x04 \x01(\tR\tcellsPath\x12\x14\n" +
+	"\x05state\x18\x05 \x01(\tR\x05state\x12\x19\n" +
+	"\baip_uuid\x18\x06 \x01(\tR\aaipUuid\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\x12'\n" +
+	"\x0freview_required\x18\b \x01(\bR\x0ereviewRequired\x129\n" +
+	"\n" +
+	"updated_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"!\n" +
+	"\x0fWatchJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"w\n" +
+	"\bJobEvent\x12-\n" +
+	"\x03job\x18\x01 \x01(\v2\x1b.curate.preservation.v1.JobR\x03job\x12<\n" +
+	"\bprogress\x18\x02 \x01(\v2 .curate.preservation.v1.ProgressR\bprogress\"\x8c\x03\n" +
+	"\bProgress\x12\x12\n" +
+	"\x04kind\x18\x01 \x01(\tR\x04kind\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x14\n" +
+	"\x05stage\x18\x03 \x01(\tR\x05stage\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x12\x18\n" +
+	"\aoutcome\x18\x05 \x01(\tR\aoutcome\x12\x16\n" +
+	"\x06detail\x18\x06 \x01(\tR\x06detail\x12\x1f\n" +
+	"\vduration_ms\x18\a \x01(\x03R\n" +
+	"durationMs\x12\x18\n" +
+	"\acurrent\x18\b \x01(\tR\acurrent\x12\x14\n" +
+	"\x05group\x18\t \x01(\tR\x05group\x12\x1c\n" +
+	"\tcompleted\x18\n" +
+	" \x01(\x05R\tcompleted\x12\x16\n" +
+	"\x06failed\x18\v \x01(\x05R\x06failed\x12\x14\n" +
+	"\x05total\x18\f \x01(\x05R\x05total\x12\x1d\n" +
+	"\apercent\x18\r \x01(\x05H\x00R\apercent\x88\x01\x01\x12\x14\n" +
+	"\x05state\x18\x0e \x01(\tR\x05stateB\n" +
+	"\n" +
+	"\b_percent\"\"\n" +
+	"\x10CancelJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\";\n" +
+	"\x11CancelJobResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status*s\n" +
+	"\bPriority\x12\x18\n" +
+	"\x14PRIORITY_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fPRIORITY_LOW\x10\x01\x12\x13\n" +
+	"\x0fPRIORITY_NORMAL\x10\x02\x12\x11\n" +
+	"\rPRIORITY_HIGH\x10\x03\x12\x13\n" +
+	"\x0fPRIORITY_URGENT\x10\x04*\xa2\x01\n" +
+	"\tJobStatus\x12\x1a\n" +
+	"\x16JOB_STATUS_UNSPECIFIED\x10\x00\x12\x16\n" +
+	"\x12JOB_STATUS_PENDING\x10\x01\x12\x16\n" +
+	"\x12JOB_STATUS_RUNNING\x10\x02\x12\x18\n" +
+	"\x14JOB_STATUS_COMPLETED\x10\x03\x12\x15\n" +
+	"\x11JOB_STATUS_FAILED\x10\x04\x12\x18\n" +
+	"\x14JOB_STATUS_CANCELLED\x10\x052\xfa\x02\n" +
+	"\n" +
+	"JobService\x12c\n" +
+	"\n" +
+	"SubmitJobs\x12).curate.preservation.v1.SubmitJobsRequest\x1a*.curate.preservation.v1.SubmitJobsResponse\x12L\n" +
+	"\x06GetJob\x12%.curate.preservation.v1.GetJobRequest\x1a\x1b.curate.preservation.v1.Job\x12W\n" +
+	"\bWatchJob\x12'.curate.preservation.v1.WatchJobRequest\x1a .curate.preservation.v1.JobEvent0\x01\x12`\n" +
+	"\tCancelJob\x12(.curate.preservation.v1.CancelJobRequest\x1a).curate.preservation.v1.CancelJobResponseBnZlgithub.com/penwern/curate-preservation-core/common/proto/curate/gen/go/curate/preservation/v1;preservationv1b\x06proto3"
+
+var (
+	file_curate_preservation_v1_jobs_proto_rawDescOnce sync.Once
+	file_curate_preservation_v1_jobs_proto_rawDescData []byte
+)
+
+func file_curate_preservation_v1_jobs_proto_rawDescGZIP() []byte {
+	file_curate_preservation_v1_jobs_proto_rawDescOnce.Do(func() {
+		file_curate_preservation_v1_jobs_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_curate_preservation_v1_jobs_proto_rawDesc), len(file_curate_preservation_v1_jobs_proto_rawDesc)))
+	})
+	return file_curate_preservation_v1_jobs_proto_rawDescData
+}
+
+var file_curate_preservation_v1_jobs_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_curate_preservation_v1_jobs_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_curate_preservation_v1_jobs_proto_goTypes = []any{
+	(Priority)(0),                 // 0: curate.preservation.v1.Priority
+	(JobStatus)(0),                // 1: curate.preservation.v1.JobStatus
+	(*SubmitJobsRequest)(nil),     // 2: curate.preservation.v1.SubmitJobsRequest
+	(*SubmitJobsResponse)(nil),    // 3: curate.preservation.v1.SubmitJobsResponse
+	(*SubmittedJob)(nil),          // 4: curate.preservation.v1.SubmittedJob
+	(*GetJobRequest)(nil),         // 5: curate.preservation.v1.GetJobRequest
+	(*Job)(nil),                   // 6: curate.preservation.v1.Job
+	(*WatchJobRequest)(nil),       // 7: curate.preservation.v1.WatchJobRequest
+	(*JobEvent)(nil),              // 8: curate.preservation.v1.JobEvent
+	(*Progress)(nil),              // 9: curate.preservation.v1.Progress
+	(*CancelJobRequest)(nil),      // 10: curate.preservation.v1.CancelJobRequest
+	(*CancelJobResponse)(nil),     // 11: curate.preservation.v1.CancelJobResponse
+	nil,                           // 12: curate.preservation.v1.SubmitJobsRequest.MetadataEntry
+	(*timestamppb.Timestamp)(nil), // 13: google.protobuf.Timestamp
+}
+var file_curate_preservation_v1_jobs_proto_depIdxs = []int32{
+	12, // 0: curate.preservation.v1.SubmitJobsRequest.metadata:type_name -> curate.preservation.v1.SubmitJobsRequest.MetadataEntry
+	0,  // 1: curate.preservation.v1.SubmitJobsRequest.priority:type_name -> curate.preservation.v1.Priority
+	4,  // 2: curate.preservation.v1.SubmitJobsResponse.jobs:type_name -> curate.preservation.v1.SubmittedJob
+	1,  // 3: curate.preservation.v1.Job.status:type_name -> curate.preservation.v1.JobStatus
+	13, // 4: curate.preservation.v1.Job.updated_at:type_name -> google.protobuf.Timestamp
+	6,  // 5: curate.preservation.v1.JobEvent.job:type_name -> curate.preservation.v1.Job
+	9,  // 6: curate.preservation.v1.JobEvent.progress:type_name -> curate.preservation.v1.Progress
+	13, // 7: curate.preservation.v1.Progress.time:type_name -> google.protobuf.Timestamp
+	2,  // 8: curate.preservation.v1.JobService.SubmitJobs:input_type -> curate.preservation.v1.SubmitJobsRequest
+	5,  // 9: curate.preservation.v1.JobService.GetJob:input_type -> curate.preservation.v1.GetJobRequest
+	7,  // 10: curate.preservation.v1.JobService.WatchJob:input_type -> curate.preservation.v1.WatchJobRequest
+	10, // 11: curate.preservation.v1.JobService.CancelJob:input_type -> curate.preservation.v1.CancelJobRequest
+	3,  // 12: curate.preservation.v1.JobService.SubmitJobs:output_type -> curate.preservation.v1.SubmitJobsResponse
+	6,  // 13: curate.preservation.v1.JobService.GetJob:output_type -> curate.preservation.v1.Job
+	8,  // 14: curate.preservation.v1.JobService.WatchJob:output_type -> curate.preservation.v1.JobEvent
+	11, // 15: curate.preservation.v1.JobService.CancelJob:output_type -> curate.preservation.v1.CancelJobResponse
+	12, // [12:16] is the sub-list for method output_type
+	8,  // [8:12] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_curate_preservation_v1_jobs_proto_init() }
+func file_curate_preservation_v1_jobs_proto_init() {
+	if File_curate_preservation_v1_jobs_proto != nil {
+		return
+	}
+	file_curate_preservation_v1_jobs_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_curate_preservation_v1_jobs_proto_rawDesc), len(file_curate_preservation_v1_jobs_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_curate_preservation_v1_jobs_proto_goTypes,
+		DependencyIndexes: file_curate_preservation_v1_jobs_proto_depIdxs,
+		EnumInfos:         file_curate_preservation_v1_jobs_proto_enumTypes,
+		MessageInfos:      file_curate_preservation_v1_jobs_proto_msgTypes,
+	}.Build()
+	File_curate_preservation_v1_jobs_proto = out.File
+	file_curate_preservation_v1_jobs_proto_goTypes = nil
+	file_curate_preservation_v1_jobs_proto_depIdxs = nil
+}
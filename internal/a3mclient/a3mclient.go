@@ -11,6 +11,7 @@ import (
 	transferservice "github.com/penwern/curate-preservation-core/common/proto/a3m/gen/go/a3m/api/transferservice/v1beta1"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
@@ -36,7 +37,9 @@ type ClientOptions struct {
 type ClientInterface interface {
 	Close()
 	SubmitPackage(ctx context.Context, path, name string, config *transferservice.ProcessingConfig) (string, *transferservice.ReadResponse, error)
+	SubmitPackageWithProgress(ctx context.Context, path, name string, config *transferservice.ProcessingConfig, onProgress ProgressFunc) (string, *transferservice.ReadResponse, error)
 	GetActiveProcessingCount() int
+	Ping(ctx context.Context) error
 }
 
 // NewClient creates a new client instance with default options.
@@ -91,10 +94,36 @@ func (c *Client) GetActiveProcessingCount() int {
 	return count
 }
 
+// Ping checks that the a3m server can be reached, connecting if the connection is idle.
+// Returns an error if the connection is not ready when the context is done.
+func (c *Client) Ping(ctx context.Context) error {
+	c.conn.Connect()
+	for {
+		state := c.conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return fmt.Errorf("connection to a3m server at %q is closed", c.address)
+		}
+		if !c.conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("a3m server at %q not reachable (%s): %w", c.address, strings.ToLower(state.String()), ctx.Err())
+		}
+	}
+}
+
 // SubmitPackage submits a package (given by its URI) with a name and configuration.
 // It polls the server until processing is complete (or fails) and returns the AIP UUID and final response.
+// The final response is also returned when the package failed or was rejected, so the jobs can be inspected.
 // This implementation will block if there are already maxActiveProcessing packages being processed.
 func (c *Client) SubmitPackage(ctx context.Context, path, name string, config *transferservice.ProcessingConfig) (string, *transferservice.ReadResponse, error) {
+	return c.SubmitPackageWithProgress(ctx, path, name, config, nil)
+}
+
+// SubmitPackageWithProgress submits a package like SubmitPackage and streams its progress to onProgress.
+// The a3m transfer service has no streaming RPC, so updates are derived from the status reads and only
+// sent when the status, the current job or the job counts change. Microservice transitions are logged.
+func (c *Client) SubmitPackageWithProgress(ctx context.Context, path, name string, config *transferservice.ProcessingConfig, onProgress ProgressFunc) (string, *transferservice.ReadResponse, error) {
 	// Acquire processing token (will block if too many packages are processing)
 	select {
 	case c.processingTokens <- struct{}{}:
@@ -130,6 +159,7 @@ func (c *Client) SubmitPackage(ctx context.Context, path, name string, config *t
 	defer c.activeRequests.Delete(submitResp.Id)
 
 	// Poll for completion
+	var lastProgress *Progress
 	for {
 		logger.Debug("Polling package %q (ID: %q)", name, submitResp.Id)
 		select {
@@ -145,6 +175,18 @@ func (c *Client) SubmitPackage(ctx context.Context, path, name string, config *t
 			return "", nil, fmt.Errorf("error reading status for package %q (ID: %q): %w", name, submitResp.Id, err)
 		}
 
+		progress := NewProgress(submitResp.Id, readResp)
+		if progress.changed(lastProgress) {
+			if progress.CurrentGroup != "" && (lastProgress == nil || progress.CurrentGroup != lastProgress.CurrentGroup) {
+				logger.Info("Package %q (ID: %q): %s (%d/%d jobs)", name, submitResp.Id, progress.CurrentGroup, progress.JobsCompleted, progress.JobsTotal)
+			}
+			logger.Debug("Package %q (ID: %q): job %q", name, submitResp.Id, progress.CurrentJob)
+			if onProgress != nil {
+				onProgress(progress)
+			}
+			lastProgress = &progress
+		}
+
 		status := readResp.Status
 		switch status {
 		case transferservice.PackageStatus_PACKAGE_STATUS_UNSPECIFIED:
@@ -161,12 +203,12 @@ func (c *Client) SubmitPackage(ctx context.Context, path, name string, config *t
 		case transferservice.PackageStatus_PACKAGE_STATUS_FAILED:
 			logger.Debug("Package %q (ID: %q) failed", name, submitResp.Id)
 			failedJobs := c.collectFailedJobs(ctx, readResp.Jobs)
-			return "", nil, fmt.Errorf("error processing package (status: %s). Failed jobs: %v",
+			return "", readResp, fmt.Errorf("error processing package (status: %s). Failed jobs: %v",
 				transferservice.PackageStatus_name[int32(status)], failedJobs)
 		case transferservice.PackageStatus_PACKAGE_STATUS_REJECTED:
 			logger.Debug("Package %q (ID: %q) rejected", name, submitResp.Id)
 			failedJobs := c.collectFailedJobs(ctx, readResp.Jobs)
-			return "", nil, fmt.Errorf("error processing package (status: %s). Failed jobs: %v",
+			return "", readResp, fmt.Errorf("error processing package (status: %s). Failed jobs: %v",
 				transferservice.PackageStatus_name[int32(status)], failedJobs)
 		default:
 			return "", nil, fmt.Errorf("unknown status %q for package %q (ID: %q)", status, name, submitResp.Id)
@@ -0,0 +1,102 @@
+package a3mclient
+
+import (
+	transferservice "github.com/penwern/curate-preservation-core/common/proto/a3m/gen/go/a3m/api/transferservice/v1beta1"
+)
+
+// Progress is a snapshot of the processing status of a package, grouped by microservice.
+type Progress struct {
+	PackageID     string                 `json:"package_id"`
+	Status        string                 `json:"status"`
+	CurrentGroup  string                 `json:"current_group,omitempty"`
+	CurrentJob    string                 `json:"current_job,omitempty"`
+	JobsCompleted int                    `json:"jobs_completed"`
+	JobsFailed    int                    `json:"jobs_failed"`
+	JobsTotal     int                    `json:"jobs_total"`
+	Microservices []MicroserviceProgress `json:"microservices"`
+}
+
+// MicroserviceProgress is the status of the jobs of a single microservice group.
+type MicroserviceProgress struct {
+	Group     string `json:"group"`
+	Status    string `json:"status"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	Total     int    `json:"total"`
+}
+
+// ProgressFunc receives progress updates while a package is processed.
+type ProgressFunc func(Progress)
+
+// Microservice statuses.
+const (
+	MicroserviceProcessing = "processing"
+	MicroserviceComplete   = "complete"
+	MicroserviceFailed     = "failed"
+)
+
+// NewProgress builds a progress snapshot from an a3m status response.
+// Microservices are listed in the order their first job ran.
+func NewProgress(packageID string, resp *transferservice.ReadResponse) Progress {
+	progress := Progress{
+		PackageID: packageID,
+		Status:    packageStatusName(resp.GetStatus()),
+	}
+	index := make(map[string]int)
+	for _, job := range resp.GetJobs() {
+		i, ok := index[job.Group]
+		if !ok {
+			i = len(progress.Microservices)
+			index[job.Group] = i
+			progress.Microservices = append(progress.Microservices, MicroserviceProgress{Group: job.Group})
+		}
+		ms := &progress.Microservices[i]
+		ms.Total++
+		progress.JobsTotal++
+		switch job.Status {
+		case transferservice.Job_STATUS_COMPLETE:
+			ms.Completed++
+			progress.JobsCompleted++
+		case transferservice.Job_STATUS_FAILED:
+			ms.Failed++
+			progress.JobsFailed++
+		default:
+			progress.CurrentGroup = job.Group
+			progress.CurrentJob = job.Name
+		}
+	}
+	// a3m only lists jobs once they have started, the most recent job is the current one
+	if progress.CurrentGroup == "" && progress.Status == packageStatusName(transferservice.PackageStatus_PACKAGE_STATUS_PROCESSING) {
+		if jobs := resp.GetJobs(); len(jobs) > 0 {
+			progress.CurrentGroup = jobs[len(jobs)-1].Group
+			progress.CurrentJob = jobs[len(jobs)-1].Name
+		}
+	}
+	for i := range progress.Microservices {
+		ms := &progress.Microservices[i]
+		switch {
+		case ms.Failed > 0:
+			ms.Status = MicroserviceFailed
+		case ms.Completed == ms.Total && ms.Group != progress.CurrentGroup:
+			ms.Status = MicroserviceComplete
+		default:
+			ms.Status = MicroserviceProcessing
+		}
+	}
+	return progress
+}
+
+// changed reports whether the progress differs from a previous snapshot.
+func (p Progress) changed(prev *Progress) bool {
+	return prev == nil ||
+		p.Status != prev.Status ||
+		p.CurrentJob != prev.CurrentJob ||
+		p.CurrentGroup != prev.CurrentGroup ||
+		p.JobsTotal != prev.JobsTotal ||
+		p.JobsCompleted != prev.JobsCompleted ||
+		p.JobsFailed != prev.JobsFailed
+}
+
+func packageStatusName(status transferservice.PackageStatus) string {
+	return transferservice.PackageStatus_name[int32(status)]
+}
@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	preservationv1 "github.com/penwern/curate-preservation-core/common/proto/curate/gen/go/curate/preservation/v1"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	// agentRetryDelay is the wait of an agent before it asks the coordinator again, after a failed call.
+	agentRetryDelay = 5 * time.Second
+	// agentCompleteTimeout is the time an agent has to report the result of a job.
+	agentCompleteTimeout = 30 * time.Second
+)
+
+// agent runs the jobs of a coordinator as a remote worker agent.
+type agent struct {
+	svc         *Service
+	client      preservationv1.AgentServiceClient
+	name        string
+	coordinator string
+}
+
+// RunAgent runs the queued jobs of the coordinator as a remote worker agent, near the data of the jobs, until the
+// context is cancelled. Up to the configured number of jobs run at once, each pulled from the coordinator and
+// reported to it with its package record. Running jobs are not stopped with the agent, they are drained by
+// Shutdown; interrupted jobs are queued again on the coordinator. Returns an error if the agent cannot start.
+func (s *Service) RunAgent(ctx context.Context) error {
+	cfg := s.cfg.Agent
+	if cfg.Coordinator == "" {
+		return errors.New("the address of the coordinator is required (CA4M_AGENT_COORDINATOR)")
+	}
+	name := cfg.Name
+	if name == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("error reading the host name, set the name of the agent: %w", err)
+		}
+		name = host
+	}
+	conn, err := dialCoordinator(s.cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		_ = conn.Close()
+		return ErrShuttingDown
+	}
+	// Shutdown waits for the running jobs to report their result
+	s.consumers.Add(1)
+	s.mu.Unlock()
+	a := &agent{svc: s, client: preservationv1.NewAgentServiceClient(conn), name: name, coordinator: cfg.Coordinator}
+	logger.Info("Agent %s running up to %d jobs of %s", name, cfg.Jobs, cfg.Coordinator)
+	var workers sync.WaitGroup
+	for range cfg.Jobs {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			a.work(ctx)
+		}()
+	}
+	go func() {
+		defer s.consumers.Done()
+		workers.Wait()
+		_ = conn.Close()
+	}()
+	<-ctx.Done()
+	return nil
+}
+
+// dialCoordinator returns the connection of an agent to the gRPC API of its coordinator, authenticated with the token
+// of the agent.
+func dialCoordinator(cfg *config.Config) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if cfg.Agent.TLS {
+		// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: cfg.AllowInsecureTLS}
+		if cfg.Agent.CAFile != "" {
+			pem, err := os.ReadFile(filepath.Clean(cfg.Agent.CAFile))
+			if err != nil {
+				return nil, fmt.Errorf("error reading the CA file of the coordinator: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate found in CA file %s", cfg.Agent.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if cfg.Agent.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(agentToken{token: cfg.Agent.Token, secure: cfg.Agent.TLS}))
+	}
+	conn, err := grpc.NewClient(cfg.Agent.Coordinator, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the coordinator %s: %w", cfg.Agent.Coordinator, err)
+	}
+	return conn, nil
+}
+
+// agentToken sends the token of an agent as bearer token in the authorization metadata of its calls.
+type agentToken struct {
+	token  string
+	secure bool
+}
+
+func (t agentToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t agentToken) RequireTransportSecurity() bool {
+	return t.secure
+}
+
+// work pulls jobs from the coordinator and runs them, one at a time, until the context is cancelled.
+func (a *agent) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		resp, err := a.client.AcquireJob(ctx, &preservationv1.AcquireJobRequest{Agent: a.name})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("Error acquiring a job from %s: %v", a.coordinator, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(agentRetryDelay):
+			}
+			continue
+		}
+		if resp.GetLease() == "" {
+			continue
+		}
+		a.run(resp)
+	}
+}
+
+// run runs a leased job, renewing its lease while it runs, then reports its result. The job stops when it is
+// cancelled on the coordinator, or when its lease is lost.
+func (a *agent) run(resp *preservationv1.AcquireJobResponse) {
+	lease := resp.GetLease()
+	var job queue.Job
+	if err := json.Unmarshal(resp.GetJob(), &job); err != nil {
+		logger.Error("Invalid job of lease %s: %v", lease, err)
+		a.complete(lease, &job, preservationv1.JobResult_JOB_RESULT_FAILED, fmt.Errorf("invalid job: %w", err), time.Now())
+		return
+	}
+	logger.Info("Running job %s of %s", job.ID, a.coordinator)
+	trackedCtx, done, err := a.svc.track(preservation.WithJob(preservation.WithTenant(context.Background(), job.Tenant), job.ID, job.QueuedAt))
+	if err != nil {
+		a.complete(lease, &job, preservationv1.JobResult_JOB_RESULT_INTERRUPTED, nil, time.Now())
+		return
+	}
+	defer done()
+	jobCtx, cancel := context.WithCancelCause(trackedCtx)
+	defer cancel(nil)
+	started := time.Now()
+	a.svc.running.Store(job.ID, &runningJob{job: &job, started: started.UTC(), cancel: cancel})
+	defer a.svc.running.Delete(job.ID)
+
+	var lost bool
+	renewed := make(chan struct{})
+	stopRenewal := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		lost = a.renew(lease, &job, started, time.Duration(resp.GetLeaseTimeoutMs())*time.Millisecond, stopRenewal, cancel)
+	}()
+	err = a.svc.preserveJob(jobCtx, &job)
+	close(stopRenewal)
+	<-renewed
+	if lost {
+		logger.Warn("Lease of job %s lost, the job was stopped and is run again by the coordinator", job.ID)
+		return
+	}
+
+	result := preservationv1.JobResult_JOB_RESULT_COMPLETED
+	switch cause := context.Cause(jobCtx); {
+	case errors.Is(cause, preservation.ErrCancelled) || errors.Is(err, preservation.ErrCancelled):
+		result = preservationv1.JobResult_JOB_RESULT_CANCELLED
+	case errors.Is(cause, preservation.ErrInterrupted):
+		result = preservationv1.JobResult_JOB_RESULT_INTERRUPTED
+	case err != nil:
+		result = preservationv1.JobResult_JOB_RESULT_FAILED
+	}
+	a.complete(lease, &job, result, err, started)
+}
+
+// renew renews the lease of a running job until it stops, reporting its package record. The job is cancelled when
+// it is cancelled on the coordinator, and interrupted when its lease is lost. Returns whether the lease was lost.
+func (a *agent) renew(lease string, job *queue.Job, started time.Time, timeout time.Duration, stop <-chan struct{}, cancel context.CancelCauseFunc) bool {
+	ticker := time.NewTicker(max(timeout/3, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+		}
+		ctx, cancelCall := context.WithTimeout(context.Background(), timeout/3)
+		resp, err := a.client.RenewLease(ctx, &preservationv1.RenewLeaseRequest{Lease: lease, Record: a.record(job, started)})
+		cancelCall()
+		switch {
+		case status.Code(err) == codes.NotFound:
+			cancel(preservation.ErrInterrupted)
+			return true
+		case err != nil:
+			// The lease expires if the coordinator cannot be reached until then
+			logger.Warn("Error renewing the lease of job %s: %v", job.ID, err)
+		case resp.GetCancelled():
+			cancel(preservation.ErrCancelled)
+		}
+	}
+}
+
+// complete reports the result of a job to the coordinator, with its package record.
+func (a *agent) complete(lease string, job *queue.Job, result preservationv1.JobResult, err error, started time.Time) {
+	req := &preservationv1.CompleteJobRequest{Lease: lease, Result: result, Record: a.record(job, started)}
+	if err != nil && result == preservationv1.JobResult_JOB_RESULT_FAILED {
+		req.Error = err.Error()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), agentCompleteTimeout)
+	defer cancel()
+	if _, err := a.client.CompleteJob(ctx, req); err != nil {
+		logger.Error("Error reporting the result of job %s to %s, it is run again once its lease expires: %v", job.ID, a.coordinator, err)
+		return
+	}
+	logger.Info("Reported job %s to %s: %s", job.ID, a.coordinator, strings.ToLower(strings.TrimPrefix(result.String(), "JOB_RESULT_")))
+}
+
+// record returns the package record of a job encoded in JSON, or nil if it has none.
+func (a *agent) record(job *queue.Job, started time.Time) []byte {
+	rec := a.svc.jobRecord(job, started)
+	if rec == nil {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		logger.Warn("Error encoding the package record of job %s: %v", job.ID, err)
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,323 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	preservationv1 "github.com/penwern/curate-preservation-core/common/proto/curate/gen/go/curate/preservation/v1"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// agentAcquireWait is the time AcquireJob waits for a queued job before the agent asks again.
+const agentAcquireWait = 30 * time.Second
+
+// errLeaseNotFound is returned when the lease of an agent expired, or its job was queued again.
+var errLeaseNotFound = errors.New("lease not found")
+
+// agentLease is a job handed to a remote worker agent. The job runs on the coordinator like a job run locally,
+// waiting for the result reported by the agent.
+type agentLease struct {
+	id     string
+	agent  string
+	job    *queue.Job
+	result chan error // Receives the result reported by the agent
+
+	mu        sync.Mutex
+	renewedAt time.Time
+	cancelled bool // The agent is told to stop the job
+}
+
+// agentDispatcher hands the queued jobs of the coordinator to the remote worker agents and tracks their leases.
+type agentDispatcher struct {
+	timeout  time.Duration
+	stopping chan struct{} // Closed when the service shuts down, ends the waits of the agents
+
+	mu     sync.Mutex
+	leases map[string]*agentLease
+	closed bool
+}
+
+func newAgentDispatcher(timeout time.Duration) *agentDispatcher {
+	return &agentDispatcher{timeout: timeout, stopping: make(chan struct{}), leases: make(map[string]*agentLease)}
+}
+
+// stop ends the waits of the agents, once the service shuts down.
+func (d *agentDispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.closed = true
+		close(d.stopping)
+	}
+}
+
+// lease leases a job to an agent.
+func (d *agentDispatcher) lease(job *queue.Job, agent string) *agentLease {
+	lease := &agentLease{id: utils.NewUUID(), agent: agent, job: job, result: make(chan error, 1), renewedAt: time.Now()}
+	d.mu.Lock()
+	d.leases[lease.id] = lease
+	d.mu.Unlock()
+	return lease
+}
+
+// get returns a lease, or nil if it ended.
+func (d *agentDispatcher) get(id string) *agentLease {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.leases[id]
+}
+
+// take ends a lease and returns it, or nil if it already ended.
+func (d *agentDispatcher) take(id string) *agentLease {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lease := d.leases[id]
+	delete(d.leases, id)
+	return lease
+}
+
+// release ends a lease, the agent can no longer renew or complete it.
+func (d *agentDispatcher) release(lease *agentLease) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.leases, lease.id)
+}
+
+// await waits for the result of a job run by an agent. A cancelled job is stopped by the agent, which then reports it
+// as cancelled. A job whose lease expires is queued again, unless it was cancelled. The lease ends with the
+// interruption of the job by a shutdown, and the agent stops running it.
+func (d *agentDispatcher) await(ctx context.Context, lease *agentLease) error {
+	defer d.release(lease)
+	ticker := time.NewTicker(d.timeout / 4)
+	defer ticker.Stop()
+	done := ctx.Done()
+	for {
+		select {
+		case err := <-lease.result:
+			return err
+		case <-done:
+			cause := context.Cause(ctx)
+			if !errors.Is(cause, preservation.ErrCancelled) {
+				return cause
+			}
+			lease.mu.Lock()
+			lease.cancelled = true
+			lease.mu.Unlock()
+			logger.Info("Asking agent %s to cancel job %s", lease.agent, lease.job.ID)
+			done = nil
+		case <-ticker.C:
+			lease.mu.Lock()
+			expired, cancelled := time.Since(lease.renewedAt) > d.timeout, lease.cancelled
+			lease.mu.Unlock()
+			if !expired {
+				continue
+			}
+			if cancelled {
+				return preservation.ErrCancelled
+			}
+			logger.Warn("Lease of job %s expired, agent %s stopped renewing it", lease.job.ID, lease.agent)
+			return fmt.Errorf("%w: lease of agent %s expired", queue.ErrInterrupted, lease.agent)
+		}
+	}
+}
+
+// AcquireJob waits for a queued job and leases it to a remote worker agent, which runs it in place of this instance.
+// Returns nil if no job was queued within agentAcquireWait, or if the job workers are drained. Returns
+// ErrShuttingDown once the service shuts down.
+func (s *Service) AcquireJob(ctx context.Context, agent string) (*agentLease, error) {
+	d := s.agents
+	if d == nil || s.queue == nil {
+		return nil, errors.New("remote worker agents are not enabled")
+	}
+	wait := time.NewTimer(agentAcquireWait)
+	defer wait.Stop()
+	// Drained workers hold the queued jobs until they resume, the agent then asks again
+	drain, resume := s.workers()
+	if resume != nil {
+		select {
+		case <-resume:
+		case <-wait.C:
+		case <-d.stopping:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return nil, ErrShuttingDown
+	}
+	// The consumption releases the job if the agent left meanwhile, or if it is interrupted
+	s.consumers.Add(1)
+	s.mu.Unlock()
+	offered := make(chan *agentLease)
+	gone := make(chan struct{})
+	defer close(gone)
+	consumeCtx, stop := context.WithCancel(context.Background())
+	go func() {
+		defer s.consumers.Done()
+		defer stop()
+		// A single job is consumed for the agent
+		err := s.queue.Consume(consumeCtx, func(jobCtx context.Context, job *queue.Job) error {
+			if err := s.holdJob(job); err != nil {
+				return err
+			}
+			stop()
+			lease := d.lease(job, agent)
+			select {
+			case offered <- lease:
+			case <-gone:
+				d.release(lease)
+				return fmt.Errorf("%w: agent %s left", queue.ErrInterrupted, agent)
+			}
+			defer d.release(lease)
+			logger.Info("Job %s leased to agent %s", job.ID, agent)
+			return s.runJob(context.WithValue(jobCtx, agentLeaseKey{}, lease), job)
+		})
+		if err != nil {
+			logger.Error("Error consuming job queue for agent %s: %v", agent, err)
+		}
+	}()
+
+	select {
+	case lease := <-offered:
+		return lease, nil
+	case <-wait.C:
+	case <-drain:
+	case <-d.stopping:
+	case <-ctx.Done():
+	}
+	stop()
+	return nil, ctx.Err()
+}
+
+// agentLeaseKey is the context key of the lease of a job run by an agent.
+type agentLeaseKey struct{}
+
+// RenewLease extends the lease of a job run by an agent and saves the package record it reported. Returns whether the
+// job is cancelled, or errLeaseNotFound if the lease ended.
+func (s *Service) RenewLease(id string, record []byte) (bool, error) {
+	lease := s.agents.get(id)
+	if lease == nil {
+		return false, errLeaseNotFound
+	}
+	lease.mu.Lock()
+	lease.renewedAt = time.Now()
+	cancelled := lease.cancelled
+	lease.mu.Unlock()
+	s.saveAgentRecord(lease, record)
+	return cancelled, nil
+}
+
+// CompleteLease ends the lease of a job run by an agent with its result, and saves the package record it reported.
+// Returns errLeaseNotFound if the lease ended.
+func (s *Service) CompleteLease(id string, result error, record []byte) error {
+	lease := s.agents.take(id)
+	if lease == nil {
+		return errLeaseNotFound
+	}
+	// The record is saved before the result, for the callback of the job
+	s.saveAgentRecord(lease, record)
+	lease.result <- result
+	return nil
+}
+
+// saveAgentRecord saves the package record of a job run by an agent, so that the job is reported on the
+// coordinator. Records of other jobs are ignored.
+func (s *Service) saveAgentRecord(lease *agentLease, data []byte) {
+	store := s.Catalog()
+	if store == nil || len(data) == 0 {
+		return
+	}
+	var rec catalog.Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		logger.Warn("Invalid package record of job %s from agent %s: %v", lease.job.ID, lease.agent, err)
+		return
+	}
+	if rec.ID == "" || rec.JobID != lease.job.ID {
+		logger.Warn("Ignoring package record %s of agent %s, it is not a record of job %s", rec.ID, lease.agent, lease.job.ID)
+		return
+	}
+	if err := store.Save(&rec); err != nil {
+		logger.Error("Error saving package record %s of agent %s: %v", rec.ID, lease.agent, err)
+	}
+}
+
+// agentServer is the AgentService of the gRPC API, serving the queued jobs to the remote worker agents.
+type agentServer struct {
+	preservationv1.UnimplementedAgentServiceServer
+	svc *Service
+}
+
+// AcquireJob leases a queued job to the agent. The response has no lease if no job was queued meanwhile.
+func (a *agentServer) AcquireJob(ctx context.Context, req *preservationv1.AcquireJobRequest) (*preservationv1.AcquireJobResponse, error) {
+	if req.GetAgent() == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent is required")
+	}
+	lease, err := a.svc.AcquireJob(ctx, req.GetAgent())
+	switch {
+	case errors.Is(err, ErrShuttingDown):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil && ctx.Err() != nil:
+		return nil, status.FromContextError(err).Err()
+	case err != nil:
+		logger.Error("Failed to acquire a job for agent %s: %v", req.GetAgent(), err)
+		return nil, status.Error(codes.Internal, "failed to acquire a job")
+	}
+	resp := &preservationv1.AcquireJobResponse{LeaseTimeoutMs: a.svc.agents.timeout.Milliseconds()}
+	if lease == nil {
+		return resp, nil
+	}
+	job, err := json.Marshal(lease.job)
+	if err != nil {
+		// The job fails, like the invalid jobs of the queue
+		_ = a.svc.CompleteLease(lease.id, fmt.Errorf("error encoding job: %w", err), nil)
+		return nil, status.Error(codes.Internal, "failed to encode job")
+	}
+	resp.Lease = lease.id
+	resp.Job = job
+	return resp, nil
+}
+
+// RenewLease extends the lease of a running job and tells the agent whether it is cancelled.
+func (a *agentServer) RenewLease(_ context.Context, req *preservationv1.RenewLeaseRequest) (*preservationv1.RenewLeaseResponse, error) {
+	cancelled, err := a.svc.RenewLease(req.GetLease(), req.GetRecord())
+	if errors.Is(err, errLeaseNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &preservationv1.RenewLeaseResponse{Cancelled: cancelled}, nil
+}
+
+// CompleteJob ends the lease of a job with its result.
+func (a *agentServer) CompleteJob(_ context.Context, req *preservationv1.CompleteJobRequest) (*preservationv1.CompleteJobResponse, error) {
+	var result error
+	switch req.GetResult() {
+	case preservationv1.JobResult_JOB_RESULT_COMPLETED:
+	case preservationv1.JobResult_JOB_RESULT_FAILED:
+		result = errors.New(cmp.Or(req.GetError(), "preservation failed"))
+	case preservationv1.JobResult_JOB_RESULT_CANCELLED:
+		result = preservation.ErrCancelled
+	case preservationv1.JobResult_JOB_RESULT_INTERRUPTED:
+		result = fmt.Errorf("%w: agent shutting down", queue.ErrInterrupted)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown result %s", req.GetResult())
+	}
+	if err := a.svc.CompleteLease(req.GetLease(), result, req.GetRecord()); errors.Is(err, errLeaseNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &preservationv1.CompleteJobResponse{}, nil
+}
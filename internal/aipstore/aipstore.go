@@ -0,0 +1,522 @@
+// Package aipstore stores AIPs in storage locations (local directories, S3 compatible buckets,
+// Azure Blob Storage containers, Google Cloud Storage buckets or rclone remotes) and retrieves them for reingest
+// and fixity checks.
+// Each AIP is stored below a key prefix derived from its UUID, alongside a SHA-256 manifest of its files.
+// The manifest is written last, so only completely stored AIPs are listed.
+package aipstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// manifestName is the name of the manifest object stored with each AIP.
+const manifestName = "manifest-sha256.txt"
+
+// ErrNotFound is returned when an AIP or object does not exist in a storage location.
+var ErrNotFound = errors.New("not found")
+
+// Object is an object in a storage location.
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// PutOptions are the options of a stored object.
+type PutOptions struct {
+	// SHA256 is the hex encoded checksum of the file.
+	SHA256 string
+	// Tier is the storage tier of the object (hot, cool, cold, archive). Empty selects the location's default.
+	// Backends without tiers ignore it.
+	Tier string
+}
+
+// Backend stores objects in a storage location. Keys are slash separated and relative to the location root.
+type Backend interface {
+	// Put stores a local file under key. The stored object is verified before Put returns.
+	Put(ctx context.Context, key, localPath string, opts PutOptions) error
+	// Get writes an object to a local file.
+	Get(ctx context.Context, key, destPath string) error
+	// Open opens an object for reading.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// List lists the objects below a key prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Delete removes an object. Removing a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// Close releases the backend resources.
+	Close() error
+}
+
+// Store stores AIPs in a storage location.
+type Store struct {
+	location *config.StorageLocation
+	backend  Backend
+	retry    config.RetryPolicy // Retries of the file transfers on transient errors
+	// tenantPrefix returns the prefix of the tenant an AIP belongs to, below the location prefix. nil without tenants
+	tenantPrefix func(aipUUID string) string
+}
+
+// ManifestEntry is a file of a stored AIP.
+type ManifestEntry struct {
+	Path     string `json:"path"` // Relative to the AIP key prefix
+	Checksum string `json:"sha256"`
+}
+
+// StoredFile is a stored file of an AIP, with its checksum from the manifest. The manifest itself has no checksum.
+type StoredFile struct {
+	Path     string    `json:"path"` // Relative to the AIP key prefix
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Checksum string    `json:"sha256,omitempty"`
+}
+
+// FixityFailure is a file of a stored AIP that failed its fixity check.
+type FixityFailure struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// FixityReport is the result of a fixity check of a stored AIP.
+type FixityReport struct {
+	Location string          `json:"location"`
+	AIPUUID  string          `json:"aip_uuid"`
+	Files    int             `json:"files"`
+	Failures []FixityFailure `json:"failures,omitempty"`
+}
+
+// Success reports whether every file of the AIP passed the fixity check.
+func (r *FixityReport) Success() bool {
+	return len(r.Failures) == 0
+}
+
+// New creates a store for a storage location. File transfers are retried on transient errors following the retry
+// policy.
+func New(location *config.StorageLocation, insecure bool, retry config.RetryPolicy) (*Store, error) {
+	if location == nil {
+		return nil, fmt.Errorf("storage location cannot be nil")
+	}
+	var (
+		backend Backend
+		err     error
+	)
+	switch location.Backend {
+	case config.StorageBackendLocal:
+		backend, err = newLocalBackend(location.Local)
+	case config.StorageBackendS3:
+		backend, err = newS3Backend(location.S3, insecure)
+	case config.StorageBackendAzure:
+		backend, err = newAzureBackend(location.Azure, insecure)
+	case config.StorageBackendGCS:
+		backend, err = newGCSBackend(location.GCS)
+	case config.StorageBackendRclone:
+		backend, err = newRcloneBackend(location.Rclone, insecure)
+	default:
+		err = fmt.Errorf("unsupported storage backend: %s", location.Backend)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating storage location %s: %w", location.Name, err)
+	}
+	return &Store{location: location, backend: backend, retry: retry}, nil
+}
+
+// Name returns the name of the storage location.
+func (s *Store) Name() string {
+	return s.location.Name
+}
+
+// Close releases the store resources.
+func (s *Store) Close() {
+	if err := s.backend.Close(); err != nil {
+		logger.Error("Error closing storage location %s: %v", s.location.Name, err)
+	}
+}
+
+// Ping checks that the storage location can be read, by opening an object that is not expected to exist.
+func (s *Store) Ping(ctx context.Context) error {
+	reader, err := s.backend.Open(ctx, path.Join(strings.Trim(s.location.Prefix, "/"), ".health"))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("storage location %s not reachable: %w", s.location.Name, err)
+	}
+	closeReader(reader)
+	return nil
+}
+
+// SetTenantPrefix sets the function returning the prefix of the tenant an AIP belongs to, empty for AIPs of no
+// tenant. The AIPs of a tenant are stored below its prefix, inside the location prefix.
+func (s *Store) SetTenantPrefix(fn func(aipUUID string) string) {
+	s.tenantPrefix = fn
+}
+
+// AIPPrefix returns the key prefix an AIP is stored below in the layout of the location.
+func (s *Store) AIPPrefix(aipUUID string) string {
+	return s.layoutPrefix(aipUUID, s.Layout())
+}
+
+// Layout returns the layout of the AIPs stored in the location.
+func (s *Store) Layout() string {
+	if s.location.Layout == "" {
+		return config.StorageLayoutFlat
+	}
+	return s.location.Layout
+}
+
+// layoutPrefix returns the key prefix of an AIP in a layout.
+func (s *Store) layoutPrefix(aipUUID, layout string) string {
+	uuidPath := aipUUID
+	if layout == config.StorageLayoutQuad {
+		hexUUID := strings.ReplaceAll(aipUUID, "-", "")
+		quads := make([]string, 0, len(hexUUID)/4+1)
+		for i := 0; i+4 <= len(hexUUID); i += 4 {
+			quads = append(quads, hexUUID[i:i+4])
+		}
+		uuidPath = path.Join(append(quads, aipUUID)...)
+	}
+	tenantPrefix := ""
+	if s.tenantPrefix != nil {
+		tenantPrefix = s.tenantPrefix(aipUUID)
+	}
+	return path.Join(strings.Trim(s.location.Prefix, "/"), tenantPrefix, uuidPath)
+}
+
+// StoreAIP stores an AIP file (e.g. a ZIP archive) or directory and its manifest. Returns the key prefix of the AIP.
+// The AIP files are stored in the given tier, the manifest always in the location's default tier so it can be read
+// without restoring the AIP. If progress is not nil, it is called with each file before it is stored.
+func (s *Store) StoreAIP(ctx context.Context, aipUUID, aipPath, tier string, progress func(file string, stored, total int)) (string, error) {
+	prefix := s.AIPPrefix(aipUUID)
+	baseDir := filepath.Dir(aipPath)
+
+	total := 0
+	if progress != nil {
+		if err := filepath.WalkDir(aipPath, func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				total++
+			}
+			return err
+		}); err != nil {
+			return "", err
+		}
+	}
+
+	var entries []ManifestEntry
+	err := filepath.WalkDir(aipPath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(baseDir, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		checksum, err := utils.FileChecksum(filePath, "sha256")
+		if err != nil {
+			return err
+		}
+		key := path.Join(prefix, rel)
+		logger.Debug("Storing %s in %s: %s", rel, s.location.Name, key)
+		if progress != nil {
+			progress(rel, len(entries), total)
+		}
+		if err := utils.RetryContext(ctx, s.retry, func() error {
+			return s.backend.Put(ctx, key, filePath, PutOptions{SHA256: checksum, Tier: tier})
+		}); err != nil {
+			return utils.Classify(utils.ErrStorage, fmt.Errorf("error storing %s: %w", rel, err))
+		}
+		entries = append(entries, ManifestEntry{Path: rel, Checksum: checksum})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("AIP has no files: %s", aipPath)
+	}
+
+	if err := s.putManifest(ctx, prefix, entries); err != nil {
+		return "", utils.Classify(utils.ErrStorage, err)
+	}
+	return prefix, nil
+}
+
+// FetchAIP downloads a stored AIP to a local directory, verifying every file against the manifest.
+// Archived files are restored first. Returns the local path of the AIP.
+func (s *Store) FetchAIP(ctx context.Context, aipUUID, destDir string) (string, error) {
+	prefix, entries, err := s.manifest(ctx, aipUUID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.awaitRestore(ctx, aipUUID); err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		destPath := filepath.Join(destDir, filepath.FromSlash(entry.Path))
+		if !strings.HasPrefix(destPath, filepath.Clean(destDir)+string(filepath.Separator)) {
+			return "", fmt.Errorf("manifest path escapes the destination: %s", entry.Path)
+		}
+		if err := utils.CreateDir(filepath.Dir(destPath)); err != nil {
+			return "", err
+		}
+		if err := utils.RetryContext(ctx, s.retry, func() error {
+			return s.backend.Get(ctx, path.Join(prefix, entry.Path), destPath)
+		}); err != nil {
+			return "", utils.Classify(utils.ErrStorage, fmt.Errorf("error fetching %s: %w", entry.Path, err))
+		}
+		checksum, err := utils.FileChecksum(destPath, "sha256")
+		if err != nil {
+			return "", err
+		}
+		if checksum != entry.Checksum {
+			return "", utils.Classify(utils.ErrIntegrity, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", entry.Path, entry.Checksum, checksum))
+		}
+	}
+	root := strings.SplitN(entries[0].Path, "/", 2)[0]
+	return filepath.Join(destDir, root), nil
+}
+
+// VerifyAIP checks the fixity of a stored AIP by reading every file back from the storage location
+// and comparing its checksum to the manifest. Archived files are restored first.
+func (s *Store) VerifyAIP(ctx context.Context, aipUUID string) (*FixityReport, error) {
+	prefix, entries, err := s.manifest(ctx, aipUUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.awaitRestore(ctx, aipUUID); err != nil {
+		return nil, err
+	}
+	report := &FixityReport{Location: s.location.Name, AIPUUID: aipUUID, Files: len(entries)}
+	for _, entry := range entries {
+		checksum, err := s.checksum(ctx, path.Join(prefix, entry.Path))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			report.Failures = append(report.Failures, FixityFailure{Path: entry.Path, Expected: entry.Checksum, Error: err.Error()})
+			continue
+		}
+		if checksum != entry.Checksum {
+			report.Failures = append(report.Failures, FixityFailure{Path: entry.Path, Expected: entry.Checksum, Actual: checksum})
+		}
+	}
+	return report, nil
+}
+
+// ListAIPs returns the UUIDs of the AIPs stored in the location. An AIP whose migration to another layout was
+// interrupted is listed once.
+func (s *Store) ListAIPs(ctx context.Context) ([]string, error) {
+	objects, err := s.backend.List(ctx, strings.Trim(s.location.Prefix, "/"))
+	if err != nil {
+		return nil, err
+	}
+	var uuids []string
+	for _, object := range objects {
+		if path.Base(object.Key) == manifestName {
+			uuids = append(uuids, path.Base(path.Dir(object.Key)))
+		}
+	}
+	sort.Strings(uuids)
+	return slices.Compact(uuids), nil
+}
+
+// Manifest returns the manifest of a stored AIP. Returns ErrNotFound if the AIP is not stored in the location.
+func (s *Store) Manifest(ctx context.Context, aipUUID string) ([]ManifestEntry, error) {
+	_, entries, err := s.manifest(ctx, aipUUID)
+	return entries, err
+}
+
+// manifest returns the key prefix and the manifest of a stored AIP. The AIP is looked up in the layout of the
+// location, then in the other layouts, so AIPs can be read while the location is migrated to another layout.
+func (s *Store) manifest(ctx context.Context, aipUUID string) (string, []ManifestEntry, error) {
+	_, prefix, entries, err := s.findAIP(ctx, aipUUID, s.Layout())
+	return prefix, entries, err
+}
+
+// findAIP returns the layout, key prefix and manifest of a stored AIP, looking it up in a layout first, then in the
+// other layouts.
+func (s *Store) findAIP(ctx context.Context, aipUUID, layout string) (string, string, []ManifestEntry, error) {
+	layouts := []string{layout}
+	for _, other := range config.StorageLayouts {
+		if other != layout {
+			layouts = append(layouts, other)
+		}
+	}
+	for _, candidate := range layouts {
+		prefix := s.layoutPrefix(aipUUID, candidate)
+		entries, err := s.readManifest(ctx, prefix)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", "", nil, fmt.Errorf("error reading manifest of AIP %s: %w", aipUUID, err)
+		}
+		return candidate, prefix, entries, nil
+	}
+	return "", "", nil, fmt.Errorf("AIP %s in %s: %w", aipUUID, s.location.Name, ErrNotFound)
+}
+
+// readManifest reads the manifest stored below a key prefix. Returns ErrNotFound if there is none.
+func (s *Store) readManifest(ctx context.Context, prefix string) ([]ManifestEntry, error) {
+	reader, err := s.backend.Open(ctx, path.Join(prefix, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer closeReader(reader)
+
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		checksum, rel, ok := strings.Cut(line, "  ")
+		if !ok {
+			return nil, fmt.Errorf("invalid manifest line: %s", line)
+		}
+		entries = append(entries, ManifestEntry{Path: rel, Checksum: checksum})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("manifest is empty")
+	}
+	return entries, nil
+}
+
+// Files returns the stored files of an AIP listed in its manifest, and the manifest, sorted by path.
+func (s *Store) Files(ctx context.Context, aipUUID string) ([]StoredFile, error) {
+	prefix, entries, err := s.manifest(ctx, aipUUID)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := s.backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	checksums := make(map[string]string, len(entries)+1)
+	for _, entry := range entries {
+		checksums[entry.Path] = entry.Checksum
+	}
+	checksums[manifestName] = ""
+	files := make([]StoredFile, 0, len(entries)+1)
+	for _, object := range objects {
+		rel := strings.TrimPrefix(strings.TrimPrefix(object.Key, prefix), "/")
+		checksum, ok := checksums[rel]
+		if !ok {
+			continue
+		}
+		files = append(files, StoredFile{Path: rel, Size: object.Size, ModTime: object.ModTime, Checksum: checksum})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// OpenFile opens a stored file of an AIP listed in its manifest, or the manifest.
+// Returns ErrNotFound for any other path, so only AIP files can be read.
+func (s *Store) OpenFile(ctx context.Context, aipUUID, filePath string) (io.ReadCloser, error) {
+	prefix, entries, err := s.manifest(ctx, aipUUID)
+	if err != nil {
+		return nil, err
+	}
+	if filePath != manifestName {
+		listed := false
+		for _, entry := range entries {
+			if entry.Path == filePath {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			return nil, fmt.Errorf("%s of AIP %s: %w", filePath, aipUUID, ErrNotFound)
+		}
+	}
+	return s.backend.Open(ctx, path.Join(prefix, filePath))
+}
+
+// putManifest writes the manifest of an AIP to a temporary file and stores it.
+func (s *Store) putManifest(ctx context.Context, prefix string, entries []ManifestEntry) error {
+	tmp, err := os.CreateTemp("", "aip-manifest-*.txt")
+	if err != nil {
+		return fmt.Errorf("error creating manifest: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(tmp.Name()); err != nil {
+			logger.Error("Failed to remove manifest: %v", err)
+		}
+	}()
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(writer, "%s  %s\n", entry.Checksum, entry.Path); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("error writing manifest: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+	checksum, err := utils.FileChecksum(tmp.Name(), "sha256")
+	if err != nil {
+		return err
+	}
+	key := path.Join(prefix, manifestName)
+	if err := utils.RetryContext(ctx, s.retry, func() error {
+		return s.backend.Put(ctx, key, tmp.Name(), PutOptions{SHA256: checksum})
+	}); err != nil {
+		return fmt.Errorf("error storing manifest: %w", err)
+	}
+	return nil
+}
+
+// checksum streams an object from the backend and returns its hex encoded SHA-256 checksum.
+func (s *Store) checksum(ctx context.Context, key string) (string, error) {
+	reader, err := s.backend.Open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer closeReader(reader)
+	h, err := utils.NewHash("sha256")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func closeReader(reader io.Closer) {
+	if err := reader.Close(); err != nil {
+		logger.Error("Failed to close object: %v", err)
+	}
+}
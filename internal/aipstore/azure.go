@@ -0,0 +1,234 @@
+package aipstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// defaultBlockSizeMB is the default block size of uploaded blobs.
+const defaultBlockSizeMB = 8
+
+// azureAccessTiers maps the storage tiers to Azure access tiers.
+var azureAccessTiers = map[string]blob.AccessTier{
+	config.StorageTierHot:     blob.AccessTierHot,
+	config.StorageTierCool:    blob.AccessTierCool,
+	config.StorageTierCold:    blob.AccessTierCold,
+	config.StorageTierArchive: blob.AccessTierArchive,
+}
+
+// azureBackend stores objects as block blobs in an Azure Blob Storage container.
+type azureBackend struct {
+	container *container.Client
+	config    *config.AzureStorageConfig
+}
+
+func newAzureBackend(cfg *config.AzureStorageConfig, insecure bool) (*azureBackend, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("azure storage config cannot be nil")
+	}
+	opts := &azblob.ClientOptions{}
+	if insecure {
+		// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+		transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		opts.ClientOptions = azcore.ClientOptions{Transport: &http.Client{Transport: transport}}
+	}
+
+	var (
+		client *azblob.Client
+		err    error
+	)
+	if cfg.ConnectionString != "" {
+		client, err = azblob.NewClientFromConnectionString(cfg.ConnectionString, opts)
+	} else {
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", cfg.AccountName)
+		}
+		var cred *azblob.SharedKeyCredential
+		cred, err = azblob.NewSharedKeyCredential(cfg.AccountName, cfg.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("error creating Azure credential: %w", err)
+		}
+		client, err = azblob.NewClientWithSharedKeyCredential(endpoint, cred, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating Azure client: %w", err)
+	}
+	return &azureBackend{container: client.ServiceClient().NewContainerClient(cfg.Container), config: cfg}, nil
+}
+
+// Put uploads a file in blocks. Each block carries a CRC64 of its content, so Azure rejects corrupted blocks.
+// The MD5 of the whole file is stored as the blob's Content-MD5, and the stored size and MD5 are checked
+// once the upload completes. A tier overrides the configured access tier.
+func (b *azureBackend) Put(ctx context.Context, key, localPath string, opts PutOptions) error {
+	md5Hex, err := utils.FileChecksum(localPath, "md5")
+	if err != nil {
+		return err
+	}
+	md5Sum, err := hex.DecodeString(md5Hex)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Clean(localPath))
+	if err != nil {
+		return err
+	}
+	defer closeReader(file)
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	blockSize := b.config.BlockSizeMB
+	if blockSize == 0 {
+		blockSize = defaultBlockSizeMB
+	}
+	uploadOpts := &blockblob.UploadFileOptions{
+		BlockSize: int64(blockSize) * 1024 * 1024,
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: to.Ptr("application/octet-stream"),
+			BlobContentMD5:  md5Sum,
+		},
+		Metadata:                map[string]*string{checksumMetadataKey: to.Ptr(opts.SHA256)},
+		TransactionalValidation: blob.TransferValidationTypeComputeCRC64(),
+	}
+	tier := opts.Tier
+	if tier == "" {
+		tier = b.config.AccessTier
+	}
+	if tier != "" {
+		uploadOpts.AccessTier = to.Ptr(azureAccessTiers[tier])
+	}
+	blobClient := b.container.NewBlockBlobClient(key)
+	if _, err := blobClient.UploadFile(ctx, file, uploadOpts); err != nil {
+		return fmt.Errorf("error uploading blob: %w", err)
+	}
+
+	props, err := blobClient.GetProperties(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error reading uploaded blob: %w", err)
+	}
+	if props.ContentLength == nil || *props.ContentLength != info.Size() {
+		return utils.Classify(utils.ErrIntegrity, fmt.Errorf("size mismatch: expected %d, got %d", info.Size(), valueOf(props.ContentLength)))
+	}
+	if !bytes.Equal(props.ContentMD5, md5Sum) {
+		return utils.Classify(utils.ErrIntegrity, fmt.Errorf("MD5 mismatch: expected %s, got %s", md5Hex, hex.EncodeToString(props.ContentMD5)))
+	}
+	return nil
+}
+
+// Get downloads a blob and checks the MD5 of the downloaded file against the blob's Content-MD5.
+func (b *azureBackend) Get(ctx context.Context, key, destPath string) error {
+	blobClient := b.container.NewBlobClient(key)
+	props, err := blobClient.GetProperties(ctx, nil)
+	if err != nil {
+		return azureError(err, key)
+	}
+	file, err := os.Create(filepath.Clean(destPath))
+	if err != nil {
+		return err
+	}
+	if _, err := blobClient.DownloadFile(ctx, file, nil); err != nil {
+		_ = file.Close()
+		return azureError(err, key)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if len(props.ContentMD5) == 0 {
+		logger.Debug("Blob has no Content-MD5, skipping MD5 check: %s", key)
+		return nil
+	}
+	md5Hex, err := utils.FileChecksum(destPath, "md5")
+	if err != nil {
+		return err
+	}
+	if md5Hex != hex.EncodeToString(props.ContentMD5) {
+		return utils.Classify(utils.ErrIntegrity, fmt.Errorf("MD5 mismatch: expected %s, got %s", hex.EncodeToString(props.ContentMD5), md5Hex))
+	}
+	return nil
+}
+
+func (b *azureBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.container.NewBlobClient(key).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, azureError(err, key)
+	}
+	return resp.Body, nil
+}
+
+func (b *azureBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	if prefix != "" {
+		prefix += "/"
+	}
+	var objects []Object
+	pager := b.container.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing blobs: %w", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+			object := Object{Key: *item.Name}
+			if item.Properties != nil {
+				object.Size = valueOf(item.Properties.ContentLength)
+				object.ModTime = valueOf(item.Properties.LastModified)
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+func (b *azureBackend) Delete(ctx context.Context, key string) error {
+	if _, err := b.container.NewBlobClient(key).Delete(ctx, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (b *azureBackend) Close() error {
+	return nil
+}
+
+// azureError maps missing blobs to ErrNotFound.
+func azureError(err error, key string) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if bloberror.HasCode(err, bloberror.BlobArchived) {
+		return fmt.Errorf("blob is in the archive tier and must be rehydrated first: %s", key)
+	}
+	return err
+}
+
+// valueOf dereferences an optional SDK field, returning the zero value for nil.
+func valueOf[T int64 | time.Time](v *T) T {
+	if v == nil {
+		var zero T
+		return zero
+	}
+	return *v
+}
@@ -0,0 +1,185 @@
+package aipstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"cloud.google.com/go/storage"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// defaultChunkSizeMB is the default resumable upload chunk size.
+const defaultChunkSizeMB = 16
+
+// crc32cTable is the Castagnoli table GCS computes object checksums with.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// gcsStorageClasses maps the storage tiers to GCS storage classes.
+var gcsStorageClasses = map[string]string{
+	config.StorageTierHot:     "STANDARD",
+	config.StorageTierCool:    "NEARLINE",
+	config.StorageTierCold:    "COLDLINE",
+	config.StorageTierArchive: "ARCHIVE",
+}
+
+// gcsBackend stores objects in a Google Cloud Storage bucket.
+type gcsBackend struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+	config *config.GCSStorageConfig
+}
+
+func newGCSBackend(cfg *config.GCSStorageConfig) (*gcsBackend, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("gcs storage config cannot be nil")
+	}
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+	client, err := storage.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCS client: %w", err)
+	}
+	return &gcsBackend{client: client, bucket: client.Bucket(cfg.Bucket), config: cfg}, nil
+}
+
+// Put uploads a file with a resumable upload. The CRC32C of the file is sent with the upload,
+// so GCS rejects the object if its content does not match, and the stored size is checked once the upload completes.
+// A tier overrides the configured storage class.
+func (b *gcsBackend) Put(ctx context.Context, key, localPath string, opts PutOptions) error {
+	crc, size, err := fileCRC32C(localPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Clean(localPath))
+	if err != nil {
+		return err
+	}
+	defer closeReader(file)
+
+	chunkSize := b.config.ChunkSizeMB
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSizeMB
+	}
+	// Cancelling the context aborts the upload if it fails part way
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer := b.bucket.Object(key).NewWriter(ctx)
+	writer.ChunkSize = chunkSize * 1024 * 1024
+	writer.ContentType = "application/octet-stream"
+	writer.Metadata = map[string]string{checksumMetadataKey: opts.SHA256}
+	writer.StorageClass = b.config.StorageClass
+	if opts.Tier != "" {
+		writer.StorageClass = gcsStorageClasses[opts.Tier]
+	}
+	writer.CRC32C = crc
+	writer.SendCRC32C = true
+	if _, err := io.Copy(writer, file); err != nil {
+		return fmt.Errorf("error uploading object: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error uploading object: %w", err)
+	}
+	if attrs := writer.Attrs(); attrs.Size != size {
+		return utils.Classify(utils.ErrIntegrity, fmt.Errorf("size mismatch: expected %d, got %d", size, attrs.Size))
+	}
+	return nil
+}
+
+// Get downloads an object and checks the CRC32C of the downloaded file against the object's.
+func (b *gcsBackend) Get(ctx context.Context, key, destPath string) error {
+	reader, err := b.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		return gcsError(err, key)
+	}
+	defer closeReader(reader)
+	file, err := os.Create(filepath.Clean(destPath))
+	if err != nil {
+		return err
+	}
+	h := crc32.New(crc32cTable)
+	if _, err := io.Copy(io.MultiWriter(file, h), reader); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("error downloading object: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if h.Sum32() != reader.Attrs.CRC32C {
+		return utils.Classify(utils.ErrIntegrity, fmt.Errorf("CRC32C mismatch: expected %08x, got %08x", reader.Attrs.CRC32C, h.Sum32()))
+	}
+	return nil
+}
+
+func (b *gcsBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	reader, err := b.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, gcsError(err, key)
+	}
+	return reader, nil
+}
+
+func (b *gcsBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	if prefix != "" {
+		prefix += "/"
+	}
+	var objects []Object
+	it := b.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing objects: %w", err)
+		}
+		objects = append(objects, Object{Key: attrs.Name, Size: attrs.Size, ModTime: attrs.Updated})
+	}
+	return objects, nil
+}
+
+func (b *gcsBackend) Delete(ctx context.Context, key string) error {
+	if err := b.bucket.Object(key).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (b *gcsBackend) Close() error {
+	return b.client.Close()
+}
+
+// gcsError maps missing objects to ErrNotFound.
+func gcsError(err error, key string) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return err
+}
+
+// fileCRC32C returns the CRC32C checksum and size of a file.
+func fileCRC32C(path string) (uint32, int64, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer closeReader(file)
+	h := crc32.New(crc32cTable)
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return 0, 0, err
+	}
+	return h.Sum32(), size, nil
+}
@@ -0,0 +1,174 @@
+package aipstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// localBackend stores objects as files in a local (or mounted) directory.
+type localBackend struct {
+	dir string
+}
+
+func newLocalBackend(cfg *config.LocalStorageConfig) (*localBackend, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("local storage config cannot be nil")
+	}
+	if err := utils.CreateDir(cfg.Dir); err != nil {
+		return nil, err
+	}
+	return &localBackend{dir: filepath.Clean(cfg.Dir)}, nil
+}
+
+// path returns the file path of a key. Keys escaping the directory are rejected.
+func (b *localBackend) path(key string) (string, error) {
+	filePath := filepath.Join(b.dir, filepath.FromSlash(key))
+	if filePath != b.dir && !strings.HasPrefix(filePath, b.dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return filePath, nil
+}
+
+// Put copies the file under a temporary name, verifies the copy and renames it into place.
+func (b *localBackend) Put(_ context.Context, key, localPath string, opts PutOptions) error {
+	dest, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := utils.CreateDir(filepath.Dir(dest)); err != nil {
+		return err
+	}
+	partial := dest + ".partial"
+	if err := copyFile(localPath, partial); err != nil {
+		return err
+	}
+	checksum, err := utils.FileChecksum(partial, "sha256")
+	if err == nil && checksum != opts.SHA256 {
+		err = utils.Classify(utils.ErrIntegrity, fmt.Errorf("checksum mismatch: expected %s, got %s", opts.SHA256, checksum))
+	}
+	if err == nil {
+		err = os.Rename(partial, dest)
+	}
+	if err != nil {
+		if removeErr := os.Remove(partial); removeErr != nil && !os.IsNotExist(removeErr) {
+			logger.Error("Failed to remove partial file: %v", removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *localBackend) Get(_ context.Context, key, destPath string) error {
+	src, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(src, destPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *localBackend) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	src, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func (b *localBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	root, err := b.path(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	err = filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(filePath, ".partial") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(b.dir, filePath)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+// Delete removes a file and the directories left empty above it.
+func (b *localBackend) Delete(_ context.Context, key string) error {
+	filePath, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for dir := filepath.Dir(filePath); dir != b.dir && strings.HasPrefix(dir, b.dir); dir = filepath.Dir(dir) {
+		// Removing a directory that is not empty fails, which ends the walk up
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (b *localBackend) Close() error {
+	return nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,174 @@
+package aipstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Migration is the migration of a stored AIP to another layout.
+type Migration struct {
+	Location string `json:"location"`
+	AIPUUID  string `json:"aip_uuid"`
+	From     string `json:"from"`   // Layout the AIP was found in
+	To       string `json:"to"`     // Layout the AIP is moved to
+	Key      string `json:"key"`    // Key prefix of the AIP in the new layout
+	Files    int    `json:"files"`  // Files of the AIP, without the manifest
+	Copied   int    `json:"copied"` // Files copied, the others were copied by an interrupted migration
+}
+
+// Moved reports whether the AIP was moved, or was already in the new layout.
+func (m *Migration) Moved() bool {
+	return m.From != m.To
+}
+
+// PlanMigration returns the migration of a stored AIP to a layout without moving it: the layout it is found in and
+// its number of files.
+func (s *Store) PlanMigration(ctx context.Context, aipUUID, layout string) (*Migration, error) {
+	migration, _, _, err := s.planMigration(ctx, aipUUID, layout)
+	return migration, err
+}
+
+// planMigration returns the migration of a stored AIP to a layout, with its current key prefix and its manifest.
+func (s *Store) planMigration(ctx context.Context, aipUUID, layout string) (*Migration, string, []ManifestEntry, error) {
+	if !slices.Contains(config.StorageLayouts, layout) {
+		return nil, "", nil, fmt.Errorf("unknown storage layout: %s", layout)
+	}
+	from, prefix, entries, err := s.findAIP(ctx, aipUUID, layout)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return &Migration{
+		Location: s.location.Name,
+		AIPUUID:  aipUUID,
+		From:     from,
+		To:       layout,
+		Key:      s.layoutPrefix(aipUUID, layout),
+		Files:    len(entries),
+	}, prefix, entries, nil
+}
+
+// MigrateAIP moves a stored AIP to another layout of the location. Each file is read back, verified against the
+// manifest and stored below the key prefix of the new layout, then the manifest is stored, so the AIP is complete in
+// the new layout before its files are removed from the old one, manifest first. A migration that was interrupted is
+// resumed: files already stored with the checksum of the manifest are not copied again. Archived files are restored
+// first, and stored in the default tier of the location. If progress is not nil, it is called with each file before
+// it is copied.
+func (s *Store) MigrateAIP(ctx context.Context, aipUUID, layout string, progress func(file string, done, total int)) (*Migration, error) {
+	migration, oldPrefix, entries, err := s.planMigration(ctx, aipUUID, layout)
+	if err != nil {
+		return nil, err
+	}
+	if migration.Moved() {
+		if err := s.copyAIP(ctx, aipUUID, oldPrefix, migration, entries, progress); err != nil {
+			return nil, err
+		}
+	}
+	// The AIP may be left in other layouts by an interrupted migration, after its manifest was stored
+	for _, other := range config.StorageLayouts {
+		if other == layout {
+			continue
+		}
+		if err := s.removeAIP(ctx, s.layoutPrefix(aipUUID, other), entries); err != nil {
+			return nil, utils.Classify(utils.ErrStorage, fmt.Errorf("error removing AIP %s from the %s layout: %w", aipUUID, other, err))
+		}
+	}
+	return migration, nil
+}
+
+// copyAIP copies the files of an AIP from a key prefix to the key prefix of a migration, verifying them against the
+// manifest, then stores the manifest.
+func (s *Store) copyAIP(ctx context.Context, aipUUID, oldPrefix string, migration *Migration, entries []ManifestEntry, progress func(file string, done, total int)) error {
+	if err := s.awaitRestore(ctx, aipUUID); err != nil {
+		return err
+	}
+	stored, err := s.backend.List(ctx, migration.Key)
+	if err != nil {
+		return utils.Classify(utils.ErrStorage, fmt.Errorf("error listing %s: %w", migration.Key, err))
+	}
+	existing := make(map[string]bool, len(stored))
+	for _, object := range stored {
+		existing[object.Key] = true
+	}
+	tmp, err := os.CreateTemp("", "aip-migration-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+			logger.Error("Failed to remove migrated file: %v", err)
+		}
+	}()
+
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := path.Join(migration.Key, entry.Path)
+		if existing[key] {
+			if checksum, err := s.checksum(ctx, key); err == nil && checksum == entry.Checksum {
+				logger.Debug("Skipping %s of AIP %s, already migrated", entry.Path, aipUUID)
+				continue
+			}
+		}
+		if progress != nil {
+			progress(entry.Path, i, len(entries))
+		}
+		if err := utils.RetryContext(ctx, s.retry, func() error {
+			return s.backend.Get(ctx, path.Join(oldPrefix, entry.Path), tmpPath)
+		}); err != nil {
+			return utils.Classify(utils.ErrStorage, fmt.Errorf("error reading %s: %w", entry.Path, err))
+		}
+		checksum, err := utils.FileChecksum(tmpPath, "sha256")
+		if err != nil {
+			return err
+		}
+		if checksum != entry.Checksum {
+			return utils.Classify(utils.ErrIntegrity, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", entry.Path, entry.Checksum, checksum))
+		}
+		logger.Debug("Migrating %s of AIP %s to %s", entry.Path, aipUUID, key)
+		if err := utils.RetryContext(ctx, s.retry, func() error {
+			return s.backend.Put(ctx, key, tmpPath, PutOptions{SHA256: checksum})
+		}); err != nil {
+			return utils.Classify(utils.ErrStorage, fmt.Errorf("error storing %s: %w", entry.Path, err))
+		}
+		migration.Copied++
+	}
+	if err := s.putManifest(ctx, migration.Key, entries); err != nil {
+		return utils.Classify(utils.ErrStorage, err)
+	}
+	return nil
+}
+
+// removeAIP removes the manifest and the files of an AIP below a key prefix. The manifest is removed first, so the
+// AIP is no longer listed there if the removal is interrupted. Objects that are not in the manifest are kept.
+func (s *Store) removeAIP(ctx context.Context, prefix string, entries []ManifestEntry) error {
+	objects, err := s.backend.List(ctx, prefix)
+	if err != nil || len(objects) == 0 {
+		return err
+	}
+	keys := make([]string, 0, len(entries)+1)
+	keys = append(keys, path.Join(prefix, manifestName))
+	for _, entry := range entries {
+		keys = append(keys, path.Join(prefix, entry.Path))
+	}
+	for _, key := range keys {
+		if err := utils.RetryContext(ctx, s.retry, func() error {
+			return s.backend.Delete(ctx, key)
+		}); err != nil {
+			return fmt.Errorf("error removing %s: %w", key, err)
+		}
+	}
+	logger.Debug("Removed AIP below %s", prefix)
+	return nil
+}
@@ -0,0 +1,164 @@
+package aipstore
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const testAIPUUID = "0190a6f2-5c1e-7b3a-9d4e-2f6a8b1c3d5e"
+
+// newTestStore returns a store of a local location in the flat layout, holding an AIP of three files.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	location := &config.StorageLocation{
+		Name:    "local",
+		Backend: config.StorageBackendLocal,
+		Prefix:  "aips",
+		Local:   &config.LocalStorageConfig{Dir: t.TempDir()},
+	}
+	s, err := New(location, false, config.RetryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	aip := filepath.Join(t.TempDir(), "box-12-"+testAIPUUID)
+	for name, content := range map[string]string{
+		"bagit.txt":               "BagIt-Version: 1.0\n",
+		"data/objects/report.pdf": "%PDF-1.7 report",
+		"data/METS.xml":           "<mets/>",
+	} {
+		file := filepath.Join(aip, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.StoreAIP(context.Background(), testAIPUUID, aip, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// putObject stores content at a key of the location, as an interrupted migration would have.
+func putObject(t *testing.T, s *Store, key, content string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "object")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := utils.FileChecksum(file, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.backend.Put(context.Background(), key, file, PutOptions{SHA256: checksum}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// objectCount returns the number of objects stored below a key prefix.
+func objectCount(t *testing.T, s *Store, prefix string) int {
+	t.Helper()
+	objects, err := s.backend.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(objects)
+}
+
+func TestMigrateAIPResumesInterruptedMigration(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	flat := s.layoutPrefix(testAIPUUID, config.StorageLayoutFlat)
+	quad := s.layoutPrefix(testAIPUUID, config.StorageLayoutQuad)
+	root := "box-12-" + testAIPUUID
+
+	// The interrupted migration copied one file, and left another one with other content
+	putObject(t, s, path.Join(quad, root, "bagit.txt"), "BagIt-Version: 1.0\n")
+	putObject(t, s, path.Join(quad, root, "data/objects/report.pdf"), "%PDF-1.7 rep")
+
+	var copied []string
+	migration, err := s.MigrateAIP(ctx, testAIPUUID, config.StorageLayoutQuad, func(file string, _, _ int) {
+		copied = append(copied, file)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migration.From != config.StorageLayoutFlat || migration.To != config.StorageLayoutQuad || migration.Key != quad {
+		t.Errorf("migration = %+v, want from flat to quad at %s", migration, quad)
+	}
+	if migration.Files != 3 || migration.Copied != 2 {
+		t.Errorf("migration copied %d of %d files, want 2 of 3", migration.Copied, migration.Files)
+	}
+	for _, file := range copied {
+		if file == root+"/bagit.txt" {
+			t.Errorf("%s was copied again, it was already migrated", file)
+		}
+	}
+
+	// The AIP is complete in the new layout, with its manifest, and removed from the old one
+	if n := objectCount(t, s, quad); n != 4 {
+		t.Errorf("%d objects in the quad layout, want the 3 files and the manifest", n)
+	}
+	if n := objectCount(t, s, flat); n != 0 {
+		t.Errorf("%d objects left in the flat layout", n)
+	}
+	s.location.Layout = config.StorageLayoutQuad
+	report, err := s.VerifyAIP(ctx, testAIPUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Success() {
+		t.Errorf("migrated AIP is not valid: %+v", report)
+	}
+}
+
+func TestMigrateAIPResumesRemoval(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	flat := s.layoutPrefix(testAIPUUID, config.StorageLayoutFlat)
+	quad := s.layoutPrefix(testAIPUUID, config.StorageLayoutQuad)
+
+	// The interrupted migration stored the AIP in the new layout, but did not remove it from the old one
+	if _, err := s.MigrateAIP(ctx, testAIPUUID, config.StorageLayoutQuad, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.StoreAIP(ctx, testAIPUUID, fetchAIP(t, s), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := objectCount(t, s, flat); n != 4 {
+		t.Fatalf("%d objects in the flat layout, want the AIP left by the interrupted migration", n)
+	}
+
+	migration, err := s.MigrateAIP(ctx, testAIPUUID, config.StorageLayoutQuad, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migration.Moved() || migration.Copied != 0 {
+		t.Errorf("migration = %+v, want the AIP found in the new layout and nothing copied", migration)
+	}
+	if n := objectCount(t, s, flat); n != 0 {
+		t.Errorf("%d objects left in the flat layout", n)
+	}
+	if n := objectCount(t, s, quad); n != 4 {
+		t.Errorf("%d objects in the quad layout, want the 3 files and the manifest", n)
+	}
+}
+
+// fetchAIP downloads the AIP to a temporary directory and returns its path.
+func fetchAIP(t *testing.T, s *Store) string {
+	t.Helper()
+	aip, err := s.FetchAIP(context.Background(), testAIPUUID, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aip
+}
@@ -0,0 +1,98 @@
+package aipstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/penwern/curate-preservation-core/internal/rclone"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// rcloneBackend stores objects in an rclone remote, with the rclone command.
+type rcloneBackend struct {
+	remote *rclone.Remote
+}
+
+func newRcloneBackend(cfg *config.RcloneConfig, insecure bool) (*rcloneBackend, error) {
+	remote, err := rclone.New(cfg, insecure)
+	if err != nil {
+		return nil, err
+	}
+	return &rcloneBackend{remote: remote}, nil
+}
+
+// Put copies a file to the remote, which rclone checks against the hashes the remote supports.
+// The stored size, and the SHA-256 if the remote has it, are then checked against the file.
+// rclone has no storage tiers, set the class of the stored files in the remote options instead.
+func (b *rcloneBackend) Put(ctx context.Context, key, localPath string, opts PutOptions) error {
+	info, err := os.Stat(filepath.Clean(localPath))
+	if err != nil {
+		return err
+	}
+	if err := b.remote.Upload(ctx, localPath, key); err != nil {
+		return fmt.Errorf("error uploading object: %w", err)
+	}
+	entry, err := b.remote.Stat(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error reading uploaded object: %w", err)
+	}
+	if entry.Size != info.Size() {
+		return utils.Classify(utils.ErrIntegrity, fmt.Errorf("size mismatch: expected %d, got %d", info.Size(), entry.Size))
+	}
+	if checksum := entry.Hash("sha256"); checksum != "" && checksum != opts.SHA256 {
+		return utils.Classify(utils.ErrIntegrity, fmt.Errorf("checksum mismatch: expected %s, got %s", opts.SHA256, checksum))
+	}
+	return nil
+}
+
+func (b *rcloneBackend) Get(ctx context.Context, key, destPath string) error {
+	return rcloneError(b.remote.Download(ctx, key, destPath), key)
+}
+
+func (b *rcloneBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	reader, err := b.remote.Open(ctx, key, 0)
+	if err != nil {
+		return nil, rcloneError(err, key)
+	}
+	return reader, nil
+}
+
+func (b *rcloneBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	entries, err := b.remote.List(ctx, prefix, true)
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %w", err)
+	}
+	objects := make([]Object, 0, len(entries))
+	for _, entry := range entries {
+		key := entry.Path
+		if prefix != "" {
+			key = prefix + "/" + entry.Path
+		}
+		objects = append(objects, Object{Key: key, Size: entry.Size, ModTime: entry.ModTime})
+	}
+	return objects, nil
+}
+
+func (b *rcloneBackend) Delete(ctx context.Context, key string) error {
+	if err := b.remote.Delete(ctx, key); err != nil && !errors.Is(err, rclone.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (b *rcloneBackend) Close() error {
+	return nil
+}
+
+// rcloneError maps missing objects to ErrNotFound.
+func rcloneError(err error, key string) error {
+	if errors.Is(err, rclone.ErrNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package aipstore
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// ObjectRestore is the restore state of an object.
+type ObjectRestore struct {
+	// Archived is set if the object is in an archive tier and must be restored before it can be read.
+	Archived bool
+	// Pending is set while a restore of the object is in progress.
+	Pending bool
+	// ExpiresAt is when the restored copy of the object is removed.
+	ExpiresAt time.Time
+}
+
+// Restorer is implemented by backends with archive tiers, whose objects must be restored before they can be read.
+type Restorer interface {
+	// Restore returns the restore state of an object, and requests its restore if it is archived
+	// and neither restored nor being restored.
+	Restore(ctx context.Context, key string) (ObjectRestore, error)
+	// RestoreWait returns the time between restore status checks and how long to wait for a restore.
+	RestoreWait() (interval, timeout time.Duration)
+}
+
+// RestoreStatus is the restore progress of a stored AIP.
+type RestoreStatus struct {
+	Location  string    `json:"location"`
+	AIPUUID   string    `json:"aip_uuid"`
+	Files     int       `json:"files"`
+	Archived  int       `json:"archived"` // Files in an archive tier
+	Pending   int       `json:"pending"`  // Archived files still being restored
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Ready reports whether every file of the AIP can be read.
+func (s *RestoreStatus) Ready() bool {
+	return s.Pending == 0
+}
+
+// RestoreAIP requests the restore of the archived files of an AIP and returns its restore progress.
+// Files already restored or being restored are not requested again, so it is also used to poll the restore.
+// AIPs in locations without archive tiers are always ready.
+func (s *Store) RestoreAIP(ctx context.Context, aipUUID string) (*RestoreStatus, error) {
+	prefix, entries, err := s.manifest(ctx, aipUUID)
+	if err != nil {
+		return nil, err
+	}
+	status := &RestoreStatus{Location: s.location.Name, AIPUUID: aipUUID, Files: len(entries)}
+	restorer, ok := s.backend.(Restorer)
+	if !ok {
+		return status, nil
+	}
+	for _, entry := range entries {
+		var state ObjectRestore
+		if err := utils.RetryContext(ctx, s.retry, func() error {
+			var err error
+			state, err = restorer.Restore(ctx, path.Join(prefix, entry.Path))
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("error restoring %s: %w", entry.Path, err)
+		}
+		if !state.Archived {
+			continue
+		}
+		status.Archived++
+		if state.Pending {
+			status.Pending++
+		} else if status.ExpiresAt.IsZero() || state.ExpiresAt.Before(status.ExpiresAt) {
+			status.ExpiresAt = state.ExpiresAt
+		}
+	}
+	return status, nil
+}
+
+// WaitForRestore restores the archived files of an AIP and polls until every file can be read.
+// progress is called with the restore progress after every check. Fails once the backend's restore timeout passes.
+func (s *Store) WaitForRestore(ctx context.Context, aipUUID string, progress func(*RestoreStatus)) error {
+	status, err := s.RestoreAIP(ctx, aipUUID)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(status)
+	}
+	if status.Ready() {
+		return nil
+	}
+	interval, timeout := s.backend.(Restorer).RestoreWait()
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for !status.Ready() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("restore of AIP %s timed out after %s, %d of %d files pending", aipUUID, timeout, status.Pending, status.Archived)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if status, err = s.RestoreAIP(ctx, aipUUID); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(status)
+		}
+	}
+	return nil
+}
+
+// awaitRestore waits for the archived files of an AIP to be restored before they are read.
+func (s *Store) awaitRestore(ctx context.Context, aipUUID string) error {
+	if _, ok := s.backend.(Restorer); !ok {
+		return nil
+	}
+	requested := false
+	return s.WaitForRestore(ctx, aipUUID, func(status *RestoreStatus) {
+		switch {
+		case status.Archived == 0:
+		case !status.Ready() && !requested:
+			requested = true
+			logger.Info("Restoring AIP %s from the archive tier of %s, %d of %d files pending", aipUUID, s.location.Name, status.Pending, status.Archived)
+		case status.Ready() && requested:
+			logger.Info("AIP %s restored in %s, available until %s", aipUUID, s.location.Name, status.ExpiresAt.Format(time.RFC3339))
+		case !status.Ready():
+			logger.Debug("Restore of AIP %s in progress, %d of %d files pending", aipUUID, status.Pending, status.Archived)
+		}
+	})
+}
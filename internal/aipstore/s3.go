@@ -0,0 +1,175 @@
+package aipstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	// defaultPartSizeMB is the default multipart upload part size.
+	defaultPartSizeMB = 64
+	// checksumMetadataKey holds the SHA-256 checksum of a stored object in its user metadata.
+	checksumMetadataKey = "Sha256"
+)
+
+// s3StorageClasses maps the storage tiers to S3 storage classes.
+var s3StorageClasses = map[string]string{
+	config.StorageTierHot:     "STANDARD",
+	config.StorageTierCool:    "STANDARD_IA",
+	config.StorageTierCold:    "GLACIER_IR",
+	config.StorageTierArchive: "GLACIER",
+}
+
+// s3ArchiveClasses are the storage classes whose objects must be restored before they can be read.
+var s3ArchiveClasses = map[string]bool{
+	"GLACIER":      true,
+	"DEEP_ARCHIVE": true,
+}
+
+// s3Backend stores objects in an S3 compatible bucket (AWS, MinIO, Wasabi).
+type s3Backend struct {
+	client *minio.Client
+	config *config.S3StorageConfig
+}
+
+func newS3Backend(cfg *config.S3StorageConfig, insecure bool) (*s3Backend, error) {
+	client, err := utils.NewS3Client(cfg, insecure)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Backend{client: client, config: cfg}, nil
+}
+
+// Put uploads a file, in parts for large files. Every request carries the MD5 of its content,
+// so S3 rejects corrupted parts, and the stored size is checked once the upload completes.
+// A tier overrides the configured storage class.
+func (b *s3Backend) Put(ctx context.Context, key, localPath string, opts PutOptions) error {
+	info, err := os.Stat(filepath.Clean(localPath))
+	if err != nil {
+		return err
+	}
+	partSize := b.config.PartSizeMB
+	if partSize == 0 {
+		partSize = defaultPartSizeMB
+	}
+	storageClass := b.config.StorageClass
+	if opts.Tier != "" {
+		storageClass = s3StorageClasses[opts.Tier]
+		if opts.Tier == config.StorageTierArchive && b.config.ArchiveClass != "" {
+			storageClass = b.config.ArchiveClass
+		}
+	}
+	putOpts := minio.PutObjectOptions{
+		ContentType:    "application/octet-stream",
+		UserMetadata:   map[string]string{checksumMetadataKey: opts.SHA256},
+		StorageClass:   storageClass,
+		PartSize:       uint64(partSize) * 1024 * 1024,
+		SendContentMd5: true,
+	}
+	if _, err := b.client.FPutObject(ctx, b.config.Bucket, key, localPath, putOpts); err != nil {
+		return fmt.Errorf("error uploading object: %w", err)
+	}
+	stat, err := b.client.StatObject(ctx, b.config.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("error reading uploaded object: %w", err)
+	}
+	if stat.Size != info.Size() {
+		return utils.Classify(utils.ErrIntegrity, fmt.Errorf("size mismatch: expected %d, got %d", info.Size(), stat.Size))
+	}
+	return nil
+}
+
+func (b *s3Backend) Get(ctx context.Context, key, destPath string) error {
+	if err := b.client.FGetObject(ctx, b.config.Bucket, key, destPath, minio.GetObjectOptions{}); err != nil {
+		return s3Error(err)
+	}
+	return nil
+}
+
+func (b *s3Backend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := b.client.GetObject(ctx, b.config.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	// GetObject is lazy, stat the object to surface missing keys
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		return nil, s3Error(err)
+	}
+	return object, nil
+}
+
+func (b *s3Backend) List(ctx context.Context, prefix string) ([]Object, error) {
+	if prefix != "" {
+		prefix += "/"
+	}
+	var objects []Object
+	for object := range b.client.ListObjects(ctx, b.config.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("error listing objects: %w", object.Err)
+		}
+		objects = append(objects, Object{Key: object.Key, Size: object.Size, ModTime: object.LastModified})
+	}
+	return objects, nil
+}
+
+// Delete removes an object. S3 does not report missing keys.
+func (b *s3Backend) Delete(ctx context.Context, key string) error {
+	return b.client.RemoveObject(ctx, b.config.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+// Restore requests a restore of archived objects with the configured retrieval tier.
+// The restore state is read from the object's x-amz-restore header.
+func (b *s3Backend) Restore(ctx context.Context, key string) (ObjectRestore, error) {
+	info, err := b.client.StatObject(ctx, b.config.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectRestore{}, s3Error(err)
+	}
+	if !s3ArchiveClasses[info.Metadata.Get("X-Amz-Storage-Class")] {
+		return ObjectRestore{}, nil
+	}
+	state := ObjectRestore{Archived: true}
+	if info.Restore != nil {
+		state.Pending = info.Restore.OngoingRestore
+		state.ExpiresAt = info.Restore.ExpiryTime
+		return state, nil
+	}
+	req := minio.RestoreRequest{}
+	req.SetDays(b.config.Restore.RestoreDays())
+	req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: minio.TierType(b.config.Restore.RetrievalTier())})
+	if err := b.client.RestoreObject(ctx, b.config.Bucket, key, "", req); err != nil {
+		// minio-go reports the 202 Accepted of a new restore as an error
+		resp := minio.ToErrorResponse(err)
+		if resp.StatusCode != http.StatusAccepted && resp.Code != "RestoreAlreadyInProgress" {
+			return ObjectRestore{}, fmt.Errorf("error requesting restore: %w", err)
+		}
+	}
+	state.Pending = true
+	return state, nil
+}
+
+func (b *s3Backend) RestoreWait() (interval, timeout time.Duration) {
+	return b.config.Restore.PollInterval(), b.config.Restore.Timeout()
+}
+
+func (b *s3Backend) Close() error {
+	return nil
+}
+
+// s3Error maps missing keys to ErrNotFound.
+func s3Error(err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == minio.NoSuchKey || resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, resp.Key)
+	}
+	return err
+}
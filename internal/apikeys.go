@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/apikeys"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// CreateAPIKeyRequest is the request body of CreateAPIKeyHandler.
+type CreateAPIKeyRequest struct {
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	Tenant    string    `json:"tenant,omitempty"`    // Tenant the key is bound to, the whole service if not set
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // Never expires if not set
+}
+
+// CreateAPIKeyResponse is the created key, with its value. The value is not stored and cannot be shown again.
+type CreateAPIKeyResponse struct {
+	*apikeys.Key
+	Value string `json:"key"`
+}
+
+// APIKeysHandler responds with the API keys, most recent first, without their values.
+func APIKeysHandler(store *apikeys.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "API keys are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		keys, err := store.List(r.Context())
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list API keys: %v", err))
+			http.Error(w, "failed to list API keys", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, keys)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// CreateAPIKeyHandler creates an API key granting a role, optionally bound to one of the tenants. Responds with 201
+// Created and the key, whose value is only shown in this response.
+func CreateAPIKeyHandler(store *apikeys.Store, tenants *config.TenantsConfig) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "API keys are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		var req CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := apikeys.Validate(req.Name, req.Role, req.ExpiresAt); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Tenant != "" && tenants.Tenant(req.Tenant) == nil {
+			http.Error(w, fmt.Sprintf("unknown tenant %q", req.Tenant), http.StatusBadRequest)
+			return
+		}
+		createdBy := ""
+		if principal := PrincipalFromContext(r.Context()); principal != nil {
+			createdBy = principal.Username
+		}
+		key, value, err := store.Create(r.Context(), req.Name, req.Role, req.Tenant, createdBy, req.ExpiresAt)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to create API key: %v", err))
+			http.Error(w, "failed to create API key", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Created API key %s (%s, %s) for %s", key.ID, key.Name, key.Role, createdBy)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, CreateAPIKeyResponse{Key: key, Value: value})
+	}
+	return recoveryMiddleware(handler)
+}
+
+// RevokeAPIKeyHandler revokes an API key. Requests authenticated with the key are rejected at once.
+// Responds with the revoked key.
+func RevokeAPIKeyHandler(store *apikeys.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if store == nil {
+			http.Error(w, "API keys are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		key, err := store.Revoke(r.Context(), id)
+		if errors.Is(err, apikeys.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to revoke API key %s: %v", id, err))
+			http.Error(w, "failed to revoke API key", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Revoked API key %s (%s)", key.ID, key.Name)
+		writeJSON(w, key)
+	}
+	return recoveryMiddleware(handler)
+}
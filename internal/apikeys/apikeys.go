@@ -0,0 +1,277 @@
+// Package apikeys manages the API keys of the HTTP API. Each key grants an API role, like the roles mapped from
+// OpenID Connect tokens, and can be bound to a tenant. Keys are shown once when they are created: only a SHA-256 hash of their secret is stored,
+// in a SQLite database shared by the service and the apikeys command.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+const (
+	// Prefix starts every API key, telling them apart from OpenID Connect tokens.
+	Prefix = "ca4m_"
+	// lastUsedInterval is how often the last use of a key is written, so that requests don't all write.
+	lastUsedInterval = time.Minute
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS api_keys (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	role TEXT NOT NULL,
+	hash TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	created_by TEXT NOT NULL DEFAULT '',
+	expires_at BIGINT NOT NULL DEFAULT 0,
+	last_used_at BIGINT NOT NULL DEFAULT 0,
+	revoked_at BIGINT NOT NULL DEFAULT 0,
+	tenant TEXT NOT NULL DEFAULT ''
+)`
+
+// tenantColumn adds the tenant column to the databases created before tenants.
+const tenantColumn = `ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`
+
+var (
+	// ErrNotFound is returned when an API key does not exist.
+	ErrNotFound = errors.New("API key not found")
+	// ErrInvalidKey is returned when a key is unknown, revoked, expired or does not match its hash.
+	ErrInvalidKey = errors.New("invalid API key")
+)
+
+// Key is an API key, without its secret.
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	Tenant     string     `json:"tenant,omitempty"` // Tenant the key is bound to, empty for the whole service
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key can be used.
+func (k *Key) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// Store keeps the API keys in a SQLite database.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the API key database, <DataDir>/api_keys.db unless a path is configured.
+func Open(ctx context.Context, cfg *config.Config) (*Store, error) {
+	dbPath := cfg.Auth.APIKeys.Path
+	if dbPath == "" {
+		if cfg.DataDir == "" {
+			return nil, fmt.Errorf("no database path or data directory set for the API keys")
+		}
+		dbPath = filepath.Join(cfg.DataDir, "api_keys.db")
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o750); err != nil {
+		return nil, fmt.Errorf("error creating API key directory: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("error opening API key database: %w", err)
+	}
+	// SQLite has a single writer
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error creating API key table: %w", err)
+	}
+	var hasTenant bool
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM pragma_table_info('api_keys') WHERE name = 'tenant'`).Scan(&hasTenant); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error reading API key table: %w", err)
+	}
+	if !hasTenant {
+		if _, err := db.ExecContext(ctx, tenantColumn); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("error adding tenant to API key table: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create creates a key granting a role, bound to a tenant if not empty, valid until expiresAt if it is not zero.
+// Returns the key and its secret value, which is not stored and cannot be shown again.
+func (s *Store) Create(ctx context.Context, name, role, tenant, createdBy string, expiresAt time.Time) (*Key, string, error) {
+	if err := Validate(name, role, expiresAt); err != nil {
+		return nil, "", err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := &Key{ID: id, Name: name, Role: role, Tenant: tenant, CreatedAt: time.Now().UTC(), CreatedBy: createdBy}
+	if !expiresAt.IsZero() {
+		expires := expiresAt.UTC()
+		key.ExpiresAt = &expires
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO api_keys (id, name, role, hash, created_at, created_by, expires_at, tenant)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, key.ID, key.Name, key.Role, hash(secret), key.CreatedAt.UnixNano(), key.CreatedBy,
+		unixNano(key.ExpiresAt), key.Tenant)
+	if err != nil {
+		return nil, "", fmt.Errorf("error storing API key: %w", err)
+	}
+	return key, Prefix + id + "_" + secret, nil
+}
+
+// Validate checks the name, role and expiry of a new key.
+func Validate(name, role string, expiresAt time.Time) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("API key name is required")
+	}
+	if !slices.Contains(config.Roles, role) {
+		return fmt.Errorf("invalid role %q, expected one of %s", role, strings.Join(config.Roles, ", "))
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+		return errors.New("API key expiry must be in the future")
+	}
+	return nil
+}
+
+// Revoke revokes a key. Revoking a revoked key keeps its revocation time.
+func (s *Store) Revoke(ctx context.Context, id string) (*Key, error) {
+	if _, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at = 0`,
+		time.Now().UnixNano(), id); err != nil {
+		return nil, fmt.Errorf("error revoking API key: %w", err)
+	}
+	return s.Get(ctx, id)
+}
+
+// Get returns a key.
+func (s *Store) Get(ctx context.Context, id string) (*Key, error) {
+	key, _, err := s.get(ctx, id)
+	return key, err
+}
+
+// List returns the keys, most recent first.
+func (s *Store) List(ctx context.Context) ([]*Key, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, role, hash, created_at, created_by, expires_at, last_used_at,
+		revoked_at, tenant FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing API keys: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	keys := []*Key{}
+	for rows.Next() {
+		key, _, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Authenticate returns the active key of a raw key value, recording its use. Returns ErrInvalidKey if the value is
+// not the value of an active key.
+func (s *Store) Authenticate(ctx context.Context, raw string) (*Key, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, Prefix), "_")
+	if !ok || !strings.HasPrefix(raw, Prefix) {
+		return nil, ErrInvalidKey
+	}
+	key, keyHash, err := s.get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(keyHash)) != 1 || !key.Active() {
+		return nil, ErrInvalidKey
+	}
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedInterval {
+		if _, err := s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now.UnixNano(), id); err != nil {
+			return nil, fmt.Errorf("error recording API key use: %w", err)
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+// get returns a key and the hash of its secret.
+func (s *Store) get(ctx context.Context, id string) (*Key, string, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT id, name, role, hash, created_at, created_by, expires_at, last_used_at,
+		revoked_at, tenant FROM api_keys WHERE id = ?`, id)
+	key, keyHash, err := scanKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrNotFound
+	}
+	return key, keyHash, err
+}
+
+func scanKey(row interface{ Scan(dest ...any) error }) (*Key, string, error) {
+	var key Key
+	var keyHash string
+	var createdAt, expiresAt, lastUsedAt, revokedAt int64
+	if err := row.Scan(&key.ID, &key.Name, &key.Role, &keyHash, &createdAt, &key.CreatedBy, &expiresAt, &lastUsedAt,
+		&revokedAt, &key.Tenant); err != nil {
+		return nil, "", err
+	}
+	key.CreatedAt = time.Unix(0, createdAt).UTC()
+	key.ExpiresAt = timeOrNil(expiresAt)
+	key.LastUsedAt = timeOrNil(lastUsedAt)
+	key.RevokedAt = timeOrNil(revokedAt)
+	return &key, keyHash, nil
+}
+
+// timeOrNil returns the time of a stored timestamp, 0 meaning no time.
+func timeOrNil(ns int64) *time.Time {
+	if ns == 0 {
+		return nil
+	}
+	t := time.Unix(0, ns).UTC()
+	return &t
+}
+
+// unixNano returns the stored timestamp of a time, 0 meaning no time.
+func unixNano(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating API key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,231 @@
+// Package archivesspace provides a client for ArchivesSpace, registering preserved AIPs as digital objects
+// linked to the archival objects they belong to.
+package archivesspace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// archivalObjectURIPattern matches ArchivesSpace archival object URIs and captures the repository ID.
+var archivalObjectURIPattern = regexp.MustCompile(`^/repositories/(\d+)/archival_objects/\d+$`)
+
+// DigitalObject describes the digital object created for an AIP.
+type DigitalObject struct {
+	Title      string
+	Identifier string // Unique digital object ID, the AIP UUID
+	FileURI    string
+	Checksum   string // SHA-256, optional
+	Rights     string // Use restrictions, optional
+}
+
+// Client represents an ArchivesSpace client.
+type Client struct {
+	httpClient *utils.HTTPClient
+	config     *config.ArchivesSpaceConfig
+	session    string
+}
+
+// NewClient creates a new ArchivesSpace client and logs in.
+func NewClient(ctx context.Context, cfg *config.ArchivesSpaceConfig, insecure bool) (*Client, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("archivesspace config cannot be nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid archivesspace config: %w", err)
+	}
+	c := &Client{
+		httpClient: utils.NewHTTPClient(30*time.Second, insecure),
+		config:     cfg,
+	}
+	if err := utils.WithRetry(func() error { return c.login(ctx) }); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the ArchivesSpace client.
+func (c *Client) Close() {
+	c.httpClient.Close()
+}
+
+// RepositoryID returns the repository ID of an archival object URI (e.g. /repositories/2/archival_objects/123).
+func RepositoryID(archivalObjectURI string) (string, error) {
+	match := archivalObjectURIPattern.FindStringSubmatch(archivalObjectURI)
+	if match == nil {
+		return "", fmt.Errorf("invalid ArchivesSpace archival object URI: %s", archivalObjectURI)
+	}
+	return match[1], nil
+}
+
+// RegisterAIP creates a digital object for an AIP in the repository of the archival object and links it to the
+// archival object as a digital object instance. The repository settings provide the file URI base, publication
+// and default rights. Returns the URI of the digital object.
+func (c *Client) RegisterAIP(ctx context.Context, archivalObjectURI string, obj DigitalObject) (string, error) {
+	repoID, err := RepositoryID(archivalObjectURI)
+	if err != nil {
+		return "", err
+	}
+	repo := c.config.Repository(repoID)
+	if repo.Disabled {
+		logger.Info("ArchivesSpace repository %s disabled. Skipping digital object for %s", repoID, obj.Identifier)
+		return "", nil
+	}
+	if repo.FileURIBase != "" {
+		obj.FileURI = strings.TrimSuffix(repo.FileURIBase, "/") + "/" + strings.TrimPrefix(obj.FileURI, "/")
+	}
+	if obj.Rights == "" {
+		obj.Rights = repo.Rights
+	}
+
+	var doURI string
+	err = utils.WithRetry(func() error {
+		var err error
+		doURI, err = c.createDigitalObject(ctx, repoID, obj, repo.Publish)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	err = utils.WithRetry(func() error {
+		return c.linkDigitalObject(ctx, archivalObjectURI, doURI)
+	})
+	return doURI, err
+}
+
+// login opens a session with the configured user.
+func (c *Client) login(ctx context.Context) error {
+	loginURL := fmt.Sprintf("%s/users/%s/login", strings.TrimSuffix(c.config.URL, "/"), url.PathEscape(c.config.Username))
+	form := url.Values{"password": {c.config.Password}}
+	resp, err := c.httpClient.DoRequest(ctx, "POST", loginURL, strings.NewReader(form.Encode()), map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	})
+	if err != nil {
+		return fmt.Errorf("error logging in to ArchivesSpace: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		closeBody(resp)
+		return fmt.Errorf("failed to log in to ArchivesSpace: %s", resp.Status)
+	}
+	var session struct {
+		Session string `json:"session"`
+	}
+	if err := utils.ParseResponse(resp, &session); err != nil {
+		return fmt.Errorf("error parsing ArchivesSpace session: %w", err)
+	}
+	c.session = session.Session
+	return nil
+}
+
+// createDigitalObject creates a digital object in a repository and returns its URI.
+func (c *Client) createDigitalObject(ctx context.Context, repoID string, obj DigitalObject, publish bool) (string, error) {
+	fileVersion := map[string]any{
+		"jsonmodel_type": "file_version",
+		"file_uri":       obj.FileURI,
+		"use_statement":  "archive",
+		"publish":        publish,
+	}
+	if obj.Checksum != "" {
+		fileVersion["checksum"] = obj.Checksum
+		fileVersion["checksum_method"] = "sha-256"
+	}
+	record := map[string]any{
+		"jsonmodel_type":    "digital_object",
+		"title":             obj.Title,
+		"digital_object_id": obj.Identifier,
+		"publish":           publish,
+		"file_versions":     []any{fileVersion},
+	}
+	if obj.Rights != "" {
+		record["notes"] = []any{map[string]any{
+			"jsonmodel_type": "note_digital_object",
+			"type":           "userestrict",
+			"content":        []string{obj.Rights},
+			"publish":        publish,
+		}}
+	}
+
+	var created struct {
+		URI string `json:"uri"`
+	}
+	if err := c.post(ctx, fmt.Sprintf("/repositories/%s/digital_objects", repoID), record, &created); err != nil {
+		return "", fmt.Errorf("error creating digital object: %w", err)
+	}
+	return created.URI, nil
+}
+
+// linkDigitalObject adds a digital object instance to an archival object.
+func (c *Client) linkDigitalObject(ctx context.Context, archivalObjectURI, digitalObjectURI string) error {
+	var archivalObject map[string]any
+	if err := c.get(ctx, archivalObjectURI, &archivalObject); err != nil {
+		return fmt.Errorf("error getting archival object: %w", err)
+	}
+	instances, _ := archivalObject["instances"].([]any)
+	archivalObject["instances"] = append(instances, map[string]any{
+		"jsonmodel_type": "instance",
+		"instance_type":  "digital_object",
+		"digital_object": map[string]string{"ref": digitalObjectURI},
+	})
+	if err := c.post(ctx, archivalObjectURI, archivalObject, nil); err != nil {
+		return fmt.Errorf("error linking digital object to archival object: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, path string, target any) error {
+	resp, err := c.httpClient.DoRequest(ctx, "GET", strings.TrimSuffix(c.config.URL, "/")+path, nil, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		closeBody(resp)
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return utils.ParseResponse(resp, target)
+}
+
+func (c *Client) post(ctx context.Context, path string, body, target any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.DoRequest(ctx, "POST", strings.TrimSuffix(c.config.URL, "/")+path, bytes.NewReader(data), c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		closeBody(resp)
+		return fmt.Errorf("POST %s: %s", path, resp.Status)
+	}
+	if target == nil {
+		closeBody(resp)
+		return nil
+	}
+	return utils.ParseResponse(resp, target)
+}
+
+func (c *Client) headers() map[string]string {
+	return map[string]string{
+		"X-ArchivesSpace-Session": c.session,
+		"Content-Type":            "application/json",
+		"User-Agent":              "curate",
+	}
+}
+
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		logger.Error("Failed to close response body: %v", err)
+	}
+}
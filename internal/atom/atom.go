@@ -3,10 +3,10 @@ package atom
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/penwern/curate-preservation-core/pkg/config"
@@ -14,10 +14,35 @@ import (
 	"github.com/penwern/curate-preservation-core/pkg/utils"
 )
 
+const (
+	// importPollInterval is the interval between checks for the imported DIP.
+	importPollInterval = 10 * time.Second
+	// importTimeout is how long to wait for AtoM to import a deposited DIP.
+	importTimeout = 30 * time.Minute
+)
+
+// ErrDescriptionNotFound is returned when the target archival description does not exist in AtoM.
+var ErrDescriptionNotFound = errors.New("archival description not found")
+
+// Description is an AtoM archival description (information object).
+type Description struct {
+	Slug               string `json:"slug,omitempty"`
+	Title              string `json:"title,omitempty"`
+	ReferenceCode      string `json:"reference_code,omitempty"`
+	LevelOfDescription string `json:"level_of_description,omitempty"`
+}
+
+// treeNode is a node of the AtoM information object tree endpoint.
+type treeNode struct {
+	Slug     string     `json:"slug"`
+	Children []treeNode `json:"children"`
+}
+
 // Client represents an Atom client.
 type Client struct {
 	httpClient *utils.HTTPClient
 	config     *config.AtomConfig
+	retry      config.RetryPolicy // Retries of the deposit request on transient errors
 }
 
 // ClientInterface defines the interface for the Atom client.
@@ -27,8 +52,8 @@ type ClientInterface interface {
 	DepositDip()
 }
 
-// NewClient creates a new Atom client.
-func NewClient(config *config.AtomConfig) (*Client, error) {
+// NewClient creates a new Atom client. DIP deposits are retried on transient errors following the retry policy.
+func NewClient(config *config.AtomConfig, retry config.RetryPolicy) (*Client, error) {
 	// Validate the config
 	if config == nil {
 		return nil, fmt.Errorf("atom config cannot be nil")
@@ -43,6 +68,7 @@ func NewClient(config *config.AtomConfig) (*Client, error) {
 	return &Client{
 		httpClient: httpClient,
 		config:     config,
+		retry:      retry,
 	}, nil
 }
 
@@ -51,16 +77,148 @@ func (c *Client) Close() {
 	c.httpClient.Close()
 }
 
-// MigratePackage migrates a package to Atom using rsync
+// MigratePackage delivers a DIP to the AtoM server using the configured delivery method (rsync or SFTP).
+// The DIP only appears at its final location once it has been fully transferred and its checksums verified.
 func (c *Client) MigratePackage(ctx context.Context, dipPath string) error {
-	if err := utils.RsyncFile(ctx, dipPath, c.config.RsyncTarget, strings.Split(c.config.RsyncCommand, " ")); err != nil {
-		return fmt.Errorf("error during rsync: %w", err)
+	if c.config.DeliveryMethod == config.DeliverySFTP {
+		return c.deliverSFTP(ctx, dipPath)
+	}
+	return c.deliverRsync(ctx, dipPath)
+}
+
+// GetDescription returns the archival description with the given slug using the AtoM REST API.
+// Returns ErrDescriptionNotFound if the description does not exist.
+func (c *Client) GetDescription(ctx context.Context, slug string) (*Description, error) {
+	descURL := fmt.Sprintf("%s/api/informationobjects/%s", c.config.Host, url.PathEscape(slug))
+	resp, err := c.httpClient.DoRequest(ctx, "GET", descURL, nil, c.apiHeaders())
+	if err != nil {
+		return nil, fmt.Errorf("error getting description: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		closeBody(resp)
+		return nil, fmt.Errorf("%w: %s", ErrDescriptionNotFound, slug)
+	}
+	if resp.StatusCode != http.StatusOK {
+		closeBody(resp)
+		return nil, fmt.Errorf("failed to get description %s: %s", slug, resp.Status)
+	}
+	var desc Description
+	if err := utils.ParseResponse(resp, &desc); err != nil {
+		return nil, fmt.Errorf("error parsing description: %w", err)
+	}
+	if desc.Slug == "" {
+		desc.Slug = slug
+	}
+	return &desc, nil
+}
+
+// Ping checks that the AtoM REST API can be reached and accepts the API key, without retries.
+func (c *Client) Ping(ctx context.Context) error {
+	pingURL := fmt.Sprintf("%s/api/informationobjects?limit=1", c.config.Host)
+	resp, err := c.httpClient.DoRequest(ctx, "GET", pingURL, nil, c.apiHeaders())
+	if err != nil {
+		return fmt.Errorf("atom at %s not reachable: %w", c.config.Host, err)
+	}
+	closeBody(resp)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("atom at %s rejected the API key: %s", c.config.Host, resp.Status)
+	default:
+		return fmt.Errorf("atom at %s not usable: %s", c.config.Host, resp.Status)
+	}
+}
+
+// CountDescendants returns the number of descriptions below the archival description with the given slug.
+// Returns -1 if the AtoM instance does not provide the tree endpoint (AtoM < 2.4).
+func (c *Client) CountDescendants(ctx context.Context, slug string) (int, error) {
+	root, err := c.tree(ctx, slug)
+	if err != nil {
+		return 0, err
+	}
+	if root == nil {
+		return -1, nil
+	}
+	return countTree(root.Children), nil
+}
+
+// tree returns the description tree below the archival description with the given slug.
+// Returns nil if the AtoM instance does not provide the tree endpoint.
+func (c *Client) tree(ctx context.Context, slug string) (*treeNode, error) {
+	treeURL := fmt.Sprintf("%s/api/informationobjects/tree/%s", c.config.Host, url.PathEscape(slug))
+	resp, err := c.httpClient.DoRequest(ctx, "GET", treeURL, nil, c.apiHeaders())
+	if err != nil {
+		return nil, fmt.Errorf("error getting description tree: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		closeBody(resp)
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		closeBody(resp)
+		return nil, fmt.Errorf("failed to get description tree %s: %s", slug, resp.Status)
+	}
+	var root treeNode
+	if err := utils.ParseResponse(resp, &root); err != nil {
+		return nil, fmt.Errorf("error parsing description tree: %w", err)
 	}
-	return nil
+	return &root, nil
 }
 
-// DepositDip deposits a DIP to Atom using the Sword Depostit API endpoint.
+func countTree(nodes []treeNode) int {
+	n := len(nodes)
+	for _, node := range nodes {
+		n += countTree(node.Children)
+	}
+	return n
+}
+
+// DepositDip deposits a DIP to Atom using the Sword Deposit API endpoint.
+// The DIP must have been migrated to the AtoM server first, see MigratePackage.
+// Descriptive metadata is taken by AtoM from the dmdSec of the DIP METS, and the imported objects
+// are attached below the archival description identified by slug.
+// Transient failures are retried with exponential backoff.
 func (c *Client) DepositDip(ctx context.Context, slug, dipName string) error {
+	return utils.RetryContext(ctx, c.retry, func() error {
+		return c.depositDip(ctx, slug, dipName)
+	})
+}
+
+// WaitForImport polls AtoM until the number of descriptions below the target exceeds before,
+// meaning the deposited DIP has been imported. Returns the number of imported descriptions.
+// If before is negative, the import can't be tracked and WaitForImport returns immediately.
+func (c *Client) WaitForImport(ctx context.Context, slug string, before int) (int, error) {
+	if before < 0 {
+		logger.Warn("AtoM description tree endpoint not available. Skipping DIP import check for %s", slug)
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, importTimeout)
+	defer cancel()
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("timed out waiting for AtoM to import DIP into %s: %w", slug, ctx.Err())
+		case <-ticker.C:
+		}
+		count, err := c.CountDescendants(ctx, slug)
+		if err != nil {
+			if utils.IsTransientError(err) {
+				logger.Warn("Error checking AtoM DIP import, retrying: %v", err)
+				continue
+			}
+			return 0, err
+		}
+		if count > before {
+			return count - before, nil
+		}
+		logger.Debug("Waiting for AtoM to import DIP into %s", slug)
+	}
+}
+
+func (c *Client) depositDip(ctx context.Context, slug, dipName string) error {
 	depositURL := fmt.Sprintf("%s/sword/deposit/%s", c.config.Host, slug)
 	encodedString := fmt.Sprintf("file:///%s", url.QueryEscape(dipName))
 
@@ -68,24 +226,38 @@ func (c *Client) DepositDip(ctx context.Context, slug, dipName string) error {
 	token := utils.Base64Encode(auth)
 
 	headers := map[string]string{
-		"Authorization":    "Basic " + token,
-		"Content-Location": encodedString,
-		"X-Packaging":      "http://purl.org/net/sword-types/METSArchivematicaDIP",
-		"X-No-Op":          "false",
-		"User-Agent":       "curate",
-		"Content-Type":     "application/zip",
+		"Authorization":       "Basic " + token,
+		"Content-Location":    encodedString,
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", dipName),
+		"X-Packaging":         "http://purl.org/net/sword-types/METSArchivematicaDIP",
+		"X-No-Op":             "false",
+		"User-Agent":          "curate",
+		"Content-Type":        "application/zip",
 	}
 	resp, err := c.httpClient.DoRequest(ctx, "POST", depositURL, nil, headers)
 	if err != nil {
 		return fmt.Errorf("error during deposit: %w", err)
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			logger.Error("Failed to close response body: %v", err)
-		}
-	}()
-	if resp.StatusCode != http.StatusOK {
+	defer closeBody(resp)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted:
+		return nil
+	default:
 		return fmt.Errorf("failed to deposit DIP: %s", resp.Status)
 	}
-	return nil
+}
+
+// apiHeaders returns the headers for AtoM REST API requests.
+func (c *Client) apiHeaders() map[string]string {
+	return map[string]string{
+		"REST-API-Key": c.config.APIKey,
+		"Accept":       "application/json",
+		"User-Agent":   "curate",
+	}
+}
+
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		logger.Error("Failed to close response body: %v", err)
+	}
 }
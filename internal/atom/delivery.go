@@ -0,0 +1,305 @@
+package atom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// partialPrefix prefixes the temporary name of a DIP while it is uploaded,
+// so the AtoM uploads watcher never picks up an incomplete DIP.
+const partialPrefix = ".partial-"
+
+// sftpDialTimeout is the timeout for establishing the SFTP connection.
+const sftpDialTimeout = 30 * time.Second
+
+// deliverRsync copies the DIP to the rsync target and verifies the copy by checksum.
+// Local targets are uploaded under a temporary name and renamed once verified.
+// Remote targets use --delay-updates, so files only appear once all of them are transferred.
+func (c *Client) deliverRsync(ctx context.Context, dipPath string) error {
+	args := strings.Fields(c.config.RsyncCommand)
+	if len(args) > 0 && args[0] == "rsync" {
+		args = args[1:]
+	}
+	target := c.config.RsyncTarget
+	if isRemoteRsyncTarget(target) {
+		args = append(args, "--delay-updates")
+		if err := utils.RsyncFile(ctx, dipPath, target, args); err != nil {
+			return fmt.Errorf("error during rsync: %w", err)
+		}
+		return verifyRsync(ctx, dipPath, target, args)
+	}
+
+	// Upload into a staging directory next to the final location, so the rename is atomic
+	staging := filepath.Join(target, partialPrefix+filepath.Base(dipPath))
+	if err := utils.CreateDir(staging); err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(staging); err != nil {
+			logger.Error("Failed to remove DIP staging directory: %v", err)
+		}
+	}()
+	if err := utils.RsyncFile(ctx, dipPath, staging, args); err != nil {
+		return fmt.Errorf("error during rsync: %w", err)
+	}
+	if err := verifyRsync(ctx, dipPath, staging, args); err != nil {
+		return err
+	}
+	dest := filepath.Join(target, filepath.Base(dipPath))
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("DIP already exists at target: %s", dest)
+	}
+	if err := os.Rename(filepath.Join(staging, filepath.Base(dipPath)), dest); err != nil {
+		return fmt.Errorf("error moving DIP into place: %w", err)
+	}
+	return nil
+}
+
+// isRemoteRsyncTarget reports whether an rsync target refers to a remote host (host:path or rsync://).
+func isRemoteRsyncTarget(target string) bool {
+	if strings.HasPrefix(target, "rsync://") {
+		return true
+	}
+	colon := strings.Index(target, ":")
+	return colon > 0 && !strings.Contains(target[:colon], "/")
+}
+
+func verifyRsync(ctx context.Context, dipPath, target string, args []string) error {
+	changed, err := utils.RsyncVerify(ctx, dipPath, target, args)
+	if err != nil {
+		return fmt.Errorf("error verifying DIP transfer: %w", err)
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("DIP checksum verification failed for %d files: %s", len(changed), strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// deliverSFTP uploads the DIP to the SFTP remote directory under a temporary name,
+// verifies the SHA-256 checksum of every uploaded file and then renames it into place.
+func (c *Client) deliverSFTP(ctx context.Context, dipPath string) error {
+	sshClient, err := dialSSH(ctx, c.config.SFTP)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := sshClient.Close(); err != nil {
+			logger.Error("Failed to close SSH connection: %v", err)
+		}
+	}()
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		return fmt.Errorf("error creating SFTP client: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logger.Error("Failed to close SFTP client: %v", err)
+		}
+	}()
+
+	name := filepath.Base(dipPath)
+	remoteDir := c.config.SFTP.RemoteDir
+	dest := path.Join(remoteDir, name)
+	if _, err := client.Stat(dest); err == nil {
+		return fmt.Errorf("DIP already exists at target: %s", dest)
+	}
+	partial := path.Join(remoteDir, partialPrefix+name)
+	if err := client.RemoveAll(partial); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing previous partial upload: %w", err)
+	}
+
+	checksums, err := uploadDir(ctx, client, dipPath, partial)
+	if err != nil {
+		if removeErr := client.RemoveAll(partial); removeErr != nil {
+			logger.Error("Failed to remove partial DIP upload: %v", removeErr)
+		}
+		return err
+	}
+	if err := verifyUpload(ctx, client, partial, checksums); err != nil {
+		if removeErr := client.RemoveAll(partial); removeErr != nil {
+			logger.Error("Failed to remove partial DIP upload: %v", removeErr)
+		}
+		return err
+	}
+	if err := client.Rename(partial, dest); err != nil {
+		return fmt.Errorf("error moving DIP into place: %w", err)
+	}
+	return nil
+}
+
+// dialSSH connects to the SFTP server with the configured credentials.
+func dialSSH(ctx context.Context, cfg *config.SFTPConfig) (*ssh.Client, error) {
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKeyPath != "" {
+		key, err := os.ReadFile(filepath.Clean(cfg.PrivateKeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("error reading SSH private key: %w", err)
+		}
+		var signer ssh.Signer
+		if cfg.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(cfg.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing SSH private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if cfg.InsecureIgnoreHostKey {
+		logger.Warn("SFTP host key verification disabled for %s", cfg.Address)
+		// #nosec G106 -- host key verification is only skipped when explicitly configured
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		var err error
+		hostKeyCallback, err = knownhosts.New(filepath.Clean(cfg.KnownHostsPath))
+		if err != nil {
+			return nil, fmt.Errorf("error reading known hosts: %w", err)
+		}
+	}
+
+	dialer := net.Dialer{Timeout: sftpDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to SFTP server: %w", err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, cfg.Address, &ssh.ClientConfig{
+		User:            cfg.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		if closeErr := conn.Close(); closeErr != nil {
+			logger.Error("Failed to close connection: %v", closeErr)
+		}
+		return nil, fmt.Errorf("error establishing SSH connection: %w", err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// uploadDir uploads the contents of a local directory to a remote directory.
+// Returns the SHA-256 checksum of every uploaded file by slash separated relative path.
+func uploadDir(ctx context.Context, client *sftp.Client, localDir, remoteDir string) (map[string]string, error) {
+	checksums := map[string]string{}
+	err := filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		remote := path.Join(remoteDir, filepath.ToSlash(rel))
+		if d.IsDir() {
+			return client.MkdirAll(remote)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		checksum, err := uploadFile(client, p, remote)
+		if err != nil {
+			return fmt.Errorf("error uploading %s: %w", rel, err)
+		}
+		checksums[filepath.ToSlash(rel)] = checksum
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error uploading DIP: %w", err)
+	}
+	return checksums, nil
+}
+
+// uploadFile uploads a file and returns its SHA-256 checksum.
+func uploadFile(client *sftp.Client, localPath, remotePath string) (string, error) {
+	src, err := os.Open(filepath.Clean(localPath))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+	dst, err := client.Create(remotePath)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(dst, io.TeeReader(src, hash)); err != nil {
+		_ = dst.Close()
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyUpload reads back every uploaded file and compares its SHA-256 checksum to the local one.
+func verifyUpload(ctx context.Context, client *sftp.Client, remoteDir string, checksums map[string]string) error {
+	var mismatched []string
+	for rel, expected := range checksums {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		actual, err := remoteChecksum(client, path.Join(remoteDir, rel))
+		if err != nil {
+			return fmt.Errorf("error verifying %s: %w", rel, err)
+		}
+		if actual != expected {
+			mismatched = append(mismatched, rel)
+		}
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("DIP checksum verification failed for %d files: %s", len(mismatched), strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+func remoteChecksum(client *sftp.Client, remotePath string) (string, error) {
+	file, err := client.Open(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("Failed to close remote file: %v", err)
+		}
+	}()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,225 @@
+package atom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// defaultLevelOfDescription is used for created descriptions without an ISAD(G) level of description.
+const defaultLevelOfDescription = "File"
+
+// DescriptionFields are the fields of an archival description written through the AtoM REST API.
+type DescriptionFields struct {
+	Title                        string            `json:"title,omitempty"`
+	Identifier                   string            `json:"identifier,omitempty"`
+	LevelOfDescription           string            `json:"level_of_description,omitempty"`
+	ParentSlug                   string            `json:"parent_slug,omitempty"`
+	Dates                        []DescriptionDate `json:"dates,omitempty"`
+	ExtentAndMedium              string            `json:"extent_and_medium,omitempty"`
+	ArchivalHistory              string            `json:"archival_history,omitempty"`
+	Acquisition                  string            `json:"acquisition,omitempty"`
+	ScopeAndContent              string            `json:"scope_and_content,omitempty"`
+	Appraisal                    string            `json:"appraisal,omitempty"`
+	Accruals                     string            `json:"accruals,omitempty"`
+	Arrangement                  string            `json:"arrangement,omitempty"`
+	AccessConditions             string            `json:"access_conditions,omitempty"`
+	ReproductionConditions       string            `json:"reproduction_conditions,omitempty"`
+	PhysicalCharacteristics      string            `json:"physical_characteristics,omitempty"`
+	FindingAids                  string            `json:"finding_aids,omitempty"`
+	LocationOfOriginals          string            `json:"location_of_originals,omitempty"`
+	LocationOfCopies             string            `json:"location_of_copies,omitempty"`
+	RelatedUnitsOfDescription    string            `json:"related_units_of_description,omitempty"`
+	Rules                        string            `json:"rules,omitempty"`
+	RevisionHistory              string            `json:"revision_history,omitempty"`
+	ArchivistNote                string            `json:"archivists_notes,omitempty"`
+	GeneralNote                  string            `json:"general_note,omitempty"`
+	AlternativeIdentifiers       string            `json:"alternative_identifiers,omitempty"`
+	CreatorHistory               string            `json:"creator_history,omitempty"`
+	CreatorName                  string            `json:"creator,omitempty"`
+	PublicationNote              string            `json:"publication_note,omitempty"`
+	LanguageAndScriptsOfMaterial string            `json:"language_and_scripts_of_material,omitempty"`
+}
+
+// DescriptionDate is an event date of an archival description.
+type DescriptionDate struct {
+	Date string `json:"date"`
+	Type string `json:"type"`
+}
+
+// DescriptionFieldsFromMetadata maps package metadata (Dublin Core and ISAD(G), keyed as in metadata.json) to
+// description fields. ISAD(G) elements take priority over their Dublin Core equivalents.
+func DescriptionFieldsFromMetadata(metadata map[string]string) DescriptionFields {
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if v := metadata[key]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	fields := DescriptionFields{
+		Title:                        first("isadg.title", "dc.title"),
+		Identifier:                   first("dc.identifier"),
+		LevelOfDescription:           first("isadg.level-of-description"),
+		ExtentAndMedium:              first("isadg.extent-and-medium-of-the-unit-of-description", "dc.format"),
+		ArchivalHistory:              first("isadg.archival-history"),
+		Acquisition:                  first("isadg.immediate-source-of-acquisition-or-transfer", "dc.source"),
+		ScopeAndContent:              first("isadg.scope-and-content", "dc.description"),
+		Appraisal:                    first("isadg.appraisal-destruction-and-scheduling-information"),
+		Accruals:                     first("isadg.accruals"),
+		Arrangement:                  first("isadg.system-of-arrangement"),
+		AccessConditions:             first("isadg.conditions-governing-access"),
+		ReproductionConditions:       first("isadg.conditions-governing-reproduction", "dc.rights"),
+		PhysicalCharacteristics:      first("isadg.physical-characteristics-and-technical-requirements"),
+		FindingAids:                  first("isadg.finding-aids"),
+		LocationOfOriginals:          first("isadg.existence-and-location-of-originals"),
+		LocationOfCopies:             first("isadg.existence-and-location-of-copies"),
+		RelatedUnitsOfDescription:    first("isadg.related-units-of-description", "dc.relation"),
+		Rules:                        first("isadg.rules-or-conventions"),
+		RevisionHistory:              first("isadg.dates-of-descriptions"),
+		ArchivistNote:                first("isadg.archivists-note"),
+		GeneralNote:                  first("isadg.note"),
+		AlternativeIdentifiers:       first("isadg.alternative-identifiers"),
+		CreatorHistory:               first("isadg.administrativebiographical-history"),
+		CreatorName:                  first("isadg.name-of-creators", "dc.creator"),
+		PublicationNote:              first("isadg.publication-note"),
+		LanguageAndScriptsOfMaterial: first("isadg.languagescripts-of-material", "dc.language"),
+	}
+	if date := first("isadg.date", "dc.date"); date != "" {
+		fields.Dates = []DescriptionDate{{Date: date, Type: "Creation"}}
+	}
+	return fields
+}
+
+// Describe writes the package description to AtoM according to the description mode and
+// returns the slug of the description the DIP should be deposited under.
+//   - create: a child of the target description is created, or updated if a child with the same identifier exists.
+//     If the package has no title, defaultTitle is used.
+//   - update: the target description is updated.
+func (c *Client) Describe(ctx context.Context, mode, targetSlug, defaultTitle string, fields DescriptionFields) (string, error) {
+	switch mode {
+	case config.DescriptionModeCreate:
+		if fields.Title == "" {
+			fields.Title = defaultTitle
+		}
+		if fields.LevelOfDescription == "" {
+			fields.LevelOfDescription = defaultLevelOfDescription
+		}
+		existing, err := c.findChild(ctx, targetSlug, fields.Identifier)
+		if err != nil {
+			return "", err
+		}
+		if existing != "" {
+			logger.Info("Updating AtoM description %s below %s", existing, targetSlug)
+			return existing, c.UpdateDescription(ctx, existing, fields)
+		}
+		fields.ParentSlug = targetSlug
+		slug, err := c.CreateDescription(ctx, fields)
+		if err != nil {
+			return "", err
+		}
+		logger.Info("Created AtoM description %s below %s", slug, targetSlug)
+		return slug, nil
+	case config.DescriptionModeUpdate:
+		// Never move or rename the target from package metadata
+		fields.ParentSlug = ""
+		fields.Title = ""
+		fields.Identifier = ""
+		return targetSlug, c.UpdateDescription(ctx, targetSlug, fields)
+	default:
+		return targetSlug, nil
+	}
+}
+
+// CreateDescription creates an archival description and returns its slug.
+func (c *Client) CreateDescription(ctx context.Context, fields DescriptionFields) (string, error) {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling description: %w", err)
+	}
+	createURL := fmt.Sprintf("%s/api/informationobjects", c.config.Host)
+	resp, err := c.httpClient.DoRequest(ctx, "POST", createURL, bytes.NewReader(body), c.apiWriteHeaders())
+	if err != nil {
+		return "", fmt.Errorf("error creating description: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		closeBody(resp)
+		return "", fmt.Errorf("failed to create description: %s", resp.Status)
+	}
+	var created struct {
+		Slug string `json:"slug"`
+	}
+	if err := utils.ParseResponse(resp, &created); err != nil {
+		return "", fmt.Errorf("error parsing created description: %w", err)
+	}
+	if created.Slug == "" {
+		return "", fmt.Errorf("AtoM did not return the slug of the created description")
+	}
+	return created.Slug, nil
+}
+
+// UpdateDescription updates the non-empty fields of an archival description.
+func (c *Client) UpdateDescription(ctx context.Context, slug string, fields DescriptionFields) error {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("error marshaling description: %w", err)
+	}
+	updateURL := fmt.Sprintf("%s/api/informationobjects/%s", c.config.Host, url.PathEscape(slug))
+	resp, err := c.httpClient.DoRequest(ctx, "PUT", updateURL, bytes.NewReader(body), c.apiWriteHeaders())
+	if err != nil {
+		return fmt.Errorf("error updating description: %w", err)
+	}
+	defer closeBody(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrDescriptionNotFound, slug)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to update description %s: %s", slug, resp.Status)
+	}
+	return nil
+}
+
+// findChild returns the slug of the direct child of parentSlug with the given identifier, if any.
+func (c *Client) findChild(ctx context.Context, parentSlug, identifier string) (string, error) {
+	if identifier == "" {
+		return "", nil
+	}
+	results, err := c.SearchDescriptions(ctx, SearchFieldIdentifier, identifier)
+	if err != nil {
+		return "", err
+	}
+	candidates := map[string]bool{}
+	for _, desc := range results {
+		if exactMatch(SearchFieldIdentifier, identifier, desc) {
+			candidates[desc.Slug] = true
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	tree, err := c.tree(ctx, parentSlug)
+	if err != nil || tree == nil {
+		return "", err
+	}
+	for _, child := range tree.Children {
+		if candidates[child.Slug] {
+			return child.Slug, nil
+		}
+	}
+	return "", nil
+}
+
+// apiWriteHeaders returns the headers for AtoM REST API requests with a JSON body.
+func (c *Client) apiWriteHeaders() map[string]string {
+	headers := c.apiHeaders()
+	headers["Content-Type"] = "application/json"
+	return headers
+}
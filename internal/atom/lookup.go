@@ -0,0 +1,174 @@
+package atom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Search fields supported by SearchDescriptions.
+const (
+	SearchFieldIdentifier = "identifier"
+	SearchFieldTitle      = "title"
+)
+
+// slugCacheTTL is how long resolved slugs are cached.
+const slugCacheTTL = time.Hour
+
+// searchLimit is the maximum number of descriptions returned by a search.
+const searchLimit = 20
+
+// AmbiguousMatchError is returned when a reference matches several archival descriptions.
+// The candidates are surfaced so the user can pick the right slug.
+type AmbiguousMatchError struct {
+	Reference string
+	Matches   []Description
+}
+
+func (e *AmbiguousMatchError) Error() string {
+	slugs := make([]string, 0, len(e.Matches))
+	for _, match := range e.Matches {
+		slugs = append(slugs, match.Slug)
+	}
+	return fmt.Sprintf("ambiguous AtoM description %q, matches: %s", e.Reference, strings.Join(slugs, ", "))
+}
+
+// searchResponse is the response of the AtoM information object browse endpoint.
+type searchResponse struct {
+	Total   int           `json:"total"`
+	Results []Description `json:"results"`
+}
+
+// slugCache caches resolved slugs by AtoM host and reference, shared by all clients.
+var slugCache = struct {
+	sync.Mutex
+	entries map[string]slugCacheEntry
+}{entries: map[string]slugCacheEntry{}}
+
+type slugCacheEntry struct {
+	slug    string
+	expires time.Time
+}
+
+// NewAPIClient creates an AtoM client for the REST API only (description lookups).
+// Unlike NewClient, it only requires the host and API key to be set.
+func NewAPIClient(config *config.AtomConfig) (*Client, error) {
+	if config == nil {
+		return nil, fmt.Errorf("atom config cannot be nil")
+	}
+	config = config.Clone()
+	if config.Host == "" || config.APIKey == "" {
+		return nil, fmt.Errorf("invalid atom config: host and api_key are required")
+	}
+	return &Client{
+		httpClient: utils.NewHTTPClient(5*time.Second, true),
+		config:     config,
+	}, nil
+}
+
+// SearchDescriptions searches archival descriptions by identifier or title using the AtoM REST API.
+func (c *Client) SearchDescriptions(ctx context.Context, field, query string) ([]Description, error) {
+	if field != SearchFieldIdentifier && field != SearchFieldTitle {
+		return nil, fmt.Errorf("unsupported search field: %s", field)
+	}
+	params := url.Values{}
+	params.Set("sq0", query)
+	params.Set("sf0", field)
+	params.Set("limit", fmt.Sprint(searchLimit))
+	searchURL := fmt.Sprintf("%s/api/informationobjects?%s", c.config.Host, params.Encode())
+	resp, err := c.httpClient.DoRequest(ctx, "GET", searchURL, nil, c.apiHeaders())
+	if err != nil {
+		return nil, fmt.Errorf("error searching descriptions: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		closeBody(resp)
+		return nil, fmt.Errorf("failed to search descriptions: %s", resp.Status)
+	}
+	var result searchResponse
+	if err := utils.ParseResponse(resp, &result); err != nil {
+		return nil, fmt.Errorf("error parsing search results: %w", err)
+	}
+	return result.Results, nil
+}
+
+// ResolveSlug resolves a reference to the slug of an archival description.
+// The reference is tried as a slug, then as an exact identifier (or reference code) and finally as an exact title.
+// Returns an *AmbiguousMatchError if several descriptions match and ErrDescriptionNotFound if none do.
+// Resolved slugs are cached.
+func (c *Client) ResolveSlug(ctx context.Context, ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", fmt.Errorf("empty AtoM description reference")
+	}
+	key := c.config.Host + "\x00" + ref
+	slugCache.Lock()
+	entry, ok := slugCache.entries[key]
+	slugCache.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.slug, nil
+	}
+
+	slug, err := c.resolveSlug(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if slug != ref {
+		logger.Info("Resolved AtoM description %q to slug: %s", ref, slug)
+	}
+	slugCache.Lock()
+	slugCache.entries[key] = slugCacheEntry{slug: slug, expires: time.Now().Add(slugCacheTTL)}
+	slugCache.Unlock()
+	return slug, nil
+}
+
+func (c *Client) resolveSlug(ctx context.Context, ref string) (string, error) {
+	if _, err := c.GetDescription(ctx, ref); err == nil {
+		return ref, nil
+	} else if !errors.Is(err, ErrDescriptionNotFound) {
+		return "", err
+	}
+
+	for _, field := range []string{SearchFieldIdentifier, SearchFieldTitle} {
+		results, err := c.SearchDescriptions(ctx, field, ref)
+		if err != nil {
+			return "", err
+		}
+		var matches []Description
+		for _, desc := range results {
+			if exactMatch(field, ref, desc) {
+				matches = append(matches, desc)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0].Slug, nil
+		default:
+			return "", &AmbiguousMatchError{Reference: ref, Matches: matches}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrDescriptionNotFound, ref)
+}
+
+// exactMatch reports whether a search result matches the reference exactly, ignoring case.
+// Identifiers are matched against the full reference code and its last segment.
+func exactMatch(field, ref string, desc Description) bool {
+	if field == SearchFieldTitle {
+		return strings.EqualFold(desc.Title, ref)
+	}
+	if strings.EqualFold(desc.ReferenceCode, ref) {
+		return true
+	}
+	segments := strings.Split(desc.ReferenceCode, "-")
+	return strings.EqualFold(strings.TrimSpace(segments[len(segments)-1]), ref)
+}
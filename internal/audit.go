@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/audit"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// defaultAuditLimit is the number of audit entries listed when no limit is given.
+const defaultAuditLimit = 100
+
+// Auditor records the actions taken through the API in the audit log: changes, denied requests and, if configured,
+// reads. A nil Auditor records nothing.
+type Auditor struct {
+	log     *audit.Log
+	reads   bool           // Record every read, not only the reads of audited routes
+	proxies trustedProxies // Proxies whose X-Forwarded-For header gives the client address
+}
+
+// NewAuditor creates the auditor writing to an audit log. Returns nil if the log is nil.
+func NewAuditor(log *audit.Log, cfg *config.Config) (*Auditor, error) {
+	if log == nil {
+		return nil, nil
+	}
+	proxies, err := parseTrustedProxies(cfg.RateLimit.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &Auditor{log: log, reads: cfg.Audit.Reads, proxies: proxies}, nil
+}
+
+// auditedRequest is the user of an audited request, noted by the authenticator.
+type auditedRequest struct {
+	principal *Principal
+}
+
+type auditedRequestKey struct{}
+
+// noteAuditPrincipal notes the user of an audited request once its token is verified, so that the requests they are
+// denied are recorded with their user.
+func noteAuditPrincipal(ctx context.Context, principal *Principal) {
+	if req, ok := ctx.Value(auditedRequestKey{}).(*auditedRequest); ok {
+		req.principal = principal
+	}
+}
+
+// Audit wraps the handler of a route, before authentication, so that its requests are recorded with their user and
+// the status of their response. Reads are only recorded if they are denied, unless every read or the reads of the
+// route are audited.
+func (a *Auditor) Audit(route *apiRoute, next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		req := &auditedRequest{}
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r.WithContext(context.WithValue(r.Context(), auditedRequestKey{}, req)))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		outcome := audit.OutcomeOf(status)
+		read := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if read && outcome != audit.OutcomeDenied && !a.reads && !route.Audited {
+			return
+		}
+		entry := &audit.Entry{
+			Time:       started.UTC(),
+			Action:     route.Operation,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Address:    a.proxies.clientAddr(r),
+			UserAgent:  r.UserAgent(),
+			Status:     status,
+			Outcome:    outcome,
+			DurationMs: time.Since(started).Milliseconds(),
+		}
+		if principal := req.principal; principal != nil {
+			entry.Subject = principal.Subject
+			entry.Username = principal.Username
+			entry.Role = principal.Role
+			entry.Tenant = principal.Tenant
+		}
+		if err := a.log.Record(entry); err != nil {
+			logger.Error("Failed to record %s %s by %s in the audit log: %v", r.Method, r.URL.Path, entry.Username, err)
+		}
+	}
+}
+
+// statusRecorder records the status of a response. Flushes and the other controls of the response reach the
+// wrapped writer through Unwrap.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AuditLogHandler responds with the most recent entries of the audit log, most recent first, filtered with the
+// since and until (RFC 3339), username, action and outcome query parameters, up to the limit parameter.
+func AuditLogHandler(log *audit.Log) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if log == nil {
+			http.Error(w, "audit log is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		query := r.URL.Query()
+		filter, err := parseAuditFilter(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := defaultAuditLimit
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", value), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		entries, err := log.Recent(filter, limit)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to read the audit log: %v", err))
+			http.Error(w, "failed to read audit log", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, entries)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// ExportAuditLogHandler exports the entries of the audit log, oldest first, as JSON lines or as CSV with the format
+// query parameter. Entries are filtered like in AuditLogHandler.
+func ExportAuditLogHandler(log *audit.Log) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if log == nil {
+			http.Error(w, "audit log is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		query := r.URL.Query()
+		filter, err := parseAuditFilter(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format := query.Get("format")
+		contentType := "application/x-ndjson"
+		switch format {
+		case "", audit.FormatJSONLines:
+			format = audit.FormatJSONLines
+		case audit.FormatCSV:
+			contentType = "text/csv; charset=utf-8"
+		default:
+			http.Error(w, audit.ErrInvalidFormat.Error(), http.StatusBadRequest)
+			return
+		}
+		filename := "audit-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// The status is sent with the first entries, later errors can only cut the export short
+		if err := log.Export(w, filter, format); err != nil {
+			logger.Error(fmt.Sprintf("Failed to export the audit log: %v", err))
+		}
+	}
+	return recoveryMiddleware(handler)
+}
+
+// parseAuditFilter parses the since, until, username, action and outcome query parameters of the audit endpoints.
+func parseAuditFilter(query url.Values) (audit.Filter, error) {
+	filter := audit.Filter{
+		Username: query.Get("username"),
+		Action:   query.Get("action"),
+		Outcome:  query.Get("outcome"),
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s parameter, expected RFC 3339 timestamp", name)
+			}
+			*t = parsed
+		}
+	}
+	return filter, nil
+}
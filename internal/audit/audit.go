@@ -0,0 +1,342 @@
+// Package audit keeps an append-only log of the actions taken through the HTTP API: who took them, when, from which
+// address and with which outcome. Entries are appended as JSON lines to a file per UTC day, so that whole days can
+// be shipped to an archive or a SIEM and removed once past their retention. Entries are never modified.
+package audit
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	filePrefix = "audit-"
+	fileSuffix = ".jsonl"
+	dayLayout  = time.DateOnly
+	// maxEntrySize bounds the lines read back, entries are far smaller
+	maxEntrySize = 1 << 20
+)
+
+// Outcomes of the actions.
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"  // Not authenticated, or not authorized
+	OutcomeFailure = "failure" // Refused or failed, e.g. an invalid request
+)
+
+// Export formats.
+const (
+	FormatJSONLines = "jsonl"
+	FormatCSV       = "csv"
+)
+
+// ErrInvalidFormat is returned when an export format is not supported.
+var ErrInvalidFormat = errors.New("invalid format: jsonl or csv")
+
+// Entry is an action taken through the API.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"` // Operation of the API, e.g. cancelJob
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Subject    string    `json:"subject,omitempty"` // Authenticated user, e.g. apikey:<id>, empty if not authenticated
+	Username   string    `json:"username,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Address    string    `json:"address"` // Client address, read from X-Forwarded-For behind trusted proxies
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Status     int       `json:"status"` // HTTP status of the response
+	Outcome    string    `json:"outcome"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// csvHeader are the columns of the CSV exports.
+var csvHeader = []string{
+	"time", "action", "method", "path", "subject", "username", "role", "tenant", "address", "user_agent", "status",
+	"outcome", "duration_ms",
+}
+
+// OutcomeOf returns the outcome of an action from the status of its response.
+func OutcomeOf(status int) string {
+	switch {
+	case status == 401 || status == 403:
+		return OutcomeDenied
+	case status >= 400:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// Filter selects entries. Empty fields match every entry.
+type Filter struct {
+	Since    time.Time
+	Until    time.Time
+	Username string
+	Action   string
+	Outcome  string
+}
+
+func (f *Filter) matches(entry *Entry) bool {
+	return (f.Since.IsZero() || !entry.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || entry.Time.Before(f.Until)) &&
+		(f.Username == "" || entry.Username == f.Username) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.Outcome == "" || entry.Outcome == f.Outcome)
+}
+
+// Log appends entries to the daily files of a directory. Files of the days past the retention are removed when the
+// log is opened and when a day starts. The log is safe for concurrent use; instances sharing the directory append
+// whole lines to the same files.
+type Log struct {
+	dir       string
+	retention int // Days the files are kept, 0 to keep them forever
+
+	mu   sync.Mutex
+	day  string
+	file *os.File
+}
+
+// Open opens the audit log, in <DataDir>/audit unless a directory is configured, and removes the files past their
+// retention.
+func Open(cfg *config.Config) (*Log, error) {
+	dir := cfg.Audit.Dir
+	if dir == "" {
+		if cfg.DataDir == "" {
+			return nil, fmt.Errorf("no directory or data directory set for the audit log")
+		}
+		dir = filepath.Join(cfg.DataDir, "audit")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating audit log directory: %w", err)
+	}
+	l := &Log{dir: dir, retention: cfg.Audit.RetentionDays}
+	if _, err := l.Prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Dir returns the directory of the log files.
+func (l *Log) Dir() string {
+	return l.dir
+}
+
+// Record appends an entry to the file of its day.
+func (l *Log) Record(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding audit entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	day := entry.Time.UTC().Format(dayLayout)
+	if l.file == nil || day != l.day {
+		if err := l.openDay(day); err != nil {
+			return err
+		}
+	}
+	// A single write per entry, so that the lines of concurrent writers are not interleaved
+	if _, err := l.file.Write(data); err != nil {
+		return fmt.Errorf("error writing audit entry: %w", err)
+	}
+	return nil
+}
+
+// openDay switches to the file of a day, removing the files past their retention when the day starts.
+func (l *Log) openDay(day string) error {
+	if l.file != nil {
+		_ = l.file.Close()
+		l.file = nil
+	}
+	starting := l.day != ""
+	// #nosec G304 -- The path is built from the configured directory and a date
+	file, err := os.OpenFile(filepath.Join(l.dir, filePrefix+day+fileSuffix), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	l.file, l.day = file, day
+	if starting {
+		if _, err := l.Prune(time.Now()); err != nil {
+			logger.Warn("Error removing expired audit log files: %v", err)
+		}
+	}
+	return nil
+}
+
+// Prune removes the files of the days past the retention, and returns the number removed.
+func (l *Log) Prune(now time.Time) (int, error) {
+	if l.retention <= 0 {
+		return 0, nil
+	}
+	days, err := l.days()
+	if err != nil {
+		return 0, err
+	}
+	oldest := now.UTC().AddDate(0, 0, -l.retention).Format(dayLayout)
+	removed := 0
+	for _, day := range days {
+		if day >= oldest {
+			break
+		}
+		if err := os.Remove(filepath.Join(l.dir, filePrefix+day+fileSuffix)); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("error removing audit log of %s: %w", day, err)
+		}
+		removed++
+	}
+	if removed > 0 {
+		logger.Info("Removed %d audit log files older than %d days", removed, l.retention)
+	}
+	return removed, nil
+}
+
+// days returns the days of the log files, oldest first.
+func (l *Log) days() ([]string, error) {
+	dirEntries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit log directory: %w", err)
+	}
+	var days []string
+	for _, dirEntry := range dirEntries {
+		day, ok := strings.CutPrefix(dirEntry.Name(), filePrefix)
+		if !ok || dirEntry.IsDir() {
+			continue
+		}
+		if day, ok = strings.CutSuffix(day, fileSuffix); !ok {
+			continue
+		}
+		if _, err := time.Parse(dayLayout, day); err == nil {
+			days = append(days, day)
+		}
+	}
+	slices.Sort(days)
+	return days, nil
+}
+
+// Each calls fn with the entries matching a filter, oldest first, until fn returns an error.
+func (l *Log) Each(filter Filter, fn func(*Entry) error) error {
+	days, err := l.days()
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if !filter.Since.IsZero() && day < filter.Since.UTC().Format(dayLayout) {
+			continue
+		}
+		if !filter.Until.IsZero() && day > filter.Until.UTC().Format(dayLayout) {
+			break
+		}
+		if err := l.eachOfDay(day, &filter, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachOfDay calls fn with the matching entries of a day. Lines that cannot be read, e.g. cut short by a crash, are
+// skipped.
+func (l *Log) eachOfDay(day string, filter *Filter, fn func(*Entry) error) error {
+	path := filepath.Join(l.dir, filePrefix+day+fileSuffix)
+	// #nosec G304 -- The path is built from the configured directory and a date
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error opening audit log of %s: %w", day, err)
+	}
+	defer func() { _ = file.Close() }()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), maxEntrySize)
+	for line := 1; scanner.Scan(); line++ {
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			logger.Warn("Skipping line %d of audit log %s: %v", line, path, err)
+			continue
+		}
+		if !filter.matches(entry) {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading audit log of %s: %w", day, err)
+	}
+	return nil
+}
+
+// Recent returns the most recent entries matching a filter, most recent first. A limit of 0 returns every entry.
+func (l *Log) Recent(filter Filter, limit int) ([]Entry, error) {
+	entries := []Entry{}
+	err := l.Each(filter, func(entry *Entry) error {
+		if limit > 0 && len(entries) == limit {
+			entries = entries[1:]
+		}
+		entries = append(entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// Export writes the entries matching a filter, oldest first, as JSON lines or CSV.
+func (l *Log) Export(w io.Writer, filter Filter, format string) error {
+	switch format {
+	case FormatJSONLines, "":
+		enc := json.NewEncoder(w)
+		return l.Each(filter, func(entry *Entry) error {
+			return enc.Encode(entry)
+		})
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		err := l.Each(filter, func(entry *Entry) error {
+			return cw.Write([]string{
+				entry.Time.Format(time.RFC3339Nano), entry.Action, entry.Method, entry.Path, entry.Subject,
+				entry.Username, entry.Role, entry.Tenant, entry.Address, entry.UserAgent, strconv.Itoa(entry.Status),
+				entry.Outcome, strconv.FormatInt(entry.DurationMs, 10),
+			})
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return ErrInvalidFormat
+	}
+}
+
+// Close closes the file of the current day.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
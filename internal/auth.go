@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+
+	"github.com/penwern/curate-preservation-core/internal/apikeys"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// errNoTenant is returned for the tokens of users without a tenant claim, when there are tenants and their roles
+// don't grant the whole service.
+var errNoTenant = errors.New("no tenant claim")
+
+// Principal is the authenticated user of a request.
+type Principal struct {
+	Subject  string
+	Username string
+	Role     string
+	Tenant   string // Tenant the user is bound to, empty for users of the whole service
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the authenticated user of a request, or nil if the API is not authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// Authenticator validates bearer tokens, either API keys or tokens issued by an OpenID Connect provider whose
+// claims are mapped to API roles. Requests without a token can be authenticated by a verified TLS client
+// certificate. A nil Authenticator lets every request through.
+type Authenticator struct {
+	cfg        *config.AuthConfig // nil if no provider is configured
+	verifier   *oidc.IDTokenVerifier
+	keys       *apikeys.Store        // nil if API keys are disabled
+	clientRole string                // Role of verified client certificates, empty to require a token
+	tenants    *config.TenantsConfig // nil if the service has a single tenant
+}
+
+// NewAuthenticator discovers the provider of the configured issuer. Returns nil if neither a provider, API keys nor
+// a client certificate role are configured. Tokens must be API keys or JWTs signed with the keys of the provider,
+// such as ID tokens or JWT access tokens. Users bound to a tenant that is not one of the tenants are refused.
+func NewAuthenticator(ctx context.Context, cfg *config.AuthConfig, keys *apikeys.Store, clientRole string, tenants *config.TenantsConfig, insecure bool) (*Authenticator, error) {
+	if cfg == nil {
+		if keys == nil && clientRole == "" {
+			return nil, nil
+		}
+		return &Authenticator{keys: keys, clientRole: clientRole, tenants: tenants}, nil
+	}
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+		},
+	}
+	// The provider keeps the client of its context to refresh the signing keys
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, client), cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering OpenID Connect provider %s: %w", cfg.Issuer, err)
+	}
+	// Several audiences are accepted, they are checked after verification
+	verifier := provider.Verifier(&oidc.Config{SkipClientIDCheck: true})
+	return &Authenticator{cfg: cfg, verifier: verifier, keys: keys, clientRole: clientRole, tenants: tenants}, nil
+}
+
+// Authenticate verifies a raw bearer token and returns its user. When there are tenants, the tokens of users without a
+// tenant claim are refused with errNoTenant and their user, unless a global role grants them the whole service.
+func (a *Authenticator) Authenticate(ctx context.Context, rawToken string) (*Principal, error) {
+	if strings.HasPrefix(rawToken, apikeys.Prefix) && a.keys != nil {
+		key, err := a.keys.Authenticate(ctx, rawToken)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{Subject: "apikey:" + key.ID, Username: key.Name, Role: key.Role, Tenant: key.Tenant}, nil
+	}
+	if a.verifier == nil {
+		return nil, apikeys.ErrInvalidKey
+	}
+	token, err := a.verifier.Verify(ctx, rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(token.Audience, func(aud string) bool { return slices.Contains(a.cfg.Audiences, aud) }) {
+		return nil, fmt.Errorf("token audience %v not accepted", token.Audience)
+	}
+	var claims map[string]any
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("error reading claims: %w", err)
+	}
+	roles := claimValues(claims, a.cfg.ClaimRoles())
+	principal := &Principal{
+		Subject: token.Subject,
+		Role:    a.cfg.RoleFor(roles),
+	}
+	if usernames := claimValues(claims, a.cfg.ClaimUsername()); len(usernames) > 0 {
+		principal.Username = usernames[0]
+	} else {
+		principal.Username = token.Subject
+	}
+	if a.cfg.TenantClaim != "" {
+		if tenants := claimValues(claims, a.cfg.TenantClaim); len(tenants) > 0 {
+			principal.Tenant = tenants[0]
+		} else if a.tenants != nil && !a.cfg.GrantsGlobal(roles) {
+			// Users only get the whole service explicitly, not by a token missing its tenant
+			return principal, fmt.Errorf("%w %q and no global role", errNoTenant, a.cfg.TenantClaim)
+		}
+	}
+	return principal, nil
+}
+
+// Require wraps a handler so that it is only served to users with the given role or a higher one. The requests of
+// users bound to a tenant are scoped to their tenant.
+func (a *Authenticator) Require(role string, next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var principal *Principal
+		if rawToken, ok := bearerToken(r); ok {
+			var err error
+			principal, err = a.Authenticate(r.Context(), rawToken)
+			if errors.Is(err, errNoTenant) {
+				noteAuditPrincipal(r.Context(), principal)
+				logger.Warn("Denied %s %s to %s: %v", r.Method, r.URL.Path, principal.Username, err)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				logger.Warn("Rejected token for %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+				unauthorized(w, "invalid_token")
+				return
+			}
+		} else if principal = a.clientCertPrincipal(r.TLS); principal == nil {
+			unauthorized(w, "")
+			return
+		}
+		noteAuditPrincipal(r.Context(), principal)
+		if !config.HasRole(principal.Role, role) {
+			logger.Warn("Denied %s %s to %s: role %q, %s required", r.Method, r.URL.Path, principal.Username, principal.Role, role)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if principal.Tenant != "" && a.tenants.Tenant(principal.Tenant) == nil {
+			logger.Warn("Denied %s %s to %s: unknown tenant %q", r.Method, r.URL.Path, principal.Username, principal.Tenant)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		logger.Debug("Authenticated %s (%s) for %s %s", principal.Username, principal.Role, r.Method, r.URL.Path)
+		ctx := context.WithValue(r.Context(), principalKey{}, principal)
+		next(w, r.WithContext(preservation.WithTenant(ctx, principal.Tenant)))
+	}
+}
+
+// RequireGlobal wraps a handler like Require, and also refuses users bound to a tenant: the handler serves the
+// whole service, e.g. administration or the feeds of every package.
+func (a *Authenticator) RequireGlobal(role string, next http.HandlerFunc) http.HandlerFunc {
+	return a.Require(role, func(w http.ResponseWriter, r *http.Request) {
+		if principal := PrincipalFromContext(r.Context()); principal != nil && principal.Tenant != "" {
+			logger.Warn("Denied %s %s to %s: not available to tenant %s", r.Method, r.URL.Path, principal.Username, principal.Tenant)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// clientCertPrincipal returns the user of the verified TLS client certificate of a connection, named after its common
+// name, or nil if the connection has none or client certificates grant no role.
+func (a *Authenticator) clientCertPrincipal(state *tls.ConnectionState) *Principal {
+	if a.clientRole == "" || state == nil || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	subject := state.VerifiedChains[0][0].Subject.CommonName
+	return &Principal{Subject: "cert:" + subject, Username: subject, Role: a.clientRole}
+}
+
+// bearerToken returns the token of the Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// unauthorized responds with 401 and the bearer challenge of RFC 6750.
+func unauthorized(w http.ResponseWriter, errorCode string) {
+	challenge := `Bearer realm="curate-preservation"`
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error=%q`, errorCode)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// claimValues returns the string values of a claim, nested claims being separated by dots (e.g. realm_access.roles).
+func claimValues(claims map[string]any, name string) []string {
+	var value any = claims
+	for key := range strings.SplitSeq(name, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if value, ok = object[key]; !ok {
+			return nil
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
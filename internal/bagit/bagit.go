@@ -0,0 +1,223 @@
+// Package bagit creates BagIt bags (RFC 8493) from files and directories, for packages exchanged outside a
+// preservation run. Bags are validated with the bagit check of the validation package.
+package bagit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/penwern/curate-preservation-core/pkg/version"
+)
+
+// Version is the BagIt version of the bags created.
+const Version = "1.0"
+
+// reservedTags are the bag-info.txt tags written by Create, which cannot be set in the options.
+var reservedTags = []string{"Bagging-Date", "Payload-Oxum", "Bag-Software-Agent"}
+
+// Tag is a bag-info.txt tag. Tags can be repeated, so they are kept in order rather than in a map.
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// CreateOptions configures the creation of a bag.
+type CreateOptions struct {
+	Algorithms []string // Checksum algorithms of the manifests, sha256 if empty
+	Info       []Tag    // Tags added to bag-info.txt
+	// DryRun checks the source and destination and counts the payload without writing anything.
+	DryRun bool
+}
+
+// Bag describes a created bag.
+type Bag struct {
+	Path       string   `json:"path"`
+	Algorithms []string `json:"algorithms"`
+	Files      int      `json:"files"`
+	Size       int64    `json:"size"`
+}
+
+// ParseTag parses a bag-info.txt tag given as Name=Value.
+func ParseTag(s string) (Tag, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !ok || name == "" {
+		return Tag{}, fmt.Errorf("invalid tag %q, expected Name=Value", s)
+	}
+	if strings.ContainsAny(name, ":\r\n") || strings.ContainsAny(value, "\r\n") {
+		return Tag{}, fmt.Errorf("invalid tag %q, names cannot contain colons and tags cannot span lines", s)
+	}
+	return Tag{Name: name, Value: value}, nil
+}
+
+// Create creates a bag at dest with a copy of src, a file or a directory, as its payload. The destination must not
+// exist or be an empty directory. A manifest and a tag manifest are written for each algorithm, and bag-info.txt
+// records the bagging date, the Payload-Oxum and the software agent with the tags of the options.
+// With DryRun, the returned bag describes the bag that would be created.
+func Create(ctx context.Context, src, dest string, opts CreateOptions) (*Bag, error) {
+	algorithms := opts.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha256"}
+	}
+	for _, algorithm := range algorithms {
+		if !slices.Contains(utils.SupportedChecksumAlgorithms, algorithm) {
+			return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+		}
+	}
+	for _, tag := range opts.Info {
+		if slices.ContainsFunc(reservedTags, func(name string) bool { return strings.EqualFold(name, tag.Name) }) {
+			return nil, fmt.Errorf("tag %s is set by the bag creation", tag.Name)
+		}
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("error reading source: %w", err)
+	}
+	if info.IsDir() && inside(dest, src) {
+		return nil, fmt.Errorf("destination %s is inside the source", dest)
+	}
+	if entries, err := os.ReadDir(dest); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("destination %s is not empty", dest)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading destination: %w", err)
+	}
+	bag := &Bag{Path: dest, Algorithms: algorithms}
+	manifests := newManifests(algorithms)
+	addPayload := func(src, rel string) error { return bag.addPayload(manifests, src, rel) }
+	if opts.DryRun {
+		addPayload = bag.countPayload
+	} else if err := utils.CreateDir(filepath.Join(dest, "data")); err != nil {
+		return nil, fmt.Errorf("error creating payload directory: %w", err)
+	}
+	if info.IsDir() {
+		err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			rel, err := filepath.Rel(src, p)
+			if err != nil {
+				return err
+			}
+			switch {
+			case d.IsDir() && opts.DryRun:
+				return nil
+			case d.IsDir():
+				return utils.CreateDir(filepath.Join(dest, "data", rel))
+			case !d.Type().IsRegular():
+				return fmt.Errorf("%s is not a regular file", p)
+			}
+			return addPayload(p, path.Join("data", filepath.ToSlash(rel)))
+		})
+	} else {
+		err = addPayload(src, path.Join("data", info.Name()))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error copying payload: %w", err)
+	}
+	if opts.DryRun {
+		return bag, nil
+	}
+
+	tags := newManifests(algorithms)
+	if err := bag.writeTagFile(tags, "bagit.txt",
+		"BagIt-Version: "+Version+"\nTag-File-Character-Encoding: UTF-8\n"); err != nil {
+		return nil, err
+	}
+	var bagInfo strings.Builder
+	fmt.Fprintf(&bagInfo, "Bagging-Date: %s\n", time.Now().Format(time.DateOnly))
+	fmt.Fprintf(&bagInfo, "Payload-Oxum: %d.%d\n", bag.Size, bag.Files)
+	fmt.Fprintf(&bagInfo, "Bag-Software-Agent: %s\n", version.Identifier())
+	for _, tag := range opts.Info {
+		fmt.Fprintf(&bagInfo, "%s: %s\n", tag.Name, tag.Value)
+	}
+	if err := bag.writeTagFile(tags, "bag-info.txt", bagInfo.String()); err != nil {
+		return nil, err
+	}
+	for _, algorithm := range algorithms {
+		if err := bag.writeTagFile(tags, "manifest-"+algorithm+".txt", manifests.lines(algorithm)); err != nil {
+			return nil, err
+		}
+	}
+	for _, algorithm := range algorithms {
+		name := "tagmanifest-" + algorithm + ".txt"
+		if err := os.WriteFile(filepath.Join(dest, name), []byte(tags.lines(algorithm)), 0o600); err != nil {
+			return nil, fmt.Errorf("error writing %s: %w", name, err)
+		}
+	}
+	return bag, nil
+}
+
+// addPayload copies a payload file to its path in the bag, computing its checksums as it is copied.
+func (b *Bag) addPayload(m *manifests, src, rel string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	dest := filepath.Join(b.Path, filepath.FromSlash(rel))
+	if err := utils.CreateDir(filepath.Dir(dest)); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	written, err := m.copy(rel, out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	b.Files++
+	b.Size += written
+	return nil
+}
+
+// countPayload counts a payload file in the bag without copying it.
+func (b *Bag) countPayload(src, _ string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	b.Files++
+	b.Size += info.Size()
+	return nil
+}
+
+// writeTagFile writes a tag file to the bag and adds it to the tag manifests.
+func (b *Bag) writeTagFile(tags *manifests, name, content string) error {
+	if _, err := tags.copy(name, io.Discard, strings.NewReader(content)); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(b.Path, name), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// inside reports whether target is dir or inside it.
+func inside(target, dir string) bool {
+	absPath, err := filepath.Abs(target)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,59 @@
+package bagit
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// manifestPath encodes the line breaks and percent signs of paths in manifests, as RFC 8493 requires.
+var manifestPath = strings.NewReplacer("%", "%25", "\n", "%0A", "\r", "%0D")
+
+// manifests collects the checksums of the files of a manifest and its other algorithms.
+type manifests struct {
+	algorithms []string
+	sums       map[string][]string // Checksums of each path, in the order of the algorithms
+}
+
+func newManifests(algorithms []string) *manifests {
+	return &manifests{algorithms: algorithms, sums: map[string][]string{}}
+}
+
+// copy copies a file to w, recording its checksums under its path relative to the bag root.
+func (m *manifests) copy(rel string, w io.Writer, r io.Reader) (int64, error) {
+	writers := []io.Writer{w}
+	hashes := make([]hash.Hash, 0, len(m.algorithms))
+	for _, algorithm := range m.algorithms {
+		h, err := utils.NewHash(algorithm)
+		if err != nil {
+			return 0, err
+		}
+		writers = append(writers, h)
+		hashes = append(hashes, h)
+	}
+	written, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return written, err
+	}
+	sums := make([]string, len(hashes))
+	for i, h := range hashes {
+		sums[i] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	m.sums[rel] = sums
+	return written, nil
+}
+
+// lines returns the manifest of an algorithm, sorted by path.
+func (m *manifests) lines(algorithm string) string {
+	i := slices.Index(m.algorithms, algorithm)
+	var b strings.Builder
+	for _, rel := range slices.Sorted(maps.Keys(m.sums)) {
+		fmt.Fprintf(&b, "%s  %s\n", m.sums[rel][i], manifestPath.Replace(rel))
+	}
+	return b.String()
+}
@@ -0,0 +1,473 @@
+package internal
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/processor"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	// maxBatchEntries is the number of packages a batch can hold.
+	maxBatchEntries = 1000
+	// defaultBatchesLimit is the number of batches listed by BatchesHandler without a limit parameter.
+	defaultBatchesLimit = 50
+)
+
+// BatchesService is the interface of the batch submissions used by the HTTP handler.
+type BatchesService interface {
+	SubmitBatch(ctx context.Context, req *BatchRequest, createdBy string) (*catalog.Batch, error)
+}
+
+// BatchRequest is a batch manifest: the packages to preserve, with the profile and metadata they share.
+type BatchRequest struct {
+	Username    string              `json:"username" validate:"required"` // Cells user the packages are preserved as
+	Reference   string              `json:"reference,omitempty"`          // Reference of the submitter, e.g. an accession number
+	Profile     string              `json:"profile,omitempty"`
+	Metadata    map[string]string   `json:"metadata,omitempty"` // Dublin Core and ISAD(G) metadata of every package, e.g. dc.rights
+	Priority    queue.Priority      `json:"priority,omitempty"`
+	CallbackURL string              `json:"callback_url,omitempty"` // Receives the result of each package, with the reference
+	Entries     []BatchEntryRequest `json:"entries" validate:"min=1,dive"`
+}
+
+// BatchEntryRequest is a package of a batch manifest. Its profile and metadata override those of the batch.
+type BatchEntryRequest struct {
+	Path     string            `json:"path" validate:"required"` // Resolved Cells path, or path in the transfer source
+	Source   string            `json:"source,omitempty"`         // Transfer source the path is pulled from, Cells otherwise
+	Profile  string            `json:"profile,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Validate checks the manifest: a username and between one and maxBatchEntries distinct packages, with known
+// metadata keys. Invalid fields are returned as a *ValidationError.
+func (r *BatchRequest) Validate() error {
+	verr := validateFields(r)
+	if len(r.Entries) > maxBatchEntries {
+		verr.add("entries", "max", fmt.Sprintf("must have at most %d elements", maxBatchEntries))
+	}
+	validateMetadata(verr, "metadata", r.Metadata)
+	seen := map[string]bool{}
+	for i, entry := range r.Entries {
+		field := fmt.Sprintf("entries[%d]", i)
+		key := entry.Source + ":" + entry.Path
+		if entry.Path != "" && seen[key] {
+			verr.add(field+".path", "unique", "is the package of another entry")
+		}
+		seen[key] = true
+		validateMetadata(verr, field+".metadata", entry.Metadata)
+	}
+	return verr.err()
+}
+
+// ParseBatchManifest reads a batch manifest, as the JSON of a batch submission or as CSV. The header row of a CSV
+// manifest names its columns: path, and optionally source, profile and metadata keys (e.g. dc.title), each following
+// row being a package with its own profile and metadata. Empty cells are ignored. The username and the settings shared
+// by the packages are not part of CSV manifests.
+func ParseBatchManifest(r io.Reader, format string) (*BatchRequest, error) {
+	switch format {
+	case "json":
+		var req BatchRequest
+		if err := json.NewDecoder(r).Decode(&req); err != nil {
+			return nil, fmt.Errorf("invalid JSON manifest: %w", err)
+		}
+		return &req, nil
+	case "csv":
+	default:
+		return nil, fmt.Errorf("unsupported manifest format %q, expected csv or json", format)
+	}
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV manifest: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("the CSV manifest has no header row")
+	}
+	header := rows[0]
+	// Spreadsheet applications may save CSV files with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	hasPath := false
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		header[i] = column
+		switch {
+		case column == "path":
+			hasPath = true
+		case column == "source", column == "profile", processor.IsMetadataKey(column):
+		default:
+			return nil, fmt.Errorf("unknown column %q, expected path, source, profile or a dc.* or isadg.* metadata key", column)
+		}
+	}
+	if !hasPath {
+		return nil, errors.New("the CSV manifest has no path column")
+	}
+	req := &BatchRequest{}
+	for _, row := range rows[1:] {
+		var entry BatchEntryRequest
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			switch header[i] {
+			case "path":
+				entry.Path = value
+			case "source":
+				entry.Source = value
+			case "profile":
+				entry.Profile = value
+			default:
+				if entry.Metadata == nil {
+					entry.Metadata = map[string]string{}
+				}
+				entry.Metadata[header[i]] = value
+			}
+		}
+		req.Entries = append(req.Entries, entry)
+	}
+	return req, nil
+}
+
+// validateMetadata checks that metadata only has Dublin Core and ISAD(G) keys.
+func validateMetadata(verr *ValidationError, field string, metadata map[string]string) {
+	for key := range metadata {
+		if !processor.IsMetadataKey(key) {
+			verr.add(field+"."+key, "metadata_key", "is not a dc.* or isadg.* key of metadata.json")
+		}
+	}
+}
+
+// SubmitBatch records a batch and queues the preservation of each of its packages, for the tenant of the context if it
+// has one. The status of each package is kept in the batch record as its job runs.
+func (s *Service) SubmitBatch(ctx context.Context, req *BatchRequest, createdBy string) (*catalog.Batch, error) {
+	if s.queue == nil {
+		return nil, errors.New("job queue is not open")
+	}
+	store := s.Catalog()
+	if store == nil {
+		return nil, errors.New("package records are disabled")
+	}
+	callback, err := s.Callback(req.CallbackURL, req.Reference)
+	if err != nil {
+		return nil, err
+	}
+	batch, jobs := newBatch(preservation.TenantFromContext(ctx), req, createdBy, callback)
+	// The batch is recorded first, its jobs may start as soon as they are queued
+	if err := store.SaveBatch(batch); err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		err := s.admitJob(job)
+		if err == nil {
+			err = s.queue.Enqueue(ctx, job)
+		}
+		if err == nil {
+			continue
+		}
+		logger.Error("Error queuing %s of batch %s: %v", job.Path, batch.ID, err)
+		s.updateBatchEntry(job, func(entry *catalog.BatchEntry) {
+			entry.Status = catalog.BatchEntrySkipped
+			entry.Error = err.Error()
+		})
+	}
+	logger.Info("Batch %s of %d packages queued for preservation", batch.ID, len(jobs))
+	return store.GetBatch(batch.ID)
+}
+
+// RunBatch records a batch and preserves its packages on this instance, up to parallel packages at a time, instead of
+// queuing them. Packages not started when the context is cancelled are skipped, running ones are drained by Shutdown.
+// Returns the batch record once every package is done.
+func (s *Service) RunBatch(ctx context.Context, req *BatchRequest, createdBy string, parallel int) (*catalog.Batch, error) {
+	store := s.Catalog()
+	if store == nil {
+		return nil, errors.New("package records are disabled")
+	}
+	callback, err := s.Callback(req.CallbackURL, req.Reference)
+	if err != nil {
+		return nil, err
+	}
+	batch, jobs := newBatch(preservation.TenantFromContext(ctx), req, createdBy, callback)
+	if err := store.SaveBatch(batch); err != nil {
+		return nil, err
+	}
+	logger.Info("Batch %s of %d packages started", batch.ID, len(jobs))
+
+	skip := func(job *queue.Job, err error) {
+		logger.Warn("Skipped %s of batch %s: %v", job.Path, batch.ID, err)
+		s.updateBatchEntry(job, func(entry *catalog.BatchEntry) {
+			entry.Status = catalog.BatchEntrySkipped
+			entry.Error = err.Error()
+		})
+	}
+	slots := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			skip(job, fmt.Errorf("interrupted before it started: %w", ctx.Err()))
+			continue
+		}
+		if err := s.admitJob(job); err != nil {
+			skip(job, err)
+			<-slots
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			// Packages over a quota queuing its submissions, and interrupted ones, cannot wait for a queue
+			if err := s.runJob(ctx, job); errors.Is(err, queue.ErrDeferred) || errors.Is(err, queue.ErrInterrupted) {
+				skip(job, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return store.GetBatch(batch.ID)
+}
+
+// PlanBatch is a dry run of RunBatch: it returns the actions preserving the packages of a batch manifest would take,
+// without recording the batch. Packages a quota would refuse are reported as skipped.
+func (s *Service) PlanBatch(ctx context.Context, req *BatchRequest) ([]preservation.PlannedAction, error) {
+	if s.Catalog() == nil {
+		return nil, errors.New("package records are disabled")
+	}
+	callback, err := s.Callback(req.CallbackURL, req.Reference)
+	if err != nil {
+		return nil, err
+	}
+	_, jobs := newBatch(preservation.TenantFromContext(ctx), req, "", callback)
+	actions := []preservation.PlannedAction{{
+		Stage:  catalog.EventPreservation,
+		Action: fmt.Sprintf("Record a batch of %d packages", len(jobs)),
+	}}
+	for _, job := range jobs {
+		if err := s.admitJob(job); err != nil {
+			actions = append(actions, preservation.PlannedAction{Stage: catalog.EventPreservation, Action: fmt.Sprintf("Skip %s: %v", job.Path, err)})
+			continue
+		}
+		if job.Source != "" {
+			actions = append(actions, preservation.PlannedAction{Stage: catalog.EventDownload, Action: "Pull " + job.Path + " from " + job.Source})
+		}
+		action := fmt.Sprintf("Preserve %s as %s with the profile of its path", job.Path, job.Username)
+		if job.Profile != "" {
+			action = fmt.Sprintf("Preserve %s as %s with profile %s", job.Path, job.Username, job.Profile)
+		}
+		actions = append(actions, preservation.PlannedAction{Stage: catalog.EventPreservation, Action: action})
+	}
+	if callback != nil {
+		actions = append(actions, preservation.PlannedAction{Stage: catalog.EventPreservation, Action: "Send the result of each package to " + callback.URL})
+	}
+	return actions, nil
+}
+
+// newBatch returns the record of a batch manifest and the jobs of its packages, for a tenant if it is not empty.
+func newBatch(tenant string, req *BatchRequest, createdBy string, callback *queue.Callback) (*catalog.Batch, []*queue.Job) {
+	now := time.Now().UTC()
+	batch := &catalog.Batch{
+		ID:        utils.NewUUID(),
+		Reference: req.Reference,
+		Username:  req.Username,
+		Tenant:    tenant,
+		Profile:   req.Profile,
+		Metadata:  req.Metadata,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+	jobs := make([]*queue.Job, 0, len(req.Entries))
+	for _, entry := range req.Entries {
+		profile := entry.Profile
+		if profile == "" {
+			profile = req.Profile
+		}
+		metadata := maps.Clone(req.Metadata)
+		if len(entry.Metadata) > 0 {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+			maps.Copy(metadata, entry.Metadata)
+		}
+		job := &queue.Job{
+			ID:       tenantJobID(tenant, "batches:"+batch.ID+":"+entry.Source+":"+entry.Path),
+			Username: req.Username,
+			Tenant:   tenant,
+			Path:     entry.Path,
+			Source:   entry.Source,
+			Profile:  profile,
+			QueuedAt: now,
+			Metadata: metadata,
+			Batch:    batch.ID,
+			Callback: callback,
+			Priority: req.Priority,
+		}
+		jobs = append(jobs, job)
+		batch.Entries = append(batch.Entries, &catalog.BatchEntry{
+			JobID:     job.ID,
+			Path:      entry.Path,
+			Source:    entry.Source,
+			Profile:   profile,
+			Status:    catalog.BatchEntryQueued,
+			UpdatedAt: now,
+		})
+	}
+	return batch, jobs
+}
+
+// updateBatchEntry applies fn to the entry of a job in its batch record, if the job belongs to a batch.
+func (s *Service) updateBatchEntry(job *queue.Job, fn func(entry *catalog.BatchEntry)) {
+	store := s.Catalog()
+	if job.Batch == "" || store == nil {
+		return
+	}
+	if err := store.UpdateBatchEntry(job.Batch, job.ID, fn); err != nil {
+		logger.Error("Error updating batch %s: %v", job.Batch, err)
+	}
+}
+
+// finishBatchEntry records the outcome of a job in its batch record, with the package record of the job if one was
+// created.
+func (s *Service) finishBatchEntry(job *queue.Job, started time.Time, runErr error) {
+	if job.Batch == "" {
+		return
+	}
+	rec := s.jobRecord(job, started)
+	s.updateBatchEntry(job, func(entry *catalog.BatchEntry) {
+		entry.Status = catalog.BatchEntryCompleted
+		entry.Error = ""
+		switch {
+		case errors.Is(runErr, preservation.ErrCancelled):
+			entry.Status = catalog.BatchEntryCancelled
+		case runErr != nil:
+			entry.Status = catalog.BatchEntryFailed
+			entry.Error = runErr.Error()
+		}
+		if rec != nil {
+			entry.PackageID = rec.ID
+			entry.AIPUUID = rec.AIPUUID
+			entry.State = rec.State
+			if entry.Status == catalog.BatchEntryFailed && rec.Error != "" {
+				// The record has the error of the failed stage, the service only reports that the run failed
+				entry.Error = rec.Error
+			}
+		}
+	})
+}
+
+// SubmitBatchHandler records a batch manifest and queues the preservation of its packages. Responds with 202 Accepted
+// and the batch record, whose status is updated as the packages are preserved.
+func SubmitBatchHandler(svc BatchesService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		createdBy := ""
+		if principal := PrincipalFromContext(r.Context()); principal != nil {
+			createdBy = principal.Username
+		}
+		batch, err := svc.SubmitBatch(r.Context(), &req, createdBy)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to submit batch: %v", err))
+			status := http.StatusInternalServerError
+			if errors.Is(err, errCallbackNotAllowed) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		writeJSON(w, batch)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// BatchesHandler responds with the batch records, most recent first, filtered by status and up to the limit
+// parameter. Tenants only see their own batches.
+func BatchesHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "package records are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		limit := defaultBatchesLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", value), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		status := r.URL.Query().Get("status")
+		batches, err := store.ListBatches()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list batches: %v", err))
+			http.Error(w, "failed to list batches", http.StatusInternalServerError)
+			return
+		}
+		tenant := preservation.TenantFromContext(r.Context())
+		matched := []*catalog.Batch{}
+		for _, batch := range batches {
+			if (tenant != "" && batch.Tenant != tenant) || (status != "" && batch.Status != status) {
+				continue
+			}
+			if matched = append(matched, batch); len(matched) == limit {
+				break
+			}
+		}
+		writeJSON(w, matched)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// BatchHandler responds with a batch record, with the status of each package and the aggregate status of the batch.
+func BatchHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "package records are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		id := r.PathValue("id")
+		batch, err := store.GetBatch(id)
+		if errors.Is(err, catalog.ErrBatchNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to read batch %s: %v", id, err))
+			http.Error(w, "failed to read batch", http.StatusInternalServerError)
+			return
+		}
+		if tenant := preservation.TenantFromContext(r.Context()); tenant != "" && batch.Tenant != tenant {
+			http.Error(w, catalog.ErrBatchNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, batch)
+	}
+	return recoveryMiddleware(handler)
+}
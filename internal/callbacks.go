@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/notify"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Job statuses reported in the completion callbacks.
+const (
+	CallbackCompleted = "completed"
+	CallbackFailed    = "failed"
+	CallbackCancelled = "cancelled"
+)
+
+// errCallbackNotAllowed is returned when the callback URL of a job is not one of the allowed URLs.
+var errCallbackNotAllowed = errors.New("callback URL not allowed")
+
+// JobCallback is the result of a job posted to its callback URL once it completes, fails or is cancelled.
+type JobCallback struct {
+	JobID          string         `json:"job_id"`
+	Reference      string         `json:"reference,omitempty"`
+	Path           string         `json:"path"`
+	Source         string         `json:"source,omitempty"` // Transfer source the package was pulled from, Cells if empty
+	Username       string         `json:"username"`
+	Tenant         string         `json:"tenant,omitempty"`
+	Profile        string         `json:"profile,omitempty"`
+	Batch          string         `json:"batch,omitempty"`
+	Priority       queue.Priority `json:"priority,omitempty"`
+	Status         string         `json:"status"`
+	Error          string         `json:"error,omitempty"`
+	PackageID      string         `json:"package_id,omitempty"`
+	CellsPath      string         `json:"cells_path,omitempty"`
+	Outcome        string         `json:"outcome,omitempty"` // Outcome of the package, e.g. warning when it was preserved with warnings
+	AIPUUID        string         `json:"aip_uuid,omitempty"`
+	State          catalog.State  `json:"state,omitempty"`
+	ReviewRequired bool           `json:"review_required,omitempty"`
+	QueuedAt       time.Time      `json:"queued_at,omitzero"`
+	StartedAt      time.Time      `json:"started_at"`
+	DurationMs     int64          `json:"duration_ms"`
+	Time           time.Time      `json:"time"`
+}
+
+// Callback returns the completion callback of a submitted job, or nil if the callback URL is empty. The callback URL
+// must start with one of the configured callback URLs, or the Cells address.
+func (s *Service) Callback(callbackURL, reference string) (*queue.Callback, error) {
+	if callbackURL == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(callbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: %s is not an HTTP URL", errCallbackNotAllowed, callbackURL)
+	}
+	if !s.callbackAllowed(callbackURL) {
+		return nil, fmt.Errorf("%w: %s", errCallbackNotAllowed, callbackURL)
+	}
+	return &queue.Callback{URL: callbackURL, Reference: reference}, nil
+}
+
+// callbackAllowed reports whether a callback URL starts with one of the allowed prefixes.
+func (s *Service) callbackAllowed(callbackURL string) bool {
+	prefixes := s.cfg.Callbacks.URLs
+	if len(prefixes) == 0 {
+		prefixes = s.cfg.Flows.CallbackURLs
+	}
+	if len(prefixes) == 0 {
+		prefixes = []string{s.cfg.Cells.Address}
+	}
+	for _, prefix := range prefixes {
+		if prefix = strings.TrimSuffix(prefix, "/"); prefix == "" {
+			continue
+		}
+		if callbackURL == prefix || strings.HasPrefix(callbackURL, prefix+"/") || strings.HasPrefix(callbackURL, prefix+"?") {
+			return true
+		}
+	}
+	return false
+}
+
+// callbackSecret returns the secret the callbacks are signed with, empty if they are not signed.
+func (s *Service) callbackSecret() string {
+	if s.cfg.Callbacks.Secret != "" {
+		return s.cfg.Callbacks.Secret
+	}
+	return s.cfg.Flows.CallbackSecret
+}
+
+// sendCallback posts the result of a job to its callback URL, with the package record of the job if one was
+// created. Callbacks are signed like webhook notifications when a callback secret is configured.
+func (s *Service) sendCallback(ctx context.Context, job *queue.Job, started time.Time, runErr error) {
+	callback := JobCallback{
+		JobID:      job.ID,
+		Reference:  job.Callback.Reference,
+		Path:       job.Path,
+		Source:     job.Source,
+		Username:   job.Username,
+		Tenant:     job.Tenant,
+		Profile:    job.Profile,
+		Batch:      job.Batch,
+		Priority:   job.Priority,
+		Status:     CallbackCompleted,
+		QueuedAt:   job.QueuedAt,
+		StartedAt:  started.UTC(),
+		DurationMs: time.Since(started).Milliseconds(),
+		Time:       time.Now().UTC(),
+	}
+	switch {
+	case errors.Is(runErr, preservation.ErrCancelled):
+		callback.Status = CallbackCancelled
+	case runErr != nil:
+		callback.Status = CallbackFailed
+		callback.Error = runErr.Error()
+	}
+	if rec := s.jobRecord(job, started); rec != nil {
+		callback.PackageID = rec.ID
+		callback.CellsPath = rec.CellsPath
+		callback.Outcome = rec.Outcome
+		callback.AIPUUID = rec.AIPUUID
+		callback.State = rec.State
+		callback.ReviewRequired = rec.ReviewRequired
+		if callback.Status == CallbackFailed && rec.Error != "" {
+			// The record has the error of the failed stage, the service only reports that the run failed
+			callback.Error = rec.Error
+		}
+	}
+	body, err := json.Marshal(callback)
+	if err != nil {
+		logger.Error("Error encoding callback of job %s: %v", job.ID, err)
+		return
+	}
+	// The jobs of Cells Flows keep the event of the callbacks they had before every job could have one
+	event := "job." + callback.Status
+	if strings.HasPrefix(untenantedJobID(job.ID), "flows:") {
+		event = "flow." + event
+	}
+
+	client := utils.NewHTTPClient(30*time.Second, s.cfg.AllowInsecureTLS)
+	defer client.Close()
+	delivery := utils.NewUUID()
+	secret := s.callbackSecret()
+	err = utils.WithRetry(func() error {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers := map[string]string{
+			"Content-Type":       "application/json",
+			"User-Agent":         "curate-preservation-core",
+			"X-Curate-Event":     event,
+			"X-Curate-Delivery":  delivery,
+			"X-Curate-Timestamp": timestamp,
+		}
+		if secret != "" {
+			headers["X-Curate-Signature"] = "sha256=" + notify.Sign(secret, timestamp, body)
+		}
+		resp, err := client.DoRequest(ctx, http.MethodPost, job.Callback.URL, bytes.NewReader(body), headers)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			return fmt.Errorf("callback returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Error sending callback of job %s to %s: %v", job.ID, job.Callback.URL, err)
+		return
+	}
+	logger.Debug("Sent %s callback of job %s", callback.Status, job.ID)
+}
+
+// jobRecord returns the latest package record of a job, created since it started. Returns nil if there is none,
+// e.g. when package records are disabled or the job failed before the package was recorded.
+func (s *Service) jobRecord(job *queue.Job, started time.Time) *catalog.Record {
+	store := s.Catalog()
+	if store == nil {
+		return nil
+	}
+	records, err := store.List()
+	if err != nil {
+		logger.Error("Error listing package records: %v", err)
+		return nil
+	}
+	// Records are listed most recent first
+	for _, rec := range records {
+		if rec.JobID == job.ID && !rec.CreatedAt.Before(started) {
+			return rec
+		}
+	}
+	return nil
+}
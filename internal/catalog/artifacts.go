@@ -0,0 +1,200 @@
+package catalog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Artifacts of a package, kept in its directory with its record.
+const (
+	ArtifactReport         = "preservation-report.txt" // Generated from the record when it is read
+	ArtifactStageLog       = "stage-log.txt"
+	ArtifactMETS           = "METS.xml"
+	ArtifactInputManifest  = "manifest-input.json"
+	ArtifactManifestReport = "manifest-report.json"
+	ArtifactPIIReport      = "pii-report.json"
+	ArtifactFixityPremis   = "premis-fixity.xml"
+)
+
+// ErrArtifactNotFound is returned when a package does not have an artifact.
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// artifactDescriptions are the known artifacts, in the order they are listed.
+var artifactDescriptions = []struct {
+	name, description, contentType string
+}{
+	{ArtifactReport, "Preservation report: outcome, stages and warnings", "text/plain; charset=utf-8"},
+	{ArtifactStageLog, "Log of the a3m jobs, with the error of the processing if it failed", "text/plain; charset=utf-8"},
+	{ArtifactMETS, "METS of the AIP", "application/xml"},
+	{ArtifactInputManifest, "Checksums of the files submitted", "application/json"},
+	{ArtifactManifestReport, "Files renamed, modified or dropped by the pipeline", "application/json"},
+	{ArtifactPIIReport, "Sensitive data found in the files", "application/json"},
+	{ArtifactFixityPremis, "PREMIS events of the fixity checks of the stored AIP", "application/xml"},
+}
+
+// Artifact is a file produced while preserving a package, such as a report or the METS of its AIP.
+type Artifact struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	ModifiedAt  time.Time `json:"modified_at"`
+}
+
+// Artifacts returns the artifacts of a package. The preservation report is always listed, the other artifacts once
+// their stage has run.
+func (s *Store) Artifacts(rec *Record) ([]Artifact, error) {
+	artifacts := make([]Artifact, 0, len(artifactDescriptions))
+	for _, desc := range artifactDescriptions {
+		artifact := Artifact{Name: desc.name, Description: desc.description, ContentType: desc.contentType}
+		if desc.name == ArtifactReport {
+			artifact.Size = int64(len(rec.Report()))
+			artifact.ModifiedAt = rec.UpdatedAt
+			artifacts = append(artifacts, artifact)
+			continue
+		}
+		info, err := os.Stat(filepath.Join(s.Dir(rec.ID), desc.name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading artifact %s: %w", desc.name, err)
+		}
+		artifact.Size = info.Size()
+		artifact.ModifiedAt = info.ModTime().UTC()
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// ArtifactPath returns the path of an artifact file of a package. Returns ErrArtifactNotFound if the name is not an
+// artifact stored as a file, or if the package does not have it.
+func (s *Store) ArtifactPath(id, name string) (string, error) {
+	for _, desc := range artifactDescriptions {
+		if desc.name != name || name == ArtifactReport {
+			continue
+		}
+		path := filepath.Join(s.Dir(id), name)
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				return "", ErrArtifactNotFound
+			}
+			return "", fmt.Errorf("error reading artifact %s: %w", name, err)
+		}
+		return path, nil
+	}
+	return "", ErrArtifactNotFound
+}
+
+// ArtifactContentType returns the content type of an artifact, or "" if the name is not an artifact.
+func ArtifactContentType(name string) string {
+	for _, desc := range artifactDescriptions {
+		if desc.name == name {
+			return desc.contentType
+		}
+	}
+	return ""
+}
+
+// CopyArtifacts copies the artifacts of another package to the directory of a package, e.g. the reports of the
+// stages a resumed package does not run again. Artifacts the other package does not have are skipped.
+func (s *Store) CopyArtifacts(from, to string) error {
+	for _, desc := range artifactDescriptions {
+		if desc.name == ArtifactReport {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.Dir(from), desc.name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading artifact %s: %w", desc.name, err)
+		}
+		if err := os.WriteFile(filepath.Join(s.Dir(to), desc.name), data, 0o600); err != nil {
+			return fmt.Errorf("error writing artifact %s: %w", desc.name, err)
+		}
+	}
+	return nil
+}
+
+// FindJob returns the most recent record of the packages preserved by a job. Returns ErrNotFound if the job has not
+// started a preservation.
+func (s *Store) FindJob(jobID string) (*Record, error) {
+	records, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		if rec.JobID == jobID {
+			return rec, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Report returns the preservation report of a package: its outcome, its stages, and the warnings and failures of
+// its timeline.
+func (r *Record) Report() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Package:  %s\n", r.ID)
+	fmt.Fprintf(&b, "Path:     %s\n", r.CellsPath)
+	fmt.Fprintf(&b, "User:     %s\n", r.Username)
+	if r.JobID != "" {
+		fmt.Fprintf(&b, "Job:      %s\n", r.JobID)
+	}
+	if r.Profile != "" {
+		fmt.Fprintf(&b, "Profile:  %s\n", r.Profile)
+	}
+	if r.ResumedFrom != "" {
+		fmt.Fprintf(&b, "Resumed:  %s\n", r.ResumedFrom)
+	}
+	if r.AIPUUID != "" {
+		fmt.Fprintf(&b, "AIP:      %s\n", r.AIPUUID)
+	}
+	fmt.Fprintf(&b, "State:    %s\n", r.State)
+	outcome := r.Outcome
+	if outcome == "" {
+		outcome = "running"
+	}
+	fmt.Fprintf(&b, "Outcome:  %s\n", outcome)
+	if r.Error != "" {
+		fmt.Fprintf(&b, "Error:    %s\n", r.Error)
+	}
+	if r.ReviewRequired {
+		fmt.Fprintf(&b, "Review:   %s\n", r.ReviewReason)
+	}
+	fmt.Fprintf(&b, "Created:  %s\n", r.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Updated:  %s\n", r.UpdatedAt.Format(time.RFC3339))
+
+	b.WriteString("\nStages:\n")
+	for _, event := range r.Events {
+		writeReportEvent(&b, event)
+	}
+	warnings := 0
+	for _, event := range r.Events {
+		if event.Outcome == OutcomeWarning || event.Outcome == OutcomeFailure {
+			if warnings == 0 {
+				b.WriteString("\nWarnings and failures:\n")
+			}
+			warnings++
+			writeReportEvent(&b, event)
+		}
+	}
+	if warnings == 0 {
+		b.WriteString("\nNo warnings.\n")
+	}
+	return b.Bytes()
+}
+
+// writeReportEvent writes an event as a line of the preservation report.
+func writeReportEvent(b *bytes.Buffer, event Event) {
+	fmt.Fprintf(b, "  %s  %-16s %-11s %s", event.Time.Format(time.RFC3339), event.Type, event.Outcome, event.Detail)
+	if event.DurationMs > 0 {
+		fmt.Fprintf(b, " (%s)", (time.Duration(event.DurationMs) * time.Millisecond).String())
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,211 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// batchesDirName is the directory of the batch records, next to the package records.
+const batchesDirName = "batches"
+
+// ErrBatchNotFound is returned when a batch record does not exist.
+var ErrBatchNotFound = errors.New("batch not found")
+
+// Statuses of the entries of a batch.
+const (
+	BatchEntryQueued    = "queued"
+	BatchEntryRunning   = "running"
+	BatchEntryCompleted = "completed"
+	BatchEntryFailed    = "failed"
+	BatchEntryCancelled = "cancelled"
+	BatchEntrySkipped   = "skipped" // Not queued, e.g. the same package is already queued
+)
+
+// Aggregate statuses of a batch.
+const (
+	BatchQueued    = "queued"    // No entry has started
+	BatchRunning   = "running"   // Entries are queued or running
+	BatchCompleted = "completed" // Every entry completed
+	BatchPartial   = "partial"   // Every entry is done, some did not complete
+	BatchFailed    = "failed"    // Every entry is done, none completed
+)
+
+// Batch is the record of a batch of packages submitted together, with the job and outcome of each package.
+type Batch struct {
+	ID        string            `json:"id"`
+	Reference string            `json:"reference,omitempty"` // Reference of the submitter, e.g. an accession number
+	Username  string            `json:"username"`
+	Tenant    string            `json:"tenant,omitempty"`
+	Profile   string            `json:"profile,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"` // Metadata shared by the packages
+	CreatedBy string            `json:"created_by,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+
+	// Status and Counts aggregate the statuses of the entries
+	Status  string         `json:"status"`
+	Counts  map[string]int `json:"counts"`
+	Entries []*BatchEntry  `json:"entries"`
+}
+
+// BatchEntry is a package of a batch.
+type BatchEntry struct {
+	JobID     string    `json:"job_id"`
+	Path      string    `json:"path"`
+	Source    string    `json:"source,omitempty"` // Transfer source the path is pulled from, Cells otherwise
+	Profile   string    `json:"profile,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	PackageID string    `json:"package_id,omitempty"`
+	AIPUUID   string    `json:"aip_uuid,omitempty"`
+	State     State     `json:"state,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Done reports whether the entry is no longer queued or running.
+func (e *BatchEntry) Done() bool {
+	return e.Status != BatchEntryQueued && e.Status != BatchEntryRunning
+}
+
+// Entry returns the entry of a job, or nil if the job is not in the batch.
+func (b *Batch) Entry(jobID string) *BatchEntry {
+	for _, entry := range b.Entries {
+		if entry.JobID == jobID {
+			return entry
+		}
+	}
+	return nil
+}
+
+// aggregate sets the counts and the status of the batch from its entries.
+func (b *Batch) aggregate() {
+	b.Counts = map[string]int{}
+	for _, entry := range b.Entries {
+		b.Counts[entry.Status]++
+	}
+	done := 0
+	for _, entry := range b.Entries {
+		if entry.Done() {
+			done++
+		}
+	}
+	switch {
+	case b.Counts[BatchEntryQueued] == len(b.Entries):
+		b.Status = BatchQueued
+	case done < len(b.Entries):
+		b.Status = BatchRunning
+	case b.Counts[BatchEntryCompleted] == len(b.Entries):
+		b.Status = BatchCompleted
+	case b.Counts[BatchEntryCompleted] == 0:
+		b.Status = BatchFailed
+	default:
+		b.Status = BatchPartial
+	}
+}
+
+// batchPath returns the file of a batch record.
+func (s *Store) batchPath(id string) string {
+	return filepath.Join(s.dir, batchesDirName, filepath.Base(id)+".json")
+}
+
+// SaveBatch writes a batch record, replacing any previous version.
+func (s *Store) SaveBatch(batch *Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveBatch(batch)
+}
+
+func (s *Store) saveBatch(batch *Batch) error {
+	if err := utils.CreateDir(filepath.Join(s.dir, batchesDirName)); err != nil {
+		return err
+	}
+	batch.UpdatedAt = time.Now().UTC()
+	batch.aggregate()
+	data, err := json.MarshalIndent(batch, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling batch record: %w", err)
+	}
+	// Write to a temporary file and rename so readers never see a partial record
+	path := s.batchPath(batch.ID)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("error writing batch record: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error replacing batch record: %w", err)
+	}
+	return nil
+}
+
+// GetBatch reads a batch record.
+func (s *Store) GetBatch(id string) (*Batch, error) {
+	data, err := os.ReadFile(s.batchPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrBatchNotFound
+		}
+		return nil, fmt.Errorf("error reading batch record: %w", err)
+	}
+	var batch Batch
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("error parsing batch record: %w", err)
+	}
+	return &batch, nil
+}
+
+// UpdateBatchEntry applies fn to the entry of a job in a batch record and saves it.
+func (s *Store) UpdateBatchEntry(id, jobID string, fn func(entry *BatchEntry)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, err := s.GetBatch(id)
+	if err != nil {
+		return err
+	}
+	entry := batch.Entry(jobID)
+	if entry == nil {
+		return fmt.Errorf("job %s is not in batch %s", jobID, id)
+	}
+	fn(entry)
+	entry.UpdatedAt = time.Now().UTC()
+	return s.saveBatch(batch)
+}
+
+// ListBatches returns all batch records, most recently created first.
+func (s *Store) ListBatches() ([]*Batch, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, batchesDirName))
+	if os.IsNotExist(err) {
+		return []*Batch{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading batches directory: %w", err)
+	}
+	batches := make([]*Batch, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		batch, err := s.GetBatch(name)
+		if errors.Is(err, ErrBatchNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		if batches[i].CreatedAt.Equal(batches[j].CreatedAt) {
+			return batches[i].ID > batches[j].ID
+		}
+		return batches[i].CreatedAt.After(batches[j].CreatedAt)
+	})
+	return batches, nil
+}
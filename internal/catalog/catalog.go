@@ -0,0 +1,257 @@
+// Package catalog provides persistent records of the packages processed by the preservation service.
+// Each package record is stored as JSON in its own directory under the data directory,
+// alongside any reports produced for the package. Batches of packages submitted together are recorded in the
+// batches directory.
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/a3mclient"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const recordFileName = "package.json"
+
+// ErrNotFound is returned when a package record does not exist.
+var ErrNotFound = errors.New("package not found")
+
+// Record is the persistent record of a package.
+type Record struct {
+	ID               string    `json:"id"`
+	CellsPath        string    `json:"cells_path"`
+	Username         string    `json:"username"`
+	Tenant           string    `json:"tenant,omitempty"`
+	JobID            string    `json:"job_id,omitempty"`   // Queued job that preserved the package, if any
+	QueuedAt         time.Time `json:"queued_at,omitzero"` // Time the job was queued
+	Profile          string    `json:"profile,omitempty"`
+	Deselect         []string  `json:"deselect,omitempty"` // Paths or patterns removed during appraisal, as submitted
+	Title            string    `json:"title,omitempty"`
+	AIPUUID          string    `json:"aip_uuid,omitempty"`
+	AIPPath          string    `json:"aip_path,omitempty"`
+	AIPSize          int64     `json:"aip_size,omitempty"` // Size of the AIP stored in Cells, in bytes
+	AtomSlug         string    `json:"atom_slug,omitempty"`
+	ArchivesSpaceURI string    `json:"archivesspace_uri,omitempty"`
+	AccessCopiesPath string    `json:"access_copies_path,omitempty"`
+	ShareLink        string    `json:"share_link,omitempty"`
+	Replicas         []Replica `json:"replicas,omitempty"`
+	Deposits         []Deposit `json:"deposits,omitempty"`
+	Outcome          string    `json:"outcome,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+
+	// Metadata holds the Dublin Core (dc.*) and ISAD(G) (isadg.*) metadata of the package when it was submitted
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	ReviewRequired bool   `json:"review_required,omitempty"`
+	ReviewReason   string `json:"review_reason,omitempty"`
+
+	// Fingerprint is the digest of the content of the transfer, identifying the same content submitted again
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// DuplicateOf is the package that already preserved the content of the transfer
+	DuplicateOf *Duplicate `json:"duplicate_of,omitempty"`
+	// OverQuota is set when the package was refused by a quota of its tenant or workspace, it is not counted in the usage
+	OverQuota bool `json:"over_quota,omitempty"`
+
+	// Processing is the latest a3m progress of the package, per microservice
+	Processing *a3mclient.Progress `json:"processing,omitempty"`
+
+	// Checkpoint is the last stage of the pipeline the package completed, while its outputs are kept
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	// ResumedFrom is the failed package this package resumed from its checkpoint
+	ResumedFrom string `json:"resumed_from,omitempty"`
+
+	State        State         `json:"state"`
+	StateHistory []StateChange `json:"state_history"`
+
+	Events []Event `json:"events"`
+}
+
+// Replica is a copy of the AIP in a storage location.
+type Replica struct {
+	Location string `json:"location"`
+	Key      string `json:"key"`
+}
+
+// Deposit is a deposit of the access copies of the package into an access repository.
+type Deposit struct {
+	Repository string `json:"repository"`
+	URI        string `json:"uri"`
+	DOI        string `json:"doi,omitempty"`
+}
+
+// Duplicate is a package that already preserved the content of a transfer.
+type Duplicate struct {
+	PackageID string `json:"package_id"`
+	AIPUUID   string `json:"aip_uuid"`
+	CellsPath string `json:"cells_path"`
+}
+
+// Store persists package records in a directory.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+
+	onStateChange func(rec *Record, from State)
+	progress      progressHub
+}
+
+// NewStore creates a store in the given directory, creating it if necessary.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("catalog directory is not configured")
+	}
+	if err := utils.CreateDir(dir); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// OnStateChange registers a function called after every lifecycle transition of a package, with a copy of its
+// record and its previous state. It must be registered before packages are recorded.
+func (s *Store) OnStateChange(fn func(rec *Record, from State)) {
+	s.onStateChange = fn
+}
+
+// stateChanged calls the state change function, if registered, and publishes the transition.
+func (s *Store) stateChanged(rec *Record, from State) {
+	s.publish(ProgressEvent{PackageID: rec.ID, CellsPath: rec.CellsPath, Username: rec.Username, Tenant: rec.Tenant, JobID: rec.JobID, Kind: ProgressState, State: rec.State})
+	if s.onStateChange != nil {
+		s.onStateChange(rec, from)
+	}
+}
+
+// Dir returns the directory holding the record and reports of a package.
+func (s *Store) Dir(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id))
+}
+
+// Save writes a package record, replacing any previous version.
+func (s *Store) Save(rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(rec)
+}
+
+// save writes a package record, with the store locked.
+func (s *Store) save(rec *Record) error {
+	dir := s.Dir(rec.ID)
+	if err := utils.CreateDir(dir); err != nil {
+		return err
+	}
+	rec.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling package record: %w", err)
+	}
+	// Write to a temporary file and rename so readers never see a partial record
+	tmp := filepath.Join(dir, recordFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("error writing package record: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, recordFileName)); err != nil {
+		return fmt.Errorf("error replacing package record: %w", err)
+	}
+	return nil
+}
+
+// Get reads a package record.
+func (s *Store) Get(id string) (*Record, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir(id), recordFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("error reading package record: %w", err)
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("error parsing package record: %w", err)
+	}
+	return &rec, nil
+}
+
+// AddEvents appends events to the timeline of a recorded package outside of its preservation, e.g. the fixity
+// checks of its stored AIP. Returns the updated record.
+func (s *Store) AddEvents(id string, events ...Event) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		if events[i].ID == "" {
+			events[i].ID = utils.NewUUID()
+		}
+	}
+	rec.Events = append(rec.Events, events...)
+	if err := s.save(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// MoveReplica sets the key of the replica of the AIP of a recorded package in a storage location, after the AIP was
+// moved within the location, and appends events to its timeline. Returns the updated record.
+func (s *Store) MoveReplica(id, location, key string, events ...Event) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rec.Replicas {
+		if rec.Replicas[i].Location == location {
+			rec.Replicas[i].Key = key
+		}
+	}
+	for i := range events {
+		if events[i].ID == "" {
+			events[i].ID = utils.NewUUID()
+		}
+	}
+	rec.Events = append(rec.Events, events...)
+	if err := s.save(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List returns all package records, most recently created first.
+// Records created in the same instant are ordered by ID, which is chronological for time-ordered (v7) IDs.
+func (s *Store) List() ([]*Record, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog directory: %w", err)
+	}
+	records := make([]*Record, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		rec, err := s.Get(entry.Name())
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].ID > records[j].ID
+		}
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+	return records, nil
+}
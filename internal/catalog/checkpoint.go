@@ -0,0 +1,106 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// Checkpoints of the pipeline, the stages whose outputs are kept to resume a failed package.
+const (
+	// CheckpointPreprocessed is set once the transfer is ready to be submitted to A3M.
+	CheckpointPreprocessed = "preprocessed"
+	// CheckpointCharacterized is set once A3M has produced the AIP.
+	CheckpointCharacterized = "characterized"
+	// CheckpointPackaged is set once the AIP is extracted, exported and compressed, ready to be disseminated and stored.
+	CheckpointPackaged = "packaged"
+)
+
+// Checkpoints lists the checkpoints in the order of the pipeline.
+var Checkpoints = []string{CheckpointPreprocessed, CheckpointCharacterized, CheckpointPackaged}
+
+// ErrNoCheckpoint is returned when a package has no checkpoint to resume from.
+var ErrNoCheckpoint = errors.New("package has no checkpoint to resume from")
+
+// Checkpoint is the last stage of the pipeline a package completed, with the outputs of the stages so far. The
+// outputs of a failed package are kept so that it can be resumed from there.
+type Checkpoint struct {
+	Stage         string    `json:"stage"`
+	Time          time.Time `json:"time"`
+	ProcessingDir string    `json:"processing_dir"`
+	PathResolved  bool      `json:"path_resolved,omitempty"`  // Whether the Cells path of the record is resolved
+	TransferPath  string    `json:"transfer_path"`            // Transfer submitted to A3M
+	InputManifest string    `json:"input_manifest,omitempty"` // Manifest of the transfer, without the deselected files
+	A3MAIPPath    string    `json:"a3m_aip_path,omitempty"`   // AIP produced by A3M
+	AIPPath       string    `json:"aip_path,omitempty"`       // AIP uploaded to Cells
+}
+
+// Reached reports whether the checkpoint is at or past a stage. A nil checkpoint has reached no stage.
+func (c *Checkpoint) Reached(stage string) bool {
+	if c == nil {
+		return false
+	}
+	return slices.Index(Checkpoints, c.Stage) >= slices.Index(Checkpoints, stage)
+}
+
+// Check checks that the outputs of the checkpoint are still on disk.
+func (c *Checkpoint) Check() error {
+	paths := []string{c.ProcessingDir}
+	switch c.Stage {
+	case CheckpointPreprocessed:
+		paths = append(paths, c.TransferPath, c.InputManifest)
+	case CheckpointCharacterized:
+		paths = append(paths, c.A3MAIPPath, c.InputManifest)
+	case CheckpointPackaged:
+		paths = append(paths, c.AIPPath)
+	default:
+		return fmt.Errorf("unknown checkpoint %q", c.Stage)
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("output of the %s checkpoint is missing: %w", c.Stage, err)
+		}
+	}
+	return nil
+}
+
+// Checkpoint records that the package completed a stage of the pipeline, with fn setting the outputs of the stage
+// on its checkpoint. The outputs of the earlier stages are kept.
+func (r *Recorder) Checkpoint(stage string, fn func(checkpoint *Checkpoint)) {
+	r.Update(func(rec *Record) {
+		checkpoint := &Checkpoint{}
+		if rec.Checkpoint != nil {
+			*checkpoint = *rec.Checkpoint
+		}
+		checkpoint.Stage = stage
+		checkpoint.Time = time.Now().UTC()
+		fn(checkpoint)
+		rec.Checkpoint = checkpoint
+	})
+}
+
+// TakeCheckpoint removes the checkpoint of a failed package and returns it, so that its outputs are taken over by
+// the package resuming it, once. Returns ErrNotFound if the package does not exist, and ErrNoCheckpoint if it has no
+// checkpoint.
+func (s *Store) TakeCheckpoint(id string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := rec.Checkpoint
+	if checkpoint == nil {
+		return nil, ErrNoCheckpoint
+	}
+	rec.Checkpoint = nil
+	if err := s.save(rec); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
@@ -0,0 +1,86 @@
+package catalog
+
+import (
+	"sort"
+	"time"
+)
+
+// Kinds of job events.
+const (
+	JobEventQueued  = "queued"  // The job was queued
+	JobEventAttempt = "attempt" // A preservation of the package started, the attempts after the first are retries
+	JobEventState   = "state"   // The package moved to a lifecycle state
+	JobEventStage   = "stage"   // An event of the package timeline, such as a completed stage or a warning
+)
+
+// JobEvent is an entry in the lifecycle of a job, across the preservation attempts of its package.
+type JobEvent struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	PackageID  string    `json:"package_id,omitempty"` // Package record of the attempt, empty for the queued event
+	Attempt    int       `json:"attempt,omitempty"`    // Preservation attempt, from 1
+	State      State     `json:"state,omitempty"`      // State of state events
+	Type       string    `json:"type,omitempty"`       // Event type of stage events
+	Outcome    string    `json:"outcome,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"` // Duration of the stage, or time spent queued or in the state
+}
+
+// JobRecords returns the records of the packages preserved by a job, one per preservation attempt, oldest first.
+// Returns ErrNotFound if the job has not started a preservation.
+func (s *Store) JobRecords(jobID string) ([]*Record, error) {
+	records, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var found []*Record
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].JobID == jobID {
+			found = append(found, records[i])
+		}
+	}
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// JobEvents returns the lifecycle of a job from the records of its preservation attempts, oldest first: when it was
+// queued, when each attempt started, the state transitions of each attempt with the time spent in each state, and
+// the events of their timelines.
+func JobEvents(records []*Record) []JobEvent {
+	var events []JobEvent
+	for i, rec := range records {
+		attempt := i + 1
+		if i == 0 && !rec.QueuedAt.IsZero() {
+			events = append(events, JobEvent{
+				Time:       rec.QueuedAt,
+				Kind:       JobEventQueued,
+				DurationMs: rec.CreatedAt.Sub(rec.QueuedAt).Milliseconds(),
+			})
+		}
+		events = append(events, JobEvent{Time: rec.CreatedAt, Kind: JobEventAttempt, PackageID: rec.ID, Attempt: attempt, Detail: rec.CellsPath})
+		for j, change := range rec.StateHistory {
+			event := JobEvent{Time: change.Time, Kind: JobEventState, PackageID: rec.ID, Attempt: attempt, State: change.State}
+			if j+1 < len(rec.StateHistory) {
+				event.DurationMs = rec.StateHistory[j+1].Time.Sub(change.Time).Milliseconds()
+			}
+			events = append(events, event)
+		}
+		for _, e := range rec.Events {
+			events = append(events, JobEvent{
+				Time:       e.Time,
+				Kind:       JobEventStage,
+				PackageID:  rec.ID,
+				Attempt:    attempt,
+				Type:       e.Type,
+				Outcome:    e.Outcome,
+				Detail:     e.Detail,
+				DurationMs: e.DurationMs,
+			})
+		}
+	}
+	// Stages are recorded when they complete, at their start time
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
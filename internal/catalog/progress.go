@@ -0,0 +1,141 @@
+package catalog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/a3mclient"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// Progress event kinds.
+const (
+	ProgressStage    = "stage"    // A stage of the pipeline started or completed
+	ProgressUpdate   = "progress" // Progress within a stage: A3M processing or the files being stored
+	ProgressState    = "state"    // The package moved to a new lifecycle state
+	ProgressFinished = "finished" // The preservation ended, the last event of a package
+)
+
+// Stage statuses of the stage events.
+const (
+	StageStarted   = "started"
+	StageCompleted = "completed"
+)
+
+// progressBuffer is the number of events buffered for a subscriber. Events are dropped for subscribers that fall
+// further behind, so that a slow client never holds up a preservation.
+const progressBuffer = 256
+
+// ProgressEvent is a live progress event of a preservation. Progress events are not persisted, the timeline of
+// the package record keeps the completed stages.
+type ProgressEvent struct {
+	PackageID string    `json:"package_id"`
+	CellsPath string    `json:"cells_path"`
+	Username  string    `json:"username"`
+	Tenant    string    `json:"tenant,omitempty"`
+	JobID     string    `json:"job_id,omitempty"` // Queued job preserving the package, if any
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+
+	Stage      string `json:"stage,omitempty"`  // Event type of the stage, e.g. download
+	Status     string `json:"status,omitempty"` // started or completed, for stage events
+	Outcome    string `json:"outcome,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+
+	Current   string `json:"current,omitempty"`   // Current A3M job or file
+	Group     string `json:"group,omitempty"`     // Current A3M microservice group
+	Completed int    `json:"completed,omitempty"` // Completed A3M jobs or stored files
+	Failed    int    `json:"failed,omitempty"`    // Failed A3M jobs
+	Total     int    `json:"total,omitempty"`     // Files to store. Not set for A3M, which lists its jobs as they start
+	Percent   *int   `json:"percent,omitempty"`   // Set when the total is known
+
+	State State `json:"state,omitempty"` // New lifecycle state, for state events
+}
+
+// progressHub sends the progress events to the subscribers.
+type progressHub struct {
+	mu   sync.Mutex
+	subs map[chan ProgressEvent]string // Package ID of each subscriber, empty for every package
+}
+
+// Subscribe returns the progress events of a package, or of every package if id is empty, and the function ending
+// the subscription, which closes the channel.
+func (s *Store) Subscribe(id string) (<-chan ProgressEvent, func()) {
+	ch := make(chan ProgressEvent, progressBuffer)
+	s.progress.mu.Lock()
+	if s.progress.subs == nil {
+		s.progress.subs = make(map[chan ProgressEvent]string)
+	}
+	s.progress.subs[ch] = id
+	s.progress.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.progress.mu.Lock()
+			delete(s.progress.subs, ch)
+			s.progress.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish sends a progress event to the subscribers of its package without waiting.
+func (s *Store) publish(event ProgressEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	s.progress.mu.Lock()
+	defer s.progress.mu.Unlock()
+	for ch, id := range s.progress.subs {
+		if id != "" && id != event.PackageID {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+			logger.Debug("Dropped progress event of package %s for a slow subscriber", event.PackageID)
+		}
+	}
+}
+
+// publish sends a progress event of the package.
+func (r *Recorder) publish(event ProgressEvent) {
+	event.PackageID = r.record.ID
+	event.CellsPath = r.record.CellsPath
+	event.Username = r.record.Username
+	event.Tenant = r.record.Tenant
+	event.JobID = r.record.JobID
+	r.store.publish(event)
+}
+
+// Processing records the latest A3M progress of the package and publishes it.
+func (r *Recorder) Processing(progress a3mclient.Progress) {
+	if r == nil {
+		return
+	}
+	r.Update(func(rec *Record) { rec.Processing = &progress })
+	r.publish(ProgressEvent{
+		Kind:      ProgressUpdate,
+		Stage:     EventProcessing,
+		Detail:    progress.Status,
+		Current:   progress.CurrentJob,
+		Group:     progress.CurrentGroup,
+		Completed: progress.JobsCompleted,
+		Failed:    progress.JobsFailed,
+	})
+}
+
+// Progress publishes the progress of a stage processing files, with the current file.
+func (r *Recorder) Progress(stage, current string, completed, total int) {
+	if r == nil {
+		return
+	}
+	event := ProgressEvent{Kind: ProgressUpdate, Stage: stage, Current: current, Completed: completed, Total: total}
+	if total > 0 {
+		percent := completed * 100 / total
+		event.Percent = &percent
+	}
+	r.publish(event)
+}
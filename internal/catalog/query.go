@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sort fields of the package records.
+const (
+	SortCreated  = "created_at"
+	SortUpdated  = "updated_at"
+	SortState    = "state"
+	SortPath     = "cells_path"
+	SortUsername = "username"
+	SortProfile  = "profile"
+	SortOutcome  = "outcome"
+)
+
+// SortFields lists the fields package records can be sorted by.
+var SortFields = []string{SortCreated, SortUpdated, SortState, SortPath, SortUsername, SortProfile, SortOutcome}
+
+// Query selects, sorts and pages package records. Empty fields match every record.
+type Query struct {
+	Username       string
+	Tenant         string
+	Path           string // Cells path of the package
+	Workspace      string // First segment of the Cells path, e.g. personal or common-files
+	Profile        string
+	Outcome        string
+	Fingerprint    string
+	States         []State // Records in any of the states
+	ReviewRequired *bool
+	Since          time.Time // Created at or after
+	Until          time.Time // Created before
+
+	Sort      string // Sort field, created_at by default
+	Ascending bool   // Sort order, most recent or highest first by default
+	Offset    int
+	Limit     int // 0 for every record
+}
+
+// Page is a page of package records.
+type Page struct {
+	Total    int       `json:"total"` // Records matching the query, on every page
+	Offset   int       `json:"offset"`
+	Limit    int       `json:"limit"`
+	Packages []*Record `json:"packages"`
+}
+
+// Match reports whether a record matches the filters of the query.
+func (q *Query) Match(rec *Record) bool {
+	switch {
+	case q.Username != "" && rec.Username != q.Username,
+		q.Tenant != "" && rec.Tenant != q.Tenant,
+		q.Path != "" && rec.CellsPath != q.Path,
+		q.Workspace != "" && workspace(rec.CellsPath) != q.Workspace,
+		q.Profile != "" && rec.Profile != q.Profile,
+		q.Outcome != "" && rec.Outcome != q.Outcome,
+		q.Fingerprint != "" && rec.Fingerprint != q.Fingerprint,
+		len(q.States) > 0 && !slices.Contains(q.States, rec.State),
+		q.ReviewRequired != nil && rec.ReviewRequired != *q.ReviewRequired,
+		!q.Since.IsZero() && rec.CreatedAt.Before(q.Since),
+		!q.Until.IsZero() && !rec.CreatedAt.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// workspace returns the first segment of a Cells path.
+func workspace(cellsPath string) string {
+	first, _, _ := strings.Cut(strings.TrimPrefix(cellsPath, "/"), "/")
+	return first
+}
+
+// Find returns a page of the records matching a query, with the number of matching records.
+func (s *Store) Find(q Query) (*Page, error) {
+	if q.Sort == "" {
+		q.Sort = SortCreated
+	}
+	if !slices.Contains(SortFields, q.Sort) {
+		return nil, fmt.Errorf("unknown sort field: %s", q.Sort)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return nil, fmt.Errorf("offset and limit cannot be negative")
+	}
+	records, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]*Record, 0, len(records))
+	for _, rec := range records {
+		if q.Match(rec) {
+			matched = append(matched, rec)
+		}
+	}
+	// Records are listed most recent first, which breaks ties
+	slices.SortStableFunc(matched, func(a, b *Record) int {
+		c := compareRecords(a, b, q.Sort)
+		if q.Ascending {
+			return c
+		}
+		return -c
+	})
+
+	page := &Page{Total: len(matched), Offset: q.Offset, Limit: q.Limit, Packages: []*Record{}}
+	if q.Offset < len(matched) {
+		end := len(matched)
+		if q.Limit > 0 {
+			end = min(end, q.Offset+q.Limit)
+		}
+		page.Packages = matched[q.Offset:end]
+	}
+	return page, nil
+}
+
+// compareRecords compares two records on a sort field.
+func compareRecords(a, b *Record, field string) int {
+	switch field {
+	case SortUpdated:
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case SortState:
+		return cmp.Compare(slices.Index(States, a.State), slices.Index(States, b.State))
+	case SortPath:
+		return cmp.Compare(a.CellsPath, b.CellsPath)
+	case SortUsername:
+		return cmp.Compare(a.Username, b.Username)
+	case SortProfile:
+		return cmp.Compare(a.Profile, b.Profile)
+	case SortOutcome:
+		return cmp.Compare(a.Outcome, b.Outcome)
+	default:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	}
+}
@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"fmt"
+	"time"
+)
+
+// State is a stage in the OAIS aligned lifecycle of a package.
+type State string
+
+// Package lifecycle states.
+const (
+	// StateReceived is set when the package is submitted for preservation.
+	StateReceived State = "received"
+	// StateQuarantined is set once the package is held in the processing area for checks (virus scan, appraisal).
+	StateQuarantined State = "quarantined"
+	// StateCharacterized is set once A3M has identified and characterized the package contents.
+	StateCharacterized State = "characterized"
+	// StatePackaged is set once the AIP has been produced.
+	StatePackaged State = "packaged"
+	// StateStored is set once the AIP has been stored and verified.
+	StateStored State = "stored"
+	// StateReplicated is set once the AIP has been copied to replication targets.
+	StateReplicated State = "replicated"
+	// StateDisseminated is set once a DIP has been delivered to an access system.
+	StateDisseminated State = "disseminated"
+	// StateFailed is set when the preservation fails. It is terminal.
+	StateFailed State = "failed"
+	// StateCancelled is set when the preservation is cancelled by a user. It is terminal.
+	StateCancelled State = "cancelled"
+)
+
+// States lists the lifecycle states in order.
+var States = []State{StateReceived, StateQuarantined, StateCharacterized, StatePackaged, StateStored, StateReplicated, StateDisseminated, StateFailed, StateCancelled}
+
+// transitions lists the legal transitions from each state.
+// Any state except failed and cancelled can transition to failed or cancelled.
+var transitions = map[State][]State{
+	"":                 {StateReceived}, // New package
+	StateReceived:      {StateQuarantined},
+	StateQuarantined:   {StateCharacterized},
+	StateCharacterized: {StatePackaged},
+	StatePackaged:      {StateStored},
+	StateStored:        {StateReplicated, StateDisseminated},
+	StateReplicated:    {StateDisseminated},
+	StateDisseminated:  {},
+}
+
+// StateChange records a transition in the package lifecycle.
+type StateChange struct {
+	State State     `json:"state"`
+	Time  time.Time `json:"time"`
+}
+
+// CanTransition reports whether a package can move from one state to another.
+func CanTransition(from, to State) bool {
+	if to == StateFailed || to == StateCancelled {
+		return from != StateFailed && from != StateCancelled
+	}
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the package to a new lifecycle state and persists it.
+// Returns an error if the transition is not legal from the current state.
+func (r *Recorder) Transition(to State) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	from := r.record.State
+	if err := r.record.transition(to); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.save()
+	rec := *r.record
+	r.mu.Unlock()
+	// Called unlocked, so the state change function can use the recorder
+	r.store.stateChanged(&rec, from)
+	return nil
+}
+
+func (rec *Record) transition(to State) error {
+	if !CanTransition(rec.State, to) {
+		return fmt.Errorf("illegal package state transition: %s -> %s", rec.State, to)
+	}
+	rec.State = to
+	rec.StateHistory = append(rec.StateHistory, StateChange{State: to, Time: time.Now().UTC()})
+	return nil
+}
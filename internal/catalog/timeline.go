@@ -0,0 +1,319 @@
+package catalog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Event types recorded in a package timeline.
+const (
+	EventPreservation     = "preservation"
+	EventDownload         = "download"
+	EventAppraisal        = "appraisal"
+	EventPreprocessing    = "preprocessing"
+	EventExtraction       = "extraction"
+	EventVirusScan        = "virus_scan"
+	EventPIIScan          = "pii_scan"
+	EventIdentification   = "identification"
+	EventCharacterization = "characterization"
+	EventNormalization    = "normalization"
+	EventProcessing       = "processing"
+	EventPackaging        = "packaging"
+	EventFixity           = "fixity"
+	EventDissemination    = "dissemination"
+	EventStorage          = "storage"
+)
+
+// EventTypes lists the event types, in the order of the pipeline.
+var EventTypes = []string{
+	EventPreservation, EventDownload, EventAppraisal, EventPreprocessing, EventExtraction, EventVirusScan, EventPIIScan,
+	EventIdentification, EventCharacterization, EventNormalization, EventProcessing, EventPackaging, EventFixity,
+	EventDissemination, EventStorage,
+}
+
+// Event outcomes.
+const (
+	OutcomeSuccess     = "success"
+	OutcomeWarning     = "warning"
+	OutcomeFailure     = "failure"
+	OutcomeCancelled   = "cancelled"   // Preservations cancelled by a user
+	OutcomeInterrupted = "interrupted" // Preservations interrupted by a shutdown, preserved again if they were queued
+)
+
+// Prefixes of the details of fixity events. The details of the fixity checks of stored AIPs continue with the storage
+// location and the result of the check, separated by ": ", and are written to the PREMIS fixity events of the package.
+const (
+	FixityCheckDetail        = "Fixity check of the AIP in "
+	ManifestComparisonDetail = "Manifest comparison: "
+)
+
+// Event is a single entry in a package timeline.
+type Event struct {
+	ID         string    `json:"id,omitempty"`
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Outcome    string    `json:"outcome"`
+	Detail     string    `json:"detail,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+}
+
+// Filter returns the events matching the given type and outcome. Empty values match everything.
+func Filter(events []Event, eventType, outcome string, since time.Time) []Event {
+	filtered := make([]Event, 0, len(events))
+	for _, event := range events {
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+		if outcome != "" && event.Outcome != outcome {
+			continue
+		}
+		if !since.IsZero() && event.Time.Before(since) {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered
+}
+
+// Recorder appends events to a package record and persists them as they happen.
+// It is safe for concurrent use. A nil Recorder discards all events.
+type Recorder struct {
+	store  *Store
+	record *Record
+	mu     sync.Mutex
+}
+
+// NewRecorder creates the record of a new package, of a tenant if not empty, and returns a recorder for it.
+func (s *Store) NewRecorder(id, cellsPath, username, tenant string) (*Recorder, error) {
+	now := time.Now().UTC()
+	rec := &Record{
+		ID:        id,
+		CellsPath: cellsPath,
+		Username:  username,
+		Tenant:    tenant,
+		CreatedAt: now,
+		Events:    []Event{},
+	}
+	if err := rec.transition(StateReceived); err != nil {
+		return nil, err
+	}
+	if err := s.Save(rec); err != nil {
+		return nil, err
+	}
+	changed := *rec
+	s.stateChanged(&changed, "")
+	return &Recorder{store: s, record: rec}, nil
+}
+
+// ID returns the package ID.
+func (r *Recorder) ID() string {
+	if r == nil {
+		return ""
+	}
+	return r.record.ID
+}
+
+// Dir returns the directory holding the package record and reports.
+func (r *Recorder) Dir() string {
+	if r == nil {
+		return ""
+	}
+	return r.store.Dir(r.record.ID)
+}
+
+// Record returns a copy of the package record. Its slices are shared with the recorder and must not be modified.
+func (r *Recorder) Record() *Record {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := *r.record
+	return &rec
+}
+
+// Update modifies the package record and persists it.
+func (r *Recorder) Update(fn func(rec *Record)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.record)
+	r.save()
+}
+
+// Add appends an event to the timeline and publishes it as a completed stage.
+func (r *Recorder) Add(eventType, outcome, detail string) {
+	if r == nil {
+		return
+	}
+	r.add(Event{Time: time.Now().UTC(), Type: eventType, Outcome: outcome, Detail: detail})
+	r.publish(ProgressEvent{Kind: ProgressStage, Stage: eventType, Status: StageCompleted, Outcome: outcome, Detail: detail})
+}
+
+// Start records the start of a stage and returns a function that completes the event.
+// The completed event carries the stage duration and a success or failure outcome depending on err.
+// The start and completion of the stage are published.
+func (r *Recorder) Start(eventType, detail string) func(err error) {
+	if r == nil {
+		return func(error) {}
+	}
+	start := time.Now().UTC()
+	r.publish(ProgressEvent{Kind: ProgressStage, Time: start, Stage: eventType, Status: StageStarted, Detail: detail})
+	return func(err error) {
+		event := Event{
+			Time:       start,
+			Type:       eventType,
+			Outcome:    OutcomeSuccess,
+			Detail:     detail,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			event.Outcome = OutcomeFailure
+			event.Detail = err.Error()
+		}
+		r.add(event)
+		r.publish(ProgressEvent{
+			Kind:       ProgressStage,
+			Stage:      eventType,
+			Status:     StageCompleted,
+			Outcome:    event.Outcome,
+			Detail:     event.Detail,
+			DurationMs: event.DurationMs,
+		})
+	}
+}
+
+// AddEvents appends fully formed events to the timeline.
+func (r *Recorder) AddEvents(events ...Event) {
+	r.add(events...)
+}
+
+// Finish records the final outcome of the preservation. A failed preservation moves the package to the failed state.
+func (r *Recorder) Finish(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	from := r.record.State
+	event := Event{
+		ID:         utils.NewUUID(),
+		Time:       time.Now().UTC(),
+		Type:       EventPreservation,
+		Outcome:    OutcomeSuccess,
+		DurationMs: time.Since(r.record.CreatedAt).Milliseconds(),
+	}
+	r.record.Outcome = OutcomeSuccess
+	if err != nil {
+		event.Outcome = OutcomeFailure
+		event.Detail = err.Error()
+		r.record.Outcome = OutcomeFailure
+		r.record.Error = err.Error()
+		if stateErr := r.record.transition(StateFailed); stateErr != nil {
+			logger.Error("Error updating package state: %v", stateErr)
+		}
+	}
+	r.record.Events = append(r.record.Events, event)
+	r.save()
+	rec := *r.record
+	r.mu.Unlock()
+	if rec.State != from {
+		r.store.stateChanged(&rec, from)
+	}
+	r.publish(ProgressEvent{Kind: ProgressFinished, Outcome: rec.Outcome, Detail: rec.Error, State: rec.State, DurationMs: event.DurationMs})
+}
+
+// Cancel records the cancellation of the preservation by a user and moves the package to the cancelled state.
+func (r *Recorder) Cancel() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	from := r.record.State
+	r.record.Outcome = OutcomeCancelled
+	r.record.Error = ""
+	if stateErr := r.record.transition(StateCancelled); stateErr != nil {
+		logger.Error("Error updating package state: %v", stateErr)
+	}
+	r.record.Events = append(r.record.Events, Event{
+		ID:         utils.NewUUID(),
+		Time:       time.Now().UTC(),
+		Type:       EventPreservation,
+		Outcome:    OutcomeCancelled,
+		Detail:     "cancelled by user",
+		DurationMs: time.Since(r.record.CreatedAt).Milliseconds(),
+	})
+	r.save()
+	rec := *r.record
+	r.mu.Unlock()
+	if rec.State != from {
+		r.store.stateChanged(&rec, from)
+	}
+	r.publish(ProgressEvent{Kind: ProgressFinished, Outcome: rec.Outcome, Detail: "cancelled by user", State: rec.State})
+}
+
+// Interrupt records the interruption of the preservation by a shutdown. The package keeps its lifecycle state.
+func (r *Recorder) Interrupt() {
+	if r == nil {
+		return
+	}
+	const detail = "interrupted by a shutdown"
+	r.mu.Lock()
+	r.record.Outcome = OutcomeInterrupted
+	r.record.Error = ""
+	r.record.Events = append(r.record.Events, Event{
+		ID:         utils.NewUUID(),
+		Time:       time.Now().UTC(),
+		Type:       EventPreservation,
+		Outcome:    OutcomeInterrupted,
+		Detail:     detail,
+		DurationMs: time.Since(r.record.CreatedAt).Milliseconds(),
+	})
+	r.save()
+	state := r.record.State
+	r.mu.Unlock()
+	r.publish(ProgressEvent{Kind: ProgressFinished, Outcome: OutcomeInterrupted, Detail: detail, State: state})
+}
+
+func (r *Recorder) add(events ...Event) {
+	if r == nil || len(events) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range events {
+		if events[i].ID == "" {
+			events[i].ID = utils.NewUUID()
+		}
+	}
+	r.record.Events = append(r.record.Events, events...)
+	r.save()
+}
+
+// save persists the record. Failures are logged, the timeline must never break a preservation.
+func (r *Recorder) save() {
+	if err := r.store.Save(r.record); err != nil {
+		logger.Error("Error saving package record %s: %v", r.record.ID, err)
+	}
+}
+
+// Outcome returns the worst outcome recorded for an event type, or an empty string if no such event was recorded.
+func (r *Recorder) Outcome(eventType string) string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rank := map[string]int{OutcomeSuccess: 1, OutcomeWarning: 2, OutcomeFailure: 3}
+	outcome := ""
+	for _, event := range r.record.Events {
+		if event.Type == eventType && rank[event.Outcome] > rank[outcome] {
+			outcome = event.Outcome
+		}
+	}
+	return outcome
+}
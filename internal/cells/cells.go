@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +25,7 @@ type Client struct {
 	adminClient         *AdminClient                    // Cells admin client
 	cecPath             string                          // Path to cec binary. Only used for cec binary
 	httpClient          *utils.HTTPClient               // User for generating and revoking tokens
+	insecure            bool                            // Allow insecure TLS connections. Used for the event websocket
 	workspaceCollection *models.RestWorkspaceCollection // Cells workspace collection. For parsing template paths
 }
 
@@ -43,11 +45,14 @@ type UserClient struct {
 // ClientInterface defines the interface for the Cells client.
 type ClientInterface interface {
 	Close()
+	CreateShareLink(ctx context.Context, userClient UserClient, nodeUUID, label string, opts ShareLinkOptions) (string, error)
 	DownloadNode(ctx context.Context, userClient UserClient, cellsSrc, dest string) (string, error)
 	GetNodeCollection(ctx context.Context, absNodePath string) (*models.RestNodesCollection, error)
 	GetNodeStats(ctx context.Context, absNodePath string) (*models.TreeReadNodeResponse, error)
 	NewUserClient(ctx context.Context, username string, insecure bool) (UserClient, error)
-	ResolveCellsPath(userClient UserClient, cellsPath string) (string, error)   // e.g. personal-files/file -> personal/username/file
+	Ping(ctx context.Context) error
+	ResolveCellsPath(userClient UserClient, cellsPath string) (string, error) // e.g. personal-files/file -> personal/username/file
+	Subscribe(ctx context.Context, handler func(NodeEvent)) error
 	UnresolveCellsPath(userClient UserClient, cellsPath string) (string, error) // e.g. personal/username/file -> personal-files/file
 	UpdateTag(ctx context.Context, userClient UserClient, nodeUUID, namespace, content string) error
 	UploadNode(ctx context.Context, userClient UserClient, src, cellsDest string) (string, error)
@@ -73,6 +78,7 @@ func NewClient(ctx context.Context, cecPath, address, adminToken string, insecur
 		cecPath:    cecPath,
 		address:    address,
 		httpClient: httpClient,
+		insecure:   insecure,
 		adminClient: &AdminClient{
 			client: adminClient,
 			token:  adminToken,
@@ -148,6 +154,55 @@ func (c *Client) UpdateTag(ctx context.Context, userClient UserClient, nodeUUID,
 	return err
 }
 
+// ShareLinkOptions restricts the access granted by a share link. Zero values are unrestricted.
+type ShareLinkOptions struct {
+	ExpiresAt    time.Time
+	MaxDownloads int
+}
+
+// CreateShareLink creates a public share link for a node, allowing preview and download.
+// Returns the absolute URL of the link.
+// User Task. Cells SDK.
+func (c *Client) CreateShareLink(ctx context.Context, userClient UserClient, nodeUUID, label string, opts ShareLinkOptions) (string, error) {
+	link := &models.RestShareLink{
+		Label:       label,
+		RootNodes:   []*models.TreeNode{{UUID: nodeUUID}},
+		Permissions: []*models.RestShareLinkAccessType{models.RestShareLinkAccessTypePreview.Pointer(), models.RestShareLinkAccessTypeDownload.Pointer()},
+	}
+	if !opts.ExpiresAt.IsZero() {
+		link.AccessEnd = strconv.FormatInt(opts.ExpiresAt.Unix(), 10)
+	}
+	if opts.MaxDownloads > 0 {
+		link.MaxDownloads = strconv.Itoa(opts.MaxDownloads)
+	}
+
+	var result *models.RestShareLink
+	err := utils.WithRetry(func() error {
+		var err error
+		result, err = sdkPutShareLink(ctx, *userClient.client, link)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return c.shareLinkURL(result)
+}
+
+// shareLinkURL returns the absolute URL of a share link. Cells returns the link URL relative to its address.
+func (c *Client) shareLinkURL(link *models.RestShareLink) (string, error) {
+	linkURL := link.LinkURL
+	if linkURL == "" {
+		if link.LinkHash == "" {
+			return "", fmt.Errorf("share link has no URL or hash")
+		}
+		linkURL = "/public/" + link.LinkHash
+	}
+	if strings.HasPrefix(linkURL, "http://") || strings.HasPrefix(linkURL, "https://") {
+		return linkURL, nil
+	}
+	return c.address + "/" + strings.TrimPrefix(linkURL, "/"), nil
+}
+
 // GetNodeCollection gets a collection of nodes from a given path.
 // It requires the absolute, fully qualified node path.
 // Admin Task. Cells SDK.
@@ -188,6 +243,32 @@ func (c *Client) GetNodeStats(ctx context.Context, absNodePath string) (*models.
 	return result, err
 }
 
+// Ping checks that Cells can be reached and accepts the admin token, without retries.
+func (c *Client) Ping(ctx context.Context) error {
+	if _, err := sdkGetWorkspaceCollection(ctx, *c.adminClient.client); err != nil {
+		return fmt.Errorf("cells at %s not reachable: %w", c.address, err)
+	}
+	return nil
+}
+
+// Ping checks that Cells at an address can be reached and accepts an admin token, without creating a client.
+// Unlike NewClient, the request is not retried.
+func Ping(ctx context.Context, address, adminToken string, insecure bool) error {
+	url, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("error parsing address: %v", err)
+	}
+	adminClient, err := newSDKClient(url.Scheme, url.Host, "/a", insecure, adminToken)
+	if err != nil {
+		return fmt.Errorf("error creating admin client: %v", err)
+	}
+	client := &Client{
+		address:     url.Scheme + "://" + url.Host,
+		adminClient: &AdminClient{client: adminClient, token: adminToken},
+	}
+	return client.Ping(ctx)
+}
+
 // GetWorkspaceCollection get the collection of Pydio Cells workspaces.
 // Admin not required. Used as User generated after execution. Cells SDK.
 func (c *Client) getWorkspaceCollection(ctx context.Context) (*models.RestWorkspaceCollection, error) {
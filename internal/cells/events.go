@@ -0,0 +1,155 @@
+package cells
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// Node event types, as sent by the Cells event websocket.
+const (
+	NodeEventCreate        = "CREATE"
+	NodeEventRead          = "READ"
+	NodeEventUpdatePath    = "UPDATE_PATH"
+	NodeEventUpdateContent = "UPDATE_CONTENT"
+	NodeEventUpdateMeta    = "UPDATE_META"
+	NodeEventDelete        = "DELETE"
+	NodeEventUpdateUser    = "UPDATE_USER"
+)
+
+// nodeEventTypes maps the numeric event types of the tree.NodeChangeEvent protobuf enum to their names.
+var nodeEventTypes = []string{NodeEventCreate, NodeEventRead, NodeEventUpdatePath, NodeEventUpdateContent, NodeEventUpdateMeta, NodeEventDelete, NodeEventUpdateUser}
+
+const (
+	eventsPath        = "/ws/event"
+	eventsPingPeriod  = 30 * time.Second
+	eventsReadTimeout = 2 * eventsPingPeriod
+)
+
+// NodeEvent is a change of a node in Cells.
+type NodeEvent struct {
+	Type   string     `json:"-"`
+	Target *EventNode `json:"Target,omitempty"`
+	Source *EventNode `json:"Source,omitempty"`
+}
+
+// EventNode is the node of a NodeEvent.
+type EventNode struct {
+	UUID string `json:"Uuid"`
+	Path string `json:"Path"`
+	Type string `json:"Type"` // LEAF or COLLECTION
+}
+
+// UnmarshalJSON decodes a node event. The event type is sent either as its name or its enum value.
+func (e *NodeEvent) UnmarshalJSON(data []byte) error {
+	type alias NodeEvent
+	aux := struct {
+		*alias
+		Type json.RawMessage `json:"Type"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	raw := strings.Trim(string(aux.Type), `"`)
+	if n, err := strconv.Atoi(raw); err == nil {
+		if n < 0 || n >= len(nodeEventTypes) {
+			return fmt.Errorf("unknown node event type: %d", n)
+		}
+		raw = nodeEventTypes[n]
+	}
+	if raw == "" {
+		// Unset enum values are omitted
+		raw = NodeEventCreate
+	}
+	e.Type = raw
+	return nil
+}
+
+// Subscribe connects to the Cells event websocket with the admin token and calls handler for every node event,
+// until the context is cancelled or the connection is lost. Other messages (e.g. tasks and activities) are ignored.
+func (c *Client) Subscribe(ctx context.Context, handler func(NodeEvent)) error {
+	wsURL := strings.Replace(c.address, "http", "ws", 1) + eventsPath
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 30 * time.Second,
+		// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: c.insecure},
+	}
+	conn, resp, err := dialer.DialContext(ctx, wsURL, nil)
+	if resp != nil && resp.Body != nil {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Error("Failed to close response body: %v", closeErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to Cells events: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close Cells events connection: %v", err)
+		}
+	}()
+
+	if err := conn.WriteJSON(map[string]string{"@type": "subscribe", "jwt": c.adminClient.token}); err != nil {
+		return fmt.Errorf("error subscribing to Cells events: %w", err)
+	}
+	logger.Info("Subscribed to Cells events: %s", wsURL)
+
+	// Keep the connection alive, the read deadline is extended on every pong
+	if err := conn.SetReadDeadline(time.Now().Add(eventsReadTimeout)); err != nil {
+		return err
+	}
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(eventsReadTimeout))
+	})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(eventsPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// Unblock the reader
+				_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				_ = conn.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+					logger.Debug("Failed to ping Cells events: %v", err)
+				}
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("error reading Cells events: %w", err)
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(eventsReadTimeout)); err != nil {
+			return err
+		}
+		var event NodeEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			logger.Debug("Ignoring Cells event message: %v", err)
+			continue
+		}
+		if event.Target == nil && event.Source == nil {
+			// Not a node event
+			continue
+		}
+		handler(event)
+	}
+}
@@ -3,12 +3,14 @@ package cells
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net/http"
 
 	httptransport "github.com/go-openapi/runtime/client"
 	"github.com/pydio/cells-sdk-go/v4/client"
 	"github.com/pydio/cells-sdk-go/v4/client/admin_tree_service"
+	"github.com/pydio/cells-sdk-go/v4/client/share_service"
 	"github.com/pydio/cells-sdk-go/v4/client/user_meta_service"
 	"github.com/pydio/cells-sdk-go/v4/client/user_service"
 	"github.com/pydio/cells-sdk-go/v4/client/workspace_service"
@@ -37,13 +39,18 @@ func newSDKClient(scheme, host, basePath string, insecure bool, pat string) (*cl
 }
 
 func sdkUpdateUserMeta(ctx context.Context, client client.PydioCellsRestAPI, nodeUUID, namespace, content string) error {
+	// Values are stored as JSON strings
+	jsonValue, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
 	updateParams := user_meta_service.NewUpdateUserMetaParamsWithContext(ctx)
 	updateParams.Body = &models.IdmUpdateUserMetaRequest{
 		MetaDatas: []*models.IdmUserMeta{
 			{
 				NodeUUID:  nodeUUID,
 				Namespace: namespace,
-				JSONValue: fmt.Sprintf("\"%s\"", content),
+				JSONValue: string(jsonValue),
 			},
 		},
 		Operation: models.UpdateUserMetaRequestUserMetaOpPUT.Pointer(),
@@ -104,6 +111,22 @@ func sdkGetWorkspaceCollection(ctx context.Context, client client.PydioCellsRest
 	return workspacesOk.GetPayload(), nil
 }
 
+func sdkPutShareLink(ctx context.Context, client client.PydioCellsRestAPI, link *models.RestShareLink) (*models.RestShareLink, error) {
+	shareParams := share_service.NewPutShareLinkParamsWithContext(ctx)
+	shareParams.Body = &models.RestPutShareLinkRequest{
+		ShareLink: link,
+	}
+	shareOk, err := client.ShareService.PutShareLink(shareParams)
+	if err != nil {
+		return nil, fmt.Errorf("error creating share link: %v", err)
+	}
+	payload := shareOk.GetPayload()
+	if payload == nil {
+		return nil, fmt.Errorf("no payload returned when creating share link")
+	}
+	return payload, nil
+}
+
 // Not required due to passing in input from Cells
 func sdkGetUserData(ctx context.Context, client client.PydioCellsRestAPI, user string) (*models.IdmUser, error) {
 	userParams := user_service.NewGetUserParamsWithContext(ctx)
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/penwern/curate-preservation-core/internal/limits"
+)
+
+// LimitsService is the interface of the concurrency limits used by the HTTP handlers.
+type LimitsService interface {
+	Status() map[string]limits.Status
+	Set(limits map[string]int) error
+}
+
+// ConcurrencyHandler responds with the concurrency limits, by name, with the number of running and waiting
+// preservations or stages.
+func ConcurrencyHandler(svc LimitsService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, svc.Status())
+	}
+	return recoveryMiddleware(handler)
+}
+
+// SetConcurrencyHandler changes concurrency limits, e.g. {"global": 4, "normalization": 2}. Limits not in the
+// request are kept, and changes are lost on restart. Responds with the limits like ConcurrencyHandler.
+func SetConcurrencyHandler(svc LimitsService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]int
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := svc.Set(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, svc.Status())
+	}
+	return recoveryMiddleware(handler)
+}
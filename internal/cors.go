@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// anyOrigin is the allowed origin matching every origin.
+const anyOrigin = "*"
+
+// CORS answers the cross-origin requests of browser frontends served from another origin, such as the Curate UI,
+// so that no reverse proxy is needed to add the headers. Preflight requests are answered before authentication, the
+// browser does not send credentials with them. A nil CORS adds no headers.
+type CORS struct {
+	origins          []string // Without trailing slashes
+	anyOrigin        bool
+	methods          string
+	headers          string
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           string // Seconds, empty to let browsers use their default
+}
+
+// NewCORS creates the CORS policy of the HTTP API. Returns nil if no origin is allowed.
+func NewCORS(cfg *config.Config) (*CORS, error) {
+	c := cfg.CORS
+	if len(c.AllowedOrigins) == 0 {
+		return nil, nil
+	}
+	cors := &CORS{
+		methods:          strings.Join(c.AllowedMethods, ", "),
+		headers:          strings.Join(c.AllowedHeaders, ", "),
+		exposedHeaders:   strings.Join(c.ExposedHeaders, ", "),
+		allowCredentials: c.AllowCredentials,
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == anyOrigin {
+			cors.anyOrigin = true
+			continue
+		}
+		cors.origins = append(cors.origins, strings.TrimSuffix(origin, "/"))
+	}
+	if cors.anyOrigin && cors.allowCredentials {
+		// Browsers reject credentialed responses allowing any origin, and reflecting every origin would let any site
+		// call the API as the user
+		return nil, errors.New("CORS credentials require explicit allowed origins, not *")
+	}
+	if c.MaxAge > 0 {
+		cors.maxAge = strconv.Itoa(int(c.MaxAge.Seconds()))
+	}
+	return cors, nil
+}
+
+// allowed reports whether requests from the origin are allowed.
+func (c *CORS) allowed(origin string) bool {
+	return c.anyOrigin || slices.ContainsFunc(c.origins, func(o string) bool { return strings.EqualFold(o, origin) })
+}
+
+// Wrap adds the CORS headers to the responses of the handler to allowed origins, and answers their preflight
+// requests. Preflight requests from other origins are rejected, their other requests are served without the headers,
+// so that browsers block the responses.
+func (c *CORS) Wrap(next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			// Same origin or not a browser
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !c.allowed(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.anyOrigin && !c.allowCredentials {
+			h.Set("Access-Control-Allow-Origin", anyOrigin)
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.allowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if c.exposedHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.methods != "" {
+			h.Set("Access-Control-Allow-Methods", c.methods)
+		}
+		if c.headers != "" {
+			h.Set("Access-Control-Allow-Headers", c.headers)
+		}
+		if c.maxAge != "" {
+			h.Set("Access-Control-Max-Age", c.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
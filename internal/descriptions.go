@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/penwern/curate-preservation-core/internal/atom"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// ResolveResponse is the response of the AtoM slug resolution endpoint.
+// Matches lists the candidate descriptions when the reference is ambiguous.
+type ResolveResponse struct {
+	Reference string             `json:"reference"`
+	Slug      string             `json:"slug,omitempty"`
+	Matches   []atom.Description `json:"matches,omitempty"`
+}
+
+// DescriptionsHandler searches AtoM archival descriptions with the q and field (identifier or title) query parameters.
+func DescriptionsHandler(cfg *config.Config) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("q") == "" {
+			http.Error(w, "missing q parameter", http.StatusBadRequest)
+			return
+		}
+		field := query.Get("field")
+		if field == "" {
+			field = atom.SearchFieldTitle
+		}
+		if field != atom.SearchFieldIdentifier && field != atom.SearchFieldTitle {
+			http.Error(w, "invalid field parameter, expected identifier or title", http.StatusBadRequest)
+			return
+		}
+		client, ok := newAtomAPIClient(w, cfg)
+		if !ok {
+			return
+		}
+		defer client.Close()
+
+		results, err := client.SearchDescriptions(r.Context(), field, query.Get("q"))
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to search AtoM descriptions: %v", err))
+			http.Error(w, "failed to search AtoM descriptions", http.StatusBadGateway)
+			return
+		}
+		if results == nil {
+			results = []atom.Description{}
+		}
+		writeJSON(w, results)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// ResolveDescriptionHandler resolves the ref query parameter (slug, identifier or title) to an AtoM slug.
+// Ambiguous references return 409 Conflict with the candidate descriptions.
+func ResolveDescriptionHandler(cfg *config.Config) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Query().Get("ref")
+		if ref == "" {
+			http.Error(w, "missing ref parameter", http.StatusBadRequest)
+			return
+		}
+		client, ok := newAtomAPIClient(w, cfg)
+		if !ok {
+			return
+		}
+		defer client.Close()
+
+		slug, err := client.ResolveSlug(r.Context(), ref)
+		var ambiguous *atom.AmbiguousMatchError
+		switch {
+		case err == nil:
+			writeJSON(w, ResolveResponse{Reference: ref, Slug: slug})
+		case errors.As(err, &ambiguous):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			writeJSON(w, ResolveResponse{Reference: ref, Matches: ambiguous.Matches})
+		case errors.Is(err, atom.ErrDescriptionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			logger.Error(fmt.Sprintf("Failed to resolve AtoM description %s: %v", ref, err))
+			http.Error(w, "failed to resolve AtoM description", http.StatusBadGateway)
+		}
+	}
+	return recoveryMiddleware(handler)
+}
+
+// newAtomAPIClient creates an AtoM REST API client from the AtoM configuration file,
+// writing the error response if it cannot be created.
+func newAtomAPIClient(w http.ResponseWriter, cfg *config.Config) (*atom.Client, bool) {
+	atomCfg, err := config.GetAtomConfig(cfg, nil)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to load AtoM configuration: %v", err))
+		http.Error(w, "Failed to load AtoM configuration", http.StatusInternalServerError)
+		return nil, false
+	}
+	client, err := atom.NewAPIClient(atomCfg)
+	if err != nil {
+		http.Error(w, "AtoM is not configured", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return client, true
+}
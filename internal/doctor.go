@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal/health"
+	"github.com/penwern/curate-preservation-core/internal/processor"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// Diagnostic is a check of the environment of the service, with the fix suggested if it fails.
+type Diagnostic struct {
+	health.Check
+	Fix string
+	// Optional diagnostics only disable a feature when they fail, e.g. the thumbnails of a media kind.
+	Optional bool
+}
+
+// Diagnostics returns the checks of the external dependencies of a configuration: the services of ProbeChecks, the
+// ClamAV daemon, the external tools with their versions, and the permissions and free space of the directories.
+// sf is the siegfried binary, which the identify command and the PRONOM sync use.
+func Diagnostics(cfg *config.Config, files []config.File, sf string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, probe := range ProbeChecks(cfg, files) {
+		fix := probeFix(probe.Name)
+		probe.Name = "service:" + probe.Name
+		diagnostics = append(diagnostics, Diagnostic{Check: probe, Fix: fix})
+	}
+	diagnostics = append(diagnostics, Diagnostic{
+		Check: health.Check{Name: "service:clamd", Run: func(ctx context.Context) (string, error) {
+			return processor.ClamdVersion(ctx, cfg.ClamAV.Address)
+		}},
+		Fix:      "Start clamd listening on TCP or a socket and set CA4M_CLAMAV_ADDRESS, needed by profiles with av_scan",
+		Optional: true,
+	})
+
+	diagnostics = append(diagnostics,
+		toolDiagnostic("cec", cfg.Cells.CecPath, []string{"version"}, false,
+			"Install the Cells client cec and set CA4M_CELLS_CEC_PATH to it"),
+		toolDiagnostic("convert", cfg.Thumbnails.ConvertPath, []string{"-version"}, true,
+			"Install ImageMagick or set CA4M_THUMBNAILS_CONVERT_PATH, needed for image thumbnails"),
+		toolDiagnostic("pdftoppm", cfg.Thumbnails.PdftoppmPath, []string{"-v"}, true,
+			"Install Poppler (poppler-utils) or set CA4M_THUMBNAILS_PDFTOPPM_PATH, needed for PDF thumbnails"),
+		toolDiagnostic("ffmpeg", cfg.Thumbnails.FfmpegPath, []string{"-version"}, true,
+			"Install FFmpeg or set CA4M_THUMBNAILS_FFMPEG_PATH, needed for video thumbnails"),
+		Diagnostic{
+			Check: health.Check{Name: "tool:sf", Run: func(ctx context.Context) (string, error) {
+				return siegfriedVersion(ctx, sf)
+			}},
+			Fix:      "Install siegfried and its signatures (pronom sync), needed to identify PRONOM formats with identify and to sync PRONOM",
+			Optional: true,
+		},
+	)
+	for _, file := range files {
+		switch c := file.Config.(type) {
+		case *config.AtomConfig:
+			if c.DeliveryMethod == "" || c.DeliveryMethod == "rsync" {
+				diagnostics = append(diagnostics, toolDiagnostic("rsync", "rsync", []string{"--version"}, false,
+					"Install rsync, needed to deliver DIPs to AtoM, or set the delivery_method of the AtoM file to sftp"))
+			}
+		case *config.AIPStorageConfig:
+			for _, location := range c.Locations {
+				if location.Backend != config.StorageBackendRclone || location.Rclone == nil {
+					continue
+				}
+				binary := location.Rclone.Binary
+				if binary == "" {
+					binary = "rclone"
+				}
+				diagnostics = append(diagnostics, toolDiagnostic("rclone:"+location.Name, binary, []string{"version"}, false,
+					"Install rclone, or set the rclone binary of the storage location "+location.Name))
+			}
+		}
+	}
+
+	dirs := []struct{ name, dir, setting string }{
+		{"processing_dir", cfg.ProcessingBaseDir, "CA4M_PROCESSING_BASE_DIR"},
+		{"data_dir", cfg.DataDir, "CA4M_DATA_DIR"},
+		{"a3m_completed_dir", cfg.A3M.CompletedDir, "CA4M_A3M_COMPLETED_DIR"},
+		{"a3m_dips_dir", cfg.A3M.DipsDir, "CA4M_A3M_DIPS_DIR"},
+	}
+	var spaceDirs []string
+	for _, d := range dirs {
+		if d.dir == "" {
+			continue
+		}
+		// Missing directories fail their permission check
+		if _, err := os.Stat(d.dir); err == nil && !slices.Contains(spaceDirs, d.dir) {
+			spaceDirs = append(spaceDirs, d.dir)
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Check: health.Writable("dir:"+d.name, d.dir),
+			Fix:   fmt.Sprintf("Create %s and give the user running the service write access to it, or set %s", d.dir, d.setting),
+		})
+	}
+	minFree := uint64(max(cfg.Health.MinFreeSpaceGB, 0)) << 30
+	diagnostics = append(diagnostics, Diagnostic{
+		Check: health.FreeSpace("disk_space", minFree, spaceDirs...),
+		Fix: "Free space on the file systems of the directories, e.g. remove the outputs kept of failed packages that won't " +
+			"be resumed, or lower CA4M_HEALTH_MIN_FREE_SPACE_GB",
+	})
+	return diagnostics
+}
+
+// probeFix returns the fix suggested when a service of ProbeChecks cannot be reached.
+func probeFix(name string) string {
+	switch {
+	case name == "a3m":
+		return "Start a3m and check CA4M_A3M_ADDRESS; a3m must share the processing directory and its completed and dips directories"
+	case name == "cells":
+		return "Check CA4M_CELLS_ADDRESS and CA4M_CELLS_ADMIN_TOKEN, and use --allow-insecure-tls for self-signed certificates in tests"
+	case name == "atom":
+		return "Check the host and API key of the AtoM file set by CA4M_ATOM_CONFIG_PATH"
+	case name == "storage_service":
+		return "Check the URL, user and API key of the Storage Service file set by CA4M_STORAGE_SERVICE_CONFIG_PATH"
+	case strings.HasPrefix(name, "storage:"):
+		return "Check the backend, credentials and path of the storage location in the file set by CA4M_AIP_STORAGE_CONFIG_PATH"
+	default:
+		return ""
+	}
+}
+
+// toolDiagnostic returns the diagnostic of an external tool: it is found on the PATH, and runs with the version
+// arguments. The first line of its output is reported.
+func toolDiagnostic(name, tool string, versionArgs []string, optional bool, fix string) Diagnostic {
+	return Diagnostic{
+		Check: health.Check{Name: "tool:" + name, Run: func(ctx context.Context) (string, error) {
+			output, err := runTool(ctx, tool, versionArgs...)
+			if err != nil {
+				return "", err
+			}
+			line, _, _ := strings.Cut(output, "\n")
+			return strings.TrimSpace(line), nil
+		}},
+		Fix:      fix,
+		Optional: optional,
+	}
+}
+
+// siegfriedVersion returns the version of siegfried and the signature file it loads.
+func siegfriedVersion(ctx context.Context, sf string) (string, error) {
+	output, err := runTool(ctx, sf, "-version")
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) < 2 || !strings.Contains(lines[1], ".sig") {
+		return strings.TrimSpace(lines[0]), errors.New("no signature file is loaded")
+	}
+	return strings.TrimSpace(lines[0]) + ", signatures " + strings.TrimSpace(lines[1]), nil
+}
+
+// runTool runs an external tool found on the PATH and returns its output, as some tools print their version to
+// stderr.
+func runTool(ctx context.Context, tool string, args ...string) (string, error) {
+	if tool == "" {
+		return "", errors.New("tool is not set")
+	}
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return "", fmt.Errorf("%s not found: %w", tool, err)
+	}
+	output, err := exec.CommandContext(ctx, path, args...).CombinedOutput() // #nosec G204 -- the tools are configured by the operator
+	if err != nil {
+		return "", fmt.Errorf("error running %s: %w: %s", path, err, bytes.TrimSpace(output))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
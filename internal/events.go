@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	// Reconnection backoff of the Cells event subscription
+	eventsMinBackoff = 5 * time.Second
+	eventsMaxBackoff = 5 * time.Minute
+)
+
+// EventWatcher preserves packages uploaded into the watched Cells folders.
+// Every folder or file created directly inside a watched folder is a package. A package is queued for preservation
+// once no new events were received for it during the settle delay, so uploads are complete before it is preserved.
+// Settled packages are added to the job queue of the service, packages already queued or being preserved are skipped.
+type EventWatcher struct {
+	svc    *Service
+	cfg    *config.Config
+	paths  []string
+	settle time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer // Packages waiting for their upload to settle
+}
+
+// NewEventWatcher creates a watcher for the Cells folders configured in the events configuration.
+func NewEventWatcher(svc *Service) *EventWatcher {
+	cfg := svc.cfg
+	paths := make([]string, 0, len(cfg.Events.Paths))
+	archive := strings.Trim(cfg.Cells.ArchiveWorkspace, "/")
+	for _, p := range cfg.Events.Paths {
+		p = strings.Trim(path.Clean("/"+strings.TrimSpace(p)), "/")
+		if p == "" {
+			continue
+		}
+		// Uploaded AIPs would be preserved again
+		if archive != "" && (p == archive || strings.HasPrefix(p, archive+"/") || strings.HasPrefix(archive, p+"/")) {
+			logger.Warn("Not watching %s: it overlaps the archive workspace %s", p, archive)
+			continue
+		}
+		paths = append(paths, p)
+	}
+	settle := cfg.Events.SettleDelay
+	if settle <= 0 {
+		settle = time.Minute
+	}
+	return &EventWatcher{
+		svc:     svc,
+		cfg:     cfg,
+		paths:   paths,
+		settle:  settle,
+		pending: make(map[string]*time.Timer),
+	}
+}
+
+// Run subscribes to Cells node events and queues the uploaded packages until the context is cancelled.
+// The subscription is re-established with a backoff when the connection is lost.
+func (w *EventWatcher) Run(ctx context.Context) {
+	if len(w.paths) == 0 {
+		logger.Warn("Cells events enabled but no folders are watched")
+		return
+	}
+	if w.cfg.Events.Username == "" {
+		logger.Warn("Cells events enabled but no username is set for the preservations")
+		return
+	}
+	logger.Info("Watching Cells folders for packages: %s", strings.Join(w.paths, ", "))
+
+	backoff := eventsMinBackoff
+	for ctx.Err() == nil {
+		connected := time.Now()
+		err := w.svc.svc.SubscribeNodeEvents(ctx, w.handle)
+		if ctx.Err() != nil {
+			break
+		}
+		// Only back off further if the connection did not last
+		if time.Since(connected) > eventsMaxBackoff {
+			backoff = eventsMinBackoff
+		}
+		logger.Warn("Cells event subscription lost, reconnecting in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, eventsMaxBackoff)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for pkg, timer := range w.pending {
+		timer.Stop()
+		delete(w.pending, pkg)
+	}
+}
+
+// handle (re)starts the settle timer of the package a node event belongs to.
+// Only uploads, content changes and moves trigger preservations; metadata changes (e.g. our own tags) are ignored.
+func (w *EventWatcher) handle(event cells.NodeEvent) {
+	switch event.Type {
+	case cells.NodeEventCreate, cells.NodeEventUpdateContent, cells.NodeEventUpdatePath:
+	default:
+		return
+	}
+	if event.Target == nil {
+		return
+	}
+	pkg := w.packagePath(event.Target.Path)
+	if pkg == "" {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if timer, ok := w.pending[pkg]; ok {
+		timer.Reset(w.settle)
+		return
+	}
+	logger.Info("Package upload detected: %s", pkg)
+	w.pending[pkg] = time.AfterFunc(w.settle, func() { w.enqueue(pkg) })
+}
+
+// packagePath returns the package a node belongs to, or an empty string if it is not inside a watched folder.
+// Hidden nodes, such as the .pydio files Cells creates in folders, are ignored.
+func (w *EventWatcher) packagePath(nodePath string) string {
+	nodePath = strings.Trim(nodePath, "/")
+	if strings.HasPrefix(path.Base(nodePath), ".") {
+		return ""
+	}
+	for _, watched := range w.paths {
+		rel, ok := strings.CutPrefix(nodePath, watched+"/")
+		if !ok || rel == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(rel, "/")
+		return watched + "/" + name
+	}
+	return ""
+}
+
+func (w *EventWatcher) enqueue(pkg string) {
+	w.mu.Lock()
+	delete(w.pending, pkg)
+	w.mu.Unlock()
+	job := &queue.Job{
+		ID:       "cells:" + pkg,
+		Username: w.cfg.Events.Username,
+		Path:     pkg,
+		Profile:  w.cfg.Events.Profile,
+	}
+	if err := w.svc.Enqueue(context.Background(), job); err != nil {
+		logger.Error("Error queuing package %s: %v", pkg, err)
+	}
+}
@@ -0,0 +1,309 @@
+// Package export converts AIPs to the submission formats of other preservation systems.
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	opexNamespace   = "http://www.openpreservationexchange.org/opex/v1.2"
+	oaiDCNamespace  = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	dcNamespace     = "http://purl.org/dc/elements/1.1/"
+	opexExtension   = ".opex"
+	partialPrefix   = ".partial-"
+	opexFixityType  = "SHA-256"
+	opexContentType = "content"
+	opexMetaType    = "metadata"
+)
+
+// dcElements are the Dublin Core elements exported as descriptive metadata, in schema order.
+var dcElements = []string{
+	"title", "creator", "subject", "description", "publisher", "contributor", "date", "type",
+	"format", "identifier", "source", "language", "relation", "coverage", "rights",
+}
+
+// OPEXPackage describes the AIP exported as an OPEX package.
+type OPEXPackage struct {
+	AIPUUID  string
+	Title    string
+	Metadata map[string]string // Dublin Core metadata keyed as in metadata.json (e.g. dc.title)
+}
+
+type opexMetadata struct {
+	XMLName             xml.Name         `xml:"opex:OPEXMetadata"`
+	Xmlns               string           `xml:"xmlns:opex,attr"`
+	Transfer            *opexTransfer    `xml:"opex:Transfer,omitempty"`
+	Properties          *opexProperties  `xml:"opex:Properties,omitempty"`
+	DescriptiveMetadata *opexDescriptive `xml:"opex:DescriptiveMetadata,omitempty"`
+}
+
+type opexTransfer struct {
+	SourceID string        `xml:"opex:SourceID,omitempty"`
+	Manifest *opexManifest `xml:"opex:Manifest,omitempty"`
+	Fixities *opexFixities `xml:"opex:Fixities,omitempty"`
+}
+
+type opexManifest struct {
+	Files   *opexFiles   `xml:"opex:Files,omitempty"`
+	Folders *opexFolders `xml:"opex:Folders,omitempty"`
+}
+
+type opexFiles struct {
+	Files []opexFile `xml:"opex:File"`
+}
+
+type opexFolders struct {
+	Folders []string `xml:"opex:Folder"`
+}
+
+type opexFixities struct {
+	Fixities []opexFixity `xml:"opex:Fixity"`
+}
+
+type opexIdentifiers struct {
+	Identifiers []opexIdentifier `xml:"opex:Identifier"`
+}
+
+type opexFile struct {
+	Type string `xml:"type,attr"`
+	Size int64  `xml:"size,attr,omitempty"`
+	Name string `xml:",chardata"`
+}
+
+type opexFixity struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type opexProperties struct {
+	Title              string           `xml:"opex:Title,omitempty"`
+	Description        string           `xml:"opex:Description,omitempty"`
+	SecurityDescriptor string           `xml:"opex:SecurityDescriptor,omitempty"`
+	Identifiers        *opexIdentifiers `xml:"opex:Identifiers,omitempty"`
+}
+
+type opexIdentifier struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type opexDescriptive struct {
+	DC oaiDC `xml:"oai_dc:dc"`
+}
+
+type oaiDC struct {
+	XmlnsOAIDC string      `xml:"xmlns:oai_dc,attr"`
+	XmlnsDC    string      `xml:"xmlns:dc,attr"`
+	Elements   []dcElement `xml:",any"`
+}
+
+type dcElement struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// ExportOPEX exports the objects of an extracted AIP as an OPEX package in the target directory.
+// The package is a folder named after the AIP with a folder OPEX listing its contents, the AIP METS as a
+// metadata file and a sidecar OPEX with the SHA-256 fixity of every object. It is written under a temporary
+// name and renamed once complete, so incremental ingest never picks up a partial package.
+// Returns the path of the exported package.
+func ExportOPEX(ctx context.Context, aipPath string, cfg *config.ExportConfig, pkg OPEXPackage) (string, error) {
+	name := filepath.Base(aipPath)
+	dest := filepath.Join(cfg.TargetDir, name)
+	if _, err := os.Stat(dest); err == nil {
+		return "", fmt.Errorf("export already exists: %s", dest)
+	}
+	partial := filepath.Join(cfg.TargetDir, partialPrefix+name)
+	if err := os.RemoveAll(partial); err != nil {
+		return "", fmt.Errorf("error removing previous partial export: %w", err)
+	}
+	if err := utils.CreateDir(partial); err != nil {
+		return "", err
+	}
+
+	if err := writeRootFolder(ctx, aipPath, partial, name, cfg, pkg); err != nil {
+		removePartial(partial)
+		return "", err
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		removePartial(partial)
+		return "", fmt.Errorf("error moving export into place: %w", err)
+	}
+	return dest, nil
+}
+
+// writeRootFolder exports the AIP objects and METS to the root folder and writes the root folder OPEX
+// with the package properties and descriptive metadata.
+func writeRootFolder(ctx context.Context, aipPath, root, name string, cfg *config.ExportConfig, pkg OPEXPackage) error {
+	manifest, err := copyOPEXFolder(ctx, filepath.Join(aipPath, "data", "objects"), root)
+	if err != nil {
+		return fmt.Errorf("error exporting AIP objects: %w", err)
+	}
+
+	mets, err := filepath.Glob(filepath.Join(aipPath, "data", "METS.*.xml"))
+	if err != nil {
+		return err
+	}
+	if len(mets) == 0 {
+		logger.Warn("No METS file found in AIP: %s", aipPath)
+	}
+	for _, metsPath := range mets {
+		if _, _, err := copyFile(metsPath, filepath.Join(root, filepath.Base(metsPath))); err != nil {
+			return fmt.Errorf("error exporting AIP METS: %w", err)
+		}
+		manifest.addFiles(opexFile{Type: opexMetaType, Name: filepath.Base(metsPath)})
+	}
+
+	security := cfg.SecurityDescriptor
+	if security == "" {
+		security = config.DefaultSecurityDescriptor
+	}
+	properties := &opexProperties{
+		Title:              pkg.Title,
+		Description:        pkg.Metadata["dc.description"],
+		SecurityDescriptor: security,
+		Identifiers:        &opexIdentifiers{Identifiers: []opexIdentifier{{Type: "AIP UUID", Value: pkg.AIPUUID}}},
+	}
+	if identifier := pkg.Metadata["dc.identifier"]; identifier != "" {
+		properties.Identifiers.Identifiers = append(properties.Identifiers.Identifiers, opexIdentifier{Type: "code", Value: identifier})
+	}
+	rootOPEX := &opexMetadata{
+		Transfer:   &opexTransfer{SourceID: pkg.AIPUUID, Manifest: manifest},
+		Properties: properties,
+	}
+	if dc := dublinCore(pkg.Metadata); dc != nil {
+		rootOPEX.DescriptiveMetadata = &opexDescriptive{DC: *dc}
+	}
+	return writeOPEX(filepath.Join(root, name+opexExtension), rootOPEX)
+}
+
+// copyOPEXFolder copies the contents of src to dest, writing a sidecar OPEX with the fixity of every file and a
+// folder OPEX (<folder>.opex inside the folder) for every subfolder. Returns the manifest of dest.
+func copyOPEXFolder(ctx context.Context, src, dest string) (*opexManifest, error) {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &opexManifest{}
+	for _, entry := range entries {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		srcPath := filepath.Join(src, entry.Name())
+		destPath := filepath.Join(dest, entry.Name())
+		switch {
+		case entry.IsDir():
+			if err := utils.CreateDir(destPath); err != nil {
+				return nil, err
+			}
+			subManifest, err := copyOPEXFolder(ctx, srcPath, destPath)
+			if err != nil {
+				return nil, err
+			}
+			err = writeOPEX(filepath.Join(destPath, entry.Name()+opexExtension), &opexMetadata{
+				Transfer:   &opexTransfer{Manifest: subManifest},
+				Properties: &opexProperties{Title: entry.Name()},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if manifest.Folders == nil {
+				manifest.Folders = &opexFolders{}
+			}
+			manifest.Folders.Folders = append(manifest.Folders.Folders, entry.Name())
+		case entry.Type().IsRegular():
+			size, checksum, err := copyFile(srcPath, destPath)
+			if err != nil {
+				return nil, err
+			}
+			err = writeOPEX(destPath+opexExtension, &opexMetadata{
+				Transfer:   &opexTransfer{Fixities: &opexFixities{Fixities: []opexFixity{{Type: opexFixityType, Value: checksum}}}},
+				Properties: &opexProperties{Title: entry.Name()},
+			})
+			if err != nil {
+				return nil, err
+			}
+			manifest.addFiles(
+				opexFile{Type: opexContentType, Size: size, Name: entry.Name()},
+				opexFile{Type: opexMetaType, Name: entry.Name() + opexExtension},
+			)
+		}
+	}
+	return manifest, nil
+}
+
+func (m *opexManifest) addFiles(files ...opexFile) {
+	if m.Files == nil {
+		m.Files = &opexFiles{}
+	}
+	m.Files.Files = append(m.Files.Files, files...)
+}
+
+// copyFile copies a file and returns its size and SHA-256 checksum.
+func copyFile(src, dest string) (int64, string, error) {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(out, io.TeeReader(in, hash))
+	if err != nil {
+		_ = out.Close()
+		return 0, "", err
+	}
+	if err := out.Close(); err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// dublinCore builds the oai_dc record of the package metadata. Returns nil if there is no Dublin Core metadata.
+func dublinCore(metadata map[string]string) *oaiDC {
+	dc := &oaiDC{XmlnsOAIDC: oaiDCNamespace, XmlnsDC: dcNamespace}
+	for _, element := range dcElements {
+		if value := metadata["dc."+element]; value != "" {
+			dc.Elements = append(dc.Elements, dcElement{XMLName: xml.Name{Local: "dc:" + element}, Value: value})
+		}
+	}
+	if len(dc.Elements) == 0 {
+		return nil
+	}
+	return dc
+}
+
+func writeOPEX(path string, metadata *opexMetadata) error {
+	metadata.Xmlns = opexNamespace
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling OPEX: %w", err)
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), data...), 0o600)
+}
+
+func removePartial(path string) {
+	if err := os.RemoveAll(path); err != nil {
+		logger.Error("Failed to remove partial export: %v", err)
+	}
+}
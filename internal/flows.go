@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// FlowsService is the interface of the Cells Flows integration used by the HTTP handler.
+type FlowsService interface {
+	SubmitFlowJobs(ctx context.Context, req *FlowJobRequest) ([]FlowJob, error)
+}
+
+// FlowJobRequest is the request of a Cells Flow action to preserve the nodes it was triggered on.
+// Nodes are passed as resolved paths, like the nodes of the /preserve endpoint.
+type FlowJobRequest struct {
+	Username    string      `json:"username" validate:"required"` // Cells user the packages are preserved as
+	Nodes       []NodeAlias `json:"nodes,omitempty" validate:"dive"`
+	Paths       []string    `json:"paths,omitempty"` // Resolved Cells paths, e.g. common-files/preserve/box-12
+	Profile     string      `json:"profile,omitempty"`
+	Deselect    []string    `json:"deselect,omitempty"`
+	CallbackURL string      `json:"callback_url,omitempty"` // Receives the outcome of each package
+	Reference   string      `json:"reference,omitempty"`    // Returned in the callbacks, e.g. the ID of the Flow run
+	// Priority of the jobs in the queue, normal by default
+	Priority queue.Priority `json:"priority,omitempty"`
+}
+
+// Validate checks the request: a username, and paths or nodes. Invalid fields are returned as a *ValidationError.
+func (r *FlowJobRequest) Validate() error {
+	verr := validateFields(r)
+	if len(r.Paths) == 0 && len(r.Nodes) == 0 {
+		verr.add("paths", "required_without", "is required without nodes")
+	}
+	return verr.err()
+}
+
+// FlowJob is a package queued by a Flow. Queued is false if the same package was already queued by the same Flow run.
+type FlowJob struct {
+	ID     string `json:"id"`
+	Path   string `json:"path"`
+	Queued bool   `json:"queued"`
+}
+
+// FlowJobsResponse is the response of FlowJobsHandler.
+type FlowJobsResponse struct {
+	Jobs []FlowJob `json:"jobs"`
+}
+
+// SubmitFlowJobs queues the preservation of the nodes of a Flow, for the tenant of the context if it has one. The
+// callback URL must be allowed, see Callback.
+func (s *Service) SubmitFlowJobs(ctx context.Context, req *FlowJobRequest) ([]FlowJob, error) {
+	if s.queue == nil {
+		return nil, errors.New("job queue is not open")
+	}
+	callback, err := s.Callback(req.CallbackURL, req.Reference)
+	if err != nil {
+		return nil, err
+	}
+	paths := req.Paths
+	for _, node := range req.Nodes {
+		paths = append(paths, node.Path)
+	}
+	tenant := preservation.TenantFromContext(ctx)
+	jobs := make([]FlowJob, 0, len(paths))
+	for _, path := range paths {
+		// The reference makes the ID unique per Flow run, so a package can be submitted again by a later run
+		id := "flows:" + path
+		if req.Reference != "" {
+			id = "flows:" + req.Reference + ":" + path
+		}
+		id = tenantJobID(tenant, id)
+		job := &queue.Job{
+			ID:       id,
+			Username: req.Username,
+			Tenant:   tenant,
+			Path:     path,
+			Profile:  req.Profile,
+			Deselect: req.Deselect,
+			QueuedAt: time.Now().UTC(),
+			Callback: callback,
+			Priority: req.Priority,
+		}
+		if err := s.admitJob(job); err != nil {
+			return jobs, fmt.Errorf("error queuing %s: %w", path, err)
+		}
+		err := s.queue.Enqueue(ctx, job)
+		if err != nil && !errors.Is(err, queue.ErrDuplicate) {
+			return jobs, fmt.Errorf("error queuing %s: %w", path, err)
+		}
+		jobs = append(jobs, FlowJob{ID: id, Path: path, Queued: err == nil})
+		if err == nil {
+			logger.Info("Package queued for preservation by a Cells Flow: %s", path)
+		}
+	}
+	return jobs, nil
+}
+
+// FlowJobsHandler queues the preservation of the nodes of a Cells Flow. Responds with 202 Accepted and the queued
+// jobs, the outcome of each package is posted to the callback URL once it is preserved.
+func FlowJobsHandler(svc FlowsService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req FlowJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		jobs, err := svc.SubmitFlowJobs(r.Context(), &req)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to submit flow jobs: %v", err))
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, errCallbackNotAllowed):
+				status = http.StatusBadRequest
+			case errors.Is(err, preservation.ErrQuotaExceeded):
+				status = quotaErrorStatus(err)
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		writeJSON(w, FlowJobsResponse{Jobs: jobs})
+	}
+	return recoveryMiddleware(handler)
+}
@@ -0,0 +1,571 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	preservationv1 "github.com/penwern/curate-preservation-core/common/proto/curate/gen/go/curate/preservation/v1"
+	"github.com/penwern/curate-preservation-core/internal/audit"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/reporting"
+)
+
+// grpcMethod is a method of the gRPC API. Like the routes of the HTTP API, it requires a role, and submissions are
+// rate limited and refused while the intake is paused.
+type grpcMethod struct {
+	Operation string // Action recorded in the audit log
+	Role      string
+	Global    bool // Serves the whole service, refused to users bound to a tenant
+	Limited   bool
+	Read      bool // Only recorded in the audit log when denied, unless every read is audited
+}
+
+// grpcMethods are the methods of the gRPC API, by full method name.
+var grpcMethods = map[string]grpcMethod{
+	preservationv1.JobService_SubmitJobs_FullMethodName: {Operation: "grpcSubmitJobs", Role: config.RoleSubmitter, Limited: true},
+	preservationv1.JobService_GetJob_FullMethodName:     {Operation: "grpcGetJob", Role: config.RoleViewer, Read: true},
+	preservationv1.JobService_WatchJob_FullMethodName:   {Operation: "grpcWatchJob", Role: config.RoleViewer, Read: true},
+	preservationv1.JobService_CancelJob_FullMethodName:  {Operation: "grpcCancelJob", Role: config.RoleOperator},
+	// Agents run the jobs of every tenant, so tenant users are refused. They poll for jobs and renew their leases
+	// continuously, only their results are audited
+	preservationv1.AgentService_AcquireJob_FullMethodName:  {Operation: "grpcAcquireJob", Role: config.RoleAdmin, Global: true, Read: true},
+	preservationv1.AgentService_RenewLease_FullMethodName:  {Operation: "grpcRenewLease", Role: config.RoleAdmin, Global: true, Read: true},
+	preservationv1.AgentService_CompleteJob_FullMethodName: {Operation: "grpcCompleteJob", Role: config.RoleAdmin, Global: true},
+}
+
+// NewGRPCServer creates the server of the gRPC API, serving the job API of the service, and the queued jobs to the
+// remote worker agents if they are enabled. Calls are authenticated, rate limited and audited like the requests of
+// the HTTP API, and served over TLS if tlsConfig is set. Watches end when the streams context is done.
+func NewGRPCServer(svc *Service, auth *Authenticator, limiter *RateLimiter, auditor *Auditor, tlsConfig *tls.Config, streams context.Context) *grpc.Server {
+	guard := &grpcGuard{auth: auth, limiter: limiter, auditor: auditor, paused: svc.IntakePaused}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(guard.unary),
+		grpc.ChainStreamInterceptor(guard.stream),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	preservationv1.RegisterJobServiceServer(server, &jobServer{svc: svc, streams: streams})
+	if svc.agents != nil {
+		preservationv1.RegisterAgentServiceServer(server, &agentServer{svc: svc})
+	}
+	return server
+}
+
+// stopGRPC stops the gRPC server, waiting up to the timeout for the calls in progress before closing them.
+func stopGRPC(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		logger.Warn("gRPC calls still in progress after %s, closing them", timeout)
+		server.Stop()
+	}
+}
+
+// grpcGuard authenticates, rate limits and audits the calls of the gRPC API.
+type grpcGuard struct {
+	auth    *Authenticator
+	limiter *RateLimiter
+	auditor *Auditor
+	paused  func() (bool, time.Duration)
+}
+
+func (g *grpcGuard) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	ctx, done := g.audit(ctx, info.FullMethod)
+	defer func() { done(err) }()
+	defer recoverCall(info.FullMethod, &err)
+	if ctx, err = g.admit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (g *grpcGuard) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx, done := g.audit(ss.Context(), info.FullMethod)
+	defer func() { done(err) }()
+	defer recoverCall(info.FullMethod, &err)
+	if ctx, err = g.admit(ctx, info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, &guardedStream{ServerStream: ss, ctx: ctx})
+}
+
+// guardedStream is a server stream with the context of its authenticated call.
+type guardedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *guardedStream) Context() context.Context {
+	return s.ctx
+}
+
+// recoverCall turns a panic of a call into an internal error, like recoveryMiddleware for the HTTP handlers.
+func recoverCall(method string, err *error) {
+	if r := recover(); r != nil {
+		logger.Error(fmt.Sprintf("Panic recovered in gRPC handler - Method: %s, Error: %v", method, r))
+		reporting.CapturePanic(r, reporting.Context{Request: method})
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
+
+// admit authenticates a call, then refuses it if its method is rate limited and the intake is paused or the client
+// exceeded its rate. Returns the context of the call with its user and tenant.
+func (g *grpcGuard) admit(ctx context.Context, fullMethod string) (context.Context, error) {
+	method, ok := grpcMethods[fullMethod]
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "unknown method %s", fullMethod)
+	}
+	ctx, err := g.auth.requireCall(ctx, fullMethod, method.Role)
+	if err != nil {
+		return nil, err
+	}
+	if principal := PrincipalFromContext(ctx); method.Global && principal != nil && principal.Tenant != "" {
+		logger.Warn("Denied %s to %s: not available to tenant %s", fullMethod, principal.Username, principal.Tenant)
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+	if !method.Limited {
+		return ctx, nil
+	}
+	if paused, retryAfter := g.paused(); paused {
+		if retryAfter > 0 {
+			return nil, status.Errorf(codes.Unavailable, "%s, retry in %s", errIntakePaused, retryAfter.Round(time.Second))
+		}
+		return nil, status.Error(codes.Unavailable, errIntakePaused)
+	}
+	if g.limiter != nil {
+		client := "ip:" + peerAddr(ctx)
+		if principal := PrincipalFromContext(ctx); principal != nil {
+			client = principal.Subject
+		}
+		if wait := g.limiter.reserve(client); wait > 0 {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %s", wait.Round(time.Second))
+		}
+	}
+	return ctx, nil
+}
+
+// audit notes the user of a call once it is authenticated, and returns the function recording the call in the audit
+// log with its outcome. Reads are only recorded if they are denied, unless every read is audited.
+func (g *grpcGuard) audit(ctx context.Context, fullMethod string) (context.Context, func(error)) {
+	a := g.auditor
+	if a == nil {
+		return ctx, func(error) {}
+	}
+	started := time.Now()
+	req := &auditedRequest{}
+	ctx = context.WithValue(ctx, auditedRequestKey{}, req)
+	return ctx, func(err error) {
+		httpStatus := grpcHTTPStatus(status.Code(err))
+		outcome := audit.OutcomeOf(httpStatus)
+		if grpcMethods[fullMethod].Read && outcome != audit.OutcomeDenied && !a.reads {
+			return
+		}
+		entry := &audit.Entry{
+			Time:       started.UTC(),
+			Action:     grpcMethods[fullMethod].Operation,
+			Method:     http.MethodPost,
+			Path:       fullMethod,
+			Address:    peerAddr(ctx),
+			Status:     httpStatus,
+			Outcome:    outcome,
+			DurationMs: time.Since(started).Milliseconds(),
+		}
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			entry.UserAgent = strings.Join(md.Get("user-agent"), " ")
+		}
+		if principal := req.principal; principal != nil {
+			entry.Subject = principal.Subject
+			entry.Username = principal.Username
+			entry.Role = principal.Role
+			entry.Tenant = principal.Tenant
+		}
+		if err := a.log.Record(entry); err != nil {
+			logger.Error("Failed to record %s by %s in the audit log: %v", fullMethod, entry.Username, err)
+		}
+	}
+}
+
+// grpcHTTPStatus returns the HTTP status matching the code of a gRPC call, as recorded in the audit log.
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted, codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499 // Client closed the call, as logged by nginx
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// requireCall authenticates a gRPC call like Require authenticates a request: with the bearer token of its
+// authorization metadata, or the verified TLS client certificate of its connection. The user must have the given
+// role or a higher one. Returns the context of the call, scoped to the tenant of the user.
+func (a *Authenticator) requireCall(ctx context.Context, method, role string) (context.Context, error) {
+	if a == nil {
+		return ctx, nil
+	}
+	var principal *Principal
+	if rawToken, ok := callBearerToken(ctx); ok {
+		var err error
+		principal, err = a.Authenticate(ctx, rawToken)
+		if errors.Is(err, errNoTenant) {
+			noteAuditPrincipal(ctx, principal)
+			logger.Warn("Denied %s to %s: %v", method, principal.Username, err)
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
+		}
+		if err != nil {
+			logger.Warn("Rejected token for %s from %s: %v", method, peerAddr(ctx), err)
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+	} else if principal = a.clientCertPrincipal(callTLSState(ctx)); principal == nil {
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	noteAuditPrincipal(ctx, principal)
+	if !config.HasRole(principal.Role, role) {
+		logger.Warn("Denied %s to %s: role %q, %s required", method, principal.Username, principal.Role, role)
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+	if principal.Tenant != "" && a.tenants.Tenant(principal.Tenant) == nil {
+		logger.Warn("Denied %s to %s: unknown tenant %q", method, principal.Username, principal.Tenant)
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+	logger.Debug("Authenticated %s (%s) for %s", principal.Username, principal.Role, method)
+	ctx = context.WithValue(ctx, principalKey{}, principal)
+	return preservation.WithTenant(ctx, principal.Tenant), nil
+}
+
+// callBearerToken returns the bearer token of the authorization metadata of a call.
+func callBearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// callTLSState returns the TLS state of the connection of a call, or nil if it is not served over TLS.
+func callTLSState(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return &info.State
+}
+
+// peerAddr returns the client address of a call.
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// jobServer serves the job API of the service over gRPC.
+type jobServer struct {
+	preservationv1.UnimplementedJobServiceServer
+	svc     *Service
+	streams context.Context // Done when the server shuts down, ending the watches
+}
+
+// SubmitJobs queues the preservation of packages, for the tenant of the context if it has one. Like the jobs of a
+// Cells Flow, a package is queued once per reference, and its result is posted to the callback URL if there is one.
+func (j *jobServer) SubmitJobs(ctx context.Context, req *preservationv1.SubmitJobsRequest) (*preservationv1.SubmitJobsResponse, error) {
+	verr := &ValidationError{}
+	if req.GetUsername() == "" {
+		verr.add("username", "required", "is required")
+	}
+	if len(req.GetPaths()) == 0 {
+		verr.add("paths", "min", "must have at least 1 element")
+	}
+	validateMetadata(verr, "metadata", req.GetMetadata())
+	priority, ok := grpcPriorities[req.GetPriority()]
+	if !ok {
+		verr.add("priority", "oneof", "is not a known priority")
+	}
+	if err := verr.err(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if j.svc.queue == nil {
+		return nil, status.Error(codes.Unavailable, "job queue is not open")
+	}
+	callback, err := j.svc.Callback(req.GetCallbackUrl(), req.GetReference())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	tenant := preservation.TenantFromContext(ctx)
+	resp := &preservationv1.SubmitJobsResponse{}
+	for _, path := range req.GetPaths() {
+		key := path
+		if req.GetSource() != "" {
+			key = req.GetSource() + ":" + path
+		}
+		// The reference makes the ID unique per submission, so a package can be submitted again with another one
+		id := "grpc:" + key
+		if req.GetReference() != "" {
+			id = "grpc:" + req.GetReference() + ":" + key
+		}
+		id = tenantJobID(tenant, id)
+		job := &queue.Job{
+			ID:       id,
+			Username: req.GetUsername(),
+			Tenant:   tenant,
+			Path:     path,
+			Source:   req.GetSource(),
+			Profile:  req.GetProfile(),
+			Deselect: req.GetDeselect(),
+			QueuedAt: time.Now().UTC(),
+			Metadata: req.GetMetadata(),
+			Callback: callback,
+			Priority: priority,
+		}
+		if err := j.svc.admitJob(job); err != nil {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		err := j.svc.queue.Enqueue(ctx, job)
+		if err != nil && !errors.Is(err, queue.ErrDuplicate) {
+			logger.Error("Failed to queue %s submitted over gRPC: %v", path, err)
+			return nil, status.Errorf(codes.Internal, "error queuing %s: %v", path, err)
+		}
+		resp.Jobs = append(resp.Jobs, &preservationv1.SubmittedJob{Id: id, Path: path, Queued: err == nil})
+		if err == nil {
+			logger.Info("Package queued for preservation over gRPC: %s", path)
+		}
+	}
+	return resp, nil
+}
+
+// grpcPriorities are the queue priorities of the priorities of the gRPC API.
+var grpcPriorities = map[preservationv1.Priority]queue.Priority{
+	preservationv1.Priority_PRIORITY_UNSPECIFIED: queue.PriorityNormal,
+	preservationv1.Priority_PRIORITY_LOW:         queue.PriorityLow,
+	preservationv1.Priority_PRIORITY_NORMAL:      queue.PriorityNormal,
+	preservationv1.Priority_PRIORITY_HIGH:        queue.PriorityHigh,
+	preservationv1.Priority_PRIORITY_URGENT:      queue.PriorityUrgent,
+}
+
+// GetJob returns the status of a job. Tenants only find their own jobs.
+func (j *jobServer) GetJob(ctx context.Context, req *preservationv1.GetJobRequest) (*preservationv1.Job, error) {
+	return j.job(ctx, req.GetId())
+}
+
+// WatchJob streams the status of a job, then the progress of its package until it finishes. The progress is only
+// streamed while the job runs on this instance, the jobs running on other instances are read again periodically.
+func (j *jobServer) WatchJob(req *preservationv1.WatchJobRequest, stream grpc.ServerStreamingServer[preservationv1.JobEvent]) error {
+	ctx := stream.Context()
+	// Subscribe before reading the job, so that no event is missed in between
+	var events <-chan catalog.ProgressEvent
+	if store := j.svc.Catalog(); store != nil {
+		var unsubscribe func()
+		events, unsubscribe = store.Subscribe("")
+		defer unsubscribe()
+	}
+	job, err := j.job(ctx, req.GetId())
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&preservationv1.JobEvent{Job: job}); err != nil || jobFinished(job) {
+		return err
+	}
+
+	recheck := time.NewTicker(jobWatchRecheck)
+	defer recheck.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-j.streams.Done():
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-recheck.C:
+			current, err := j.job(ctx, job.Id)
+			if err != nil {
+				return err
+			}
+			if current.Status == job.Status && current.State == job.State && current.PackageId == job.PackageId {
+				continue
+			}
+			job = current
+			if err := stream.Send(&preservationv1.JobEvent{Job: job}); err != nil || jobFinished(job) {
+				return err
+			}
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.Unavailable, "progress stream closed")
+			}
+			if event.JobID != job.Id {
+				continue
+			}
+			applyProgress(job, &event)
+			if err := stream.Send(&preservationv1.JobEvent{Job: job, Progress: jobProgress(&event)}); err != nil || jobFinished(job) {
+				return err
+			}
+		}
+	}
+}
+
+// CancelJob cancels a queued or running job, like the DELETE /jobs/{id} endpoint.
+func (j *jobServer) CancelJob(ctx context.Context, req *preservationv1.CancelJobRequest) (*preservationv1.CancelJobResponse, error) {
+	id := req.GetId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	cancellation, err := j.svc.CancelJob(ctx, id)
+	switch {
+	case errors.Is(err, queue.ErrNotFound):
+		return nil, status.Error(codes.NotFound, "job not found")
+	case errors.Is(err, queue.ErrRunning):
+		return nil, status.Error(codes.FailedPrecondition, "job is running on another instance")
+	case err != nil:
+		logger.Error(fmt.Sprintf("Failed to cancel job %s: %v", id, err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &preservationv1.CancelJobResponse{Id: id, Status: cancellation}, nil
+}
+
+// job returns the status of a job. Tenants only find their own jobs.
+func (j *jobServer) job(ctx context.Context, id string) (*preservationv1.Job, error) {
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	js, err := j.svc.JobStatus(ctx, id)
+	if errors.Is(err, errJobNotFound) {
+		return nil, status.Error(codes.NotFound, "job not found")
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to read the status of job %s: %v", id, err))
+		return nil, status.Error(codes.Internal, "failed to read package record")
+	}
+	job := &preservationv1.Job{
+		Id:             js.ID,
+		Status:         grpcJobStatuses[js.Status],
+		PackageId:      js.PackageID,
+		CellsPath:      js.CellsPath,
+		State:          string(js.State),
+		AipUuid:        js.AIPUUID,
+		Error:          js.Error,
+		ReviewRequired: js.ReviewRequired,
+	}
+	if js.UpdatedAt != nil {
+		job.UpdatedAt = timestamppb.New(*js.UpdatedAt)
+	}
+	return job, nil
+}
+
+// grpcJobStatuses maps the statuses of the jobs to their gRPC values.
+var grpcJobStatuses = map[string]preservationv1.JobStatus{
+	JobStatusPending:   preservationv1.JobStatus_JOB_STATUS_PENDING,
+	JobStatusRunning:   preservationv1.JobStatus_JOB_STATUS_RUNNING,
+	JobStatusCompleted: preservationv1.JobStatus_JOB_STATUS_COMPLETED,
+	JobStatusFailed:    preservationv1.JobStatus_JOB_STATUS_FAILED,
+	JobStatusCancelled: preservationv1.JobStatus_JOB_STATUS_CANCELLED,
+}
+
+// jobFinished reports whether a job has its final status.
+func jobFinished(job *preservationv1.Job) bool {
+	switch job.Status {
+	case preservationv1.JobStatus_JOB_STATUS_COMPLETED, preservationv1.JobStatus_JOB_STATUS_FAILED, preservationv1.JobStatus_JOB_STATUS_CANCELLED:
+		return true
+	}
+	return false
+}
+
+// applyProgress updates the status of a job with a progress event of its package.
+func applyProgress(job *preservationv1.Job, event *catalog.ProgressEvent) {
+	job.PackageId = event.PackageID
+	job.CellsPath = event.CellsPath
+	job.UpdatedAt = timestamppb.New(event.Time)
+	if event.State != "" {
+		job.State = string(event.State)
+	}
+	switch event.Kind {
+	case catalog.ProgressFinished:
+		job.Status = grpcJobStatuses[outcomeJobStatus(event.Outcome)]
+		job.Error = event.Detail
+	default:
+		job.Status = preservationv1.JobStatus_JOB_STATUS_RUNNING
+	}
+}
+
+// jobProgress returns the progress message of a progress event.
+func jobProgress(event *catalog.ProgressEvent) *preservationv1.Progress {
+	progress := &preservationv1.Progress{
+		Kind:       event.Kind,
+		Time:       timestamppb.New(event.Time),
+		Stage:      event.Stage,
+		Status:     event.Status,
+		Outcome:    event.Outcome,
+		Detail:     event.Detail,
+		DurationMs: event.DurationMs,
+		Current:    event.Current,
+		Group:      event.Group,
+		Completed:  int32(event.Completed), // #nosec G115 -- counts of jobs and files
+		Failed:     int32(event.Failed),    // #nosec G115
+		Total:      int32(event.Total),     // #nosec G115
+		State:      string(event.State),
+	}
+	if event.Percent != nil {
+		percent := int32(*event.Percent) // #nosec G115 -- between 0 and 100
+		progress.Percent = &percent
+	}
+	return progress
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/penwern/curate-preservation-core/internal/health"
+)
+
+// HealthChecker is the interface of the dependency checks used by the readiness handler.
+type HealthChecker interface {
+	Check(ctx context.Context) *health.Report
+}
+
+// NewHealthChecker returns the readiness checks of the service: its shutdown state, the services preservations
+// depend on, the job queue, and the writability and free space of the processing and data directories.
+func (s *Service) NewHealthChecker() *health.Checker {
+	checks := []health.Check{
+		{Name: "service", Run: func(context.Context) (string, error) {
+			if s.ShuttingDown() {
+				return "", ErrShuttingDown
+			}
+			return "", nil
+		}},
+	}
+	checks = append(checks, s.svc.HealthChecks()...)
+	if s.queue != nil {
+		checks = append(checks, health.Check{Name: "queue", Run: func(ctx context.Context) (string, error) {
+			return s.cfg.Queue.Backend, s.queue.Ping(ctx)
+		}})
+	}
+	dirs := []string{s.cfg.ProcessingBaseDir}
+	checks = append(checks, health.Writable("processing_dir", s.cfg.ProcessingBaseDir))
+	if s.cfg.DataDir != "" {
+		dirs = append(dirs, s.cfg.DataDir)
+		checks = append(checks, health.Writable("data_dir", s.cfg.DataDir))
+	}
+	if minFree := s.cfg.Health.MinFreeSpaceGB; minFree > 0 {
+		checks = append(checks, health.FreeSpace("disk_space", uint64(minFree)<<30, dirs...))
+	}
+	return health.NewChecker(checks, s.cfg.Health.Timeout, s.cfg.Health.CacheTTL)
+}
+
+// LivenessHandler responds while the server can handle requests, whatever the state of the dependencies: restarting
+// the service would not fix them.
+func LivenessHandler() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, map[string]string{"status": health.StatusOK})
+	}
+	return recoveryMiddleware(handler)
+}
+
+// ReadinessHandler responds with the result of each dependency check, with status 503 if a check failed or the
+// service shuts down.
+func ReadinessHandler(checker HealthChecker) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+		if !report.OK() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		writeJSON(w, report)
+	}
+	return recoveryMiddleware(handler)
+}
@@ -0,0 +1,12 @@
+package health
+
+import "syscall"
+
+// freeSpace returns the bytes available to unprivileged users on the file system of a directory.
+func freeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil //nolint:gosec // Block sizes are positive
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package health
+
+import "errors"
+
+// freeSpace returns the bytes available on the file system of a directory, which is only supported on Linux.
+func freeSpace(_ string) (uint64, error) {
+	return 0, errors.New("free space checks are only supported on Linux")
+}
@@ -0,0 +1,183 @@
+// Package health checks the dependencies of the service, for the readiness probes of orchestrators such as
+// Kubernetes and for monitoring. Checks run concurrently, each with a timeout, and their report is reused for a
+// short time so that frequent probes don't load the dependencies.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Statuses of the checks and reports.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check checks a dependency. Run returns an optional detail, such as the free space of a disk, or an error if the
+// dependency is not usable.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (string, error)
+}
+
+// Result is the result of a check.
+type Result struct {
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"duration_ms"`
+}
+
+// Report is the result of every check. Its status is ok if every check passed.
+type Report struct {
+	Status    string             `json:"status"`
+	CheckedAt time.Time          `json:"checked_at"`
+	Checks    map[string]*Result `json:"checks"`
+}
+
+// OK reports whether every check passed.
+func (r *Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs checks and caches their report.
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu     sync.Mutex
+	report *Report
+}
+
+// NewChecker creates a checker running each check with a timeout, and reusing its report for cacheTTL.
+func NewChecker(checks []Check, timeout, cacheTTL time.Duration) *Checker {
+	return &Checker{checks: checks, timeout: timeout, cacheTTL: cacheTTL}
+}
+
+// Check runs the checks, or returns the last report if it is more recent than the cache TTL.
+// Concurrent calls wait for the same run.
+func (c *Checker) Check(ctx context.Context) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.report != nil && time.Since(c.report.CheckedAt) < c.cacheTTL {
+		return c.report
+	}
+	// The report is shared by the waiting callers, it is not cancelled with the request of the first
+	c.report = Run(context.WithoutCancel(ctx), c.checks, c.timeout)
+	return c.report
+}
+
+// Run runs checks concurrently, each with a timeout.
+func Run(ctx context.Context, checks []Check, timeout time.Duration) *Report {
+	report := &Report{Status: StatusOK, CheckedAt: time.Now(), Checks: make(map[string]*Result, len(checks))}
+	results := make([]*Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, check, timeout)
+		}()
+	}
+	wg.Wait()
+	for i, check := range checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// run runs a check with a timeout. Checks ignoring their context are reported as failed once it is done.
+func run(ctx context.Context, check Check, timeout time.Duration) *Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		detail, err := check.Run(ctx)
+		done <- outcome{detail, err}
+	}()
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+
+	result := &Result{Status: StatusOK, Detail: out.detail, Duration: time.Since(start).Milliseconds()}
+	if out.err != nil {
+		result.Status = StatusFail
+		result.Error = out.err.Error()
+	}
+	return result
+}
+
+// Writable returns a check that a directory exists and files can be created in it.
+func Writable(name, dir string) Check {
+	return Check{Name: name, Run: func(context.Context) (string, error) {
+		if dir == "" {
+			return "", errors.New("directory is not set")
+		}
+		file, err := os.CreateTemp(dir, ".health-*")
+		if err != nil {
+			return "", fmt.Errorf("directory is not writable: %w", err)
+		}
+		_ = file.Close()
+		if err := os.Remove(file.Name()); err != nil {
+			return "", fmt.Errorf("error removing test file: %w", err)
+		}
+		return dir, nil
+	}}
+}
+
+// FreeSpace returns a check that the file systems of directories have at least minFree bytes available.
+func FreeSpace(name string, minFree uint64, dirs ...string) Check {
+	return Check{Name: name, Run: func(context.Context) (string, error) {
+		detail := ""
+		var low []string
+		for _, dir := range dirs {
+			free, err := freeSpace(dir)
+			if err != nil {
+				return detail, fmt.Errorf("error reading free space of %s: %w", dir, err)
+			}
+			if detail != "" {
+				detail += ", "
+			}
+			detail += fmt.Sprintf("%s: %s free", dir, formatBytes(free))
+			if free < minFree {
+				low = append(low, dir)
+			}
+		}
+		if len(low) > 0 {
+			return detail, fmt.Errorf("less than %s free in %v", formatBytes(minFree), low)
+		}
+		return detail, nil
+	}}
+}
+
+// FreeBytes returns the bytes available on the file system of a directory. Only supported on Linux.
+func FreeBytes(dir string) (uint64, error) {
+	return freeSpace(dir)
+}
+
+// formatBytes formats a size in GiB, or MiB below 1 GiB.
+func formatBytes(n uint64) string {
+	const mib = 1 << 20
+	if n < 1<<30 {
+		return fmt.Sprintf("%d MiB", n/mib)
+	}
+	return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+}
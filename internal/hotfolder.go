@@ -0,0 +1,370 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// hotFolderProcessing is the directory of the hot folder holding the transfers whose jobs have not finished.
+const hotFolderProcessing = ".processing"
+
+// HotFolder preserves the transfers dropped into a local directory.
+// Every folder or file created directly inside the directory is a transfer. Once it stayed unchanged during the settle
+// delay, it is moved aside, copied to the Cells destination and queued for preservation. When its job finishes, the
+// transfer is moved to the processed or the failed directory. Hidden entries are ignored, so that transfers can be
+// copied under a hidden name and renamed once complete.
+type HotFolder struct {
+	svc          *Service
+	dir          string
+	processing   string
+	processedDir string
+	failedDir    string
+	settle       time.Duration
+	interval     time.Duration
+
+	seen    map[string]*hotFolderEntry // Transfers waiting to settle, by name
+	running map[string]string          // Job IDs of the transfers being preserved, by name
+}
+
+// hotFolderEntry is the last observed state of a transfer waiting to settle.
+type hotFolderEntry struct {
+	size    int64
+	files   int
+	modTime time.Time
+	since   time.Time // When the transfer was last seen changing
+}
+
+// NewHotFolder creates a watcher for the hot folder of the configuration.
+func NewHotFolder(svc *Service) *HotFolder {
+	cfg := svc.cfg.HotFolder
+	dir := absPath(cfg.Dir)
+	processedDir := absPath(cfg.ProcessedDir)
+	if cfg.ProcessedDir == "" {
+		processedDir = filepath.Join(dir, "processed")
+	}
+	failedDir := absPath(cfg.FailedDir)
+	if cfg.FailedDir == "" {
+		failedDir = filepath.Join(dir, "failed")
+	}
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &HotFolder{
+		svc:          svc,
+		dir:          dir,
+		processing:   filepath.Join(dir, hotFolderProcessing),
+		processedDir: processedDir,
+		failedDir:    failedDir,
+		settle:       max(cfg.SettleDelay, 0),
+		interval:     interval,
+		seen:         make(map[string]*hotFolderEntry),
+		running:      make(map[string]string),
+	}
+}
+
+// Run scans the hot folder and follows the jobs of its transfers until the context is cancelled. Transfers left
+// being preserved by a previous run are followed again, and queued again if their job was lost.
+func (h *HotFolder) Run(ctx context.Context) error {
+	cfg := h.svc.cfg.HotFolder
+	if cfg.Dir == "" || cfg.Destination == "" || cfg.Username == "" {
+		return errors.New("the hot folder directory, destination and username are required")
+	}
+	if info, err := os.Stat(h.dir); err != nil {
+		return fmt.Errorf("error reading hot folder: %w", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("hot folder %s is not a directory", h.dir)
+	}
+	for _, dir := range []string{h.processing, h.processedDir, h.failedDir} {
+		if err := utils.CreateDir(dir); err != nil {
+			return fmt.Errorf("error creating %s: %w", dir, err)
+		}
+	}
+	if err := h.resume(ctx); err != nil {
+		return err
+	}
+	logger.Info("Watching hot folder %s for transfers, copied to %s", h.dir, cfg.Destination)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		h.scan(ctx)
+		h.follow(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Plan is a dry run of Run: it scans the hot folder once and returns the actions watching it would take with the
+// transfers it holds, without moving, copying or queuing them.
+func (h *HotFolder) Plan() ([]preservation.PlannedAction, error) {
+	cfg := h.svc.cfg.HotFolder
+	if cfg.Dir == "" || cfg.Destination == "" || cfg.Username == "" {
+		return nil, errors.New("the hot folder directory, destination and username are required")
+	}
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hot folder: %w", err)
+	}
+	var actions []preservation.PlannedAction
+	for _, dir := range []string{h.processing, h.processedDir, h.failedDir} {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			actions = append(actions, preservation.PlannedAction{Stage: catalog.EventPreservation, Action: "Create directory " + dir})
+		}
+	}
+	if processing, err := os.ReadDir(h.processing); err == nil {
+		for _, entry := range processing {
+			actions = append(actions, preservation.PlannedAction{
+				Stage:  catalog.EventPreservation,
+				Action: "Follow the job of transfer " + entry.Name() + ", submitting it again if it was lost",
+			})
+		}
+	}
+	profile := "the profile of its path"
+	if cfg.Profile != "" {
+		profile = "profile " + cfg.Profile
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || h.isOutputDir(filepath.Join(h.dir, name)) {
+			continue
+		}
+		size, files, _, err := transferStats(filepath.Join(h.dir, name))
+		if err != nil {
+			logger.Warn("Error reading transfer %s: %v", name, err)
+			continue
+		}
+		actions = append(actions,
+			preservation.PlannedAction{
+				Stage:  catalog.EventStorage,
+				Action: fmt.Sprintf("Copy transfer %s to Cells once unchanged for %s: %s (%d files, %d bytes)", name, h.settle, cfg.Destination, files, size),
+			},
+			preservation.PlannedAction{
+				Stage:  catalog.EventPreservation,
+				Action: fmt.Sprintf("Preserve %s as %s with %s, then move it to %s, or %s if it fails", name, cfg.Username, profile, h.processedDir, h.failedDir),
+			},
+		)
+	}
+	return actions, nil
+}
+
+// resume follows the jobs of the transfers moved aside by a previous run. Transfers whose job is neither queued nor
+// known from a package record, e.g. lost with the in-memory queue, are submitted again.
+func (h *HotFolder) resume(ctx context.Context) error {
+	entries, err := os.ReadDir(h.processing)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", h.processing, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		id := hotFolderJobID(name)
+		job, err := h.svc.JobStatus(ctx, id)
+		lost := errors.Is(err, errJobNotFound)
+		if err != nil && !lost {
+			logger.Error("Error reading the job of transfer %s: %v", name, err)
+			continue
+		}
+		// Interrupted jobs are pending with a record, and queued again unless the queue was lost
+		if !lost && job.Status == JobStatusPending {
+			queued, err := h.svc.queuedJob(ctx, id)
+			if err != nil {
+				logger.Error("Error reading the job of transfer %s: %v", name, err)
+				continue
+			}
+			lost = !queued
+		}
+		if lost {
+			logger.Info("Job of transfer %s was lost, submitting it again", name)
+			h.submit(ctx, name)
+			continue
+		}
+		h.running[name] = id
+	}
+	return nil
+}
+
+// scan submits the transfers of the hot folder that stayed unchanged during the settle delay.
+func (h *HotFolder) scan(ctx context.Context) {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		logger.Error("Error reading hot folder %s: %v", h.dir, err)
+		return
+	}
+	now := time.Now()
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if ctx.Err() != nil {
+			return
+		}
+		if strings.HasPrefix(name, ".") || h.isOutputDir(filepath.Join(h.dir, name)) {
+			continue
+		}
+		if _, ok := h.running[name]; ok {
+			// Waits for the transfer of the same name to finish
+			continue
+		}
+		present[name] = true
+		size, files, modTime, err := transferStats(filepath.Join(h.dir, name))
+		if err != nil {
+			// Removed or still being written, e.g. without read permissions yet
+			logger.Debug("Error reading transfer %s: %v", name, err)
+			delete(h.seen, name)
+			continue
+		}
+		seen, ok := h.seen[name]
+		if !ok {
+			logger.Info("Transfer detected in hot folder: %s", name)
+		}
+		if !ok || seen.size != size || seen.files != files || !seen.modTime.Equal(modTime) {
+			h.seen[name] = &hotFolderEntry{size: size, files: files, modTime: modTime, since: now}
+			continue
+		}
+		if now.Sub(seen.since) < h.settle {
+			continue
+		}
+		delete(h.seen, name)
+		if err := os.Rename(filepath.Join(h.dir, name), filepath.Join(h.processing, name)); err != nil {
+			logger.Error("Error moving transfer %s aside: %v", name, err)
+			continue
+		}
+		h.submit(ctx, name)
+	}
+	for name := range h.seen {
+		if !present[name] {
+			delete(h.seen, name)
+		}
+	}
+}
+
+// submit copies a transfer moved aside to the Cells destination and queues its preservation. Transfers that cannot be
+// submitted are moved to the failed directory.
+func (h *HotFolder) submit(ctx context.Context, name string) {
+	cfg := h.svc.cfg.HotFolder
+	localPath := filepath.Join(h.processing, name)
+	err := func() error {
+		userClient, err := h.svc.svc.NewUserClient(ctx, cfg.Username)
+		if err != nil {
+			return fmt.Errorf("failed to get user client: %w", err)
+		}
+		cellsPath, err := h.svc.svc.PushTransfer(ctx, userClient, localPath, cfg.Destination)
+		if err != nil {
+			return err
+		}
+		return h.svc.Enqueue(ctx, &queue.Job{
+			ID:       hotFolderJobID(name),
+			Username: cfg.Username,
+			Path:     cellsPath,
+			Profile:  cfg.Profile,
+		})
+	}()
+	if err != nil {
+		if ctx.Err() != nil {
+			// Submitted again on the next start
+			return
+		}
+		logger.Error("Error submitting transfer %s: %v", name, err)
+		h.move(name, h.failedDir)
+		return
+	}
+	h.running[name] = hotFolderJobID(name)
+}
+
+// follow moves the transfers whose job finished to the processed or the failed directory.
+func (h *HotFolder) follow(ctx context.Context) {
+	for name, id := range h.running {
+		job, err := h.svc.JobStatus(ctx, id)
+		// A job taken from the queue is not found until the instance or agent running it records its package
+		if errors.Is(err, errJobNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.Error("Error reading the job of transfer %s: %v", name, err)
+			continue
+		}
+		if !job.Finished() {
+			continue
+		}
+		delete(h.running, name)
+		if job.Status == JobStatusCompleted {
+			h.move(name, h.processedDir)
+			continue
+		}
+		logger.Warn("Transfer %s was not preserved (%s): %s", name, job.Status, job.Error)
+		h.move(name, h.failedDir)
+	}
+}
+
+// move moves a transfer moved aside to a directory. A timestamp is appended to its name if the directory already has
+// an entry of that name.
+func (h *HotFolder) move(name, dir string) {
+	dest := filepath.Join(dir, name)
+	if _, err := os.Lstat(dest); err == nil {
+		dest += "-" + time.Now().Format("20060102T150405")
+	}
+	if err := os.Rename(filepath.Join(h.processing, name), dest); err != nil {
+		logger.Error("Error moving transfer %s to %s: %v", name, dir, err)
+		return
+	}
+	logger.Info("Moved transfer %s to %s", name, dest)
+}
+
+// isOutputDir reports whether a path is the processed or the failed directory.
+func (h *HotFolder) isOutputDir(p string) bool {
+	return p == h.processedDir || p == h.failedDir
+}
+
+// absPath returns the absolute path of a path, or the cleaned path if it cannot be made absolute.
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return filepath.Clean(p)
+}
+
+// hotFolderJobID returns the ID of the job of a hot folder transfer.
+func hotFolderJobID(name string) string {
+	return "hotfolder:" + name
+}
+
+// transferStats returns the total size, the number of files and the latest modification time of a transfer.
+func transferStats(root string) (int64, int, time.Time, error) {
+	var (
+		size    int64
+		files   int
+		modTime time.Time
+	)
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		if !d.IsDir() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files, modTime, err
+}
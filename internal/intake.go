@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/internal/source"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// IntakeService is the interface of the presigned upload intake used by the HTTP handlers.
+type IntakeService interface {
+	CreateUpload(ctx context.Context, name string, size int64) (*source.Upload, error)
+	CompleteUpload(ctx context.Context, req *CompleteUploadRequest) error
+	AbortUpload(ctx context.Context, req *AbortUploadRequest) error
+}
+
+// CreateUploadRequest is the request to start the upload of a transfer.
+type CreateUploadRequest struct {
+	Name string `json:"name" validate:"required"` // File name of the transfer, e.g. a ZIP or tar archive
+	Size int64  `json:"size" validate:"gt=0"`     // Size of the transfer in bytes
+}
+
+// CompleteUploadRequest is the request to complete the upload of a transfer and preserve it.
+type CompleteUploadRequest struct {
+	Path        string                 `json:"path" validate:"required"`
+	UploadID    string                 `json:"upload_id" validate:"required"`
+	Parts       []source.CompletedPart `json:"parts" validate:"min=1"`
+	Username    string                 `json:"username" validate:"required"` // Cells user the transfer is preserved as
+	Profile     string                 `json:"profile,omitempty"`
+	Priority    queue.Priority         `json:"priority,omitempty"`
+	CallbackURL string                 `json:"callback_url,omitempty"` // Receives the result of the preservation
+	Reference   string                 `json:"reference,omitempty"`    // Returned in the callback
+}
+
+// AbortUploadRequest is the request to cancel the upload of a transfer.
+type AbortUploadRequest struct {
+	Path     string `json:"path" validate:"required"`
+	UploadID string `json:"upload_id" validate:"required"`
+}
+
+// CreateUploadHandler starts a presigned upload. The response lists the URL each part is PUT to.
+func CreateUploadHandler(svc IntakeService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req CreateUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		if err := validateFields(&req).err(); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		upload, err := svc.CreateUpload(r.Context(), req.Name, req.Size)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to create upload: %v", err))
+			http.Error(w, err.Error(), intakeErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, upload)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// CompleteUploadHandler completes a presigned upload and queues the preservation of the transfer.
+// Responds with 202 Accepted once the upload is assembled, the preservation runs in the background.
+func CompleteUploadHandler(svc IntakeService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req CompleteUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		if err := validateFields(&req).err(); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		if err := svc.CompleteUpload(r.Context(), &req); err != nil {
+			logger.Error(fmt.Sprintf("Failed to complete upload: %v", err))
+			http.Error(w, err.Error(), intakeErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// AbortUploadHandler cancels a presigned upload and discards its uploaded parts.
+func AbortUploadHandler(svc IntakeService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req AbortUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		if err := validateFields(&req).err(); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		if err := svc.AbortUpload(r.Context(), &req); err != nil {
+			logger.Error(fmt.Sprintf("Failed to abort upload: %v", err))
+			http.Error(w, err.Error(), intakeErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// intakeErrorStatus returns the response status of an intake error: 403 if the upload is not accessible to the
+// tenant of the user, 400 if the callback URL is not allowed, 413 or 429 if the transfer is over a quota, 500
+// otherwise.
+func intakeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, preservation.ErrTenantAccess):
+		return http.StatusForbidden
+	case errors.Is(err, errCallbackNotAllowed):
+		return http.StatusBadRequest
+	case errors.Is(err, preservation.ErrQuotaExceeded):
+		return quotaErrorStatus(err)
+	}
+	return http.StatusInternalServerError
+}
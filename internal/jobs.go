@@ -0,0 +1,818 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// JobsService is the interface of the job queue used by the HTTP handler.
+type JobsService interface {
+	CancelJob(ctx context.Context, id string) (string, error)
+	RetryJob(ctx context.Context, id string) (*JobStatus, error)
+	JobStatus(ctx context.Context, id string) (*JobStatus, error)
+	ListJobs(ctx context.Context, status string, limit int) ([]*JobStatus, error)
+	Catalog() *catalog.Store
+}
+
+// jobWatchRecheck is the interval at which watched jobs are read again, so that the jobs finishing on other
+// instances, whose progress is not published here, end their watch.
+const jobWatchRecheck = 30 * time.Second
+
+// maxJobWait is the longest JobHandler waits for a job to change.
+const maxJobWait = 60 * time.Second
+
+// defaultJobsLimit is the number of jobs listed by JobsHandler without a limit.
+const defaultJobsLimit = 100
+
+// errJobNotFound is returned for unknown jobs and the jobs of other tenants.
+var errJobNotFound = errors.New("job not found")
+
+// errJobNotRetryable is returned when retrying a job that did not fail and was not cancelled.
+var errJobNotRetryable = errors.New("only failed and cancelled jobs can be retried")
+
+// Statuses of the jobs.
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// JobStatus is the status of a job, and of the package it preserves once it has started.
+type JobStatus struct {
+	ID             string        `json:"id"`
+	Status         string        `json:"status"`
+	PackageID      string        `json:"package_id,omitempty"`
+	CellsPath      string        `json:"cells_path,omitempty"`
+	State          catalog.State `json:"state,omitempty"`
+	AIPUUID        string        `json:"aip_uuid,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	ReviewRequired bool          `json:"review_required,omitempty"`
+	UpdatedAt      *time.Time    `json:"updated_at,omitempty"`
+}
+
+// Finished reports whether the job has its final status.
+func (j *JobStatus) Finished() bool {
+	switch j.Status {
+	case JobStatusCompleted, JobStatusFailed, JobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// etag returns the entity tag of the status, which changes when the job moves to another status or its package to
+// another lifecycle state, but not with the progress within a state.
+func (j *JobStatus) etag() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		j.Status, j.PackageID, string(j.State), j.AIPUUID, strconv.FormatBool(j.ReviewRequired),
+	}, "\x00")))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// JobStatus returns the status of a job: running while it runs on this instance, then from the record of its
+// package. Jobs without a record are pending while they are in the queue, and errJobNotFound is returned for the
+// others. Tenants only find their own jobs.
+func (s *Service) JobStatus(ctx context.Context, id string) (*JobStatus, error) {
+	tenant := preservation.TenantFromContext(ctx)
+	if tenant != "" && !strings.HasPrefix(id, tenantJobID(tenant, "")) {
+		return nil, errJobNotFound
+	}
+	job := &JobStatus{ID: id, Status: JobStatusPending}
+	var started time.Time
+	if running, ok := s.running.Load(id); ok {
+		job.Status = JobStatusRunning
+		started = running.(*runningJob).started
+	}
+	var rec *catalog.Record
+	if store := s.Catalog(); store != nil {
+		var err error
+		if rec, err = store.FindJob(id); err != nil && !errors.Is(err, catalog.ErrNotFound) {
+			return nil, fmt.Errorf("error finding the package record of job %s: %w", id, err)
+		}
+	}
+	if rec == nil || (tenant != "" && rec.Tenant != tenant) {
+		if !started.IsZero() {
+			return job, nil
+		}
+		if queued, err := s.queuedJob(ctx, id); err != nil {
+			return nil, err
+		} else if !queued {
+			return nil, errJobNotFound
+		}
+		return job, nil
+	}
+	// The record of an earlier run of the job is not the record of the running one, nor of a retry still queued
+	if rec.CreatedAt.Before(started) {
+		return job, nil
+	}
+	if started.IsZero() && rec.Outcome != "" && rec.Outcome != catalog.OutcomeInterrupted {
+		if queued, err := s.queuedJob(ctx, id); err != nil {
+			return nil, err
+		} else if queued {
+			return job, nil
+		}
+	}
+	job.PackageID = rec.ID
+	job.CellsPath = rec.CellsPath
+	job.State = rec.State
+	job.AIPUUID = rec.AIPUUID
+	job.Error = rec.Error
+	job.ReviewRequired = rec.ReviewRequired
+	updatedAt := rec.UpdatedAt
+	job.UpdatedAt = &updatedAt
+	if started.IsZero() {
+		job.Status = outcomeJobStatus(rec.Outcome)
+	}
+	return job, nil
+}
+
+// ListJobs returns the jobs of the queue, pending first in the order they were queued, then the jobs that started
+// from the records of their packages, most recent first, up to limit jobs with the given status if it is not empty.
+// Jobs that started and were queued again are listed once, with their latest status. Tenants only find their own
+// jobs.
+func (s *Service) ListJobs(ctx context.Context, status string, limit int) ([]*JobStatus, error) {
+	tenant := preservation.TenantFromContext(ctx)
+	ownJob := func(id string) bool {
+		return tenant == "" || strings.HasPrefix(id, tenantJobID(tenant, ""))
+	}
+	seen := map[string]bool{}
+	var jobs []*JobStatus
+	add := func(job *JobStatus) {
+		seen[job.ID] = true
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+
+	if s.queue != nil {
+		queued, err := s.queue.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing queued jobs: %w", err)
+		}
+		sort.Slice(queued, func(i, j int) bool { return queued[i].QueuedAt.Before(queued[j].QueuedAt) })
+		for _, job := range queued {
+			if !ownJob(job.ID) || seen[job.ID] {
+				continue
+			}
+			queuedAt := job.QueuedAt
+			add(&JobStatus{ID: job.ID, Status: JobStatusPending, CellsPath: jobCellsPath(job), UpdatedAt: &queuedAt})
+		}
+	}
+	// Jobs running on this instance have no record until their package is downloaded
+	s.running.Range(func(key, value any) bool {
+		id, running := key.(string), value.(*runningJob)
+		if ownJob(id) && !seen[id] {
+			started := running.started
+			add(&JobStatus{ID: id, Status: JobStatusRunning, CellsPath: jobCellsPath(running.job), UpdatedAt: &started})
+		}
+		return true
+	})
+	store := s.Catalog()
+	if store == nil {
+		return jobs[:min(len(jobs), limit)], nil
+	}
+	records, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing package records: %w", err)
+	}
+	for _, rec := range records {
+		if len(jobs) >= limit {
+			break
+		}
+		if rec.JobID == "" || seen[rec.JobID] || (tenant != "" && rec.Tenant != tenant) {
+			continue
+		}
+		updatedAt := rec.UpdatedAt
+		add(&JobStatus{
+			ID:             rec.JobID,
+			Status:         outcomeJobStatus(rec.Outcome),
+			PackageID:      rec.ID,
+			CellsPath:      rec.CellsPath,
+			State:          rec.State,
+			AIPUUID:        rec.AIPUUID,
+			Error:          rec.Error,
+			ReviewRequired: rec.ReviewRequired,
+			UpdatedAt:      &updatedAt,
+		})
+	}
+	return jobs[:min(len(jobs), limit)], nil
+}
+
+// queuedJob reports whether a job is in the queue, waiting to run.
+func (s *Service) queuedJob(ctx context.Context, id string) (bool, error) {
+	if s.queue == nil {
+		return false, nil
+	}
+	queued, err := s.queue.List(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error listing queued jobs: %w", err)
+	}
+	return slices.ContainsFunc(queued, func(job *queue.Job) bool { return job.ID == id }), nil
+}
+
+// outcomeJobStatus returns the status of a job from the outcome of its package. Packages without an outcome are
+// still being preserved, e.g. on another instance, and interrupted ones are queued again.
+func outcomeJobStatus(outcome string) string {
+	switch outcome {
+	case "":
+		return JobStatusRunning
+	case catalog.OutcomeSuccess, catalog.OutcomeWarning:
+		return JobStatusCompleted
+	case catalog.OutcomeCancelled:
+		return JobStatusCancelled
+	case catalog.OutcomeInterrupted:
+		return JobStatusPending
+	default:
+		return JobStatusFailed
+	}
+}
+
+// OpenQueue opens the job queue of the watched uploads and intake transfers, in memory, in a SQLite database or
+// shared with the other service instances through Postgres or NATS JetStream.
+func (s *Service) OpenQueue(ctx context.Context) error {
+	q, err := queue.New(ctx, s.cfg)
+	if err != nil {
+		return err
+	}
+	s.queue = q
+	return nil
+}
+
+// Enqueue queues the preservation of a package. Jobs already queued are ignored.
+func (s *Service) Enqueue(ctx context.Context, job *queue.Job) error {
+	if s.queue == nil {
+		return errors.New("job queue is not open")
+	}
+	if job.QueuedAt.IsZero() {
+		job.QueuedAt = time.Now().UTC()
+	}
+	if err := s.admitJob(job); err != nil {
+		return err
+	}
+	err := s.queue.Enqueue(ctx, job)
+	if errors.Is(err, queue.ErrDuplicate) {
+		logger.Debug("Package already queued for preservation: %s", job.Path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("Package queued for preservation: %s", job.Path)
+	return nil
+}
+
+// ProcessJobs preserves the queued packages, one at a time, until the context is cancelled. Queued packages are held
+// while the job workers are drained.
+func (s *Service) ProcessJobs(ctx context.Context) {
+	if s.queue == nil {
+		logger.Error("Job queue is not open, queued packages are not preserved")
+		return
+	}
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.consumers.Add(1)
+	s.mu.Unlock()
+	defer s.consumers.Done()
+	for ctx.Err() == nil {
+		drain, resume := s.workers()
+		if resume != nil {
+			select {
+			case <-resume:
+			case <-ctx.Done():
+			}
+			continue
+		}
+		// Draining stops the consumption once the running job completes
+		consumeCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-drain:
+				cancel()
+			case <-consumeCtx.Done():
+			}
+		}()
+		err := s.queue.Consume(consumeCtx, s.runJob)
+		cancel()
+		if err != nil {
+			logger.Error("Error consuming job queue: %v", err)
+			return
+		}
+	}
+}
+
+// JobCancellation is the response of CancelJobHandler.
+type JobCancellation struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// Job cancellation statuses.
+const (
+	JobCancelled  = "cancelled"  // The job was removed from the queue
+	JobCancelling = "cancelling" // The running preservation stops at its next cancellation point
+)
+
+// CancelJob cancels a job: a queued job is removed from the queue, and a job running on this instance stops and
+// removes its partial outputs. Returns the cancellation status, queue.ErrNotFound if no such job is queued, or
+// queue.ErrRunning if it runs on another instance. Tenants only find their own jobs.
+func (s *Service) CancelJob(ctx context.Context, id string) (string, error) {
+	if s.queue == nil {
+		return "", errors.New("job queue is not open")
+	}
+	if tenant := preservation.TenantFromContext(ctx); tenant != "" && !strings.HasPrefix(id, tenantJobID(tenant, "")) {
+		return "", queue.ErrNotFound
+	}
+	if s.cancelRunningJob(id) {
+		return JobCancelling, nil
+	}
+	err := s.queue.Remove(ctx, id)
+	if err == nil {
+		logger.Info("Queued job cancelled: %s", id)
+		s.updateBatchEntry(&queue.Job{ID: id, Batch: jobBatch(id)}, func(entry *catalog.BatchEntry) {
+			entry.Status = catalog.BatchEntryCancelled
+		})
+		return JobCancelled, nil
+	}
+	// The job may have started since
+	if (errors.Is(err, queue.ErrRunning) || errors.Is(err, queue.ErrNotFound)) && s.cancelRunningJob(id) {
+		return JobCancelling, nil
+	}
+	return "", err
+}
+
+// RetryJob queues a failed or cancelled job again, with the same ID, to preserve the Cells path of its latest package
+// record as it was submitted: as the same user and tenant, with the profile, deselections and metadata of the
+// package. Transfers pulled from a source are preserved from their copy in Cells. Callbacks are not sent again.
+// Returns errJobNotFound if the job has no package record, or errJobNotRetryable if it is queued again, running or
+// completed.
+func (s *Service) RetryJob(ctx context.Context, id string) (*JobStatus, error) {
+	if s.queue == nil {
+		return nil, errors.New("job queue is not open")
+	}
+	store := s.Catalog()
+	if store == nil {
+		return nil, errors.New("package records are disabled, jobs cannot be retried")
+	}
+	tenant := preservation.TenantFromContext(ctx)
+	if tenant != "" && !strings.HasPrefix(id, tenantJobID(tenant, "")) {
+		return nil, errJobNotFound
+	}
+	rec, err := store.FindJob(id)
+	if errors.Is(err, catalog.ErrNotFound) || (err == nil && tenant != "" && rec.Tenant != tenant) {
+		return nil, errJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding the package record of job %s: %w", id, err)
+	}
+	status, err := s.JobStatus(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status.Status != JobStatusFailed && status.Status != JobStatusCancelled {
+		return nil, fmt.Errorf("%w: job %s is %s", errJobNotRetryable, id, status.Status)
+	}
+	job := &queue.Job{
+		ID:       id,
+		Username: rec.Username,
+		Tenant:   rec.Tenant,
+		Path:     rec.CellsPath,
+		Profile:  rec.Profile,
+		Deselect: rec.Deselect,
+		Metadata: rec.Metadata,
+		Batch:    jobBatch(id),
+	}
+	if err := s.Enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+	s.updateBatchEntry(job, func(entry *catalog.BatchEntry) {
+		entry.Status = catalog.BatchEntryQueued
+		entry.Error = ""
+	})
+	logger.Info("Job queued again: %s", id)
+	return &JobStatus{ID: id, Status: JobStatusPending, CellsPath: rec.CellsPath, UpdatedAt: &job.QueuedAt}, nil
+}
+
+// cancelRunningJob cancels a job running on this instance. Returns false if it is not running here.
+func (s *Service) cancelRunningJob(id string) bool {
+	running, ok := s.running.Load(id)
+	if !ok {
+		return false
+	}
+	running.(*runningJob).cancel(preservation.ErrCancelled)
+	logger.Info("Cancelling running job: %s", id)
+	return true
+}
+
+// runningJob is a job running on this instance.
+type runningJob struct {
+	job     *queue.Job
+	started time.Time
+	cancel  context.CancelCauseFunc
+}
+
+// runJob preserves the package of a job, or waits for the remote agent it is leased to, then posts its outcome to the
+// job's callback URL and records it in the job's batch if it has them.
+// The job can be cancelled while it runs. Running jobs are not stopped with the job consumption, they are drained
+// by Shutdown; interrupted jobs are queued again and their callback is only sent once they complete.
+func (s *Service) runJob(ctx context.Context, job *queue.Job) error {
+	// The jobs of agents are held before they are leased
+	if _, leased := ctx.Value(agentLeaseKey{}).(*agentLease); !leased {
+		if err := s.holdJob(job); err != nil {
+			return err
+		}
+	}
+	trackedCtx, done, err := s.track(preservation.WithJob(preservation.WithTenant(context.WithoutCancel(ctx), job.Tenant), job.ID, job.QueuedAt))
+	if err != nil {
+		return fmt.Errorf("%w: %w", queue.ErrInterrupted, err)
+	}
+	defer done()
+	jobCtx, cancel := context.WithCancelCause(trackedCtx)
+	defer cancel(nil)
+	started := time.Now()
+	if !job.QueuedAt.IsZero() {
+		s.monitor.ObserveQueueWait(started.Sub(job.QueuedAt))
+	}
+	s.running.Store(job.ID, &runningJob{job: job, started: started.UTC(), cancel: cancel})
+	defer s.running.Delete(job.ID)
+
+	s.updateBatchEntry(job, func(entry *catalog.BatchEntry) {
+		entry.Status = catalog.BatchEntryRunning
+	})
+	if lease, ok := ctx.Value(agentLeaseKey{}).(*agentLease); ok {
+		err = s.agents.await(jobCtx, lease)
+	} else {
+		err = s.preserveJob(jobCtx, job)
+	}
+	if err != nil && errors.Is(context.Cause(jobCtx), preservation.ErrCancelled) {
+		// Cancelled before or after the package preservation, e.g. while pulling it from its source
+		err = preservation.ErrCancelled
+	}
+	// Jobs of remote agents are also interrupted when the agent stops, or stops renewing its lease
+	if err != nil && (errors.Is(context.Cause(jobCtx), preservation.ErrInterrupted) || errors.Is(err, queue.ErrInterrupted)) {
+		s.updateBatchEntry(job, func(entry *catalog.BatchEntry) {
+			entry.Status = catalog.BatchEntryQueued
+		})
+		return fmt.Errorf("%w: %w", queue.ErrInterrupted, err)
+	}
+	if job.Callback != nil {
+		// The callback is sent even if the job workers are drained meanwhile
+		s.sendCallback(trackedCtx, job, started, err)
+	}
+	s.finishBatchEntry(job, started, err)
+	return err
+}
+
+// tenantJobID returns the ID of a job submitted by a tenant, prefixed with the tenant name so that tenants can neither
+// cancel nor collide with the jobs of other tenants. The IDs of the jobs of the service are unchanged.
+func tenantJobID(tenant, id string) string {
+	if tenant == "" {
+		return id
+	}
+	return "tenant:" + tenant + ":" + id
+}
+
+// untenantedJobID returns the ID of a job without the prefix of its tenant.
+func untenantedJobID(id string) string {
+	if rest, ok := strings.CutPrefix(id, "tenant:"); ok {
+		_, id, _ = strings.Cut(rest, ":")
+	}
+	return id
+}
+
+// jobBatch returns the batch of a job from its ID, or "" if the job was not submitted in a batch.
+func jobBatch(id string) string {
+	rest, ok := strings.CutPrefix(untenantedJobID(id), "batches:")
+	if !ok {
+		return ""
+	}
+	batch, _, _ := strings.Cut(rest, ":")
+	return batch
+}
+
+// preserveJob preserves the package of a job, pulling it from its transfer source first. The metadata of the job is
+// added to the package.
+func (s *Service) preserveJob(ctx context.Context, job *queue.Job) error {
+	ctx = preservation.WithMetadata(ctx, job.Metadata)
+	if job.Source != "" {
+		return s.PreserveFromSource(ctx, job.Username, job.Source, []string{job.Path}, job.Profile)
+	}
+	atomCfg, err := config.GetAtomConfig(s.cfg, nil)
+	if err != nil {
+		return fmt.Errorf("error loading AtoM configuration: %w", err)
+	}
+	// Queued Cells paths are resolved paths, like nodes passed from flows
+	if err := s.Run(ctx, job.Username, []string{job.Path}, job.Profile, job.Deselect, s.cfg.Cleanup, true, nil, atomCfg); err != nil {
+		return err
+	}
+	logger.Info("Preserved queued package: %s", job.Path)
+	return nil
+}
+
+// JobHandler responds with the status of a job. With the wait query parameter, in seconds, the response waits until
+// the job changes, for clients that cannot follow the progress streams: from the status of the If-None-Match entity
+// tag, or from its status when the request arrived. Responds with 304 Not Modified if the job still matches the
+// entity tag.
+func JobHandler(svc JobsService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		var wait time.Duration
+		if value := r.URL.Query().Get("wait"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > maxJobWait {
+				http.Error(w, fmt.Sprintf("invalid wait %q: seconds up to %d", value, int(maxJobWait.Seconds())), http.StatusBadRequest)
+				return
+			}
+			wait = time.Duration(seconds) * time.Second
+		}
+		// Subscribe before reading the job, so that no change is missed in between
+		var events <-chan catalog.ProgressEvent
+		if store := svc.Catalog(); store != nil && wait > 0 {
+			var unsubscribe func()
+			events, unsubscribe = store.Subscribe("")
+			defer unsubscribe()
+		}
+		job, err := svc.JobStatus(r.Context(), id)
+		if err != nil {
+			writeJobStatusError(w, id, err)
+			return
+		}
+		seen := r.Header.Get("If-None-Match")
+		if wait > 0 && !job.Finished() && (seen == "" || seen == job.etag()) {
+			// Long polls outlive the write timeout of the server
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + progressKeepAlive)); err != nil {
+				logger.Debug("Failed to extend the write deadline of the status of job %s: %v", id, err)
+			}
+			if job, err = waitJob(r.Context(), svc, job, events, wait); err != nil {
+				writeJobStatusError(w, id, err)
+				return
+			}
+		}
+		w.Header().Set("ETag", job.etag())
+		w.Header().Set("Cache-Control", "no-cache")
+		if seen != "" && seen == job.etag() {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeJSON(w, job)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// waitJob waits until a job moves to another status or state, finishes, or the wait is over, and returns its status.
+// The job is read again on the state changes of its package on this instance, and periodically for the other
+// instances.
+func waitJob(ctx context.Context, svc JobsService, job *JobStatus, events <-chan catalog.ProgressEvent, wait time.Duration) (*JobStatus, error) {
+	etag := job.etag()
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	recheck := time.NewTicker(jobWatchRecheck)
+	defer recheck.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return job, nil
+		case <-timeout.C:
+			return job, nil
+		case <-recheck.C:
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if event.JobID != job.ID || (event.Kind != catalog.ProgressState && event.Kind != catalog.ProgressFinished) {
+				continue
+			}
+		}
+		current, err := svc.JobStatus(ctx, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		job = current
+		if job.etag() != etag || job.Finished() {
+			return job, nil
+		}
+	}
+}
+
+// writeJobStatusError responds with the status of an error reading the status of a job.
+func writeJobStatusError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, errJobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	logger.Error(fmt.Sprintf("Failed to read the status of job %s: %v", id, err))
+	http.Error(w, "failed to read package record", http.StatusInternalServerError)
+}
+
+// CancelJobHandler cancels a queued or running job. Responds with the job ID and its cancellation status: 200 OK
+// once a queued job is removed, or 202 Accepted while a running preservation stops.
+func CancelJobHandler(svc JobsService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		status, err := svc.CancelJob(r.Context(), id)
+		switch {
+		case errors.Is(err, queue.ErrNotFound):
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		case errors.Is(err, queue.ErrRunning):
+			http.Error(w, "job is running on another instance", http.StatusConflict)
+			return
+		case err != nil:
+			logger.Error(fmt.Sprintf("Failed to cancel job %s: %v", id, err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if status == JobCancelling {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+		}
+		writeJSON(w, JobCancellation{ID: id, Status: status})
+	}
+	return recoveryMiddleware(handler)
+}
+
+// JobsHandler responds with the jobs of the queue and the jobs that started, filtered by status and up to limit
+// jobs.
+func JobsHandler(svc JobsService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultJobsLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", value), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", JobStatusPending, JobStatusRunning, JobStatusCompleted, JobStatusFailed, JobStatusCancelled:
+		default:
+			http.Error(w, fmt.Sprintf("invalid status %q", status), http.StatusBadRequest)
+			return
+		}
+		jobs, err := svc.ListJobs(r.Context(), status, limit)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list jobs: %v", err))
+			http.Error(w, "failed to list jobs", http.StatusInternalServerError)
+			return
+		}
+		if jobs == nil {
+			jobs = []*JobStatus{}
+		}
+		writeJSON(w, jobs)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// RetryJobHandler queues a failed or cancelled job again. Responds with 202 Accepted and the status of the job.
+func RetryJobHandler(svc JobsService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		job, err := svc.RetryJob(r.Context(), id)
+		switch {
+		case errors.Is(err, errJobNotFound):
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		case errors.Is(err, errJobNotRetryable):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			logger.Error(fmt.Sprintf("Failed to retry job %s: %v", id, err))
+			http.Error(w, err.Error(), intakeErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		writeJSON(w, job)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// JobArtifacts is the response of JobArtifactsHandler.
+type JobArtifacts struct {
+	JobID     string             `json:"job_id"`
+	PackageID string             `json:"package_id"`
+	Artifacts []catalog.Artifact `json:"artifacts"`
+}
+
+// JobArtifactsHandler lists the artifacts of the package preserved by a job: its preservation report, the log of
+// its a3m jobs, the METS of its AIP and the reports of its checks. Responds with 404 until the job has started.
+func JobArtifactsHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := getJobRecord(w, r, store, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		artifacts, err := store.Artifacts(rec)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list artifacts of package %s: %v", rec.ID, err))
+			http.Error(w, "failed to list artifacts", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, JobArtifacts{JobID: rec.JobID, PackageID: rec.ID, Artifacts: artifacts})
+	}
+	return recoveryMiddleware(handler)
+}
+
+// JobArtifactHandler downloads an artifact of the package preserved by a job.
+func JobArtifactHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := getJobRecord(w, r, store, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		name := r.PathValue("name")
+		w.Header().Set("Content-Type", catalog.ArtifactContentType(name))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if name == catalog.ArtifactReport {
+			http.ServeContent(w, r, name, rec.UpdatedAt, bytes.NewReader(rec.Report()))
+			return
+		}
+		path, err := store.ArtifactPath(rec.ID, name)
+		if errors.Is(err, catalog.ErrArtifactNotFound) {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to read artifact %s of package %s: %v", name, rec.ID, err))
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "failed to read artifact", http.StatusInternalServerError)
+			return
+		}
+		http.ServeFile(w, r, path)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// JobEvents is the response of JobEventsHandler.
+type JobEvents struct {
+	JobID  string             `json:"job_id"`
+	Events []catalog.JobEvent `json:"events"`
+}
+
+// JobEventsHandler returns the lifecycle of a job, oldest first: when it was queued, the attempts of its preservation
+// and their state transitions, stages and warnings, with their durations. Responds with 404 until the job has started.
+func JobEventsHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, ok := getJobRecord(w, r, store, id); !ok {
+			return
+		}
+		records, err := store.JobRecords(id)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to read the package records of job %s: %v", id, err))
+			http.Error(w, "failed to read package records", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, JobEvents{JobID: id, Events: catalog.JobEvents(records)})
+	}
+	return recoveryMiddleware(handler)
+}
+
+// getJobRecord reads the record of the package preserved by a job, writing the error response if it cannot be read.
+// Tenants only find their own jobs.
+func getJobRecord(w http.ResponseWriter, r *http.Request, store *catalog.Store, id string) (*catalog.Record, bool) {
+	if store == nil {
+		http.Error(w, "package records are disabled", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	tenant := preservation.TenantFromContext(r.Context())
+	rec, err := store.FindJob(id)
+	if err == nil && tenant != "" && (!strings.HasPrefix(id, tenantJobID(tenant, "")) || rec.Tenant != tenant) {
+		err = catalog.ErrNotFound
+	}
+	if errors.Is(err, catalog.ErrNotFound) {
+		http.Error(w, "job not found, or not started", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to find the package record of job %s: %v", id, err))
+		http.Error(w, "failed to read package record", http.StatusInternalServerError)
+		return nil, false
+	}
+	return rec, true
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+func TestOutcomeJobStatus(t *testing.T) {
+	tests := []struct {
+		outcome string
+		want    string
+	}{
+		{outcome: "", want: JobStatusRunning},
+		{outcome: catalog.OutcomeSuccess, want: JobStatusCompleted},
+		{outcome: catalog.OutcomeWarning, want: JobStatusCompleted},
+		{outcome: catalog.OutcomeFailure, want: JobStatusFailed},
+		{outcome: catalog.OutcomeCancelled, want: JobStatusCancelled},
+		{outcome: catalog.OutcomeInterrupted, want: JobStatusPending},
+		{outcome: "unknown", want: JobStatusFailed},
+	}
+	for _, tt := range tests {
+		if got := outcomeJobStatus(tt.outcome); got != tt.want {
+			t.Errorf("outcomeJobStatus(%q) = %q, want %q", tt.outcome, got, tt.want)
+		}
+	}
+}
+
+// newTestService returns a service whose package records are kept in a temporary directory, with a Cells server
+// without workspaces and an in-memory job queue.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	cells := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"Workspaces":[]}`)
+	}))
+	t.Cleanup(cells.Close)
+
+	cfg := &config.Config{DataDir: t.TempDir()}
+	cfg.Cells.Address = cells.URL
+	cfg.Cells.AdminToken = "token"
+	cfg.Queue.Backend = queue.BackendMemory
+	q, err := queue.New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = q.Close() })
+	return &Service{cfg: cfg, svc: preservation.NewPreserverWithA3MClient(context.Background(), cfg, nil), queue: q}
+}
+
+func TestJobStatus(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name    string
+		tenant  string          // Tenant of the request
+		record  *catalog.Record // Record of the package of the job, if any
+		started time.Time       // Start of the job on this instance, if it runs
+		queued  bool            // The job is queued again
+		want    string
+		wantErr error
+	}{
+		{name: "unknown job", wantErr: errJobNotFound},
+		{name: "queued", queued: true, want: JobStatusPending},
+		{name: "running without record", started: now, want: JobStatusRunning},
+		{name: "running with record", started: now.Add(-time.Minute),
+			record: &catalog.Record{CreatedAt: now}, want: JobStatusRunning},
+		{name: "running again after an earlier run", started: now,
+			record: &catalog.Record{CreatedAt: now.Add(-time.Hour), Outcome: catalog.OutcomeFailure}, want: JobStatusRunning},
+		{name: "preserving on another instance", record: &catalog.Record{CreatedAt: now}, want: JobStatusRunning},
+		{name: "completed", record: &catalog.Record{CreatedAt: now, Outcome: catalog.OutcomeSuccess}, want: JobStatusCompleted},
+		{name: "completed with warnings", record: &catalog.Record{CreatedAt: now, Outcome: catalog.OutcomeWarning},
+			want: JobStatusCompleted},
+		{name: "failed", record: &catalog.Record{CreatedAt: now, Outcome: catalog.OutcomeFailure}, want: JobStatusFailed},
+		{name: "cancelled", record: &catalog.Record{CreatedAt: now, Outcome: catalog.OutcomeCancelled},
+			want: JobStatusCancelled},
+		{name: "interrupted", record: &catalog.Record{CreatedAt: now, Outcome: catalog.OutcomeInterrupted},
+			want: JobStatusPending},
+		{name: "failed and queued again", record: &catalog.Record{CreatedAt: now, Outcome: catalog.OutcomeFailure},
+			queued: true, want: JobStatusPending},
+		{name: "job of another tenant", tenant: "library", wantErr: errJobNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			ctx := context.Background()
+			const id = "job-1"
+			if tt.record != nil {
+				tt.record.ID = "package-1"
+				tt.record.JobID = id
+				tt.record.CellsPath = "personal-files/box-12"
+				tt.record.Error = "error"
+				if err := s.Catalog().Save(tt.record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !tt.started.IsZero() {
+				s.running.Store(id, &runningJob{job: &queue.Job{ID: id}, started: tt.started})
+			}
+			if tt.queued {
+				if err := s.queue.Enqueue(ctx, &queue.Job{ID: id, QueuedAt: now}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.tenant != "" {
+				ctx = preservation.WithTenant(ctx, tt.tenant)
+			}
+
+			job, err := s.JobStatus(ctx, id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("JobStatus() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if job.Status != tt.want {
+				t.Errorf("status = %q, want %q", job.Status, tt.want)
+			}
+			// The record describes the job unless it is from an earlier run, or the job waits to run again
+			described := tt.record != nil && !tt.record.CreatedAt.Before(tt.started) && !tt.queued
+			if got := job.PackageID != ""; got != described {
+				t.Errorf("package ID = %q, want the record: %v", job.PackageID, described)
+			}
+			if described && (job.CellsPath != tt.record.CellsPath || job.Error != tt.record.Error) {
+				t.Errorf("job = %+v, want the details of the record", job)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Package limits caps the number of preservations, and of each stage of the pipeline, running at the same time, so
+// that a burst of submissions does not exhaust the CPU or disk of the host. Limits can be changed while the service
+// runs: raising a limit starts waiting work at once, lowering it lets running work finish.
+package limits
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// Limit names.
+const (
+	Global        = "global"        // Preservations of packages
+	Download      = "download"      // Package downloads from Cells and transfer sources
+	Preprocessing = "preprocessing" // Construction of the transfers, with their virus scan
+	Normalization = "normalization" // A3M processing, where files are normalized
+	Extraction    = "extraction"    // Extraction of the AIPs generated by A3M
+	Compression   = "compression"   // Compression of the AIPs
+	Storage       = "storage"       // AIP uploads to Cells and the AIP storage locations
+	Dissemination = "dissemination" // DIP migrations and deposits to AtoM
+)
+
+// Status is the state of a limit.
+type Status struct {
+	Limit   int `json:"limit"`   // 0 for no limit
+	Active  int `json:"active"`  // Running at the moment
+	Waiting int `json:"waiting"` // Waiting for a slot
+}
+
+// Limiter is a semaphore whose size can change.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int // 0 for no limit
+	active  int
+	waiters list.List // chan struct{}, closed when the waiter gets a slot
+}
+
+// NewLimiter creates a limiter allowing limit holders at once, or any number if limit is 0.
+func NewLimiter(limit int) *Limiter {
+	return &Limiter{limit: limit}
+}
+
+// Acquire waits for a slot. Returns the context error if the context is cancelled first.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.waiters.Len() == 0 && l.free() {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		granted := false
+		select {
+		case <-ready:
+			// The slot was granted at the same time
+			granted = true
+		default:
+			l.waiters.Remove(elem)
+		}
+		l.mu.Unlock()
+		if granted {
+			l.Release()
+		}
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.wake()
+}
+
+// SetLimit changes the limit, 0 for no limit. Waiters get the slots freed by a higher limit.
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.wake()
+}
+
+// Status returns the limit, and the number of holders and waiters.
+func (l *Limiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Status{Limit: l.limit, Active: l.active, Waiting: l.waiters.Len()}
+}
+
+func (l *Limiter) free() bool {
+	return l.limit == 0 || l.active < l.limit
+}
+
+// wake gives the free slots to the waiters, in order. Must be called with the lock held.
+func (l *Limiter) wake() {
+	for l.waiters.Len() > 0 && l.free() {
+		ready := l.waiters.Remove(l.waiters.Front()).(chan struct{})
+		l.active++
+		close(ready)
+	}
+}
+
+// Limits holds the limiters of the preservations and of the stages of the pipeline.
+type Limits struct {
+	limiters map[string]*Limiter
+}
+
+// Configured returns the limits set in the configuration, by name.
+func Configured(cfg *config.Config) map[string]int {
+	c := cfg.Concurrency
+	return map[string]int{
+		Global:        c.Global,
+		Download:      c.Download,
+		Preprocessing: c.Preprocessing,
+		Normalization: c.Normalization,
+		Extraction:    c.Extraction,
+		Compression:   c.Compression,
+		Storage:       c.Storage,
+		Dissemination: c.Dissemination,
+	}
+}
+
+// New creates the limiters from the configuration.
+func New(cfg *config.Config) *Limits {
+	initial := Configured(cfg)
+	l := &Limits{limiters: make(map[string]*Limiter, len(initial))}
+	for name, limit := range initial {
+		l.limiters[name] = NewLimiter(limit)
+	}
+	return l
+}
+
+// Acquire waits for a slot of a limit and returns the function releasing it. Returns the context error if the
+// context is cancelled first. A nil Limits has no limits.
+func (l *Limits) Acquire(ctx context.Context, name string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	limiter, ok := l.limiters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown concurrency limit: %s", name)
+	}
+	if status := limiter.Status(); status.Limit > 0 && status.Active >= status.Limit {
+		logger.Info("Waiting for a %s slot (%d running)", name, status.Active)
+	}
+	if err := limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(limiter.Release) }, nil
+}
+
+// Do runs fn with a slot of a limit.
+func (l *Limits) Do(ctx context.Context, name string, fn func() error) error {
+	release, err := l.Acquire(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
+// Set changes limits, by name. Limits not set are kept. Nothing is changed if a name is unknown or a limit negative.
+func (l *Limits) Set(limits map[string]int) error {
+	names := make([]string, 0, len(limits))
+	for name, limit := range limits {
+		if _, ok := l.limiters[name]; !ok {
+			return fmt.Errorf("unknown concurrency limit: %s", name)
+		}
+		if limit < 0 {
+			return fmt.Errorf("invalid %s concurrency limit: %d", name, limit)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l.limiters[name].SetLimit(limits[name])
+		logger.Info("Concurrency limit of %s set to %d", name, limits[name])
+	}
+	return nil
+}
+
+// Status returns the state of every limit, by name.
+func (l *Limits) Status() map[string]Status {
+	status := make(map[string]Status, len(l.limiters))
+	for name, limiter := range l.limiters {
+		status[name] = limiter.Status()
+	}
+	return status
+}
@@ -0,0 +1,507 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/health"
+	"github.com/penwern/curate-preservation-core/internal/limits"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/penwern/curate-preservation-core/pkg/version"
+)
+
+// errIntakePaused is the message of the submissions refused while the intake is paused.
+const errIntakePaused = "intake is paused for maintenance"
+
+// maintenanceRetryAfter is the wait sent in the Retry-After of the submissions refused during a maintenance window
+// whose end is not known, or past.
+const maintenanceRetryAfter = time.Minute
+
+// Maintenance modes.
+const (
+	// MaintenanceQueue accepts the submissions to the queue and holds them until the maintenance ends. This is the
+	// default.
+	MaintenanceQueue = "queue"
+	// MaintenanceReject refuses the submissions with 503 and a Retry-After until the maintenance ends.
+	MaintenanceReject = "reject"
+)
+
+// ErrMaintenance is returned when a preservation is submitted to run immediately during a maintenance window.
+var ErrMaintenance = utils.Classify(utils.ErrPolicy, errors.New("service is in maintenance"))
+
+// MaintenanceRequest is the request to start a maintenance window.
+type MaintenanceRequest struct {
+	Mode   string `json:"mode,omitempty" validate:"omitempty,oneof=queue reject"` // queue or reject, default queue
+	Reason string `json:"reason,omitempty" validate:"max=500"`
+	// Expected length of the window, sent as the Retry-After of refused submissions
+	DurationSeconds int `json:"duration_seconds,omitempty" validate:"min=0"`
+}
+
+// Validate checks the mode and the duration of the request. Invalid fields are returned as a *ValidationError.
+func (r *MaintenanceRequest) Validate() error {
+	return validateFields(r).err()
+}
+
+// Maintenance is a maintenance window of the instance.
+type Maintenance struct {
+	Mode      string    `json:"mode"`
+	Reason    string    `json:"reason,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndsAt    time.Time `json:"ends_at,omitzero"` // Expected end, zero if not known
+}
+
+// retryAfter returns the wait before submissions are sent again: the time left in the window, or
+// maintenanceRetryAfter if its end is not known or past.
+func (m *Maintenance) retryAfter() time.Duration {
+	if left := time.Until(m.EndsAt); left > 0 {
+		return left
+	}
+	return maintenanceRetryAfter
+}
+
+// MaintenanceError is the error of a preservation submitted to run immediately during a maintenance window.
+type MaintenanceError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *MaintenanceError) Error() string {
+	msg := ErrMaintenance.Error()
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return fmt.Sprintf("%s, retry in %s", msg, e.RetryAfter.Round(time.Second))
+}
+
+func (e *MaintenanceError) Unwrap() error {
+	return ErrMaintenance
+}
+
+// MaintenanceService is the interface of the maintenance operations used by the HTTP handlers.
+type MaintenanceService interface {
+	Reload() (*ConfigReload, error)
+	StartMaintenance(req *MaintenanceRequest)
+	EndMaintenance()
+	PauseIntake()
+	ResumeIntake()
+	DrainWorkers()
+	ResumeWorkers()
+	RuntimeState(ctx context.Context) *RuntimeState
+}
+
+// RuntimeState is the state of a service instance, for its administrators.
+type RuntimeState struct {
+	Version          string                   `json:"version"`
+	StartedAt        time.Time                `json:"started_at"`
+	UptimeSeconds    int64                    `json:"uptime_seconds"`
+	ShuttingDown     bool                     `json:"shutting_down"`
+	Maintenance      *Maintenance             `json:"maintenance,omitempty"` // nil outside of a maintenance window
+	IntakePaused     bool                     `json:"intake_paused"`
+	IntakePausedAt   time.Time                `json:"intake_paused_at,omitzero"`
+	WorkersDrained   bool                     `json:"workers_drained"`
+	WorkersDrainedAt time.Time                `json:"workers_drained_at,omitzero"`
+	Queue            *QueueState              `json:"queue,omitempty"` // nil if the job queue is not open
+	RunningJobs      []RunningJob             `json:"running_jobs"`    // Jobs running on this instance
+	Concurrency      map[string]limits.Status `json:"concurrency"`
+	Resources        Resources                `json:"resources"`
+}
+
+// QueueState is the depth of the job queue, shared by the instances of the service unless it is in memory.
+type QueueState struct {
+	Backend string `json:"backend"`
+	queue.Stats
+	Error string `json:"error,omitempty"` // Set if the queue could not be read
+}
+
+// RunningJob is a job running on this instance.
+type RunningJob struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Username  string    `json:"username"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Resources is the resource usage of the process.
+type Resources struct {
+	Goroutines     int               `json:"goroutines"`
+	MaxProcs       int               `json:"max_procs"` // GOMAXPROCS
+	HeapAllocBytes uint64            `json:"heap_alloc_bytes"`
+	SysBytes       uint64            `json:"sys_bytes"` // Memory obtained from the OS
+	NumGC          uint32            `json:"num_gc"`
+	FreeSpace      map[string]uint64 `json:"free_space_bytes,omitempty"` // Bytes available, by directory
+}
+
+// ConfigReload is the response of ReloadConfigHandler.
+type ConfigReload struct {
+	ReloadedAt   time.Time      `json:"reloaded_at"`
+	Integrations []string       `json:"integrations"`     // Integrations configured after the reload
+	Limits       map[string]int `json:"limits,omitempty"` // Concurrency limits changed by the reload, by name
+	// Settings changed since the start, which are only applied on restart
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// reloadedSettings are the prefixes of the settings a reload applies: the concurrency limits, and the settings of the
+// PRONOM sync, which reads them for each sync.
+var reloadedSettings = []string{"concurrency.", "pronom.", "format_policies."}
+
+// Reload reads the .env file and the config files of the integrations again, without restarting the service. Jobs
+// already running keep the settings they read, the changes apply to the next jobs. Of the settings, the concurrency
+// limits changed since the last load are applied, so that the limits changed with the API are kept otherwise, and
+// the PRONOM sync uses the reloaded settings; the other changed settings are reported as requiring a restart. The environment, the auth, tenants and
+// schedules configs are only read on start. If the settings or a config are invalid, nothing is applied and the
+// current configuration stays active.
+func (s *Service) Reload() (*ConfigReload, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	cfg, err := config.Reload()
+	var integrations []string
+	if err == nil {
+		integrations, err = s.svc.Reload()
+	}
+	if err != nil {
+		logger.Error("Configuration not reloaded, the current settings are kept: %v", err)
+		return nil, err
+	}
+	// The command line flags only enable these settings
+	cfg.AllowInsecureTLS = cfg.AllowInsecureTLS || s.cfg.AllowInsecureTLS
+	cfg.Cleanup = cfg.Cleanup || s.cfg.Cleanup
+
+	reload := &ConfigReload{ReloadedAt: time.Now().UTC(), Integrations: integrations}
+	previous := limits.Configured(s.settings)
+	for name, limit := range limits.Configured(cfg) {
+		if limit != previous[name] {
+			if reload.Limits == nil {
+				reload.Limits = map[string]int{}
+			}
+			reload.Limits[name] = limit
+		}
+	}
+	if err := s.Limits().Set(reload.Limits); err != nil {
+		logger.Error("Concurrency limits not reloaded: %v", err)
+		reload.Limits = nil
+	}
+	for _, key := range s.cfg.Changed(cfg) {
+		if !slices.ContainsFunc(reloadedSettings, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) {
+			reload.RestartRequired = append(reload.RestartRequired, key)
+		}
+	}
+	s.settings = cfg
+
+	logger.Info("Configuration reloaded, integrations: %v", integrations)
+	if len(reload.RestartRequired) > 0 {
+		logger.Warn("Settings changed that are only applied on restart: %s", strings.Join(reload.RestartRequired, ", "))
+	}
+	return reload, nil
+}
+
+// currentSettings returns the settings of the last load, reloaded since the start if the configuration was reloaded.
+func (s *Service) currentSettings() *config.Config {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.settings
+}
+
+// PauseIntake refuses new submissions to the API until ResumeIntake, e.g. for maintenance. Queued and running jobs
+// are not affected, and packages uploaded into the watched folders are still queued.
+func (s *Service) PauseIntake() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.intakePausedAt.IsZero() {
+		s.intakePausedAt = time.Now().UTC()
+		logger.Info("Intake paused for maintenance, submissions are refused")
+	}
+}
+
+// ResumeIntake accepts submissions again.
+func (s *Service) ResumeIntake() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.intakePausedAt.IsZero() {
+		s.intakePausedAt = time.Time{}
+		logger.Info("Intake resumed")
+	}
+}
+
+// IntakePaused reports whether submissions are refused for maintenance, and the wait before they are sent again,
+// zero if it is not known. Submissions are refused while the intake is paused, and during a maintenance window that
+// rejects them.
+func (s *Service) IntakePaused() (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maintenance != nil && s.maintenance.Mode == MaintenanceReject {
+		return true, s.maintenance.retryAfter()
+	}
+	return !s.intakePausedAt.IsZero(), 0
+}
+
+// StartMaintenance starts a maintenance window, e.g. while the storage or A3M are maintained: the job workers of this
+// instance are drained, and the submissions are queued and held, or refused, until EndMaintenance. Running jobs
+// complete. Starting a window again updates its mode, reason and expected end.
+func (s *Service) StartMaintenance(req *MaintenanceRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	if s.maintenance == nil {
+		s.maintenance = &Maintenance{StartedAt: now}
+	}
+	s.maintenance.Mode = req.Mode
+	if s.maintenance.Mode == "" {
+		s.maintenance.Mode = MaintenanceQueue
+	}
+	s.maintenance.Reason = req.Reason
+	s.maintenance.EndsAt = time.Time{}
+	if req.DurationSeconds > 0 {
+		s.maintenance.EndsAt = now.Add(time.Duration(req.DurationSeconds) * time.Second)
+	}
+	if s.workersDrainedAt.IsZero() {
+		s.drainWorkersLocked()
+		s.maintenanceDrained = true
+	}
+	logger.Info("Maintenance started in %s mode, queued jobs are held. Reason: %q", s.maintenance.Mode, s.maintenance.Reason)
+}
+
+// EndMaintenance ends the maintenance window: submissions are accepted again, and the job workers drained by the
+// window take the queued jobs. Workers drained before the window stay drained.
+func (s *Service) EndMaintenance() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maintenance == nil {
+		return
+	}
+	s.maintenance = nil
+	if s.maintenanceDrained {
+		s.resumeWorkersLocked()
+	}
+	logger.Info("Maintenance ended")
+}
+
+// checkMaintenance returns a *MaintenanceError during a maintenance window, for the preservations that would run
+// immediately rather than be queued.
+func (s *Service) checkMaintenance() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maintenance == nil {
+		return nil
+	}
+	return &MaintenanceError{Reason: s.maintenance.Reason, RetryAfter: s.maintenance.retryAfter()}
+}
+
+// DrainWorkers stops the job workers of this instance from taking queued jobs until ResumeWorkers. Running jobs
+// complete, and queued jobs wait in the queue, for other instances or for the workers to resume.
+func (s *Service) DrainWorkers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drainWorkersLocked()
+}
+
+// drainWorkersLocked drains the job workers. Must be called with the lock held.
+func (s *Service) drainWorkersLocked() {
+	if s.workersDrainedAt.IsZero() {
+		s.workersDrainedAt = time.Now().UTC()
+		s.resumeWorkers = make(chan struct{})
+		close(s.drainWorkers)
+		logger.Info("Draining job workers, queued jobs are held")
+	}
+}
+
+// ResumeWorkers lets drained job workers take queued jobs again, during a maintenance window too.
+func (s *Service) ResumeWorkers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resumeWorkersLocked()
+}
+
+// resumeWorkersLocked resumes the drained job workers. Must be called with the lock held.
+func (s *Service) resumeWorkersLocked() {
+	s.maintenanceDrained = false
+	if !s.workersDrainedAt.IsZero() {
+		s.workersDrainedAt = time.Time{}
+		s.drainWorkers = make(chan struct{})
+		close(s.resumeWorkers)
+		logger.Info("Job workers resumed")
+	}
+}
+
+// workers returns the channel closed when the job workers are drained, or nil and the channel closed when they
+// resume if they are drained.
+func (s *Service) workers() (drain, resume <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.workersDrainedAt.IsZero() {
+		return nil, s.resumeWorkers
+	}
+	return s.drainWorkers, nil
+}
+
+// RuntimeState returns the state of this instance: its maintenance state, the depth of the job queue, the jobs it
+// runs, its concurrency limits and its resource usage.
+func (s *Service) RuntimeState(ctx context.Context) *RuntimeState {
+	s.mu.Lock()
+	state := &RuntimeState{
+		Version:          version.Version(),
+		StartedAt:        s.startedAt,
+		UptimeSeconds:    int64(time.Since(s.startedAt).Seconds()),
+		ShuttingDown:     s.draining,
+		Maintenance:      s.maintenanceState(),
+		IntakePaused:     !s.intakePausedAt.IsZero(),
+		IntakePausedAt:   s.intakePausedAt,
+		WorkersDrained:   !s.workersDrainedAt.IsZero(),
+		WorkersDrainedAt: s.workersDrainedAt,
+		RunningJobs:      []RunningJob{},
+		Concurrency:      s.Limits().Status(),
+	}
+	s.mu.Unlock()
+
+	state.Queue = s.queueState(ctx)
+	s.running.Range(func(_, value any) bool {
+		running := value.(*runningJob)
+		state.RunningJobs = append(state.RunningJobs, RunningJob{
+			ID:        running.job.ID,
+			Path:      running.job.Path,
+			Username:  running.job.Username,
+			Tenant:    running.job.Tenant,
+			Source:    running.job.Source,
+			StartedAt: running.started,
+		})
+		return true
+	})
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	state.Resources = Resources{
+		Goroutines:     runtime.NumGoroutine(),
+		MaxProcs:       runtime.GOMAXPROCS(0),
+		HeapAllocBytes: mem.HeapAlloc,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+	}
+	for _, dir := range []string{s.cfg.ProcessingBaseDir, s.cfg.DataDir} {
+		if dir == "" {
+			continue
+		}
+		// Free space is only read on Linux
+		if free, err := health.FreeBytes(dir); err == nil {
+			if state.Resources.FreeSpace == nil {
+				state.Resources.FreeSpace = map[string]uint64{}
+			}
+			state.Resources.FreeSpace[dir] = free
+		}
+	}
+	return state
+}
+
+// maintenanceState returns a copy of the maintenance window, or nil outside of one. Must be called with the lock held.
+func (s *Service) maintenanceState() *Maintenance {
+	if s.maintenance == nil {
+		return nil
+	}
+	maintenance := *s.maintenance
+	return &maintenance
+}
+
+// queueState returns the depth of the job queue, or nil if the queue is not open.
+func (s *Service) queueState(ctx context.Context) *QueueState {
+	if s.queue == nil {
+		return nil
+	}
+	state := &QueueState{Backend: s.cfg.Queue.Backend}
+	stats, err := s.queue.Stats(ctx)
+	if err != nil {
+		state.Error = err.Error()
+	}
+	state.Stats = stats
+	return state
+}
+
+// refuseWhilePaused wraps the handler of a submission endpoint so that it responds with 503 while the intake is
+// paused, with a Retry-After if the wait is known.
+func refuseWhilePaused(paused func() (bool, time.Duration), next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if paused == nil {
+			next(w, r)
+			return
+		}
+		if refused, retryAfter := paused(); refused {
+			setRetryAfter(w, retryAfter)
+			http.Error(w, errIntakePaused, http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// setRetryAfter sets the Retry-After header of a response, in whole seconds, unless the wait is zero.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+}
+
+// ReloadConfigHandler reloads the configuration. Responds with the integrations configured after the reload, the
+// concurrency limits it changed and the changed settings requiring a restart, or with 500 and the errors if the
+// settings or a config fail to load, in which case the current configuration is kept.
+func ReloadConfigHandler(svc MaintenanceService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		reload, err := svc.Reload()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("configuration not reloaded: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if reload.Integrations == nil {
+			reload.Integrations = []string{}
+		}
+		writeJSON(w, reload)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// MaintenanceHandler runs a maintenance operation, such as PauseIntake, and responds with the runtime state.
+func MaintenanceHandler(svc MaintenanceService, op func()) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		op()
+		writeJSON(w, svc.RuntimeState(r.Context()))
+	}
+	return recoveryMiddleware(handler)
+}
+
+// RuntimeStateHandler responds with the runtime state of the instance.
+func RuntimeStateHandler(svc MaintenanceService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, svc.RuntimeState(r.Context()))
+	}
+	return recoveryMiddleware(handler)
+}
+
+// StartMaintenanceHandler starts a maintenance window, or updates the current one, and responds with the runtime
+// state. The request body is optional, the window queues the submissions by default.
+func StartMaintenanceHandler(svc MaintenanceService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req MaintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeProblem(w, r, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+		svc.StartMaintenance(&req)
+		writeJSON(w, svc.RuntimeState(r.Context()))
+	}
+	return recoveryMiddleware(handler)
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/metrics"
+	"github.com/penwern/curate-preservation-core/internal/notify"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// MetricsService is the interface of the metrics used by the HTTP handler.
+type MetricsService interface {
+	Metrics(ctx context.Context) *Metrics
+}
+
+// Metrics are the rolling metrics of an instance, with the depth of the job queue.
+type Metrics struct {
+	Queue *QueueState `json:"queue,omitempty"` // nil if the job queue is not open
+	metrics.Snapshot
+}
+
+// MonitorMetrics collects the durations of the stages completed on this instance, and checks the metrics against
+// their thresholds at the configured interval until the context is done. Thresholds crossed and recovered are
+// notified.
+func (s *Service) MonitorMetrics(ctx context.Context) {
+	if store := s.Catalog(); store != nil {
+		events, unsubscribe := store.Subscribe("")
+		defer unsubscribe()
+		go func() {
+			for event := range events {
+				s.observeProgress(&event)
+			}
+		}()
+	}
+	s.monitor.Run(ctx, s.cfg.Metrics.CheckInterval)
+}
+
+// observeProgress records the duration of the completed stages and preservations.
+func (s *Service) observeProgress(event *catalog.ProgressEvent) {
+	if event.DurationMs <= 0 {
+		return
+	}
+	duration := time.Duration(event.DurationMs) * time.Millisecond
+	switch {
+	case event.Kind == catalog.ProgressStage && event.Status == catalog.StageCompleted:
+		s.monitor.ObserveStage(event.Stage, duration)
+	case event.Kind == catalog.ProgressFinished && (event.Outcome == catalog.OutcomeSuccess || event.Outcome == catalog.OutcomeFailure):
+		s.monitor.ObserveStage(catalog.EventPreservation, duration)
+	}
+}
+
+// queueDepth returns the number of queued jobs, 0 if the job queue is not open.
+func (s *Service) queueDepth(ctx context.Context) (int, error) {
+	if s.queue == nil {
+		return 0, nil
+	}
+	stats, err := s.queue.Stats(ctx)
+	return stats.Queued, err
+}
+
+// notifyAlert notifies the channels of a metric going above its threshold, or back below it.
+func (s *Service) notifyAlert(alert metrics.Alert, firing bool) {
+	event := notify.Event{
+		Type:      config.NotifyEventThresholdExceeded,
+		Severity:  notify.SeverityWarning,
+		Metric:    alert.Metric,
+		Value:     alert.Value,
+		Threshold: alert.Threshold,
+		Detail:    alert.Detail(),
+	}
+	if firing {
+		logger.Warn("Metric %s above its threshold: %s", alert.Metric, event.Detail)
+	} else {
+		event.Type = config.NotifyEventThresholdRecovered
+		event.Severity = notify.SeverityInfo
+		logger.Info("Metric %s back below its threshold: %s", alert.Metric, event.Detail)
+	}
+	s.svc.Notifier().Notify(event)
+}
+
+// Metrics returns the rolling metrics of this instance, their thresholds and alerts, and the depth of the queue.
+func (s *Service) Metrics(ctx context.Context) *Metrics {
+	return &Metrics{Queue: s.queueState(ctx), Snapshot: *s.monitor.Snapshot()}
+}
+
+// MetricsHandler responds with the rolling metrics of the instance: the percentiles of the stage durations and queue
+// waits, the depth of the queue, and the alerts firing.
+func MetricsHandler(svc MetricsService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, svc.Metrics(r.Context()))
+	}
+	return recoveryMiddleware(handler)
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// Metrics checked against the thresholds. Stage metrics are named after their stage, e.g. stage.packaging.
+const (
+	MetricQueueDepth  = "queue_depth"
+	MetricQueueWait   = "queue_wait"
+	metricStagePrefix = "stage."
+)
+
+// Thresholds are the values above which a metric alerts. Durations are compared to the 95th percentile of their
+// series, zero thresholds are not checked.
+type Thresholds struct {
+	QueueDepth  int              `json:"queue_depth,omitempty"`   // Queued jobs
+	QueueWaitMs int64            `json:"queue_wait_ms,omitempty"` // Queue wait of the jobs
+	StagesMs    map[string]int64 `json:"stages_ms,omitempty"`     // Duration of the stages, by stage
+}
+
+// ParseThresholds reads the thresholds of the metrics config. Stage thresholds are given as stage=duration, e.g.
+// packaging=2h.
+func ParseThresholds(cfg *config.Config) (*Thresholds, error) {
+	t := &Thresholds{
+		QueueDepth:  cfg.Metrics.QueueDepthThreshold,
+		QueueWaitMs: cfg.Metrics.QueueWaitThreshold.Milliseconds(),
+	}
+	for _, entry := range cfg.Metrics.StageDurationThresholds {
+		stage, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid stage duration threshold %q, expected stage=duration", entry)
+		}
+		stage = strings.TrimSpace(stage)
+		if !slices.Contains(catalog.EventTypes, stage) {
+			return nil, fmt.Errorf("invalid stage duration threshold %q: unknown stage %q, one of %s", entry, stage,
+				strings.Join(catalog.EventTypes, ", "))
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid stage duration threshold %q: expected a positive duration, e.g. 2h", entry)
+		}
+		if t.StagesMs == nil {
+			t.StagesMs = map[string]int64{}
+		}
+		t.StagesMs[stage] = d.Milliseconds()
+	}
+	return t, nil
+}
+
+// Alert is a metric above its threshold.
+type Alert struct {
+	Metric    string    `json:"metric"`    // queue_depth, queue_wait or stage.<stage>
+	Value     int64     `json:"value"`     // Queued jobs, or the 95th percentile in milliseconds
+	Threshold int64     `json:"threshold"` // Queued jobs, or milliseconds
+	Since     time.Time `json:"since"`
+}
+
+// Detail describes the alert.
+func (a *Alert) Detail() string {
+	if a.Metric == MetricQueueDepth {
+		return fmt.Sprintf("%d jobs are queued, the threshold is %d", a.Value, a.Threshold)
+	}
+	what := "Jobs wait in the queue"
+	if stage, ok := strings.CutPrefix(a.Metric, metricStagePrefix); ok {
+		what = "The " + stage + " stage takes"
+	}
+	return fmt.Sprintf("%s %s at the 95th percentile, the threshold is %s", what, formatMs(a.Value), formatMs(a.Threshold))
+}
+
+// formatMs formats milliseconds as a duration rounded to the second.
+func formatMs(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Second).String()
+}
+
+// Snapshot is the state of the metrics of an instance.
+type Snapshot struct {
+	WindowSeconds int64              `json:"window_seconds"` // Window of the summaries
+	QueueWait     Summary            `json:"queue_wait"`     // Waits of the jobs started by this instance
+	Stages        map[string]Summary `json:"stages"`         // Durations of the stages completed by this instance
+	Thresholds    Thresholds         `json:"thresholds"`
+	Alerts        []Alert            `json:"alerts"` // Metrics above their threshold, at the last check
+}
+
+// Monitor collects the metrics of an instance and checks them against their thresholds. Alerts are reported once
+// when a metric goes above its threshold, and once when it recovers.
+type Monitor struct {
+	*Collector
+	thresholds *Thresholds
+	queueDepth func(ctx context.Context) (int, error)
+	onChange   func(alert Alert, firing bool)
+
+	mu     sync.Mutex
+	alerts map[string]*Alert // Alerts firing, by metric
+}
+
+// NewMonitor creates the monitor of the metrics config. queueDepth returns the number of queued jobs, and onChange is
+// called when an alert fires or recovers.
+func NewMonitor(cfg *config.Config, queueDepth func(ctx context.Context) (int, error), onChange func(alert Alert, firing bool)) (*Monitor, error) {
+	thresholds, err := ParseThresholds(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Monitor{
+		Collector:  NewCollector(cfg.Metrics.Window),
+		thresholds: thresholds,
+		queueDepth: queueDepth,
+		onChange:   onChange,
+		alerts:     map[string]*Alert{},
+	}, nil
+}
+
+// Run checks the metrics at an interval until the context is done.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
+
+// Check compares the metrics to their thresholds, and reports the alerts that fire or recover.
+func (m *Monitor) Check(ctx context.Context) {
+	values := map[string]int64{}
+	thresholds := map[string]int64{}
+	if m.thresholds.QueueDepth > 0 && m.queueDepth != nil {
+		depth, err := m.queueDepth(ctx)
+		if err != nil {
+			// The alert keeps its state until the queue can be read
+			logger.Warn("Error reading the queue depth: %v", err)
+		} else {
+			values[MetricQueueDepth] = int64(depth)
+			thresholds[MetricQueueDepth] = int64(m.thresholds.QueueDepth)
+		}
+	}
+	if m.thresholds.QueueWaitMs > 0 {
+		values[MetricQueueWait] = m.QueueWait().P95Ms
+		thresholds[MetricQueueWait] = m.thresholds.QueueWaitMs
+	}
+	if len(m.thresholds.StagesMs) > 0 {
+		stages := m.Stages()
+		for stage, threshold := range m.thresholds.StagesMs {
+			values[metricStagePrefix+stage] = stages[stage].P95Ms
+			thresholds[metricStagePrefix+stage] = threshold
+		}
+	}
+
+	type change struct {
+		alert  Alert
+		firing bool
+	}
+	var changes []change
+	m.mu.Lock()
+	for metric, value := range values {
+		threshold := thresholds[metric]
+		alert := m.alerts[metric]
+		switch {
+		case value > threshold && alert == nil:
+			alert = &Alert{Metric: metric, Value: value, Threshold: threshold, Since: time.Now().UTC()}
+			m.alerts[metric] = alert
+			changes = append(changes, change{*alert, true})
+		case value > threshold:
+			alert.Value = value
+		case alert != nil:
+			delete(m.alerts, metric)
+			alert.Value = value
+			changes = append(changes, change{*alert, false})
+		}
+	}
+	m.mu.Unlock()
+	for _, c := range changes {
+		if m.onChange != nil {
+			m.onChange(c.alert, c.firing)
+		}
+	}
+}
+
+// Alerts returns the alerts firing at the last check, by metric.
+func (m *Monitor) Alerts() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alerts := make([]Alert, 0, len(m.alerts))
+	for _, alert := range m.alerts {
+		alerts = append(alerts, *alert)
+	}
+	slices.SortFunc(alerts, func(a, b Alert) int { return strings.Compare(a.Metric, b.Metric) })
+	return alerts
+}
+
+// Snapshot returns the summaries of the metrics, their thresholds and the alerts firing.
+func (m *Monitor) Snapshot() *Snapshot {
+	return &Snapshot{
+		WindowSeconds: int64(m.Window().Seconds()),
+		QueueWait:     m.QueueWait(),
+		Stages:        m.Stages(),
+		Thresholds:    *m.thresholds,
+		Alerts:        m.Alerts(),
+	}
+}
@@ -0,0 +1,140 @@
+// Package metrics keeps rolling metrics of the preservations of a service instance: the durations of the pipeline
+// stages and the time jobs wait in the queue, summarized by percentiles over a time window. The monitor checks them
+// and the depth of the queue against thresholds, and reports the thresholds crossed and recovered, so that operators
+// learn about backlogs before users do.
+package metrics
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxSamples bounds the samples kept by each series, the oldest are dropped first.
+const maxSamples = 10000
+
+// Summary summarizes the durations of a series over the window.
+type Summary struct {
+	Count int   `json:"count"`
+	P50Ms int64 `json:"p50_ms"`
+	P90Ms int64 `json:"p90_ms"`
+	P95Ms int64 `json:"p95_ms"`
+	P99Ms int64 `json:"p99_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+type sample struct {
+	at    time.Time
+	value time.Duration
+}
+
+// series is a rolling series of durations, oldest first.
+type series []sample
+
+// add appends a sample, and drops the samples older than the window.
+func (s *series) add(at time.Time, value, window time.Duration) {
+	*s = append(*s, sample{at: at, value: value})
+	if len(*s) > maxSamples {
+		*s = slices.Delete(*s, 0, len(*s)-maxSamples)
+	}
+	s.trim(at.Add(-window))
+}
+
+// trim drops the samples older than a time.
+func (s *series) trim(oldest time.Time) {
+	i := 0
+	for i < len(*s) && (*s)[i].at.Before(oldest) {
+		i++
+	}
+	if i > 0 {
+		*s = slices.Delete(*s, 0, i)
+	}
+}
+
+// summary returns the percentiles of the series.
+func (s series) summary() Summary {
+	if len(s) == 0 {
+		return Summary{}
+	}
+	values := make([]time.Duration, len(s))
+	for i, sample := range s {
+		values[i] = sample.value
+	}
+	slices.Sort(values)
+	return Summary{
+		Count: len(values),
+		P50Ms: percentile(values, 50).Milliseconds(),
+		P90Ms: percentile(values, 90).Milliseconds(),
+		P95Ms: percentile(values, 95).Milliseconds(),
+		P99Ms: percentile(values, 99).Milliseconds(),
+		MaxMs: values[len(values)-1].Milliseconds(),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// Collector keeps the rolling series of the stage durations and the queue waits. It is safe for concurrent use.
+type Collector struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	stages    map[string]*series
+	queueWait series
+}
+
+// NewCollector creates a collector summarizing the samples of a time window.
+func NewCollector(window time.Duration) *Collector {
+	return &Collector{window: window, stages: map[string]*series{}}
+}
+
+// Window returns the time window of the summaries.
+func (c *Collector) Window() time.Duration {
+	return c.window
+}
+
+// ObserveStage records the duration of a completed stage, by its event type in the package timelines.
+func (c *Collector) ObserveStage(stage string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stages[stage]
+	if s == nil {
+		s = &series{}
+		c.stages[stage] = s
+	}
+	s.add(time.Now(), d, c.window)
+}
+
+// ObserveQueueWait records the time a job waited in the queue before it started.
+func (c *Collector) ObserveQueueWait(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queueWait.add(time.Now(), d, c.window)
+}
+
+// Stages returns the summaries of the stages completed within the window, by stage.
+func (c *Collector) Stages() map[string]Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	oldest := time.Now().Add(-c.window)
+	summaries := map[string]Summary{}
+	for stage, s := range c.stages {
+		s.trim(oldest)
+		if len(*s) > 0 {
+			summaries[stage] = s.summary()
+		}
+	}
+	return summaries
+}
+
+// QueueWait returns the summary of the queue waits of the jobs started within the window.
+func (c *Collector) QueueWait() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queueWait.trim(time.Now().Add(-c.window))
+	return c.queueWait.summary()
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	// publishTimeout bounds the publication of an event to a message broker, including retries.
+	publishTimeout = time.Minute
+	// publishAttempts is the number of attempts to publish an event.
+	publishAttempts = 3
+)
+
+// publisher sends event messages to a message broker.
+type publisher interface {
+	// publish sends the JSON body of an event once. Publishers reconnect on the next call after a failure.
+	publish(ctx context.Context, event *Event, body []byte) error
+	Close() error
+}
+
+// brokerNotifier publishes events as JSON messages to a message broker.
+type brokerNotifier struct {
+	name      string
+	events    []string
+	publisher publisher
+}
+
+func (n *brokerNotifier) Name() string {
+	return n.name
+}
+
+// Notify publishes the event if the publisher is configured for its type, retrying with a linear backoff.
+func (n *brokerNotifier) Notify(ctx context.Context, event *Event) error {
+	if !config.NotifyEnabled(n.events, event.Type) {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	for attempt := 1; ; attempt++ {
+		err = n.publisher.publish(ctx, event, body)
+		if err == nil || attempt >= publishAttempts {
+			return err
+		}
+		logger.Debug("Error publishing %s event to %s (attempt %d of %d): %v", event.Type, n.name, attempt, publishAttempts, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		}
+	}
+}
+
+// Close closes the connection to the broker.
+func (n *brokerNotifier) Close() error {
+	return n.publisher.Close()
+}
+
+// messageKey returns the key of the messages of an event, so that the events of a package, or of a metric, share a
+// partition.
+func messageKey(event *Event) string {
+	if event.PackageID != "" {
+		return event.PackageID
+	}
+	if event.AIPUUID != "" {
+		return event.AIPUUID
+	}
+	return event.Metric
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// maxChatDetail is the longest detail or error shown in a chat message.
+const maxChatDetail = 500
+
+// eventTitles are the headlines of the chat messages, by event type.
+var eventTitles = map[string]string{
+	config.NotifyEventCompleted:    "Preserved",
+	config.NotifyEventFailed:       "Preservation failed",
+	config.NotifyEventFixityFailed: "Fixity check failed",
+	config.NotifyEventQuarantined:  "Package quarantined",
+	// Threshold events are named after their metric
+	config.NotifyEventThresholdExceeded:  "Threshold exceeded",
+	config.NotifyEventThresholdRecovered: "Back below threshold",
+}
+
+// chatNotifier posts events as message cards to a chat channel through an incoming webhook.
+type chatNotifier struct {
+	config  *config.ChatConfig
+	kind    string
+	message func(event *Event) any
+	client  *utils.HTTPClient
+}
+
+func newChatNotifier(cfg *config.ChatConfig, kind string, message func(event *Event) any, insecure bool) *chatNotifier {
+	return &chatNotifier{config: cfg, kind: kind, message: message, client: utils.NewHTTPClient(30*time.Second, insecure)}
+}
+
+func (n *chatNotifier) Name() string {
+	return n.kind + " " + n.config.Name
+}
+
+// Notify posts the event if the channel accepts its type and severity.
+// Events without a title, such as started preservations, are not posted to chats.
+func (n *chatNotifier) Notify(ctx context.Context, event *Event) error {
+	if _, ok := eventTitles[event.Type]; !ok || !n.config.Accepts(event.Type, event.Severity) {
+		return nil
+	}
+	body, err := json.Marshal(n.message(event))
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.DoRequest(ctx, http.MethodPost, n.config.WebhookURL, bytes.NewReader(body), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// summary returns the detail or error of an event, shortened for a chat message.
+func summary(event *Event) string {
+	text := event.Error
+	if text == "" {
+		text = event.Detail
+	}
+	return utils.TruncateError(text, maxChatDetail)
+}
+
+// facts returns the compact details of an event as name and value pairs.
+func facts(event *Event) [][2]string {
+	var facts [][2]string
+	add := func(name, value string) {
+		if value != "" {
+			facts = append(facts, [2]string{name, value})
+		}
+	}
+	add("Package", event.PackageID)
+	add("User", event.Username)
+	add("AIP", event.AIPUUID)
+	add("Location", event.Location)
+	if event.DurationMs > 0 {
+		add("Duration", event.Duration().String())
+	}
+	return facts
+}
+
+// slackMessage renders an event as a Slack message with a colored attachment.
+func slackMessage(event *Event) any {
+	colors := map[string]string{SeverityInfo: "good", SeverityWarning: "warning", SeverityError: "danger"}
+	title := fmt.Sprintf("%s: %s", eventTitles[event.Type], event.Name())
+	headline := "*" + slackEscape(title) + "*"
+	if event.URL != "" {
+		headline = fmt.Sprintf("*<%s|%s>*", event.URL, slackEscape(title))
+	}
+	if text := summary(event); text != "" {
+		headline += "\n" + slackEscape(text)
+	}
+	var details []string
+	for _, fact := range facts(event) {
+		details = append(details, fmt.Sprintf("%s: `%s`", fact[0], slackEscape(fact[1])))
+	}
+	blocks := []any{
+		map[string]any{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": headline}},
+	}
+	if len(details) > 0 {
+		blocks = append(blocks, map[string]any{
+			"type":     "context",
+			"elements": []any{map[string]any{"type": "mrkdwn", "text": strings.Join(details, " · ")}},
+		})
+	}
+	return map[string]any{
+		"text":        title,
+		"attachments": []any{map[string]any{"color": colors[event.Severity], "blocks": blocks}},
+	}
+}
+
+// slackEscape escapes the control characters of Slack's mrkdwn.
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// teamsMessage renders an event as an adaptive card, accepted by Teams incoming webhooks and workflows.
+func teamsMessage(event *Event) any {
+	colors := map[string]string{SeverityInfo: "Good", SeverityWarning: "Warning", SeverityError: "Attention"}
+	body := []any{
+		map[string]any{
+			"type":   "TextBlock",
+			"text":   fmt.Sprintf("%s: %s", eventTitles[event.Type], event.Name()),
+			"weight": "Bolder",
+			"color":  colors[event.Severity],
+			"wrap":   true,
+		},
+	}
+	if text := summary(event); text != "" {
+		body = append(body, map[string]any{"type": "TextBlock", "text": text, "isSubtle": true, "wrap": true, "spacing": "Small"})
+	}
+	var factSet []any
+	for _, fact := range facts(event) {
+		factSet = append(factSet, map[string]any{"title": fact[0], "value": fact[1]})
+	}
+	if len(factSet) > 0 {
+		body = append(body, map[string]any{"type": "FactSet", "facts": factSet})
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if event.URL != "" {
+		card["actions"] = []any{map[string]any{"type": "Action.OpenUrl", "title": "View report", "url": event.URL}}
+	}
+	return map[string]any{
+		"type":        "message",
+		"attachments": []any{map[string]any{"contentType": "application/vnd.microsoft.card.adaptive", "content": card}},
+	}
+}
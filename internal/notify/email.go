@@ -0,0 +1,309 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// sendTimeout bounds the delivery of an email.
+const sendTimeout = 2 * time.Minute
+
+// defaultEmailTemplates are the message templates of the events without a configured template.
+var defaultEmailTemplates = map[string]config.EmailTemplate{
+	config.NotifyEventCompleted: {
+		Subject: `Preserved: {{.Name}}`,
+		Body: `{{.Name}} was preserved{{with .Duration}} in {{.}}{{end}}.
+
+Package:  {{.CellsPath}}
+User:     {{.Username}}
+{{- with .Profile}}
+Profile:  {{.}}{{end}}
+{{- with .AIPUUID}}
+AIP UUID: {{.}}{{end}}
+{{- with .URL}}
+
+{{.}}{{end}}
+`,
+	},
+	config.NotifyEventFailed: {
+		Subject: `Preservation failed: {{.Name}}`,
+		Body: `The preservation of {{.Name}} failed:
+
+{{.Error}}
+
+Package:  {{.CellsPath}}
+User:     {{.Username}}
+{{- with .Profile}}
+Profile:  {{.}}{{end}}
+{{- with .URL}}
+
+{{.}}{{end}}
+`,
+	},
+	config.NotifyEventFixityFailed: {
+		Subject: `Fixity check failed: {{.Name}}`,
+		Body: `A fixity check of {{.Name}} failed:
+
+{{.Detail}}
+{{with .CellsPath}}
+Package:  {{.}}{{end}}
+{{- with .AIPUUID}}
+AIP UUID: {{.}}{{end}}
+{{- with .Location}}
+Location: {{.}}{{end}}
+{{- with .URL}}
+
+{{.}}{{end}}
+`,
+	},
+	config.NotifyEventQuarantined: {
+		Subject: `Package quarantined: {{.Name}}`,
+		Body: `{{.Name}} is held in quarantine:
+
+{{.Detail}}
+
+Package:  {{.CellsPath}}
+User:     {{.Username}}
+{{- with .URL}}
+
+{{.}}{{end}}
+`,
+	},
+	config.NotifyEventThresholdExceeded: {
+		Subject: `Threshold exceeded: {{.Metric}}`,
+		Body: `{{.Metric}} is above its alert threshold:
+
+{{.Detail}}
+`,
+	},
+	config.NotifyEventThresholdRecovered: {
+		Subject: `Back below threshold: {{.Metric}}`,
+		Body: `{{.Metric}} is back below its alert threshold:
+
+{{.Detail}}
+`,
+	},
+}
+
+// emailNotifier sends events as plain text emails over SMTP.
+type emailNotifier struct {
+	config    *config.EmailConfig
+	insecure  bool
+	templates map[string]*emailTemplate
+}
+
+type emailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+func newEmailNotifier(cfg *config.EmailConfig, insecure bool) *emailNotifier {
+	n := &emailNotifier{config: cfg, insecure: insecure, templates: map[string]*emailTemplate{}}
+	for eventType, tmpl := range defaultEmailTemplates {
+		if custom := cfg.Templates[eventType]; custom != nil {
+			// Configured templates were checked when the config was loaded, a blank subject or body keeps the default
+			if custom.Subject != "" {
+				tmpl.Subject = custom.Subject
+			}
+			if custom.Body != "" {
+				tmpl.Body = custom.Body
+			}
+		}
+		n.templates[eventType] = &emailTemplate{
+			subject: template.Must(template.New("subject").Parse(tmpl.Subject)),
+			body:    template.Must(template.New("body").Parse(tmpl.Body)),
+		}
+	}
+	return n
+}
+
+func (n *emailNotifier) Name() string {
+	return "email"
+}
+
+// Notify sends the event to the recipients of every package and to the tenants the package belongs to.
+// Events without a template, such as started preservations, are not sent by email.
+func (n *emailNotifier) Notify(ctx context.Context, event *Event) error {
+	tmpl, ok := n.templates[event.Type]
+	if !ok {
+		return nil
+	}
+	recipients := n.recipients(event)
+	if len(recipients) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, event); err != nil {
+		return fmt.Errorf("error rendering subject: %w", err)
+	}
+	if err := tmpl.body.Execute(&body, event); err != nil {
+		return fmt.Errorf("error rendering body: %w", err)
+	}
+	msg, err := n.message(recipients, strings.TrimSpace(subject.String()), body.String())
+	if err != nil {
+		return err
+	}
+	return n.send(ctx, recipients, msg)
+}
+
+// recipients returns the deduplicated recipients of an event.
+func (n *emailNotifier) recipients(event *Event) []string {
+	seen := map[string]bool{}
+	var recipients []string
+	add := func(addresses []string) {
+		for _, address := range addresses {
+			if key := strings.ToLower(address); !seen[key] {
+				seen[key] = true
+				recipients = append(recipients, address)
+			}
+		}
+	}
+	if config.NotifyEnabled(n.config.Events, event.Type) {
+		add(n.config.Recipients)
+	}
+	for _, tenant := range n.config.Tenants {
+		if config.NotifyEnabled(tenant.Events, event.Type) && tenant.Matches(event.Username, event.CellsPath) {
+			add(tenant.Recipients)
+		}
+	}
+	return recipients
+}
+
+// message builds a quoted-printable UTF-8 plain text message.
+func (n *emailNotifier) message(recipients []string, subject, body string) ([]byte, error) {
+	from, err := mail.ParseAddress(n.config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address: %w", err)
+	}
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", strings.Join(recipients, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(from.Address)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+	writer := quotedprintable.NewWriter(&msg)
+	if _, err := writer.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// send delivers a message over SMTP, with implicit TLS or STARTTLS unless security is none.
+func (n *emailNotifier) send(ctx context.Context, recipients []string, msg []byte) error {
+	security := n.config.Security
+	if security == "" {
+		security = config.SMTPSecurityStartTLS
+	}
+	port := n.config.Port
+	if port == 0 {
+		port = 587
+		if security == config.SMTPSecurityTLS {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(n.config.Host, strconv.Itoa(port))
+	// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+	tlsConfig := &tls.Config{ServerName: n.config.Host, InsecureSkipVerify: n.insecure}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if security == config.SMTPSecurityTLS {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if security == config.SMTPSecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("error starting TLS: %w", err)
+		}
+	}
+	if n.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)); err != nil {
+			return fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+	from, err := mail.ParseAddress(n.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("error sending email to %s: %w", recipient, err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	if _, err := writer.Write(msg); err != nil {
+		_ = writer.Close()
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return client.Quit()
+}
+
+// messageID returns a unique Message-ID in the domain of the sender.
+func messageID(from string) string {
+	domain := "localhost"
+	if _, d, ok := strings.Cut(from, "@"); ok {
+		domain = d
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// kafkaPublisher writes events to a Kafka topic. The writer retries failed writes and reconnects to the brokers.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(cfg *config.KafkaConfig, insecure bool) (*kafkaPublisher, error) {
+	transport := &kafka.Transport{ClientID: "curate-preservation-core"}
+	if cfg.TLS {
+		// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+		transport.TLS = &tls.Config{InsecureSkipVerify: insecure}
+	}
+	if cfg.SASL != nil {
+		mechanism, err := kafkaSASL(cfg.SASL)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// Events are written one at a time, don't wait for a batch to fill
+		BatchTimeout: 10 * time.Millisecond,
+		Transport:    transport,
+	}}, nil
+}
+
+// kafkaSASL returns the SASL mechanism of the configured credentials.
+func kafkaSASL(cfg *config.KafkaSASLConfig) (sasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case config.KafkaSASLPlain:
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case config.KafkaSASLSCRAMSHA256:
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case config.KafkaSASLSCRAMSHA512:
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", cfg.Mechanism)
+	}
+}
+
+// publish writes the event keyed by its package, with its ID and type as headers.
+func (p *kafkaPublisher) publish(ctx context.Context, event *Event, body []byte) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(messageKey(event)),
+		Value: body,
+		Time:  event.Time,
+		Headers: []kafka.Header{
+			{Key: "event_id", Value: []byte(event.ID)},
+			{Key: "event_type", Value: []byte(event.Type)},
+			{Key: "content_type", Value: []byte("application/json")},
+		},
+	})
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
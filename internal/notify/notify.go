@@ -0,0 +1,206 @@
+// Package notify sends notifications of package outcomes (preserved, failed, fixity failures and quarantined packages)
+// and of the service metrics crossing their alert thresholds to the configured channels: email, Slack or Microsoft
+// Teams channels, signed outbound webhooks, and Kafka or RabbitMQ message brokers. Webhooks and brokers also receive
+// started and cancelled preservations, stored AIPs and lifecycle state changes.
+// Notifications are sent in the background, in order for each channel, and never fail a preservation.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// channelBacklog is the number of events waiting to be delivered to a channel.
+const channelBacklog = 1000
+
+// Notification severities.
+const (
+	SeverityInfo    = config.NotifySeverityInfo
+	SeverityWarning = config.NotifySeverityWarning
+	SeverityError   = config.NotifySeverityError
+)
+
+// Event is a package outcome sent to the notification channels.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Severity   string    `json:"severity"`
+	Time       time.Time `json:"time"`
+	PackageID  string    `json:"package_id,omitempty"`
+	CellsPath  string    `json:"cells_path,omitempty"`
+	Username   string    `json:"username,omitempty"`
+	Profile    string    `json:"profile,omitempty"`
+	AIPUUID    string    `json:"aip_uuid,omitempty"`
+	Location   string    `json:"location,omitempty"` // Storage location of a fixity check
+	Detail     string    `json:"detail,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+	URL        string    `json:"url,omitempty"` // Package record in the preservation API
+	// Lifecycle states of state change events
+	State         string `json:"state,omitempty"`
+	PreviousState string `json:"previous_state,omitempty"`
+	// Metric of threshold events, e.g. queue_depth, with its value and threshold in jobs or milliseconds
+	Metric    string `json:"metric,omitempty"`
+	Value     int64  `json:"value,omitempty"`
+	Threshold int64  `json:"threshold,omitempty"`
+}
+
+// Name returns the name of the package, the last element of its Cells path, or the AIP UUID. Threshold events are
+// named after their metric.
+func (e *Event) Name() string {
+	if e.CellsPath != "" {
+		return path.Base(e.CellsPath)
+	}
+	if e.AIPUUID != "" {
+		return e.AIPUUID
+	}
+	return e.Metric
+}
+
+// Duration returns the duration of the preservation, rounded to the second.
+func (e *Event) Duration() time.Duration {
+	return (time.Duration(e.DurationMs) * time.Millisecond).Round(time.Second)
+}
+
+// Notifier delivers events to a notification channel.
+type Notifier interface {
+	// Name returns the name of the channel.
+	Name() string
+	// Notify delivers an event. Notifiers skip events they are not configured for,
+	// and bound the time spent delivering it.
+	Notify(ctx context.Context, event *Event) error
+}
+
+// Dispatcher sends events to every notification channel. A nil Dispatcher discards all events.
+type Dispatcher struct {
+	baseURL   string
+	notifiers []Notifier
+	backlogs  []chan Event // Events waiting for each notifier
+	wg        sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates the notifiers of the configured channels. Undeliverable webhook events are written below dataDir
+// unless the config sets a dead letter file. Returns nil if no channel is configured.
+func New(cfg *config.NotificationsConfig, dataDir string, insecure bool) *Dispatcher {
+	if cfg == nil {
+		return nil
+	}
+	d := &Dispatcher{baseURL: strings.TrimSuffix(cfg.BaseURL, "/")}
+	if cfg.Email != nil {
+		d.notifiers = append(d.notifiers, newEmailNotifier(cfg.Email, insecure))
+	}
+	for _, channel := range cfg.Slack {
+		d.notifiers = append(d.notifiers, newChatNotifier(channel, "slack", slackMessage, insecure))
+	}
+	for _, channel := range cfg.Teams {
+		d.notifiers = append(d.notifiers, newChatNotifier(channel, "teams", teamsMessage, insecure))
+	}
+	if len(cfg.Webhooks) > 0 {
+		deadLetterFile := cfg.DeadLetterFile
+		if deadLetterFile == "" {
+			deadLetterFile = filepath.Join(dataDir, "webhook-dead-letters.jsonl")
+		}
+		deadLetters := &deadLetterLog{path: deadLetterFile}
+		for _, webhook := range cfg.Webhooks {
+			d.notifiers = append(d.notifiers, newWebhookNotifier(webhook, deadLetters, insecure))
+		}
+	}
+	for _, kafka := range cfg.Kafka {
+		publisher, err := newKafkaPublisher(kafka, insecure)
+		if err != nil {
+			logger.Error("Kafka publisher %s disabled: %v", kafka.Name, err)
+			continue
+		}
+		d.notifiers = append(d.notifiers, &brokerNotifier{name: "kafka " + kafka.Name, events: kafka.Events, publisher: publisher})
+	}
+	for _, rabbitmq := range cfg.RabbitMQ {
+		d.notifiers = append(d.notifiers, &brokerNotifier{name: "rabbitmq " + rabbitmq.Name, events: rabbitmq.Events, publisher: newRabbitMQPublisher(rabbitmq, insecure)})
+	}
+	if len(d.notifiers) == 0 {
+		return nil
+	}
+	for _, notifier := range d.notifiers {
+		backlog := make(chan Event, channelBacklog)
+		d.backlogs = append(d.backlogs, backlog)
+		d.wg.Add(1)
+		go d.deliver(notifier, backlog)
+	}
+	return d
+}
+
+// deliver sends the events of a notifier one at a time, so that each channel receives them in order.
+func (d *Dispatcher) deliver(notifier Notifier, backlog <-chan Event) {
+	defer d.wg.Done()
+	for event := range backlog {
+		if err := notifier.Notify(context.Background(), &event); err != nil {
+			logger.Error("Error sending %s notification to %s: %v", event.Type, notifier.Name(), err)
+		}
+	}
+}
+
+// Notify sends an event to the notification channels in the background.
+// Events are dropped if a channel falls too far behind.
+func (d *Dispatcher) Notify(event Event) {
+	if d == nil {
+		return
+	}
+	if event.ID == "" {
+		event.ID = utils.NewUUID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.URL == "" && d.baseURL != "" && event.PackageID != "" {
+		event.URL = fmt.Sprintf("%s/packages/%s", d.baseURL, event.PackageID)
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for i, backlog := range d.backlogs {
+		select {
+		case backlog <- event:
+		default:
+			logger.Error("Notification backlog of %s is full, %s event dropped", d.notifiers[i].Name(), event.Type)
+		}
+	}
+}
+
+// Close waits for the notifications being sent, including webhook retries, and closes the broker connections.
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for _, backlog := range d.backlogs {
+		close(backlog)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+	for _, notifier := range d.notifiers {
+		if closer, ok := notifier.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warn("Error closing %s: %v", notifier.Name(), err)
+			}
+		}
+	}
+}
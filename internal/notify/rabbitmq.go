@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// rabbitMQPublisher publishes events to a RabbitMQ exchange with publisher confirms.
+// The connection is opened on the first event and reopened once it is lost.
+type rabbitMQPublisher struct {
+	config   *config.RabbitMQConfig
+	insecure bool
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func newRabbitMQPublisher(cfg *config.RabbitMQConfig, insecure bool) *rabbitMQPublisher {
+	return &rabbitMQPublisher{config: cfg, insecure: insecure}
+}
+
+// publish sends the event as a persistent message routed by its type, and waits for the broker to confirm it.
+func (p *rabbitMQPublisher) publish(ctx context.Context, event *Event, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    event.ID,
+		Timestamp:    event.Time,
+		Type:         event.Type,
+		AppId:        "curate-preservation-core",
+		Body:         body,
+	}
+	channel, err := p.open()
+	if err != nil {
+		return err
+	}
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, p.config.Exchange, event.Type, false, false, msg)
+	if err != nil {
+		// Reconnect on the next attempt
+		p.closeConnection()
+		return fmt.Errorf("error publishing: %w", err)
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		p.closeConnection()
+		return fmt.Errorf("error waiting for confirmation: %w", err)
+	}
+	if !acked {
+		return errors.New("message rejected by the broker")
+	}
+	return nil
+}
+
+// open returns the channel of the publisher, connecting and declaring the exchange if needed.
+func (p *rabbitMQPublisher) open() (*amqp.Channel, error) {
+	if p.channel != nil && !p.channel.IsClosed() {
+		return p.channel, nil
+	}
+	p.closeConnection()
+	properties := amqp.NewConnectionProperties()
+	properties.SetClientConnectionName("curate-preservation-core")
+	conn, err := amqp.DialConfig(p.config.URL, amqp.Config{
+		Heartbeat:  10 * time.Second,
+		Locale:     "en_US",
+		Properties: properties,
+		// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: p.insecure},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to RabbitMQ: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("error opening channel: %w", err)
+	}
+	kind := p.config.ExchangeType
+	if kind == "" {
+		kind = amqp.ExchangeTopic
+	}
+	if err := channel.ExchangeDeclare(p.config.Exchange, kind, true, false, false, false, nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("error declaring exchange %s: %w", p.config.Exchange, err)
+	}
+	if err := channel.Confirm(false); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("error enabling publisher confirms: %w", err)
+	}
+	p.conn = conn
+	p.channel = channel
+	return channel, nil
+}
+
+// closeConnection closes the connection, if open.
+func (p *rabbitMQPublisher) closeConnection() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	p.conn = nil
+	p.channel = nil
+}
+
+func (p *rabbitMQPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeConnection()
+	return nil
+}
@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	// webhookBackoff is the wait before the first retry of a webhook delivery, doubled after every attempt.
+	webhookBackoff = 2 * time.Second
+	// maxWebhookBackoff caps the wait between delivery attempts.
+	maxWebhookBackoff = time.Minute
+)
+
+// webhookNotifier posts events as JSON to an endpoint, signed with the shared secret of the webhook.
+type webhookNotifier struct {
+	config      *config.WebhookConfig
+	deadLetters *deadLetterLog
+	client      *utils.HTTPClient
+}
+
+func newWebhookNotifier(cfg *config.WebhookConfig, deadLetters *deadLetterLog, insecure bool) *webhookNotifier {
+	return &webhookNotifier{config: cfg, deadLetters: deadLetters, client: utils.NewHTTPClient(30*time.Second, insecure)}
+}
+
+func (n *webhookNotifier) Name() string {
+	return "webhook " + n.config.Name
+}
+
+// Notify delivers the event, retrying with exponential backoff on network errors, 429 and 5xx responses.
+// Events that cannot be delivered, or whose retries are cancelled, e.g. on shutdown, are written to the dead letter file.
+func (n *webhookNotifier) Notify(ctx context.Context, event *Event) error {
+	if !config.NotifyEnabled(n.config.Events, event.Type) {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// The event ID is the delivery ID, kept across retries so that receivers can drop duplicates
+	delivery := event.ID
+	backoff := webhookBackoff
+	attempts := n.config.Attempts()
+	for attempt := 1; ; attempt++ {
+		retry, err := n.deliver(ctx, event.Type, delivery, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= attempts {
+			n.writeDeadLetter(attempt, err, body)
+			return fmt.Errorf("delivery failed after %d attempts: %w", attempt, err)
+		}
+		logger.Debug("Webhook %s delivery %s failed (attempt %d of %d), retrying in %s: %v", n.config.Name, delivery, attempt, attempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			n.writeDeadLetter(attempt, ctx.Err(), body)
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxWebhookBackoff)
+	}
+}
+
+// writeDeadLetter writes an event that was not delivered to the dead letter file.
+func (n *webhookNotifier) writeDeadLetter(attempts int, err error, body []byte) {
+	if dlErr := n.deadLetters.Write(n.config, attempts, err, body); dlErr != nil {
+		logger.Error("Error writing dead letter of webhook %s: %v", n.config.Name, dlErr)
+	}
+}
+
+// deliver posts a signed event once. Reports whether a failed delivery may succeed when retried.
+func (n *webhookNotifier) deliver(ctx context.Context, eventType, delivery string, body []byte) (bool, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{}
+	for name, value := range n.config.Headers {
+		headers[name] = value
+	}
+	headers["Content-Type"] = "application/json"
+	headers["User-Agent"] = "curate-preservation-core"
+	headers["X-Curate-Event"] = eventType
+	headers["X-Curate-Delivery"] = delivery
+	headers["X-Curate-Timestamp"] = timestamp
+	headers["X-Curate-Signature"] = "sha256=" + Sign(n.config.Secret, timestamp, body)
+
+	resp, err := n.client.DoRequest(ctx, http.MethodPost, n.config.URL, bytes.NewReader(body), headers)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// Sign returns the hex HMAC-SHA256 of a webhook delivery: the timestamp header, a dot and the request body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetterLog appends undeliverable webhook events to a JSON lines file.
+type deadLetterLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// deadLetter is a line of the dead letter file.
+type deadLetter struct {
+	Time     time.Time       `json:"time"`
+	Webhook  string          `json:"webhook"`
+	URL      string          `json:"url"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Event    json.RawMessage `json:"event"`
+}
+
+// Write appends an event that could not be delivered to a webhook.
+func (l *deadLetterLog) Write(webhook *config.WebhookConfig, attempts int, deliveryErr error, event []byte) error {
+	line, err := json.Marshal(deadLetter{
+		Time:     time.Now().UTC(),
+		Webhook:  webhook.Name,
+		URL:      webhook.URL,
+		Attempts: attempts,
+		Error:    deliveryErr.Error(),
+		Event:    event,
+	})
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Clean(l.path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
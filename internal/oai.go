@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/oaipmh"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// OAIHandler serves the metadata of preserved packages over OAI-PMH.
+func OAIHandler(store *catalog.Store, cfg *config.Config) (http.HandlerFunc, error) {
+	if store == nil {
+		return nil, fmt.Errorf("OAI-PMH requires package records, set the data directory")
+	}
+	provider, err := oaipmh.NewProvider(store, oaipmh.Options{
+		BaseURL:              cfg.OAI.BaseURL,
+		RepositoryName:       cfg.OAI.RepositoryName,
+		RepositoryIdentifier: cfg.OAI.RepositoryIdentifier,
+		AdminEmail:           cfg.OAI.AdminEmail,
+		PageSize:             cfg.OAI.PageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recoveryMiddleware(provider.ServeHTTP), nil
+}
@@ -0,0 +1,589 @@
+// Package oaipmh serves the descriptive metadata of preserved packages over OAI-PMH 2.0, so aggregators and
+// discovery layers can harvest it. Records are the stored packages of the catalog, in the oai_dc format.
+package oaipmh
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	oaiNamespace      = "http://www.openarchives.org/OAI/2.0/"
+	oaiSchemaLocation = "http://www.openarchives.org/OAI/2.0/ http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	oaiDCPrefix       = "oai_dc"
+	oaiDCNamespace    = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	oaiDCSchema       = "http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+	dcNamespace       = "http://purl.org/dc/elements/1.1/"
+
+	// granularity is the datestamp granularity of the repository.
+	granularity = "YYYY-MM-DDThh:mm:ssZ"
+	dayLayout   = "2006-01-02"
+	timeLayout  = "2006-01-02T15:04:05Z"
+)
+
+// OAI-PMH error codes.
+const (
+	errBadArgument             = "badArgument"
+	errBadResumptionToken      = "badResumptionToken"
+	errBadVerb                 = "badVerb"
+	errCannotDisseminateFormat = "cannotDisseminateFormat"
+	errIDDoesNotExist          = "idDoesNotExist"
+	errNoRecordsMatch          = "noRecordsMatch"
+)
+
+// dcElements are the Dublin Core elements of the package metadata, in order.
+var dcElements = []string{
+	"title", "creator", "subject", "description", "publisher", "contributor", "date", "type",
+	"format", "identifier", "source", "language", "relation", "coverage", "rights",
+}
+
+// Options configures the provider.
+type Options struct {
+	BaseURL              string
+	RepositoryName       string
+	RepositoryIdentifier string
+	AdminEmail           string
+	PageSize             int
+}
+
+// Provider answers OAI-PMH requests from the package catalog.
+// Packages are harvestable once their AIP is stored; their processing profile is their set.
+type Provider struct {
+	store *catalog.Store
+	opts  Options
+}
+
+// NewProvider creates a provider. The repository identifier defaults to the host of the base URL.
+func NewProvider(store *catalog.Store, opts Options) (*Provider, error) {
+	base, err := url.Parse(opts.BaseURL)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid OAI-PMH base URL: %s", opts.BaseURL)
+	}
+	if opts.RepositoryIdentifier == "" {
+		opts.RepositoryIdentifier = base.Hostname()
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 100
+	}
+	return &Provider{store: store, opts: opts}, nil
+}
+
+// response is the OAI-PMH response envelope. Exactly one of the verb elements or errors is set.
+type response struct {
+	XMLName           xml.Name `xml:"OAI-PMH"`
+	Xmlns             string   `xml:"xmlns,attr"`
+	XmlnsXSI          string   `xml:"xmlns:xsi,attr"`
+	XSISchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	ResponseDate      string   `xml:"responseDate"`
+	Request           request  `xml:"request"`
+	Errors            []oaiError
+
+	Identify            *identify            `xml:"Identify,omitempty"`
+	ListMetadataFormats *listMetadataFormats `xml:"ListMetadataFormats,omitempty"`
+	ListSets            *listSets            `xml:"ListSets,omitempty"`
+	GetRecord           *getRecord           `xml:"GetRecord,omitempty"`
+	ListIdentifiers     *listIdentifiers     `xml:"ListIdentifiers,omitempty"`
+	ListRecords         *listRecords         `xml:"ListRecords,omitempty"`
+}
+
+// request echoes the request. Its arguments are omitted on badVerb and badArgument errors.
+type request struct {
+	URL             string `xml:",chardata"`
+	Verb            string `xml:"verb,attr,omitempty"`
+	Identifier      string `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string `xml:"metadataPrefix,attr,omitempty"`
+	From            string `xml:"from,attr,omitempty"`
+	Until           string `xml:"until,attr,omitempty"`
+	Set             string `xml:"set,attr,omitempty"`
+	ResumptionToken string `xml:"resumptionToken,attr,omitempty"`
+}
+
+type oaiError struct {
+	XMLName xml.Name `xml:"error"`
+	Code    string   `xml:"code,attr"`
+	Message string   `xml:",chardata"`
+}
+
+type identify struct {
+	RepositoryName    string `xml:"repositoryName"`
+	BaseURL           string `xml:"baseURL"`
+	ProtocolVersion   string `xml:"protocolVersion"`
+	AdminEmail        string `xml:"adminEmail"`
+	EarliestDatestamp string `xml:"earliestDatestamp"`
+	DeletedRecord     string `xml:"deletedRecord"`
+	Granularity       string `xml:"granularity"`
+}
+
+type metadataFormat struct {
+	MetadataPrefix    string `xml:"metadataPrefix"`
+	Schema            string `xml:"schema"`
+	MetadataNamespace string `xml:"metadataNamespace"`
+}
+
+type listMetadataFormats struct {
+	Formats []metadataFormat `xml:"metadataFormat"`
+}
+
+type set struct {
+	Spec string `xml:"setSpec"`
+	Name string `xml:"setName"`
+}
+
+type listSets struct {
+	Sets []set `xml:"set"`
+}
+
+type header struct {
+	Identifier string   `xml:"identifier"`
+	Datestamp  string   `xml:"datestamp"`
+	SetSpecs   []string `xml:"setSpec"`
+}
+
+type record struct {
+	Header   header      `xml:"header"`
+	Metadata oaiDCRecord `xml:"metadata>oai_dc:dc"`
+}
+
+type getRecord struct {
+	Record record `xml:"record"`
+}
+
+type listIdentifiers struct {
+	Headers         []header         `xml:"header"`
+	ResumptionToken *resumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+type listRecords struct {
+	Records         []record         `xml:"record"`
+	ResumptionToken *resumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+type resumptionToken struct {
+	Value            string `xml:",chardata"`
+	CompleteListSize int    `xml:"completeListSize,attr"`
+	Cursor           int    `xml:"cursor,attr"`
+}
+
+// oaiDCRecord is an oai_dc record.
+type oaiDCRecord struct {
+	XmlnsOAIDC        string    `xml:"xmlns:oai_dc,attr"`
+	XmlnsDC           string    `xml:"xmlns:dc,attr"`
+	XmlnsXSI          string    `xml:"xmlns:xsi,attr"`
+	XSISchemaLocation string    `xml:"xsi:schemaLocation,attr"`
+	Elements          []dcValue `xml:",any"`
+}
+
+type dcValue struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// ServeHTTP answers a GET or form encoded POST OAI-PMH request.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	resp := &response{
+		Xmlns:             oaiNamespace,
+		XmlnsXSI:          "http://www.w3.org/2001/XMLSchema-instance",
+		XSISchemaLocation: oaiSchemaLocation,
+		ResponseDate:      time.Now().UTC().Format(timeLayout),
+		Request:           request{URL: p.opts.BaseURL},
+	}
+	args := r.Form
+	if r.Method == http.MethodPost {
+		args = r.PostForm
+	}
+	p.handle(resp, args)
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		logger.Error("Failed to write OAI-PMH response: %v", err)
+		return
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(resp); err != nil {
+		logger.Error("Failed to write OAI-PMH response: %v", err)
+	}
+}
+
+// verbArguments lists the allowed arguments of each verb, with required ones marked.
+var verbArguments = map[string]map[string]bool{
+	"Identify":            {},
+	"ListMetadataFormats": {"identifier": false},
+	"ListSets":            {"resumptionToken": false},
+	"GetRecord":           {"identifier": true, "metadataPrefix": true},
+	"ListIdentifiers":     {"metadataPrefix": true, "from": false, "until": false, "set": false, "resumptionToken": false},
+	"ListRecords":         {"metadataPrefix": true, "from": false, "until": false, "set": false, "resumptionToken": false},
+}
+
+// handle validates the arguments of a request and fills the response of its verb.
+func (p *Provider) handle(resp *response, args url.Values) {
+	verb := args.Get("verb")
+	allowed, ok := verbArguments[verb]
+	if !ok || len(args["verb"]) != 1 {
+		resp.fail(errBadVerb, "illegal or missing verb")
+		return
+	}
+	for name, values := range args {
+		if name == "verb" {
+			continue
+		}
+		if _, ok := allowed[name]; !ok {
+			resp.fail(errBadArgument, "illegal argument: "+name)
+			return
+		}
+		if len(values) != 1 {
+			resp.fail(errBadArgument, "repeated argument: "+name)
+			return
+		}
+	}
+	if args.Has("resumptionToken") && len(args) > 2 {
+		resp.fail(errBadArgument, "resumptionToken is an exclusive argument")
+		return
+	}
+	for name, required := range allowed {
+		if required && !args.Has(name) && !args.Has("resumptionToken") {
+			resp.fail(errBadArgument, "missing argument: "+name)
+			return
+		}
+	}
+	resp.Request = request{
+		URL:             p.opts.BaseURL,
+		Verb:            verb,
+		Identifier:      args.Get("identifier"),
+		MetadataPrefix:  args.Get("metadataPrefix"),
+		From:            args.Get("from"),
+		Until:           args.Get("until"),
+		Set:             args.Get("set"),
+		ResumptionToken: args.Get("resumptionToken"),
+	}
+
+	records, err := p.records()
+	if err != nil {
+		logger.Error("Failed to list package records for OAI-PMH: %v", err)
+		resp.fail(errNoRecordsMatch, "package records are unavailable")
+		return
+	}
+	switch verb {
+	case "Identify":
+		p.identify(resp, records)
+	case "ListMetadataFormats":
+		p.listMetadataFormats(resp, records, args.Get("identifier"))
+	case "ListSets":
+		p.listSets(resp, records, args.Get("resumptionToken"))
+	case "GetRecord":
+		p.getRecord(resp, records, args.Get("identifier"), args.Get("metadataPrefix"))
+	case "ListIdentifiers", "ListRecords":
+		p.list(resp, records, verb, args)
+	}
+}
+
+func (r *response) fail(code, message string) {
+	r.Errors = append(r.Errors, oaiError{Code: code, Message: message})
+}
+
+func (p *Provider) identify(resp *response, records []*catalog.Record) {
+	earliest := time.Unix(0, 0).UTC()
+	if len(records) > 0 {
+		earliest = records[0].UpdatedAt
+	}
+	resp.Identify = &identify{
+		RepositoryName:    p.opts.RepositoryName,
+		BaseURL:           p.opts.BaseURL,
+		ProtocolVersion:   "2.0",
+		AdminEmail:        p.opts.AdminEmail,
+		EarliestDatestamp: earliest.UTC().Format(timeLayout),
+		DeletedRecord:     "no",
+		Granularity:       granularity,
+	}
+}
+
+func (p *Provider) listMetadataFormats(resp *response, records []*catalog.Record, identifier string) {
+	if identifier != "" && p.find(records, identifier) == nil {
+		resp.fail(errIDDoesNotExist, "unknown identifier: "+identifier)
+		return
+	}
+	resp.ListMetadataFormats = &listMetadataFormats{Formats: []metadataFormat{{
+		MetadataPrefix:    oaiDCPrefix,
+		Schema:            oaiDCSchema,
+		MetadataNamespace: oaiDCNamespace,
+	}}}
+}
+
+// listSets lists the processing profiles of the records. The list is never split, so tokens are never issued.
+func (p *Provider) listSets(resp *response, records []*catalog.Record, token string) {
+	if token != "" {
+		resp.fail(errBadResumptionToken, "invalid resumption token")
+		return
+	}
+	var specs []string
+	for _, rec := range records {
+		if spec := setSpec(rec); spec != "" && !slices.Contains(specs, spec) {
+			specs = append(specs, spec)
+		}
+	}
+	if len(specs) == 0 {
+		resp.fail("noSetHierarchy", "the repository has no sets")
+		return
+	}
+	sort.Strings(specs)
+	sets := make([]set, 0, len(specs))
+	for _, spec := range specs {
+		sets = append(sets, set{Spec: spec, Name: "Processing profile " + spec})
+	}
+	resp.ListSets = &listSets{Sets: sets}
+}
+
+func (p *Provider) getRecord(resp *response, records []*catalog.Record, identifier, prefix string) {
+	if prefix != oaiDCPrefix {
+		resp.fail(errCannotDisseminateFormat, "unsupported metadata format: "+prefix)
+		return
+	}
+	rec := p.find(records, identifier)
+	if rec == nil {
+		resp.fail(errIDDoesNotExist, "unknown identifier: "+identifier)
+		return
+	}
+	resp.GetRecord = &getRecord{Record: p.record(rec)}
+}
+
+// listQuery holds the arguments of a list request, carried by its resumption tokens.
+type listQuery struct {
+	Prefix string
+	From   string
+	Until  string
+	Set    string
+	Cursor int
+}
+
+// list answers ListIdentifiers and ListRecords, a page at a time.
+func (p *Provider) list(resp *response, records []*catalog.Record, verb string, args url.Values) {
+	query := listQuery{Prefix: args.Get("metadataPrefix"), From: args.Get("from"), Until: args.Get("until"), Set: args.Get("set")}
+	if token := args.Get("resumptionToken"); token != "" {
+		var ok bool
+		if query, ok = decodeToken(token); !ok {
+			resp.fail(errBadResumptionToken, "invalid resumption token")
+			return
+		}
+	}
+	if query.Prefix != oaiDCPrefix {
+		resp.fail(errCannotDisseminateFormat, "unsupported metadata format: "+query.Prefix)
+		return
+	}
+	from, until, err := parseRange(query.From, query.Until)
+	if err != nil {
+		resp.fail(errBadArgument, err.Error())
+		return
+	}
+
+	var matches []*catalog.Record
+	for _, rec := range records {
+		datestamp := rec.UpdatedAt.UTC().Truncate(time.Second)
+		if (!from.IsZero() && datestamp.Before(from)) || (!until.IsZero() && datestamp.After(until)) {
+			continue
+		}
+		if query.Set != "" && setSpec(rec) != query.Set {
+			continue
+		}
+		matches = append(matches, rec)
+	}
+	if len(matches) == 0 {
+		resp.fail(errNoRecordsMatch, "no records match the request")
+		return
+	}
+	if query.Cursor >= len(matches) {
+		resp.fail(errBadResumptionToken, "resumption token is past the end of the list")
+		return
+	}
+
+	end := min(query.Cursor+p.opts.PageSize, len(matches))
+	var token *resumptionToken
+	if end < len(matches) || query.Cursor > 0 {
+		// The last page of a split list carries an empty token
+		token = &resumptionToken{CompleteListSize: len(matches), Cursor: query.Cursor}
+		if end < len(matches) {
+			next := query
+			next.Cursor = end
+			token.Value = encodeToken(next)
+		}
+	}
+	page := matches[query.Cursor:end]
+	if verb == "ListIdentifiers" {
+		headers := make([]header, 0, len(page))
+		for _, rec := range page {
+			headers = append(headers, p.header(rec))
+		}
+		resp.ListIdentifiers = &listIdentifiers{Headers: headers, ResumptionToken: token}
+		return
+	}
+	list := make([]record, 0, len(page))
+	for _, rec := range page {
+		list = append(list, p.record(rec))
+	}
+	resp.ListRecords = &listRecords{Records: list, ResumptionToken: token}
+}
+
+// records returns the harvestable records, those whose AIP is stored, oldest datestamp first.
+func (p *Provider) records() ([]*catalog.Record, error) {
+	all, err := p.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var records []*catalog.Record
+	for _, rec := range all {
+		switch rec.State {
+		case catalog.StateStored, catalog.StateReplicated, catalog.StateDisseminated:
+			if rec.AIPUUID != "" {
+				records = append(records, rec)
+			}
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].UpdatedAt.Equal(records[j].UpdatedAt) {
+			return records[i].ID < records[j].ID
+		}
+		return records[i].UpdatedAt.Before(records[j].UpdatedAt)
+	})
+	return records, nil
+}
+
+// identifier returns the OAI identifier of a record, e.g. oai:preservation.example.org:<AIP UUID>.
+func (p *Provider) identifier(rec *catalog.Record) string {
+	return "oai:" + p.opts.RepositoryIdentifier + ":" + rec.AIPUUID
+}
+
+func (p *Provider) find(records []*catalog.Record, identifier string) *catalog.Record {
+	for _, rec := range records {
+		if p.identifier(rec) == identifier {
+			return rec
+		}
+	}
+	return nil
+}
+
+func (p *Provider) header(rec *catalog.Record) header {
+	h := header{Identifier: p.identifier(rec), Datestamp: rec.UpdatedAt.UTC().Format(timeLayout)}
+	if spec := setSpec(rec); spec != "" {
+		h.SetSpecs = []string{spec}
+	}
+	return h
+}
+
+// record returns the oai_dc record of a package: its title, Dublin Core metadata, AIP UUID and deposit DOIs.
+func (p *Provider) record(rec *catalog.Record) record {
+	dc := oaiDCRecord{
+		XmlnsOAIDC:        oaiDCNamespace,
+		XmlnsDC:           dcNamespace,
+		XmlnsXSI:          "http://www.w3.org/2001/XMLSchema-instance",
+		XSISchemaLocation: oaiDCNamespace + " " + oaiDCSchema,
+	}
+	add := func(element, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			dc.Elements = append(dc.Elements, dcValue{XMLName: xml.Name{Local: "dc:" + element}, Value: value})
+		}
+	}
+	title := rec.Metadata["dc.title"]
+	if title == "" {
+		title = rec.Title
+	}
+	if title == "" {
+		title = path.Base(rec.CellsPath)
+	}
+	add("title", title)
+	for _, element := range dcElements[1:] {
+		add(element, rec.Metadata["dc."+element])
+	}
+	add("identifier", "urn:uuid:"+rec.AIPUUID)
+	for _, deposit := range rec.Deposits {
+		if deposit.DOI != "" {
+			add("identifier", "https://doi.org/"+deposit.DOI)
+		}
+	}
+	return record{Header: p.header(rec), Metadata: dc}
+}
+
+// setSpec returns the set of a record, its processing profile with the characters set specs do not allow replaced.
+func setSpec(rec *catalog.Record) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.!~*'()", r)) {
+			return r
+		}
+		return '_'
+	}, rec.Profile)
+}
+
+// parseRange parses the from and until arguments, which must have the same granularity.
+func parseRange(fromArg, untilArg string) (time.Time, time.Time, error) {
+	from, fromDay, err := parseDatestamp(fromArg, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	until, untilDay, err := parseDatestamp(untilArg, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if fromArg != "" && untilArg != "" {
+		if fromDay != untilDay {
+			return time.Time{}, time.Time{}, fmt.Errorf("from and until have different granularities")
+		}
+		if from.After(until) {
+			return time.Time{}, time.Time{}, fmt.Errorf("from is after until")
+		}
+	}
+	return from, until, nil
+}
+
+// parseDatestamp parses a day or second datestamp. Days are inclusive, so an until day ends at its last second.
+func parseDatestamp(value string, until bool) (time.Time, bool, error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.Parse(dayLayout, value); err == nil {
+		if until {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, true, nil
+	}
+	t, err := time.Parse(timeLayout, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid datestamp: %s", value)
+	}
+	return t, false, nil
+}
+
+// encodeToken encodes the query of the next page. Tokens are stateless, so they survive restarts and never expire.
+func encodeToken(q listQuery) string {
+	raw := strings.Join([]string{q.Prefix, q.From, q.Until, q.Set, strconv.Itoa(q.Cursor)}, "\x1f")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeToken(token string) (listQuery, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return listQuery{}, false
+	}
+	parts := strings.Split(string(raw), "\x1f")
+	if len(parts) != 5 {
+		return listQuery{}, false
+	}
+	cursor, err := strconv.Atoi(parts[4])
+	if err != nil || cursor < 0 {
+		return listQuery{}, false
+	}
+	return listQuery{Prefix: parts[0], From: parts[1], Until: parts[2], Set: parts[3], Cursor: cursor}, true
+}
@@ -0,0 +1,300 @@
+// Command clientgen generates the types and methods of the Go client of the service, in pkg/client, from the OpenAPI
+// document of its routes. Run it with go generate in pkg/client after changing the routes or their types.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal"
+	"github.com/penwern/curate-preservation-core/internal/openapi"
+)
+
+// initialisms are the words written in capitals in Go names.
+var initialisms = []string{"AIP", "API", "DC", "DIP", "DOI", "GC", "HTTP", "ID", "JSON", "PII", "SFTP", "TLS", "URI", "URL", "UUID"}
+
+func main() {
+	out := flag.String("o", "client_gen.go", "Output file")
+	flag.Parse()
+
+	src, err := format.Source(generate(internal.OpenAPIDocument()))
+	if err != nil {
+		log.Fatalf("error formatting the generated client: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0o600); err != nil {
+		log.Fatalf("error writing the generated client: %v", err)
+	}
+}
+
+// generate returns the source of the client types and methods of a document.
+func generate(doc *openapi.Document) []byte {
+	var b strings.Builder
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		writeStruct(&b, name, doc.Components.Schemas[name])
+	}
+
+	type operation struct {
+		method, path string
+		op           *openapi.Operation
+	}
+	var ops []operation
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			ops = append(ops, operation{method, path, op})
+		}
+	}
+	slices.SortFunc(ops, func(a, b operation) int { return strings.Compare(a.op.OperationID, b.op.OperationID) })
+	for _, o := range ops {
+		writeMethod(&b, strings.ToUpper(o.method), o.path, o.op)
+	}
+
+	body := b.String()
+	imports := []string{"context", "net/http"}
+	for _, pkg := range []string{"net/url", "strconv", "time"} {
+		if strings.Contains(body, pkg[strings.LastIndex(pkg, "/")+1:]+".") {
+			imports = append(imports, pkg)
+		}
+	}
+	slices.Sort(imports)
+	var src strings.Builder
+	src.WriteString("// Code generated by clientgen from the OpenAPI document of the service. DO NOT EDIT.\n\n")
+	src.WriteString("package client\n\nimport (\n")
+	for _, pkg := range imports {
+		fmt.Fprintf(&src, "\t%q\n", pkg)
+	}
+	src.WriteString(")\n\n")
+	src.WriteString(body)
+	return []byte(src.String())
+}
+
+// writeStruct writes the struct type of an object schema, with its fields in the order of their JSON names.
+func writeStruct(b *strings.Builder, name string, schema *openapi.Schema) {
+	fmt.Fprintf(b, "// %s is an object of the API.\n", name)
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	props := make([]string, 0, len(schema.Properties))
+	for prop := range schema.Properties {
+		props = append(props, prop)
+	}
+	slices.Sort(props)
+	for _, prop := range props {
+		required := slices.Contains(schema.Required, prop)
+		typ := goType(schema.Properties[prop], required)
+		tag := prop
+		switch {
+		case required:
+		case typ == "time.Time":
+			tag += ",omitzero"
+		default:
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", goName(prop), typ, tag)
+	}
+	b.WriteString("}\n\n")
+}
+
+// writeMethod writes the client method of an operation, and the struct of its query parameters if it has some.
+// Streamed and downloaded operations are skipped, downloads are written by hand.
+func writeMethod(b *strings.Builder, method, path string, op *openapi.Operation) {
+	var response *openapi.Schema
+	for code, resp := range op.Responses {
+		// Errors are returned as an *Error
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		if resp.Content["text/event-stream"].Schema != nil || resp.Content["application/octet-stream"].Schema != nil {
+			return
+		}
+		response = resp.Content["application/json"].Schema
+	}
+	name := goName(op.OperationID)
+
+	args := []string{"ctx context.Context"}
+	pathExpr := `"` + path + `"`
+	var query []*openapi.Parameter
+	for _, param := range op.Parameters {
+		switch param.In {
+		case "path":
+			arg := lowerFirst(goName(param.Name))
+			args = append(args, arg+" string")
+			pathExpr = strings.Replace(pathExpr, "{"+param.Name+"}", `" + escapePath(`+arg+`) + "`, 1)
+		case "query":
+			query = append(query, param)
+		}
+	}
+	pathExpr = strings.TrimSuffix(pathExpr, ` + ""`)
+	if len(query) > 0 {
+		fmt.Fprintf(b, "// %sParams are the query parameters of %s.\n", name, name)
+		fmt.Fprintf(b, "type %sParams struct {\n", name)
+		for _, param := range query {
+			if param.Description != "" {
+				fmt.Fprintf(b, "\t// %s\n", param.Description)
+			}
+			fmt.Fprintf(b, "\t%s %s\n", goName(param.Name), paramType(param.Schema.Type))
+		}
+		b.WriteString("}\n\n")
+		args = append(args, "params *"+name+"Params")
+	}
+	body := "nil"
+	if op.RequestBody != nil {
+		typ := goType(op.RequestBody.Content["application/json"].Schema, false)
+		args = append(args, "body "+typ)
+		body = "body"
+	}
+
+	result, zero, out := "error", "", "nil"
+	if response != nil {
+		typ := goType(response, false)
+		result = "(" + typ + ", error)"
+		zero = "nil, "
+		out = "&out"
+		if strings.HasPrefix(typ, "*") {
+			out = "out"
+		}
+	}
+
+	fmt.Fprintf(b, "// %s calls %s %s: %s. %s\n", name, method, path, op.Summary, op.Description)
+	fmt.Fprintf(b, "func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), result)
+	queryExpr := "nil"
+	if len(query) > 0 {
+		queryExpr = "query"
+		b.WriteString("\tquery := url.Values{}\n\tif params != nil {\n")
+		for _, param := range query {
+			field := "params." + goName(param.Name)
+			switch param.Schema.Type {
+			case "integer":
+				fmt.Fprintf(b, "\t\tif %s != 0 {\n\t\t\tquery.Set(%q, strconv.Itoa(%s))\n\t\t}\n", field, param.Name, field)
+			case "boolean":
+				fmt.Fprintf(b, "\t\tif %s != nil {\n\t\t\tquery.Set(%q, strconv.FormatBool(*%s))\n\t\t}\n", field, param.Name, field)
+			default:
+				fmt.Fprintf(b, "\t\tif %s != \"\" {\n\t\t\tquery.Set(%q, %s)\n\t\t}\n", field, param.Name, field)
+			}
+		}
+		b.WriteString("\t}\n")
+	}
+	if response != nil {
+		typ := goType(response, false)
+		if elem, ok := strings.CutPrefix(typ, "*"); ok {
+			fmt.Fprintf(b, "\tout := new(%s)\n", elem)
+		} else {
+			fmt.Fprintf(b, "\tvar out %s\n", typ)
+		}
+	}
+	fmt.Fprintf(b, "\tif err := c.do(ctx, http.Method%s, %s, %s, %s, %s); err != nil {\n\t\treturn %serr\n\t}\n",
+		methodName(method), pathExpr, queryExpr, body, out, zero)
+	if response != nil {
+		b.WriteString("\treturn out, nil\n")
+	} else {
+		b.WriteString("\treturn nil\n")
+	}
+	b.WriteString("}\n\n")
+}
+
+// goType returns the Go type of a schema. Optional objects are pointers, and so are the objects returned or sent by
+// the client methods.
+func goType(schema *openapi.Schema, required bool) string {
+	if name := schema.RefName(); name != "" {
+		if required {
+			return name
+		}
+		return "*" + name
+	}
+	switch schema.Type {
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			return "time.Time"
+		case "byte":
+			return "[]byte"
+		}
+		return "string"
+	case "integer":
+		switch schema.Format {
+		case "int32":
+			return "int32"
+		case "int64":
+			return "int64"
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + goType(schema.Items, true)
+	case "object":
+		if schema.AdditionalProperties != nil {
+			return "map[string]" + goType(schema.AdditionalProperties, true)
+		}
+		return "map[string]any"
+	default:
+		return "any"
+	}
+}
+
+// paramType returns the Go type of a query parameter. Booleans are pointers, so that false can be sent.
+func paramType(typ string) string {
+	switch typ {
+	case "integer":
+		return "int"
+	case "boolean":
+		return "*bool"
+	default:
+		return "string"
+	}
+}
+
+// methodName returns the name of an HTTP method in the net/http constants, e.g. Get.
+func methodName(method string) string {
+	return method[:1] + strings.ToLower(method[1:])
+}
+
+// goName returns the Go name of a JSON name or operation ID, e.g. AIPUUID for aip_uuid.
+func goName(name string) string {
+	var words []string
+	start := 0
+	for i := 1; i <= len(name); i++ {
+		switch {
+		case i == len(name) || name[i] == '_' || name[i] == '-' || name[i] == '.':
+			words = append(words, name[start:i])
+			start = i + 1
+		case isUpper(name[i]) && !isUpper(name[i-1]):
+			words = append(words, name[start:i])
+			start = i
+		}
+	}
+	var b strings.Builder
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		if upper := strings.ToUpper(word); slices.Contains(initialisms, upper) {
+			b.WriteString(upper)
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+func lowerFirst(name string) string {
+	for _, initialism := range initialisms {
+		if name == initialism {
+			return strings.ToLower(name)
+		}
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/a3mclient"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// TimelineResponse is the response of the package timeline endpoint.
+type TimelineResponse struct {
+	ID     string          `json:"id"`
+	Events []catalog.Event `json:"events"`
+}
+
+// StateResponse is the response of the package state endpoint.
+type StateResponse struct {
+	ID      string                `json:"id"`
+	State   catalog.State         `json:"state"`
+	History []catalog.StateChange `json:"history"`
+
+	Processing *a3mclient.Progress `json:"processing,omitempty"`
+}
+
+// Page sizes of the package list.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// PackagesHandler lists package records, most recent first, a page at a time. Users bound to a tenant only list the
+// records of their tenant. Records can be filtered with the username, path, workspace, profile, outcome, state (comma separated),
+// review_required, since and until (RFC 3339, on the creation time) query parameters, sorted with the sort and order
+// (asc or desc) query parameters, and paged with the offset and limit query parameters.
+func PackagesHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "package records are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		q, err := parsePackagesQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Tenant = preservation.TenantFromContext(r.Context())
+		page, err := store.Find(*q)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list package records: %v", err))
+			http.Error(w, "failed to list package records", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, page)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// parsePackagesQuery reads the filters, sort and page of the package list.
+func parsePackagesQuery(query url.Values) (*catalog.Query, error) {
+	q := &catalog.Query{
+		Username:    query.Get("username"),
+		Path:        query.Get("path"),
+		Workspace:   query.Get("workspace"),
+		Profile:     query.Get("profile"),
+		Outcome:     query.Get("outcome"),
+		Fingerprint: query.Get("fingerprint"),
+		Sort:        query.Get("sort"),
+		Limit:       defaultPageSize,
+	}
+	if q.Sort != "" && !slices.Contains(catalog.SortFields, q.Sort) {
+		return nil, fmt.Errorf("invalid sort parameter, expected one of %s", strings.Join(catalog.SortFields, ", "))
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return nil, errors.New("invalid order parameter, expected asc or desc")
+	}
+	if v := query.Get("state"); v != "" {
+		for _, state := range strings.Split(v, ",") {
+			if !slices.Contains(catalog.States, catalog.State(state)) {
+				return nil, fmt.Errorf("invalid state parameter: unknown state %q", state)
+			}
+			q.States = append(q.States, catalog.State(state))
+		}
+	}
+	if v := query.Get("review_required"); v != "" {
+		review, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("invalid review_required parameter, expected true or false")
+		}
+		q.ReviewRequired = &review
+	}
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := query.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s parameter, expected RFC 3339 timestamp", name)
+			}
+			*t = parsed
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, errors.New("invalid offset parameter, expected a non-negative integer")
+		}
+		q.Offset = offset
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return nil, fmt.Errorf("invalid limit parameter, expected an integer from 1 to %d", maxPageSize)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// PackageHandler returns the record of a package, including its full timeline.
+func PackageHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := getRecord(w, r, store, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		writeJSON(w, rec)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// StateHandler returns the lifecycle state of a package and its history.
+func StateHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := getRecord(w, r, store, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		writeJSON(w, StateResponse{ID: rec.ID, State: rec.State, History: rec.StateHistory, Processing: rec.Processing})
+	}
+	return recoveryMiddleware(handler)
+}
+
+// StatesHandler returns the number of packages in each lifecycle state, for monitoring. Users bound to a tenant only
+// count the packages of their tenant.
+func StatesHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "package records are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		records, err := store.List()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list package records: %v", err))
+			http.Error(w, "failed to list package records", http.StatusInternalServerError)
+			return
+		}
+		counts := make(map[catalog.State]int, len(catalog.States))
+		for _, state := range catalog.States {
+			counts[state] = 0
+		}
+		q := catalog.Query{Tenant: preservation.TenantFromContext(r.Context())}
+		for _, rec := range records {
+			if q.Match(rec) {
+				counts[rec.State]++
+			}
+		}
+		writeJSON(w, counts)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// TimelineHandler returns the timeline of a package.
+// Events can be filtered with the type, outcome and since (RFC 3339) query parameters.
+func TimelineHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var since time.Time
+		if v := query.Get("since"); v != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid since parameter, expected RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+		rec, ok := getRecord(w, r, store, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		writeJSON(w, TimelineResponse{
+			ID:     rec.ID,
+			Events: catalog.Filter(rec.Events, query.Get("type"), query.Get("outcome"), since),
+		})
+	}
+	return recoveryMiddleware(handler)
+}
+
+// getRecord reads a package record, writing the error response if it cannot be read. The records of other tenants
+// are not found by users bound to a tenant.
+func getRecord(w http.ResponseWriter, r *http.Request, store *catalog.Store, id string) (*catalog.Record, bool) {
+	if store == nil {
+		http.Error(w, "package records are disabled", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	rec, err := store.Get(id)
+	if tenant := preservation.TenantFromContext(r.Context()); err == nil && tenant != "" && rec.Tenant != tenant {
+		err = catalog.ErrNotFound
+	}
+	if errors.Is(err, catalog.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to read package record %s: %v", id, err))
+		http.Error(w, "failed to read package record", http.StatusInternalServerError)
+		return nil, false
+	}
+	return rec, true
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write response: %v", err))
+	}
+}
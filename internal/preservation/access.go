@@ -0,0 +1,121 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// publishAccessCopies uploads the access derivatives of a DIP to a Cells folder named after the package,
+// and creates a share link for it if the profile asks for one. The upload path and link are kept on the package record.
+// Access copies are a convenience for staff, so failures are recorded and logged, not returned.
+func (p *Preserver) publishAccessCopies(ctx context.Context, userClient cells.UserClient, processingDir, dipPath, name string, cfg *config.AccessCopyConfig, recorder *catalog.Recorder) {
+	stagingDir := filepath.Join(processingDir, "access", name)
+	finishEvent := recorder.Start(catalog.EventDissemination, "Upload access copies to Cells: "+cfg.Destination)
+	copied, err := copyDir(ctx, filepath.Join(dipPath, "objects"), stagingDir)
+	if err == nil && copied == 0 {
+		err = fmt.Errorf("DIP has no access copies")
+	}
+	var cellsPath string
+	if err == nil {
+		cellsPath, err = p.cellsClient.UploadNode(ctx, userClient, stagingDir, cfg.Destination)
+	}
+	finishEvent(err)
+	if err != nil {
+		logger.Error("Error uploading access copies: %v", err)
+		return
+	}
+	logger.Info("Uploaded %d access copies: %s", copied, cellsPath)
+	recorder.Update(func(rec *catalog.Record) { rec.AccessCopiesPath = cellsPath })
+
+	if !cfg.ShareLink {
+		return
+	}
+	finishEvent = recorder.Start(catalog.EventDissemination, "Create share link: "+cellsPath)
+	link, err := p.createShareLink(ctx, userClient, cellsPath, name, cfg)
+	finishEvent(err)
+	if err != nil {
+		logger.Error("Error creating share link for access copies: %v", err)
+		return
+	}
+	logger.Info("Shared access copies: %s", link)
+	recorder.Update(func(rec *catalog.Record) { rec.ShareLink = link })
+}
+
+// createShareLink creates a share link for an uploaded Cells node. Returns the link URL.
+func (p *Preserver) createShareLink(ctx context.Context, userClient cells.UserClient, cellsPath, label string, cfg *config.AccessCopyConfig) (string, error) {
+	resolvedPath, err := p.cellsClient.ResolveCellsPath(userClient, cellsPath)
+	if err != nil {
+		return "", fmt.Errorf("error resolving access copies path: %w", err)
+	}
+	nodeStats, err := p.getNodeStats(ctx, resolvedPath)
+	if err != nil {
+		return "", err
+	}
+	opts := cells.ShareLinkOptions{MaxDownloads: cfg.MaxDownloads}
+	if cfg.ExpireDays > 0 {
+		opts.ExpiresAt = time.Now().AddDate(0, 0, cfg.ExpireDays)
+	}
+	return p.cellsClient.CreateShareLink(ctx, userClient, nodeStats.Node.UUID, label, opts)
+}
+
+// copyDir copies the regular files of a directory tree. Returns the number of files copied.
+func copyDir(ctx context.Context, src, dest string) (int, error) {
+	copied := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return utils.CreateDir(target)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if err := copyFile(path, target); err != nil {
+			return fmt.Errorf("error copying %s: %w", rel, err)
+		}
+		copied++
+		return nil
+	})
+	return copied, err
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
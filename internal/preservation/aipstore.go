@@ -0,0 +1,160 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/penwern/curate-preservation-core/internal/aipstore"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/limits"
+	"github.com/penwern/curate-preservation-core/internal/notify"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// AIPStore returns the store of a storage location. An empty name selects the first location.
+// The AIPs of tenants are found below the storage prefix of their tenant, from their package records.
+// The caller is responsible for closing the store.
+func (p *Preserver) AIPStore(name string) (*aipstore.Store, error) {
+	aipStorage := p.integrations().aipStorage
+	if aipStorage == nil {
+		return nil, fmt.Errorf("AIP storage is not configured")
+	}
+	location := aipStorage.Locations[0]
+	if name != "" {
+		if location = aipStorage.Location(name); location == nil {
+			return nil, fmt.Errorf("storage location not found: %s", name)
+		}
+	}
+	store, err := aipstore.New(location, p.envConfig.AllowInsecureTLS, p.envConfig.Retry.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if prefixes := p.tenantPrefixes(); prefixes != nil {
+		store.SetTenantPrefix(prefixes)
+	}
+	return store, nil
+}
+
+// StorageLocations returns the names of the AIP storage locations.
+func (p *Preserver) StorageLocations() []string {
+	aipStorage := p.integrations().aipStorage
+	if aipStorage == nil {
+		return nil
+	}
+	names := make([]string, 0, len(aipStorage.Locations))
+	for _, location := range aipStorage.Locations {
+		names = append(names, location.Name)
+	}
+	return names
+}
+
+// replicateAIP stores a copy of the AIP in every configured storage location, in the given tier
+// or the default tier of each location if empty. Returns true if the AIP was stored in all locations. The AIP is already stored in Cells at this point,
+// so failures are recorded and logged, not returned.
+func (p *Preserver) replicateAIP(ctx context.Context, aipUUID, aipPath, tier string, recorder *catalog.Recorder) bool {
+	aipStorage := p.integrations().aipStorage
+	if aipStorage == nil {
+		return false
+	}
+	replicated := true
+	for _, location := range aipStorage.Locations {
+		finishEvent := recorder.Start(catalog.EventStorage, "Replicate AIP to "+location.Name)
+		key, err := p.storeAIP(ctx, location.Name, aipUUID, aipPath, tier, func(file string, stored, total int) {
+			recorder.Progress(catalog.EventStorage, file, stored, total)
+		})
+		finishEvent(err)
+		if err != nil {
+			logger.Error("Error replicating AIP to %s: %v", location.Name, err)
+			replicated = false
+			continue
+		}
+		logger.Info("Replicated AIP to %s: %s", location.Name, key)
+		recorder.Update(func(rec *catalog.Record) {
+			rec.Replicas = append(rec.Replicas, catalog.Replica{Location: location.Name, Key: key})
+		})
+	}
+	return replicated
+}
+
+// storeAIP stores the AIP in a storage location, reporting each file stored to progress. Returns the key prefix of
+// the stored AIP.
+func (p *Preserver) storeAIP(ctx context.Context, location, aipUUID, aipPath, tier string, progress func(file string, stored, total int)) (string, error) {
+	store, err := p.AIPStore(location)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+	tenant, err := p.tenant(ctx)
+	if err != nil {
+		return "", err
+	}
+	if tenant != nil {
+		// The AIP may not be recorded, e.g. when package records are disabled
+		store.SetTenantPrefix(func(string) string { return tenant.Prefix() })
+	}
+	release, err := p.limits.Acquire(ctx, limits.Storage)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return store.StoreAIP(ctx, aipUUID, aipPath, tier, progress)
+}
+
+// VerifyAIP checks the fixity of an AIP in a storage location. Failures are notified to the recipients
+// of the package the AIP was produced from.
+func (p *Preserver) VerifyAIP(ctx context.Context, location, aipUUID string) (*aipstore.FixityReport, error) {
+	store, err := p.AIPStore(location)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return p.verifyAIP(ctx, store, aipUUID)
+}
+
+// verifyAIP checks the fixity of an AIP in an open store, notifying failures.
+func (p *Preserver) verifyAIP(ctx context.Context, store *aipstore.Store, aipUUID string) (*aipstore.FixityReport, error) {
+	report, err := store.VerifyAIP(ctx, aipUUID)
+	if err != nil || report.Success() {
+		return report, err
+	}
+	p.notifyFixity(aipUUID, report.Location, fmt.Sprintf("%d of %d files failed the fixity check in %s", len(report.Failures), report.Files, report.Location))
+	return report, nil
+}
+
+// notifyFixity notifies the recipients of the package an AIP was produced from that the AIP is damaged or lost in a
+// storage location.
+func (p *Preserver) notifyFixity(aipUUID, location, detail string) {
+	event := notify.Event{
+		Type:     config.NotifyEventFixityFailed,
+		Severity: notify.SeverityError,
+		AIPUUID:  aipUUID,
+		Location: location,
+		Detail:   detail,
+	}
+	if rec := p.packageRecord(aipUUID); rec != nil {
+		event.PackageID = rec.ID
+		event.CellsPath = rec.CellsPath
+		event.Username = rec.Username
+		event.Profile = rec.Profile
+	}
+	p.integrations().notifier.Notify(event)
+}
+
+// packageRecord returns the record of the package an AIP was produced from, or nil if it is not found.
+func (p *Preserver) packageRecord(aipUUID string) *catalog.Record {
+	if p.catalog == nil {
+		return nil
+	}
+	records, err := p.catalog.List()
+	if err != nil {
+		logger.Error("Error listing package records: %v", err)
+		return nil
+	}
+	for _, rec := range records {
+		if rec.AIPUUID == aipUUID {
+			return rec
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package preservation
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal/archivesspace"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/processor"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/pydio/cells-sdk-go/v4/models"
+)
+
+// archivesSpaceURITagNamespace holds the URI of the ArchivesSpace archival object a package belongs to.
+const archivesSpaceURITagNamespace = "usermeta-archivesspace-uri"
+
+// registerInArchivesSpace creates an ArchivesSpace digital object for a stored AIP, linked to the archival object
+// set on the package. The AIP is already preserved at this point, so failures are recorded and logged, not returned.
+func (p *Preserver) registerInArchivesSpace(ctx context.Context, parent *models.TreeNode, aipUUID, aipPath, cellsUploadPath string, recorder *catalog.Recorder) {
+	archivesSpace := p.integrations().archivesSpace
+	archivalObjectURI := strings.Trim(parent.MetaStore[archivesSpaceURITagNamespace], `"\ `)
+	if archivalObjectURI == "" {
+		return
+	}
+	if archivesSpace == nil {
+		logger.Warn("Package linked to ArchivesSpace archival object %s, but ArchivesSpace is not configured", archivalObjectURI)
+		return
+	}
+
+	finishEvent := recorder.Start(catalog.EventStorage, "Register AIP in ArchivesSpace: "+archivalObjectURI)
+	client, err := archivesspace.NewClient(ctx, archivesSpace, p.envConfig.AllowInsecureTLS)
+	if err != nil {
+		finishEvent(err)
+		logger.Error("Error creating ArchivesSpace client: %v", err)
+		return
+	}
+	defer client.Close()
+
+	metadata := processor.NodeMetadata(parent)
+	obj := archivesspace.DigitalObject{
+		Title:      packageTitle(parent, metadata),
+		Identifier: aipUUID,
+		FileURI:    cellsUploadPath,
+		Rights:     metadata["dc.rights"],
+	}
+	if info, statErr := os.Stat(aipPath); statErr == nil && info.Mode().IsRegular() {
+		if obj.Checksum, err = utils.FileChecksum(aipPath, "sha256"); err != nil {
+			logger.Warn("Error computing AIP checksum for ArchivesSpace: %v", err)
+		}
+	}
+
+	digitalObjectURI, err := client.RegisterAIP(ctx, archivalObjectURI, obj)
+	finishEvent(err)
+	if err != nil {
+		logger.Error("Error registering AIP in ArchivesSpace: %v", err)
+		return
+	}
+	if digitalObjectURI != "" {
+		logger.Info("Registered AIP in ArchivesSpace: %s", digitalObjectURI)
+		recorder.Update(func(rec *catalog.Record) { rec.ArchivesSpaceURI = digitalObjectURI })
+	}
+}
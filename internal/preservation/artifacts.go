@@ -0,0 +1,60 @@
+package preservation
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	transferservice "github.com/penwern/curate-preservation-core/common/proto/a3m/gen/go/a3m/api/transferservice/v1beta1"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// writeStageLog writes the log of the a3m jobs of a transfer to the report directory, with the error of the
+// processing if it failed. Artifacts are for debugging, so failures are only logged.
+func writeStageLog(reportDir, transferName string, resp *transferservice.ReadResponse, processErr error) {
+	jobs := append([]*transferservice.Job(nil), resp.GetJobs()...)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].GetStartTime().AsTime().Before(jobs[j].GetStartTime().AsTime())
+	})
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "a3m transfer: %s\n", transferName)
+	if resp != nil {
+		fmt.Fprintf(&b, "Status: %s\n", strings.TrimPrefix(resp.GetStatus().String(), "PACKAGE_STATUS_"))
+	}
+	fmt.Fprintf(&b, "Jobs: %d\n\n", len(jobs))
+	for _, job := range jobs {
+		fmt.Fprintf(&b, "%s  %-10s %s: %s (job %s, link %s)\n",
+			job.GetStartTime().AsTime().UTC().Format(time.RFC3339),
+			strings.TrimPrefix(job.GetStatus().String(), "STATUS_"),
+			job.GetGroup(), job.GetName(), job.GetId(), job.GetLinkId())
+	}
+	if processErr != nil {
+		// The error holds the tasks of the failed jobs, with their output
+		fmt.Fprintf(&b, "\nError: %v\n", processErr)
+	}
+	if err := os.WriteFile(filepath.Join(reportDir, catalog.ArtifactStageLog), b.Bytes(), 0o600); err != nil {
+		logger.Error("Error writing stage log: %v", err)
+	}
+}
+
+// copyMETS copies the METS of an extracted AIP to the report directory. Artifacts are for debugging, so failures
+// are only logged.
+func copyMETS(aipPath, reportDir string) {
+	matches, err := filepath.Glob(filepath.Join(aipPath, "data", "METS.*.xml"))
+	if err != nil || len(matches) == 0 {
+		logger.Warn("METS not found in AIP: %s", aipPath)
+		return
+	}
+	data, err := os.ReadFile(matches[0])
+	if err == nil {
+		err = os.WriteFile(filepath.Join(reportDir, catalog.ArtifactMETS), data, 0o600)
+	}
+	if err != nil {
+		logger.Error("Error copying METS: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package preservation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// ErrDuplicate is returned when the content of a transfer was already preserved and the profile skips duplicates.
+var ErrDuplicate = utils.Classify(utils.ErrPolicy, errors.New("transfer already preserved"))
+
+// checkDuplicate records the fingerprint of a transfer and looks for a preserved package with the same content.
+// A duplicate is recorded on the package with a reference to the existing AIP, and logged as a warning. Returns
+// ErrDuplicate if duplicates are skipped. Transfers are only compared within the tenant of the package, and not at
+// all without package records.
+func (p *Preserver) checkDuplicate(recorder *catalog.Recorder, fingerprint string, skip bool) error {
+	store := p.Catalog()
+	if store == nil || recorder == nil || fingerprint == "" {
+		return nil
+	}
+	recorder.Update(func(rec *catalog.Record) { rec.Fingerprint = fingerprint })
+	rec := recorder.Record()
+	existing := p.findDuplicate(store, rec.Tenant, fingerprint, rec.ID)
+	if existing == nil {
+		return nil
+	}
+
+	duplicate := &catalog.Duplicate{PackageID: existing.ID, AIPUUID: existing.AIPUUID, CellsPath: existing.CellsPath}
+	recorder.Update(func(rec *catalog.Record) { rec.DuplicateOf = duplicate })
+	detail := fmt.Sprintf("Content already preserved as AIP %s (package %s from %s)", existing.AIPUUID, existing.ID, existing.CellsPath)
+	if skip {
+		recorder.Add(catalog.EventAppraisal, catalog.OutcomeFailure, detail)
+		return fmt.Errorf("%w: AIP %s", ErrDuplicate, existing.AIPUUID)
+	}
+	logger.Warn("%s: %s", detail, rec.CellsPath)
+	recorder.Add(catalog.EventAppraisal, catalog.OutcomeWarning, detail)
+	return nil
+}
+
+// findDuplicate returns the most recent package of the tenant preserved with the given fingerprint, other than the
+// package with the given ID, or nil if there is none.
+func (p *Preserver) findDuplicate(store *catalog.Store, tenant, fingerprint, exclude string) *catalog.Record {
+	page, err := store.Find(catalog.Query{Tenant: tenant, Fingerprint: fingerprint, Outcome: catalog.OutcomeSuccess})
+	if err != nil {
+		// The lookup must not break the preservation
+		logger.Error("Error looking for packages with fingerprint %s: %v", fingerprint, err)
+		return nil
+	}
+	for _, candidate := range page.Packages {
+		if candidate.ID != exclude && candidate.AIPUUID != "" {
+			return candidate
+		}
+	}
+	return nil
+}
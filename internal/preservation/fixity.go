@@ -0,0 +1,249 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/aipstore"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/premis"
+	"github.com/penwern/curate-preservation-core/pkg/version"
+)
+
+// maxListedFailures is the number of damaged files listed in the timeline event of a fixity check.
+const maxListedFailures = 10
+
+// FixityResult is the result of the fixity check of the AIP of a package in a storage location.
+type FixityResult struct {
+	PackageID string `json:"package_id"`
+	AIPUUID   string `json:"aip_uuid"`
+	Location  string `json:"location"`
+	Files     int    `json:"files"`
+	Failures  int    `json:"failures"`
+	Error     string `json:"error,omitempty"` // The AIP could not be checked, e.g. it is missing from the location
+}
+
+// Success reports whether the AIP was checked and every file passed.
+func (r *FixityResult) Success() bool {
+	return r.Error == "" && r.Failures == 0
+}
+
+// CheckPackageFixity checks the fixity of the AIP of a recorded package in each storage location it was replicated
+// to, against the manifest stored with it. Each check is recorded as a fixity event in the timeline of the package
+// and in its PREMIS fixity events, and failures are notified. Returns an error if the package has no stored AIP.
+func (p *Preserver) CheckPackageFixity(ctx context.Context, id string) ([]*FixityResult, error) {
+	if p.catalog == nil {
+		return nil, fmt.Errorf("package records are disabled, packages cannot be checked by ID")
+	}
+	rec, err := p.catalog.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading package record %s: %w", id, err)
+	}
+	if rec.AIPUUID == "" || len(rec.Replicas) == 0 {
+		return nil, fmt.Errorf("package %s has no AIP in the storage locations", id)
+	}
+	stores := map[string]*aipstore.Store{}
+	defer closeStores(stores)
+	return p.checkPackageFixity(ctx, rec, stores)
+}
+
+// CheckAllFixity checks the fixity of the AIPs of every recorded package with stored replicas, like
+// CheckPackageFixity. Packages without a stored AIP are skipped.
+func (p *Preserver) CheckAllFixity(ctx context.Context) ([]*FixityResult, error) {
+	if p.catalog == nil {
+		return nil, fmt.Errorf("package records are disabled, there are no packages to check")
+	}
+	records, err := p.catalog.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing package records: %w", err)
+	}
+	stores := map[string]*aipstore.Store{}
+	defer closeStores(stores)
+	var results []*FixityResult
+	for _, rec := range records {
+		if rec.AIPUUID == "" || len(rec.Replicas) == 0 {
+			continue
+		}
+		checked, err := p.checkPackageFixity(ctx, rec, stores)
+		results = append(results, checked...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// PlanPackageFixity is a dry run of CheckPackageFixity: it returns the checks of the AIP of a package it would make
+// and record, without reading the storage locations.
+func (p *Preserver) PlanPackageFixity(id string) ([]PlannedAction, error) {
+	if p.catalog == nil {
+		return nil, fmt.Errorf("package records are disabled, packages cannot be checked by ID")
+	}
+	rec, err := p.catalog.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading package record %s: %w", id, err)
+	}
+	if rec.AIPUUID == "" || len(rec.Replicas) == 0 {
+		return nil, fmt.Errorf("package %s has no AIP in the storage locations", id)
+	}
+	return planPackageFixity(rec), nil
+}
+
+// PlanAllFixity is a dry run of CheckAllFixity, like PlanPackageFixity for every package with a stored AIP.
+func (p *Preserver) PlanAllFixity() ([]PlannedAction, error) {
+	if p.catalog == nil {
+		return nil, fmt.Errorf("package records are disabled, there are no packages to check")
+	}
+	records, err := p.catalog.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing package records: %w", err)
+	}
+	var actions []PlannedAction
+	for _, rec := range records {
+		if rec.AIPUUID == "" || len(rec.Replicas) == 0 {
+			continue
+		}
+		actions = append(actions, planPackageFixity(rec)...)
+	}
+	return actions, nil
+}
+
+// planPackageFixity returns the checks of the replicas of the AIP of a package and their recording.
+func planPackageFixity(rec *catalog.Record) []PlannedAction {
+	actions := make([]PlannedAction, 0, len(rec.Replicas)+1)
+	for _, replica := range rec.Replicas {
+		actions = append(actions, PlannedAction{
+			Stage:  catalog.EventFixity,
+			Action: fmt.Sprintf("Verify AIP %s of package %s in %s", rec.AIPUUID, rec.ID, replica.Location),
+		})
+	}
+	return append(actions, PlannedAction{
+		Stage:  catalog.EventFixity,
+		Action: fmt.Sprintf("Record the checks in the timeline of package %s and in %s", rec.ID, catalog.ArtifactFixityPremis),
+	})
+}
+
+// checkPackageFixity checks the replicas of the AIP of a package with the stores of their locations, opening them as
+// needed, and records the checks.
+func (p *Preserver) checkPackageFixity(ctx context.Context, rec *catalog.Record, stores map[string]*aipstore.Store) ([]*FixityResult, error) {
+	results := make([]*FixityResult, 0, len(rec.Replicas))
+	events := make([]catalog.Event, 0, len(rec.Replicas))
+	for _, replica := range rec.Replicas {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		result := &FixityResult{PackageID: rec.ID, AIPUUID: rec.AIPUUID, Location: replica.Location}
+		start := time.Now().UTC()
+		report, err := p.verifyReplica(ctx, stores, replica.Location, rec.AIPUUID)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		event := catalog.Event{
+			Time:       start,
+			Type:       catalog.EventFixity,
+			Outcome:    catalog.OutcomeSuccess,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		switch {
+		case err != nil:
+			logger.Error("Error verifying AIP %s in %s: %v", rec.AIPUUID, replica.Location, err)
+			result.Error = err.Error()
+			event.Outcome = catalog.OutcomeFailure
+			event.Detail = fmt.Sprintf("%s%s: %v", catalog.FixityCheckDetail, replica.Location, err)
+		case !report.Success():
+			result.Files, result.Failures = report.Files, len(report.Failures)
+			paths := make([]string, 0, min(len(report.Failures), maxListedFailures))
+			for _, failure := range report.Failures[:min(len(report.Failures), maxListedFailures)] {
+				paths = append(paths, failure.Path)
+			}
+			event.Outcome = catalog.OutcomeFailure
+			event.Detail = fmt.Sprintf("%s%s: %d of %d files failed (%s)", catalog.FixityCheckDetail, replica.Location,
+				len(report.Failures), report.Files, strings.Join(paths, ", "))
+		default:
+			result.Files = report.Files
+			event.Detail = fmt.Sprintf("%s%s: %d files verified", catalog.FixityCheckDetail, replica.Location, report.Files)
+		}
+		results = append(results, result)
+		events = append(events, event)
+	}
+
+	updated, err := p.catalog.AddEvents(rec.ID, events...)
+	if err != nil {
+		return results, fmt.Errorf("error recording the fixity checks of package %s: %w", rec.ID, err)
+	}
+	if err := p.writeFixityPremis(updated); err != nil {
+		return results, fmt.Errorf("error writing the PREMIS fixity events of package %s: %w", rec.ID, err)
+	}
+	return results, nil
+}
+
+// verifyReplica checks the fixity of an AIP in a storage location, notifying failures.
+func (p *Preserver) verifyReplica(ctx context.Context, stores map[string]*aipstore.Store, location, aipUUID string) (*aipstore.FixityReport, error) {
+	store, ok := stores[location]
+	if !ok {
+		var err error
+		if store, err = p.AIPStore(location); err != nil {
+			return nil, err
+		}
+		stores[location] = store
+	}
+	return p.verifyAIP(ctx, store, aipUUID)
+}
+
+// writeFixityPremis writes the PREMIS events of the fixity checks of the stored AIP of a package, from its timeline,
+// to the package record directory.
+func (p *Preserver) writeFixityPremis(rec *catalog.Record) error {
+	agent := premis.Agent{
+		AgentIdentifier: premis.AgentIdentifier{
+			IdentifierType:  "Preservation System",
+			IdentifierValue: version.Identifier(),
+		},
+		AgentType: "Software",
+		AgentName: "Curate Preservation System",
+	}
+	premisRoot := premis.Premis{
+		XMLNS:   "http://www.loc.gov/premis/v3",
+		XSI:     "http://www.w3.org/2001/XMLSchema-instance",
+		Version: "3.0",
+		Schema:  "http://www.loc.gov/premis/v3 https://www.loc.gov/standards/premis/premis.xsd",
+		Agents:  []premis.Agent{agent},
+	}
+	for _, event := range rec.Events {
+		if event.Type != catalog.EventFixity || !strings.HasPrefix(event.Detail, catalog.FixityCheckDetail) {
+			continue
+		}
+		outcome := "pass"
+		if event.Outcome != catalog.OutcomeSuccess {
+			outcome = "fail"
+		}
+		location, note, _ := strings.Cut(strings.TrimPrefix(event.Detail, catalog.FixityCheckDetail), ": ")
+		premisRoot.Events = append(premisRoot.Events, premis.Event{
+			EventIdentifier: premis.EventIdentifier{IdentifierType: "UUID", IdentifierValue: event.ID},
+			EventType:       "fixity check",
+			EventDateTime:   event.Time.Format(time.RFC3339),
+			EventDetailInformation: premis.EventDetailInformation{
+				EventDetail: "SHA-256 checksums of the files of the AIP in " + location + " compared to its stored manifest",
+			},
+			EventOutcomeInformation: premis.EventOutcomeInformation{
+				EventOutcome:       outcome,
+				EventOutcomeDetail: premis.EventOutcomeDetail{EventOutcomeDetailNote: note},
+			},
+			LinkingAgentIdentifiers: []premis.LinkingAgentIdentifier{premis.LinkingAgentIdentifier(agent.AgentIdentifier)},
+			LinkingObjectIdentifiers: []premis.LinkingObjectIdentifier{
+				{ObjectIdentifierType: "UUID", ObjectIdentifierValue: rec.AIPUUID},
+			},
+		})
+	}
+	return premis.WritePremis(premisRoot, filepath.Join(p.catalog.Dir(rec.ID), catalog.ArtifactFixityPremis))
+}
+
+// closeStores closes the stores opened for fixity checks.
+func closeStores(stores map[string]*aipstore.Store) {
+	for _, store := range stores {
+		store.Close()
+	}
+}
@@ -0,0 +1,31 @@
+package preservation
+
+import (
+	"context"
+
+	"github.com/penwern/curate-preservation-core/internal/health"
+)
+
+// HealthChecks returns the checks of the services preservations depend on: a3m, Cells and the AIP storage
+// locations.
+func (p *Preserver) HealthChecks() []health.Check {
+	checks := []health.Check{
+		{Name: "a3m", Run: func(ctx context.Context) (string, error) {
+			return "", p.a3mClient.Ping(ctx)
+		}},
+		{Name: "cells", Run: func(ctx context.Context) (string, error) {
+			return "", p.cellsClient.Ping(ctx)
+		}},
+	}
+	for _, name := range p.StorageLocations() {
+		checks = append(checks, health.Check{Name: "storage:" + name, Run: func(ctx context.Context) (string, error) {
+			store, err := p.AIPStore(name)
+			if err != nil {
+				return "", err
+			}
+			defer store.Close()
+			return "", store.Ping(ctx)
+		}})
+	}
+	return checks
+}
@@ -0,0 +1,158 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/source"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Intake returns the presigned upload intake configuration. Returns nil if the intake is not configured.
+func (p *Preserver) Intake() *config.IntakeConfig {
+	sources := p.integrations().sources
+	if sources == nil {
+		return nil
+	}
+	return sources.Intake
+}
+
+// CreateUpload starts a presigned upload of a transfer to the intake source.
+// Each upload is written below its own prefix, so transfers with the same name don't collide, and the uploads of a
+// tenant below the tenant name. Tenants without an intake folder cannot upload.
+func (p *Preserver) CreateUpload(ctx context.Context, name string, size int64) (*source.Upload, error) {
+	intake := p.Intake()
+	if intake == nil {
+		return nil, fmt.Errorf("the upload intake is not configured")
+	}
+	name = path.Base(path.Clean("/" + name))
+	if name == "/" || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid transfer name: %q", name)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("transfer size must be positive")
+	}
+	if intake.MaxSizeGB > 0 && size > int64(intake.MaxSizeGB)*1024*1024*1024 {
+		return nil, fmt.Errorf("transfer exceeds the maximum size of %d GiB", intake.MaxSizeGB)
+	}
+
+	tenant, err := p.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := path.Join(utils.NewUUID(), name)
+	intakeFolder := ""
+	if tenant != nil {
+		if tenant.IntakeFolder == "" {
+			return nil, fmt.Errorf("%w: tenant %s has no intake folder", ErrTenantAccess, tenant.Name)
+		}
+		key = path.Join(tenant.Name, key)
+		intakeFolder = tenant.IntakeFolder
+	}
+	if err := p.CheckPackageSize(ctx, intakeFolder, size); err != nil {
+		return nil, err
+	}
+
+	client, err := p.intakeSource()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return client.CreateUpload(ctx, key, size, intake.PartSize(), intake.Expiry())
+}
+
+// CompleteUpload assembles the uploaded parts of a transfer in the intake source.
+func (p *Preserver) CompleteUpload(ctx context.Context, transferPath, uploadID string, parts []source.CompletedPart) error {
+	if err := p.checkUploadTenant(ctx, transferPath); err != nil {
+		return err
+	}
+	client, err := p.intakeSource()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.CompleteUpload(ctx, transferPath, uploadID, parts)
+}
+
+// AbortUpload cancels an upload to the intake source.
+func (p *Preserver) AbortUpload(ctx context.Context, transferPath, uploadID string) error {
+	if err := p.checkUploadTenant(ctx, transferPath); err != nil {
+		return err
+	}
+	client, err := p.intakeSource()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.AbortUpload(ctx, transferPath, uploadID)
+}
+
+// checkUploadTenant returns ErrTenantAccess if an upload path is not below the name of the tenant of the context.
+func (p *Preserver) checkUploadTenant(ctx context.Context, transferPath string) error {
+	tenant, err := p.tenant(ctx)
+	if err != nil || tenant == nil {
+		return err
+	}
+	if !strings.HasPrefix(path.Clean("/"+transferPath), "/"+tenant.Name+"/") {
+		return fmt.Errorf("%w: upload %s is not an upload of tenant %s", ErrTenantAccess, transferPath, tenant.Name)
+	}
+	return nil
+}
+
+// UploadDestination returns the Cells folder the transfers uploaded to the service are copied to: the intake folder of
+// the tenant of the context, or the tus destination of the service. Tenants without an intake folder cannot upload.
+func (p *Preserver) UploadDestination(ctx context.Context) (string, error) {
+	tenant, err := p.tenant(ctx)
+	if err != nil {
+		return "", err
+	}
+	if tenant == nil {
+		return p.envConfig.Tus.Destination, nil
+	}
+	if tenant.IntakeFolder == "" {
+		return "", fmt.Errorf("%w: tenant %s has no intake folder", ErrTenantAccess, tenant.Name)
+	}
+	return tenant.IntakeFolder, nil
+}
+
+// PushUpload copies a transfer uploaded to the service to its Cells destination, as the user of the client. Returns
+// the resolved Cells path of the transfer.
+func (p *Preserver) PushUpload(ctx context.Context, userClient cells.UserClient, localPath string) (string, error) {
+	destination, err := p.UploadDestination(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.PushTransfer(ctx, userClient, localPath, destination)
+}
+
+// PushTransfer copies a local transfer, a file or a directory, into a Cells folder as the user of the client. Returns
+// the resolved Cells path of the transfer.
+func (p *Preserver) PushTransfer(ctx context.Context, userClient cells.UserClient, localPath, destination string) (string, error) {
+	cellsPath, err := p.cellsClient.UploadNode(ctx, userClient, localPath, destination)
+	if err != nil {
+		return "", fmt.Errorf("error uploading transfer: %w", err)
+	}
+	resolvedPath, err := p.cellsClient.ResolveCellsPath(userClient, cellsPath)
+	if err != nil {
+		return "", fmt.Errorf("error resolving upload path: %w", err)
+	}
+	if _, err := p.getNodeStats(ctx, resolvedPath); err != nil {
+		return "", err
+	}
+	logger.Info("Copied transfer %s to %s", filepath.Base(localPath), cellsPath)
+	return resolvedPath, nil
+}
+
+func (p *Preserver) intakeSource() (*source.Client, error) {
+	intake := p.Intake()
+	if intake == nil {
+		return nil, fmt.Errorf("the upload intake is not configured")
+	}
+	return p.TransferSource(intake.Source)
+}
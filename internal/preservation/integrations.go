@@ -0,0 +1,96 @@
+package preservation
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/penwern/curate-preservation-core/internal/notify"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// integrations are the settings of the integrations read from their config files. They are replaced as a whole when
+// the configuration is reloaded, so each stage reads them once.
+type integrations struct {
+	archivesSpace  *config.ArchivesSpaceConfig  // nil if ArchivesSpace is not configured
+	storageService *config.StorageServiceConfig // nil if the Storage Service is not configured
+	aipStorage     *config.AIPStorageConfig     // nil if AIPs are only stored in Cells
+	repositories   *config.RepositoriesConfig   // nil if access copies are not deposited into repositories
+	sources        *config.SourcesConfig        // nil if transfers are only taken from Cells
+	notifications  *config.NotificationsConfig  // nil if no notification channel is configured
+	notifier       *notify.Dispatcher           // nil if no notification channel is configured
+	// Processing profiles of the last valid profiles file, used while the file is invalid. nil if it never was valid
+	profiles *config.ProfileRegistry
+}
+
+// loadIntegrations reads the config files of the integrations. Integrations whose config fails to load are
+// disabled, and their errors returned.
+func loadIntegrations(cfg *config.Config) (*integrations, []error) {
+	in := &integrations{}
+	var errs []error
+	var err error
+	if in.archivesSpace, err = config.LoadArchivesSpaceConfig(cfg.ArchivesSpace.ConfigPath); err != nil {
+		errs = append(errs, fmt.Errorf("error loading ArchivesSpace config: %w", err))
+	}
+	if in.storageService, err = config.LoadStorageServiceConfig(cfg.StorageService.ConfigPath); err != nil {
+		errs = append(errs, fmt.Errorf("error loading Storage Service config: %w", err))
+	}
+	if in.aipStorage, err = config.LoadAIPStorageConfig(cfg.AIPStorage.ConfigPath); err != nil {
+		errs = append(errs, fmt.Errorf("error loading AIP storage config: %w", err))
+	}
+	if in.repositories, err = config.LoadRepositoriesConfig(cfg.Repositories.ConfigPath); err != nil {
+		errs = append(errs, fmt.Errorf("error loading repositories config: %w", err))
+	}
+	if in.sources, err = config.LoadSourcesConfig(cfg.Sources.ConfigPath); err != nil {
+		errs = append(errs, fmt.Errorf("error loading transfer sources config: %w", err))
+	}
+	if in.notifications, err = config.LoadNotificationsConfig(cfg.Notifications.ConfigPath); err != nil {
+		errs = append(errs, fmt.Errorf("error loading notifications config: %w", err))
+	}
+	return in, errs
+}
+
+// integrations returns the current settings of the integrations.
+func (p *Preserver) integrations() *integrations {
+	return p.current.Load()
+}
+
+// Reload reads the config files of the integrations again: ArchivesSpace, the Storage Service, the AIP storage
+// locations, the access repositories, the transfer sources and the notification channels. The processing profiles,
+// read for each package, are checked too, and kept to be used while their file is invalid. If a config fails to load,
+// the current settings are kept and the errors are returned. Returns the names of the integrations configured after
+// the reload.
+func (p *Preserver) Reload() ([]string, error) {
+	in, errs := loadIntegrations(p.envConfig)
+	var err error
+	if in.profiles, err = config.GetProfiles(p.envConfig); err != nil {
+		errs = append(errs, fmt.Errorf("error loading profiles: %w", err))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	in.notifier = notify.New(in.notifications, p.envConfig.DataDir, p.envConfig.AllowInsecureTLS)
+	old := p.current.Swap(in)
+	// The notifications being sent are delivered with the previous channels
+	go old.notifier.Close()
+	return in.names(), nil
+}
+
+// names returns the names of the configured integrations.
+func (in *integrations) names() []string {
+	var names []string
+	for name, configured := range map[string]bool{
+		"archivesspace":   in.archivesSpace != nil,
+		"storage_service": in.storageService != nil,
+		"aip_storage":     in.aipStorage != nil,
+		"repositories":    in.repositories != nil,
+		"sources":         in.sources != nil,
+		"notifications":   in.notifier != nil,
+	} {
+		if configured {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
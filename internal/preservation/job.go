@@ -0,0 +1,26 @@
+package preservation
+
+import (
+	"context"
+	"time"
+)
+
+type jobKey struct{}
+
+// job is the queued job of a context.
+type job struct {
+	id       string
+	queuedAt time.Time
+}
+
+// WithJob returns a context whose preserved packages are recorded as preserved by a queued job, queued at the given
+// time, so that the job finds their records and artifacts.
+func WithJob(ctx context.Context, id string, queuedAt time.Time) context.Context {
+	return context.WithValue(ctx, jobKey{}, job{id: id, queuedAt: queuedAt})
+}
+
+// jobFromContext returns the queued job of a context. Its ID is "" if it has none.
+func jobFromContext(ctx context.Context) job {
+	j, _ := ctx.Value(jobKey{}).(job)
+	return j
+}
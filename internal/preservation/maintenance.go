@@ -0,0 +1,168 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal/processor"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// maxListedProblems is the number of damaged or missing AIPs listed in the error of a sweep or audit.
+const maxListedProblems = 20
+
+// FixitySweep checks the fixity of every AIP in storage locations, or in every location if none is given.
+// Failures are notified. Returns a summary of the sweep, and an error listing the AIPs that failed.
+func (p *Preserver) FixitySweep(ctx context.Context, locations []string) (string, error) {
+	locations, err := p.sweptLocations(locations)
+	if err != nil {
+		return "", err
+	}
+	var summary, failed []string
+	for _, location := range locations {
+		store, err := p.AIPStore(location)
+		if err != nil {
+			return strings.Join(summary, ", "), err
+		}
+		uuids, err := store.ListAIPs(ctx)
+		if err != nil {
+			store.Close()
+			return strings.Join(summary, ", "), fmt.Errorf("error listing AIPs in %s: %w", location, err)
+		}
+		for _, aipUUID := range uuids {
+			if err := ctx.Err(); err != nil {
+				store.Close()
+				return strings.Join(summary, ", "), err
+			}
+			report, err := p.verifyAIP(ctx, store, aipUUID)
+			switch {
+			case err != nil:
+				logger.Error("Error verifying AIP %s in %s: %v", aipUUID, location, err)
+				failed = append(failed, fmt.Sprintf("%s in %s (%v)", aipUUID, location, err))
+			case !report.Success():
+				failed = append(failed, fmt.Sprintf("%s in %s (%d of %d files)", aipUUID, location, len(report.Failures), report.Files))
+			}
+		}
+		store.Close()
+		summary = append(summary, fmt.Sprintf("%d AIPs verified in %s", len(uuids), location))
+	}
+	if len(failed) > 0 {
+		return strings.Join(summary, ", "), fmt.Errorf("%d AIPs failed the fixity check: %s", len(failed), listProblems(failed))
+	}
+	return strings.Join(summary, ", "), nil
+}
+
+// StorageAudit compares the AIPs in storage locations, or in every location if none is given, with the replicas of
+// the package records. AIPs recorded but missing from a location are notified as fixity failures, AIPs stored without
+// a record are reported in the summary. Returns an error listing the missing AIPs.
+func (p *Preserver) StorageAudit(ctx context.Context, locations []string) (string, error) {
+	if p.catalog == nil {
+		return "", fmt.Errorf("package records are disabled, there is nothing to audit the storage against")
+	}
+	locations, err := p.sweptLocations(locations)
+	if err != nil {
+		return "", err
+	}
+	records, err := p.catalog.List()
+	if err != nil {
+		return "", fmt.Errorf("error listing package records: %w", err)
+	}
+	var summary, missing []string
+	for _, location := range locations {
+		recorded := map[string]bool{}
+		for _, rec := range records {
+			for _, replica := range rec.Replicas {
+				if replica.Location == location && rec.AIPUUID != "" {
+					recorded[rec.AIPUUID] = true
+				}
+			}
+		}
+		store, err := p.AIPStore(location)
+		if err != nil {
+			return strings.Join(summary, ", "), err
+		}
+		uuids, err := store.ListAIPs(ctx)
+		store.Close()
+		if err != nil {
+			return strings.Join(summary, ", "), fmt.Errorf("error listing AIPs in %s: %w", location, err)
+		}
+		unrecorded := 0
+		for _, aipUUID := range uuids {
+			if !recorded[aipUUID] {
+				unrecorded++
+			}
+			delete(recorded, aipUUID)
+		}
+		for aipUUID := range recorded {
+			logger.Error("AIP %s is missing from %s", aipUUID, location)
+			p.notifyFixity(aipUUID, location, "The AIP is missing from "+location)
+			missing = append(missing, fmt.Sprintf("%s in %s", aipUUID, location))
+		}
+		summary = append(summary, fmt.Sprintf("%s: %d AIPs stored, %d missing, %d without a package record", location,
+			len(uuids), len(recorded), unrecorded))
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return strings.Join(summary, ", "), fmt.Errorf("%d recorded AIPs are missing: %s", len(missing), listProblems(missing))
+	}
+	return strings.Join(summary, ", "), nil
+}
+
+// UpdateSignatures runs the signature update commands of the scheduler config, such as freshclam, then asks the
+// ClamAV daemon to reload its signatures if an address is configured.
+func (p *Preserver) UpdateSignatures(ctx context.Context) (string, error) {
+	commands := p.envConfig.Scheduler.SignatureCommands
+	address := p.envConfig.ClamAV.Address
+	if len(commands) == 0 && address == "" {
+		return "", fmt.Errorf("no signature update command or ClamAV address is configured")
+	}
+	var summary []string
+	for _, command := range commands {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			continue
+		}
+		// #nosec G204 -- commands come from the service configuration
+		output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			return strings.Join(summary, ", "), fmt.Errorf("error running %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+		logger.Debug("Signature update %s output:\n%s", args[0], output)
+		summary = append(summary, "ran "+args[0])
+	}
+	if address != "" {
+		if err := processor.ReloadSignatures(ctx, address); err != nil {
+			return strings.Join(summary, ", "), fmt.Errorf("error reloading ClamAV signatures: %w", err)
+		}
+		summary = append(summary, "reloaded ClamAV signatures")
+	}
+	return strings.Join(summary, ", "), nil
+}
+
+// sweptLocations returns the storage locations of a sweep or audit, every location if none is given.
+func (p *Preserver) sweptLocations(locations []string) ([]string, error) {
+	all := p.StorageLocations()
+	if len(all) == 0 {
+		return nil, fmt.Errorf("AIP storage is not configured")
+	}
+	if len(locations) == 0 {
+		return all, nil
+	}
+	for _, location := range locations {
+		if !slices.Contains(all, location) {
+			return nil, fmt.Errorf("storage location not found: %s", location)
+		}
+	}
+	return locations, nil
+}
+
+// listProblems joins the first damaged or missing AIPs of a sweep or audit.
+func listProblems(problems []string) string {
+	if len(problems) <= maxListedProblems {
+		return strings.Join(problems, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(problems[:maxListedProblems], ", "), len(problems)-maxListedProblems)
+}
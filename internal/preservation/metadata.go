@@ -0,0 +1,20 @@
+package preservation
+
+import "context"
+
+type metadataKey struct{}
+
+// WithMetadata returns a context whose preserved packages get Dublin Core and ISAD(G) metadata, keyed as in
+// metadata.json (e.g. dc.title), for the fields their Cells node does not have, e.g. the metadata shared by a batch.
+func WithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	if len(metadata) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+// metadataFromContext returns the metadata of a context, or nil if it has none.
+func metadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
+}
@@ -0,0 +1,163 @@
+package preservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/aipstore"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// MigrationResult is the outcome of the migration of a stored AIP to another layout.
+type MigrationResult struct {
+	*aipstore.Migration
+	Packages []string `json:"packages,omitempty"` // Package records with a replica of the AIP
+	Error    string   `json:"error,omitempty"`
+}
+
+// MigrateLayout moves the AIPs of a storage location to another layout, or every AIP of the location if none is
+// given, and updates the keys of their replicas in the package records. AIPs already in the layout are left in
+// place, so an interrupted migration is resumed by running it again. progress is called before each AIP is migrated.
+// Returns the migration of each AIP, and the errors of the AIPs that could not be migrated.
+func (p *Preserver) MigrateLayout(ctx context.Context, location, layout string, aipUUIDs []string, progress func(aipUUID string, n, total int)) ([]*MigrationResult, error) {
+	store, err := p.AIPStore(location)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if len(aipUUIDs) == 0 {
+		if aipUUIDs, err = store.ListAIPs(ctx); err != nil {
+			return nil, fmt.Errorf("error listing AIPs in %s: %w", store.Name(), err)
+		}
+	}
+	packages, err := p.replicaPackages(store.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*MigrationResult, 0, len(aipUUIDs))
+	var errs []error
+	for i, aipUUID := range aipUUIDs {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		if progress != nil {
+			progress(aipUUID, i+1, len(aipUUIDs))
+		}
+		migration, err := store.MigrateAIP(ctx, aipUUID, layout, func(file string, done, total int) {
+			logger.Debug("Migrating AIP %s: %s (%d of %d files)", aipUUID, file, done+1, total)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			results = append(results, &MigrationResult{
+				Migration: &aipstore.Migration{Location: store.Name(), AIPUUID: aipUUID, To: layout},
+				Error:     err.Error(),
+			})
+			errs = append(errs, fmt.Errorf("AIP %s: %w", aipUUID, err))
+			continue
+		}
+		result := &MigrationResult{Migration: migration}
+		for _, rec := range packages[aipUUID] {
+			if err := p.moveReplica(rec, migration); err != nil {
+				result.Error = err.Error()
+				errs = append(errs, fmt.Errorf("AIP %s: %w", aipUUID, err))
+				continue
+			}
+			result.Packages = append(result.Packages, rec.ID)
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+// PlanMigrateLayout is a dry run of MigrateLayout: it reads the manifests of the AIPs and returns the actions moving
+// them would take.
+func (p *Preserver) PlanMigrateLayout(ctx context.Context, location, layout string, aipUUIDs []string) ([]PlannedAction, error) {
+	store, err := p.AIPStore(location)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if len(aipUUIDs) == 0 {
+		if aipUUIDs, err = store.ListAIPs(ctx); err != nil {
+			return nil, fmt.Errorf("error listing AIPs in %s: %w", store.Name(), err)
+		}
+	}
+	var actions []PlannedAction
+	moved := 0
+	for _, aipUUID := range aipUUIDs {
+		migration, err := store.PlanMigration(ctx, aipUUID, layout)
+		if err != nil {
+			return nil, fmt.Errorf("error planning the migration of AIP %s: %w", aipUUID, err)
+		}
+		if !migration.Moved() {
+			continue
+		}
+		moved++
+		actions = append(actions, PlannedAction{
+			Stage: catalog.EventStorage,
+			Action: fmt.Sprintf("Move AIP %s in %s from the %s to the %s layout: %d files verified and stored below %s",
+				aipUUID, store.Name(), migration.From, layout, migration.Files, migration.Key),
+		})
+	}
+	if moved > 0 {
+		actions = append(actions, PlannedAction{
+			Stage:  catalog.EventStorage,
+			Action: "Remove the moved AIPs from their old layout and update the replicas of their package records",
+		})
+	}
+	if moved < len(aipUUIDs) {
+		actions = append(actions, PlannedAction{
+			Stage:  catalog.EventStorage,
+			Action: fmt.Sprintf("Leave %d AIPs already in the %s layout in place", len(aipUUIDs)-moved, layout),
+		})
+	}
+	return actions, nil
+}
+
+// replicaPackages returns the package records with a replica in a storage location, by AIP UUID.
+func (p *Preserver) replicaPackages(location string) (map[string][]*catalog.Record, error) {
+	packages := map[string][]*catalog.Record{}
+	if p.catalog == nil {
+		return packages, nil
+	}
+	records, err := p.catalog.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing package records: %w", err)
+	}
+	for _, rec := range records {
+		for _, replica := range rec.Replicas {
+			if replica.Location == location && rec.AIPUUID != "" {
+				packages[rec.AIPUUID] = append(packages[rec.AIPUUID], rec)
+				break
+			}
+		}
+	}
+	return packages, nil
+}
+
+// moveReplica records the key of a migrated AIP in the replica of a package, with a storage event in its timeline.
+// Records already holding the key are left as they are.
+func (p *Preserver) moveReplica(rec *catalog.Record, migration *aipstore.Migration) error {
+	for _, replica := range rec.Replicas {
+		if replica.Location == migration.Location && replica.Key == migration.Key {
+			return nil
+		}
+	}
+	event := catalog.Event{
+		Time:    time.Now().UTC(),
+		Type:    catalog.EventStorage,
+		Outcome: catalog.OutcomeSuccess,
+		Detail: fmt.Sprintf("AIP moved to the %s layout of %s: %s (%d files)", migration.To, migration.Location,
+			migration.Key, migration.Files),
+	}
+	if _, err := p.catalog.MoveReplica(rec.ID, migration.Location, migration.Key, event); err != nil {
+		return fmt.Errorf("error updating the replica of package %s: %w", rec.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package preservation
+
+import (
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/notify"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// Notifier returns the dispatcher of the notification channels. Returns nil if no channel is configured.
+func (p *Preserver) Notifier() *notify.Dispatcher {
+	return p.integrations().notifier
+}
+
+// notifyOutcome notifies the channels of the final outcome of a preservation.
+func (p *Preserver) notifyOutcome(recorder *catalog.Recorder, userClient cells.UserClient, cellsPackagePath string, runErr error) {
+	if runErr != nil {
+		p.notifyPackage(recorder, userClient, cellsPackagePath, config.NotifyEventFailed, notify.SeverityError, runErr.Error())
+		return
+	}
+	p.notifyPackage(recorder, userClient, cellsPackagePath, config.NotifyEventCompleted, notify.SeverityInfo, "")
+}
+
+// notifyStateChange notifies the channels of a lifecycle transition of a package.
+func (p *Preserver) notifyStateChange(rec *catalog.Record, from catalog.State) {
+	event := notify.Event{
+		Type:          config.NotifyEventStateChanged,
+		Severity:      notify.SeverityInfo,
+		PackageID:     rec.ID,
+		CellsPath:     rec.CellsPath,
+		Username:      rec.Username,
+		Profile:       rec.Profile,
+		AIPUUID:       rec.AIPUUID,
+		State:         string(rec.State),
+		PreviousState: string(from),
+		DurationMs:    time.Since(rec.CreatedAt).Milliseconds(),
+	}
+	if n := len(rec.StateHistory); n > 0 {
+		event.Time = rec.StateHistory[n-1].Time
+	}
+	switch rec.State {
+	case catalog.StateFailed:
+		event.Severity = notify.SeverityError
+		event.Error = rec.Error
+	case catalog.StateCancelled:
+		event.Severity = notify.SeverityWarning
+	}
+	p.integrations().notifier.Notify(event)
+}
+
+// notifyPackage notifies the channels of an event of a package. The package details are taken from its record.
+// Failures carry the error, other events the detail.
+func (p *Preserver) notifyPackage(recorder *catalog.Recorder, userClient cells.UserClient, cellsPackagePath, eventType, severity, detail string) {
+	notifier := p.integrations().notifier
+	if notifier == nil {
+		return
+	}
+	event := notify.Event{Type: eventType, Severity: severity, CellsPath: cellsPackagePath}
+	if eventType == config.NotifyEventFailed {
+		event.Error = detail
+	} else {
+		event.Detail = detail
+	}
+	if userClient.UserData != nil {
+		event.Username = userClient.UserData.Login
+	}
+	if rec := recorder.Record(); rec != nil {
+		event.PackageID = rec.ID
+		event.Profile = rec.Profile
+		event.AIPUUID = rec.AIPUUID
+		event.DurationMs = time.Since(rec.CreatedAt).Milliseconds()
+	}
+	notifier.Notify(event)
+}
@@ -0,0 +1,121 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// globMeta are the characters of the patterns of path.Match.
+const globMeta = `*?[\`
+
+// HasPattern reports whether any Cells path has glob pattern characters, and may need ExpandPaths.
+func HasPattern(paths []string) bool {
+	return slices.ContainsFunc(paths, func(cellsPath string) bool {
+		return strings.ContainsAny(cellsPath, globMeta)
+	})
+}
+
+// ExpandPaths expands the Cells paths of a submission that are glob patterns, such as personal-files/box-*, to the
+// paths of the folders and files they match, in order. Patterns are matched per segment of the path with the syntax
+// of path.Match, the workspace cannot be a pattern, and hidden nodes are only matched by patterns starting with a dot.
+// Paths without pattern characters, and existing nodes with pattern characters in their name, are kept as they are.
+// Returns a validation error if a pattern is invalid or matches no node.
+func (p *Preserver) ExpandPaths(ctx context.Context, userClient cells.UserClient, paths []string) ([]string, error) {
+	expanded := make([]string, 0, len(paths))
+	for _, cellsPath := range paths {
+		matches := []string{cellsPath}
+		if strings.ContainsAny(cellsPath, globMeta) && !p.cellsPathExists(ctx, userClient, cellsPath) {
+			var err error
+			if matches, err = p.globCellsPath(ctx, userClient, cellsPath); err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, utils.Classify(utils.ErrValidation, fmt.Errorf("no package matches %s", cellsPath))
+			}
+			logger.Debug("Expanded %s to %d packages", cellsPath, len(matches))
+		}
+		for _, match := range matches {
+			if !slices.Contains(expanded, match) {
+				expanded = append(expanded, match)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// globCellsPath returns the Cells paths matching a pattern, sorted. The folders matching each segment of the pattern
+// are listed in turn.
+func (p *Preserver) globCellsPath(ctx context.Context, userClient cells.UserClient, pattern string) ([]string, error) {
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+	if strings.ContainsAny(segments[0], globMeta) {
+		return nil, utils.Classify(utils.ErrValidation, fmt.Errorf("the workspace of %s cannot be a pattern", pattern))
+	}
+	matches := []string{segments[0]}
+	for _, segment := range segments[1:] {
+		if !strings.ContainsAny(segment, globMeta) {
+			for i := range matches {
+				matches[i] += "/" + segment
+			}
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, utils.Classify(utils.ErrValidation, fmt.Errorf("invalid pattern %s: %w", pattern, err))
+		}
+		var next []string
+		for _, dir := range matches {
+			names, err := p.listCellsFolder(ctx, userClient, dir)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				if strings.HasPrefix(name, ".") && !strings.HasPrefix(segment, ".") {
+					continue
+				}
+				if ok, _ := path.Match(segment, name); ok {
+					next = append(next, dir+"/"+name)
+				}
+			}
+		}
+		matches = next
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
+
+// listCellsFolder returns the names of the nodes in a Cells folder.
+func (p *Preserver) listCellsFolder(ctx context.Context, userClient cells.UserClient, cellsPath string) ([]string, error) {
+	resolvedPath, err := p.cellsClient.ResolveCellsPath(userClient, cellsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving cells path %s: %w", cellsPath, err)
+	}
+	collection, err := p.cellsClient.GetNodeCollection(ctx, resolvedPath)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", cellsPath, err)
+	}
+	// The collection lists the nodes of the folder recursively
+	var names []string
+	for _, node := range collection.Children {
+		name := strings.Trim(strings.TrimPrefix(node.Path, collection.Parent.Path), "/")
+		if name != "" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// cellsPathExists reports whether a Cells path is an existing node.
+func (p *Preserver) cellsPathExists(ctx context.Context, userClient cells.UserClient, cellsPath string) bool {
+	resolvedPath, err := p.cellsClient.ResolveCellsPath(userClient, cellsPath)
+	if err != nil {
+		return false
+	}
+	stats, err := p.cellsClient.GetNodeStats(ctx, resolvedPath)
+	return err == nil && stats != nil && stats.Node != nil
+}
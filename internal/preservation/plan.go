@@ -0,0 +1,269 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/processor"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/manifest"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/pydio/cells-sdk-go/v4/models"
+)
+
+// PlannedAction is a step a preservation would take, under the lifecycle stage it belongs to.
+type PlannedAction struct {
+	Stage  string `json:"stage"` // Event type of the stage, e.g. packaging
+	Action string `json:"action"`
+}
+
+// Plan is the outcome of a dry run: what the preservation of a package would do, from its resolved processing
+// profile and the contents of the package.
+type Plan struct {
+	CellsPath    string                     `json:"cells_path"`
+	Tenant       string                     `json:"tenant,omitempty"`
+	Profile      string                     `json:"profile,omitempty"` // Empty for the default or an explicit configuration
+	Config       *config.PreservationConfig `json:"config"`
+	AtomSlug     string                     `json:"atom_slug,omitempty"`
+	Files        int                        `json:"files"`
+	Bytes        int64                      `json:"bytes"`
+	Formats      []processor.Format         `json:"formats,omitempty"`
+	Deselections []processor.Deselection    `json:"deselections,omitempty"`
+	DuplicateOf  *catalog.Duplicate         `json:"duplicate_of,omitempty"`
+	Actions      []PlannedAction            `json:"actions"`
+	Warnings     []string                   `json:"warnings,omitempty"` // Conditions that would refuse or degrade the preservation
+}
+
+// add adds an action to the plan.
+func (pl *Plan) add(stage, action string) {
+	pl.Actions = append(pl.Actions, PlannedAction{Stage: stage, Action: action})
+}
+
+// Plan is a dry run of Run: it resolves the processing profile of a package, downloads it to identify its formats and
+// the files deselected during appraisal, and returns the actions its preservation would take. Nothing is modified:
+// the package tags, records and storage are left untouched, and the download is removed.
+// Errors that would refuse the package, such as tenant access, are returned. Quotas and duplicates are reported as
+// warnings, as they depend on the time the package is preserved.
+func (p *Preserver) Plan(ctx context.Context, pcfg *config.PreservationConfig, atomConfig *config.AtomConfig, userClient cells.UserClient, cellsPackagePath, profileName string, deselect []string, pathResolved bool) (*Plan, error) {
+	var err error
+	if pathResolved {
+		cellsPackagePath, err = p.cellsClient.UnresolveCellsPath(userClient, cellsPackagePath)
+		if err != nil {
+			return nil, fmt.Errorf("error unresolving cells path: %w", err)
+		}
+	}
+	tenant, err := p.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil && !tenant.Contains(cellsPackagePath) {
+		return nil, fmt.Errorf("%w: package %s is outside the paths of tenant %s", ErrTenantAccess, cellsPackagePath, tenant.Name)
+	}
+	plan := &Plan{CellsPath: cellsPackagePath, Tenant: TenantFromContext(ctx)}
+	if err := p.CheckQuota(plan.Tenant, cellsPackagePath, ""); err != nil {
+		plan.Warnings = append(plan.Warnings, err.Error())
+	}
+
+	nodeCollection, _, err := p.gatherNodeEnvironment(ctx, userClient, cellsPackagePath)
+	if err != nil {
+		return nil, fmt.Errorf("error gathering node environment: %w", err)
+	}
+	if err := p.CheckPackageSize(ctx, cellsPackagePath, nodeSize(nodeCollection.Parent)); err != nil {
+		plan.Warnings = append(plan.Warnings, err.Error())
+	}
+	pcfg, atomConfig, err = p.resolveProfile(tenant, profileName, cellsPackagePath, pcfg, atomConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving processing profile: %w", err)
+	}
+	plan.Profile = pcfg.Profile
+	plan.Config = pcfg
+	if atomSlug := strings.Trim(nodeCollection.Parent.MetaStore[atomSlugTagNamespace], `"\ `); atomSlug != "" {
+		atomConfig.Slug = atomSlug
+	}
+	plan.AtomSlug = atomConfig.Slug
+
+	// The package is downloaded to a directory of its own, removed once it is identified
+	processingDir, err := utils.MakeUniqueDir(ctx, p.envConfig.ProcessingBaseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create processing directory: %w", err)
+	}
+	defer func() {
+		if removeErr := os.RemoveAll(processingDir); removeErr != nil {
+			logger.Error("Error deleting processing directory: %v", removeErr)
+		}
+	}()
+	downloadedPath, err := p.downloadPackage(ctx, userClient, processingDir, cellsPackagePath)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading package: %w", err)
+	}
+	if err := p.inspectPackage(ctx, plan, processingDir, downloadedPath, nodeCollection, deselect); err != nil {
+		return nil, err
+	}
+	p.planActions(plan, pcfg, atomConfig, nodeCollection.Parent.MetaStore[archivesSpaceURITagNamespace])
+	return plan, nil
+}
+
+// inspectPackage identifies the formats of a downloaded package, the files deselected during appraisal and the
+// preserved packages with the same content, as preprocessing would see them.
+func (p *Preserver) inspectPackage(ctx context.Context, plan *Plan, processingDir, downloadedPath string, nodeCollection *models.RestNodesCollection, deselect []string) error {
+	info, err := os.Stat(downloadedPath)
+	if err != nil {
+		return fmt.Errorf("error checking path: %w", err)
+	}
+	// Zip packages are extracted by preprocessing, a single file is the package root
+	dataDir, packageRoot := filepath.Dir(downloadedPath), downloadedPath
+	switch {
+	case info.Mode().IsRegular() && utils.IsZipFile(downloadedPath) && utils.IsActualArchive(downloadedPath):
+		dataDir = filepath.Join(processingDir, "extracted")
+		packageRoot = filepath.Join(dataDir, filepath.Base(strings.TrimSuffix(downloadedPath, filepath.Ext(downloadedPath))))
+		if _, err := utils.ExtractZip(ctx, downloadedPath, packageRoot); err != nil {
+			return fmt.Errorf("error extracting zip: %w", err)
+		}
+	case info.Mode().IsRegular():
+		packageRoot = dataDir
+	}
+
+	if plan.Formats, err = processor.IdentifyFormats(ctx, packageRoot); err != nil {
+		return fmt.Errorf("error identifying formats: %w", err)
+	}
+	for _, format := range plan.Formats {
+		plan.Files += format.Files
+		plan.Bytes += format.Bytes
+	}
+	if plan.Deselections, err = processor.PlanDeselection(dataDir, packageRoot, nodeCollection, deselect); err != nil {
+		return err
+	}
+	for _, deselection := range plan.Deselections {
+		plan.Files--
+		plan.Bytes -= deselection.Size
+	}
+
+	if plan.Config.DuplicateCheck == config.DuplicateCheckOff || p.Catalog() == nil {
+		return nil
+	}
+	inputManifest, err := manifest.FromPath(ctx, downloadedPath, "data", manifest.DefaultAlgorithm)
+	if err != nil {
+		return fmt.Errorf("error recording input manifest: %w", err)
+	}
+	if existing := p.findDuplicate(p.Catalog(), plan.Tenant, inputManifest.Fingerprint("data"), ""); existing != nil {
+		plan.DuplicateOf = &catalog.Duplicate{PackageID: existing.ID, AIPUUID: existing.AIPUUID, CellsPath: existing.CellsPath}
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("Content already preserved as AIP %s (package %s from %s)", existing.AIPUUID, existing.ID, existing.CellsPath))
+	}
+	return nil
+}
+
+// planActions lists the actions of the preservation of a package, in the order Run takes them.
+func (p *Preserver) planActions(plan *Plan, pcfg *config.PreservationConfig, atomConfig *config.AtomConfig, archivalObjectURI string) {
+	plan.add(catalog.EventDownload, "Download package from Cells: "+plan.CellsPath)
+	if pcfg.DuplicateCheck == config.DuplicateCheckSkip && plan.DuplicateOf != nil {
+		plan.add(catalog.EventAppraisal, "Skip the package, its content is already preserved as AIP "+plan.DuplicateOf.AIPUUID)
+		return
+	}
+	plan.add(catalog.EventPreprocessing, "Construct transfer package")
+	if len(plan.Deselections) > 0 {
+		plan.add(catalog.EventAppraisal, fmt.Sprintf("Deselect %d files", len(plan.Deselections)))
+	}
+	if pcfg.AVScan {
+		plan.add(catalog.EventVirusScan, "ClamAV scan")
+	}
+	if len(pcfg.ChecksumAlgorithms) > 0 {
+		plan.add(catalog.EventFixity, "Write transfer checksums: "+strings.Join(pcfg.ChecksumAlgorithms, ", "))
+	}
+	if pcfg.PIIScan != nil {
+		plan.add(catalog.EventPIIScan, "Scan for sensitive data, the DIP is held back for review if any is found")
+	}
+
+	a3m := pcfg.A3mConfig
+	if a3m != nil {
+		if a3m.ExtractPackages {
+			plan.add(catalog.EventExtraction, "Extract packages within the transfer")
+		}
+		if a3m.IdentifyTransfer || a3m.IdentifyBeforeNormalization {
+			plan.add(catalog.EventIdentification, "Identify file formats")
+		}
+		if a3m.Normalize {
+			plan.add(catalog.EventNormalization, "Normalize files for preservation and access")
+		}
+		if a3m.TranscribeFiles {
+			plan.add(catalog.EventProcessing, "Transcribe files")
+		}
+		if a3m.PerformPolicyChecksOnOriginals || a3m.PerformPolicyChecksOnPreservationDerivatives || a3m.PerformPolicyChecksOnAccessDerivatives {
+			plan.add(catalog.EventCharacterization, "Perform policy checks")
+		}
+		plan.add(catalog.EventPackaging, "Package AIP with A3M: "+a3m.AipCompressionAlgorithm.String())
+	}
+	plan.add(catalog.EventExtraction, "Extract AIP")
+	if pcfg.ManifestCheck != config.ManifestCheckOff {
+		plan.add(catalog.EventFixity, "Compare input and AIP manifests ("+manifestCheckMode(pcfg.ManifestCheck)+")")
+	}
+	if pcfg.Export != nil {
+		plan.add(catalog.EventPackaging, "Export AIP: "+pcfg.Export.Format)
+	}
+	if pcfg.CompressAip {
+		plan.add(catalog.EventPackaging, "Compress AIP")
+	}
+
+	if atomConfig.Slug != "" && !pcfg.DIPEnabled() {
+		plan.Warnings = append(plan.Warnings, "DIP generation disabled by processing profile, AtoM slug ignored: "+atomConfig.Slug)
+	}
+	if atomConfig.Slug != "" && pcfg.DIPEnabled() {
+		if err := atomConfig.Validate(); err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Invalid AtoM config: %v", err))
+		}
+		if atomConfig.DescriptionMode == config.DescriptionModeCreate || atomConfig.DescriptionMode == config.DescriptionModeUpdate {
+			plan.add(catalog.EventDissemination, fmt.Sprintf("Describe package in AtoM (%s): %s", atomConfig.DescriptionMode, atomConfig.Slug))
+		}
+		if pcfg.Thumbnails != nil {
+			plan.add(catalog.EventDissemination, "Generate DIP thumbnails")
+		}
+		if pcfg.AccessCopies != nil {
+			plan.add(catalog.EventDissemination, "Upload and share access copies in Cells")
+		}
+		plan.add(catalog.EventDissemination, "Migrate DIP to AtoM")
+		plan.add(catalog.EventDissemination, "Deposit DIP to AtoM: "+atomConfig.Slug)
+	}
+
+	in := p.integrations()
+	plan.add(catalog.EventStorage, "Upload AIP to Cells: "+p.envConfig.Cells.ArchiveWorkspace)
+	if in.aipStorage != nil {
+		for _, location := range in.aipStorage.Locations {
+			action := "Replicate AIP to " + location.Name
+			if pcfg.StorageTier != "" {
+				action += " (" + pcfg.StorageTier + ")"
+			}
+			plan.add(catalog.EventStorage, action)
+		}
+	}
+	if archivalObjectURI = strings.Trim(archivalObjectURI, `"\ `); archivalObjectURI != "" {
+		if in.archivesSpace == nil {
+			plan.Warnings = append(plan.Warnings, "Package linked to ArchivesSpace archival object "+archivalObjectURI+", but ArchivesSpace is not configured")
+		} else {
+			plan.add(catalog.EventStorage, "Register AIP in ArchivesSpace: "+archivalObjectURI)
+		}
+	}
+	if in.storageService != nil && in.storageService.Register {
+		plan.add(catalog.EventStorage, "Register AIP in the Storage Service")
+	}
+	if pcfg.DIPEnabled() && in.repositories != nil {
+		for _, repo := range in.repositories.Repositories {
+			if repo.Accepts(pcfg.Profile) {
+				plan.add(catalog.EventDissemination, "Deposit access copies into "+repo.Name)
+			}
+		}
+	}
+	plan.add(catalog.EventPreservation, "Write the preservation status to the package node")
+}
+
+// manifestCheckMode returns the manifest check mode of a profile, warn if unset.
+func manifestCheckMode(mode string) string {
+	if mode == "" {
+		return config.ManifestCheckWarn
+	}
+	return mode
+}
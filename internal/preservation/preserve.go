@@ -5,19 +5,29 @@ package preservation
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	transferservice "github.com/penwern/curate-preservation-core/common/proto/a3m/gen/go/a3m/api/transferservice/v1beta1"
 	"github.com/penwern/curate-preservation-core/internal/a3mclient"
 	"github.com/penwern/curate-preservation-core/internal/atom"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
 	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/export"
+	"github.com/penwern/curate-preservation-core/internal/limits"
+	"github.com/penwern/curate-preservation-core/internal/notify"
 	"github.com/penwern/curate-preservation-core/internal/processor"
 	"github.com/penwern/curate-preservation-core/pkg/config"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/manifest"
+	"github.com/penwern/curate-preservation-core/pkg/reporting"
 	"github.com/penwern/curate-preservation-core/pkg/utils"
 	"github.com/pydio/cells-sdk-go/v4/models"
 )
@@ -37,14 +47,27 @@ var (
 	preservationTagCompleted     = "🔒 Preserved"
 	preservationTagFailed        = "❌ Failed"
 	preservationTagDipFailed     = "❌ DIP Failed"
+	preservationTagCancelled     = "⛔ Cancelled"
+	preservationTagInterrupted   = "⏸️ Interrupted"
 	dipTagWaiting                = "⏳ Waiting..."
 	dipTagStarting               = preservationTagStarting
 	dipTagMigrating              = "📨 Migrating..."
 	dipTagDepositing             = "🌐 Depositing..."
+	dipTagImporting              = "🗂️ Importing..."
 	dipTagCompleted              = "🖼️ Deposited"
 	dipTagFailed                 = preservationTagFailed
+	dipTagReviewRequired         = "⚠️ Review required"
 )
 
+// ErrCancelled is the cause of the context of a preservation cancelled by a user. The preservation stops at the
+// next cancellation point, removes its partial outputs and records the package as cancelled.
+var ErrCancelled = errors.New("preservation cancelled")
+
+// ErrInterrupted is the cause of the context of a preservation interrupted by a shutdown. The preservation stops at
+// the next cancellation point, removes its partial outputs and records the package as interrupted, so that it can
+// be preserved again.
+var ErrInterrupted = errors.New("preservation interrupted by a shutdown")
+
 // TagUpdaters holds functions to update various tag namespaces
 type TagUpdaters struct {
 	Preservation func(context.Context, string) error
@@ -56,7 +79,13 @@ type TagUpdaters struct {
 type Preserver struct {
 	a3mClient   a3mclient.ClientInterface
 	cellsClient cells.ClientInterface
+	catalog     *catalog.Store
 	envConfig   *config.Config
+
+	tenants *config.TenantsConfig        // nil if the service has a single tenant
+	quotas  *config.QuotasConfig         // nil if nothing is limited
+	current atomic.Pointer[integrations] // Replaced when the configuration is reloaded
+	limits  *limits.Limits               // Concurrency limits of the preservations and their stages
 }
 
 // NewPreserver creates a new preservation service.
@@ -76,11 +105,57 @@ func NewPreserverWithA3MClient(ctx context.Context, cfg *config.Config, a3mClien
 	if err != nil {
 		logger.Fatal("cells client error: %v", err)
 	}
-	return &Preserver{
+	// Package records are not required for preservation, run without them if the data dir is unavailable
+	store, err := catalog.NewStore(cfg.DataDir)
+	if err != nil {
+		logger.Warn("Package records disabled: %v", err)
+	}
+	in, errs := loadIntegrations(cfg)
+	for _, err := range errs {
+		logger.Warn("Integration disabled: %v", err)
+	}
+	in.notifier = notify.New(in.notifications, cfg.DataDir, cfg.AllowInsecureTLS)
+	// An invalid profiles file fails the packages until it is fixed
+	in.profiles, _ = config.GetProfiles(cfg)
+	// Without tenants, the requests of tenant users are refused
+	tenants, err := config.LoadTenantsConfig(cfg.Tenants.ConfigPath)
+	if err != nil {
+		logger.Warn("Tenants disabled: %v", err)
+	}
+	quotas, err := config.LoadQuotasConfig(cfg.Quotas.ConfigPath)
+	if err != nil {
+		logger.Warn("Quotas disabled: %v", err)
+	}
+	p := &Preserver{
 		a3mClient:   a3mClient,
 		cellsClient: cellsClient,
+		catalog:     store,
 		envConfig:   cfg,
+		tenants:     tenants,
+		quotas:      quotas,
+		limits:      limits.New(cfg),
+	}
+	p.current.Store(in)
+	if store != nil {
+		// Notifications may be configured by a reload
+		store.OnStateChange(p.notifyStateChange)
 	}
+	return p
+}
+
+// Catalog returns the store of package records. Returns nil if package records are disabled.
+func (p *Preserver) Catalog() *catalog.Store {
+	return p.catalog
+}
+
+// Limits returns the concurrency limits of the preservations and their stages.
+func (p *Preserver) Limits() *limits.Limits {
+	return p.limits
+}
+
+// SubscribeNodeEvents calls handler for every node event in Cells until the context is cancelled or the connection is lost.
+func (p *Preserver) SubscribeNodeEvents(ctx context.Context, handler func(cells.NodeEvent)) error {
+	return p.cellsClient.Subscribe(ctx, handler)
 }
 
 // Close closes the preservation service clients.
@@ -88,27 +163,73 @@ func (p *Preserver) Close() {
 	logger.Debug("Closing Clients")
 	p.cellsClient.Close()
 	p.a3mClient.Close()
+	p.integrations().notifier.Close()
 }
 
 // Run runs the preservation process.
 // Ignoring gocyclo error for now, this function is complex and I cba to break it down yet TODO: refactor
 //
 //nolint:gocyclo
-func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, atomConfig *config.AtomConfig, userClient cells.UserClient, cellsPackagePath string, cleanUp, pathResolved bool) error {
-	// Add panic recovery to prevent crashes
-	defer func() {
-		if r := recover(); r != nil {
-			logger.Error("Panic recovered in preservation Run method for path '%s': %v", cellsPackagePath, r)
-		}
-	}()
-
+func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, atomConfig *config.AtomConfig, userClient cells.UserClient, cellsPackagePath, profileName string, deselect []string, cleanUp, pathResolved bool) (runErr error) {
 	var (
 		err            error
 		nodeCollection *models.RestNodesCollection
 		tagUpdaters    *TagUpdaters
 		producingDip   bool // If the atom slug is set, we will produce a DIP
+		reviewRequired bool // If sensitive data was found, the DIP is held back for review
 	)
 
+	// Record the package timeline and final outcome
+	recorder := p.newRecorder(ctx, userClient, cellsPackagePath)
+	if len(deselect) > 0 {
+		// Kept so that the job can be retried as it was submitted
+		recorder.Update(func(rec *catalog.Record) { rec.Deselect = deselect })
+	}
+	// A resumed package takes over the outputs of the failed package, they are kept with it if it fails again
+	resumedFrom, checkpoint := resumeFromContext(ctx)
+	if checkpoint != nil {
+		recorder.Update(func(rec *catalog.Record) {
+			rec.ResumedFrom = resumedFrom.ID
+			rec.Checkpoint = checkpoint
+			rec.Fingerprint = resumedFrom.Fingerprint
+			rec.ReviewRequired = resumedFrom.ReviewRequired
+			rec.ReviewReason = resumedFrom.ReviewReason
+		})
+		// The reports of the stages that are not run again
+		if store := p.Catalog(); store != nil && recorder != nil {
+			if copyErr := store.CopyArtifacts(resumedFrom.ID, recorder.ID()); copyErr != nil {
+				logger.Error("Error copying the reports of package %s: %v", resumedFrom.ID, copyErr)
+			}
+		}
+	}
+	defer func() {
+		if runErr != nil && cancelled(ctx) {
+			runErr = ErrCancelled
+			recorder.Cancel()
+			p.notifyPackage(recorder, userClient, cellsPackagePath, config.NotifyEventCancelled, notify.SeverityWarning, "")
+			logger.Info("Preservation cancelled: %s", cellsPackagePath)
+			return
+		}
+		if runErr != nil && interrupted(ctx) {
+			runErr = ErrInterrupted
+			recorder.Interrupt()
+			logger.Warn("Preservation interrupted by a shutdown: %s", cellsPackagePath)
+			return
+		}
+		recorder.Finish(runErr)
+		p.notifyOutcome(recorder, userClient, cellsPackagePath, runErr)
+		p.reportFailure(recorder, userClient, cellsPackagePath, profileName, runErr)
+	}()
+	// Add panic recovery to prevent crashes. Deferred after the outcome, so that it runs first and the outcome of a
+	// panic is a failure.
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic recovered in preservation Run method for path '%s': %v", cellsPackagePath, r)
+			reporting.CapturePanic(r, reporting.Context{CellsPath: cellsPackagePath, Profile: profileName, Stage: catalog.EventPreservation})
+			runErr = fmt.Errorf("panic in preservation of %s: %v", cellsPackagePath, r)
+		}
+	}()
+
 	///////////////////////////////////////////////////////////////////
 	//						Pre-requisites							 //
 	///////////////////////////////////////////////////////////////////
@@ -123,6 +244,21 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 		logger.Info("Unresolved Cells Path: %s", cellsPackagePath)
 	}
 
+	// Tenants only preserve the packages under their paths
+	tenant, err := p.tenant(ctx)
+	if err != nil {
+		return utils.Permanent(err)
+	}
+	if tenant != nil && !tenant.Contains(cellsPackagePath) {
+		return utils.Permanent(fmt.Errorf("%w: package %s is outside the paths of tenant %s", ErrTenantAccess, cellsPackagePath, tenant.Name))
+	}
+
+	// Packages over a quota of their tenant or workspace are refused
+	if err := p.CheckQuota(TenantFromContext(ctx), cellsPackagePath, recorder.ID()); err != nil {
+		recorder.Update(func(rec *catalog.Record) { rec.OverQuota = true })
+		return utils.Permanent(err)
+	}
+
 	// Gather the node environment
 	nodeCollection, tagUpdaters, err = p.gatherNodeEnvironment(ctx, userClient, cellsPackagePath)
 	if err != nil {
@@ -132,6 +268,23 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 	// Ensure the preservation tags are updated on failure
 	processingDip := false
 	defer func() {
+		if err != nil && stopped(ctx) {
+			// The context is cancelled, the tags are updated without it
+			tagCtx := context.WithoutCancel(ctx)
+			tag := preservationTagCancelled
+			if interrupted(ctx) {
+				tag = preservationTagInterrupted
+			}
+			if updateErr := tagUpdaters.Preservation(tagCtx, tag); updateErr != nil {
+				logger.Error("error updating Preservation tag on cancellation: %v", updateErr)
+			}
+			if processingDip {
+				if updateErr := tagUpdaters.Dip(tagCtx, tag); updateErr != nil {
+					logger.Error("error updating AtoM tag on cancellation: %v", updateErr)
+				}
+			}
+			return
+		}
 		if err != nil {
 			if !processingDip {
 				// Update the preservation tag on failure
@@ -152,6 +305,25 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 		}
 	}()
 
+	// Packages larger than the quota of their tenant or workspace are refused
+	if err = p.CheckPackageSize(ctx, cellsPackagePath, nodeSize(nodeCollection.Parent)); err != nil {
+		recorder.Update(func(rec *catalog.Record) { rec.OverQuota = true })
+		return utils.Permanent(err)
+	}
+
+	// Resolve the processing profile for the package
+	pcfg, atomConfig, err = p.resolveProfile(tenant, profileName, cellsPackagePath, pcfg, atomConfig)
+	if err != nil {
+		return utils.Permanent(utils.Classify(utils.ErrValidation, fmt.Errorf("error resolving processing profile: %w", err)))
+	}
+	metadata := processor.NodeMetadata(nodeCollection.Parent)
+	recorder.Update(func(rec *catalog.Record) {
+		rec.Profile = pcfg.Profile
+		rec.Title = packageTitle(nodeCollection.Parent, metadata)
+		rec.Metadata = metadata
+	})
+	p.notifyPackage(recorder, userClient, cellsPackagePath, config.NotifyEventStarted, notify.SeverityInfo, "")
+
 	// CLI Atom Slug overrides the atom slug from the node collection
 	atomSlug := nodeCollection.Parent.MetaStore[atomSlugTagNamespace]
 	trimmedAtomSlug := strings.Trim(atomSlug, `"\ `) // Trim quotes and spaces
@@ -170,7 +342,10 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 	}
 
 	// If the atom slug is set, update the DIP tag to "Waiting..."
-	if atomConfig.Slug != "" {
+	if atomConfig.Slug != "" && !pcfg.DIPEnabled() {
+		logger.Info("DIP generation disabled by processing profile. Ignoring AtoM slug: %s", atomConfig.Slug)
+	}
+	if atomConfig.Slug != "" && pcfg.DIPEnabled() {
 		if err = tagUpdaters.Dip(ctx, dipTagWaiting); err != nil {
 			return fmt.Errorf("error updating AtoM tag: %w", err)
 		}
@@ -178,7 +353,7 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 		producingDip = true
 		processingDip = true // Set to true to error on DIP status tag
 		if err = atomConfig.Validate(); err != nil {
-			return fmt.Errorf("error validating atom config: %w", err)
+			return utils.Permanent(utils.Classify(utils.ErrValidation, fmt.Errorf("error validating atom config: %w", err)))
 		}
 		processingDip = false
 	} else {
@@ -188,16 +363,23 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 		}
 	}
 
-	// Create unique processing directory
+	// Create unique processing directory, resumed packages continue in the directory of the failed package
 	var processingDir string
-	processingDir, err = utils.MakeUniqueDir(ctx, p.envConfig.ProcessingBaseDir)
-	if err != nil {
-		return fmt.Errorf("failed to create processing directory: %w", err)
+	if checkpoint != nil {
+		processingDir = checkpoint.ProcessingDir
+		logger.Info("Resuming package %s from its %s checkpoint in: %s", resumedFrom.ID, checkpoint.Stage, processingDir)
+	} else {
+		processingDir, err = utils.MakeUniqueDir(ctx, p.envConfig.ProcessingBaseDir)
+		if err != nil {
+			return fmt.Errorf("failed to create processing directory: %w", err)
+		}
+		logger.Info("Created processing dir: %s", processingDir)
 	}
-	logger.Info("Created processing dir: %s", processingDir)
-	// Clean up the processing directory
+	// Clean up the processing directory, partial outputs of cancelled or interrupted preservations are always removed.
+	// The outputs of failed preservations that reached a checkpoint are kept to resume them
 	defer func() {
-		if cleanUp && processingDir != "" {
+		if (cleanUp || stopped(ctx)) && processingDir != "" && !p.keepFailed(ctx, recorder, runErr) {
+			recorder.Update(func(rec *catalog.Record) { rec.Checkpoint = nil })
 			logger.Info("Cleaning up.")
 			if removeErr := os.RemoveAll(processingDir); removeErr != nil {
 				logger.Error("Error deleting processing directory: %v", removeErr)
@@ -210,66 +392,178 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 	//					 Download Cells Package						 //
 	///////////////////////////////////////////////////////////////////
 
-	// Tag Package: Downloading
-	if err = tagUpdaters.Preservation(ctx, preservationTagDownloading); err != nil {
-		return fmt.Errorf("error updating Preservation tag: %w", err)
+	// Reports are kept with the package record so they survive clean up
+	reportDir := processingDir
+	if recorder != nil {
+		reportDir = recorder.Dir()
 	}
-	logger.Info("Downloading package: %s", cellsPackagePath)
-	var downloadedPath string
-	downloadedPath, err = p.downloadPackage(ctx, userClient, processingDir, cellsPackagePath)
-	if err != nil {
-		return fmt.Errorf("error downloading package: %v", err)
+
+	var (
+		finishEvent    func(err error)
+		downloadedPath string
+		inputManifest  *manifest.Manifest
+	)
+	if checkpoint != nil {
+		// The package was downloaded and appraised before it failed, its AIP is compared to the manifest of its transfer
+		if checkpoint.InputManifest != "" {
+			inputManifest, err = manifest.Read(checkpoint.InputManifest)
+			if err != nil {
+				return fmt.Errorf("error reading transfer manifest: %w", err)
+			}
+		}
+	} else {
+		// Tag Package: Downloading
+		if err = tagUpdaters.Preservation(ctx, preservationTagDownloading); err != nil {
+			return fmt.Errorf("error updating Preservation tag: %w", err)
+		}
+		logger.Info("Downloading package: %s", cellsPackagePath)
+		finishEvent = recorder.Start(catalog.EventDownload, cellsPackagePath)
+		downloadedPath, err = p.downloadPackage(ctx, userClient, processingDir, cellsPackagePath)
+		finishEvent(err)
+		if err != nil {
+			return fmt.Errorf("error downloading package: %w", err)
+		}
+
+		// Record the manifest of the input tree before it is modified by the pipeline
+		if pcfg.ManifestCheck != config.ManifestCheckOff || pcfg.DuplicateCheck != config.DuplicateCheckOff {
+			inputManifest, err = p.recordInputManifest(ctx, reportDir, downloadedPath)
+			if err != nil {
+				return fmt.Errorf("error recording input manifest: %w", err)
+			}
+		}
+
+		// Transfers whose content was already preserved are reported, or skipped before processing
+		if pcfg.DuplicateCheck != config.DuplicateCheckOff {
+			err = p.checkDuplicate(recorder, inputManifest.Fingerprint("data"), pcfg.DuplicateCheck == config.DuplicateCheckSkip)
+			if err != nil {
+				// The same transfer is a duplicate when run again
+				return utils.Permanent(err)
+			}
+		}
+		if pcfg.ManifestCheck == config.ManifestCheckOff {
+			inputManifest = nil
+		}
+	}
+
+	// Package is held in the processing area until it passes the preprocessing checks
+	if err = recorder.Transition(catalog.StateQuarantined); err != nil {
+		return fmt.Errorf("error updating package state: %w", err)
 	}
 
 	///////////////////////////////////////////////////////////////////
 	//						 Preprocessing							 //
 	///////////////////////////////////////////////////////////////////
 
-	// Tag Package: Preprocessing
-	if err = tagUpdaters.Preservation(ctx, preservationTagPreprocessing); err != nil {
-		return fmt.Errorf("error updating Preservation tag: %w", err)
-	}
-	// Preprocess package. Don't use retry as we move/extract the package in the first step
-	logger.Info("Preprocessing package: %s", cellsPackagePath)
+	var transferPath string
+	if checkpoint != nil {
+		// The transfer was preprocessed and scanned for sensitive data before the package failed
+		transferPath = checkpoint.TransferPath
+		reviewRequired = resumedFrom.ReviewRequired
+	} else {
+		// Tag Package: Preprocessing
+		if err = tagUpdaters.Preservation(ctx, preservationTagPreprocessing); err != nil {
+			return fmt.Errorf("error updating Preservation tag: %w", err)
+		}
+		// Preprocess package. Don't use retry as we move/extract the package in the first step
+		logger.Info("Preprocessing package: %s", cellsPackagePath)
 
-	// Add defensive check for userClient.UserData
-	if userClient.UserData == nil {
-		return fmt.Errorf("user data is nil for user client")
-	}
+		// Add defensive check for userClient.UserData
+		if userClient.UserData == nil {
+			return fmt.Errorf("user data is nil for user client")
+		}
 
-	var transferPath string
-	transferPath, err = p.preprocessPackage(ctx, processingDir, downloadedPath, nodeCollection, userClient.UserData)
-	if err != nil {
-		return fmt.Errorf("error preprocessing package: %w", err)
+		var deselections []processor.Deselection
+		transferPath, deselections, err = p.preprocessPackage(ctx, processingDir, downloadedPath, nodeCollection, userClient.UserData, pcfg, deselect, recorder)
+		if err != nil {
+			if errors.Is(err, processor.ErrInfected) {
+				p.notifyPackage(recorder, userClient, cellsPackagePath, config.NotifyEventQuarantined, notify.SeverityError, err.Error())
+				// Running an infected package again quarantines it again
+				return utils.Permanent(fmt.Errorf("error preprocessing package: %w", err))
+			}
+			return fmt.Errorf("error preprocessing package: %w", err)
+		}
+		// Scan for sensitive data. Packages with findings are flagged for review and their DIP is held back
+		if pcfg.PIIScan != nil {
+			reviewRequired, err = p.scanForPII(ctx, reportDir, transferPath, pcfg.PIIScan, recorder)
+			if err != nil {
+				return fmt.Errorf("error scanning for sensitive data: %w", err)
+			}
+			if reviewRequired {
+				p.notifyPackage(recorder, userClient, cellsPackagePath, config.NotifyEventQuarantined, notify.SeverityWarning, recorder.Record().ReviewReason)
+			}
+		}
+
+		// Deselected files are expected to be missing from the AIP
+		if inputManifest != nil {
+			for _, deselection := range deselections {
+				inputManifest.Remove(path.Join("data", deselection.Path))
+			}
+		}
+
+		// The package is resumed from the submission to A3M if it fails from here
+		var transferManifest string
+		if inputManifest != nil {
+			transferManifest = filepath.Join(processingDir, transferManifestFile)
+			if err = inputManifest.Write(transferManifest); err != nil {
+				return fmt.Errorf("error writing transfer manifest: %w", err)
+			}
+		}
+		recorder.Checkpoint(catalog.CheckpointPreprocessed, func(c *catalog.Checkpoint) {
+			c.ProcessingDir = processingDir
+			c.PathResolved = pathResolved
+			c.TransferPath = transferPath
+			c.InputManifest = transferManifest
+		})
+	}
+	// The DIP of a package with sensitive data is held back for review
+	if reviewRequired && producingDip {
+		logger.Warn("Sensitive data found. Holding back DIP for review: %s", cellsPackagePath)
+		producingDip = false
+		if err = tagUpdaters.Dip(ctx, dipTagReviewRequired); err != nil {
+			return fmt.Errorf("error updating AtoM tag: %w", err)
+		}
 	}
 
 	///////////////////////////////////////////////////////////////////
 	//						 Submit to A3M							 //
 	///////////////////////////////////////////////////////////////////
 
-	// Tag Package: Preserving
-	if err = tagUpdaters.Preservation(ctx, preservationTagPackaging); err != nil {
-		return fmt.Errorf("error updating Preservation tag: %w", err)
-	}
-
-	a3mStartTime := time.Now()
-	// Submit package to A3M
-	logger.Info("Submitting package to A3M: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, transferPath))
 	transferName := transferNameFromPath(transferPath)
-	var aipUUID string
-	aipUUID, err = p.submitPackage(ctx, transferPath, transferName, pcfg.A3mConfig)
-	if err != nil {
-		return fmt.Errorf("failed to submit package: %w (path: %s)", err, transferPath)
-	}
-	var a3mAipPath string
-	a3mAipPath, err = getA3mAipPath(p.envConfig.A3M.CompletedDir, transferName, aipUUID)
-	if err != nil {
-		return fmt.Errorf("error getting A3M AIP path: %v", err)
+	var aipUUID, a3mAipPath string
+	a3mStartTime := time.Now()
+	if checkpoint.Reached(catalog.CheckpointCharacterized) {
+		// A3M produced the AIP before the package failed
+		aipUUID = resumedFrom.AIPUUID
+		a3mAipPath = checkpoint.A3MAIPPath
+	} else {
+		// Tag Package: Preserving
+		if err = tagUpdaters.Preservation(ctx, preservationTagPackaging); err != nil {
+			return fmt.Errorf("error updating Preservation tag: %w", err)
+		}
+
+		// Submit package to A3M
+		logger.Info("Submitting package to A3M: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, transferPath))
+		var a3mResp *transferservice.ReadResponse
+		finishEvent = recorder.Start(catalog.EventPackaging, "a3m: "+transferName)
+		aipUUID, a3mResp, err = p.submitPackage(ctx, transferPath, transferName, pcfg.A3mConfig, recorder)
+		recorder.AddEvents(a3mEvents(a3mResp.GetJobs(), time.Now().UTC())...)
+		if recorder != nil {
+			writeStageLog(reportDir, transferName, a3mResp, err)
+		}
+		finishEvent(err)
+		if err != nil {
+			return fmt.Errorf("failed to submit package: %w (path: %s)", err, transferPath)
+		}
+		a3mAipPath, err = getA3mAipPath(p.envConfig.A3M.CompletedDir, transferName, aipUUID)
+		if err != nil {
+			return fmt.Errorf("error getting A3M AIP path: %v", err)
+		}
+		logger.Info("Generated A3M AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, a3mAipPath))
 	}
 	a3mFinishTime := time.Since(a3mStartTime).Seconds()
 	defer func() {
-		// Clean up the A3M AIP
-		if cleanUp && a3mAipPath != "" {
+		// Clean up the A3M AIP, unless it is kept to resume the package
+		if (cleanUp || stopped(ctx)) && a3mAipPath != "" && !p.keepFailed(ctx, recorder, runErr) {
 			if removeErr := os.RemoveAll(a3mAipPath); removeErr != nil {
 				logger.Error("Error deleting A3M AIP: %v", removeErr)
 			} else {
@@ -278,41 +572,100 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 		}
 		logger.Debug("A3M Execution time: %vs", a3mFinishTime)
 	}()
-	logger.Info("Generated A3M AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, a3mAipPath))
+	recorder.Update(func(rec *catalog.Record) { rec.AIPUUID = aipUUID })
+	// A3M has identified and characterized the package contents
+	if err = recorder.Transition(catalog.StateCharacterized); err != nil {
+		return fmt.Errorf("error updating package state: %w", err)
+	}
+	if !checkpoint.Reached(catalog.CheckpointCharacterized) {
+		// The package is resumed from the extraction of the AIP if it fails from here
+		recorder.Checkpoint(catalog.CheckpointCharacterized, func(c *catalog.Checkpoint) { c.A3MAIPPath = a3mAipPath })
+	}
 
 	///////////////////////////////////////////////////////////////////
 	//						 Postprocessing							 //
 	///////////////////////////////////////////////////////////////////
 
-	// Tag Package: Extracting
-	if err = tagUpdaters.Preservation(ctx, preservationTagExtracting); err != nil {
-		return fmt.Errorf("error updating Preservation tag: %w", err)
-	}
-	// Create AIP Directory
-	processingAipDir := filepath.Join(processingDir, "aip")
-	if err = utils.CreateDir(processingAipDir); err != nil {
-		return fmt.Errorf("failed to create AIP directory: %w", err)
-	}
-	// Post-process package
-	logger.Info("Postprocessing A3M AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, a3mAipPath))
 	var aipPath string
-	aipPath, err = p.postprocessPackage(ctx, processingAipDir, a3mAipPath)
-	if err != nil {
-		return fmt.Errorf("error postprocessing package: %w", err)
-	}
-	logger.Info("Postprocessed AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, aipPath))
-	if pcfg.CompressAip {
-		// Tag Package: Compressing
-		if err = tagUpdaters.Preservation(ctx, preservationTagCompressing); err != nil {
+	if checkpoint.Reached(catalog.CheckpointPackaged) {
+		// The AIP was extracted, exported and compressed before the package failed
+		aipPath = checkpoint.AIPPath
+	} else {
+		// Tag Package: Extracting
+		if err = tagUpdaters.Preservation(ctx, preservationTagExtracting); err != nil {
 			return fmt.Errorf("error updating Preservation tag: %w", err)
 		}
-		// Compress AIP
-		logger.Info("Compressing AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, aipPath))
-		aipPath, err = p.compressPackage(ctx, processingAipDir, aipPath)
+		// Create AIP Directory
+		processingAipDir := filepath.Join(processingDir, "aip")
+		if err = utils.CreateDir(processingAipDir); err != nil {
+			return fmt.Errorf("failed to create AIP directory: %w", err)
+		}
+		// Post-process package
+		logger.Info("Postprocessing A3M AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, a3mAipPath))
+		finishEvent = recorder.Start(catalog.EventExtraction, "Extract AIP")
+		aipPath, err = p.postprocessPackage(ctx, processingAipDir, a3mAipPath, recorder)
+		finishEvent(err)
 		if err != nil {
-			return fmt.Errorf("error compressing AIP: %w", err)
+			return fmt.Errorf("error postprocessing package: %w", err)
+		}
+		logger.Info("Postprocessed AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, aipPath))
+		if recorder != nil {
+			copyMETS(aipPath, reportDir)
 		}
-		logger.Info("Compressed AIP %s", utils.RelPath(p.envConfig.ProcessingBaseDir, aipPath))
+		if inputManifest != nil {
+			strict := pcfg.ManifestCheck == config.ManifestCheckStrict
+			var report *manifest.Report
+			report, err = p.compareManifests(ctx, reportDir, aipPath, inputManifest, strict, recorder)
+			if report != nil && report.HasLoss() {
+				severity := notify.SeverityWarning
+				if strict {
+					severity = notify.SeverityError
+				}
+				p.notifyPackage(recorder, userClient, cellsPackagePath, config.NotifyEventFixityFailed, severity, catalog.ManifestComparisonDetail+report.Summary())
+			}
+			if err != nil {
+				if report != nil && report.HasLoss() {
+					// The same package loses the same files when run again
+					return utils.Permanent(fmt.Errorf("error comparing manifests: %w", err))
+				}
+				return fmt.Errorf("error comparing manifests: %w", err)
+			}
+		}
+		if pcfg.Export != nil {
+			// Export the AIP for another preservation system
+			finishEvent = recorder.Start(catalog.EventPackaging, "Export AIP: "+pcfg.Export.Format)
+			var exportPath string
+			exportPath, err = p.exportPackage(ctx, aipPath, aipUUID, nodeCollection.Parent, pcfg.Export)
+			finishEvent(err)
+			if err != nil {
+				return fmt.Errorf("error exporting AIP: %w", err)
+			}
+			logger.Info("Exported AIP: %s", exportPath)
+		}
+		if pcfg.CompressAip {
+			// Tag Package: Compressing
+			if err = tagUpdaters.Preservation(ctx, preservationTagCompressing); err != nil {
+				return fmt.Errorf("error updating Preservation tag: %w", err)
+			}
+			// Compress AIP
+			logger.Info("Compressing AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, aipPath))
+			finishEvent = recorder.Start(catalog.EventPackaging, "Compress AIP")
+			aipPath, err = p.compressPackage(ctx, processingAipDir, aipPath)
+			finishEvent(err)
+			if err != nil {
+				return fmt.Errorf("error compressing AIP: %w", err)
+			}
+			logger.Info("Compressed AIP %s", utils.RelPath(p.envConfig.ProcessingBaseDir, aipPath))
+		}
+	}
+
+	// AIP is ready for dissemination and storage
+	if err = recorder.Transition(catalog.StatePackaged); err != nil {
+		return fmt.Errorf("error updating package state: %w", err)
+	}
+	if !checkpoint.Reached(catalog.CheckpointPackaged) {
+		// The package is resumed from the dissemination and storage of the AIP if it fails from here
+		recorder.Checkpoint(catalog.CheckpointPackaged, func(c *catalog.Checkpoint) { c.AIPPath = aipPath })
 	}
 
 	///////////////////////////////////////////////////////////////////
@@ -336,12 +689,31 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 
 		// Create AtoM Client
 		var atomClient *atom.Client
-		atomClient, err = atom.NewClient(atomConfig)
+		atomClient, err = atom.NewClient(atomConfig, p.envConfig.Retry.Dissemination)
 		if err != nil {
 			return fmt.Errorf("error creating AtoM client: %w", err)
 		}
 		defer atomClient.Close()
 
+		// Resolve the target archival description before moving the DIP.
+		// The slug tag may hold a slug, an identifier or a title
+		atomConfig.Slug, err = atomClient.ResolveSlug(ctx, atomConfig.Slug)
+		if err != nil {
+			return fmt.Errorf("error resolving AtoM target description: %w", err)
+		}
+
+		// Describe the package in AtoM from its metadata, so the DIP lands under a described record
+		if atomConfig.DescriptionMode == config.DescriptionModeCreate || atomConfig.DescriptionMode == config.DescriptionModeUpdate {
+			finishEvent = recorder.Start(catalog.EventDissemination, fmt.Sprintf("Describe package in AtoM (%s): %s", atomConfig.DescriptionMode, atomConfig.Slug))
+			fields := atom.DescriptionFieldsFromMetadata(processor.NodeMetadata(nodeCollection.Parent))
+			atomConfig.Slug, err = atomClient.Describe(ctx, atomConfig.DescriptionMode, atomConfig.Slug, filepath.Base(cellsPackagePath), fields)
+			finishEvent(err)
+			if err != nil {
+				return fmt.Errorf("error describing package in AtoM: %w", err)
+			}
+		}
+		recorder.Update(func(rec *catalog.Record) { rec.AtomSlug = atomConfig.Slug })
+
 		// Ensure DIP exists where expected
 		logger.Debug("Searching for DIP: %s", aipUUID)
 		var a3mDipPath string
@@ -350,8 +722,8 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 			return fmt.Errorf("error getting A3M DIP path: %v", err)
 		}
 		defer func() {
-			// Clean up the A3M AIP
-			if cleanUp && a3mDipPath != "" {
+			// Clean up the A3M DIP, unless it is kept to resume the package
+			if (cleanUp || stopped(ctx)) && a3mDipPath != "" && !p.keepFailed(ctx, recorder, runErr) {
 				if removeErr := os.RemoveAll(a3mDipPath); removeErr != nil {
 					logger.Error("Error deleting A3M DIP: %v", removeErr)
 				} else {
@@ -361,6 +733,24 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 		}()
 		logger.Debug("Found A3M DIP: %s", a3mDipPath)
 
+		// Generate thumbnails and previews for the DIP objects. The AIP is left untouched
+		if pcfg.Thumbnails != nil {
+			logger.Info("Generating DIP thumbnails: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, a3mDipPath))
+			finishEvent = recorder.Start(catalog.EventDissemination, "Generate DIP thumbnails")
+			var generated int
+			generated, err = processor.NewThumbnailGenerator(p.envConfig, pcfg.Thumbnails).Generate(ctx, a3mDipPath)
+			finishEvent(err)
+			if err != nil {
+				return fmt.Errorf("error generating DIP thumbnails: %w", err)
+			}
+			logger.Debug("Generated thumbnails for %d DIP objects", generated)
+		}
+
+		// Upload the access copies to Cells and share them, so staff can distribute them before AtoM has imported the DIP
+		if pcfg.AccessCopies != nil {
+			p.publishAccessCopies(ctx, userClient, processingDir, a3mDipPath, transferName+"-"+aipUUID, pcfg.AccessCopies, recorder)
+		}
+
 		logger.Info("Migrating DIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, a3mDipPath))
 
 		// Tag Package: Migrating to AtoM Server
@@ -369,7 +759,10 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 		}
 
 		// Migrate DIP to AtoM server
-		if err = atomClient.MigratePackage(ctx, a3mDipPath); err != nil {
+		finishEvent = recorder.Start(catalog.EventDissemination, "Migrate DIP to AtoM")
+		err = p.limits.Do(ctx, limits.Dissemination, func() error { return atomClient.MigratePackage(ctx, a3mDipPath) })
+		finishEvent(err)
+		if err != nil {
 			return fmt.Errorf("error migrating DIP to AtoM: %w", err)
 		}
 
@@ -379,10 +772,35 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 		}
 
 		// Deposit DIP to AtoM
-		if err = atomClient.DepositDip(ctx, atomConfig.Slug, filepath.Base(a3mDipPath)); err != nil {
+		var descendants int
+		descendants, err = atomClient.CountDescendants(ctx, atomConfig.Slug)
+		if err != nil {
+			return fmt.Errorf("error reading AtoM target description: %w", err)
+		}
+		finishEvent = recorder.Start(catalog.EventDissemination, "Deposit DIP to AtoM: "+atomConfig.Slug)
+		err = p.limits.Do(ctx, limits.Dissemination, func() error {
+			return atomClient.DepositDip(ctx, atomConfig.Slug, filepath.Base(a3mDipPath))
+		})
+		finishEvent(err)
+		if err != nil {
 			return fmt.Errorf("error depositing DIP to AtoM: %w", err)
 		}
 
+		// Tag Package: Importing
+		if err = tagUpdaters.Dip(ctx, dipTagImporting); err != nil {
+			return fmt.Errorf("error updating AtoM tag: %w", err)
+		}
+
+		// Wait for AtoM to import the deposited DIP
+		finishEvent = recorder.Start(catalog.EventDissemination, "Import DIP into AtoM: "+atomConfig.Slug)
+		var imported int
+		imported, err = atomClient.WaitForImport(ctx, atomConfig.Slug, descendants)
+		finishEvent(err)
+		if err != nil {
+			return fmt.Errorf("error importing DIP into AtoM: %w", err)
+		}
+		logger.Info("AtoM imported %d descriptions into %s", imported, atomConfig.Slug)
+
 		// Tag Package: Preserved
 		if err = tagUpdaters.Preservation(ctx, dipTagCompleted); err != nil {
 			return fmt.Errorf("error updating Preservation tag: %w", err)
@@ -402,9 +820,11 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 	// Upload Node
 	logger.Info("Uploading AIP: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, aipPath))
 	var cellsUploadPath string
+	finishEvent = recorder.Start(catalog.EventStorage, "Upload AIP to Cells")
 	cellsUploadPath, err = p.uploadPackage(ctx, userClient, aipPath)
+	finishEvent(err)
 	if err != nil {
-		return fmt.Errorf("error uploading AIP: %w", err)
+		return utils.Classify(utils.ErrStorage, fmt.Errorf("error uploading AIP: %w", err))
 	}
 	logger.Info("Uploaded AIP %s", cellsUploadPath)
 
@@ -414,11 +834,42 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 	if err != nil {
 		return fmt.Errorf("error resolving upload path: %w", err)
 	}
-	_, err = p.getNodeStats(ctx, resolvedUploadPath)
+	var aipStats *models.TreeReadNodeResponse
+	aipStats, err = p.getNodeStats(ctx, resolvedUploadPath)
 	if err != nil {
 		return fmt.Errorf("error getting node stats: %w", err)
 	}
 	logger.Info("Verified AIP in Cells: %s", resolvedUploadPath)
+	recorder.Update(func(rec *catalog.Record) {
+		rec.AIPPath = cellsUploadPath
+		rec.AIPSize = nodeSize(aipStats.Node)
+	})
+	// AIP is stored and verified in Cells
+	if err = recorder.Transition(catalog.StateStored); err != nil {
+		return fmt.Errorf("error updating package state: %w", err)
+	}
+	p.notifyPackage(recorder, userClient, cellsPackagePath, config.NotifyEventAIPStored, notify.SeverityInfo, cellsUploadPath)
+	// Replicate the stored AIP to the configured storage locations
+	if p.replicateAIP(ctx, aipUUID, aipPath, pcfg.StorageTier, recorder) {
+		if err = recorder.Transition(catalog.StateReplicated); err != nil {
+			return fmt.Errorf("error updating package state: %w", err)
+		}
+	}
+	// Register the stored AIP in ArchivesSpace if the package is linked to an archival object
+	p.registerInArchivesSpace(ctx, nodeCollection.Parent, aipUUID, aipPath, cellsUploadPath, recorder)
+	// Register the stored AIP in the Archivematica Storage Service if enabled
+	p.registerInStorageService(ctx, aipUUID, aipPath, recorder)
+	// Deposit the access copies into the access repositories, unless the DIP is held back
+	if pcfg.DIPEnabled() && !reviewRequired {
+		p.depositInRepositories(ctx, userClient, nodeCollection.Parent, aipUUID, pcfg.Profile, recorder)
+	}
+
+	// The DIP is delivered before the AIP is uploaded, the package is disseminated once it is also stored
+	if producingDip {
+		if err = recorder.Transition(catalog.StateDisseminated); err != nil {
+			return fmt.Errorf("error updating package state: %w", err)
+		}
+	}
 
 	// TODO: Tag the uploaded AIP with the atom slug
 	// if producingDip {
@@ -428,6 +879,9 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 	// 	}
 	// }
 
+	// Write the preservation status back to the package node
+	p.writePreservationMetadata(ctx, userClient, nodeCollection.Parent.UUID, aipUUID, recorder)
+
 	// Tag Package: Preserved
 	if err = tagUpdaters.Preservation(ctx, preservationTagCompleted); err != nil {
 		return fmt.Errorf("error updating Preservation tag: %w", err)
@@ -440,6 +894,46 @@ func (p *Preserver) Run(ctx context.Context, pcfg *config.PreservationConfig, at
 	return nil
 }
 
+// cancelled reports whether the preservation was cancelled by a user, rather than interrupted by a shutdown.
+func cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrCancelled)
+}
+
+// interrupted reports whether the preservation was interrupted by a shutdown.
+func interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrInterrupted)
+}
+
+// stopped reports whether the preservation was cancelled or interrupted, and must remove its partial outputs.
+func stopped(ctx context.Context) bool {
+	return cancelled(ctx) || interrupted(ctx)
+}
+
+// newRecorder creates the record of a package, with the tenant and the job of the context. Returns nil if package
+// records are disabled or cannot be written.
+func (p *Preserver) newRecorder(ctx context.Context, userClient cells.UserClient, cellsPackagePath string) *catalog.Recorder {
+	if p.catalog == nil {
+		return nil
+	}
+	var username string
+	if userClient.UserData != nil {
+		username = userClient.UserData.Login
+	}
+	recorder, err := p.catalog.NewRecorder(utils.NewUUID(), cellsPackagePath, username, TenantFromContext(ctx))
+	if err != nil {
+		logger.Error("Error creating package record for %s: %v", cellsPackagePath, err)
+		return nil
+	}
+	if job := jobFromContext(ctx); job.id != "" {
+		recorder.Update(func(rec *catalog.Record) {
+			rec.JobID = job.id
+			rec.QueuedAt = job.queuedAt
+		})
+	}
+	logger.Info("Package ID: %s", recorder.ID())
+	return recorder
+}
+
 // NewUserClient creates a new cells user client.
 func (p *Preserver) NewUserClient(ctx context.Context, username string) (cells.UserClient, error) {
 	return p.cellsClient.NewUserClient(ctx, username, p.envConfig.AllowInsecureTLS)
@@ -455,6 +949,68 @@ func (p *Preserver) createTagUpdater(userClient cells.UserClient, parentNodeUUID
 	}
 }
 
+// resolveProfile applies the processing profile selected for the package.
+// An explicit preservation config takes priority over the profile's processing options.
+// The AtoM config is cloned so per package changes don't leak between packages.
+// The packages of a tenant use its default profile when none is requested, only use its profiles, and deposit
+// their DIPs in its AtoM target.
+func (p *Preserver) resolveProfile(tenant *config.Tenant, profileName, cellsPackagePath string, pcfg *config.PreservationConfig, atomConfig *config.AtomConfig) (*config.PreservationConfig, *config.AtomConfig, error) {
+	registry, err := config.GetProfiles(p.envConfig)
+	if err != nil {
+		// A file being edited must not fail the packages submitted meanwhile
+		last := p.integrations().profiles
+		if last == nil {
+			return nil, nil, err
+		}
+		logger.Warn("Using the profiles of the last valid profiles file: %v", err)
+		registry = last
+	}
+	if tenant != nil && profileName == "" {
+		profileName = tenant.DefaultProfile
+	}
+	profile, policy, err := registry.ResolvePolicy(profileName, cellsPackagePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tenant != nil && len(tenant.Profiles) > 0 {
+		if pcfg != nil {
+			return nil, nil, fmt.Errorf("%w: tenant %s is restricted to its processing profiles", ErrTenantAccess, tenant.Name)
+		}
+		if profile == nil {
+			return nil, nil, fmt.Errorf("%w: tenant %s requires one of its processing profiles", ErrTenantAccess, tenant.Name)
+		}
+		if !tenant.AllowsProfile(profile.Name) {
+			return nil, nil, fmt.Errorf("%w: processing profile %s is not one of the profiles of tenant %s", ErrTenantAccess, profile.Name, tenant.Name)
+		}
+	}
+
+	atomConfig = atomConfig.Clone()
+	if policy != nil {
+		logger.Info("Using policy: %s", policy.Path)
+	}
+	if profile == nil {
+		logger.Debug("No processing profile found. Using default processing configuration")
+	} else {
+		logger.Info("Using processing profile: %s", profile.Name)
+	}
+	atomConfig.ApplyTarget(policy.AtomTarget(profile))
+	if tenant != nil && tenant.Atom != nil {
+		atomConfig.ApplyTarget(tenant.Atom)
+	}
+
+	if pcfg == nil {
+		profileCfg := profile.PreservationConfig()
+		pcfg = &profileCfg
+		// The policy's storage tier overrides the profile's
+		if policy != nil && policy.StorageTier != "" {
+			pcfg.StorageTier = policy.StorageTier
+		}
+	} else if profile != nil {
+		logger.Debug("Explicit preservation configuration provided. Ignoring processing options of profile: %s", profile.Name)
+	}
+	return pcfg, atomConfig, nil
+}
+
 // Gather the node environment. Returns the node collection and tag updaters.
 func (p *Preserver) gatherNodeEnvironment(ctx context.Context, userClient cells.UserClient, cellsPackagePath string) (*models.RestNodesCollection, *TagUpdaters, error) {
 	// Get the resolved cells path, parsing cells template path if necessary
@@ -479,6 +1035,8 @@ func (p *Preserver) gatherNodeEnvironment(ctx context.Context, userClient cells.
 	if nodeCollection.Parent.MetaStore == nil {
 		nodeCollection.Parent.MetaStore = make(map[string]string)
 	}
+	// Metadata submitted with the package fills in the fields missing from its node
+	processor.ApplyMetadata(nodeCollection.Parent, metadataFromContext(ctx))
 
 	// Set the parent node uuid
 	parentNodeUUID := nodeCollection.Parent.UUID
@@ -526,57 +1084,202 @@ func (p *Preserver) downloadPackage(ctx context.Context, userClient cells.UserCl
 	if err := utils.CreateDir(downloadDir); err != nil {
 		return "", fmt.Errorf("failed to create download directory: %w", err)
 	}
+	release, err := p.limits.Acquire(ctx, limits.Download)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 	// TODO: I don't think retry will work here because the download is executed using CEC binary, so doesn't produce a transient error.
 	var downloadedPath string
-	err := utils.Retry(3, 2*time.Second, func() error {
+	err = utils.RetryContext(ctx, p.envConfig.Retry.Download, func() error {
 		var downloadErr error
 		downloadedPath, downloadErr = p.cellsClient.DownloadNode(ctx, userClient, packagePath, downloadDir)
 		return downloadErr
-	}, utils.IsTransientError)
+	})
 	if err != nil {
 		return "", fmt.Errorf("download error: %w", err)
 	}
 	return downloadedPath, nil
 }
 
+// Records the manifest of the downloaded package to the report directory. Paths are relative to the transfer root (data/...).
+func (p *Preserver) recordInputManifest(ctx context.Context, reportDir, downloadedPath string) (*manifest.Manifest, error) {
+	inputManifest, err := manifest.FromPath(ctx, downloadedPath, "data", manifest.DefaultAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := inputManifest.Write(filepath.Join(reportDir, catalog.ArtifactInputManifest)); err != nil {
+		return nil, err
+	}
+	logger.Debug("Recorded input manifest: %d files", len(inputManifest.Entries))
+	return inputManifest, nil
+}
+
+// Compares the input manifest to the objects of the extracted AIP and writes the report to the report directory.
+// Renamed files are expected (a3m sanitizes file names) and only logged.
+// In strict mode, dropped or modified files fail the preservation. Returns the comparison report.
+func (p *Preserver) compareManifests(ctx context.Context, reportDir, aipPath string, inputManifest *manifest.Manifest, strict bool, recorder *catalog.Recorder) (*manifest.Report, error) {
+	outputManifest, err := manifest.FromDir(ctx, filepath.Join(aipPath, "data", "objects"), "", inputManifest.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	report, err := inputManifest.Compare(outputManifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := report.Write(filepath.Join(reportDir, catalog.ArtifactManifestReport)); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Manifest comparison: %s", report.Summary())
+	outcome := catalog.OutcomeSuccess
+	if report.HasLoss() {
+		outcome = catalog.OutcomeWarning
+		if strict {
+			outcome = catalog.OutcomeFailure
+		}
+	}
+	recorder.Add(catalog.EventFixity, outcome, catalog.ManifestComparisonDetail+report.Summary())
+	for _, rename := range report.Renamed {
+		logger.Debug("Renamed by pipeline: %s -> %s", rename.From, rename.To)
+	}
+	for _, path := range report.Modified {
+		logger.Warn("Modified by pipeline: %s", path)
+	}
+	for _, path := range report.Dropped {
+		logger.Warn("Dropped by pipeline: %s", path)
+	}
+	if strict && report.HasLoss() {
+		return report, utils.Classify(utils.ErrIntegrity, fmt.Errorf("pipeline dropped %d and modified %d input files", len(report.Dropped), len(report.Modified)))
+	}
+	return report, nil
+}
+
 // Preprocess package. Uses preproces module. Constructs the a3m tranfer package. Writes DC and Premis Metadata.
-func (p *Preserver) preprocessPackage(ctx context.Context, processingDir, packagePath string, nodeCollection *models.RestNodesCollection, userData *models.IdmUser) (string, error) {
+// Removes deselected files. Writes transfer checksum files and scans for viruses if the preservation config requires it.
+func (p *Preserver) preprocessPackage(ctx context.Context, processingDir, packagePath string, nodeCollection *models.RestNodesCollection, userData *models.IdmUser, pcfg *config.PreservationConfig, deselect []string, recorder *catalog.Recorder) (string, []processor.Deselection, error) {
+	release, err := p.limits.Acquire(ctx, limits.Preprocessing)
+	if err != nil {
+		return "", nil, err
+	}
+	defer release()
 	// Create the a3m transfer directory
 	a3mTransferDir := filepath.Join(processingDir, "a3m_transfer")
 	if err := utils.CreateDir(a3mTransferDir); err != nil {
-		return "", fmt.Errorf("failed to create a3m transfer directory: %w", err)
+		return "", nil, fmt.Errorf("failed to create a3m transfer directory: %w", err)
 	}
 	// Preprocess package
-	transferPath, err := processor.PreprocessPackage(ctx, packagePath, a3mTransferDir, nodeCollection, userData, p.envConfig.Premis.Organization)
+	finishEvent := recorder.Start(catalog.EventPreprocessing, "Construct transfer package")
+	transferPath, deselections, err := processor.PreprocessPackage(ctx, packagePath, a3mTransferDir, nodeCollection, userData, p.envConfig.Premis.Organization, deselect)
+	finishEvent(err)
+	if err != nil {
+		return "", nil, fmt.Errorf("error preprocessing package: %w", err)
+	}
+	if len(deselections) > 0 {
+		recorder.Add(catalog.EventAppraisal, catalog.OutcomeSuccess, fmt.Sprintf("Deselected %d files", len(deselections)))
+	}
+	if pcfg.AVScan {
+		logger.Info("Scanning package for viruses: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, transferPath))
+		finishEvent = recorder.Start(catalog.EventVirusScan, "ClamAV scan")
+		err = processor.ScanForViruses(ctx, p.envConfig.ClamAV.Address, filepath.Join(transferPath, "data"))
+		finishEvent(err)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if len(pcfg.ChecksumAlgorithms) > 0 {
+		finishEvent = recorder.Start(catalog.EventFixity, "Write transfer checksums: "+strings.Join(pcfg.ChecksumAlgorithms, ", "))
+		err = processor.WriteChecksumFiles(transferPath, pcfg.ChecksumAlgorithms, func(file string, completed, total int) {
+			recorder.Progress(catalog.EventFixity, file, completed, total)
+		})
+		finishEvent(err)
+		if err != nil {
+			return "", nil, fmt.Errorf("error writing checksum files: %w", err)
+		}
+	}
+	return transferPath, deselections, nil
+}
+
+// Scans the transfer data for sensitive data and writes the findings to the report directory.
+// Returns true if the package must be reviewed before dissemination.
+func (p *Preserver) scanForPII(ctx context.Context, reportDir, transferPath string, cfg *config.PIIScanConfig, recorder *catalog.Recorder) (bool, error) {
+	scanner, err := processor.NewPIIScanner(cfg)
+	if err != nil {
+		return false, err
+	}
+	logger.Info("Scanning package for sensitive data: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, transferPath))
+	finishEvent := recorder.Start(catalog.EventPIIScan, "Sensitive data scan")
+	findings, err := scanner.Scan(ctx, filepath.Join(transferPath, "data"))
+	finishEvent(err)
+	if err != nil {
+		return false, err
+	}
+	if len(findings) == 0 {
+		return false, nil
+	}
+
+	data, err := json.MarshalIndent(findings, "", "  ")
 	if err != nil {
-		return "", fmt.Errorf("error preprocessing package: %w", err)
+		return false, fmt.Errorf("error marshaling PII report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(reportDir, catalog.ArtifactPIIReport), data, 0o600); err != nil {
+		return false, fmt.Errorf("error writing PII report: %w", err)
 	}
-	return transferPath, nil
+
+	files := map[string]bool{}
+	for _, finding := range findings {
+		files[finding.Path] = true
+		logger.Warn("Possible %s found in %s (%d matches)", finding.Pattern, finding.Path, finding.Count)
+	}
+	reason := fmt.Sprintf("Possible sensitive data found in %d files", len(files))
+	recorder.Add(catalog.EventPIIScan, catalog.OutcomeWarning, reason)
+	recorder.Update(func(rec *catalog.Record) {
+		rec.ReviewRequired = true
+		rec.ReviewReason = reason
+	})
+	return true, nil
 }
 
-// Submit package to A3M. Submits the package to A3M and returns the path of the generated AIP.
+// Submit package to A3M. Submits the package to A3M and returns the AIP UUID and the final A3M response.
 // The generated AIP is expected to be in the configured A3M Completed directory.
-// Will retry submission on transient errors.
-func (p *Preserver) submitPackage(ctx context.Context, transferPath, transferName string, config *transferservice.ProcessingConfig) (string, error) {
+// Will retry submission on transient errors. Processing progress is kept on the package record.
+func (p *Preserver) submitPackage(ctx context.Context, transferPath, transferName string, config *transferservice.ProcessingConfig, recorder *catalog.Recorder) (string, *transferservice.ReadResponse, error) {
+	release, err := p.limits.Acquire(ctx, limits.Normalization)
+	if err != nil {
+		return "", nil, err
+	}
+	defer release()
 	var aipUUID string
+	var resp *transferservice.ReadResponse
 	// Submit package to A3M with retry
-	if err := utils.Retry(3, 2*time.Second, func() error {
+	if err := utils.RetryContext(ctx, p.envConfig.Retry.Packaging, func() error {
 		logger.Debug("Queing A3M Transfer: %s", utils.RelPath(p.envConfig.ProcessingBaseDir, transferPath))
 		ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
 		defer cancel()
 		var submitErr error
-		aipUUID, _, submitErr = p.a3mClient.SubmitPackage(ctx, transferPath, transferName, config)
+		aipUUID, resp, submitErr = p.a3mClient.SubmitPackageWithProgress(ctx, transferPath, transferName, config, recorder.Processing)
 		return submitErr
-	}, utils.IsTransientError); err != nil {
-		return "", fmt.Errorf("submission failed: %v", err)
+	}); err != nil {
+		return "", resp, fmt.Errorf("submission failed: %w", err)
 	}
-	return aipUUID, nil
+	return aipUUID, resp, nil
 }
 
 // Post-processes the AIP. Extracts the AIP.
-func (p *Preserver) postprocessPackage(ctx context.Context, processingAipDir, a3mAipPath string) (string, error) {
-	// Extract AIP
-	aipPath, err := utils.ExtractArchive(ctx, a3mAipPath, processingAipDir)
+func (p *Preserver) postprocessPackage(ctx context.Context, processingAipDir, a3mAipPath string, recorder *catalog.Recorder) (string, error) {
+	release, err := p.limits.Acquire(ctx, limits.Extraction)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	// Extract AIP, the entries are only counted as they are extracted
+	extracted := 0
+	aipPath, err := utils.ExtractArchiveWithOptions(ctx, a3mAipPath, processingAipDir, utils.ExtractOptions{
+		OnEntry: func(entry utils.ArchiveEntry) {
+			extracted++
+			recorder.Progress(catalog.EventExtraction, entry.Name, extracted, 0)
+		},
+	})
 	if err != nil {
 		return "", fmt.Errorf("error extracting AIP: %w", err)
 	}
@@ -584,10 +1287,25 @@ func (p *Preserver) postprocessPackage(ctx context.Context, processingAipDir, a3
 	return aipPath, nil
 }
 
+// Exports the AIP in the configured format.
+func (p *Preserver) exportPackage(ctx context.Context, aipPath, aipUUID string, parent *models.TreeNode, cfg *config.ExportConfig) (string, error) {
+	metadata := processor.NodeMetadata(parent)
+	title := metadata["dc.title"]
+	if title == "" {
+		title = filepath.Base(parent.Path)
+	}
+	return export.ExportOPEX(ctx, aipPath, cfg, export.OPEXPackage{AIPUUID: aipUUID, Title: title, Metadata: metadata})
+}
+
 // Convert the AIP to a ZIP archive.
 func (p *Preserver) compressPackage(ctx context.Context, processingAipDir, aipPath string) (string, error) {
+	release, err := p.limits.Acquire(ctx, limits.Compression)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 	archiveAipPath := filepath.Join(processingAipDir, fmt.Sprintf("%s.zip", filepath.Base(aipPath)))
-	err := utils.CompressToZip(ctx, aipPath, archiveAipPath)
+	err = utils.CompressToZip(ctx, aipPath, archiveAipPath)
 	if err != nil {
 		return "", fmt.Errorf("error compressing AIP: %w", err)
 	}
@@ -596,6 +1314,11 @@ func (p *Preserver) compressPackage(ctx context.Context, processingAipDir, aipPa
 
 // Uploads the AIP to Cells
 func (p *Preserver) uploadPackage(ctx context.Context, userClient cells.UserClient, aipPath string) (string, error) {
+	release, err := p.limits.Acquire(ctx, limits.Storage)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 	return p.cellsClient.UploadNode(ctx, userClient, aipPath, p.envConfig.Cells.ArchiveWorkspace)
 }
 
@@ -0,0 +1,53 @@
+package preservation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// panickingCells is a Cells client whose path resolution panics.
+type panickingCells struct {
+	cells.ClientInterface
+}
+
+func (panickingCells) UnresolveCellsPath(cells.UserClient, string) (string, error) {
+	panic("cells client failure")
+}
+
+func TestRunRecordsPanicAsFailure(t *testing.T) {
+	store, err := catalog.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Preserver{cellsClient: panickingCells{}, catalog: store, envConfig: &config.Config{}}
+	p.current.Store(&integrations{})
+
+	const path = "personal-files/box-12"
+	err = p.Run(context.Background(), nil, nil, cells.UserClient{}, path, "", nil, false, true)
+	if err == nil {
+		t.Fatal("Run returned nil after a panic")
+	}
+	if want := "panic in preservation of " + path + ": cells client failure"; err.Error() != want {
+		t.Errorf("Run error = %q, want %q", err, want)
+	}
+
+	records, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d package records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.Outcome != catalog.OutcomeFailure {
+		t.Errorf("outcome = %q, want %q", rec.Outcome, catalog.OutcomeFailure)
+	}
+	if !strings.Contains(rec.Error, "cells client failure") {
+		t.Errorf("record error = %q, want the panic", rec.Error)
+	}
+}
@@ -0,0 +1,204 @@
+package preservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sdk-go/v4/models"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// ErrQuotaExceeded is returned when a package is over a quota of its tenant or of its Cells workspace.
+var ErrQuotaExceeded = utils.Classify(utils.ErrPolicy, errors.New("quota exceeded"))
+
+// quotaRecheck is the wait before a job held by a stored bytes quota is checked again. The storage used only goes
+// down when AIPs are removed, or when the quota is raised.
+const quotaRecheck = time.Hour
+
+// Quota scopes.
+const (
+	QuotaScopeTenant    = "tenant"
+	QuotaScopeWorkspace = "workspace"
+)
+
+// Quota limits, as in the quotas file.
+const (
+	QuotaStoredBytes  = "stored_bytes"
+	QuotaJobsPerDay   = "jobs_per_day"
+	QuotaPackageBytes = "package_bytes"
+)
+
+// QuotaError is the error of a package over a quota.
+type QuotaError struct {
+	Scope  string    // Scope of the quota, tenant or workspace
+	Name   string    // Name of the tenant or workspace
+	Limit  string    // Limit exceeded, e.g. jobs_per_day
+	Detail string    // Usage and limit, e.g. 20 of 20 jobs today
+	Queue  bool      // Submissions over the quota are queued rather than rejected
+	Until  time.Time // When the package may be under the quota again, zero if it never is
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of %s %s exceeded: %s", strings.ReplaceAll(e.Limit, "_", " "), e.Scope, e.Name, e.Detail)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// QuotaUsage is a quota with the storage and processing used under it.
+type QuotaUsage struct {
+	Scope       string        `json:"scope"` // tenant or workspace
+	Name        string        `json:"name"`
+	Quota       *config.Quota `json:"quota"`
+	StoredBytes int64         `json:"stored_bytes"` // Total size of the AIPs preserved
+	JobsToday   int           `json:"jobs_today"`   // Preservations started since the start of the UTC day
+	ResetsAt    time.Time     `json:"resets_at"`    // Start of the next UTC day, when the jobs are counted again
+}
+
+// Quotas returns the quotas of the tenants and workspaces. Returns nil if nothing is limited.
+func (p *Preserver) Quotas() *config.QuotasConfig {
+	return p.quotas
+}
+
+// quotasOf returns the quotas a package is held to, without their usage: the quota of its tenant, and the quota of its
+// Cells workspace if its Cells path is known.
+func (p *Preserver) quotasOf(tenant, cellsPath string) []*QuotaUsage {
+	if p.quotas == nil {
+		return nil
+	}
+	var usages []*QuotaUsage
+	if quota := p.quotas.Tenants[tenant]; tenant != "" && quota != nil {
+		usages = append(usages, &QuotaUsage{Scope: QuotaScopeTenant, Name: tenant, Quota: quota})
+	}
+	workspace, _, _ := strings.Cut(strings.TrimPrefix(cellsPath, "/"), "/")
+	if quota := p.quotas.Workspaces[workspace]; workspace != "" && quota != nil {
+		usages = append(usages, &QuotaUsage{Scope: QuotaScopeWorkspace, Name: workspace, Quota: quota})
+	}
+	return usages
+}
+
+// QuotaUsage returns the usage of the quotas, sorted by scope and name. A tenant only gets its own quota.
+func (p *Preserver) QuotaUsage(tenant string) ([]*QuotaUsage, error) {
+	var usages []*QuotaUsage
+	switch {
+	case p.quotas == nil:
+	case tenant != "":
+		usages = p.quotasOf(tenant, "")
+	default:
+		for name, quota := range p.quotas.Tenants {
+			usages = append(usages, &QuotaUsage{Scope: QuotaScopeTenant, Name: name, Quota: quota})
+		}
+		for name, quota := range p.quotas.Workspaces {
+			usages = append(usages, &QuotaUsage{Scope: QuotaScopeWorkspace, Name: name, Quota: quota})
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Scope != usages[j].Scope {
+			return usages[i].Scope < usages[j].Scope
+		}
+		return usages[i].Name < usages[j].Name
+	})
+	if err := p.countUsage(usages, ""); err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
+// countUsage counts the storage and processing used under quotas, from the package records. The record with the
+// given ID, if any, is not counted.
+func (p *Preserver) countUsage(usages []*QuotaUsage, exclude string) error {
+	if len(usages) == 0 || p.catalog == nil {
+		return nil
+	}
+	records, err := p.catalog.List()
+	if err != nil {
+		return err
+	}
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	for _, usage := range usages {
+		usage.ResetsAt = day.Add(24 * time.Hour)
+		q := catalog.Query{Tenant: usage.Name}
+		if usage.Scope == QuotaScopeWorkspace {
+			q = catalog.Query{Workspace: usage.Name}
+		}
+		for _, rec := range records {
+			if rec.ID == exclude || rec.OverQuota || !q.Match(rec) {
+				continue
+			}
+			if rec.Outcome == catalog.OutcomeSuccess {
+				usage.StoredBytes += rec.AIPSize
+			}
+			// Interrupted preservations are counted once they run again
+			if !rec.CreatedAt.Before(day) && rec.Outcome != catalog.OutcomeInterrupted {
+				usage.JobsToday++
+			}
+		}
+	}
+	return nil
+}
+
+// CheckQuota checks that a package is under the stored bytes and jobs per day quotas of its tenant and of its Cells
+// workspace, if its Cells path is known. The record with the given ID, e.g. the record of the package, is not counted.
+// Returns a *QuotaError if the package is over a quota. Quotas are not checked without package records.
+func (p *Preserver) CheckQuota(tenant, cellsPath, exclude string) error {
+	usages := p.quotasOf(tenant, cellsPath)
+	if err := p.countUsage(usages, exclude); err != nil {
+		// The usage must not break the preservation
+		logger.Error("Error counting the usage of the quotas: %v", err)
+		return nil
+	}
+	for _, usage := range usages {
+		quota := usage.Quota
+		qerr := &QuotaError{Scope: usage.Scope, Name: usage.Name, Queue: quota.Queues()}
+		switch {
+		case quota.StoredBytes > 0 && usage.StoredBytes >= quota.StoredBytes:
+			qerr.Limit = QuotaStoredBytes
+			qerr.Detail = fmt.Sprintf("%d of %d bytes stored", usage.StoredBytes, quota.StoredBytes)
+			qerr.Until = time.Now().Add(quotaRecheck)
+		case quota.JobsPerDay > 0 && usage.JobsToday >= quota.JobsPerDay:
+			qerr.Limit = QuotaJobsPerDay
+			qerr.Detail = fmt.Sprintf("%d of %d jobs today", usage.JobsToday, quota.JobsPerDay)
+			qerr.Until = usage.ResetsAt
+		default:
+			continue
+		}
+		return qerr
+	}
+	return nil
+}
+
+// CheckPackageSize checks that a package of the given size is under the package size quotas of its tenant and of its
+// Cells workspace, if its Cells path is known. Returns a *QuotaError if it is over one, packages are never queued
+// until they fit.
+func (p *Preserver) CheckPackageSize(ctx context.Context, cellsPath string, size int64) error {
+	for _, usage := range p.quotasOf(TenantFromContext(ctx), cellsPath) {
+		if limit := usage.Quota.PackageBytes; limit > 0 && size > limit {
+			return &QuotaError{
+				Scope:  usage.Scope,
+				Name:   usage.Name,
+				Limit:  QuotaPackageBytes,
+				Detail: fmt.Sprintf("package of %d bytes, at most %d", size, limit),
+			}
+		}
+	}
+	return nil
+}
+
+// nodeSize returns the size of a Cells node, cumulated for a folder, or 0 if it is unknown.
+func nodeSize(node *models.TreeNode) int64 {
+	if node == nil {
+		return 0
+	}
+	size, _ := strconv.ParseInt(node.Size, 10, 64)
+	return size
+}
@@ -0,0 +1,44 @@
+package preservation
+
+import (
+	"errors"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/pkg/reporting"
+)
+
+// reportFailure reports a failed preservation with the stage that failed, taken from the package timeline.
+func (p *Preserver) reportFailure(recorder *catalog.Recorder, userClient cells.UserClient, cellsPackagePath, profileName string, runErr error) {
+	// Skipped duplicates and packages over quota are expected
+	if runErr == nil || errors.Is(runErr, ErrDuplicate) || errors.Is(runErr, ErrQuotaExceeded) {
+		return
+	}
+	reporting.CaptureError(runErr, packageContext(recorder, userClient, cellsPackagePath, profileName))
+}
+
+// packageContext returns the reporting context of a package. The package details are taken from its record.
+func packageContext(recorder *catalog.Recorder, userClient cells.UserClient, cellsPackagePath, profileName string) reporting.Context {
+	c := reporting.Context{CellsPath: cellsPackagePath, Profile: profileName, Stage: catalog.EventPreservation}
+	if userClient.UserData != nil {
+		c.Username = userClient.UserData.Login
+	}
+	rec := recorder.Record()
+	if rec == nil {
+		return c
+	}
+	c.PackageID = rec.ID
+	c.AIPUUID = rec.AIPUUID
+	if rec.Profile != "" {
+		c.Profile = rec.Profile
+	}
+	// The last failed stage, the preservation event only records the overall outcome
+	for i := len(rec.Events) - 1; i >= 0; i-- {
+		event := rec.Events[i]
+		if event.Outcome == catalog.OutcomeFailure && event.Type != catalog.EventPreservation {
+			c.Stage = event.Type
+			break
+		}
+	}
+	return c
+}
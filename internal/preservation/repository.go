@@ -0,0 +1,85 @@
+package preservation
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/processor"
+	"github.com/penwern/curate-preservation-core/internal/repository"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/pydio/cells-sdk-go/v4/models"
+)
+
+// depositInRepositories deposits the access copies of the DIP and the package metadata into the access repositories
+// that accept the packages of the profile. DOIs minted by the repositories are written to the package node.
+// The AIP is already stored at this point, so failures are recorded and logged, not returned.
+func (p *Preserver) depositInRepositories(ctx context.Context, userClient cells.UserClient, parent *models.TreeNode, aipUUID, profile string, recorder *catalog.Recorder) {
+	repositories := p.integrations().repositories
+	if repositories == nil {
+		return
+	}
+	var dipPath string
+	metadata := processor.NodeMetadata(parent)
+	for _, repo := range repositories.Repositories {
+		if !repo.Accepts(profile) {
+			continue
+		}
+		finishEvent := recorder.Start(catalog.EventDissemination, "Deposit access copies into "+repo.Name)
+		if dipPath == "" {
+			var err error
+			if dipPath, err = getA3mDipPath(p.envConfig.A3M.DipsDir, aipUUID); err != nil {
+				finishEvent(err)
+				logger.Error("Error depositing access copies: %v", err)
+				return
+			}
+		}
+		receipt, err := p.deposit(ctx, repo, &repository.Package{
+			AIPUUID:  aipUUID,
+			Title:    packageTitle(parent, metadata),
+			Metadata: metadata,
+			DIPPath:  dipPath,
+		})
+		finishEvent(err)
+		if err != nil {
+			logger.Error("Error depositing access copies into %s: %v", repo.Name, err)
+			continue
+		}
+		logger.Info("Deposited access copies into %s: %s", repo.Name, receipt.URI)
+		recorder.Update(func(rec *catalog.Record) {
+			rec.Deposits = append(rec.Deposits, catalog.Deposit{Repository: repo.Name, URI: receipt.URI, DOI: receipt.DOI})
+		})
+		if receipt.DOI != "" {
+			if err := p.createTagUpdater(userClient, parent.UUID, doiTagNamespace)(ctx, receipt.DOI); err != nil {
+				logger.Warn("Error writing %s to package node (is the namespace configured in Cells?): %v", doiTagNamespace, err)
+			}
+		}
+	}
+}
+
+// deposit deposits a package into a repository.
+func (p *Preserver) deposit(ctx context.Context, repo *config.RepositoryConfig, pkg *repository.Package) (*repository.Receipt, error) {
+	depositor, err := repository.New(repo, p.envConfig.AllowInsecureTLS)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := depositor.Close(); err != nil {
+			logger.Error("Failed to close %s depositor: %v", repo.Name, err)
+		}
+	}()
+	return depositor.Deposit(ctx, pkg)
+}
+
+// packageTitle returns the ISAD(G) or Dublin Core title of a package, or its name.
+func packageTitle(parent *models.TreeNode, metadata map[string]string) string {
+	if title := metadata["isadg.title"]; title != "" {
+		return title
+	}
+	if title := metadata["dc.title"]; title != "" {
+		return title
+	}
+	return filepath.Base(parent.Path)
+}
@@ -0,0 +1,60 @@
+package preservation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// transferManifestFile is the manifest of the transfer kept in the processing directory, without the deselected
+// files, so that a resumed package compares its AIP to it.
+const transferManifestFile = "manifest-transfer.json"
+
+type resumeKey struct{}
+
+// resume is a failed package resumed from its checkpoint.
+type resume struct {
+	from       *catalog.Record
+	checkpoint *catalog.Checkpoint
+}
+
+// WithResume returns a context whose preservation resumes a failed package from its checkpoint: the stages up to the
+// checkpoint are not run again, their outputs are taken over from the failed package.
+func WithResume(ctx context.Context, from *catalog.Record, checkpoint *catalog.Checkpoint) context.Context {
+	return context.WithValue(ctx, resumeKey{}, resume{from: from, checkpoint: checkpoint})
+}
+
+// resumeFromContext returns the failed package resumed by a context and its checkpoint. The checkpoint is nil if the
+// context resumes no package.
+func resumeFromContext(ctx context.Context) (*catalog.Record, *catalog.Checkpoint) {
+	r, _ := ctx.Value(resumeKey{}).(resume)
+	return r.from, r.checkpoint
+}
+
+type retryKey struct{}
+
+// WithRetry returns a context whose preservation is attempted again if it fails with a transient error, so that the
+// outputs of the attempt are not kept to resume it.
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+// keepFailed reports whether the outputs of a failed preservation are kept so that it can be resumed: it reached a
+// checkpoint, and failed with an error that may not happen again, on its last attempt. The outputs of cancelled and
+// interrupted preservations are never kept.
+func (p *Preserver) keepFailed(ctx context.Context, recorder *catalog.Recorder, err error) bool {
+	if err == nil || stopped(ctx) || !p.envConfig.KeepFailed {
+		return false
+	}
+	if rec := recorder.Record(); rec == nil || rec.Checkpoint == nil {
+		return false
+	}
+	var permanent *utils.PermanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	retried, _ := ctx.Value(retryKey{}).(bool)
+	return !retried || !utils.IsTransientError(err)
+}
@@ -0,0 +1,166 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/limits"
+	"github.com/penwern/curate-preservation-core/internal/source"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// TransferSource connects to a transfer source. The caller is responsible for closing the client.
+func (p *Preserver) TransferSource(name string) (*source.Client, error) {
+	cfg, err := p.transferSource(name)
+	if err != nil {
+		return nil, err
+	}
+	return source.New(cfg, p.envConfig.AllowInsecureTLS, p.envConfig.Retry.Download)
+}
+
+// transferSource returns the config of a transfer source.
+func (p *Preserver) transferSource(name string) (*config.TransferSource, error) {
+	sources := p.integrations().sources
+	if sources == nil {
+		return nil, fmt.Errorf("transfer sources are not configured")
+	}
+	cfg := sources.Source(name)
+	if cfg == nil {
+		return nil, fmt.Errorf("transfer source not found: %s", name)
+	}
+	return cfg, nil
+}
+
+// PullTransfer downloads a transfer from a transfer source, verifies it and uploads it to the destination folder
+// of the source in Cells, or the intake folder of the tenant of the context. Returns the Cells path of the transfer.
+// The metadata the source has of the files, e.g. the authors of SharePoint documents, is set on the uploaded nodes,
+// and is written to the metadata of the package when it is preserved.
+// Transfers are staged under a path derived from the source and transfer path, so an interrupted pull resumes.
+func (p *Preserver) PullTransfer(ctx context.Context, userClient cells.UserClient, sourceName, transferPath string) (string, error) {
+	// The transfers of a tenant are pulled to its intake folder, under its paths
+	tenant, err := p.tenant(ctx)
+	if err != nil {
+		return "", err
+	}
+	if tenant != nil && tenant.IntakeFolder == "" {
+		return "", fmt.Errorf("%w: tenant %s has no intake folder", ErrTenantAccess, tenant.Name)
+	}
+	sourceCfg, err := p.transferSource(sourceName)
+	if err != nil {
+		return "", err
+	}
+	client, err := source.New(sourceCfg, p.envConfig.AllowInsecureTLS, p.envConfig.Retry.Download)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	stagingDir := filepath.Join(p.envConfig.ProcessingBaseDir, "sources", sourceName, filepath.FromSlash(path.Dir(path.Clean("/"+transferPath))))
+	logger.Info("Pulling %s from %s", transferPath, sourceName)
+	release, err := p.limits.Acquire(ctx, limits.Download)
+	if err != nil {
+		return "", err
+	}
+	transfer, err := client.Download(ctx, transferPath, stagingDir)
+	release()
+	if err != nil {
+		return "", err
+	}
+
+	cellsPath, err := p.cellsClient.UploadNode(ctx, userClient, transfer.LocalPath, pullDestination(sourceCfg, tenant))
+	if err != nil {
+		return "", fmt.Errorf("error uploading transfer: %w", err)
+	}
+	resolvedPath, err := p.cellsClient.ResolveCellsPath(userClient, cellsPath)
+	if err != nil {
+		return "", fmt.Errorf("error resolving upload path: %w", err)
+	}
+	if _, err := p.getNodeStats(ctx, resolvedPath); err != nil {
+		return "", err
+	}
+	if len(transfer.Metadata) > 0 {
+		if err := p.setTransferMetadata(ctx, userClient, resolvedPath, transfer.Metadata); err != nil {
+			return "", fmt.Errorf("error setting transfer metadata: %w", err)
+		}
+	}
+	logger.Info("Pulled %s from %s to %s", transferPath, sourceName, cellsPath)
+
+	if p.envConfig.Cleanup {
+		if err := os.RemoveAll(transfer.LocalPath); err != nil {
+			logger.Error("Failed to remove staged transfer: %v", err)
+		}
+	}
+	return cellsPath, nil
+}
+
+// PlanPullTransfer is a dry run of PullTransfer: it checks that a transfer exists in a transfer source and returns the
+// actions pulling it would take, without downloading it.
+func (p *Preserver) PlanPullTransfer(ctx context.Context, sourceName, transferPath string) ([]PlannedAction, error) {
+	tenant, err := p.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil && tenant.IntakeFolder == "" {
+		return nil, fmt.Errorf("%w: tenant %s has no intake folder", ErrTenantAccess, tenant.Name)
+	}
+	sourceCfg, err := p.transferSource(sourceName)
+	if err != nil {
+		return nil, err
+	}
+	client, err := source.New(sourceCfg, p.envConfig.AllowInsecureTLS, p.envConfig.Retry.Download)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	entry, err := client.Stat(ctx, transferPath)
+	if err != nil {
+		return nil, err
+	}
+	download := fmt.Sprintf("Download %s from %s", transferPath, sourceName)
+	if !entry.IsDir && entry.Size >= 0 {
+		download += fmt.Sprintf(" (%d bytes)", entry.Size)
+	}
+	return []PlannedAction{
+		{Stage: catalog.EventDownload, Action: download},
+		{Stage: catalog.EventFixity, Action: "Verify the files against their checksum files"},
+		{Stage: catalog.EventStorage, Action: "Upload transfer to Cells: " + pullDestination(sourceCfg, tenant)},
+	}, nil
+}
+
+// pullDestination returns the Cells folder transfers are pulled to: the destination of the source, or the intake folder
+// of the tenant.
+func pullDestination(sourceCfg *config.TransferSource, tenant *config.Tenant) string {
+	if tenant != nil {
+		return tenant.IntakeFolder
+	}
+	return sourceCfg.Destination
+}
+
+// setTransferMetadata sets the metadata of an uploaded transfer on its nodes, as the Cells user metadata the package
+// metadata is read from (e.g. dc.creator is set as usermeta-dc-creator).
+func (p *Preserver) setTransferMetadata(ctx context.Context, userClient cells.UserClient, resolvedPath string, metadata map[string]map[string]string) error {
+	collection, err := p.cellsClient.GetNodeCollection(ctx, resolvedPath)
+	if err != nil {
+		return err
+	}
+	set := 0
+	for _, node := range append(collection.Children, collection.Parent) {
+		name := strings.Trim(strings.TrimPrefix(node.Path, collection.Parent.Path), "/")
+		for key, value := range metadata[name] {
+			namespace := "usermeta-" + strings.ReplaceAll(key, ".", "-")
+			if err := p.cellsClient.UpdateTag(ctx, userClient, node.UUID, namespace, value); err != nil {
+				return err
+			}
+			set++
+		}
+	}
+	logger.Debug("Set %d metadata values on %s", set, resolvedPath)
+	return nil
+}
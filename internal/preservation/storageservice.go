@@ -0,0 +1,146 @@
+package preservation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/storageservice"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// StorageServiceClient returns a client for the Archivematica Storage Service.
+// The caller is responsible for closing the client.
+func (p *Preserver) StorageServiceClient() (*storageservice.Client, error) {
+	storageService := p.integrations().storageService
+	if storageService == nil {
+		return nil, fmt.Errorf("the Storage Service is not configured")
+	}
+	return storageservice.NewClient(storageService, p.envConfig.AllowInsecureTLS)
+}
+
+// MirrorAIP fetches an AIP from the Storage Service, verifying its fixity before and its size after the download,
+// and uploads it to the archive workspace of the user. Returns the Cells path of the mirrored AIP.
+func (p *Preserver) MirrorAIP(ctx context.Context, userClient cells.UserClient, aipUUID string) (string, error) {
+	client, err := p.StorageServiceClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	pkg, err := storedAIP(ctx, client, aipUUID)
+	if err != nil {
+		return "", err
+	}
+
+	// Ask the Storage Service to verify the AIP before copying it
+	fixity, err := client.CheckFixity(ctx, aipUUID)
+	if err != nil {
+		return "", err
+	}
+	if !fixity.Success {
+		return "", fmt.Errorf("AIP %s failed fixity check in the Storage Service: %s", aipUUID, fixity.Message)
+	}
+	logger.Info("Storage Service verified AIP %s", aipUUID)
+
+	processingDir := filepath.Join(p.envConfig.ProcessingBaseDir, "storage_service", utils.NewUUID())
+	if err := utils.CreateDir(processingDir); err != nil {
+		return "", fmt.Errorf("failed to create processing directory: %w", err)
+	}
+	if p.envConfig.Cleanup {
+		defer func() {
+			if err := os.RemoveAll(processingDir); err != nil {
+				logger.Error("Failed to remove processing directory: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Downloading AIP %s from the Storage Service", aipUUID)
+	var aipPath string
+	err = utils.WithRetry(func() error {
+		var downloadErr error
+		aipPath, downloadErr = client.Download(ctx, pkg, processingDir)
+		return downloadErr
+	})
+	if err != nil {
+		return "", err
+	}
+
+	cellsUploadPath, err := p.uploadPackage(ctx, userClient, aipPath)
+	if err != nil {
+		return "", fmt.Errorf("error uploading AIP: %w", err)
+	}
+	resolvedUploadPath, err := p.cellsClient.ResolveCellsPath(userClient, cellsUploadPath)
+	if err != nil {
+		return "", fmt.Errorf("error resolving upload path: %w", err)
+	}
+	if _, err := p.getNodeStats(ctx, resolvedUploadPath); err != nil {
+		return "", err
+	}
+	logger.Info("Mirrored AIP %s to %s", aipUUID, resolvedUploadPath)
+	return cellsUploadPath, nil
+}
+
+// PlanMirrorAIP is a dry run of MirrorAIP: it checks that an AIP is stored in the Storage Service and returns the
+// actions mirroring it would take, without requesting a fixity check or downloading it.
+func (p *Preserver) PlanMirrorAIP(ctx context.Context, aipUUID string) ([]PlannedAction, error) {
+	client, err := p.StorageServiceClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	pkg, err := storedAIP(ctx, client, aipUUID)
+	if err != nil {
+		return nil, err
+	}
+	return []PlannedAction{
+		{Stage: catalog.EventFixity, Action: "Check the fixity of AIP " + aipUUID + " in the Storage Service"},
+		{Stage: catalog.EventDownload, Action: fmt.Sprintf("Download AIP from the Storage Service: %s (%d bytes)", pkg.Name(), pkg.Size)},
+		{Stage: catalog.EventStorage, Action: "Upload AIP to Cells: " + p.envConfig.Cells.ArchiveWorkspace},
+	}, nil
+}
+
+// storedAIP returns the package of an AIP stored in the Storage Service, or an error if the package is not a stored AIP.
+func storedAIP(ctx context.Context, client *storageservice.Client, aipUUID string) (*storageservice.Package, error) {
+	pkg, err := client.GetPackage(ctx, aipUUID)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.PackageType != storageservice.PackageTypeAIP {
+		return nil, fmt.Errorf("package %s is not an AIP: %s", aipUUID, pkg.PackageType)
+	}
+	if pkg.Status != storageservice.StatusUploaded {
+		return nil, fmt.Errorf("AIP %s is not stored: %s", aipUUID, pkg.Status)
+	}
+	return pkg, nil
+}
+
+// registerInStorageService registers a stored AIP with the Storage Service if registration is enabled.
+// The AIP is already preserved at this point, so failures are recorded and logged, not returned.
+func (p *Preserver) registerInStorageService(ctx context.Context, aipUUID, aipPath string, recorder *catalog.Recorder) {
+	storageService := p.integrations().storageService
+	if storageService == nil || !storageService.Register {
+		return
+	}
+	finishEvent := recorder.Start(catalog.EventStorage, "Register AIP in the Storage Service")
+	client, err := p.StorageServiceClient()
+	if err != nil {
+		finishEvent(err)
+		logger.Error("Error creating Storage Service client: %v", err)
+		return
+	}
+	defer client.Close()
+
+	err = client.RegisterAIP(ctx, aipUUID, aipPath)
+	finishEvent(err)
+	if err != nil {
+		logger.Error("Error registering AIP in the Storage Service: %v", err)
+		return
+	}
+	logger.Info("Registered AIP %s in the Storage Service", aipUUID)
+}
@@ -0,0 +1,76 @@
+package preservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// ErrTenantAccess is returned when a tenant requests a package, profile or upload that is not its own.
+var ErrTenantAccess = utils.Classify(utils.ErrPolicy, errors.New("not accessible to the tenant"))
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose preservations, uploads and jobs belong to a tenant. An empty name leaves them
+// to the service, unrestricted.
+func WithTenant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// TenantFromContext returns the tenant of a context, or an empty string if it has none.
+func TenantFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(tenantKey{}).(string)
+	return name
+}
+
+// Tenants returns the tenants of the service. Returns nil if tenants are not configured.
+func (p *Preserver) Tenants() *config.TenantsConfig {
+	return p.tenants
+}
+
+// tenant returns the tenant of a context, or nil if it has none. Returns ErrTenantAccess if the tenant is not
+// configured, so that the requests of a removed tenant are refused rather than left unrestricted.
+func (p *Preserver) tenant(ctx context.Context) (*config.Tenant, error) {
+	name := TenantFromContext(ctx)
+	if name == "" {
+		return nil, nil
+	}
+	tenant := p.tenants.Tenant(name)
+	if tenant == nil {
+		return nil, fmt.Errorf("%w: unknown tenant %s", ErrTenantAccess, name)
+	}
+	return tenant, nil
+}
+
+// tenantPrefixes returns the function giving the storage prefix of the tenant an AIP belongs to, from the package
+// records. The records are read once, on the first call. Returns nil if tenants are not configured.
+func (p *Preserver) tenantPrefixes() func(aipUUID string) string {
+	if p.tenants == nil || p.catalog == nil {
+		return nil
+	}
+	var (
+		once     sync.Once
+		prefixes map[string]string
+	)
+	return func(aipUUID string) string {
+		once.Do(func() {
+			prefixes = map[string]string{}
+			records, err := p.catalog.List()
+			if err != nil {
+				logger.Error("Error listing package records: %v", err)
+				return
+			}
+			for _, rec := range records {
+				if tenant := p.tenants.Tenant(rec.Tenant); tenant != nil && rec.AIPUUID != "" {
+					prefixes[rec.AIPUUID] = tenant.Prefix()
+				}
+			}
+		})
+		return prefixes[aipUUID]
+	}
+}
@@ -0,0 +1,86 @@
+package preservation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	transferservice "github.com/penwern/curate-preservation-core/common/proto/a3m/gen/go/a3m/api/transferservice/v1beta1"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+)
+
+// a3mEventType maps an A3M job group (microservice group) to a timeline event type.
+func a3mEventType(group string) string {
+	g := strings.ToLower(group)
+	switch {
+	case strings.Contains(g, "identif"):
+		return catalog.EventIdentification
+	case strings.Contains(g, "characteri"):
+		return catalog.EventCharacterization
+	case strings.Contains(g, "normaliz"):
+		return catalog.EventNormalization
+	case strings.Contains(g, "extract"):
+		return catalog.EventExtraction
+	case strings.Contains(g, "virus"):
+		return catalog.EventVirusScan
+	case strings.Contains(g, "checksum"), strings.Contains(g, "fixity"):
+		return catalog.EventFixity
+	case strings.Contains(g, "dip"), strings.Contains(g, "access"):
+		return catalog.EventDissemination
+	case strings.Contains(g, "store"):
+		return catalog.EventStorage
+	case strings.Contains(g, "aip"), strings.Contains(g, "bag"), strings.Contains(g, "compress"):
+		return catalog.EventPackaging
+	default:
+		return catalog.EventProcessing
+	}
+}
+
+// a3mEvents converts the jobs reported by A3M into timeline events.
+// Consecutive jobs of the same group are aggregated into a single event lasting until the next group starts.
+func a3mEvents(jobs []*transferservice.Job, finishedAt time.Time) []catalog.Event {
+	var events []catalog.Event
+	var group string
+	var count, failed int
+	var start time.Time
+
+	jobs = append([]*transferservice.Job(nil), jobs...)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].GetStartTime().AsTime().Before(jobs[j].GetStartTime().AsTime())
+	})
+
+	flush := func(end time.Time) {
+		if count == 0 {
+			return
+		}
+		event := catalog.Event{
+			Time:    start,
+			Type:    a3mEventType(group),
+			Outcome: catalog.OutcomeSuccess,
+			Detail:  fmt.Sprintf("a3m: %s (%d jobs)", group, count),
+		}
+		if !end.IsZero() && end.After(start) {
+			event.DurationMs = end.Sub(start).Milliseconds()
+		}
+		if failed > 0 {
+			event.Outcome = catalog.OutcomeFailure
+			event.Detail = fmt.Sprintf("a3m: %s (%d of %d jobs failed)", group, failed, count)
+		}
+		events = append(events, event)
+	}
+
+	for _, job := range jobs {
+		jobStart := job.GetStartTime().AsTime().UTC()
+		if count == 0 || job.GetGroup() != group {
+			flush(jobStart)
+			group, count, failed, start = job.GetGroup(), 0, 0, jobStart
+		}
+		count++
+		if job.GetStatus() == transferservice.Job_STATUS_FAILED {
+			failed++
+		}
+	}
+	flush(finishedAt)
+	return events
+}
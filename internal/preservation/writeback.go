@@ -0,0 +1,52 @@
+package preservation
+
+import (
+	"context"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// Metadata namespaces holding the preservation status of a package in Cells.
+const (
+	aipUUIDTagNamespace          = "usermeta-aip-uuid"
+	preservationDateTagNamespace = "usermeta-preservation-date"
+	fixityTagNamespace           = "usermeta-fixity-status"
+	doiTagNamespace              = "usermeta-doi"
+)
+
+// Fixity statuses written to the package node.
+const (
+	fixityTagVerified   = "✅ Verified"
+	fixityTagWarning    = "⚠️ Verified with warnings"
+	fixityTagFailed     = "❌ Failed"
+	fixityTagNotChecked = "Not checked"
+)
+
+// writePreservationMetadata writes the AIP UUID, preservation date and fixity status to the package node in Cells,
+// so users see the preservation state of their packages in the Cells UI.
+// The namespaces are optional, so failures are logged and not returned.
+func (p *Preserver) writePreservationMetadata(ctx context.Context, userClient cells.UserClient, nodeUUID, aipUUID string, recorder *catalog.Recorder) {
+	fixityStatus := fixityTagNotChecked
+	switch recorder.Outcome(catalog.EventFixity) {
+	case catalog.OutcomeSuccess:
+		fixityStatus = fixityTagVerified
+	case catalog.OutcomeWarning:
+		fixityStatus = fixityTagWarning
+	case catalog.OutcomeFailure:
+		fixityStatus = fixityTagFailed
+	}
+
+	tags := []struct{ namespace, value string }{
+		{aipUUIDTagNamespace, aipUUID},
+		{preservationDateTagNamespace, time.Now().UTC().Format(time.RFC3339)},
+		{fixityTagNamespace, fixityStatus},
+	}
+	for _, tag := range tags {
+		if err := p.createTagUpdater(userClient, nodeUUID, tag.namespace)(ctx, tag.value); err != nil {
+			logger.Warn("Error writing %s to package node (is the namespace configured in Cells?): %v", tag.namespace, err)
+		}
+	}
+}
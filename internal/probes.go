@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/penwern/curate-preservation-core/internal/a3mclient"
+	"github.com/penwern/curate-preservation-core/internal/aipstore"
+	"github.com/penwern/curate-preservation-core/internal/atom"
+	"github.com/penwern/curate-preservation-core/internal/cells"
+	"github.com/penwern/curate-preservation-core/internal/health"
+	"github.com/penwern/curate-preservation-core/internal/storageservice"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// ProbeChecks returns the reachability checks of the services of a configuration: a3m, Cells, and AtoM, the Storage
+// Service and the AIP storage locations when their files are configured. Unlike the readiness checks, no service is
+// created, so that unreachable services are reported instead of stopping the startup.
+func ProbeChecks(cfg *config.Config, files []config.File) []health.Check {
+	checks := []health.Check{
+		{Name: "a3m", Run: func(ctx context.Context) (string, error) {
+			client, err := a3mclient.NewClient(cfg.A3M.Address)
+			if err != nil {
+				return "", err
+			}
+			defer client.Close()
+			return cfg.A3M.Address, client.Ping(ctx)
+		}},
+		{Name: "cells", Run: func(ctx context.Context) (string, error) {
+			return cfg.Cells.Address, cells.Ping(ctx, cfg.Cells.Address, cfg.Cells.AdminToken, cfg.AllowInsecureTLS)
+		}},
+	}
+	for _, file := range files {
+		switch c := file.Config.(type) {
+		case *config.AtomConfig:
+			checks = append(checks, health.Check{Name: "atom", Run: func(ctx context.Context) (string, error) {
+				client, err := atom.NewAPIClient(c)
+				if err != nil {
+					return "", err
+				}
+				defer client.Close()
+				return c.Host, client.Ping(ctx)
+			}})
+		case *config.StorageServiceConfig:
+			checks = append(checks, health.Check{Name: "storage_service", Run: func(ctx context.Context) (string, error) {
+				client, err := storageservice.NewClient(c, cfg.AllowInsecureTLS)
+				if err != nil {
+					return "", err
+				}
+				defer client.Close()
+				return c.URL, client.Ping(ctx)
+			}})
+		case *config.AIPStorageConfig:
+			for _, location := range c.Locations {
+				checks = append(checks, health.Check{Name: "storage:" + location.Name, Run: func(ctx context.Context) (string, error) {
+					store, err := aipstore.New(location, cfg.AllowInsecureTLS, cfg.Retry.Storage)
+					if err != nil {
+						return "", err
+					}
+					defer store.Close()
+					return location.Backend, store.Ping(ctx)
+				}})
+			}
+		}
+	}
+	return checks
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// problemTypeValidation is the type of the problems of requests with invalid fields.
+const problemTypeValidation = "https://github.com/penwern/curate-preservation-core#validation-errors"
+
+// Problem is an RFC 7807 problem details response, with the errors of the invalid fields of the request.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is the error of a field of a request.
+type FieldError struct {
+	Field   string `json:"field"`   // JSON path of the field, e.g. preservationCfg.pii_scan.patterns[0]
+	Rule    string `json:"rule"`    // Rule the field breaks, e.g. required or oneof
+	Message string `json:"message"` // e.g. "must be one of warn, strict, off"
+}
+
+// ValidationError is the error of a request with invalid fields.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + " " + fe.Message
+	}
+	return "invalid fields: " + strings.Join(msgs, "; ")
+}
+
+// Is matches the validation failure class.
+func (e *ValidationError) Is(target error) bool {
+	return target == utils.ErrValidation
+}
+
+// add adds the error of a field.
+func (e *ValidationError) add(field, rule, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Rule: rule, Message: message})
+}
+
+// err returns the error, or nil if no field is invalid.
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// requestValidator validates requests with the validate tags of their fields, named after their JSON names.
+var requestValidator = newRequestValidator()
+
+func newRequestValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// validateFields returns the errors of the fields of a request that break the rules of their validate tags.
+func validateFields(req any) *ValidationError {
+	verr := &ValidationError{}
+	var errs validator.ValidationErrors
+	if err := requestValidator.Struct(req); errors.As(err, &errs) {
+		for _, fe := range errs {
+			// The namespace starts with the name of the request type
+			_, field, _ := strings.Cut(fe.Namespace(), ".")
+			verr.add(field, fe.Tag(), ruleMessage(fe))
+		}
+	}
+	return verr
+}
+
+// ruleMessage returns the message of a field that breaks a validation rule.
+func ruleMessage(fe validator.FieldError) string {
+	sized := fe.Kind() == reflect.Slice || fe.Kind() == reflect.Map || fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required", "required_if", "required_unless", "required_with", "required_without":
+		return "is required"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min", "gte":
+		if sized {
+			return "must have at least " + fe.Param() + " elements"
+		}
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		if sized {
+			return "must have at most " + fe.Param() + " elements"
+		}
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	case "url", "http_url":
+		return "must be a URL"
+	case "email":
+		return "must be an email address"
+	default:
+		return fmt.Sprintf("does not satisfy the %s rule", fe.Tag())
+	}
+}
+
+// writeProblem responds with the problem details of an invalid request: the field errors of a *ValidationError or
+// of a JSON value of the wrong type, or the message of any other error.
+func writeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(http.StatusBadRequest),
+		Status:   http.StatusBadRequest,
+		Detail:   err.Error(),
+		Instance: r.URL.Path,
+	}
+	var verr *ValidationError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &verr):
+		problem.Type = problemTypeValidation
+		problem.Title = "Invalid request"
+		problem.Errors = verr.Errors
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		problem.Type = problemTypeValidation
+		problem.Title = "Invalid request"
+		problem.Errors = []FieldError{{Field: typeErr.Field, Rule: "type", Message: "must be " + jsonType(typeErr.Type)}}
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write response: %v", err))
+	}
+}
+
+// jsonType returns the JSON type a Go type is decoded from, with its article.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
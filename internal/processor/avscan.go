@@ -0,0 +1,209 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// clamdChunkSize is the size of the chunks streamed to clamd.
+const clamdChunkSize = 64 << 10
+
+// ErrInfected is returned when the virus scan finds infected files.
+var ErrInfected = utils.Classify(utils.ErrPolicy, errors.New("virus scan failed"))
+
+// ScanForViruses streams every file in a directory to a ClamAV daemon using the INSTREAM command.
+// The address is either tcp://host:port or unix:///path/to/clamd.sock.
+// Returns an error listing the infected files if any signature is found.
+func ScanForViruses(ctx context.Context, address, dir string) error {
+	if address == "" {
+		return fmt.Errorf("virus scanning requested but no ClamAV address is configured")
+	}
+
+	var infected []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		result, err := clamdScanFile(ctx, address, path)
+		if err != nil {
+			return fmt.Errorf("error scanning %s: %w", path, err)
+		}
+		if result != "" {
+			logger.Warn("Virus found in %s: %s", path, result)
+			rel, relErr := filepath.Rel(dir, path)
+			if relErr != nil {
+				rel = path
+			}
+			infected = append(infected, fmt.Sprintf("%s (%s)", rel, result))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(infected) > 0 {
+		return fmt.Errorf("%w: %s", ErrInfected, strings.Join(infected, ", "))
+	}
+	return nil
+}
+
+// clamdScanFile scans a single file. Returns the signature name if the file is infected.
+func clamdScanFile(ctx context.Context, address, path string) (string, error) {
+	conn, err := dialClamd(ctx, address)
+	if err != nil {
+		return "", err
+	}
+	defer closeClamd(conn)
+
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("error sending command: %w", err)
+	}
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := file.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n)) // #nosec G115 -- n is bounded by clamdChunkSize
+			if _, err := conn.Write(size); err != nil {
+				return "", fmt.Errorf("error streaming file: %w", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return "", fmt.Errorf("error streaming file: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", fmt.Errorf("error reading file: %w", readErr)
+		}
+	}
+	// Zero length chunk terminates the stream
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", fmt.Errorf("error terminating stream: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("error reading reply: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+
+	switch {
+	case strings.HasSuffix(reply, "OK"):
+		return "", nil
+	case strings.HasSuffix(reply, "FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return signature, nil
+	default:
+		return "", fmt.Errorf("unexpected clamd reply: %s", reply)
+	}
+}
+
+// ReloadSignatures asks the ClamAV daemon to reload its signature database, e.g. after freshclam updated it.
+func ReloadSignatures(ctx context.Context, address string) error {
+	if address == "" {
+		return fmt.Errorf("no ClamAV address is configured")
+	}
+	conn, err := dialClamd(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer closeClamd(conn)
+	if _, err := conn.Write([]byte("zRELOAD\x00")); err != nil {
+		return fmt.Errorf("error sending command: %w", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("error reading reply: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	if reply != "RELOADING" {
+		return fmt.Errorf("unexpected clamd reply: %s", reply)
+	}
+	return nil
+}
+
+// dialClamd connects to a ClamAV daemon, at tcp://host:port, host:port or unix:///path/to/clamd.sock.
+// The connection deadline is the deadline of the context.
+func dialClamd(ctx context.Context, address string) (net.Conn, error) {
+	network, addr := "tcp", address
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		network, addr = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		addr = strings.TrimPrefix(address, "tcp://")
+	}
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to clamd: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+func closeClamd(conn net.Conn) {
+	if err := conn.Close(); err != nil {
+		logger.Error("Failed to close clamd connection: %v", err)
+	}
+}
+
+// ClamdVersion returns the version of a ClamAV daemon and of its signature database, e.g.
+// "ClamAV 1.3.1/27410/Mon Sep 30 08:34:57 2024".
+func ClamdVersion(ctx context.Context, address string) (string, error) {
+	if address == "" {
+		return "", fmt.Errorf("no ClamAV address is configured")
+	}
+	conn, err := dialClamd(ctx, address)
+	if err != nil {
+		return "", err
+	}
+	defer closeClamd(conn)
+	if _, err := conn.Write([]byte("zVERSION\x00")); err != nil {
+		return "", fmt.Errorf("error sending command: %w", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("error reading reply: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	if !strings.HasPrefix(reply, "ClamAV") {
+		return "", fmt.Errorf("unexpected clamd reply: %s", reply)
+	}
+	return reply, nil
+}
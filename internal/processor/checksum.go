@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// WriteChecksumFiles writes a3m transfer checksum files (metadata/checksum.<algorithm>) for the data in a transfer.
+// a3m verifies the transfer against these files before processing.
+// Paths are written relative to the metadata directory, as expected by the a3m checksum verification job.
+// progress, if not nil, is called after each file is hashed, with its path relative to the data directory and the
+// checksums computed out of the total.
+func WriteChecksumFiles(transferDir string, algorithms []string, progress func(file string, completed, total int)) error {
+	if len(algorithms) == 0 {
+		return nil
+	}
+
+	dataDir := filepath.Join(transferDir, "data")
+	var files []string
+	if err := filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("error walking transfer data: %w", err)
+	}
+	sort.Strings(files)
+
+	metadataDir := filepath.Join(transferDir, "metadata")
+	if err := utils.CreateDir(metadataDir); err != nil {
+		return err
+	}
+
+	completed, total := 0, len(files)*len(algorithms)
+	for _, algorithm := range algorithms {
+		var sb strings.Builder
+		for _, file := range files {
+			sum, err := utils.FileChecksum(file, algorithm)
+			if err != nil {
+				return fmt.Errorf("error computing %s checksum for %s: %w", algorithm, file, err)
+			}
+			completed++
+			if progress != nil {
+				progress(utils.RelPath(dataDir, file), completed, total)
+			}
+			rel, err := filepath.Rel(metadataDir, file)
+			if err != nil {
+				return fmt.Errorf("error computing relative path: %w", err)
+			}
+			fmt.Fprintf(&sb, "%s  %s\n", sum, filepath.ToSlash(rel))
+		}
+		checksumPath := filepath.Join(metadataDir, "checksum."+strings.ToLower(algorithm))
+		if err := os.WriteFile(checksumPath, []byte(sb.String()), 0o600); err != nil {
+			return fmt.Errorf("error writing checksum file: %w", err)
+		}
+		logger.Debug("Wrote %s checksums for %d files", algorithm, len(files))
+	}
+	return nil
+}
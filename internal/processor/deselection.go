@@ -0,0 +1,230 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/premis"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+	"github.com/pydio/cells-sdk-go/v4/models"
+)
+
+const (
+	// appraisalTagNamespace flags a node for removal during appraisal when set to "deselect".
+	appraisalTagNamespace = "usermeta-appraisal"
+	// appraisalDeselectNamespace holds deselection patterns on the package node, as a JSON array or comma/newline separated.
+	appraisalDeselectNamespace = "usermeta-appraisal-deselect"
+	// deselectionFileName is the name of the deselection list written to the transfer metadata.
+	deselectionFileName = "deselection.json"
+)
+
+// Deselection records a file removed from a transfer during appraisal.
+type Deselection struct {
+	Path    string    `json:"path"` // Slash separated, relative to the transfer data directory
+	Pattern string    `json:"pattern"`
+	Size    int64     `json:"size"`
+	Time    time.Time `json:"time"`
+}
+
+// deselectionPatterns collects the deselection patterns flagged on the package in Cells.
+// Patterns are read from the package node's deselection list and from child nodes tagged for deselection.
+func deselectionPatterns(nodesCollection *models.RestNodesCollection) []string {
+	if nodesCollection == nil || nodesCollection.Parent == nil {
+		return nil
+	}
+	var patterns []string
+	if raw := strings.Trim(nodesCollection.Parent.MetaStore[appraisalDeselectNamespace], `"\ `); raw != "" {
+		var list []string
+		if err := json.Unmarshal([]byte(nodesCollection.Parent.MetaStore[appraisalDeselectNamespace]), &list); err == nil {
+			patterns = append(patterns, list...)
+		} else {
+			for _, p := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' }) {
+				patterns = append(patterns, strings.TrimSpace(p))
+			}
+		}
+	}
+	for _, node := range nodesCollection.Children {
+		if strings.Trim(node.MetaStore[appraisalTagNamespace], `"\ `) != "deselect" {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(node.Path, nodesCollection.Parent.Path), "/")
+		if rel != "" {
+			patterns = append(patterns, rel)
+		}
+	}
+	return patterns
+}
+
+// applyDeselection removes the files and directories matching the deselection patterns from the package root.
+// Patterns are slash separated paths or glob patterns relative to the package root.
+// Patterns without a slash also match base names at any depth. A matching directory is removed with its contents.
+// Returns the removed files and the set of removed paths (files and directories) relative to the data directory.
+// Matching paths are only recorded if remove is false.
+func applyDeselection(dataDir, packageRoot string, patterns []string, remove bool) ([]Deselection, map[string]bool, error) {
+	removed := map[string]bool{}
+	if len(patterns) == 0 {
+		return nil, removed, nil
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, nil, fmt.Errorf("invalid deselection pattern %q: %w", pattern, err)
+		}
+	}
+
+	var deselections []Deselection
+	now := time.Now().UTC()
+	err := filepath.WalkDir(packageRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == packageRoot {
+			return nil
+		}
+		rel, err := filepath.Rel(packageRoot, p)
+		if err != nil {
+			return err
+		}
+		pattern := matchDeselection(filepath.ToSlash(rel), patterns)
+		if pattern == "" {
+			return nil
+		}
+
+		// Record every file removed, including those within a removed directory
+		if err := filepath.WalkDir(p, func(sp string, sd fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			dataRel, err := filepath.Rel(dataDir, sp)
+			if err != nil {
+				return err
+			}
+			removed[filepath.ToSlash(dataRel)] = true
+			if !sd.Type().IsRegular() {
+				return nil
+			}
+			info, err := sd.Info()
+			if err != nil {
+				return err
+			}
+			deselections = append(deselections, Deselection{
+				Path:    filepath.ToSlash(dataRel),
+				Pattern: pattern,
+				Size:    info.Size(),
+				Time:    now,
+			})
+			return nil
+		}); err != nil {
+			return err
+		}
+		if remove {
+			logger.Info("Deselecting %s (pattern: %s)", filepath.ToSlash(rel), pattern)
+			if err := os.RemoveAll(p); err != nil {
+				return fmt.Errorf("error removing %s: %w", p, err)
+			}
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error applying deselection: %w", err)
+	}
+	return deselections, removed, nil
+}
+
+// PlanDeselection returns the files that preprocessing would deselect from the package root, for the deselection
+// patterns flagged on the package in Cells and the given patterns. Nothing is removed. Paths are relative to the
+// data directory, as in the deselection list of the transfer.
+func PlanDeselection(dataDir, packageRoot string, nodesCollection *models.RestNodesCollection, deselect []string) ([]Deselection, error) {
+	deselections, _, err := applyDeselection(dataDir, packageRoot, append(deselectionPatterns(nodesCollection), deselect...), false)
+	return deselections, err
+}
+
+// matchDeselection returns the first pattern matching the relative path, or an empty string.
+func matchDeselection(rel string, patterns []string) string {
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return pattern
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
+// writeDeselectionList writes the list of deselected files to the transfer metadata directory.
+func writeDeselectionList(metadataDir string, deselections []Deselection) error {
+	data, err := json.MarshalIndent(deselections, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling deselection list: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(metadataDir, deselectionFileName), data, 0o600); err != nil {
+		return fmt.Errorf("error writing deselection list: %w", err)
+	}
+	return nil
+}
+
+// deselectionPremis constructs a PREMIS object and deselection event for every deselected file.
+// Objects are identified by their Cells node UUID when known, otherwise by their original path.
+func deselectionPremis(premisAgents []premis.Agent, deselections []Deselection, nodesByPath map[string]*models.TreeNode) ([]premis.Object, []premis.Event) {
+	objects := make([]premis.Object, 0, len(deselections))
+	events := make([]premis.Event, 0, len(deselections))
+	for _, deselection := range deselections {
+		objectPath := path.Join("objects/data", deselection.Path)
+		objectIdentifier := premis.ObjectIdentifier{IdentifierType: "Original Path", IdentifierValue: objectPath}
+		var formatName string
+		if node, ok := nodesByPath[objectPath]; ok && node.UUID != "" {
+			objectIdentifier = premis.ObjectIdentifier{IdentifierType: "UUID", IdentifierValue: node.UUID}
+			formatName = strings.Trim(node.MetaStore["mime"], "\"")
+		}
+
+		eventIdentifier := premis.EventIdentifier{IdentifierType: "UUID", IdentifierValue: utils.NewUUID()}
+		event := premis.Event{
+			EventIdentifier: eventIdentifier,
+			EventType:       "deselection",
+			EventDateTime:   deselection.Time.Format(time.RFC3339),
+			EventDetailInformation: premis.EventDetailInformation{
+				EventDetail: fmt.Sprintf("Removed from transfer during appraisal (pattern: %s)", deselection.Pattern),
+			},
+			EventOutcomeInformation: premis.EventOutcomeInformation{
+				EventOutcome: "success",
+				EventOutcomeDetail: premis.EventOutcomeDetail{
+					EventOutcomeDetailNote: fmt.Sprintf("Removed %s (%d bytes)", objectPath, deselection.Size),
+				},
+			},
+			LinkingObjectIdentifiers: []premis.LinkingObjectIdentifier{
+				{ObjectIdentifierType: objectIdentifier.IdentifierType, ObjectIdentifierValue: objectIdentifier.IdentifierValue},
+			},
+		}
+		for _, premisAgent := range premisAgents {
+			event.LinkingAgentIdentifiers = append(event.LinkingAgentIdentifiers, premis.LinkingAgentIdentifier(premisAgent.AgentIdentifier))
+		}
+
+		objects = append(objects, premis.Object{
+			XSIType:          "premis:file",
+			ObjectIdentifier: objectIdentifier,
+			ObjectCharacteristics: premis.ObjectCharacteristics{
+				Format: premis.Format{FormatDesignation: premis.FormatDesignation{FormatName: formatName}},
+			},
+			OriginalName:            objectPath,
+			LinkingEventIdentifiers: []premis.LinkingEventIdentifier{premis.LinkingEventIdentifier(eventIdentifier)},
+		})
+		events = append(events, event)
+	}
+	return objects, events
+}
@@ -0,0 +1,235 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// sniffLength is the number of bytes read to identify the format of a file, as used by http.DetectContentType.
+const sniffLength = 512
+
+// Format is a file format found in a package, with the number and size of its files.
+type Format struct {
+	Extension string `json:"extension,omitempty"` // Lower case, with the dot
+	MIMEType  string `json:"mime_type"`
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// IdentifyFormats identifies the formats of the files under root, or of root if it is a file, from their content
+// signature, or their extension when the signature is not recognized. It is a quick preview of the identification of
+// A3M, which uses the PRONOM registry. Formats are sorted by number of files, then by extension.
+func IdentifyFormats(ctx context.Context, root string) ([]Format, error) {
+	formats := map[Format]*Format{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mimeType, err := detectMIMEType(p)
+		if err != nil {
+			return err
+		}
+		key := Format{Extension: strings.ToLower(filepath.Ext(p)), MIMEType: mimeType}
+		format, ok := formats[key]
+		if !ok {
+			format = &key
+			formats[key] = format
+		}
+		format.Files++
+		format.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	identified := make([]Format, 0, len(formats))
+	for _, format := range formats {
+		identified = append(identified, *format)
+	}
+	sort.Slice(identified, func(i, j int) bool {
+		if identified[i].Files != identified[j].Files {
+			return identified[i].Files > identified[j].Files
+		}
+		if identified[i].Extension != identified[j].Extension {
+			return identified[i].Extension < identified[j].Extension
+		}
+		return identified[i].MIMEType < identified[j].MIMEType
+	})
+	return identified, nil
+}
+
+// detectMIMEType returns the media type of a file, without its parameters.
+func detectMIMEType(filePath string) (string, error) {
+	f, err := os.Open(filepath.Clean(filePath))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	mimeType := http.DetectContentType(head[:n])
+	if mimeType == "application/octet-stream" || strings.HasPrefix(mimeType, "text/plain") {
+		// Generic signatures, the extension is more specific
+		if byExtension := mime.TypeByExtension(filepath.Ext(filePath)); byExtension != "" {
+			mimeType = byExtension
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return mimeType, nil
+	}
+	return mediaType, nil
+}
+
+// FileFormat is the format identified for a file.
+type FileFormat struct {
+	Path     string `json:"path"` // Slash separated, relative to the identified directory
+	Size     int64  `json:"size"`
+	MIMEType string `json:"mime_type"`
+	PUID     string `json:"puid,omitempty"` // PRONOM identifier, UNKNOWN if siegfried found no match
+	Format   string `json:"format,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Basis    string `json:"basis,omitempty"`   // Evidence of the PRONOM match, e.g. its signature and extension
+	Warning  string `json:"warning,omitempty"` // Warning of siegfried, e.g. an extension mismatch
+}
+
+// IdentifyFiles identifies the format of each file under root, or of root if it is a file: its MIME type like
+// IdentifyFormats and, if the siegfried binary sf is given, its PRONOM format, as A3M identifies it. Files are sorted
+// by path.
+func IdentifyFiles(ctx context.Context, root, sf string) ([]FileFormat, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	base := root
+	if !info.IsDir() {
+		base = filepath.Dir(root)
+	}
+	var files []FileFormat
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mimeType, err := detectMIMEType(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileFormat{Path: filepath.ToSlash(rel), Size: info.Size(), MIMEType: mimeType})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	if sf == "" || len(files) == 0 {
+		return files, nil
+	}
+
+	matches, err := siegfried(ctx, sf, root)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		match, ok := matches[filepath.Join(base, filepath.FromSlash(files[i].Path))]
+		if !ok {
+			continue
+		}
+		files[i].PUID = match.ID
+		files[i].Format = match.Format
+		files[i].Version = match.Version
+		files[i].Basis = match.Basis
+		files[i].Warning = match.Warning
+	}
+	return files, nil
+}
+
+// siegfriedMatch is a PRONOM match of the JSON output of siegfried.
+type siegfriedMatch struct {
+	Namespace string `json:"ns"`
+	ID        string `json:"id"`
+	Format    string `json:"format"`
+	Version   string `json:"version"`
+	Basis     string `json:"basis"`
+	Warning   string `json:"warning"`
+}
+
+// siegfried identifies the files under root, or root, with siegfried. Returns the PRONOM match of each file, by
+// absolute path.
+func siegfried(ctx context.Context, sf, root string) (map[string]siegfriedMatch, error) {
+	// #nosec G204 -- the binary is chosen by the operator
+	output, err := exec.CommandContext(ctx, sf, "-json", root).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("error running siegfried: %w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("error running siegfried: %w", err)
+	}
+	var result struct {
+		Files []struct {
+			Filename string           `json:"filename"`
+			Matches  []siegfriedMatch `json:"matches"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("error parsing siegfried output: %w", err)
+	}
+	matches := make(map[string]siegfriedMatch, len(result.Files))
+	for _, file := range result.Files {
+		for _, match := range file.Matches {
+			if match.Namespace == "pronom" {
+				matches[filepath.Clean(file.Filename)] = match
+				break
+			}
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,230 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// piiSampleLimit is the number of masked samples kept per finding.
+const piiSampleLimit = 3
+
+// builtinPIIPatterns are the regular expressions of the built-in PII pattern sets.
+var builtinPIIPatterns = map[string]*regexp.Regexp{
+	config.PIIPatternEmail:      regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	config.PIIPatternUKNINO:     regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`),
+	config.PIIPatternCreditCard: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+}
+
+// invalidNINOPrefixes are prefixes that are never allocated as national insurance numbers.
+var invalidNINOPrefixes = []string{"BG", "GB", "KN", "NK", "NT", "TN", "ZZ"}
+
+// PIIFinding records matches of a PII pattern in a file.
+type PIIFinding struct {
+	Path    string   `json:"path"` // Slash separated, relative to the scanned directory
+	Pattern string   `json:"pattern"`
+	Count   int      `json:"count"`
+	Samples []string `json:"samples"` // Masked
+}
+
+// PIIScanner detects sensitive data in text-bearing files.
+type PIIScanner struct {
+	patterns    map[string]*regexp.Regexp
+	allowlist   []*regexp.Regexp
+	maxFileSize int64
+}
+
+// NewPIIScanner creates a scanner from the PII scan configuration.
+func NewPIIScanner(cfg *config.PIIScanConfig) (*PIIScanner, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	s := &PIIScanner{patterns: map[string]*regexp.Regexp{}, maxFileSize: cfg.MaxFileSize}
+	if s.maxFileSize == 0 {
+		s.maxFileSize = config.DefaultPIIMaxFileSize
+	}
+
+	sets := cfg.Patterns
+	if len(sets) == 0 && len(cfg.CustomPatterns) == 0 {
+		sets = config.PIIPatternSets
+	}
+	for _, name := range sets {
+		re, ok := builtinPIIPatterns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown PII pattern set: %s", name)
+		}
+		s.patterns[name] = re
+	}
+	for name, pattern := range cfg.CustomPatterns {
+		s.patterns[name] = regexp.MustCompile(pattern) // Validated above
+	}
+	for _, pattern := range cfg.Allowlist {
+		s.allowlist = append(s.allowlist, regexp.MustCompile(pattern))
+	}
+	return s, nil
+}
+
+// Scan scans every text-bearing file under dir. Binary files and files above the size limit are skipped.
+func (s *PIIScanner) Scan(ctx context.Context, dir string) ([]PIIFinding, error) {
+	var findings []PIIFinding
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > s.maxFileSize {
+			logger.Debug("Skipping PII scan of large file: %s", path)
+			return nil
+		}
+		content, err := readTextFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if content == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, s.scanText(filepath.ToSlash(rel), content)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning for PII: %w", err)
+	}
+	return findings, nil
+}
+
+// scanText returns the findings of every pattern in the content, ignoring allowlisted and invalid matches.
+func (s *PIIScanner) scanText(rel, content string) []PIIFinding {
+	names := make([]string, 0, len(s.patterns))
+	for name := range s.patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var findings []PIIFinding
+	for _, name := range names {
+		finding := PIIFinding{Path: rel, Pattern: name}
+		for _, match := range s.patterns[name].FindAllString(content, -1) {
+			if s.allowed(match) || !validPIIMatch(name, match) {
+				continue
+			}
+			finding.Count++
+			if len(finding.Samples) < piiSampleLimit {
+				finding.Samples = append(finding.Samples, maskPII(match))
+			}
+		}
+		if finding.Count > 0 {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+func (s *PIIScanner) allowed(match string) bool {
+	for _, re := range s.allowlist {
+		if re.MatchString(match) {
+			return true
+		}
+	}
+	return false
+}
+
+// validPIIMatch applies the checks that can't be expressed as regular expressions to built-in pattern matches.
+func validPIIMatch(pattern, match string) bool {
+	switch pattern {
+	case config.PIIPatternCreditCard:
+		return luhnValid(match)
+	case config.PIIPatternUKNINO:
+		for _, prefix := range invalidNINOPrefixes {
+			if strings.HasPrefix(match, prefix) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// luhnValid reports whether the digits in s form a card number of valid length passing the Luhn checksum.
+func luhnValid(s string) bool {
+	var digits []int
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// maskPII masks all but the first and last two characters of a match.
+func maskPII(match string) string {
+	runes := []rune(match)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:2]) + strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-2:])
+}
+
+// readTextFile reads a file if its content is text. Returns an empty string for binary files.
+func readTextFile(path string) (string, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if !strings.HasPrefix(http.DetectContentType(head[:n]), "text/") {
+		return "", nil
+	}
+	rest, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	return string(head[:n]) + string(rest), nil
+}
@@ -20,83 +20,101 @@ import (
 // PreprocessPackage prepares a package for preservation submission and returns the path to the preprocessed package path.
 // It MOVES the package to a new directory and extracts it if it's a ZIP file.
 // It also creates the metadata and premis files.
+// Files matching the deselect patterns, or flagged for deselection in Cells, are removed and returned.
 // NodesCollection is the collection of cells nodes for the package, using the cells SDK.
-func PreprocessPackage(ctx context.Context, packagePath, preprocessingDir string, nodesCollection *models.RestNodesCollection, userData *models.IdmUser, organization string) (string, error) {
+func PreprocessPackage(ctx context.Context, packagePath, preprocessingDir string, nodesCollection *models.RestNodesCollection, userData *models.IdmUser, organization string, deselect []string) (string, []Deselection, error) {
 	packageName := filepath.Base(strings.TrimSuffix(packagePath, filepath.Ext(packagePath)))
 
 	// Create transfer package directory
 	transferDir := filepath.Join(preprocessingDir, packageName)
 	if err := utils.CreateDir(transferDir); err != nil {
-		return "", fmt.Errorf("error creating transfer directory: %w", err)
+		return "", nil, fmt.Errorf("error creating transfer directory: %w", err)
 	}
 
 	// Create data subdirectory
 	dataDir := filepath.Join(transferDir, "data")
 	if err := utils.CreateDir(dataDir); err != nil {
-		return "", fmt.Errorf("error creating data directory: %w", err)
+		return "", nil, fmt.Errorf("error creating data directory: %w", err)
 	}
 
 	// Get file info
 	fileInfo, err := os.Stat(packagePath)
 	if err != nil {
-		return "", fmt.Errorf("error checking path: %w", err)
+		return "", nil, fmt.Errorf("error checking path: %w", err)
 	}
 
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
+		return "", nil, ctx.Err()
 	default:
 	}
 
+	// The package root is the moved or extracted package within the data directory
+	var packageRoot string
+
 	// TODO: Support other file types - e.g. tar, gzip, etc.
 	switch {
 	case fileInfo.Mode().IsRegular() && utils.IsZipFile(packagePath) && utils.IsActualArchive(packagePath):
 		// If it's a ZIP file, extract it
 		logger.Debug("Extracting ZIP file %s", packagePath)
-		if _, err := utils.ExtractZip(ctx, packagePath, filepath.Join(dataDir, packageName)); err != nil {
-			return "", fmt.Errorf("error extracting zip: %w", err)
+		packageRoot = filepath.Join(dataDir, packageName)
+		if _, err := utils.ExtractZip(ctx, packagePath, packageRoot); err != nil {
+			return "", nil, fmt.Errorf("error extracting zip: %w", err)
 		}
 	case fileInfo.Mode().IsRegular():
 		// If it's a regular file, move it
 		logger.Debug("Moving file %s to %s", packagePath, dataDir)
+		packageRoot = dataDir
 		if err := os.Rename(packagePath, filepath.Join(dataDir, filepath.Base(packagePath))); err != nil {
-			return "", fmt.Errorf("error moving file: %w", err)
+			return "", nil, fmt.Errorf("error moving file: %w", err)
 		}
 	case fileInfo.IsDir():
 		// If it's a directory, move it
 		logger.Debug("Moving directory %s to %s", packagePath, dataDir)
-		if err := os.Rename(packagePath, filepath.Join(dataDir, filepath.Base(packagePath))); err != nil {
-			return "", fmt.Errorf("error moving directory: %w", err)
+		packageRoot = filepath.Join(dataDir, filepath.Base(packagePath))
+		if err := os.Rename(packagePath, packageRoot); err != nil {
+			return "", nil, fmt.Errorf("error moving directory: %w", err)
 		}
 	default:
-		return "", fmt.Errorf("file type not supported: %s", packagePath)
+		return "", nil, fmt.Errorf("file type not supported: %s", packagePath)
 	}
 
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
+		return "", nil, ctx.Err()
 	default:
 	}
 
 	// Create metadata subdirectory
 	metadataDir := filepath.Join(transferDir, "metadata")
 	if err = utils.CreateDir(metadataDir); err != nil {
-		return "", fmt.Errorf("error creating metadata directory: %w", err)
+		return "", nil, fmt.Errorf("error creating metadata directory: %w", err)
+	}
+
+	// Remove files deselected during appraisal
+	deselections, removed, err := applyDeselection(dataDir, packageRoot, append(deselectionPatterns(nodesCollection), deselect...), true)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(deselections) > 0 {
+		if err = writeDeselectionList(metadataDir, deselections); err != nil {
+			return "", nil, err
+		}
 	}
 
 	// Construct Metadata
-	premisObj, metadataArray, err := constructMetadataFromNodesCollection(nodesCollection, userData, organization)
+	premisObj, metadataArray, err := constructMetadataFromNodesCollection(nodesCollection, userData, organization, deselections, removed)
 	if err != nil {
-		return "", fmt.Errorf("error constructing PREMIS XML: %w", err)
+		return "", nil, fmt.Errorf("error constructing PREMIS XML: %w", err)
 	}
 
 	if len(premisObj.Objects) != 0 {
 		// Validate PREMIS XML
 		if err = premis.ValidatePremis(premisObj); err != nil {
-			return "", fmt.Errorf("error validating PREMIS XML: %w", err)
+			return "", nil, fmt.Errorf("error validating PREMIS XML: %w", err)
 		}
 		if err = premis.WritePremis(premisObj, filepath.Join(metadataDir, "premis.xml")); err != nil {
-			return "", fmt.Errorf("error writing PREMIS XML: %w", err)
+			return "", nil, fmt.Errorf("error writing PREMIS XML: %w", err)
 		}
 	}
 
@@ -104,19 +122,20 @@ func PreprocessPackage(ctx context.Context, packagePath, preprocessingDir string
 	if len(metadataArray) > 0 {
 		metadataJSON, err := json.Marshal(metadataArray)
 		if err != nil {
-			return "", fmt.Errorf("error marshaling metadata JSON array: %w", err)
+			return "", nil, fmt.Errorf("error marshaling metadata JSON array: %w", err)
 		}
 		if err = os.WriteFile(filepath.Join(metadataDir, "metadata.json"), metadataJSON, 0o600); err != nil {
-			return "", fmt.Errorf("error writing metadata JSON: %w", err)
+			return "", nil, fmt.Errorf("error writing metadata JSON: %w", err)
 		}
 	}
 
-	return transferDir, nil
+	return transferDir, deselections, nil
 }
 
 // Constructs the PREMIS XML from the nodes in the package
 // This function is a bit janky as it contructs Premis, Dublin Core and ISAD(G) metadata to avoid looping through the nodes repeatedly
-func constructMetadataFromNodesCollection(nodesCollection *models.RestNodesCollection, userData *models.IdmUser, organization string) (premis.Premis, []map[string]any, error) {
+// Deselected nodes are left out of the metadata and a deselection event is recorded for each deselected file instead.
+func constructMetadataFromNodesCollection(nodesCollection *models.RestNodesCollection, userData *models.IdmUser, organization string, deselections []Deselection, removed map[string]bool) (premis.Premis, []map[string]any, error) {
 	// Initialize the PREMIS XML
 	premisRoot := premis.Premis{
 		XMLNS:   "http://www.loc.gov/premis/v3",
@@ -159,10 +178,15 @@ func constructMetadataFromNodesCollection(nodesCollection *models.RestNodesColle
 	metadataArray := make([]map[string]any, 0)
 
 	nodePrefix := filepath.Dir(nodesCollection.Parent.Path)
+	nodesByPath := map[string]*models.TreeNode{}
 	// For each node in the package
 	for _, node := range append(nodesCollection.Children, nodesCollection.Parent) {
 
 		objectPath := strings.Replace(node.Path, nodePrefix, "objects/data", 1)
+		nodesByPath[objectPath] = node
+		if removed[strings.TrimPrefix(objectPath, "objects/data/")] {
+			continue
+		}
 
 		// Create the PREMIS object
 		premisObject, premisEvents, err := constructPremisObjectsFromNode(premisAgents, node, objectPath)
@@ -183,6 +207,11 @@ func constructMetadataFromNodesCollection(nodesCollection *models.RestNodesColle
 			metadataArray = append(metadataArray, metadataMap)
 		}
 	}
+	// Record the deselected files
+	deselectionObjects, deselectionEvents := deselectionPremis(premisAgents, deselections, nodesByPath)
+	premisRoot.Objects = append(premisRoot.Objects, deselectionObjects...)
+	premisRoot.Events = append(premisRoot.Events, deselectionEvents...)
+
 	// Append PREMIS agents to PREMIS XML
 	if len(premisRoot.Events) != 0 {
 		premisRoot.Agents = append(premisRoot.Agents, premisAgents...)
@@ -370,6 +399,56 @@ var metadataMap = map[string]string{
 	"usermeta-isadg-dates-of-descriptions":                               "isadg.dates-of-descriptions",
 }
 
+// IsMetadataKey reports whether a key is one of the Dublin Core and ISAD(G) metadata keys of metadata.json.
+func IsMetadataKey(key string) bool {
+	for _, metaKey := range metadataMap {
+		if metaKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyMetadata sets the Dublin Core and ISAD(G) metadata of a node, keyed as in metadata.json, that the node does not
+// already have. Values are stored like Cells stores user metadata, as JSON strings.
+func ApplyMetadata(node *models.TreeNode, metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+	if node.MetaStore == nil {
+		node.MetaStore = make(map[string]string)
+	}
+	existing := NodeMetadata(node)
+	for cellsKey, metaKey := range metadataMap {
+		value, ok := metadata[metaKey]
+		if !ok || strings.TrimSpace(value) == "" || existing[metaKey] != "" {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		node.MetaStore[cellsKey] = string(encoded)
+	}
+}
+
+// NodeMetadata returns the Dublin Core and ISAD(G) metadata of a node, keyed as in metadata.json (e.g. dc.title).
+// JSON encoded values are decoded.
+func NodeMetadata(node *models.TreeNode) map[string]string {
+	metadata := make(map[string]string)
+	for cellsKey, metaKey := range metadataMap {
+		value := node.MetaStore[cellsKey]
+		var decoded string
+		if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+			value = decoded
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			metadata[metaKey] = value
+		}
+	}
+	return metadata
+}
+
 // constructMetadataJSONFromNode constructs the DC and ISADG metadata JSON from the node
 func constructMetadataJSONFromNode(node *models.TreeNode, objectPath string) map[string]any {
 	metadata := make(map[string]any)
@@ -0,0 +1,157 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Media kinds supported by the thumbnail generator.
+const (
+	mediaImage = "image"
+	mediaPDF   = "pdf"
+	mediaVideo = "video"
+)
+
+// thumbnailMediaKinds maps file extensions to the media kind used to pick the thumbnail tool.
+var thumbnailMediaKinds = map[string]string{
+	".jpg": mediaImage, ".jpeg": mediaImage, ".png": mediaImage, ".gif": mediaImage, ".bmp": mediaImage,
+	".tif": mediaImage, ".tiff": mediaImage, ".webp": mediaImage, ".jp2": mediaImage,
+	".pdf": mediaPDF,
+	".mp4": mediaVideo, ".m4v": mediaVideo, ".mov": mediaVideo, ".avi": mediaVideo, ".mkv": mediaVideo,
+	".webm": mediaVideo, ".mpg": mediaVideo, ".mpeg": mediaVideo, ".wmv": mediaVideo,
+}
+
+// ThumbnailGenerator generates thumbnails and previews for the objects of a DIP.
+// Images use ImageMagick, PDFs use the first page rendered by pdftoppm and videos use a keyframe extracted by FFmpeg.
+type ThumbnailGenerator struct {
+	tools     map[string]string // Media kind to tool binary
+	size      int
+	preview   int
+	overwrite bool
+}
+
+// NewThumbnailGenerator creates a thumbnail generator. Media kinds whose tool is not installed are skipped.
+func NewThumbnailGenerator(cfg *config.Config, thumbnailCfg *config.ThumbnailConfig) *ThumbnailGenerator {
+	g := &ThumbnailGenerator{
+		tools:     map[string]string{},
+		size:      thumbnailCfg.Size,
+		preview:   thumbnailCfg.PreviewSize,
+		overwrite: thumbnailCfg.Overwrite,
+	}
+	if g.size == 0 {
+		g.size = config.DefaultThumbnailSize
+	}
+	for kind, tool := range map[string]string{
+		mediaImage: cfg.Thumbnails.ConvertPath,
+		mediaPDF:   cfg.Thumbnails.PdftoppmPath,
+		mediaVideo: cfg.Thumbnails.FfmpegPath,
+	} {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			logger.Warn("Thumbnail tool %q not found, %s thumbnails disabled", tool, kind)
+			continue
+		}
+		g.tools[kind] = path
+	}
+	return g
+}
+
+// Generate writes thumbnails to <dip>/thumbnails and, if configured, previews to <dip>/previews.
+// Derivatives are named after the A3M file UUID prefixing the object name, as expected by AtoM.
+// Failures for individual objects are logged and skipped. Returns the number of objects processed.
+func (g *ThumbnailGenerator) Generate(ctx context.Context, dipPath string) (int, error) {
+	thumbnailsDir := filepath.Join(dipPath, "thumbnails")
+	previewsDir := filepath.Join(dipPath, "previews")
+	if err := utils.CreateDir(thumbnailsDir); err != nil {
+		return 0, err
+	}
+	if g.preview > 0 {
+		if err := utils.CreateDir(previewsDir); err != nil {
+			return 0, err
+		}
+	}
+
+	generated := 0
+	err := filepath.WalkDir(filepath.Join(dipPath, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		kind := thumbnailMediaKinds[strings.ToLower(filepath.Ext(path))]
+		tool, ok := g.tools[kind]
+		if !ok {
+			return nil
+		}
+
+		name := derivativeName(d.Name()) + ".jpg"
+		thumbnail := filepath.Join(thumbnailsDir, name)
+		if _, err := os.Stat(thumbnail); err == nil && !g.overwrite {
+			return nil
+		}
+		if err := renderThumbnail(ctx, kind, tool, path, thumbnail, g.size); err != nil {
+			logger.Warn("Error generating thumbnail for %s: %v", d.Name(), err)
+			return nil
+		}
+		if g.preview > 0 {
+			if err := renderThumbnail(ctx, kind, tool, path, filepath.Join(previewsDir, name), g.preview); err != nil {
+				logger.Warn("Error generating preview for %s: %v", d.Name(), err)
+			}
+		}
+		generated++
+		return nil
+	})
+	if err != nil {
+		return generated, fmt.Errorf("error generating thumbnails: %w", err)
+	}
+	return generated, nil
+}
+
+// derivativeName returns the A3M file UUID prefixing a DIP object name, or the name without extension.
+func derivativeName(objectName string) string {
+	if len(objectName) > 36 {
+		if _, err := uuid.Parse(objectName[:36]); err == nil {
+			return objectName[:36]
+		}
+	}
+	return strings.TrimSuffix(objectName, filepath.Ext(objectName))
+}
+
+// renderThumbnail renders a JPEG of the source fitting within a size x size box.
+func renderThumbnail(ctx context.Context, kind, tool, src, dst string, size int) error {
+	box := strconv.Itoa(size)
+	var args []string
+	switch kind {
+	case mediaImage:
+		args = []string{src + "[0]", "-auto-orient", "-thumbnail", box + "x" + box, "-background", "white", "-flatten", dst}
+	case mediaPDF:
+		args = []string{"-jpeg", "-f", "1", "-l", "1", "-singlefile", "-scale-to", box, src, strings.TrimSuffix(dst, ".jpg")}
+	case mediaVideo:
+		args = []string{"-y", "-loglevel", "error", "-i", src, "-vf", fmt.Sprintf("thumbnail,scale=%s:%s:force_original_aspect_ratio=decrease", box, box), "-frames:v", "1", dst}
+	default:
+		return fmt.Errorf("unsupported media kind: %s", kind)
+	}
+	// #nosec G204 -- the tool is resolved from configuration and the arguments are file paths within the DIP
+	output, err := exec.CommandContext(ctx, tool, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\nOutput: %s", filepath.Base(tool), err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/penwern/curate-preservation-core/internal/profiles"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// ProfilesHandler responds with the processing profiles, by name, with their assignments.
+func ProfilesHandler(store *profiles.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		list, err := store.List()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list profiles: %v", err))
+			http.Error(w, "failed to list profiles", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, list)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// ProfileHandler responds with a processing profile.
+func ProfileHandler(store *profiles.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		profile, err := store.Get(name)
+		if err != nil {
+			writeProfileError(w, err, "get profile "+name)
+			return
+		}
+		writeJSON(w, profile)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// CreateProfileHandler creates a processing profile. Responds with 201 Created and the profile.
+func CreateProfileHandler(store *profiles.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req profiles.NewProfile
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profile, err := store.Create(&req, principalName(r))
+		if err != nil {
+			writeProfileError(w, err, "create profile "+req.Name)
+			return
+		}
+		logger.Info("Created profile %s for %s", profile.Name, principalName(r))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, profile)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// UpdateProfileHandler replaces the settings of a processing profile. The version of the request body must be the
+// current version of the profile, or be left out to overwrite any version. Responds with the profile at its new
+// version, or 409 Conflict if the profile was changed since.
+func UpdateProfileHandler(store *profiles.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var req config.ProcessingProfile
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profile, err := store.Update(name, &req, principalName(r))
+		if err != nil {
+			writeProfileError(w, err, "update profile "+name)
+			return
+		}
+		logger.Info("Updated profile %s to version %d for %s", name, profile.Version, principalName(r))
+		writeJSON(w, profile)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// DeleteProfileHandler deletes a processing profile, unless it is still assigned or is one of the profiles of a
+// tenant. Responds with 204 No Content.
+func DeleteProfileHandler(store *profiles.Store, tenants *config.TenantsConfig) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if tenants != nil {
+			for _, tenant := range tenants.Tenants {
+				if tenant.DefaultProfile == name || slices.Contains(tenant.Profiles, name) {
+					http.Error(w, fmt.Sprintf("%v: %s is a profile of tenant %s", profiles.ErrInUse, name, tenant.Name), http.StatusConflict)
+					return
+				}
+			}
+		}
+		if err := store.Delete(name); err != nil {
+			writeProfileError(w, err, "delete profile "+name)
+			return
+		}
+		logger.Info("Deleted profile %s for %s", name, principalName(r))
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// ProfileVersionsHandler responds with the versions of a processing profile, most recent first.
+func ProfileVersionsHandler(store *profiles.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		versions, err := store.Versions(name)
+		if err != nil {
+			writeProfileError(w, err, "list the versions of profile "+name)
+			return
+		}
+		writeJSON(w, versions)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// SetDefaultProfileHandler sets the default processing profile, or removes it if the profile of the request body is
+// empty. Responds with 204 No Content.
+func SetDefaultProfileHandler(store *profiles.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req profiles.Assignment
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := store.SetDefault(req.Profile); err != nil {
+			writeProfileError(w, err, "set the default profile")
+			return
+		}
+		logger.Info("Set the default profile to %q for %s", req.Profile, principalName(r))
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// AssignWorkspaceProfileHandler assigns a processing profile to the packages of a Cells workspace, or removes the
+// assignment if the profile of the request body is empty. Responds with 204 No Content.
+func AssignWorkspaceProfileHandler(store *profiles.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		workspace := r.PathValue("workspace")
+		var req profiles.Assignment
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := store.AssignWorkspace(workspace, req.Profile); err != nil {
+			writeProfileError(w, err, "assign the profile of workspace "+workspace)
+			return
+		}
+		logger.Info("Assigned profile %q to workspace %s for %s", req.Profile, workspace, principalName(r))
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// writeProfileError responds with the status of an error of the profile store, logging unexpected errors.
+func writeProfileError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, profiles.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, profiles.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, profiles.ErrExists), errors.Is(err, profiles.ErrVersionConflict), errors.Is(err, profiles.ErrInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.Error(fmt.Sprintf("Failed to %s: %v", action, err))
+		http.Error(w, "failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// principalName returns the username of the caller, empty without authentication.
+func principalName(r *http.Request) string {
+	if principal := PrincipalFromContext(r.Context()); principal != nil {
+		return principal.Username
+	}
+	return ""
+}
@@ -0,0 +1,324 @@
+// Package profiles manages the processing profiles of the profiles file through the admin API, so that they can be
+// changed without editing the file on the server. Changes are written back to the file, which is still read for each
+// package. Each change increments the version of the profile, and the version it replaces is kept in the versions
+// directory, one JSON file per version.
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+var (
+	// ErrNotFound is returned when a profile does not exist.
+	ErrNotFound = errors.New("profile not found")
+	// ErrExists is returned when a profile is created with the name of an existing profile.
+	ErrExists = errors.New("profile already exists")
+	// ErrVersionConflict is returned when a profile is updated from a version that is not its current version.
+	ErrVersionConflict = errors.New("profile was changed since the version it is updated from")
+	// ErrInUse is returned when a profile still referenced by the registry or by a tenant is deleted.
+	ErrInUse = errors.New("profile is in use")
+	// ErrInvalid is returned when a change would leave the registry invalid.
+	ErrInvalid = errors.New("invalid profile")
+)
+
+// Profile is a processing profile with its name and assignments.
+type Profile struct {
+	Name       string   `json:"name"`
+	Default    bool     `json:"default"`
+	Workspaces []string `json:"workspaces,omitempty"` // Cells workspaces assigned the profile
+	*config.ProcessingProfile
+}
+
+// NewProfile is a profile to create.
+type NewProfile struct {
+	Name string `json:"name" validate:"required,max=64,excludesall=/\\"`
+	config.ProcessingProfile
+}
+
+// Assignment names the profile of a workspace or the default profile. An empty profile removes the assignment.
+type Assignment struct {
+	Profile string `json:"profile"`
+}
+
+// Store changes the profiles of the profiles file.
+type Store struct {
+	path        string
+	versionsDir string
+
+	mu sync.Mutex // Serializes the changes of the file
+}
+
+// Open opens the profiles of the configured profiles file, keeping their previous versions in
+// <DataDir>/profile_versions unless a directory is configured.
+func Open(cfg *config.Config) (*Store, error) {
+	if cfg.Profiles.ConfigPath == "" {
+		return nil, fmt.Errorf("no profiles file set")
+	}
+	dir := cfg.Profiles.VersionsDir
+	if dir == "" {
+		if cfg.DataDir == "" {
+			return nil, fmt.Errorf("no versions directory or data directory set for the profiles")
+		}
+		dir = filepath.Join(cfg.DataDir, "profile_versions")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating profile versions directory: %w", err)
+	}
+	return &Store{path: cfg.Profiles.ConfigPath, versionsDir: dir}, nil
+}
+
+// List returns the profiles, sorted by name.
+func (s *Store) List() ([]*Profile, error) {
+	registry, err := config.LoadProfiles(s.path)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]*Profile, 0, len(registry.Profiles))
+	for _, name := range registry.Names() {
+		profiles = append(profiles, newProfile(registry, name))
+	}
+	return profiles, nil
+}
+
+// Get returns a profile.
+func (s *Store) Get(name string) (*Profile, error) {
+	registry, err := config.LoadProfiles(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := registry.Profiles[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return newProfile(registry, name), nil
+}
+
+// Create creates a profile. Its version follows the versions of a deleted profile of the same name, if any.
+func (s *Store) Create(profile *NewProfile, createdBy string) (*Profile, error) {
+	if err := validator.New().Struct(profile); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	var created *Profile
+	err := s.change(func(registry *config.ProfileRegistry) (*config.ProcessingProfile, error) {
+		if _, ok := registry.Profiles[profile.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrExists, profile.Name)
+		}
+		versions, err := s.archived(profile.Name)
+		if err != nil {
+			return nil, err
+		}
+		p := profile.ProcessingProfile
+		p.Name = profile.Name
+		p.Version = 1
+		if len(versions) > 0 {
+			p.Version = versions[0].Version + 1
+		}
+		stamp(&p, createdBy)
+		registry.Profiles[profile.Name] = &p
+		created = newProfile(registry, profile.Name)
+		return nil, nil
+	})
+	return created, err
+}
+
+// Update replaces the settings of a profile, incrementing its version. The profile's version must be the current
+// version of the profile, unless it is 0, so that concurrent changes are not overwritten. The replaced version is
+// kept.
+func (s *Store) Update(name string, profile *config.ProcessingProfile, updatedBy string) (*Profile, error) {
+	var updated *Profile
+	err := s.change(func(registry *config.ProfileRegistry) (*config.ProcessingProfile, error) {
+		current, ok := registry.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		if profile.Version != 0 && profile.Version != current.Version {
+			return nil, fmt.Errorf("%w: %s is at version %d, not %d", ErrVersionConflict, name, current.Version, profile.Version)
+		}
+		p := *profile
+		p.Name = name
+		p.Version = current.Version + 1
+		stamp(&p, updatedBy)
+		registry.Profiles[name] = &p
+		updated = newProfile(registry, name)
+		return current, nil
+	})
+	return updated, err
+}
+
+// Delete deletes a profile, keeping its last version. A profile that is the default profile, or is assigned to a
+// workspace or a policy, cannot be deleted.
+func (s *Store) Delete(name string) error {
+	return s.change(func(registry *config.ProfileRegistry) (*config.ProcessingProfile, error) {
+		current, ok := registry.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		if registry.Default == name {
+			return nil, fmt.Errorf("%w: %s is the default profile", ErrInUse, name)
+		}
+		for workspace, assigned := range registry.Workspaces {
+			if assigned == name {
+				return nil, fmt.Errorf("%w: %s is assigned to workspace %s", ErrInUse, name, workspace)
+			}
+		}
+		for _, policy := range registry.Policies {
+			if policy.Profile == name {
+				return nil, fmt.Errorf("%w: %s is the profile of policy %s", ErrInUse, name, policy.Path)
+			}
+		}
+		delete(registry.Profiles, name)
+		return current, nil
+	})
+}
+
+// Versions returns the versions of a profile, most recent first: its current version, unless it was deleted, and the
+// versions it replaced.
+func (s *Store) Versions(name string) ([]*config.ProcessingProfile, error) {
+	registry, err := config.LoadProfiles(s.path)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.archived(name)
+	if err != nil {
+		return nil, err
+	}
+	if current, ok := registry.Profiles[name]; ok {
+		versions = append([]*config.ProcessingProfile{current}, versions...)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return versions, nil
+}
+
+// SetDefault makes a profile the default profile, or removes the default profile if the name is empty.
+func (s *Store) SetDefault(name string) error {
+	return s.change(func(registry *config.ProfileRegistry) (*config.ProcessingProfile, error) {
+		if _, ok := registry.Profiles[name]; name != "" && !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		registry.Default = name
+		return nil, nil
+	})
+}
+
+// AssignWorkspace assigns a profile to the packages of a Cells workspace, or removes the assignment of the
+// workspace if the name is empty.
+func (s *Store) AssignWorkspace(workspace, name string) error {
+	return s.change(func(registry *config.ProfileRegistry) (*config.ProcessingProfile, error) {
+		if name == "" {
+			delete(registry.Workspaces, workspace)
+			return nil, nil
+		}
+		if _, ok := registry.Profiles[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		if registry.Workspaces == nil {
+			registry.Workspaces = map[string]string{}
+		}
+		registry.Workspaces[workspace] = name
+		return nil, nil
+	})
+}
+
+// change applies a change to the registry of the profiles file and writes it back if it is still valid, keeping the
+// version of the profile the change replaces, if any.
+func (s *Store) change(apply func(registry *config.ProfileRegistry) (replaced *config.ProcessingProfile, err error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	registry, err := config.LoadProfiles(s.path)
+	if err != nil {
+		return err
+	}
+	replaced, err := apply(registry)
+	if err != nil {
+		return err
+	}
+	if err := registry.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if replaced != nil {
+		if err := s.archive(replaced); err != nil {
+			return err
+		}
+	}
+	return config.SaveProfiles(s.path, registry)
+}
+
+// archive keeps a version of a profile before it is replaced.
+func (s *Store) archive(profile *config.ProcessingProfile) error {
+	dir := filepath.Join(s.versionsDir, url.PathEscape(profile.Name))
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("error creating profile versions directory: %w", err)
+	}
+	data, err := json.MarshalIndent(profile, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error marshaling profile %s: %w", profile.Name, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(profile.Version)+".json"), data, 0o600); err != nil {
+		return fmt.Errorf("error keeping version %d of profile %s: %w", profile.Version, profile.Name, err)
+	}
+	return nil
+}
+
+// archived returns the kept versions of a profile, most recent first.
+func (s *Store) archived(name string) ([]*config.ProcessingProfile, error) {
+	dir := filepath.Join(s.versionsDir, url.PathEscape(name))
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing the versions of profile %s: %w", name, err)
+	}
+	var versions []*config.ProcessingProfile
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json")); err != nil || entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading a version of profile %s: %w", name, err)
+		}
+		var profile config.ProcessingProfile
+		if err := json.Unmarshal(data, &profile); err != nil {
+			return nil, fmt.Errorf("error reading version %s of profile %s: %w", entry.Name(), name, err)
+		}
+		profile.Name = name
+		versions = append(versions, &profile)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+// newProfile returns a profile of the registry with its assignments.
+func newProfile(registry *config.ProfileRegistry, name string) *Profile {
+	profile := &Profile{Name: name, Default: registry.Default == name, ProcessingProfile: registry.Profiles[name]}
+	for workspace, assigned := range registry.Workspaces {
+		if assigned == name {
+			profile.Workspaces = append(profile.Workspaces, workspace)
+		}
+	}
+	sort.Strings(profile.Workspaces)
+	return profile
+}
+
+// stamp records who changed a profile, and when.
+func stamp(profile *config.ProcessingProfile, by string) {
+	now := time.Now().UTC()
+	profile.UpdatedAt = &now
+	profile.UpdatedBy = by
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// progressKeepAlive is the interval of the comments keeping idle progress streams open through proxies.
+const progressKeepAlive = 15 * time.Second
+
+// ProgressHandler streams the progress events of the running preservations as Server-Sent Events, named after the
+// event kind. Users bound to a tenant only receive the events of their tenant. Events can be filtered with the
+// username and path query parameters.
+func ProgressHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "package records are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		events, unsubscribe := store.Subscribe("")
+		defer unsubscribe()
+
+		query := r.URL.Query()
+		username, path := query.Get("username"), query.Get("path")
+		tenant := preservation.TenantFromContext(r.Context())
+		streamProgress(w, r, events, func(event *catalog.ProgressEvent) (bool, bool) {
+			if (username != "" && event.Username != username) || (path != "" && event.CellsPath != path) ||
+				(tenant != "" && event.Tenant != tenant) {
+				return false, false
+			}
+			return true, false
+		})
+	}
+	return recoveryMiddleware(handler)
+}
+
+// PackageProgressHandler streams the progress events of a package as Server-Sent Events. The stream starts with the
+// current state of the package and ends after its finished event.
+func PackageProgressHandler(store *catalog.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if store == nil {
+			http.Error(w, "package records are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		// Subscribe before reading the record, so that no event is missed in between
+		events, unsubscribe := store.Subscribe(id)
+		defer unsubscribe()
+		rec, ok := getRecord(w, r, store, id)
+		if !ok {
+			return
+		}
+
+		initial := []catalog.ProgressEvent{{
+			PackageID: rec.ID, CellsPath: rec.CellsPath, Username: rec.Username, Tenant: rec.Tenant, JobID: rec.JobID,
+			Kind: catalog.ProgressState, Time: rec.UpdatedAt, State: rec.State,
+		}}
+		if rec.Outcome != "" {
+			initial = append(initial, catalog.ProgressEvent{
+				PackageID: rec.ID, CellsPath: rec.CellsPath, Username: rec.Username, Tenant: rec.Tenant, JobID: rec.JobID,
+				Kind: catalog.ProgressFinished, Time: rec.UpdatedAt, State: rec.State, Outcome: rec.Outcome, Detail: rec.Error,
+			})
+		}
+		streamProgress(w, r, events, func(event *catalog.ProgressEvent) (bool, bool) {
+			return true, event.Kind == catalog.ProgressFinished
+		}, initial...)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// streamProgress writes progress events as Server-Sent Events until the client disconnects. filter returns whether
+// an event is sent, and whether the stream ends after it. The initial events are sent first, through the filter.
+func streamProgress(w http.ResponseWriter, r *http.Request, events <-chan catalog.ProgressEvent, filter func(*catalog.ProgressEvent) (bool, bool), initial ...catalog.ProgressEvent) {
+	rc := http.NewResponseController(w)
+	// Streams outlive the write timeout of the server
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("Failed to clear the write deadline of the progress stream: %v", err)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Don't let nginx buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	send := func(event *catalog.ProgressEvent) bool {
+		ok, last := filter(event)
+		if !ok {
+			return true
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to encode progress event: %v", err))
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data); err != nil {
+			return false
+		}
+		return rc.Flush() == nil && !last
+	}
+	for i := range initial {
+		if !send(&initial[i]) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(progressKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok || !send(&event) {
+				return
+			}
+		}
+	}
+}
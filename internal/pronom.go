@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/pronom"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// PronomService is the interface of the PRONOM sync used by the HTTP handler.
+type PronomService interface {
+	SyncPronom(ctx context.Context, since string) (*pronom.Sync, error)
+}
+
+// PronomSignatures returns the signature file loaded by the siegfried binary of the PRONOM sync.
+func (s *Service) PronomSignatures(ctx context.Context) (*pronom.Signatures, error) {
+	return pronom.ReadSignatures(ctx, s.currentSettings().PRONOM.SfPath)
+}
+
+// SyncPronom updates the siegfried signature file to the latest PRONOM release, and looks up the formats added since
+// the previous release, or since the given release, in the format policy registry. The settings are read for each
+// sync, so that a reload of the configuration applies to the next sync.
+func (s *Service) SyncPronom(ctx context.Context, since string) (*pronom.Sync, error) {
+	cfg := s.currentSettings()
+	policies, err := config.LoadFormatPoliciesConfig(cfg.FormatPolicies.ConfigPath)
+	if err != nil {
+		return nil, utils.Classify(utils.ErrValidation, fmt.Errorf("error loading format policies: %w", err))
+	}
+	if policies == nil {
+		logger.Warn("No format policy registry at %s, every new format is unpoliced", cfg.FormatPolicies.ConfigPath)
+	}
+	releases := pronom.NewReleases(cfg.PRONOM.ReleaseURL, cfg.AllowInsecureTLS)
+	result, err := pronom.SyncPolicies(ctx, cfg.PRONOM.SfPath, releases, policies, since)
+	if err != nil {
+		return nil, err
+	}
+	if result.Updated {
+		logger.Info("Updated the siegfried signature file from %s to %s", result.Before.File, result.After.File)
+	}
+	if len(result.Unpoliced) > 0 {
+		puids := make([]string, 0, len(result.Unpoliced))
+		for _, format := range result.Unpoliced {
+			puids = append(puids, format.PUID)
+		}
+		logger.Warn("%d formats added to PRONOM since %s have no format policy: %s", len(puids), result.Since, strings.Join(puids, ", "))
+	}
+	return result, nil
+}
+
+// PlanSyncPronom is a dry run of SyncPronom: it reads the signature file and the format policy registry and returns the
+// actions the sync would take, without updating the signature file or downloading the releases.
+func (s *Service) PlanSyncPronom(ctx context.Context, since string) ([]preservation.PlannedAction, error) {
+	if since != "" {
+		if err := pronom.CheckRelease(since); err != nil {
+			return nil, err
+		}
+	}
+	cfg := s.currentSettings()
+	policies, err := config.LoadFormatPoliciesConfig(cfg.FormatPolicies.ConfigPath)
+	if err != nil {
+		return nil, utils.Classify(utils.ErrValidation, fmt.Errorf("error loading format policies: %w", err))
+	}
+	signatures, err := pronom.ReadSignatures(ctx, cfg.PRONOM.SfPath)
+	if err != nil {
+		return nil, err
+	}
+	if since == "" {
+		since = signatures.Release
+	}
+	if since == "" {
+		return nil, pronom.ErrNoRelease
+	}
+	registry := "no format policy registry, every new format would be flagged"
+	if policies != nil {
+		registry = fmt.Sprintf("the format policy registry %s (%d policies)", cfg.FormatPolicies.ConfigPath, len(policies.Policies))
+	}
+	return []preservation.PlannedAction{
+		{Stage: catalog.EventIdentification, Action: fmt.Sprintf("Update the signature file %s to the latest PRONOM release with sf -update", signatures.File)},
+		{Stage: catalog.EventIdentification, Action: fmt.Sprintf("Download %s and the release of the updated signature file from %s, and list the formats added since", since, cfg.PRONOM.ReleaseURL)},
+		{Stage: catalog.EventIdentification, Action: "Look up the new formats in " + registry},
+	}, nil
+}
+
+// SyncPronomHandler runs a PRONOM sync and responds with the formats added since the previous release, or since the
+// release of the since query parameter, flagging those without a format policy. Responds with 502 if the signature
+// file cannot be updated or the releases cannot be downloaded.
+func SyncPronomHandler(svc PronomService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		result, err := svc.SyncPronom(r.Context(), r.URL.Query().Get("since"))
+		if errors.Is(err, pronom.ErrInvalidRelease) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to sync PRONOM: %v", err))
+			http.Error(w, fmt.Sprintf("PRONOM sync failed: %v", err), http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, result)
+	}
+	return recoveryMiddleware(handler)
+}
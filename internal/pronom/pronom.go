@@ -0,0 +1,124 @@
+// Package pronom keeps the format policy registry in step with PRONOM, the file format registry of The National
+// Archives. A sync updates the signature file of siegfried to the latest PRONOM release, and lists the formats added
+// since the previous release, flagging those without a policy in the registry so that policies don't go stale.
+package pronom
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// downloadTimeout bounds the download of a release, a DROID signature file of a few megabytes.
+const downloadTimeout = 2 * time.Minute
+
+// ErrInvalidRelease is returned for a release that is not the name of a DROID signature file.
+var ErrInvalidRelease = errors.New("invalid PRONOM release")
+
+// releasePattern matches the names of the PRONOM releases, e.g. DROID_SignatureFile_V120.xml.
+var releasePattern = regexp.MustCompile(`^DROID_SignatureFile_V[0-9]+\.xml$`)
+
+// CheckRelease returns ErrInvalidRelease if release is not the name of a DROID signature file.
+func CheckRelease(release string) error {
+	if !releasePattern.MatchString(release) {
+		return utils.Classify(utils.ErrValidation, fmt.Errorf("%w: %q", ErrInvalidRelease, release))
+	}
+	return nil
+}
+
+// Format is a file format of a PRONOM release.
+type Format struct {
+	PUID    string `json:"puid"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Policy  string `json:"policy,omitempty"` // Action of the format policy, empty if the format has none
+}
+
+// Releases downloads the PRONOM releases, published as DROID signature files.
+type Releases struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewReleases downloads the releases from baseURL, where each release is published under its file name.
+func NewReleases(baseURL string, insecure bool) *Releases {
+	client := &http.Client{Timeout: downloadTimeout}
+	if insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		client.Transport = transport
+	}
+	return &Releases{baseURL: strings.TrimSuffix(baseURL, "/"), client: client}
+}
+
+// Formats downloads a release, e.g. DROID_SignatureFile_V120.xml, and returns its formats.
+func (r *Releases) Formats(ctx context.Context, release string) ([]Format, error) {
+	if err := CheckRelease(release); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/"+url.PathEscape(release), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading PRONOM release %s: %w", release, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.Classify(utils.ErrNetwork, fmt.Errorf("error downloading PRONOM release %s: %s", release, resp.Status))
+	}
+	formats, err := ParseRelease(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading PRONOM release %s: %w", release, err)
+	}
+	return formats, nil
+}
+
+// ParseRelease reads the formats of a DROID signature file, in the order of the file.
+func ParseRelease(r io.Reader) ([]Format, error) {
+	var formats []Format
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "FileFormat" {
+			continue
+		}
+		var format Format
+		for _, attr := range element.Attr {
+			switch attr.Name.Local {
+			case "PUID":
+				format.PUID = attr.Value
+			case "Name":
+				format.Name = attr.Value
+			case "Version":
+				format.Version = attr.Value
+			}
+		}
+		if format.PUID != "" {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		return nil, errors.New("no file formats, not a DROID signature file")
+	}
+	return formats, nil
+}
@@ -0,0 +1,76 @@
+package pronom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Signatures describes the signature file siegfried loads, as reported by sf -version.
+type Signatures struct {
+	Version   string `json:"version"`             // siegfried version, e.g. siegfried 1.11.1
+	File      string `json:"file"`                // Signature file with its creation date
+	Release   string `json:"release,omitempty"`   // PRONOM release the signature file is built from
+	Container string `json:"container,omitempty"` // Container signature file the signature file is built from
+}
+
+// ReadSignatures returns the signature file loaded by the siegfried binary sf.
+func ReadSignatures(ctx context.Context, sf string) (*Signatures, error) {
+	output, err := runSiegfried(ctx, sf, "-version")
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) < 2 || !strings.Contains(lines[1], ".sig") {
+		return nil, errors.New("siegfried loads no signature file")
+	}
+	signatures := &Signatures{
+		Version: strings.TrimSpace(lines[0]),
+		File:    strings.TrimSpace(lines[1]),
+	}
+	// The PRONOM identifier lists its DROID and container signature files, e.g.
+	//   - pronom: DROID_SignatureFile_V120.xml; container-signature-20240715.xml
+	for _, line := range lines[2:] {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-"))
+		files, ok := strings.CutPrefix(line, "pronom:")
+		if !ok {
+			continue
+		}
+		for _, file := range strings.Split(files, ";") {
+			file = strings.TrimSpace(file)
+			switch {
+			case releasePattern.MatchString(file):
+				signatures.Release = file
+			case strings.HasPrefix(file, "container-signature"):
+				signatures.Container = file
+			}
+		}
+		break
+	}
+	return signatures, nil
+}
+
+// updateSignatures updates the signature file of the siegfried binary sf with sf -update, which downloads the
+// signature file of the latest PRONOM release if it is newer. Returns the output of siegfried.
+func updateSignatures(ctx context.Context, sf string) (string, error) {
+	return runSiegfried(ctx, sf, "-update")
+}
+
+// runSiegfried runs the siegfried binary sf and returns its output.
+func runSiegfried(ctx context.Context, sf string, args ...string) (string, error) {
+	if sf == "" {
+		return "", errors.New("no siegfried binary is set")
+	}
+	// #nosec G204 -- the binary is chosen by the operator
+	output, err := exec.CommandContext(ctx, sf, args...).CombinedOutput()
+	if err != nil {
+		if len(bytes.TrimSpace(output)) == 0 {
+			return "", fmt.Errorf("error running siegfried: %w", err)
+		}
+		return "", fmt.Errorf("error running siegfried: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,97 @@
+package pronom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// ErrNoRelease is returned when the signature file does not name the PRONOM release it is built from.
+var ErrNoRelease = errors.New("the signature file does not name its PRONOM release, it is not built from a DROID signature file")
+
+// syncMu serializes the syncs, which write the signature file of siegfried.
+var syncMu sync.Mutex
+
+// Sync is the result of a PRONOM sync.
+type Sync struct {
+	Before     *Signatures `json:"before"`
+	After      *Signatures `json:"after"`
+	Updated    bool        `json:"updated"`     // False if the signature file was already the latest
+	Output     string      `json:"output"`      // Output of sf -update
+	Since      string      `json:"since"`       // Release the formats of the updated signature file are compared with
+	NewFormats []Format    `json:"new_formats"` // Formats added since that release, with their policy
+	Unpoliced  []Format    `json:"unpoliced"`   // New formats without a policy
+}
+
+// SyncPolicies updates the signature file of the siegfried binary sf to the latest PRONOM release, and diffs the
+// formats of its release against those of the previous signature file, or of the since release if set. Formats added
+// since are looked up in the format policy registry, those without a policy are flagged as unpoliced. If the
+// signature file was already the latest, formats are only compared with the since release.
+func SyncPolicies(ctx context.Context, sf string, releases *Releases, policies *config.FormatPoliciesConfig, since string) (*Sync, error) {
+	if since != "" {
+		if err := CheckRelease(since); err != nil {
+			return nil, err
+		}
+	}
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	before, err := ReadSignatures(ctx, sf)
+	if err != nil {
+		return nil, err
+	}
+	output, err := updateSignatures(ctx, sf)
+	if err != nil {
+		return nil, err
+	}
+	after, err := ReadSignatures(ctx, sf)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the updated signature file: %w", err)
+	}
+	result := &Sync{
+		Before:     before,
+		After:      after,
+		Updated:    *after != *before,
+		Output:     output,
+		Since:      since,
+		NewFormats: []Format{},
+		Unpoliced:  []Format{},
+	}
+	if result.Since == "" {
+		result.Since = before.Release
+	}
+	if result.Since == "" || after.Release == "" {
+		return nil, ErrNoRelease
+	}
+	if result.Since == after.Release {
+		return result, nil
+	}
+
+	previous, err := releases.Formats(ctx, result.Since)
+	if err != nil {
+		return nil, err
+	}
+	current, err := releases.Formats(ctx, after.Release)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(previous))
+	for _, format := range previous {
+		known[format.PUID] = true
+	}
+	for _, format := range current {
+		if known[format.PUID] {
+			continue
+		}
+		if policy := policies.Policy(format.PUID); policy != nil {
+			format.Policy = policy.Action
+		} else {
+			result.Unpoliced = append(result.Unpoliced, format)
+		}
+		result.NewFormats = append(result.NewFormats, format)
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package pronom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// fakeSiegfried is a siegfried binary whose signature file is built from the release in the release file next to it,
+// and updated to V120 by sf -update.
+const fakeSiegfried = `#!/bin/sh
+dir=$(dirname "$0")
+if [ "$1" = "-update" ]; then
+	echo "V120" > "$dir/release"
+	echo "Your signature file has been updated"
+	exit 0
+fi
+echo "siegfried 1.11.1"
+echo "/home/sf/default.sig ($(cat "$dir/release"))"
+echo "identifiers:"
+echo "  - pronom: DROID_SignatureFile_$(cat "$dir/release").xml; container-signature-20240715.xml"
+`
+
+const releaseV119 = `<?xml version="1.0" encoding="UTF-8"?>
+<FFSignatureFile xmlns="http://www.nationalarchives.gov.uk/pronom/SignatureFile" Version="119">
+  <InternalSignatureCollection/>
+  <FileFormatCollection>
+    <FileFormat ID="1" Name="Broadcast WAVE" PUID="fmt/1" Version="0 Generic"/>
+    <FileFormat ID="2" Name="Acrobat PDF 1.7" PUID="fmt/276" Version="1.7"/>
+  </FileFormatCollection>
+</FFSignatureFile>`
+
+const releaseV120 = `<?xml version="1.0" encoding="UTF-8"?>
+<FFSignatureFile xmlns="http://www.nationalarchives.gov.uk/pronom/SignatureFile" Version="120">
+  <FileFormatCollection>
+    <FileFormat ID="1" Name="Broadcast WAVE" PUID="fmt/1" Version="0 Generic"/>
+    <FileFormat ID="2" Name="Acrobat PDF 1.7" PUID="fmt/276" Version="1.7"><Extension>pdf</Extension></FileFormat>
+    <FileFormat ID="3" Name="New Format" PUID="fmt/2001" Version="2"/>
+    <FileFormat ID="4" Name="Another Format" PUID="fmt/2002"/>
+  </FileFormatCollection>
+</FFSignatureFile>`
+
+// newTestReleases returns a siegfried binary loading the signature file of release V119, and the releases V119 and
+// V120 served by a test server.
+func newTestReleases(t *testing.T) (string, *Releases) {
+	t.Helper()
+	dir := t.TempDir()
+	sf := filepath.Join(dir, "sf")
+	if err := os.WriteFile(sf, []byte(fakeSiegfried), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "release"), []byte("V119\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/documents/DROID_SignatureFile_V119.xml":
+			_, _ = w.Write([]byte(releaseV119))
+		case "/documents/DROID_SignatureFile_V120.xml":
+			_, _ = w.Write([]byte(releaseV120))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return sf, NewReleases(server.URL+"/documents/", false)
+}
+
+func TestSyncPolicies(t *testing.T) {
+	sf, releases := newTestReleases(t)
+	policies := &config.FormatPoliciesConfig{Policies: []*config.FormatPolicy{{PUID: "fmt/2001", Action: config.FormatPolicyPreserve}}}
+
+	result, err := SyncPolicies(context.Background(), sf, releases, policies, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Updated || result.Before.Release != "DROID_SignatureFile_V119.xml" || result.After.Release != "DROID_SignatureFile_V120.xml" {
+		t.Errorf("updated %v from %q to %q, want the update from V119 to V120", result.Updated, result.Before.Release, result.After.Release)
+	}
+	if result.Since != "DROID_SignatureFile_V119.xml" {
+		t.Errorf("since %q, want the release before the update", result.Since)
+	}
+	wantNew := []Format{
+		{PUID: "fmt/2001", Name: "New Format", Version: "2", Policy: config.FormatPolicyPreserve},
+		{PUID: "fmt/2002", Name: "Another Format"},
+	}
+	if !reflect.DeepEqual(result.NewFormats, wantNew) {
+		t.Errorf("new formats %+v, want %+v", result.NewFormats, wantNew)
+	}
+	if want := wantNew[1:]; !reflect.DeepEqual(result.Unpoliced, want) {
+		t.Errorf("unpoliced formats %+v, want %+v", result.Unpoliced, want)
+	}
+
+	// The signature file is the latest, formats are only listed since an earlier release
+	result, err = SyncPolicies(context.Background(), sf, releases, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Updated || len(result.NewFormats) != 0 {
+		t.Errorf("updated %v with new formats %+v, want neither", result.Updated, result.NewFormats)
+	}
+	result, err = SyncPolicies(context.Background(), sf, releases, nil, "DROID_SignatureFile_V119.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.NewFormats) != 2 || len(result.Unpoliced) != 2 {
+		t.Errorf("%d new and %d unpoliced formats since V119 without a registry, want 2 of each", len(result.NewFormats), len(result.Unpoliced))
+	}
+
+	if _, err := SyncPolicies(context.Background(), sf, releases, nil, "../V119.xml"); !errors.Is(err, ErrInvalidRelease) {
+		t.Errorf("error %v for an invalid since release, want ErrInvalidRelease", err)
+	}
+}
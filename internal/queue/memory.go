@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// memoryQueueSize is the number of jobs waiting in the in-memory queue.
+const memoryQueueSize = 100
+
+// memoryQueue keeps the jobs of a single instance in memory. Queued jobs are lost when the service stops.
+type memoryQueue struct {
+	size   int
+	aging  time.Duration // Wait after which a job gains a priority level
+	notify chan struct{} // Wakes the consumer up when a job is queued
+
+	mu      sync.Mutex
+	queued  []*Job // Jobs waiting to run, in the order they were queued
+	running map[string]bool
+}
+
+func newMemoryQueue(size int, aging time.Duration) *memoryQueue {
+	return &memoryQueue{
+		size:    size,
+		aging:   aging,
+		notify:  make(chan struct{}, 1),
+		running: make(map[string]bool),
+	}
+}
+
+func (q *memoryQueue) Enqueue(_ context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.find(job.ID) >= 0 || q.running[job.ID] {
+		return ErrDuplicate
+	}
+	if len(q.queued) >= q.size {
+		return ErrFull
+	}
+	if job.QueuedAt.IsZero() {
+		job.QueuedAt = time.Now().UTC()
+	}
+	q.queued = append(q.queued, job)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *memoryQueue) Consume(ctx context.Context, handler Handler) error {
+	for ctx.Err() == nil {
+		job, wait := q.next()
+		if job == nil {
+			// Held jobs are due again after the wait
+			var due <-chan time.Time
+			if wait > 0 {
+				due = time.After(wait)
+			}
+			select {
+			case <-ctx.Done():
+			case <-q.notify:
+			case <-due:
+			}
+			continue
+		}
+		err := handler(ctx, job)
+		deferred := errors.Is(err, ErrDeferred)
+		switch {
+		case deferred:
+			logger.Info("Job %s deferred until %s", job.ID, job.HeldUntil.Format(time.RFC3339))
+		case errors.Is(err, ErrInterrupted):
+			logger.Warn("Job %s interrupted, it is lost with the in-memory queue", job.ID)
+		case err != nil:
+			logger.Error("Error running job %s: %v", job.ID, err)
+		}
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		if deferred {
+			q.queued = append(q.queued, job)
+		}
+		q.mu.Unlock()
+	}
+	return nil
+}
+
+func (q *memoryQueue) List(_ context.Context) ([]*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]*Job, 0, len(q.queued))
+	for _, job := range q.queued {
+		copied := *job
+		jobs = append(jobs, &copied)
+	}
+	return jobs, nil
+}
+
+func (q *memoryQueue) Stats(_ context.Context) (Stats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return Stats{Queued: len(q.queued), Running: len(q.running)}, nil
+}
+
+// next takes the queued job to run next and marks it running. Returns nil if no job is due, with the wait until the
+// next held job is due, or 0 if no job is held.
+func (q *memoryQueue) next() (*Job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	i := -1
+	var wait time.Duration
+	for j, job := range q.queued {
+		if job.HeldUntil.After(now) {
+			if until := job.HeldUntil.Sub(now); wait == 0 || until < wait {
+				wait = until
+			}
+			continue
+		}
+		if i < 0 || job.before(q.queued[i], q.aging) {
+			i = j
+		}
+	}
+	if i < 0 {
+		return nil, wait
+	}
+	job := q.queued[i]
+	q.queued = append(q.queued[:i], q.queued[i+1:]...)
+	q.running[job.ID] = true
+	if len(q.queued) > 0 {
+		// Wake up another consumer, if any, for the remaining jobs
+		select {
+		case q.notify <- struct{}{}:
+		default:
+		}
+	}
+	return job, 0
+}
+
+// find returns the index of a queued job, or -1 if no job with the ID is queued.
+func (q *memoryQueue) find(id string) int {
+	for i, job := range q.queued {
+		if job.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *memoryQueue) Remove(_ context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := q.find(id); i >= 0 {
+		q.queued = append(q.queued[:i], q.queued[i+1:]...)
+		return nil
+	}
+	if q.running[id] {
+		return ErrRunning
+	}
+	return ErrNotFound
+}
+
+func (q *memoryQueue) Ping(_ context.Context) error {
+	return nil
+}
+
+func (q *memoryQueue) Close() error {
+	return nil
+}
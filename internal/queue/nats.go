@@ -0,0 +1,270 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// natsQueue keeps the jobs in a JetStream work queue stream, consumed through a durable consumer shared by
+// every instance. Jobs are delivered at least once: a job is acknowledged when its handler returns, and
+// redelivered to another instance if the consuming instance stops before. Jobs are delivered in the order they were
+// published, their priority is ignored.
+type natsQueue struct {
+	conn     *nats.Conn
+	js       jetstream.JetStream
+	stream   jetstream.Stream
+	consumer jetstream.Consumer
+	subject  string
+	ackWait  time.Duration
+}
+
+func newNATSQueue(ctx context.Context, cfg *config.Config) (*natsQueue, error) {
+	ncfg := cfg.Queue.NATS
+	if ncfg.URL == "" {
+		return nil, fmt.Errorf("no NATS server URL set for the nats queue backend")
+	}
+	opts := []nats.Option{
+		nats.Name("curate-preservation-core"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Warn("Disconnected from NATS: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Info("Reconnected to NATS: %s", conn.ConnectedUrlRedacted())
+		}),
+	}
+	if ncfg.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(ncfg.CredsFile))
+	}
+	conn, err := nats.Connect(ncfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NATS: %w", err)
+	}
+	q := &natsQueue{conn: conn, subject: ncfg.Subject, ackWait: ncfg.AckWait}
+	if err := q.setup(ctx, cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	logger.Info("Using NATS JetStream queue: stream %s, consumer %s", ncfg.Stream, ncfg.Consumer)
+	return q, nil
+}
+
+// setup creates or updates the stream and the durable consumer of the jobs.
+func (q *natsQueue) setup(ctx context.Context, cfg *config.Config) error {
+	ncfg := cfg.Queue.NATS
+	js, err := jetstream.New(q.conn)
+	if err != nil {
+		return fmt.Errorf("error opening JetStream: %w", err)
+	}
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        ncfg.Stream,
+		Description: "Curate preservation jobs",
+		Subjects:    []string{ncfg.Subject},
+		Retention:   jetstream.WorkQueuePolicy,
+		Storage:     jetstream.FileStorage,
+		Replicas:    max(ncfg.Replicas, 1),
+		Duplicates:  ncfg.DuplicateWindow,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating stream %s: %w", ncfg.Stream, err)
+	}
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       ncfg.Consumer,
+		Description:   "Curate preservation workers",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ncfg.AckWait,
+		MaxDeliver:    ncfg.MaxDeliver,
+		FilterSubject: ncfg.Subject,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating consumer %s: %w", ncfg.Consumer, err)
+	}
+	q.js = js
+	q.stream = stream
+	q.consumer = consumer
+	return nil
+}
+
+// Enqueue publishes a job with its ID as message ID, so the same job published by several instances within the
+// duplicate window of the stream is only stored once.
+func (q *natsQueue) Enqueue(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	ack, err := q.js.Publish(ctx, q.subject, data, jetstream.WithMsgID(job.ID))
+	if err != nil {
+		return fmt.Errorf("error publishing job: %w", err)
+	}
+	if ack.Duplicate {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (q *natsQueue) Consume(ctx context.Context, handler Handler) error {
+	for ctx.Err() == nil {
+		msg, err := q.consumer.Next(jetstream.FetchContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			if !errors.Is(err, nats.ErrTimeout) {
+				logger.Warn("Error fetching job: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(5 * time.Second):
+				}
+			}
+			continue
+		}
+		q.handle(ctx, msg, handler)
+	}
+	return nil
+}
+
+// handle runs the handler on a job, marking it in progress so that it is not redelivered while it runs.
+func (q *natsQueue) handle(ctx context.Context, msg jetstream.Msg, handler Handler) {
+	var job Job
+	if err := json.Unmarshal(msg.Data(), &job); err != nil {
+		logger.Error("Discarding invalid job: %v", err)
+		_ = msg.TermWithReason("invalid job")
+		return
+	}
+	if meta, err := msg.Metadata(); err == nil && meta.NumDelivered > 1 {
+		logger.Warn("Job %s redelivered (delivery %d), its previous run did not complete", job.ID, meta.NumDelivered)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(q.ackWait / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					logger.Warn("Error extending job %s: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	err := handler(ctx, &job)
+	if errors.Is(err, ErrDeferred) {
+		// The message is redelivered once the job is due, deferrals count as deliveries
+		logger.Info("Job %s deferred until %s", job.ID, job.HeldUntil.Format(time.RFC3339))
+		_ = msg.NakWithDelay(time.Until(job.HeldUntil))
+		return
+	}
+	if errors.Is(err, ErrInterrupted) {
+		// The job was interrupted by a shutdown, let another instance run it
+		_ = msg.Nak()
+		return
+	}
+	if err != nil {
+		logger.Error("Error running job %s: %v", job.ID, err)
+	}
+	// Failed preservations are recorded in their package record and are not retried
+	if err := msg.Ack(); err != nil {
+		logger.Error("Error acknowledging job %s: %v", job.ID, err)
+	}
+}
+
+// Remove deletes the message of a queued job from the stream. Messages up to the last sequence delivered to the
+// consumer are running on an instance, or waiting to be redelivered, and are not removed.
+func (q *natsQueue) Remove(ctx context.Context, id string) error {
+	streamInfo, err := q.stream.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading stream: %w", err)
+	}
+	consumerInfo, err := q.consumer.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading consumer: %w", err)
+	}
+	for seq := streamInfo.State.FirstSeq; seq <= streamInfo.State.LastSeq && seq > 0; seq++ {
+		msg, err := q.stream.GetMsg(ctx, seq)
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading job: %w", err)
+		}
+		if msg.Header.Get(jetstream.MsgIDHeader) != id {
+			continue
+		}
+		if seq <= consumerInfo.Delivered.Stream {
+			return ErrRunning
+		}
+		if err := q.stream.DeleteMsg(ctx, seq); err != nil {
+			return fmt.Errorf("error removing job: %w", err)
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+// List reads the messages of the stream after the last sequence delivered to the consumer, which are not running yet.
+func (q *natsQueue) List(ctx context.Context) ([]*Job, error) {
+	streamInfo, err := q.stream.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stream: %w", err)
+	}
+	consumerInfo, err := q.consumer.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading consumer: %w", err)
+	}
+	var jobs []*Job
+	for seq := max(streamInfo.State.FirstSeq, consumerInfo.Delivered.Stream+1); seq <= streamInfo.State.LastSeq && seq > 0; seq++ {
+		msg, err := q.stream.GetMsg(ctx, seq)
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading job: %w", err)
+		}
+		var job Job
+		if err := json.Unmarshal(msg.Data, &job); err != nil {
+			logger.Warn("Skipping invalid job %d: %v", seq, err)
+			continue
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// Stats counts the messages not delivered yet as queued, and the messages delivered but not acknowledged as running.
+func (q *natsQueue) Stats(ctx context.Context) (Stats, error) {
+	info, err := q.consumer.Info(ctx)
+	if err != nil {
+		return Stats{}, fmt.Errorf("error reading consumer: %w", err)
+	}
+	return Stats{Queued: int(info.NumPending), Running: info.NumAckPending}, nil //nolint:gosec // Job counts fit in an int
+}
+
+func (q *natsQueue) Ping(ctx context.Context) error {
+	if !q.conn.IsConnected() {
+		return fmt.Errorf("not connected to NATS: %s", q.conn.Status())
+	}
+	if _, err := q.stream.Info(ctx); err != nil {
+		return fmt.Errorf("error reading job stream: %w", err)
+	}
+	return nil
+}
+
+func (q *natsQueue) Close() error {
+	return q.conn.Drain()
+}
@@ -0,0 +1,187 @@
+// Package queue holds the preservation jobs of watched Cells uploads and intake transfers until a worker runs them.
+// Jobs are kept in a SQLite database by default, so that they survive a restart, in memory, or in a Postgres
+// database or a NATS JetStream stream shared by several service instances. Workers run the jobs with the highest
+// priority first, except on NATS.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// Queue backends.
+const (
+	BackendMemory   = "memory"
+	BackendSQLite   = "sqlite"
+	BackendPostgres = "postgres"
+	BackendNATS     = "nats"
+)
+
+var (
+	// ErrDuplicate is returned when a job with the same ID is already queued or running.
+	ErrDuplicate = errors.New("job already queued")
+	// ErrFull is returned when the in-memory queue has no room for another job.
+	ErrFull = errors.New("queue is full")
+	// ErrNotFound is returned when no job with the ID is queued or running.
+	ErrNotFound = errors.New("job not found")
+	// ErrRunning is returned when a job cannot be removed because it is running.
+	ErrRunning = errors.New("job is running")
+	// ErrInterrupted is returned by handlers, wrapped or not, when a job is interrupted by a shutdown. The job is
+	// queued again, to run on the next start or on another instance.
+	ErrInterrupted = errors.New("job interrupted")
+	// ErrDeferred is returned by handlers, wrapped or not, when a job cannot run yet, e.g. while its tenant is over
+	// quota. The job is queued again and held until its HeldUntil time.
+	ErrDeferred = errors.New("job deferred")
+)
+
+// Job is a package waiting to be preserved.
+type Job struct {
+	// ID identifies the package, jobs with the same ID are only queued once
+	ID       string    `json:"id"`
+	Username string    `json:"username"`
+	Tenant   string    `json:"tenant,omitempty"` // Tenant the package is preserved for, if it was submitted by one
+	Path     string    `json:"path"`
+	Source   string    `json:"source,omitempty"` // Transfer source the path is pulled from, Cells otherwise
+	Profile  string    `json:"profile,omitempty"`
+	Deselect []string  `json:"deselect,omitempty"` // Paths or patterns removed during appraisal
+	QueuedAt time.Time `json:"queued_at"`
+	// Callback receives the outcome of the job once it finishes, if set
+	Callback *Callback `json:"callback,omitempty"`
+	// Metadata fills in the Dublin Core and ISAD(G) fields the package does not have, keyed as in metadata.json
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Batch    string            `json:"batch,omitempty"` // Batch the job was submitted with, if any
+	Priority Priority          `json:"priority,omitempty"`
+	// HeldUntil is the time before which a deferred job is not run again, set by the handler that deferred it
+	HeldUntil time.Time `json:"held_until,omitzero"`
+}
+
+// Priority orders the queued jobs: jobs with a higher priority run first, and jobs with the same priority run in the
+// order they were queued.
+type Priority int
+
+// Priorities of the jobs, normal by default.
+const (
+	PriorityLow    Priority = -1 // Background work, e.g. the ingest of a backlog
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+	PriorityUrgent Priority = 2 // e.g. the reprocessing of a package needed now
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+	PriorityUrgent: "urgent",
+}
+
+// ParsePriority returns the priority of a name: low, normal, high or urgent. An empty name is the normal priority.
+func ParsePriority(name string) (Priority, error) {
+	if name == "" {
+		return PriorityNormal, nil
+	}
+	for p, n := range priorityNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q, expected low, normal, high or urgent", name)
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// MarshalText encodes the priority as its name.
+func (p Priority) MarshalText() ([]byte, error) {
+	if _, ok := priorityNames[p]; !ok {
+		return nil, fmt.Errorf("unknown priority %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a priority from its name.
+func (p *Priority) UnmarshalText(text []byte) error {
+	priority, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = priority
+	return nil
+}
+
+// rank orders the queued jobs, lowest first. A job gains a priority level for each aging interval it waits, so that
+// jobs with a low priority are not starved by a steady flow of jobs with higher priorities. Without aging, jobs are
+// ordered by priority only.
+func (j *Job) rank(aging time.Duration) (int64, int64) {
+	if aging <= 0 {
+		return -int64(j.Priority), j.QueuedAt.UnixNano()
+	}
+	return j.QueuedAt.UnixNano() - int64(j.Priority)*int64(aging), j.QueuedAt.UnixNano()
+}
+
+// before reports whether a job runs before another.
+func (j *Job) before(other *Job, aging time.Duration) bool {
+	a1, a2 := j.rank(aging)
+	b1, b2 := other.rank(aging)
+	return a1 < b1 || (a1 == b1 && a2 < b2)
+}
+
+// Callback is where the outcome of a job is posted, e.g. the webhook trigger of a Cells Flow.
+type Callback struct {
+	URL       string `json:"url"`
+	Reference string `json:"reference,omitempty"` // Returned with the outcome, e.g. the ID of the Flow run
+}
+
+// Stats are the number of jobs in a queue.
+type Stats struct {
+	Queued  int `json:"queued"`  // Jobs waiting to run
+	Running int `json:"running"` // Jobs running, or waiting to be run again after their instance stopped
+}
+
+// Handler preserves the package of a job.
+type Handler func(ctx context.Context, job *Job) error
+
+// Queue holds jobs until they are consumed.
+type Queue interface {
+	// Enqueue adds a job to the queue. Returns ErrDuplicate if a job with the same ID is already queued.
+	Enqueue(ctx context.Context, job *Job) error
+	// Consume runs the handler on the queued jobs, one at a time, until the context is cancelled.
+	// A job is removed from the queue once its handler returns, even if it failed, unless it returns
+	// ErrInterrupted or ErrDeferred. The in-memory queue loses interrupted jobs.
+	Consume(ctx context.Context, handler Handler) error
+	// Remove removes a queued job before it runs. Returns ErrRunning if the job is running, or ErrNotFound if no
+	// job with the ID is queued.
+	Remove(ctx context.Context, id string) error
+	// List returns the queued jobs that are not running yet, of every instance sharing the queue, in no particular
+	// order.
+	List(ctx context.Context) ([]*Job, error)
+	// Stats returns the number of queued and running jobs, of every instance sharing the queue.
+	Stats(ctx context.Context) (Stats, error)
+	// Ping checks the connection to the queue backend.
+	Ping(ctx context.Context) error
+	// Close releases the connections of the queue.
+	Close() error
+}
+
+// New opens the queue of the configured backend.
+func New(ctx context.Context, cfg *config.Config) (Queue, error) {
+	switch cfg.Queue.Backend {
+	case BackendMemory:
+		return newMemoryQueue(memoryQueueSize, cfg.Queue.PriorityAging), nil
+	case "", BackendSQLite:
+		return newSQLiteQueue(ctx, cfg)
+	case BackendPostgres:
+		return newPostgresQueue(ctx, cfg)
+	case BackendNATS:
+		return newNATSQueue(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("unknown queue backend: %s", cfg.Queue.Backend)
+	}
+}
@@ -0,0 +1,401 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib" // Postgres driver
+	_ "github.com/mattn/go-sqlite3"    // SQLite driver
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	// sqlPollInterval is how often the store is polled for jobs queued by other instances.
+	sqlPollInterval = 2 * time.Second
+	// sqliteLease is the lease of the jobs run from a SQLite store, which belongs to a single instance.
+	sqliteLease = 5 * time.Minute
+)
+
+const sqlSchema = `CREATE TABLE IF NOT EXISTS preservation_jobs (
+	id TEXT PRIMARY KEY,
+	job TEXT NOT NULL,
+	state TEXT NOT NULL,
+	queued_at BIGINT NOT NULL,
+	owner TEXT NOT NULL DEFAULT '',
+	lease_until BIGINT NOT NULL DEFAULT 0,
+	priority INTEGER NOT NULL DEFAULT 0,
+	held_until BIGINT NOT NULL DEFAULT 0
+)`
+
+// sqlColumns are the columns added to the jobs table after its first version.
+var sqlColumns = []struct{ name, definition string }{
+	{"priority", "INTEGER NOT NULL DEFAULT 0"},
+	{"held_until", "BIGINT NOT NULL DEFAULT 0"},
+}
+
+// Job states.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+)
+
+// sqlQueue keeps the jobs in a SQLite or Postgres table, so that queued jobs survive a restart. A running job
+// is leased by its instance and its lease is extended while it runs: a job whose lease expired, e.g. because its
+// instance crashed, is run again. Jobs are removed once their handler returns.
+type sqlQueue struct {
+	db       *sql.DB
+	postgres bool
+	owner    string        // Identifies the leases of this instance
+	lease    time.Duration // Time without progress before a running job is run again
+	notify   chan struct{} // Wakes the consumer up when a job is queued by this instance
+	aging    time.Duration // Wait after which a queued job gains a priority level
+}
+
+func newSQLiteQueue(ctx context.Context, cfg *config.Config) (*sqlQueue, error) {
+	dbPath := cfg.Queue.SQLite.Path
+	if dbPath == "" {
+		if cfg.DataDir == "" {
+			return nil, fmt.Errorf("no database path or data directory set for the sqlite queue backend")
+		}
+		dbPath = filepath.Join(cfg.DataDir, "jobs.db")
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o750); err != nil {
+		return nil, fmt.Errorf("error creating queue directory: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("error opening queue database: %w", err)
+	}
+	// SQLite has a single writer
+	db.SetMaxOpenConns(1)
+	q := &sqlQueue{db: db, owner: uuid.NewString(), lease: sqliteLease, notify: make(chan struct{}, 1), aging: cfg.Queue.PriorityAging}
+	if err := q.setup(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	// The database belongs to this instance, jobs left running were interrupted by a stop or a crash
+	res, err := db.ExecContext(ctx, `UPDATE preservation_jobs SET state = ?, owner = '', lease_until = 0 WHERE state = ?`,
+		jobQueued, jobRunning)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error recovering interrupted jobs: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logger.Warn("Requeued %d interrupted jobs", n)
+	}
+	q.logPending(ctx)
+	logger.Info("Using SQLite job queue: %s", dbPath)
+	return q, nil
+}
+
+func newPostgresQueue(ctx context.Context, cfg *config.Config) (*sqlQueue, error) {
+	pcfg := cfg.Queue.Postgres
+	if pcfg.URL == "" {
+		return nil, fmt.Errorf("no database URL set for the postgres queue backend")
+	}
+	db, err := sql.Open("pgx", pcfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error opening queue database: %w", err)
+	}
+	q := &sqlQueue{db: db, postgres: true, owner: uuid.NewString(), lease: pcfg.Lease, notify: make(chan struct{}, 1),
+		aging: cfg.Queue.PriorityAging}
+	if err := q.setup(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	// Other instances may be running jobs, interrupted jobs are run again once their lease expires
+	q.logPending(ctx)
+	logger.Info("Using Postgres job queue")
+	return q, nil
+}
+
+// setup creates the jobs table, and adds the columns missing from the tables created by previous versions.
+func (q *sqlQueue) setup(ctx context.Context) error {
+	if err := q.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("error connecting to queue database: %w", err)
+	}
+	if _, err := q.db.ExecContext(ctx, sqlSchema); err != nil {
+		return fmt.Errorf("error creating jobs table: %w", err)
+	}
+	for _, column := range sqlColumns {
+		rows, err := q.db.QueryContext(ctx, `SELECT `+column.name+` FROM preservation_jobs LIMIT 0`)
+		if err == nil {
+			_ = rows.Close()
+			continue
+		}
+		if _, err := q.db.ExecContext(ctx, `ALTER TABLE preservation_jobs ADD COLUMN `+column.name+` `+column.definition); err != nil {
+			return fmt.Errorf("error adding %s to jobs table: %w", column.name, err)
+		}
+	}
+	return nil
+}
+
+// order returns the ORDER BY clause of the queued jobs, the job to run next first. See Job.rank.
+func (q *sqlQueue) order() string {
+	if q.aging <= 0 {
+		return "ORDER BY priority DESC, queued_at"
+	}
+	return fmt.Sprintf("ORDER BY queued_at - priority * %d, queued_at", q.aging.Nanoseconds())
+}
+
+// logPending logs the jobs recovered from a previous run.
+func (q *sqlQueue) logPending(ctx context.Context) {
+	var n int
+	if err := q.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM preservation_jobs`).Scan(&n); err != nil {
+		logger.Warn("Error counting queued jobs: %v", err)
+		return
+	}
+	if n > 0 {
+		logger.Info("Recovered %d queued jobs", n)
+	}
+}
+
+// query rewrites the ? placeholders of a query for the database.
+func (q *sqlQueue) query(query string) string {
+	if !q.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (q *sqlQueue) Enqueue(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	queuedAt := job.QueuedAt
+	if queuedAt.IsZero() {
+		queuedAt = time.Now()
+	}
+	res, err := q.db.ExecContext(ctx, q.query(`INSERT INTO preservation_jobs (id, job, state, queued_at, priority)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`), job.ID, string(data), jobQueued, queuedAt.UnixNano(), int(job.Priority))
+	if err != nil {
+		return fmt.Errorf("error storing job: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrDuplicate
+	}
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *sqlQueue) Consume(ctx context.Context, handler Handler) error {
+	for ctx.Err() == nil {
+		job, err := q.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("Error fetching job: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-q.notify:
+			case <-time.After(sqlPollInterval):
+			}
+			continue
+		}
+		q.handle(ctx, job, handler)
+	}
+	return nil
+}
+
+// claim leases the queued job to run next, by priority and age, or a running job whose lease expired. Held jobs are
+// skipped until they are due. Returns nil if there is none.
+func (q *sqlQueue) claim(ctx context.Context) (*Job, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	selectQuery := `SELECT id, job, state FROM preservation_jobs WHERE (state = ? AND held_until <= ?) OR (state = ? AND lease_until < ?) ` +
+		q.order() + ` LIMIT 1`
+	if q.postgres {
+		// Instances claim different jobs
+		selectQuery += " FOR UPDATE SKIP LOCKED"
+	}
+	var id, data, state string
+	err = tx.QueryRowContext(ctx, q.query(selectQuery), jobQueued, now.UnixNano(), jobRunning, now.UnixNano()).Scan(&id, &data, &state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		logger.Error("Discarding invalid job %s: %v", id, err)
+		if _, err := tx.ExecContext(ctx, q.query(`DELETE FROM preservation_jobs WHERE id = ?`), id); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	}
+	if _, err := tx.ExecContext(ctx, q.query(`UPDATE preservation_jobs SET state = ?, owner = ?, lease_until = ? WHERE id = ?`),
+		jobRunning, q.owner, now.Add(q.lease).UnixNano(), id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if state == jobRunning {
+		logger.Warn("Job %s run again, its previous run did not complete", job.ID)
+	}
+	return &job, nil
+}
+
+// handle runs the handler on a job, extending its lease so that it is not run again while it runs.
+func (q *sqlQueue) handle(ctx context.Context, job *Job, handler Handler) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(q.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := q.extend(job.ID); err != nil {
+					logger.Warn("Error extending job %s: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	err := handler(ctx, job)
+	interrupted, deferred := errors.Is(err, ErrInterrupted), errors.Is(err, ErrDeferred)
+	if err != nil && !interrupted && !deferred {
+		logger.Error("Error running job %s: %v", job.ID, err)
+	}
+	// The job is released or removed even if the context is cancelled
+	ctx = context.WithoutCancel(ctx)
+	switch {
+	case deferred:
+		// The job is held with its place in the queue, its handler may have updated it
+		var data []byte
+		if data, err = json.Marshal(job); err == nil {
+			logger.Info("Job %s deferred until %s", job.ID, job.HeldUntil.Format(time.RFC3339))
+			_, err = q.db.ExecContext(ctx, q.query(`UPDATE preservation_jobs SET job = ?, state = ?, owner = '', lease_until = 0,
+				held_until = ? WHERE id = ? AND owner = ?`), string(data), jobQueued, job.HeldUntil.UnixNano(), job.ID, q.owner)
+		}
+	case interrupted:
+		// The job was interrupted by a shutdown, run it again on the next start or on another instance
+		_, err = q.db.ExecContext(ctx, q.query(`UPDATE preservation_jobs SET state = ?, owner = '', lease_until = 0
+			WHERE id = ? AND owner = ?`), jobQueued, job.ID, q.owner)
+	default:
+		// Failed preservations are recorded in their package record and are not retried
+		_, err = q.db.ExecContext(ctx, q.query(`DELETE FROM preservation_jobs WHERE id = ? AND owner = ?`), job.ID, q.owner)
+	}
+	if err != nil {
+		logger.Error("Error completing job %s: %v", job.ID, err)
+	}
+}
+
+func (q *sqlQueue) Remove(ctx context.Context, id string) error {
+	res, err := q.db.ExecContext(ctx, q.query(`DELETE FROM preservation_jobs WHERE id = ? AND state = ?`), id, jobQueued)
+	if err != nil {
+		return fmt.Errorf("error removing job: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+	var state string
+	err = q.db.QueryRowContext(ctx, q.query(`SELECT state FROM preservation_jobs WHERE id = ?`), id).Scan(&state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ErrRunning
+}
+
+// extend extends the lease of a running job.
+func (q *sqlQueue) extend(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), q.lease/3)
+	defer cancel()
+	_, err := q.db.ExecContext(ctx, q.query(`UPDATE preservation_jobs SET lease_until = ? WHERE id = ? AND owner = ?`),
+		time.Now().Add(q.lease).UnixNano(), id, q.owner)
+	return err
+}
+
+func (q *sqlQueue) List(ctx context.Context) ([]*Job, error) {
+	rows, err := q.db.QueryContext(ctx, q.query(`SELECT id, job FROM preservation_jobs WHERE state = ?`), jobQueued)
+	if err != nil {
+		return nil, fmt.Errorf("error listing jobs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var jobs []*Job
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("error listing jobs: %w", err)
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			// Invalid jobs are discarded when they are claimed
+			logger.Warn("Skipping invalid job %s: %v", id, err)
+			continue
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
+
+func (q *sqlQueue) Stats(ctx context.Context) (Stats, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT state, COUNT(*) FROM preservation_jobs GROUP BY state`)
+	if err != nil {
+		return Stats{}, fmt.Errorf("error counting jobs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var stats Stats
+	for rows.Next() {
+		var state string
+		var n int
+		if err := rows.Scan(&state, &n); err != nil {
+			return Stats{}, fmt.Errorf("error counting jobs: %w", err)
+		}
+		switch state {
+		case jobQueued:
+			stats.Queued = n
+		case jobRunning:
+			stats.Running = n
+		}
+	}
+	return stats, rows.Err()
+}
+
+func (q *sqlQueue) Ping(ctx context.Context) error {
+	if err := q.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("error connecting to job database: %w", err)
+	}
+	return nil
+}
+
+func (q *sqlQueue) Close() error {
+	return q.db.Close()
+}
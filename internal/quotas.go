@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// QuotasService is the interface of the quotas used by the HTTP handlers.
+type QuotasService interface {
+	QuotaUsage(ctx context.Context) ([]*preservation.QuotaUsage, error)
+}
+
+// QuotaUsage returns the quotas with their current usage. Tenants only get their own quota.
+func (s *Service) QuotaUsage(ctx context.Context) ([]*preservation.QuotaUsage, error) {
+	return s.svc.QuotaUsage(preservation.TenantFromContext(ctx))
+}
+
+// CheckPackageSize checks that a package of the given size is under the package size quotas of the tenant of the
+// context and of the workspace of its Cells path.
+func (s *Service) CheckPackageSize(ctx context.Context, cellsPath string, size int64) error {
+	return s.svc.CheckPackageSize(ctx, cellsPath, size)
+}
+
+// jobCellsPath returns the Cells path of the package of a job, or "" if it is pulled from a source and its path is
+// not known yet.
+func jobCellsPath(job *queue.Job) string {
+	if job.Source != "" {
+		return ""
+	}
+	return job.Path
+}
+
+// admitJob checks that a submitted job is under the quotas of its tenant and workspace. Jobs over a quota that queues
+// its submissions are admitted, and held once they are consumed.
+func (s *Service) admitJob(job *queue.Job) error {
+	err := s.svc.CheckQuota(job.Tenant, jobCellsPath(job), "")
+	var qerr *preservation.QuotaError
+	if errors.As(err, &qerr) && qerr.Queue {
+		logger.Info("Package queued over quota, it is held until the quota allows it: %s: %v", job.Path, err)
+		return nil
+	}
+	return err
+}
+
+// holdJob defers a consumed job over a quota that queues its submissions, until the quota may allow it. Jobs over a
+// quota that rejects its submissions are run, and refused by the preservation.
+func (s *Service) holdJob(job *queue.Job) error {
+	err := s.svc.CheckQuota(job.Tenant, jobCellsPath(job), "")
+	var qerr *preservation.QuotaError
+	if errors.As(err, &qerr) && qerr.Queue {
+		job.HeldUntil = qerr.Until
+		return fmt.Errorf("%w: %w", queue.ErrDeferred, err)
+	}
+	return nil
+}
+
+// quotaErrorStatus returns the response status of a quota error: 413 if the package is too large, 429 otherwise.
+func quotaErrorStatus(err error) int {
+	var qerr *preservation.QuotaError
+	if errors.As(err, &qerr) && qerr.Limit == preservation.QuotaPackageBytes {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusTooManyRequests
+}
+
+// QuotasHandler responds with the quotas of the tenants and workspaces, with the storage and jobs used under them.
+// Users bound to a tenant only get the quota of their tenant.
+func QuotasHandler(svc QuotasService) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		usages, err := svc.QuotaUsage(r.Context())
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to count the usage of the quotas: %v", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, usages)
+	}
+	return recoveryMiddleware(handler)
+}
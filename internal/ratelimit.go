@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// rateLimitSweepInterval is how often the buckets of idle clients are removed.
+const rateLimitSweepInterval = 5 * time.Minute
+
+// RateLimiter limits the requests of each client with a token bucket, so that a misbehaving integration cannot
+// flood the queue. Clients are told apart by their authenticated user, e.g. their API key, or by their address.
+// Buckets are kept in memory, each instance limits the requests it serves. A nil RateLimiter lets every request
+// through.
+type RateLimiter struct {
+	requests       int // Requests per period, refilling the buckets
+	period         time.Duration
+	burst          int            // Size of the buckets
+	trustedProxies trustedProxies // Proxies whose X-Forwarded-For header gives the client address
+
+	mu      sync.Mutex
+	clients map[string]*rateLimitedClient
+}
+
+type rateLimitedClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+	limited  bool // Requests are being rejected, logged once
+}
+
+// NewRateLimiter creates the rate limiter of the submission endpoints, removing the buckets of idle clients until
+// the context is done. Returns nil if rate limiting is disabled.
+func NewRateLimiter(ctx context.Context, cfg *config.Config) (*RateLimiter, error) {
+	c := cfg.RateLimit
+	if !c.Enabled {
+		return nil, nil
+	}
+	proxies, err := parseTrustedProxies(c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	l := &RateLimiter{
+		requests:       c.Requests,
+		period:         c.Period,
+		burst:          c.Burst,
+		trustedProxies: proxies,
+		clients:        make(map[string]*rateLimitedClient),
+	}
+	go l.sweep(ctx)
+	return l, nil
+}
+
+// Limit wraps a handler so that clients over their rate are rejected with 429 and the time to wait before retrying.
+// Wrapped handlers must run after authentication, so that authenticated clients are limited by user.
+func (l *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := l.clientKey(r)
+		if wait := l.reserve(client); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// reserve takes a token from the bucket of a client. Returns the time until a token is available if the bucket is
+// empty, or 0 if the request is allowed.
+func (l *RateLimiter) reserve(client string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.clients[client]
+	if !ok {
+		c = &rateLimitedClient{limiter: rate.NewLimiter(rate.Every(l.period/time.Duration(l.requests)), l.burst)}
+		l.clients[client] = c
+	}
+	now := time.Now()
+	c.lastSeen = now
+	reservation := c.limiter.ReserveN(now, 1)
+	wait := reservation.DelayFrom(now)
+	if wait == 0 {
+		c.limited = false
+		return 0
+	}
+	reservation.CancelAt(now)
+	if !c.limited {
+		c.limited = true
+		logger.Warn("Rate limiting %s to %d requests per %s, in bursts of %d", client, l.requests, l.period, l.burst)
+	}
+	return wait
+}
+
+// clientKey returns the authenticated user of a request, or its client address.
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if principal := PrincipalFromContext(r.Context()); principal != nil {
+		return principal.Subject
+	}
+	return "ip:" + l.trustedProxies.clientAddr(r)
+}
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For header gives the client address.
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies parses the addresses or CIDR ranges of the trusted proxies.
+func parseTrustedProxies(list []string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, proxy := range list {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		proxies = append(proxies, prefix)
+	}
+	return proxies, nil
+}
+
+// clientAddr returns the address of the client. Behind trusted proxies, it is the last address of the
+// X-Forwarded-For header that is not a trusted proxy: addresses before it are set by the client and can be forged.
+func (p trustedProxies) clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !p.trusted(addr) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		if !p.trusted(hop) {
+			return hop.Unmap().String()
+		}
+	}
+	return host
+}
+
+func (p trustedProxies) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sweep removes the buckets of clients idle long enough for their bucket to be full again, until the context is
+// done.
+func (l *RateLimiter) sweep(ctx context.Context) {
+	ticker := time.NewTicker(rateLimitSweepInterval)
+	defer ticker.Stop()
+	refill := l.period * time.Duration(l.burst) / time.Duration(l.requests)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		l.mu.Lock()
+		for client, c := range l.clients {
+			if time.Since(c.lastSeen) > refill {
+				delete(l.clients, client)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// parsePrefix parses a CIDR prefix or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxiesClientAddr(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For headers
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:51000", want: "203.0.113.7"},
+		{name: "forwarded header of an untrusted client is ignored", remoteAddr: "203.0.113.7:51000",
+			forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:443", forwarded: []string{"198.51.100.1"},
+			want: "198.51.100.1"},
+		{name: "trusted proxy without header", remoteAddr: "10.1.2.3:443", want: "10.1.2.3"},
+		{name: "forged addresses before the client", remoteAddr: "10.1.2.3:443",
+			forwarded: []string{"1.1.1.1, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "192.0.2.1:443",
+			forwarded: []string{"198.51.100.1, 10.0.0.5"}, want: "198.51.100.1"},
+		{name: "headers are joined", remoteAddr: "10.1.2.3:443",
+			forwarded: []string{"198.51.100.1", "10.0.0.5"}, want: "198.51.100.1"},
+		{name: "only trusted proxies", remoteAddr: "10.1.2.3:443", forwarded: []string{"10.0.0.5"},
+			want: "10.1.2.3"},
+		{name: "invalid hop stops the search", remoteAddr: "10.1.2.3:443",
+			forwarded: []string{"198.51.100.1, unknown, 10.0.0.5"}, want: "10.1.2.3"},
+		{name: "IPv4-mapped client", remoteAddr: "10.1.2.3:443", forwarded: []string{"::ffff:198.51.100.1"},
+			want: "198.51.100.1"},
+		{name: "IPv6 proxy", remoteAddr: "[2001:db8::1]:443", forwarded: []string{"2001:db9::5"},
+			want: "2001:db9::5"},
+		{name: "IPv4-mapped proxy", remoteAddr: "[::ffff:10.1.2.3]:443", forwarded: []string{"198.51.100.1"},
+			want: "198.51.100.1"},
+		{name: "remote address without port", remoteAddr: "203.0.113.7", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/preserve", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := proxies.clientAddr(r); got != tt.want {
+				t.Errorf("clientAddr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxiesNone(t *testing.T) {
+	var proxies trustedProxies
+	r := httptest.NewRequest(http.MethodGet, "/preserve", nil)
+	r.RemoteAddr = "10.1.2.3:443"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := proxies.clientAddr(r); got != "10.1.2.3" {
+		t.Errorf("clientAddr() = %q, want the remote address without trusted proxies", got)
+	}
+}
@@ -0,0 +1,259 @@
+// Package rclone runs the rclone command against a remote, so any of the storage systems rclone supports
+// (Backblaze B2, Dropbox, OneDrive, Swift, SMB, tape gateways and others) can hold AIPs or deliver transfers.
+// Remotes are defined in the rclone config file, on the fly (":sftp,host=...:path") or with options
+// passed as RCLONE_CONFIG_<REMOTE>_<OPTION> environment variables.
+package rclone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// defaultBinary is the rclone command used when none is configured.
+const defaultBinary = "rclone"
+
+// rclone exit codes of missing directories and files.
+const (
+	exitDirNotFound  = 3
+	exitFileNotFound = 4
+)
+
+// ErrNotFound is returned when a file or directory does not exist on the remote.
+var ErrNotFound = errors.New("not found")
+
+// Entry is a file or directory on a remote.
+type Entry struct {
+	Path    string            `json:"Path"` // Relative to the listed directory
+	Size    int64             `json:"Size"`
+	ModTime time.Time         `json:"ModTime"`
+	IsDir   bool              `json:"IsDir"`
+	Hashes  map[string]string `json:"Hashes,omitempty"`
+}
+
+// Hash returns the hash of an entry, e.g. sha256, or an empty string if the remote does not support it.
+func (e Entry) Hash(name string) string {
+	for hashName, value := range e.Hashes {
+		// Older rclone versions name hashes e.g. SHA-1
+		if strings.EqualFold(strings.ReplaceAll(hashName, "-", ""), name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// Remote runs rclone commands against the root of a remote.
+type Remote struct {
+	binary string
+	root   string
+	flags  []string
+	env    []string
+}
+
+// New returns the remote of an rclone config. insecure skips the TLS certificate checks of HTTP based remotes.
+func New(cfg *config.RcloneConfig, insecure bool) (*Remote, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("rclone config cannot be nil")
+	}
+	name, _, ok := strings.Cut(cfg.Remote, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid rclone remote %q, expected <remote>:<path>", cfg.Remote)
+	}
+	for _, flag := range cfg.Flags {
+		if !strings.HasPrefix(flag, "-") {
+			return nil, fmt.Errorf("invalid rclone flag: %s", flag)
+		}
+	}
+	binary := cfg.Binary
+	if binary == "" {
+		binary = defaultBinary
+	}
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, fmt.Errorf("rclone not found: %w", err)
+	}
+
+	r := &Remote{binary: binary, root: strings.TrimSuffix(cfg.Remote, "/")}
+	if cfg.ConfigFile != "" {
+		r.flags = append(r.flags, "--config", cfg.ConfigFile)
+	}
+	if insecure {
+		r.flags = append(r.flags, "--no-check-certificate")
+	}
+	r.flags = append(r.flags, cfg.Flags...)
+	if len(cfg.Options) > 0 {
+		if name == "" {
+			return nil, fmt.Errorf("options require a named rclone remote, set them in the on the fly remote instead")
+		}
+		prefix := "RCLONE_CONFIG_" + strings.ToUpper(name) + "_"
+		for key, value := range cfg.Options {
+			r.env = append(r.env, prefix+strings.ToUpper(key)+"="+value)
+		}
+	}
+	return r, nil
+}
+
+// Path returns the remote path of a slash separated path below the root.
+func (r *Remote) Path(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return r.root
+	}
+	if strings.HasSuffix(r.root, ":") {
+		return r.root + p
+	}
+	return r.root + "/" + p
+}
+
+// Upload copies a local file to a path below the root. rclone checks the copy against the size and the hashes
+// the remote supports, and retries failed transfers.
+func (r *Remote) Upload(ctx context.Context, localPath, remotePath string) error {
+	_, err := r.run(ctx, "copyto", localPath, r.Path(remotePath))
+	return err
+}
+
+// Download copies a file below the root to a local file.
+func (r *Remote) Download(ctx context.Context, remotePath, localPath string) error {
+	_, err := r.run(ctx, "copyto", r.Path(remotePath), localPath)
+	return err
+}
+
+// Delete removes a file below the root. Missing files return ErrNotFound.
+func (r *Remote) Delete(ctx context.Context, remotePath string) error {
+	_, err := r.run(ctx, "deletefile", r.Path(remotePath))
+	return err
+}
+
+// Stat returns the entry of a file or directory, with its SHA-256 if the remote supports it.
+func (r *Remote) Stat(ctx context.Context, remotePath string) (Entry, error) {
+	output, err := r.run(ctx, "lsjson", "--stat", "--hash", "--hash-type", "sha256", r.Path(remotePath))
+	if err != nil {
+		return Entry{}, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(output, &entry); err != nil {
+		return Entry{}, fmt.Errorf("error reading rclone listing: %w", err)
+	}
+	entry.Path = remotePath
+	return entry, nil
+}
+
+// List lists a directory below the root, with its subdirectories if recursive. Entry paths are relative to the
+// directory. A missing directory has no entries.
+func (r *Remote) List(ctx context.Context, dir string, recursive bool) ([]Entry, error) {
+	var args []string
+	if recursive {
+		args = append(args, "--recursive", "--files-only")
+	}
+	output, err := r.run(ctx, "lsjson", append(args, r.Path(dir))...)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(output, &entries); err != nil {
+		return nil, fmt.Errorf("error reading rclone listing: %w", err)
+	}
+	return entries, nil
+}
+
+// Open opens a file below the root for reading, starting at offset. The file is streamed from rclone until
+// the reader is closed.
+func (r *Remote) Open(ctx context.Context, remotePath string, offset int64) (io.ReadCloser, error) {
+	// cat only reports a missing file once the stream ends, check it first
+	if _, err := r.Stat(ctx, remotePath); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	args := append(r.args("cat"), "--offset", strconv.FormatInt(offset, 10), r.Path(remotePath))
+	// #nosec G204 -- the binary and flags come from configuration, the paths are cleaned below the remote root
+	cmd := exec.CommandContext(ctx, r.binary, args...)
+	cmd.Env = append(os.Environ(), r.env...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("error starting rclone: %w", err)
+	}
+	return &catReader{ReadCloser: stdout, cmd: cmd, cancel: cancel, stderr: stderr}, nil
+}
+
+// args returns the arguments of an rclone command with the configured flags.
+func (r *Remote) args(command string) []string {
+	return append([]string{command}, r.flags...)
+}
+
+// run runs an rclone command and returns its output. Missing files and directories return ErrNotFound.
+func (r *Remote) run(ctx context.Context, command string, args ...string) ([]byte, error) {
+	logger.Debug("Running rclone %s %s", command, strings.Join(args, " "))
+	// #nosec G204 -- the binary and flags come from configuration, the paths are cleaned below the remote root
+	cmd := exec.CommandContext(ctx, r.binary, append(r.args(command), args...)...)
+	cmd.Env = append(os.Environ(), r.env...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, commandError(command, err, stderr)
+	}
+	return output, nil
+}
+
+// catReader is the output of rclone cat. Closing it stops rclone.
+type catReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stderr *bytes.Buffer
+	eof    bool
+}
+
+// Read reports the rclone error once the stream ends, so a failed transfer is not mistaken for the end of the file.
+func (c *catReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if errors.Is(err, io.EOF) && !c.eof {
+		c.eof = true
+		if waitErr := c.cmd.Wait(); waitErr != nil {
+			return n, commandError("cat", waitErr, c.stderr)
+		}
+	}
+	return n, err
+}
+
+func (c *catReader) Close() error {
+	c.cancel()
+	if !c.eof {
+		// rclone was stopped before the end of the file, its exit status is of no interest
+		_ = c.cmd.Wait()
+	}
+	return nil
+}
+
+// commandError returns the error of a failed rclone command with its error output.
+func commandError(command string, err error, stderr *bytes.Buffer) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case exitDirNotFound, exitFileNotFound:
+			return fmt.Errorf("%w: %s", ErrNotFound, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return fmt.Errorf("rclone %s failed: %w\nOutput: %s", command, err, strings.TrimSpace(stderr.String()))
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"maps"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// WatchConfig reloads the configuration when the process receives SIGHUP, and when the .env file or a config file
+// read by Reload changes, checked every CA4M_CONFIG_RELOAD_INTERVAL, until the context is done. Invalid changes are
+// logged and the current configuration stays active.
+func (s *Service) WatchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval := s.cfg.ConfigReload.Interval; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	modTimes := s.configModTimes()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info("Received SIGHUP, reloading the configuration")
+		case <-tick:
+			if maps.Equal(s.configModTimes(), modTimes) {
+				continue
+			}
+			logger.Info("Configuration files changed, reloading the configuration")
+		}
+		// A file changed again during the reload is reloaded at the next check
+		modTimes = s.configModTimes()
+		// Errors are logged by Reload
+		_, _ = s.Reload()
+	}
+}
+
+// configModTimes returns the modification times of the .env file and of the config files read by Reload, zero for
+// the files that don't exist, so that created and removed files are reloaded too.
+func (s *Service) configModTimes() map[string]time.Time {
+	paths := []string{
+		".env",
+		s.cfg.ArchivesSpace.ConfigPath,
+		s.cfg.StorageService.ConfigPath,
+		s.cfg.AIPStorage.ConfigPath,
+		s.cfg.Repositories.ConfigPath,
+		s.cfg.Sources.ConfigPath,
+		s.cfg.Notifications.ConfigPath,
+		s.cfg.Profiles.ConfigPath,
+	}
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+		modTimes[path] = modTime
+	}
+	return modTimes
+}
@@ -0,0 +1,66 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+)
+
+//go:embed report.html.tmpl
+var htmlTemplate string
+
+// htmlReport is the template of the HTML reports.
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"size":     formatSize,
+	"duration": formatDuration,
+	"time":     func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05 UTC") },
+	"outcome":  outcomeClass,
+}).Parse(htmlTemplate))
+
+// WriteHTML writes the report as a standalone HTML document, printable to PDF.
+func (r *Report) WriteHTML(w io.Writer) error {
+	if err := htmlReport.Execute(w, r); err != nil {
+		return fmt.Errorf("error writing report: %w", err)
+	}
+	return nil
+}
+
+// formatSize formats a size in bytes with a binary unit.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// formatDuration formats the duration of an event, empty if it was not measured.
+func formatDuration(ms int64) string {
+	if ms <= 0 {
+		return ""
+	}
+	return (time.Duration(ms) * time.Millisecond).Round(time.Millisecond).String()
+}
+
+// outcomeClass returns the CSS class of an event outcome or a fixity status.
+func outcomeClass(outcome string) string {
+	switch outcome {
+	case catalog.OutcomeSuccess, FixityPassed:
+		return "ok"
+	case catalog.OutcomeWarning:
+		return "warn"
+	case catalog.OutcomeFailure, FixityFailed:
+		return "fail"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// WritePDF converts the HTML report to a PDF file with an external command, such as a headless browser. The
+// {input} and {output} placeholders of the command are replaced by the paths of the HTML and PDF files.
+func (r *Report) WritePDF(ctx context.Context, command, pdfPath string) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return errors.New("no PDF command is set, see CA4M_REPORTS_PDF_COMMAND")
+	}
+	tmpDir, err := os.MkdirTemp("", "report-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	htmlPath := filepath.Join(tmpDir, "report.html")
+	var html bytes.Buffer
+	if err := r.WriteHTML(&html); err != nil {
+		return err
+	}
+	if err := os.WriteFile(htmlPath, html.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("error writing %s: %w", htmlPath, err)
+	}
+	output, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return err
+	}
+	// A PDF left by a previous run would pass for the output of a command that wrote none
+	if err := os.Remove(output); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing %s: %w", output, err)
+	}
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "{input}", htmlPath)
+		args[i] = strings.ReplaceAll(arg, "{output}", output)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // #nosec G204 -- the command is configured by the operator
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running %s: %w: %s", args[0], err, bytes.TrimSpace(out))
+	}
+	if _, err := os.Stat(output); err != nil {
+		return fmt.Errorf("%s did not write the PDF report: %w", args[0], err)
+	}
+	return nil
+}
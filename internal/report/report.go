@@ -0,0 +1,402 @@
+// Package report generates the preservation reports of packages for depositors and auditors, from the record of a
+// package and the artifacts the pipeline kept with it: the contents and formats of the package, its identifiers,
+// the timeline of its events and the fixity status of its AIP.
+package report
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/pkg/manifest"
+)
+
+// Formats of the reports.
+const (
+	FormatHTML = "html"
+	FormatPDF  = "pdf"
+)
+
+// Formats lists the formats of the reports.
+var Formats = []string{FormatHTML, FormatPDF}
+
+// Fixity statuses of a package.
+const (
+	FixityPassed     = "passed"      // Every check passed
+	FixityFailed     = "failed"      // The latest check of a replica or the manifest comparison failed
+	FixityNotChecked = "not checked" // The package has no fixity event
+)
+
+// Sources of the formats of a report.
+const (
+	formatsFromMETS       = "PRONOM identification of the AIP (METS)"
+	formatsFromExtensions = "file extensions of the files submitted"
+)
+
+// transferDirectory prefixes the original names of the files submitted in the PREMIS objects of a3m METS files, the
+// other objects are normalized copies and metadata.
+const transferDirectory = "%transferDirectory%"
+
+// maxFormats is the number of formats shown in the chart, the others are grouped.
+const maxFormats = 8
+
+// chartColors are the colors of the slices of the formats chart.
+var chartColors = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f",
+}
+
+// Field is a labelled value of a report. Values with a URL are links.
+type Field struct {
+	Name  string
+	Value string
+	URL   string
+}
+
+// Contents summarizes the files of a package.
+type Contents struct {
+	Files int   // Files submitted, or original files of the AIP without an input manifest
+	Size  int64 // Size of the files submitted, 0 without an input manifest
+	// Compared is set when the files submitted were compared to the files of the AIP
+	Compared bool
+	Matched  int
+	Renamed  int
+	Modified int
+	Dropped  int
+	Added    int
+}
+
+// Format is a file format of a package, with its slice of the formats chart.
+type Format struct {
+	Name    string
+	PUID    string
+	Files   int
+	Percent float64
+	Color   string
+	Path    string // SVG path of the slice, empty if the format has every file
+}
+
+// FixityCheck is the latest fixity check of a replica of the AIP.
+type FixityCheck struct {
+	Location string
+	Key      string
+	Time     time.Time // Zero if the replica was never checked
+	Outcome  string
+	Note     string
+}
+
+// Report is the preservation report of a package.
+type Report struct {
+	Record        *catalog.Record
+	GeneratedAt   time.Time
+	Identifiers   []Field
+	Metadata      []Field
+	Contents      Contents
+	Formats       []Format
+	FormatsSource string
+	Fixity        string
+	FixityChecks  []FixityCheck
+	// ManifestComparison is the comparison of the files submitted to the files of the AIP, nil if they were not compared
+	ManifestComparison *catalog.Event
+	Events             []catalog.Event
+}
+
+// Build builds the report of a package from its record and the artifacts in its record directory. Missing artifacts
+// leave their sections empty.
+func Build(rec *catalog.Record, dir string) (*Report, error) {
+	r := &Report{Record: rec, GeneratedAt: time.Now().UTC(), Events: rec.Events}
+	r.Identifiers = identifiers(rec)
+	for _, key := range slices.Sorted(maps.Keys(rec.Metadata)) {
+		r.Metadata = append(r.Metadata, Field{Name: key, Value: rec.Metadata[key]})
+	}
+
+	input, err := readManifest(filepath.Join(dir, catalog.ArtifactInputManifest))
+	if err != nil {
+		return nil, err
+	}
+	if input != nil {
+		r.Contents.Files = len(input.Entries)
+		for _, entry := range input.Entries {
+			r.Contents.Size += entry.Size
+		}
+	}
+	if err := r.readManifestReport(filepath.Join(dir, catalog.ArtifactManifestReport)); err != nil {
+		return nil, err
+	}
+
+	counts, err := metsFormats(filepath.Join(dir, catalog.ArtifactMETS))
+	if err != nil {
+		return nil, err
+	}
+	if len(counts) > 0 {
+		r.FormatsSource = formatsFromMETS
+		if input == nil {
+			for _, format := range counts {
+				r.Contents.Files += format.Files
+			}
+		}
+	} else if input != nil {
+		counts = extensionFormats(input)
+		r.FormatsSource = formatsFromExtensions
+	}
+	r.Formats = chart(counts)
+
+	r.fixity()
+	return r, nil
+}
+
+// identifiers returns the identifiers of a package and of the copies of its AIP and access copies.
+func identifiers(rec *catalog.Record) []Field {
+	var fields []Field
+	add := func(name, value, url string) {
+		if value != "" {
+			fields = append(fields, Field{Name: name, Value: value, URL: url})
+		}
+	}
+	add("Package", rec.ID, "")
+	add("Job", rec.JobID, "")
+	add("Resumed from", rec.ResumedFrom, "")
+	add("AIP UUID", rec.AIPUUID, "")
+	add("AIP path", rec.AIPPath, "")
+	add("Fingerprint", rec.Fingerprint, "")
+	if rec.DuplicateOf != nil {
+		add("Duplicate of", rec.DuplicateOf.PackageID, "")
+	}
+	for _, replica := range rec.Replicas {
+		add("Replica in "+replica.Location, replica.Key, "")
+	}
+	add("AtoM slug", rec.AtomSlug, "")
+	add("ArchivesSpace URI", rec.ArchivesSpaceURI, "")
+	add("Access copies", rec.AccessCopiesPath, "")
+	add("Share link", rec.ShareLink, rec.ShareLink)
+	for _, deposit := range rec.Deposits {
+		add("Deposit in "+deposit.Repository, deposit.URI, deposit.URI)
+		if deposit.DOI != "" {
+			add("DOI", deposit.DOI, "https://doi.org/"+deposit.DOI)
+		}
+	}
+	return fields
+}
+
+// readManifest reads a manifest artifact, nil if the package does not have it.
+func readManifest(filePath string) (*manifest.Manifest, error) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return manifest.Read(filePath)
+}
+
+// readManifestReport reads the comparison of the files submitted to the files of the AIP, if the package has it.
+func (r *Report) readManifestReport(filePath string) error {
+	data, err := os.ReadFile(filepath.Clean(filePath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+	var comparison manifest.Report
+	if err := json.Unmarshal(data, &comparison); err != nil {
+		return fmt.Errorf("error parsing %s: %w", filePath, err)
+	}
+	r.Contents.Compared = true
+	r.Contents.Matched = comparison.Matched
+	r.Contents.Renamed = len(comparison.Renamed)
+	r.Contents.Modified = len(comparison.Modified)
+	r.Contents.Dropped = len(comparison.Dropped)
+	r.Contents.Added = len(comparison.Added)
+	return nil
+}
+
+// metsFormats counts the formats identified in the PREMIS objects of a METS file, nil if the package does not have
+// it. The original files are counted, or every object if the METS does not tell them apart.
+func metsFormats(metsPath string) ([]Format, error) {
+	f, err := os.Open(filepath.Clean(metsPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", metsPath, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	type object struct{ originalName, formatName, formatVersion, puid string }
+	var objects []object
+	var current *object
+	var text strings.Builder
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", metsPath, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "object" {
+				objects = append(objects, object{})
+				current = &objects[len(objects)-1]
+			}
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if current == nil {
+				continue
+			}
+			value := strings.TrimSpace(text.String())
+			switch t.Name.Local {
+			case "object":
+				current = nil
+			case "originalName":
+				current.originalName = value
+			case "formatName":
+				current.formatName = value
+			case "formatVersion":
+				current.formatVersion = value
+			case "formatRegistryKey":
+				current.puid = value
+			}
+		}
+	}
+
+	originals := slices.DeleteFunc(slices.Clone(objects), func(o object) bool {
+		return !strings.HasPrefix(o.originalName, transferDirectory)
+	})
+	if len(originals) == 0 {
+		originals = objects
+	}
+	counts := map[string]*Format{}
+	var formats []Format
+	for _, o := range originals {
+		name := o.formatName
+		if name == "" {
+			name = "Unidentified"
+		} else if o.formatVersion != "" {
+			name += " " + o.formatVersion
+		}
+		if counts[name] == nil {
+			counts[name] = &Format{Name: name, PUID: o.puid}
+		}
+		counts[name].Files++
+	}
+	for _, format := range counts {
+		formats = append(formats, *format)
+	}
+	return formats, nil
+}
+
+// extensionFormats counts the extensions of the files of a manifest.
+func extensionFormats(m *manifest.Manifest) []Format {
+	counts := map[string]int{}
+	for filePath := range m.Entries {
+		ext := strings.ToLower(path.Ext(filePath))
+		if ext == "" {
+			ext = "No extension"
+		}
+		counts[ext]++
+	}
+	formats := make([]Format, 0, len(counts))
+	for ext, files := range counts {
+		formats = append(formats, Format{Name: ext, Files: files})
+	}
+	return formats
+}
+
+// chart sorts formats by decreasing number of files, groups the formats after maxFormats, and computes the slices of
+// the formats chart.
+func chart(formats []Format) []Format {
+	slices.SortFunc(formats, func(a, b Format) int {
+		return cmp.Or(cmp.Compare(b.Files, a.Files), strings.Compare(a.Name, b.Name))
+	})
+	if len(formats) > maxFormats {
+		other := Format{Name: fmt.Sprintf("%d other formats", len(formats)-maxFormats+1)}
+		for _, format := range formats[maxFormats-1:] {
+			other.Files += format.Files
+		}
+		formats = append(formats[:maxFormats-1], other)
+	}
+	total := 0
+	for _, format := range formats {
+		total += format.Files
+	}
+	angle := 0.0
+	for i := range formats {
+		fraction := float64(formats[i].Files) / float64(total)
+		formats[i].Percent = fraction * 100
+		formats[i].Color = chartColors[i%len(chartColors)]
+		if fraction < 1 {
+			formats[i].Path = slicePath(angle, angle+fraction*2*math.Pi)
+		}
+		angle += fraction * 2 * math.Pi
+	}
+	return formats
+}
+
+// slicePath returns the SVG path of a slice of a pie chart of radius 100 centered on the origin, between two angles
+// in radians clockwise from the top.
+func slicePath(from, to float64) string {
+	largeArc := 0
+	if to-from > math.Pi {
+		largeArc = 1
+	}
+	return fmt.Sprintf("M0,0 L%.3f,%.3f A100,100 0 %d 1 %.3f,%.3f Z",
+		100*math.Sin(from), -100*math.Cos(from), largeArc, 100*math.Sin(to), -100*math.Cos(to))
+}
+
+// fixity sets the latest fixity check of each replica of the AIP, the manifest comparison, and the fixity status of
+// the package.
+func (r *Report) fixity() {
+	checks := map[string]catalog.Event{}
+	for _, event := range r.Events {
+		if event.Type != catalog.EventFixity {
+			continue
+		}
+		if strings.HasPrefix(event.Detail, catalog.ManifestComparisonDetail) {
+			comparison := event
+			r.ManifestComparison = &comparison
+			continue
+		}
+		if detail, ok := strings.CutPrefix(event.Detail, catalog.FixityCheckDetail); ok {
+			location, _, _ := strings.Cut(detail, ": ")
+			checks[location] = event
+		}
+	}
+
+	r.Fixity = FixityNotChecked
+	failed := func(outcome string) bool {
+		return outcome == catalog.OutcomeFailure || outcome == catalog.OutcomeWarning
+	}
+	if r.ManifestComparison != nil {
+		r.Fixity = FixityPassed
+		if failed(r.ManifestComparison.Outcome) {
+			r.Fixity = FixityFailed
+		}
+	}
+	for _, replica := range r.Record.Replicas {
+		check := FixityCheck{Location: replica.Location, Key: replica.Key}
+		if event, ok := checks[replica.Location]; ok {
+			check.Time = event.Time
+			check.Outcome = event.Outcome
+			_, check.Note, _ = strings.Cut(strings.TrimPrefix(event.Detail, catalog.FixityCheckDetail), ": ")
+			if failed(event.Outcome) {
+				r.Fixity = FixityFailed
+			} else if r.Fixity == FixityNotChecked {
+				r.Fixity = FixityPassed
+			}
+		}
+		r.FixityChecks = append(r.FixityChecks, check)
+	}
+}
@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	// dataverseTimeout bounds each request to Dataverse, including file uploads.
+	dataverseTimeout = 2 * time.Hour
+
+	// defaultDataverseSubject is the subject of datasets when none is configured.
+	defaultDataverseSubject = "Other"
+)
+
+// dataverseDepositor deposits packages into a Dataverse collection. Each package is a new dataset with a citation
+// metadata block mapped from the package metadata, holding its access copies in folders mirroring the DIP folders.
+// Dataverse takes no checksum on upload, so the checksum it computes for each file is compared with the access copy.
+// A dataset whose files fail to upload is deleted, so a failed deposit leaves no partial dataset.
+type dataverseDepositor struct {
+	config *config.DataverseConfig
+	client *utils.HTTPClient
+}
+
+func newDataverseDepositor(cfg *config.DataverseConfig, insecure bool) (*dataverseDepositor, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("dataverse config cannot be nil")
+	}
+	return &dataverseDepositor{config: cfg, client: utils.NewHTTPClient(dataverseTimeout, insecure)}, nil
+}
+
+func (d *dataverseDepositor) Close() error {
+	d.client.Close()
+	return nil
+}
+
+// Deposit creates a dataset for a package, uploads its access copies and publishes it if configured.
+// Returns the dataset page and its DOI, which Dataverse reserves when the dataset is created and registers when
+// it is published.
+func (d *dataverseDepositor) Deposit(ctx context.Context, pkg *Package) (*Receipt, error) {
+	files, err := accessFiles(pkg.DIPPath)
+	if err != nil {
+		return nil, err
+	}
+	persistentID, err := d.createDataset(ctx, pkg)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		err := utils.WithRetry(func() error {
+			return d.uploadFile(ctx, persistentID, file)
+		})
+		if err != nil {
+			d.deleteDataset(ctx, persistentID)
+			return nil, err
+		}
+	}
+	if d.config.Publish {
+		if err := utils.WithRetry(func() error { return d.publishDataset(ctx, persistentID) }); err != nil {
+			// The files are deposited, the draft can be published from Dataverse
+			logger.Warn("Error publishing Dataverse dataset %s, left as draft: %v", persistentID, err)
+		}
+	}
+	logger.Debug("Deposited %d access copies into Dataverse: %s", len(files), persistentID)
+	receipt := &Receipt{URI: d.apiURL("dataset.xhtml", url.Values{"persistentId": {persistentID}})}
+	if doi, ok := strings.CutPrefix(persistentID, "doi:"); ok {
+		receipt.DOI = doi
+	}
+	return receipt, nil
+}
+
+// dataverseResponse is the envelope of Dataverse API responses.
+type dataverseResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// createDataset creates a draft dataset in the collection and returns its persistent ID, e.g. doi:10.5072/FK2/ABCDEF.
+func (d *dataverseDepositor) createDataset(ctx context.Context, pkg *Package) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"datasetVersion": map[string]any{
+			"metadataBlocks": map[string]any{
+				"citation": map[string]any{"fields": d.citationFields(pkg)},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	var dataset struct {
+		PersistentID string `json:"persistentId"`
+	}
+	err = utils.WithRetry(func() error {
+		// A dataset may have been created by an attempt whose response was lost; duplicates are left to curators
+		return d.do(ctx, http.MethodPost, d.apiURL("api/dataverses/"+url.PathEscape(d.config.Collection)+"/datasets", nil),
+			bytes.NewReader(body), "application/json", &dataset)
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating Dataverse dataset: %w", err)
+	}
+	if dataset.PersistentID == "" {
+		return "", fmt.Errorf("dataverse returned no dataset persistent ID")
+	}
+	return dataset.PersistentID, nil
+}
+
+// citationFields maps the package metadata onto the fields of the citation metadata block.
+// Multiple creators and subjects are separated by semicolons.
+func (d *dataverseDepositor) citationFields(pkg *Package) []map[string]any {
+	authors := splitValues(firstValue(pkg.Metadata, "dc.creator", "isadg.name-of-creators"))
+	if len(authors) == 0 {
+		authors = []string{d.config.ContactName}
+	}
+	description := firstValue(pkg.Metadata, "dc.description", "isadg.scope-and-content")
+	if description == "" {
+		description = pkg.Title
+	}
+	subject := d.config.Subject
+	if subject == "" {
+		subject = defaultDataverseSubject
+	}
+
+	authorValues := make([]map[string]any, 0, len(authors))
+	for _, author := range authors {
+		authorValues = append(authorValues, map[string]any{"authorName": primitiveField("authorName", author)})
+	}
+	fields := []map[string]any{
+		primitiveField("title", pkg.Title),
+		compoundField("author", authorValues),
+		compoundField("datasetContact", []map[string]any{{
+			"datasetContactName":  primitiveField("datasetContactName", d.config.ContactName),
+			"datasetContactEmail": primitiveField("datasetContactEmail", d.config.ContactEmail),
+		}}),
+		compoundField("dsDescription", []map[string]any{{
+			"dsDescriptionValue": primitiveField("dsDescriptionValue", description),
+		}}),
+		{"typeName": "subject", "multiple": true, "typeClass": "controlledVocabulary", "value": []string{subject}},
+		compoundField("otherId", []map[string]any{{
+			"otherIdAgency": primitiveField("otherIdAgency", "AIP UUID"),
+			"otherIdValue":  primitiveField("otherIdValue", pkg.AIPUUID),
+		}}),
+	}
+	if keywords := splitValues(pkg.Metadata["dc.subject"]); len(keywords) > 0 {
+		keywordValues := make([]map[string]any, 0, len(keywords))
+		for _, keyword := range keywords {
+			keywordValues = append(keywordValues, map[string]any{"keywordValue": primitiveField("keywordValue", keyword)})
+		}
+		fields = append(fields, compoundField("keyword", keywordValues))
+	}
+	return fields
+}
+
+// uploadFile adds an access copy to a dataset and checks the checksum Dataverse computed for it.
+func (d *dataverseDepositor) uploadFile(ctx context.Context, persistentID string, file accessFile) error {
+	in, err := os.Open(filepath.Clean(file.LocalPath))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	jsonData, err := json.Marshal(map[string]string{"directoryLabel": strings.TrimPrefix(path.Dir(file.Path), ".")})
+	if err != nil {
+		return err
+	}
+
+	// Stream the multipart body so large access copies are not held in memory
+	pr, pw := io.Pipe()
+	defer func() { _ = pr.Close() }()
+	form := multipart.NewWriter(pw)
+	go func() {
+		part, err := form.CreateFormFile("file", path.Base(file.Path))
+		if err == nil {
+			_, err = io.Copy(part, in)
+		}
+		if err == nil {
+			err = form.WriteField("jsonData", string(jsonData))
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	var added struct {
+		Files []struct {
+			DataFile struct {
+				Checksum struct {
+					Type  string `json:"type"`
+					Value string `json:"value"`
+				} `json:"checksum"`
+			} `json:"dataFile"`
+		} `json:"files"`
+	}
+	uploadURL := d.apiURL("api/datasets/:persistentId/add", url.Values{"persistentId": {persistentID}})
+	if err := d.do(ctx, http.MethodPost, uploadURL, pr, form.FormDataContentType(), &added); err != nil {
+		return fmt.Errorf("error uploading %s to Dataverse: %w", file.Path, err)
+	}
+	if len(added.Files) != 1 || added.Files[0].DataFile.Checksum.Value == "" {
+		logger.Warn("Dataverse returned no checksum for %s, not verified", file.Path)
+		return nil
+	}
+	checksum := added.Files[0].DataFile.Checksum
+	// Dataverse names algorithms MD5, SHA-1, SHA-256 and SHA-512
+	expected, err := utils.FileChecksum(file.LocalPath, strings.ReplaceAll(checksum.Type, "-", ""))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(expected, checksum.Value) {
+		return fmt.Errorf("checksum mismatch for %s in Dataverse: expected %s, got %s", file.Path, expected, checksum.Value)
+	}
+	return nil
+}
+
+// publishDataset publishes a major version of a dataset. Dataverse may finish publishing asynchronously.
+func (d *dataverseDepositor) publishDataset(ctx context.Context, persistentID string) error {
+	publishURL := d.apiURL("api/datasets/:persistentId/actions/:publish", url.Values{"persistentId": {persistentID}, "type": {"major"}})
+	return d.do(ctx, http.MethodPost, publishURL, nil, "", nil)
+}
+
+// deleteDataset deletes the draft of a dataset, which deletes a dataset that was never published.
+func (d *dataverseDepositor) deleteDataset(ctx context.Context, persistentID string) {
+	// Delete with a fresh context, the deposit context may be cancelled
+	deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	deleteURL := d.apiURL("api/datasets/:persistentId/versions/:draft", url.Values{"persistentId": {persistentID}})
+	if err := d.do(deleteCtx, http.MethodDelete, deleteURL, nil, "", nil); err != nil {
+		logger.Error("Error deleting Dataverse dataset %s: %v", persistentID, err)
+	}
+}
+
+// do sends an authenticated request and decodes the data of its response into target, if set.
+func (d *dataverseDepositor) do(ctx context.Context, method, requestURL string, body io.Reader, contentType string, target any) error {
+	headers := map[string]string{"X-Dataverse-key": d.config.APIToken}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	resp, err := d.client.DoRequest(ctx, method, requestURL, body, headers)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error reading Dataverse response: %w", err)
+	}
+	var envelope dataverseResponse
+	if len(data) > 0 {
+		_ = json.Unmarshal(data, &envelope)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if envelope.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, envelope.Message)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	if target == nil {
+		return nil
+	}
+	if len(envelope.Data) == 0 {
+		return fmt.Errorf("dataverse response has no data")
+	}
+	return json.Unmarshal(envelope.Data, target)
+}
+
+// apiURL returns the URL of a path of the installation with a query.
+func (d *dataverseDepositor) apiURL(apiPath string, query url.Values) string {
+	u := strings.TrimSuffix(d.config.URL, "/") + "/" + apiPath
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func primitiveField(typeName, value string) map[string]any {
+	return map[string]any{"typeName": typeName, "multiple": false, "typeClass": "primitive", "value": value}
+}
+
+func compoundField(typeName string, values []map[string]any) map[string]any {
+	return map[string]any{"typeName": typeName, "multiple": true, "typeClass": "compound", "value": values}
+}
+
+// firstValue returns the first non-empty metadata value of the keys.
+func firstValue(metadata map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(metadata[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// splitValues splits a semicolon separated metadata value.
+func splitValues(value string) []string {
+	var values []string
+	for v := range strings.SplitSeq(value, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,332 @@
+package repository
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/md5" // #nosec G501 -- MD5 is the checksum SWORD and DSpace verify packages with
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	// dspaceTimeout bounds a package deposit.
+	dspaceTimeout = 2 * time.Hour
+
+	// swordPackagingMETS is the SWORD packaging of DSpace METS SIPs.
+	swordPackagingMETS = "http://purl.org/net/sword/package/METSDSpaceSIP"
+	// dspaceMETSProfile is the METS profile DSpace expects in SIPs.
+	dspaceMETSProfile = "DSpace METS SIP Profile 1.0"
+
+	metsNamespace  = "http://www.loc.gov/METS/"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+	dcNamespace    = "http://purl.org/dc/elements/1.1/"
+)
+
+// dcElements are the Dublin Core elements of the package metadata, in order.
+var dcElements = []string{
+	"title", "creator", "subject", "description", "publisher", "contributor", "date", "type",
+	"format", "identifier", "source", "language", "relation", "coverage", "rights",
+}
+
+// dspaceDepositor deposits packages into a DSpace collection with SWORD v2. Each package is a METS DSpace SIP:
+// a zip of the access copies with a mets.xml holding the package Dublin Core metadata and the MD5 of each file.
+// Every deposit creates a new item.
+type dspaceDepositor struct {
+	config *config.DSpaceConfig
+	client *utils.HTTPClient
+}
+
+func newDSpaceDepositor(cfg *config.DSpaceConfig, insecure bool) (*dspaceDepositor, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("dspace config cannot be nil")
+	}
+	return &dspaceDepositor{config: cfg, client: utils.NewHTTPClient(dspaceTimeout, insecure)}, nil
+}
+
+func (d *dspaceDepositor) Close() error {
+	d.client.Close()
+	return nil
+}
+
+// Deposit packages the access copies and posts the package to the collection, retrying on transient errors.
+// Returns the URL of the item page, or its SWORD edit URL if DSpace returns none.
+func (d *dspaceDepositor) Deposit(ctx context.Context, pkg *Package) (*Receipt, error) {
+	files, err := accessFiles(pkg.DIPPath)
+	if err != nil {
+		return nil, err
+	}
+	zipFile, err := os.CreateTemp("", "dspace-sip-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	sipPath := zipFile.Name()
+	defer func() {
+		if err := os.Remove(sipPath); err != nil {
+			logger.Error("Failed to remove DSpace package: %v", err)
+		}
+	}()
+	checksum, err := writeSIP(zipFile, pkg, files)
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error packaging DSpace SIP: %w", err)
+	}
+	var itemURL string
+	err = utils.WithRetry(func() error {
+		// The request closes its body, so each attempt reads the package afresh
+		sip, err := os.Open(filepath.Clean(sipPath))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = sip.Close() }()
+		itemURL, err = d.post(ctx, sip, pkg.AIPUUID+".zip", checksum)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("Deposited %d access copies into DSpace: %s", len(files), itemURL)
+	return &Receipt{URI: itemURL}, nil
+}
+
+// depositReceipt is the Atom entry SWORD returns for a deposit.
+type depositReceipt struct {
+	ID    string `xml:"id"`
+	Links []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+}
+
+// post sends a package to the collection and returns the URL of the created item.
+func (d *dspaceDepositor) post(ctx context.Context, body io.Reader, filename, checksum string) (string, error) {
+	headers := map[string]string{
+		"Authorization":       "Basic " + utils.Base64Encode(d.config.Username+":"+d.config.Password),
+		"Content-Type":        "application/zip",
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": filename}),
+		// SWORD v2 expects the hex encoded MD5 of the package
+		"Content-MD5": checksum,
+		"Packaging":   swordPackagingMETS,
+		"In-Progress": "false",
+	}
+	if d.config.OnBehalfOf != "" {
+		headers["On-Behalf-Of"] = d.config.OnBehalfOf
+	}
+	resp, err := d.client.DoRequest(ctx, http.MethodPost, d.config.CollectionURL, body, headers)
+	if err != nil {
+		return "", fmt.Errorf("error depositing into DSpace: %w", err)
+	}
+	defer closeBody(resp)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("error reading DSpace deposit receipt: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		if message := swordError(data); message != "" {
+			return "", fmt.Errorf("error depositing into DSpace: %s: %s", resp.Status, message)
+		}
+		return "", fmt.Errorf("error depositing into DSpace: %s", resp.Status)
+	}
+	var receipt depositReceipt
+	if err := xml.Unmarshal(data, &receipt); err != nil {
+		logger.Warn("Error parsing DSpace deposit receipt: %v", err)
+	}
+	for _, link := range receipt.Links {
+		if link.Rel == "alternate" && link.Href != "" {
+			return link.Href, nil
+		}
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		return location, nil
+	}
+	return receipt.ID, nil
+}
+
+// swordError returns the summary of a SWORD error document, or the start of the response.
+func swordError(data []byte) string {
+	var doc struct {
+		Summary string `xml:"summary"`
+	}
+	if xml.Unmarshal(data, &doc) == nil && doc.Summary != "" {
+		return strings.TrimSpace(doc.Summary)
+	}
+	message := strings.TrimSpace(string(data))
+	if len(message) > 512 {
+		message = message[:512]
+	}
+	return message
+}
+
+// writeSIP writes the METS DSpace SIP of a package to a file and returns its hex encoded MD5.
+func writeSIP(file *os.File, pkg *Package, files []accessFile) (string, error) {
+	zipWriter := zip.NewWriter(file)
+	mets := newSIPMETS(pkg)
+	for i, f := range files {
+		href := path.Join("objects", f.Path)
+		checksum, size, err := addZipFile(zipWriter, href, f.LocalPath)
+		if err != nil {
+			return "", err
+		}
+		mets.addFile(fmt.Sprintf("file-%d", i+1), href, checksum, size)
+	}
+	data, err := xml.MarshalIndent(mets, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling METS: %w", err)
+	}
+	entry, err := zipWriter.Create("mets.xml")
+	if err != nil {
+		return "", err
+	}
+	if _, err := entry.Write(append([]byte(xml.Header), data...)); err != nil {
+		return "", err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	hash := md5.New() // #nosec G401 -- see import
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// addZipFile copies a file into the zip and returns its hex encoded MD5 and size.
+func addZipFile(zipWriter *zip.Writer, name, localPath string) (string, int64, error) {
+	in, err := os.Open(filepath.Clean(localPath))
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = in.Close() }()
+	entry, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return "", 0, err
+	}
+	hash := md5.New() // #nosec G401 -- see import
+	size, err := io.Copy(entry, io.TeeReader(in, hash))
+	if err != nil {
+		return "", 0, fmt.Errorf("error adding %s to package: %w", name, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// sipMETS is the METS document of a DSpace SIP.
+type sipMETS struct {
+	XMLName    xml.Name     `xml:"mets"`
+	Xmlns      string       `xml:"xmlns,attr"`
+	XmlnsXlink string       `xml:"xmlns:xlink,attr"`
+	ObjID      string       `xml:"OBJID,attr"`
+	Label      string       `xml:"LABEL,attr,omitempty"`
+	Profile    string       `xml:"PROFILE,attr"`
+	DmdSec     sipDmdSec    `xml:"dmdSec"`
+	FileGrp    sipFileGrp   `xml:"fileSec>fileGrp"`
+	StructMap  sipStructMap `xml:"structMap"`
+}
+
+type sipDmdSec struct {
+	ID     string    `xml:"ID,attr"`
+	MDWrap sipMDWrap `xml:"mdWrap"`
+}
+
+type sipMDWrap struct {
+	MDType  string    `xml:"MDTYPE,attr"`
+	XmlnsDC string    `xml:"xmlns:dc,attr"`
+	Values  []dcValue `xml:"xmlData>dc"`
+}
+
+// dcValue is a Dublin Core element, marshaled as dc:<element>.
+type dcValue struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type sipFileGrp struct {
+	Use   string    `xml:"USE,attr"`
+	Files []sipFile `xml:"file"`
+}
+
+type sipFile struct {
+	ID           string `xml:"ID,attr"`
+	MIMEType     string `xml:"MIMETYPE,attr"`
+	Size         int64  `xml:"SIZE,attr"`
+	Checksum     string `xml:"CHECKSUM,attr"`
+	ChecksumType string `xml:"CHECKSUMTYPE,attr"`
+	FLocat       struct {
+		LocType string `xml:"LOCTYPE,attr"`
+		Href    string `xml:"xlink:href,attr"`
+	} `xml:"FLocat"`
+}
+
+type sipStructMap struct {
+	Div struct {
+		Type  string    `xml:"TYPE,attr"`
+		DMDID string    `xml:"DMDID,attr"`
+		Fptrs []sipFptr `xml:"fptr"`
+	} `xml:"div"`
+}
+
+type sipFptr struct {
+	FileID string `xml:"FILEID,attr"`
+}
+
+// newSIPMETS returns the METS document of a package, with its title, AIP UUID and simple Dublin Core metadata.
+func newSIPMETS(pkg *Package) *sipMETS {
+	mets := &sipMETS{
+		Xmlns:      metsNamespace,
+		XmlnsXlink: xlinkNamespace,
+		ObjID:      pkg.AIPUUID,
+		Label:      pkg.Title,
+		Profile:    dspaceMETSProfile,
+		DmdSec: sipDmdSec{
+			ID:     "dmd-1",
+			MDWrap: sipMDWrap{MDType: "DC", XmlnsDC: dcNamespace},
+		},
+		FileGrp: sipFileGrp{Use: "CONTENT"},
+	}
+	mets.StructMap.Div.Type = "DSpace Item"
+	mets.StructMap.Div.DMDID = mets.DmdSec.ID
+	mets.addDC("title", pkg.Title)
+	mets.addDC("identifier", pkg.AIPUUID)
+	for _, element := range dcElements {
+		if element == "title" {
+			continue
+		}
+		if value := strings.TrimSpace(pkg.Metadata["dc."+element]); value != "" {
+			mets.addDC(element, value)
+		}
+	}
+	return mets
+}
+
+func (m *sipMETS) addDC(element, value string) {
+	m.DmdSec.MDWrap.Values = append(m.DmdSec.MDWrap.Values, dcValue{XMLName: xml.Name{Local: "dc:" + element}, Value: value})
+}
+
+// addFile adds a content file to the file section and the item.
+func (m *sipMETS) addFile(id, href, checksum string, size int64) {
+	contentType := mime.TypeByExtension(path.Ext(href))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	file := sipFile{ID: id, MIMEType: contentType, Size: size, Checksum: checksum, ChecksumType: "MD5"}
+	file.FLocat.LocType = "URL"
+	file.FLocat.Href = href
+	m.FileGrp.Files = append(m.FileGrp.Files, file)
+	m.StructMap.Div.Fptrs = append(m.StructMap.Div.Fptrs, sipFptr{FileID: id})
+}
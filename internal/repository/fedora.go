@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	// fedoraTimeout bounds each request to Fedora, including binary uploads.
+	fedoraTimeout = 2 * time.Hour
+
+	ldpBasicContainer = "http://www.w3.org/ns/ldp#BasicContainer"
+	ldpNonRDFSource   = "http://www.w3.org/ns/ldp#NonRDFSource"
+
+	// preferMinimal lets a PUT replace the triples of an existing container without repeating its server managed triples.
+	preferMinimal = `handling=lenient; received="minimal"`
+)
+
+// fedoraDepositor deposits packages into a Fedora 6 repository. Each package is a PCDM object container named
+// after its AIP UUID, holding its access copies as binaries in containers mirroring the DIP folders, and its METS file.
+// A deposit is made in a Fedora transaction, so a failed deposit leaves no partial package.
+type fedoraDepositor struct {
+	config *config.FedoraConfig
+	client *utils.HTTPClient
+}
+
+func newFedoraDepositor(cfg *config.FedoraConfig, insecure bool) (*fedoraDepositor, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("fedora config cannot be nil")
+	}
+	return &fedoraDepositor{config: cfg, client: utils.NewHTTPClient(fedoraTimeout, insecure)}, nil
+}
+
+func (f *fedoraDepositor) Close() error {
+	f.client.Close()
+	return nil
+}
+
+// Deposit deposits a package in a transaction, retrying it on transient errors.
+func (f *fedoraDepositor) Deposit(ctx context.Context, pkg *Package) (*Receipt, error) {
+	files, err := accessFiles(pkg.DIPPath)
+	if err != nil {
+		return nil, err
+	}
+	itemPath := path.Join(strings.Trim(f.config.Container, "/"), pkg.AIPUUID)
+	err = utils.WithRetry(func() error {
+		return f.inTransaction(ctx, func(tx string) error {
+			return f.depositPackage(ctx, tx, itemPath, pkg, files)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Receipt{URI: f.resourceURL(itemPath)}, nil
+}
+
+// depositPackage creates or replaces the package container and uploads its files.
+func (f *fedoraDepositor) depositPackage(ctx context.Context, tx, itemPath string, pkg *Package, files []accessFile) error {
+	if f.config.Container != "" {
+		if err := f.ensureContainers(ctx, tx, strings.Trim(f.config.Container, "/")); err != nil {
+			return err
+		}
+	}
+	if err := f.putContainer(ctx, tx, itemPath, packageTurtle(pkg)); err != nil {
+		return err
+	}
+	for _, dir := range folders(files) {
+		turtle := containerTurtle(path.Base(dir))
+		if err := f.putContainer(ctx, tx, path.Join(itemPath, dir), turtle); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if err := f.putBinary(ctx, tx, path.Join(itemPath, file.Path), file.LocalPath); err != nil {
+			return err
+		}
+	}
+	if mets := metsFile(pkg.DIPPath); mets != "" {
+		if err := f.putBinary(ctx, tx, path.Join(itemPath, filepath.Base(mets)), mets); err != nil {
+			return err
+		}
+	}
+	logger.Debug("Deposited %d access copies into Fedora: %s", len(files), itemPath)
+	return nil
+}
+
+// inTransaction runs fn in a Fedora transaction, committing it if fn succeeds and rolling it back otherwise.
+func (f *fedoraDepositor) inTransaction(ctx context.Context, fn func(tx string) error) error {
+	resp, err := f.do(ctx, http.MethodPost, f.resourceURL("fcr:tx"), "", nil, nil)
+	if err != nil {
+		return fmt.Errorf("error starting Fedora transaction: %w", err)
+	}
+	closeBody(resp)
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("error starting Fedora transaction: %s", resp.Status)
+	}
+	tx := resp.Header.Get("Location")
+	if tx == "" {
+		return fmt.Errorf("fedora returned no transaction location")
+	}
+	if err := fn(tx); err != nil {
+		// Roll back with a fresh context, the deposit context may be cancelled
+		rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		if resp, rollbackErr := f.do(rollbackCtx, http.MethodDelete, tx, "", nil, nil); rollbackErr != nil {
+			logger.Error("Error rolling back Fedora transaction %s: %v", tx, rollbackErr)
+		} else {
+			closeBody(resp)
+		}
+		return err
+	}
+	resp, err = f.do(ctx, http.MethodPut, tx, "", nil, nil)
+	if err != nil {
+		return fmt.Errorf("error committing Fedora transaction: %w", err)
+	}
+	closeBody(resp)
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error committing Fedora transaction: %s", resp.Status)
+	}
+	return nil
+}
+
+// ensureContainers creates the missing containers of a path.
+func (f *fedoraDepositor) ensureContainers(ctx context.Context, tx, containerPath string) error {
+	current := ""
+	for segment := range strings.SplitSeq(containerPath, "/") {
+		current = path.Join(current, segment)
+		resp, err := f.do(ctx, http.MethodHead, f.resourceURL(current), tx, nil, nil)
+		if err != nil {
+			return fmt.Errorf("error checking Fedora container %s: %w", current, err)
+		}
+		closeBody(resp)
+		switch resp.StatusCode {
+		case http.StatusOK:
+			continue
+		case http.StatusNotFound:
+			if err := f.putContainer(ctx, tx, current, containerTurtle(segment)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("error checking Fedora container %s: %s", current, resp.Status)
+		}
+	}
+	return nil
+}
+
+// putContainer creates a basic container, or replaces the triples of an existing one.
+func (f *fedoraDepositor) putContainer(ctx context.Context, tx, containerPath, turtle string) error {
+	resp, err := f.do(ctx, http.MethodPut, f.resourceURL(containerPath), tx, strings.NewReader(turtle), map[string]string{
+		"Content-Type": "text/turtle",
+		"Link":         fmt.Sprintf(`<%s>; rel="type"`, ldpBasicContainer),
+		"Prefer":       preferMinimal,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating Fedora container %s: %w", containerPath, err)
+	}
+	return checkResponse(resp, "error creating Fedora container "+containerPath)
+}
+
+// putBinary uploads a file as a binary with its SHA-256 digest, which Fedora verifies.
+func (f *fedoraDepositor) putBinary(ctx context.Context, tx, binaryPath, localPath string) error {
+	checksum, err := utils.FileChecksum(localPath, "sha256")
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Clean(localPath))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	contentType := mime.TypeByExtension(filepath.Ext(localPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	resp, err := f.do(ctx, http.MethodPut, f.resourceURL(binaryPath), tx, file, map[string]string{
+		"Content-Type":        contentType,
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(localPath)}),
+		// Fedora expects hex encoded digests
+		"Digest": "sha-256=" + checksum,
+		"Link":   fmt.Sprintf(`<%s>; rel="type"`, ldpNonRDFSource),
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading %s to Fedora: %w", binaryPath, err)
+	}
+	return checkResponse(resp, "error uploading "+binaryPath+" to Fedora")
+}
+
+// do sends an authenticated request, in the transaction if tx is set.
+func (f *fedoraDepositor) do(ctx context.Context, method, resourceURL, tx string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	if tx != "" {
+		headers["Atomic-ID"] = tx
+	}
+	switch {
+	case f.config.Token != "":
+		headers["Authorization"] = "Bearer " + f.config.Token
+	case f.config.Username != "":
+		headers["Authorization"] = "Basic " + utils.Base64Encode(f.config.Username+":"+f.config.Password)
+	}
+	return f.client.DoRequest(ctx, method, resourceURL, body, headers)
+}
+
+// resourceURL returns the URL of a resource path, escaping its segments.
+func (f *fedoraDepositor) resourceURL(resourcePath string) string {
+	segments := strings.Split(resourcePath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(f.config.URL, "/") + "/" + strings.Join(segments, "/")
+}
+
+// folders returns the folders of the access copies, parents first.
+func folders(files []accessFile) []string {
+	var dirs []string
+	for _, file := range files {
+		for dir := path.Dir(file.Path); dir != "."; dir = path.Dir(dir) {
+			if !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// packageTurtle describes a package as a PCDM object with its Dublin Core metadata.
+func packageTurtle(pkg *Package) string {
+	var b strings.Builder
+	b.WriteString("@prefix dcterms: <http://purl.org/dc/terms/> .\n")
+	b.WriteString("@prefix pcdm: <http://pcdm.org/models#> .\n")
+	b.WriteString("<> a pcdm:Object ;\n")
+	fmt.Fprintf(&b, "  dcterms:title %s ;\n", turtleLiteral(pkg.Title))
+	fmt.Fprintf(&b, "  dcterms:identifier %s", turtleLiteral(pkg.AIPUUID))
+	keys := make([]string, 0, len(pkg.Metadata))
+	for key := range pkg.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		element, ok := strings.CutPrefix(key, "dc.")
+		if !ok || element == "title" {
+			continue
+		}
+		fmt.Fprintf(&b, " ;\n  dcterms:%s %s", element, turtleLiteral(pkg.Metadata[key]))
+	}
+	b.WriteString(" .\n")
+	return b.String()
+}
+
+// containerTurtle describes a folder container.
+func containerTurtle(title string) string {
+	return "@prefix dcterms: <http://purl.org/dc/terms/> .\n<> dcterms:title " + turtleLiteral(title) + " .\n"
+}
+
+// turtleLiteral returns a Turtle string literal.
+func turtleLiteral(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(value) + `"`
+}
+
+// checkResponse closes a response, returning an error with its status and message if the request failed.
+func checkResponse(resp *http.Response, message string) error {
+	defer closeBody(resp)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if len(body) > 0 {
+		return fmt.Errorf("%s: %s: %s", message, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return fmt.Errorf("%s: %s", message, resp.Status)
+}
+
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		logger.Error("Failed to close response body: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package repository deposits the access copies and metadata of preserved packages into access repositories,
+// such as Fedora repositories behind Samvera or Islandora, DSpace collections and Dataverse collections.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// Package is a preserved package deposited into a repository.
+type Package struct {
+	AIPUUID string
+	Title   string
+	// Metadata holds the Dublin Core (dc.*) and ISAD(G) (isadg.*) metadata of the package
+	Metadata map[string]string
+	// DIPPath is the DIP the access copies and METS file are read from
+	DIPPath string
+}
+
+// Receipt describes a deposited item.
+type Receipt struct {
+	// URI is the URI of the deposited item
+	URI string
+	// DOI is the DOI minted for the item by the repository, if any, e.g. 10.5072/FK2/ABCDEF
+	DOI string
+}
+
+// Depositor deposits packages into a repository.
+type Depositor interface {
+	// Deposit deposits the access copies and metadata of a package.
+	// Backends that address items by AIP UUID replace a previous deposit of the same AIP.
+	Deposit(ctx context.Context, pkg *Package) (*Receipt, error)
+	// Close releases the depositor resources.
+	Close() error
+}
+
+// New returns the depositor of a repository.
+func New(cfg *config.RepositoryConfig, insecure bool) (Depositor, error) {
+	switch cfg.Backend {
+	case config.RepositoryBackendFedora:
+		return newFedoraDepositor(cfg.Fedora, insecure)
+	case config.RepositoryBackendDSpace:
+		return newDSpaceDepositor(cfg.DSpace, insecure)
+	case config.RepositoryBackendDataverse:
+		return newDataverseDepositor(cfg.Dataverse, insecure)
+	default:
+		return nil, fmt.Errorf("unsupported repository backend: %s", cfg.Backend)
+	}
+}
+
+// accessFile is an access copy of a DIP.
+type accessFile struct {
+	// Path is slash separated and relative to the objects directory of the DIP
+	Path      string
+	LocalPath string
+}
+
+// accessFiles returns the access copies of a DIP, sorted by path.
+func accessFiles(dipPath string) ([]accessFile, error) {
+	objectsDir := filepath.Join(dipPath, "objects")
+	var files []accessFile
+	err := filepath.WalkDir(objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(objectsDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, accessFile{Path: filepath.ToSlash(rel), LocalPath: path})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing access copies: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("DIP has no access copies")
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// metsFile returns the METS file of a DIP, or an empty string if it has none.
+func metsFile(dipPath string) string {
+	matches, err := filepath.Glob(filepath.Join(dipPath, "METS.*.xml"))
+	if err != nil || len(matches) == 0 {
+		return ""
+	}
+	slices.Sort(matches)
+	return matches[0]
+}
@@ -0,0 +1,13 @@
+package internal
+
+import (
+	"github.com/penwern/curate-preservation-core/internal/aipstore"
+	"github.com/penwern/curate-preservation-core/internal/resourcesync"
+)
+
+// NewResourceSyncSource publishes the AIP storage locations of the service over ResourceSync.
+func NewResourceSyncSource(svc *Service) (*resourcesync.Source, error) {
+	return resourcesync.NewSource(svc.cfg.ResourceSync.BaseURL, svc.svc.StorageLocations(), func(location string) (*aipstore.Store, error) {
+		return svc.svc.AIPStore(location)
+	})
+}
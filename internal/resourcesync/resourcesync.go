@@ -0,0 +1,322 @@
+// Package resourcesync publishes the AIP storage locations as ResourceSync (ANSI/NISO Z39.99) sources, so
+// downstream mirrors can synchronize their holdings incrementally. Each location has a capability list, a resource
+// list of the files of its AIPs with their SHA-256 checksums, and a change list of the files stored since a date.
+// The AIP files are served alongside the lists, so every listed resource can be fetched.
+package resourcesync
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/aipstore"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	sitemapNamespace      = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	resourceSyncNamespace = "http://www.openarchives.org/rs/terms/"
+
+	// listTimeout bounds the generation of a list, which reads the manifest of every AIP of a location.
+	listTimeout = 10 * time.Minute
+)
+
+// StoreOpener opens the store of a storage location. The caller closes the store.
+type StoreOpener func(location string) (*aipstore.Store, error)
+
+// Source publishes the storage locations.
+type Source struct {
+	baseURL   string
+	locations []string
+	open      StoreOpener
+}
+
+// NewSource creates a source publishing the given storage locations, with URLs below baseURL.
+func NewSource(baseURL string, locations []string, open StoreOpener) (*Source, error) {
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("ResourceSync requires AIP storage locations")
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid ResourceSync base URL: %w", err)
+	}
+	return &Source{baseURL: strings.TrimSuffix(baseURL, "/"), locations: locations, open: open}, nil
+}
+
+// urlset is a ResourceSync document, a sitemap with ResourceSync links and metadata.
+type urlset struct {
+	XMLName  xml.Name   `xml:"urlset"`
+	Xmlns    string     `xml:"xmlns,attr"`
+	XmlnsRS  string     `xml:"xmlns:rs,attr"`
+	Links    []link     `xml:"rs:ln"`
+	Metadata metadata   `xml:"rs:md"`
+	URLs     []urlEntry `xml:"url"`
+}
+
+type link struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type metadata struct {
+	Capability string `xml:"capability,attr,omitempty"`
+	At         string `xml:"at,attr,omitempty"`
+	Completed  string `xml:"completed,attr,omitempty"`
+	From       string `xml:"from,attr,omitempty"`
+	Until      string `xml:"until,attr,omitempty"`
+	Change     string `xml:"change,attr,omitempty"`
+	Datetime   string `xml:"datetime,attr,omitempty"`
+	Hash       string `xml:"hash,attr,omitempty"`
+	Length     string `xml:"length,attr,omitempty"`
+	Type       string `xml:"type,attr,omitempty"`
+}
+
+type urlEntry struct {
+	Loc      string    `xml:"loc"`
+	Lastmod  string    `xml:"lastmod,omitempty"`
+	Metadata *metadata `xml:"rs:md,omitempty"`
+}
+
+// resource is a stored file of an AIP.
+type resource struct {
+	aipUUID string
+	file    aipstore.StoredFile
+}
+
+// Description serves the source description, listing the capability list of every location.
+func (s *Source) Description(w http.ResponseWriter, _ *http.Request) {
+	doc := newURLSet(metadata{Capability: "description"})
+	for _, location := range s.locations {
+		doc.URLs = append(doc.URLs, urlEntry{
+			Loc:      s.locationURL(location, "capabilitylist.xml"),
+			Metadata: &metadata{Capability: "capabilitylist"},
+		})
+	}
+	writeXML(w, doc)
+}
+
+// CapabilityList serves the capability list of a location.
+func (s *Source) CapabilityList(w http.ResponseWriter, r *http.Request) {
+	location, ok := s.location(w, r)
+	if !ok {
+		return
+	}
+	doc := newURLSet(metadata{Capability: "capabilitylist"})
+	doc.Links = []link{{Rel: "up", Href: s.baseURL + "/.well-known/resourcesync"}}
+	doc.URLs = []urlEntry{
+		{Loc: s.locationURL(location, "resourcelist.xml"), Metadata: &metadata{Capability: "resourcelist"}},
+		{Loc: s.locationURL(location, "changelist.xml"), Metadata: &metadata{Capability: "changelist"}},
+	}
+	writeXML(w, doc)
+}
+
+// ResourceList serves the resource list of a location: every file of its stored AIPs.
+func (s *Source) ResourceList(w http.ResponseWriter, r *http.Request) {
+	location, ok := s.location(w, r)
+	if !ok {
+		return
+	}
+	at := time.Now().UTC()
+	resources, ok := s.resources(w, r, location)
+	if !ok {
+		return
+	}
+	doc := newURLSet(metadata{Capability: "resourcelist", At: formatTime(at), Completed: formatTime(time.Now())})
+	doc.Links = []link{{Rel: "up", Href: s.locationURL(location, "capabilitylist.xml")}}
+	for _, res := range resources {
+		doc.URLs = append(doc.URLs, s.entry(location, res, ""))
+	}
+	writeXML(w, doc)
+}
+
+// ChangeList serves the change list of a location: the files stored since the from query parameter (RFC 3339),
+// or all files, oldest first. Stored AIP files are not modified, so every change is a creation; a file stored again
+// is listed again with its new modification time.
+func (s *Source) ChangeList(w http.ResponseWriter, r *http.Request) {
+	location, ok := s.location(w, r)
+	if !ok {
+		return
+	}
+	var from time.Time
+	if v := r.URL.Query().Get("from"); v != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid from parameter, expected RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	until := time.Now().UTC()
+	resources, ok := s.resources(w, r, location)
+	if !ok {
+		return
+	}
+	var changes []resource
+	for _, res := range resources {
+		if !res.file.ModTime.Before(from) && !res.file.ModTime.After(until) {
+			changes = append(changes, res)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].file.ModTime.Before(changes[j].file.ModTime) })
+	if from.IsZero() && len(changes) > 0 {
+		from = changes[0].file.ModTime
+	}
+	md := metadata{Capability: "changelist", Until: formatTime(until)}
+	if !from.IsZero() {
+		md.From = formatTime(from)
+	}
+	doc := newURLSet(md)
+	doc.Links = []link{{Rel: "up", Href: s.locationURL(location, "capabilitylist.xml")}}
+	for _, res := range changes {
+		doc.URLs = append(doc.URLs, s.entry(location, res, "created"))
+	}
+	writeXML(w, doc)
+}
+
+// Resource serves a stored file of an AIP. Archived files must be restored before they can be read.
+func (s *Source) Resource(w http.ResponseWriter, r *http.Request) {
+	location, ok := s.location(w, r)
+	if !ok {
+		return
+	}
+	store, err := s.open(location)
+	if err != nil {
+		logger.Error("Failed to open storage location %s: %v", location, err)
+		http.Error(w, "failed to open storage location", http.StatusInternalServerError)
+		return
+	}
+	defer store.Close()
+	reader, err := store.OpenFile(r.Context(), r.PathValue("uuid"), r.PathValue("path"))
+	if errors.Is(err, aipstore.ErrNotFound) {
+		http.Error(w, "AIP file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to read AIP file %s/%s from %s: %v", r.PathValue("uuid"), r.PathValue("path"), location, err)
+		http.Error(w, "failed to read AIP file, it may need to be restored", http.StatusBadGateway)
+		return
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			logger.Error("Failed to close AIP file: %v", err)
+		}
+	}()
+	// AIP files can be large, lift the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("Failed to lift write deadline: %v", err)
+	}
+	contentType := mime.TypeByExtension(path.Ext(r.PathValue("path")))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := io.Copy(w, reader); err != nil {
+		logger.Error("Failed to send AIP file: %v", err)
+	}
+}
+
+// location returns the location of a request, writing a 404 response if it is not published.
+func (s *Source) location(w http.ResponseWriter, r *http.Request) (string, bool) {
+	location := r.PathValue("location")
+	if !slices.Contains(s.locations, location) {
+		http.Error(w, "storage location not found", http.StatusNotFound)
+		return "", false
+	}
+	return location, true
+}
+
+// resources returns the files of the AIPs of a location, writing the error response if they cannot be listed.
+func (s *Source) resources(w http.ResponseWriter, r *http.Request, location string) ([]resource, bool) {
+	// Reading every manifest can outlast the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(listTimeout)); err != nil {
+		logger.Debug("Failed to extend write deadline: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), listTimeout)
+	defer cancel()
+	store, err := s.open(location)
+	if err != nil {
+		logger.Error("Failed to open storage location %s: %v", location, err)
+		http.Error(w, "failed to open storage location", http.StatusInternalServerError)
+		return nil, false
+	}
+	defer store.Close()
+	aipUUIDs, err := store.ListAIPs(ctx)
+	if err != nil {
+		logger.Error("Failed to list AIPs in %s: %v", location, err)
+		http.Error(w, "failed to list AIPs", http.StatusBadGateway)
+		return nil, false
+	}
+	var resources []resource
+	for _, aipUUID := range aipUUIDs {
+		files, err := store.Files(ctx, aipUUID)
+		if err != nil {
+			logger.Error("Failed to list files of AIP %s in %s: %v", aipUUID, location, err)
+			http.Error(w, "failed to list AIP files", http.StatusBadGateway)
+			return nil, false
+		}
+		for _, file := range files {
+			resources = append(resources, resource{aipUUID: aipUUID, file: file})
+		}
+	}
+	return resources, true
+}
+
+// entry returns the list entry of a resource, with its change if set.
+func (s *Source) entry(location string, res resource, change string) urlEntry {
+	md := &metadata{Change: change, Length: strconv.FormatInt(res.file.Size, 10)}
+	if res.file.Checksum != "" {
+		md.Hash = "sha-256:" + res.file.Checksum
+	}
+	if contentType := mime.TypeByExtension(path.Ext(res.file.Path)); contentType != "" {
+		md.Type = contentType
+	}
+	if change != "" {
+		md.Datetime = formatTime(res.file.ModTime)
+	}
+	return urlEntry{
+		Loc:      s.locationURL(location, "aips", res.aipUUID, res.file.Path),
+		Lastmod:  formatTime(res.file.ModTime),
+		Metadata: md,
+	}
+}
+
+// locationURL returns the URL of a path below the location, escaping its segments.
+func (s *Source) locationURL(location string, parts ...string) string {
+	segments := []string{s.baseURL, "resourcesync", url.PathEscape(location)}
+	for _, part := range parts {
+		for segment := range strings.SplitSeq(part, "/") {
+			segments = append(segments, url.PathEscape(segment))
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func newURLSet(md metadata) *urlset {
+	return &urlset{Xmlns: sitemapNamespace, XmlnsRS: resourceSyncNamespace, Metadata: md}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func writeXML(w http.ResponseWriter, doc *urlset) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		logger.Error("Failed to write ResourceSync document: %v", err)
+		return
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		logger.Error("Failed to write ResourceSync document: %v", err)
+	}
+}
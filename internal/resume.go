@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/limits"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// ErrNotResumable is returned when resuming a package that did not fail, or whose outputs were not kept.
+var ErrNotResumable = errors.New("package cannot be resumed")
+
+// ResumablePackage returns the record of a failed package that can be resumed from its checkpoint. The id is a
+// package ID, or a job ID whose latest package is resumed. Returns catalog.ErrNotFound if there is no such package,
+// and ErrNotResumable if it did not fail, if a later attempt of its job is queued or running, or if its outputs were
+// not kept. Tenants only find their own packages.
+func (s *Service) ResumablePackage(ctx context.Context, id string) (*catalog.Record, error) {
+	store := s.Catalog()
+	if store == nil {
+		return nil, errors.New("package records are disabled, packages cannot be resumed")
+	}
+	rec, err := store.Get(id)
+	if errors.Is(err, catalog.ErrNotFound) {
+		rec, err = store.FindJob(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tenant := preservation.TenantFromContext(ctx); tenant != "" && rec.Tenant != tenant {
+		return nil, catalog.ErrNotFound
+	}
+	if rec.Outcome != catalog.OutcomeFailure {
+		outcome := rec.Outcome
+		if outcome == "" {
+			outcome = "running"
+		}
+		return nil, fmt.Errorf("%w: package %s is %s, only failed packages are resumed", ErrNotResumable, rec.ID, outcome)
+	}
+	if rec.JobID != "" {
+		status, err := s.JobStatus(ctx, rec.JobID)
+		if err != nil {
+			return nil, err
+		}
+		if status.Status != JobStatusFailed {
+			return nil, fmt.Errorf("%w: job %s is %s", ErrNotResumable, rec.JobID, status.Status)
+		}
+	}
+	if rec.Checkpoint == nil {
+		return nil, fmt.Errorf("%w: package %s failed before a checkpoint or its outputs were removed, retry it instead", ErrNotResumable, rec.ID)
+	}
+	if err := rec.Checkpoint.Check(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotResumable, err)
+	}
+	return rec, nil
+}
+
+// PlanResume returns the actions resuming a failed package would take, from its checkpoint, without modifying
+// anything.
+func PlanResume(rec *catalog.Record) []preservation.PlannedAction {
+	checkpoint := rec.Checkpoint
+	actions := []preservation.PlannedAction{{
+		Stage:  catalog.EventPreservation,
+		Action: fmt.Sprintf("Resume package %s of %s from its %s checkpoint in %s", rec.ID, rec.CellsPath, checkpoint.Stage, checkpoint.ProcessingDir),
+	}}
+	if !checkpoint.Reached(catalog.CheckpointCharacterized) {
+		actions = append(actions, preservation.PlannedAction{Stage: catalog.EventPackaging, Action: "Submit the transfer to A3M: " + checkpoint.TransferPath})
+	}
+	if !checkpoint.Reached(catalog.CheckpointPackaged) {
+		actions = append(actions, preservation.PlannedAction{Stage: catalog.EventExtraction, Action: "Extract, export and compress the AIP"})
+	}
+	actions = append(actions, preservation.PlannedAction{Stage: catalog.EventStorage, Action: "Disseminate and store the AIP"})
+	if rec.JobID != "" {
+		actions = append(actions, preservation.PlannedAction{Stage: catalog.EventPreservation, Action: "Record the package as the latest attempt of job " + rec.JobID})
+	}
+	return actions
+}
+
+// ResumePackage preserves a failed package again from its checkpoint, the last stage of the pipeline it completed:
+// only the stages after it are run, on the outputs kept by the failed package. The package is preserved once, as
+// the same user, tenant and job, with the profile, deselections and metadata of the failed package. The resumed
+// package is a new record, which takes over the outputs and is resumed in turn if it fails. Returns its record,
+// nil if it was not recorded, and the error of the preservation.
+// Returns ErrShuttingDown if the service shuts down, and a *MaintenanceError during a maintenance window.
+func (s *Service) ResumePackage(ctx context.Context, rec *catalog.Record) (*catalog.Record, error) {
+	if err := s.checkMaintenance(); err != nil {
+		return nil, err
+	}
+	ctx, done, err := s.track(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	userClient, err := s.svc.NewUserClient(ctx, rec.Username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user client: %w", err)
+	}
+	atomCfg, err := config.GetAtomConfig(s.cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AtoM configuration: %w", err)
+	}
+	// The checkpoint is taken so that the outputs are only resumed once
+	store := s.Catalog()
+	checkpoint, err := store.TakeCheckpoint(rec.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error taking the checkpoint of package %s: %w", rec.ID, err)
+	}
+
+	ctx = preservation.WithResume(ctx, rec, checkpoint)
+	ctx = preservation.WithMetadata(preservation.WithTenant(ctx, rec.Tenant), rec.Metadata)
+	if rec.JobID != "" {
+		ctx = preservation.WithJob(ctx, rec.JobID, rec.QueuedAt)
+	}
+	// Packages beyond the global concurrency limit wait for a running preservation to end
+	runErr := s.Limits().Do(ctx, limits.Global, func() error {
+		return s.svc.Run(ctx, nil, atomCfg, userClient, rec.CellsPath, rec.Profile, rec.Deselect, s.cfg.Cleanup, checkpoint.PathResolved)
+	})
+
+	resumed, err := s.resumedRecord(rec.ID)
+	if err != nil {
+		logger.Error("Error finding the package resuming %s: %v", rec.ID, err)
+	}
+	return resumed, runErr
+}
+
+// resumedRecord returns the most recent record of the packages resuming a package, or nil if there is none.
+func (s *Service) resumedRecord(id string) (*catalog.Record, error) {
+	records, err := s.Catalog().List()
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		if rec.ResumedFrom == id {
+			return rec, nil
+		}
+	}
+	return nil, nil
+}
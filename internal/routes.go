@@ -0,0 +1,346 @@
+package internal
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/apikeys"
+	"github.com/penwern/curate-preservation-core/internal/atom"
+	"github.com/penwern/curate-preservation-core/internal/audit"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/health"
+	"github.com/penwern/curate-preservation-core/internal/limits"
+	"github.com/penwern/curate-preservation-core/internal/openapi"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/profiles"
+	"github.com/penwern/curate-preservation-core/internal/pronom"
+	"github.com/penwern/curate-preservation-core/internal/scheduler"
+	"github.com/penwern/curate-preservation-core/internal/source"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/version"
+)
+
+// apiRoute is an endpoint of the JSON API. Routes are registered by Serve and described in the OpenAPI document
+// served at /openapi.json, from which the Go client is generated.
+type apiRoute struct {
+	Method    string
+	Path      string // Pattern of the path, as in http.ServeMux
+	Operation string // Operation ID in the OpenAPI document, and method name in the Go client
+	Summary   string
+	Role      string // Role required, public if empty
+	Global    bool   // Not available to users bound to a tenant
+	Limited   bool   // Rate limited with the other submission endpoints, and refused while the intake is paused
+	AnyMethod bool   // Served for every method, as before the method was documented
+	Query     []apiParam
+	Request   any  // Request body, decoded from JSON
+	Response  any  // Response body, encoded as JSON
+	Status    int  // Status of the successful responses, 200 OK if not set
+	Stream    bool // Response streamed as Server-Sent Events of the response type
+	Download  bool // Response is a file to download, of the content type of the file
+	Problems  bool // Invalid requests respond with RFC 7807 problem details
+	Audited   bool // Reads recorded in the audit log like changes, e.g. the reads of the audit log
+}
+
+// apiParam is a query parameter of a route.
+type apiParam struct {
+	Name        string
+	Description string
+	Type        string // JSON schema type, string if empty
+}
+
+// pathParamPattern matches the wildcards of the route patterns, e.g. {id} or {id...}.
+var pathParamPattern = regexp.MustCompile(`\{([a-z_]+)(\.\.\.)?\}`)
+
+// apiRoutes returns the routes of the JSON API. The OAI-PMH and ResourceSync endpoints follow their own
+// specifications and are not listed.
+func apiRoutes() []apiRoute {
+	limit := func(def int) apiParam {
+		return apiParam{Name: "limit", Type: "integer", Description: "Maximum number of results, " + strconv.Itoa(def) + " by default"}
+	}
+	return []apiRoute{
+		{Method: http.MethodGet, Path: "/healthz", Operation: "getLiveness", Summary: "Liveness of the service",
+			Response: map[string]string{}},
+		{Method: http.MethodGet, Path: "/readyz", Operation: "getReadiness",
+			Summary: "Readiness of the service, with the status of each dependency. Responds with 503 if a check failed", Response: health.Report{}},
+		{Method: http.MethodPost, Path: "/preserve", Operation: "preserve", AnyMethod: true, Role: config.RoleSubmitter, Limited: true, Problems: true,
+			Summary: "Preserve packages, responding once they are preserved. Dry runs respond with the planned processing steps of each package, without modifying anything",
+			Request: ServiceArgs{}, Response: []*preservation.Plan{}},
+		{Method: http.MethodGet, Path: "/packages", Operation: "listPackages", Role: config.RoleViewer,
+			Summary: "Package records, most recent first, a page at a time", Response: catalog.Page{}, Query: []apiParam{
+				{Name: "username"}, {Name: "path"}, {Name: "workspace"}, {Name: "profile"}, {Name: "outcome"},
+				{Name: "fingerprint", Description: "Fingerprint of the content of the transfer"},
+				{Name: "state", Description: "Lifecycle states, comma separated"},
+				{Name: "review_required", Type: "boolean"},
+				{Name: "since", Description: "RFC 3339 time, on the creation time"},
+				{Name: "until", Description: "RFC 3339 time, on the creation time"},
+				{Name: "sort", Description: "Field to sort by: " + strings.Join(catalog.SortFields, ", ")},
+				{Name: "order", Description: "asc or desc"},
+				{Name: "offset", Type: "integer"},
+				limit(defaultPageSize),
+			}},
+		{Method: http.MethodGet, Path: "/packages/{id}", Operation: "getPackage", Role: config.RoleViewer,
+			Summary: "Package record with its outcome and full timeline", Response: catalog.Record{}},
+		{Method: http.MethodGet, Path: "/packages/{id}/timeline", Operation: "getPackageTimeline", Role: config.RoleViewer,
+			Summary: "Package timeline", Response: TimelineResponse{}, Query: []apiParam{
+				{Name: "type"}, {Name: "outcome"}, {Name: "since", Description: "RFC 3339 time"},
+			}},
+		{Method: http.MethodGet, Path: "/packages/{id}/state", Operation: "getPackageState", Role: config.RoleViewer,
+			Summary: "Package lifecycle state and history, with the A3M processing progress", Response: StateResponse{}},
+		{Method: http.MethodGet, Path: "/packages/states", Operation: "countPackageStates", Role: config.RoleViewer,
+			Summary: "Number of packages in each lifecycle state", Response: map[catalog.State]int{}},
+		{Method: http.MethodGet, Path: "/packages/progress", Operation: "streamProgress", Role: config.RoleViewer,
+			Summary: "Live progress of the running preservations", Response: catalog.ProgressEvent{}, Stream: true,
+			Query: []apiParam{{Name: "username"}, {Name: "path"}}},
+		{Method: http.MethodGet, Path: "/packages/{id}/progress", Operation: "streamPackageProgress", Role: config.RoleViewer,
+			Summary: "Live progress of a package, ending once it is preserved", Response: catalog.ProgressEvent{}, Stream: true},
+		{Method: http.MethodGet, Path: "/atom/descriptions", Operation: "searchDescriptions", Role: config.RoleViewer, Global: true,
+			Summary: "Search AtoM archival descriptions", Response: []atom.Description{}, Query: []apiParam{
+				{Name: "q", Description: "Search terms"}, {Name: "field", Description: "identifier or title"},
+			}},
+		{Method: http.MethodGet, Path: "/atom/descriptions/resolve", Operation: "resolveDescription", Role: config.RoleViewer, Global: true,
+			Summary:  "Resolve a slug, identifier or title to an AtoM slug. Ambiguous references respond with 409 and the candidates",
+			Response: ResolveResponse{}, Query: []apiParam{{Name: "ref", Description: "Slug, identifier or title"}}},
+		{Method: http.MethodPost, Path: "/intake/uploads", Operation: "createUpload", Role: config.RoleSubmitter, Limited: true, Problems: true,
+			Summary: "Start a presigned upload of a transfer", Request: CreateUploadRequest{}, Response: source.Upload{}, Status: http.StatusCreated},
+		{Method: http.MethodPost, Path: "/intake/uploads/complete", Operation: "completeUpload", Role: config.RoleSubmitter, Limited: true, Problems: true,
+			Summary: "Complete an upload and queue its preservation", Request: CompleteUploadRequest{}, Status: http.StatusAccepted},
+		{Method: http.MethodPost, Path: "/intake/uploads/abort", Operation: "abortUpload", Role: config.RoleSubmitter, Problems: true,
+			Summary: "Cancel an upload", Request: AbortUploadRequest{}, Status: http.StatusNoContent},
+		{Method: http.MethodPost, Path: "/batches", Operation: "submitBatch", Role: config.RoleSubmitter, Limited: true, Problems: true,
+			Summary: "Queue a batch of packages with shared metadata and profile", Request: BatchRequest{}, Response: catalog.Batch{},
+			Status: http.StatusAccepted},
+		{Method: http.MethodGet, Path: "/batches", Operation: "listBatches", Role: config.RoleViewer,
+			Summary: "Batch records, most recent first", Response: []catalog.Batch{},
+			Query: []apiParam{{Name: "status"}, limit(defaultBatchesLimit)}},
+		{Method: http.MethodGet, Path: "/batches/{id}", Operation: "getBatch", Role: config.RoleViewer,
+			Summary: "Batch record with the status of each package", Response: catalog.Batch{}},
+		{Method: http.MethodPost, Path: "/flows/jobs", Operation: "submitFlowJobs", Role: config.RoleSubmitter, Limited: true, Problems: true,
+			Summary: "Queue the preservation of the nodes of a Cells Flow", Request: FlowJobRequest{}, Response: FlowJobsResponse{},
+			Status: http.StatusAccepted},
+		{Method: http.MethodGet, Path: "/quotas", Operation: "getQuotas", Role: config.RoleViewer,
+			Summary:  "Quotas of the tenants and workspaces, with the storage and jobs used. Tenants only get their own quota",
+			Response: []*preservation.QuotaUsage{}},
+		{Method: http.MethodGet, Path: "/jobs", Operation: "listJobs", Role: config.RoleViewer,
+			Summary:  "Jobs of the queue, pending first in the order they were queued, then the jobs that started, most recent first",
+			Response: []JobStatus{}, Query: []apiParam{
+				{Name: "status", Description: "pending, running, completed, failed or cancelled"},
+				limit(defaultJobsLimit),
+			}},
+		{Method: http.MethodGet, Path: "/jobs/{id}", Operation: "getJob", Role: config.RoleViewer,
+			Summary:  "Status of a job, waiting for it to change with wait. The job ID is escaped, slashes included",
+			Response: JobStatus{}, Query: []apiParam{
+				{Name: "wait", Description: "Seconds to wait for the job to change from the If-None-Match entity tag, or from its status, up to 60"},
+			}},
+		{Method: http.MethodGet, Path: "/jobs/{id}/events", Operation: "listJobEvents", Role: config.RoleViewer,
+			Summary:  "Lifecycle of a job, oldest first: queued, preservation attempts, state transitions, stages and warnings. The job ID is escaped, slashes included",
+			Response: JobEvents{}},
+		{Method: http.MethodGet, Path: "/jobs/{id}/artifacts", Operation: "listJobArtifacts", Role: config.RoleViewer,
+			Summary:  "Artifacts of the package preserved by a job, such as its reports and METS. The job ID is escaped, slashes included",
+			Response: JobArtifacts{}},
+		{Method: http.MethodGet, Path: "/jobs/{id}/artifacts/{name}", Operation: "getJobArtifact", Role: config.RoleViewer, Download: true,
+			Summary: "Download an artifact of the package preserved by a job"},
+		{Method: http.MethodPost, Path: "/jobs/{id}/retry", Operation: "retryJob", Role: config.RoleOperator,
+			Summary:  "Queue a failed or cancelled job again, to preserve its package as it was submitted. The job ID is escaped, slashes included",
+			Response: JobStatus{}, Status: http.StatusAccepted},
+		{Method: http.MethodDelete, Path: "/jobs/{id...}", Operation: "cancelJob", Role: config.RoleOperator,
+			Summary: "Cancel a queued or running job. Responds with 202 while a running job stops", Response: JobCancellation{}},
+		{Method: http.MethodGet, Path: "/admin/concurrency", Operation: "getConcurrency", Role: config.RoleAdmin, Global: true,
+			Summary: "Concurrency limits, with the running and waiting work", Response: map[string]limits.Status{}},
+		{Method: http.MethodPut, Path: "/admin/concurrency", Operation: "setConcurrency", Role: config.RoleAdmin, Global: true,
+			Summary: "Change concurrency limits until the service restarts", Request: map[string]int{}, Response: map[string]limits.Status{}},
+		{Method: http.MethodPost, Path: "/admin/config/reload", Operation: "reloadConfig", Role: config.RoleAdmin, Global: true,
+			Summary:  "Reload the .env settings and the config files of the integrations. The current configuration is kept if they are invalid",
+			Response: ConfigReload{}},
+		{Method: http.MethodGet, Path: "/admin/state", Operation: "getRuntimeState", Role: config.RoleAdmin, Global: true,
+			Summary:  "Runtime state of the instance: maintenance state, queue depth, running jobs and resource usage",
+			Response: RuntimeState{}},
+		{Method: http.MethodGet, Path: "/admin/metrics", Operation: "getMetrics", Role: config.RoleAdmin, Global: true,
+			Summary:  "Rolling metrics of the instance: percentiles of the stage durations and queue waits, queue depth and alerts",
+			Response: Metrics{}},
+		{Method: http.MethodPost, Path: "/admin/maintenance/start", Operation: "startMaintenance", Role: config.RoleAdmin, Global: true, Problems: true,
+			Summary: "Start a maintenance window: the job workers are drained, and submissions are queued and held, or refused with 503 and a Retry-After, until it ends",
+			Request: MaintenanceRequest{}, Response: RuntimeState{}},
+		{Method: http.MethodPost, Path: "/admin/maintenance/end", Operation: "endMaintenance", Role: config.RoleAdmin, Global: true,
+			Summary: "End the maintenance window, the job workers it drained take the queued jobs again", Response: RuntimeState{}},
+		{Method: http.MethodPost, Path: "/admin/intake/pause", Operation: "pauseIntake", Role: config.RoleAdmin, Global: true,
+			Summary: "Refuse submissions with 503 until the intake resumes", Response: RuntimeState{}},
+		{Method: http.MethodPost, Path: "/admin/intake/resume", Operation: "resumeIntake", Role: config.RoleAdmin, Global: true,
+			Summary: "Accept submissions again", Response: RuntimeState{}},
+		{Method: http.MethodPost, Path: "/admin/workers/drain", Operation: "drainWorkers", Role: config.RoleAdmin, Global: true,
+			Summary: "Stop taking queued jobs on this instance once the running job completes", Response: RuntimeState{}},
+		{Method: http.MethodPost, Path: "/admin/workers/resume", Operation: "resumeWorkers", Role: config.RoleAdmin, Global: true,
+			Summary: "Take queued jobs again", Response: RuntimeState{}},
+		{Method: http.MethodGet, Path: "/admin/api-keys", Operation: "listAPIKeys", Role: config.RoleAdmin, Global: true, Audited: true,
+			Summary: "API keys, without their values", Response: []apikeys.Key{}},
+		{Method: http.MethodPost, Path: "/admin/api-keys", Operation: "createAPIKey", Role: config.RoleAdmin, Global: true,
+			Summary: "Create an API key, returning its value once", Request: CreateAPIKeyRequest{}, Response: CreateAPIKeyResponse{},
+			Status: http.StatusCreated},
+		{Method: http.MethodDelete, Path: "/admin/api-keys/{id}", Operation: "revokeAPIKey", Role: config.RoleAdmin, Global: true,
+			Summary: "Revoke an API key", Response: apikeys.Key{}},
+		{Method: http.MethodPost, Path: "/admin/pronom/sync", Operation: "syncPronom", Role: config.RoleAdmin, Global: true,
+			Summary:  "Update the siegfried signature file to the latest PRONOM release, and list the formats added since with their policy",
+			Response: pronom.Sync{}, Query: []apiParam{{Name: "since", Description: "PRONOM release the formats are compared with, e.g. DROID_SignatureFile_V118.xml"}}},
+		{Method: http.MethodGet, Path: "/admin/audit", Operation: "listAuditLog", Role: config.RoleAdmin, Global: true, Audited: true,
+			Summary: "Entries of the audit log, most recent first", Response: []audit.Entry{}, Query: []apiParam{
+				{Name: "since", Description: "RFC 3339 time"}, {Name: "until", Description: "RFC 3339 time"},
+				{Name: "username"}, {Name: "action", Description: "Operation of the API, e.g. cancelJob"},
+				{Name: "outcome", Description: "success, denied or failure"},
+				limit(defaultAuditLimit),
+			}},
+		{Method: http.MethodGet, Path: "/admin/audit/export", Operation: "exportAuditLog", Role: config.RoleAdmin, Global: true, Audited: true,
+			Download: true, Summary: "Export the entries of the audit log, oldest first", Query: []apiParam{
+				{Name: "since", Description: "RFC 3339 time"}, {Name: "until", Description: "RFC 3339 time"},
+				{Name: "username"}, {Name: "action", Description: "Operation of the API, e.g. cancelJob"},
+				{Name: "outcome", Description: "success, denied or failure"},
+				{Name: "format", Description: "jsonl (JSON lines) or csv, jsonl by default"},
+			}},
+		{Method: http.MethodGet, Path: "/admin/profiles", Operation: "listProfiles", Role: config.RoleAdmin, Global: true,
+			Summary: "Processing profiles, with their assignments", Response: []profiles.Profile{}},
+		{Method: http.MethodPost, Path: "/admin/profiles", Operation: "createProfile", Role: config.RoleAdmin, Global: true,
+			Summary: "Create a processing profile", Request: profiles.NewProfile{}, Response: profiles.Profile{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: "/admin/profiles/{name}", Operation: "getProfile", Role: config.RoleAdmin, Global: true,
+			Summary: "Processing profile", Response: profiles.Profile{}},
+		{Method: http.MethodPut, Path: "/admin/profiles/{name}", Operation: "updateProfile", Role: config.RoleAdmin, Global: true,
+			Summary: "Replace the settings of a processing profile, from its current version", Request: config.ProcessingProfile{},
+			Response: profiles.Profile{}},
+		{Method: http.MethodDelete, Path: "/admin/profiles/{name}", Operation: "deleteProfile", Role: config.RoleAdmin, Global: true,
+			Summary: "Delete a processing profile that is not in use", Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/admin/profiles/{name}/versions", Operation: "listProfileVersions", Role: config.RoleAdmin, Global: true,
+			Summary: "Versions of a processing profile, most recent first", Response: []config.ProcessingProfile{}},
+		{Method: http.MethodPut, Path: "/admin/default-profile", Operation: "setDefaultProfile", Role: config.RoleAdmin, Global: true,
+			Summary: "Set or remove the default processing profile", Request: profiles.Assignment{}, Status: http.StatusNoContent},
+		{Method: http.MethodPut, Path: "/admin/workspaces/{workspace}/profile", Operation: "assignWorkspaceProfile", Role: config.RoleAdmin, Global: true,
+			Summary: "Assign a processing profile to a Cells workspace, or remove its assignment", Request: profiles.Assignment{},
+			Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/admin/schedules", Operation: "listSchedules", Role: config.RoleAdmin, Global: true,
+			Summary: "Scheduled tasks, with their next and last runs", Response: []scheduler.Status{}},
+		{Method: http.MethodPost, Path: "/admin/schedules", Operation: "createSchedule", Role: config.RoleAdmin, Global: true,
+			Summary: "Create a schedule", Request: config.Schedule{}, Response: scheduler.Status{}, Status: http.StatusCreated},
+		{Method: http.MethodDelete, Path: "/admin/schedules/{name}", Operation: "deleteSchedule", Role: config.RoleAdmin, Global: true,
+			Summary: "Delete a schedule created with the API", Status: http.StatusNoContent},
+		{Method: http.MethodPost, Path: "/admin/schedules/{name}/run", Operation: "runSchedule", Role: config.RoleAdmin, Global: true,
+			Summary: "Run a schedule now", Response: scheduler.Run{}, Status: http.StatusAccepted},
+		{Method: http.MethodGet, Path: "/admin/schedules/{name}/runs", Operation: "listScheduleRuns", Role: config.RoleAdmin, Global: true,
+			Summary: "Run history of a schedule, most recent first", Response: []scheduler.Run{},
+			Query: []apiParam{limit(defaultRunsLimit)}},
+	}
+}
+
+// pattern returns the pattern the route is registered with.
+func (route *apiRoute) pattern() string {
+	if route.AnyMethod {
+		return route.Path
+	}
+	return route.Method + " " + route.Path
+}
+
+// register registers the route with its handler, behind authentication and the rate limiter. Submissions are
+// refused while paused reports that the intake is paused, with the wait before they are sent again. The requests of authenticated routes are recorded by the
+// auditor.
+func (route *apiRoute) register(handler http.HandlerFunc, auth *Authenticator, limiter *RateLimiter, auditor *Auditor, paused func() (bool, time.Duration)) {
+	if route.Limited {
+		handler = refuseWhilePaused(paused, limiter.Limit(handler))
+	}
+	switch {
+	case route.Role == "":
+	case route.Global:
+		handler = auth.RequireGlobal(route.Role, handler)
+	default:
+		handler = auth.Require(route.Role, handler)
+	}
+	if route.Role != "" {
+		handler = auditor.Audit(route, handler)
+	}
+	http.HandleFunc(route.pattern(), handler)
+}
+
+// operation returns the OpenAPI operation of the route.
+func (route *apiRoute) operation(doc *openapi.Document) *openapi.Operation {
+	op := &openapi.Operation{OperationID: route.Operation, Summary: route.Summary}
+	switch {
+	case route.Role == "":
+		op.Description = "Public, without authentication."
+	case route.Global:
+		op.Description = "Requires the " + route.Role + " role, and is not available to users bound to a tenant."
+	default:
+		op.Description = "Requires the " + route.Role + " role."
+	}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+		param := &openapi.Parameter{Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}}
+		if match[2] != "" {
+			param.Description = "May hold slashes"
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+	for _, query := range route.Query {
+		typ := query.Type
+		if typ == "" {
+			typ = "string"
+		}
+		op.Parameters = append(op.Parameters, &openapi.Parameter{
+			Name: query.Name, In: "query", Description: query.Description, Schema: &openapi.Schema{Type: typ},
+		})
+	}
+	if route.Request != nil {
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: doc.JSON(route.Request)}
+	}
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := &openapi.Response{Description: http.StatusText(status), Content: doc.JSON(route.Response)}
+	switch {
+	case route.Stream:
+		response.Description = "Server-Sent Events, named after the event kind, whose data is the event"
+		response.Content = map[string]openapi.MediaType{"text/event-stream": response.Content["application/json"]}
+	case route.Download:
+		response.Description = "File, of its content type"
+		response.Content = map[string]openapi.MediaType{"application/octet-stream": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+	}
+	op.Responses = map[string]*openapi.Response{
+		strconv.Itoa(status): response,
+		"default":            {Description: "Error, with a plain text message"},
+	}
+	if route.Problems {
+		op.Responses[strconv.Itoa(http.StatusBadRequest)] = &openapi.Response{
+			Description: "Invalid request, with the errors of its fields",
+			Content: map[string]openapi.MediaType{
+				"application/problem+json": {Schema: doc.Schema(reflect.TypeFor[Problem]())},
+			},
+		}
+	}
+	return op
+}
+
+// newOpenAPIDocument returns the OpenAPI document of the routes.
+func newOpenAPIDocument(routes []apiRoute) *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:       "Curate Preservation Core",
+		Description: "Preservation service of Curate: package preservation, records and administration.",
+		Version:     version.Version(),
+	})
+	for i := range routes {
+		route := &routes[i]
+		path := pathParamPattern.ReplaceAllString(route.Path, "{$1}")
+		doc.Add(route.Method, path, route.operation(doc), route.Role == "")
+	}
+	return doc
+}
+
+// OpenAPIDocument returns the OpenAPI document of every route of the JSON API, including the routes of the optional
+// features. The Go client is generated from it.
+func OpenAPIDocument() *openapi.Document {
+	return newOpenAPIDocument(apiRoutes())
+}
+
+// OpenAPIHandler responds with the OpenAPI document of the registered routes.
+func OpenAPIHandler(doc *openapi.Document) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, doc)
+	}
+	return recoveryMiddleware(handler)
+}
@@ -0,0 +1,520 @@
+// Package scheduler runs recurring tasks of serve mode, such as fixity sweeps and storage audits, at the times of
+// cron expressions. Schedules come from the schedules file or are created with the admin API. Schedules created with
+// the API and the history of the runs are kept in a SQLite database. A schedule is not run again while its previous
+// run is in progress: the overlapping run is recorded as skipped.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"github.com/robfig/cron/v3"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// Statuses of the runs.
+const (
+	StatusRunning     = "running"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"     // The previous run was still in progress
+	StatusInterrupted = "interrupted" // The service shut down during the run
+)
+
+// Triggers of the runs.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Sources of the schedules.
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+// idleWait is how long the scheduler waits when no schedule is enabled, unless a schedule is created.
+const idleWait = time.Hour
+
+const schema = `CREATE TABLE IF NOT EXISTS schedules (
+	name TEXT PRIMARY KEY,
+	definition TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	created_by TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS schedule_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	schedule TEXT NOT NULL,
+	task TEXT NOT NULL,
+	trigger_type TEXT NOT NULL,
+	triggered_by TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL,
+	started_at BIGINT NOT NULL,
+	ended_at BIGINT NOT NULL DEFAULT 0,
+	detail TEXT NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS schedule_runs_schedule ON schedule_runs (schedule, id)`
+
+var (
+	// ErrNotFound is returned when a schedule does not exist.
+	ErrNotFound = errors.New("schedule not found")
+	// ErrExists is returned when a schedule is created with the name of an existing schedule.
+	ErrExists = errors.New("schedule already exists")
+	// ErrReadOnly is returned when a schedule of the schedules file is deleted.
+	ErrReadOnly = errors.New("schedule is defined in the schedules file")
+	// ErrRunning is returned when a schedule is triggered while its previous run is in progress.
+	ErrRunning = errors.New("schedule is already running")
+)
+
+// Task runs a scheduled task. It returns a summary of the run, or an error if the task failed.
+type Task func(ctx context.Context, schedule *config.Schedule) (string, error)
+
+// Run is a run of a schedule.
+type Run struct {
+	ID          int64      `json:"id"`
+	Schedule    string     `json:"schedule"`
+	Task        string     `json:"task"`
+	Trigger     string     `json:"trigger"`
+	TriggeredBy string     `json:"triggered_by,omitempty"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at,omitempty"`
+	Detail      string     `json:"detail,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Status is a schedule with its next and last runs.
+type Status struct {
+	*config.Schedule
+	Source    string     `json:"source"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	Running   bool       `json:"running"`
+	LastRun   *Run       `json:"last_run,omitempty"`
+}
+
+type entry struct {
+	schedule  *config.Schedule
+	source    string
+	createdBy string
+	cron      cron.Schedule
+	next      time.Time
+}
+
+// Scheduler runs the tasks of the schedules at their times.
+type Scheduler struct {
+	db           *sql.DB
+	tasks        map[string]Task
+	historyLimit int
+	ctx          context.Context // Context of the runs, cancelled when the service shuts down
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	running map[string]bool // Schedules with a run in progress
+	wake    chan struct{}   // Signals a change of the schedules to the loop
+	runs    sync.WaitGroup
+}
+
+// Open opens the database of the scheduler, <DataDir>/schedules.db unless a path is configured, and loads the
+// schedules of the schedules file and of the database. Runs left in progress by a previous instance are recorded as
+// interrupted. Tasks are run with the context, and cancelled when it is done.
+func Open(ctx context.Context, cfg *config.Config, tasks map[string]Task) (*Scheduler, error) {
+	schedulesCfg, err := config.LoadSchedulesConfig(cfg.Scheduler.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading schedules config: %w", err)
+	}
+	dbPath := cfg.Scheduler.Path
+	if dbPath == "" {
+		if cfg.DataDir == "" {
+			return nil, fmt.Errorf("no database path or data directory set for the scheduler")
+		}
+		dbPath = filepath.Join(cfg.DataDir, "schedules.db")
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o750); err != nil {
+		return nil, fmt.Errorf("error creating scheduler directory: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("error opening scheduler database: %w", err)
+	}
+	// SQLite has a single writer
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error creating scheduler tables: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE schedule_runs SET status = ?, ended_at = ? WHERE status = ?`,
+		StatusInterrupted, time.Now().UnixNano(), StatusRunning); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error recording interrupted runs: %w", err)
+	}
+
+	s := &Scheduler{
+		db:           db,
+		tasks:        tasks,
+		historyLimit: cfg.Scheduler.HistoryLimit,
+		ctx:          ctx,
+		entries:      make(map[string]*entry),
+		running:      make(map[string]bool),
+		wake:         make(chan struct{}, 1),
+	}
+	if schedulesCfg != nil {
+		for _, schedule := range schedulesCfg.Schedules {
+			if err := s.add(schedule, SourceConfig, ""); err != nil {
+				_ = db.Close()
+				return nil, err
+			}
+		}
+	}
+	if err := s.load(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load adds the schedules created with the API. Schedules named like a schedule of the schedules file are ignored.
+func (s *Scheduler) load(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, definition, created_by FROM schedules ORDER BY name`)
+	if err != nil {
+		return fmt.Errorf("error listing schedules: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var name, definition, createdBy string
+		if err := rows.Scan(&name, &definition, &createdBy); err != nil {
+			return fmt.Errorf("error reading schedule: %w", err)
+		}
+		if _, ok := s.entries[name]; ok {
+			logger.Warn("Ignoring schedule %s created with the API: a schedule of the schedules file has its name", name)
+			continue
+		}
+		var schedule config.Schedule
+		if err := json.Unmarshal([]byte(definition), &schedule); err != nil {
+			return fmt.Errorf("error reading schedule %s: %w", name, err)
+		}
+		if err := s.add(&schedule, SourceAPI, createdBy); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// add adds a schedule, validating it and its task.
+func (s *Scheduler) add(schedule *config.Schedule, source, createdBy string) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	if _, ok := s.tasks[schedule.Task]; !ok {
+		return fmt.Errorf("schedule %s: unknown task %s", schedule.Name, schedule.Task)
+	}
+	sched, err := cron.ParseStandard(schedule.Cron)
+	if err != nil {
+		return fmt.Errorf("schedule %s: invalid cron expression %q: %w", schedule.Name, schedule.Cron, err)
+	}
+	s.entries[schedule.Name] = &entry{
+		schedule:  schedule,
+		source:    source,
+		createdBy: createdBy,
+		cron:      sched,
+		next:      sched.Next(time.Now()),
+	}
+	return nil
+}
+
+// Close waits for the runs in progress, which end when the context of the scheduler is done, and closes the
+// database.
+func (s *Scheduler) Close() error {
+	s.runs.Wait()
+	return s.db.Close()
+}
+
+// Run starts the tasks of the enabled schedules at their times until the context is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	logger.Info("Scheduler started with %d schedules", len(s.entries))
+	s.mu.Unlock()
+	timer := time.NewTimer(idleWait)
+	defer timer.Stop()
+	for {
+		next := s.startDue(time.Now())
+		wait := idleWait
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// startDue starts the runs of the enabled schedules due at now. Returns the time of the next run, or the zero time
+// if no schedule is enabled.
+func (s *Scheduler) startDue(now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, e := range s.entries {
+		if e.schedule.Disabled {
+			continue
+		}
+		if !e.next.After(now) {
+			if _, err := s.start(e, TriggerSchedule, ""); err != nil && !errors.Is(err, ErrRunning) {
+				logger.Error("Error starting schedule %s: %v", e.schedule.Name, err)
+			}
+			e.next = e.cron.Next(now)
+		}
+		if next.IsZero() || e.next.Before(next) {
+			next = e.next
+		}
+	}
+	return next
+}
+
+// start records a run of a schedule and runs its task in the background. If the previous run of the schedule is in
+// progress, ErrRunning is returned and scheduled runs are recorded as skipped. Must be called with the lock held.
+func (s *Scheduler) start(e *entry, trigger, triggeredBy string) (*Run, error) {
+	name := e.schedule.Name
+	run := &Run{Schedule: name, Task: e.schedule.Task, Trigger: trigger, TriggeredBy: triggeredBy, StartedAt: time.Now().UTC()}
+	if s.running[name] && trigger == TriggerManual {
+		return nil, ErrRunning
+	}
+	if s.running[name] {
+		run.Status = StatusSkipped
+		run.EndedAt = &run.StartedAt
+		run.Detail = "previous run still in progress"
+		logger.Warn("Skipping schedule %s: its previous run is still in progress", name)
+		if err := s.insert(run); err != nil {
+			logger.Error("Error recording skipped run of schedule %s: %v", name, err)
+		}
+		return nil, ErrRunning
+	}
+	run.Status = StatusRunning
+	if err := s.insert(run); err != nil {
+		return nil, err
+	}
+	s.running[name] = true
+	s.runs.Add(1)
+	schedule := *e.schedule
+	go s.execute(&schedule, *run)
+	return run, nil
+}
+
+// execute runs the task of a schedule and records the end of the run.
+func (s *Scheduler) execute(schedule *config.Schedule, run Run) {
+	defer s.runs.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, schedule.Name)
+		s.mu.Unlock()
+	}()
+
+	ctx := s.ctx
+	if schedule.TimeoutMinutes > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(schedule.TimeoutMinutes)*time.Minute)
+		defer cancel()
+	}
+	logger.Info("Running schedule %s (%s)", schedule.Name, schedule.Task)
+	detail, err := s.runTask(ctx, schedule)
+	ended := time.Now().UTC()
+	run.EndedAt = &ended
+	run.Detail = detail
+	switch {
+	case err == nil:
+		run.Status = StatusSucceeded
+		logger.Info("Schedule %s completed in %s: %s", schedule.Name, ended.Sub(run.StartedAt).Round(time.Second), detail)
+	case s.ctx.Err() != nil:
+		run.Status = StatusInterrupted
+		run.Error = err.Error()
+		logger.Warn("Schedule %s interrupted by the shutdown: %v", schedule.Name, err)
+	default:
+		run.Status = StatusFailed
+		run.Error = err.Error()
+		logger.Error("Schedule %s failed: %v", schedule.Name, err)
+	}
+	// The run is recorded even when the service shuts down
+	ctx = context.WithoutCancel(s.ctx)
+	if _, err := s.db.ExecContext(ctx, `UPDATE schedule_runs SET status = ?, ended_at = ?, detail = ?, error = ? WHERE id = ?`,
+		run.Status, ended.UnixNano(), run.Detail, run.Error, run.ID); err != nil {
+		logger.Error("Error recording run of schedule %s: %v", schedule.Name, err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM schedule_runs WHERE schedule = ? AND id NOT IN
+		(SELECT id FROM schedule_runs WHERE schedule = ? ORDER BY id DESC LIMIT ?)`,
+		schedule.Name, schedule.Name, s.historyLimit); err != nil {
+		logger.Error("Error pruning the runs of schedule %s: %v", schedule.Name, err)
+	}
+}
+
+// runTask runs the task of a schedule, recovering from panics.
+func (s *Scheduler) runTask(ctx context.Context, schedule *config.Schedule) (detail string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic occurred during the task: %v", r)
+		}
+	}()
+	return s.tasks[schedule.Task](ctx, schedule)
+}
+
+// insert records a new run, setting its ID.
+func (s *Scheduler) insert(run *Run) error {
+	var ended int64
+	if run.EndedAt != nil {
+		ended = run.EndedAt.UnixNano()
+	}
+	result, err := s.db.ExecContext(s.ctx, `INSERT INTO schedule_runs (schedule, task, trigger_type, triggered_by, status,
+		started_at, ended_at, detail) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, run.Schedule, run.Task, run.Trigger,
+		run.TriggeredBy, run.Status, run.StartedAt.UnixNano(), ended, run.Detail)
+	if err != nil {
+		return fmt.Errorf("error recording run: %w", err)
+	}
+	run.ID, err = result.LastInsertId()
+	return err
+}
+
+// Trigger runs a schedule now, whether it is disabled or not, without changing its next run.
+// Returns ErrRunning if its previous run is in progress.
+func (s *Scheduler) Trigger(name, triggeredBy string) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.start(e, TriggerManual, triggeredBy)
+}
+
+// List returns the schedules, by name.
+func (s *Scheduler) List(ctx context.Context) ([]*Status, error) {
+	s.mu.Lock()
+	statuses := make([]*Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		statuses = append(statuses, s.status(e))
+	}
+	s.mu.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	for _, status := range statuses {
+		runs, err := s.Runs(ctx, status.Name, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			status.LastRun = runs[0]
+		}
+	}
+	return statuses, nil
+}
+
+// status returns the state of a schedule, without its last run. Must be called with the lock held.
+func (s *Scheduler) status(e *entry) *Status {
+	status := &Status{Schedule: e.schedule, Source: e.source, CreatedBy: e.createdBy, Running: s.running[e.schedule.Name]}
+	if !e.schedule.Disabled {
+		next := e.next
+		status.NextRun = &next
+	}
+	return status
+}
+
+// Create adds a schedule, kept in the database.
+func (s *Scheduler) Create(ctx context.Context, schedule *config.Schedule, createdBy string) (*Status, error) {
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	definition, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[schedule.Name]; ok {
+		return nil, ErrExists
+	}
+	if err := s.add(schedule, SourceAPI, createdBy); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO schedules (name, definition, created_at, created_by) VALUES (?, ?, ?, ?)`,
+		schedule.Name, string(definition), time.Now().UnixNano(), createdBy); err != nil {
+		delete(s.entries, schedule.Name)
+		return nil, fmt.Errorf("error storing schedule: %w", err)
+	}
+	s.notify()
+	return s.status(s.entries[schedule.Name]), nil
+}
+
+// Delete removes a schedule created with the API, and its run history. A run in progress is not cancelled.
+func (s *Scheduler) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.source != SourceAPI {
+		return ErrReadOnly
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM schedules WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("error deleting schedule: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM schedule_runs WHERE schedule = ? AND status != ?`, name, StatusRunning); err != nil {
+		return fmt.Errorf("error deleting the runs of the schedule: %w", err)
+	}
+	delete(s.entries, name)
+	s.notify()
+	return nil
+}
+
+// Runs returns the last runs of a schedule, most recent first.
+func (s *Scheduler) Runs(ctx context.Context, name string, limit int) ([]*Run, error) {
+	s.mu.Lock()
+	_, ok := s.entries[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, schedule, task, trigger_type, triggered_by, status, started_at, ended_at,
+		detail, error FROM schedule_runs WHERE schedule = ? ORDER BY id DESC LIMIT ?`, name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing runs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	runs := []*Run{}
+	for rows.Next() {
+		var run Run
+		var started, ended int64
+		if err := rows.Scan(&run.ID, &run.Schedule, &run.Task, &run.Trigger, &run.TriggeredBy, &run.Status, &started,
+			&ended, &run.Detail, &run.Error); err != nil {
+			return nil, fmt.Errorf("error reading run: %w", err)
+		}
+		run.StartedAt = time.Unix(0, started).UTC()
+		if ended != 0 {
+			t := time.Unix(0, ended).UTC()
+			run.EndedAt = &t
+		}
+		runs = append(runs, &run)
+	}
+	return runs, rows.Err()
+}
+
+// notify wakes the loop up to take a change of the schedules into account.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
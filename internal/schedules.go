@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/penwern/curate-preservation-core/internal/scheduler"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// defaultRunsLimit is the number of runs listed by ScheduleRunsHandler without a limit parameter.
+const defaultRunsLimit = 20
+
+// OpenScheduler opens the scheduler of the recurring tasks, whose runs are cancelled when the context is done.
+// Returns nil if the scheduler is disabled.
+func (s *Service) OpenScheduler(ctx context.Context) (*scheduler.Scheduler, error) {
+	if !s.cfg.Scheduler.Enabled {
+		return nil, nil
+	}
+	return scheduler.Open(ctx, s.cfg, map[string]scheduler.Task{
+		config.TaskFixitySweep: func(ctx context.Context, schedule *config.Schedule) (string, error) {
+			return s.svc.FixitySweep(ctx, schedule.Locations)
+		},
+		config.TaskStorageAudit: func(ctx context.Context, schedule *config.Schedule) (string, error) {
+			return s.svc.StorageAudit(ctx, schedule.Locations)
+		},
+		config.TaskSignatureUpdate: func(ctx context.Context, _ *config.Schedule) (string, error) {
+			return s.svc.UpdateSignatures(ctx)
+		},
+	})
+}
+
+// SchedulesHandler responds with the schedules, by name, with their next and last runs.
+func SchedulesHandler(sched *scheduler.Scheduler) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if sched == nil {
+			http.Error(w, "scheduler is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		statuses, err := sched.List(r.Context())
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list schedules: %v", err))
+			http.Error(w, "failed to list schedules", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, statuses)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// CreateScheduleHandler creates a schedule, kept until it is deleted. Responds with 201 Created and the schedule.
+func CreateScheduleHandler(sched *scheduler.Scheduler) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if sched == nil {
+			http.Error(w, "scheduler is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		var schedule config.Schedule
+		if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := schedule.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		createdBy := ""
+		if principal := PrincipalFromContext(r.Context()); principal != nil {
+			createdBy = principal.Username
+		}
+		status, err := sched.Create(r.Context(), &schedule, createdBy)
+		if errors.Is(err, scheduler.ErrExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to create schedule %s: %v", schedule.Name, err))
+			http.Error(w, "failed to create schedule", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Created schedule %s (%s at %s) for %s", schedule.Name, schedule.Task, schedule.Cron, createdBy)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, status)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// DeleteScheduleHandler deletes a schedule created with the API and its run history. Schedules of the schedules
+// file can only be removed from the file. Responds with 204 No Content.
+func DeleteScheduleHandler(sched *scheduler.Scheduler) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if sched == nil {
+			http.Error(w, "scheduler is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		err := sched.Delete(r.Context(), name)
+		switch {
+		case errors.Is(err, scheduler.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, scheduler.ErrReadOnly):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			logger.Error(fmt.Sprintf("Failed to delete schedule %s: %v", name, err))
+			http.Error(w, "failed to delete schedule", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Deleted schedule %s", name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// TriggerScheduleHandler runs a schedule now, even if it is disabled. Responds with 202 Accepted and the started
+// run, or 409 Conflict if the previous run of the schedule is in progress.
+func TriggerScheduleHandler(sched *scheduler.Scheduler) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if sched == nil {
+			http.Error(w, "scheduler is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		triggeredBy := ""
+		if principal := PrincipalFromContext(r.Context()); principal != nil {
+			triggeredBy = principal.Username
+		}
+		run, err := sched.Trigger(name, triggeredBy)
+		switch {
+		case errors.Is(err, scheduler.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, scheduler.ErrRunning):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			logger.Error(fmt.Sprintf("Failed to run schedule %s: %v", name, err))
+			http.Error(w, "failed to run schedule", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		writeJSON(w, run)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// ScheduleRunsHandler responds with the last runs of a schedule, most recent first, up to the limit parameter.
+func ScheduleRunsHandler(sched *scheduler.Scheduler) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if sched == nil {
+			http.Error(w, "scheduler is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		limit := defaultRunsLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", value), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		runs, err := sched.Runs(r.Context(), name, limit)
+		if errors.Is(err, scheduler.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list the runs of schedule %s: %v", name, err))
+			http.Error(w, "failed to list runs", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, runs)
+	}
+	return recoveryMiddleware(handler)
+}
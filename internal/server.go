@@ -7,16 +7,30 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"google.golang.org/grpc"
+
+	"github.com/penwern/curate-preservation-core/internal/apikeys"
+	"github.com/penwern/curate-preservation-core/internal/audit"
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/profiles"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/internal/tus"
 	"github.com/penwern/curate-preservation-core/pkg/config"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/reporting"
 )
 
+// serverShutdownTimeout is the time requests in progress have to complete once running preservations are drained.
+const serverShutdownTimeout = 10 * time.Second
+
 // Global map to track active requests
 var (
 	activeRequests sync.Map
@@ -25,6 +39,7 @@ var (
 // ServiceRunner is an interface that defines the methods required by the HTTP handler
 type ServiceRunner interface {
 	RunArgs(context.Context, *ServiceArgs) error
+	PlanArgs(context.Context, *ServiceArgs) ([]*preservation.Plan, error)
 }
 
 // recoveryMiddleware wraps an http.HandlerFunc with panic recovery
@@ -35,6 +50,7 @@ func recoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
 				// Log detailed panic information including request details
 				logger.Error(fmt.Sprintf("Panic recovered in HTTP handler - URL: %s, Method: %s, Remote: %s, Error: %v",
 					r.URL.Path, r.Method, r.RemoteAddr, err))
+				reporting.CapturePanic(err, reporting.Context{Request: r.Method + " " + r.URL.Path})
 
 				// Send error response - http.Error will handle if headers were already sent
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -83,15 +99,18 @@ func Handler(svc ServiceRunner, cfg *config.Config) http.HandlerFunc {
 		// Decode request args
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			logger.Error(fmt.Sprintf("Failed to decode request body: %v", err))
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeProblem(w, r, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			logger.Error(fmt.Sprintf("Received invalid request: %v", err))
+			writeProblem(w, r, err)
 			return
 		}
 
-		// Handle preservation config defaults
-		if req.PreservationCfg == nil {
-			preservationCfg := config.DefaultPreservationConfig()
-			req.PreservationCfg = &preservationCfg
-		} else {
+		// Handle preservation config defaults.
+		// Without an explicit config, the processing profile resolved for each package is used.
+		if req.PreservationCfg != nil {
 			// Merge with defaults
 			preservationCfg := req.PreservationCfg.MergeWithDefaults()
 			req.PreservationCfg = &preservationCfg
@@ -109,20 +128,9 @@ func Handler(svc ServiceRunner, cfg *config.Config) http.HandlerFunc {
 			req.AtomCfg = atomCfg
 		}
 
-		if req.CellsUsername == "" {
-			logger.Error("Received request with no username")
-			http.Error(w, "no username provided", http.StatusBadRequest)
-			return
-		}
-
 		// If theres no paths, we're going to look for nodes from Cells
 		req.PathsResolved = false
 		if len(req.CellsPaths) == 0 {
-			if len(req.CellsNodes) == 0 {
-				logger.Error("Received request with no paths or nodes")
-				http.Error(w, "no paths or nodes provided", http.StatusBadRequest)
-				return
-			}
 			for _, node := range req.CellsNodes {
 				req.CellsPaths = append(req.CellsPaths, node.Path)
 			}
@@ -130,6 +138,18 @@ func Handler(svc ServiceRunner, cfg *config.Config) http.HandlerFunc {
 			req.PathsResolved = true
 		}
 
+		// Dry runs only plan the preservation, they may run alongside the preservation of the same packages
+		if req.DryRun {
+			plans, err := svc.PlanArgs(r.Context(), &req)
+			if err != nil {
+				logger.Error(fmt.Sprintf("Dry run error: %v", err))
+				http.Error(w, err.Error(), preserveErrorStatus(err))
+				return
+			}
+			writeJSON(w, plans)
+			return
+		}
+
 		// Generate a unique request ID
 		requestID := generateRequestID(req)
 
@@ -143,7 +163,11 @@ func Handler(svc ServiceRunner, cfg *config.Config) http.HandlerFunc {
 		logger.Debug(fmt.Sprintf("Processing request with ID: %s", requestID))
 		if err := svc.RunArgs(r.Context(), &req); err != nil {
 			logger.Error(fmt.Sprintf("Preserve error: %v", err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			var merr *MaintenanceError
+			if errors.As(err, &merr) {
+				setRetryAfter(w, merr.RetryAfter)
+			}
+			http.Error(w, err.Error(), preserveErrorStatus(err))
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -151,6 +175,20 @@ func Handler(svc ServiceRunner, cfg *config.Config) http.HandlerFunc {
 	return recoveryMiddleware(handler)
 }
 
+// preserveErrorStatus returns the response status of a failed preservation or dry run.
+func preserveErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrShuttingDown) || errors.Is(err, preservation.ErrInterrupted) || errors.Is(err, ErrMaintenance):
+		// Submit again once the service is back
+		return http.StatusServiceUnavailable
+	case errors.Is(err, preservation.ErrTenantAccess):
+		return http.StatusForbidden
+	case errors.Is(err, preservation.ErrQuotaExceeded):
+		return quotaErrorStatus(err)
+	}
+	return http.StatusInternalServerError
+}
+
 // generateRequestID creates a unique identifier for a request based on its contents
 func generateRequestID(req ServiceArgs) string {
 	// Create a simple hash based on username and path combination
@@ -166,17 +204,279 @@ func generateRequestID(req ServiceArgs) string {
 }
 
 // Serve starts the HTTP server for the preservation service.
-func Serve(svc *Service, addr string) error {
-	http.HandleFunc("/preserve", Handler(svc, svc.cfg))
-	logger.Info(fmt.Sprintf("Server listening on %s", addr))
+// Endpoints require a bearer token, either an API key or a token from the OpenID Connect provider of the auth config,
+// if either is configured. The API is served over HTTPS when a certificate is configured.
+// Users bound to a tenant only see the jobs and packages of their tenant, and cannot use the administration
+// endpoints or the authenticated feeds, which cover every tenant.
+// When the context is cancelled, the service is shut down gracefully: running preservations are drained while
+// the API keeps serving reads, then the server stops.
+// Recurring tasks, such as fixity sweeps, run on the scheduler when it is enabled.
+// The actions taken through the authenticated routes are recorded in the audit log when it is enabled.
+// Transfers can be uploaded with the tus protocol when resumable uploads are enabled.
+// The job API is also served over gRPC when enabled, with the same authentication and TLS config, and the queued
+// jobs are handed to the remote worker agents over gRPC when they are enabled.
+// The routes of the JSON API are described by the OpenAPI document served at /openapi.json.
+func Serve(ctx context.Context, svc *Service, addr string) error {
+	if svc.agents != nil {
+		if !svc.cfg.GRPC.Enabled {
+			return errors.New("remote worker agents require the gRPC API (CA4M_GRPC_ENABLED)")
+		}
+		if svc.cfg.Queue.Backend == queue.BackendMemory {
+			return errors.New("remote worker agents require a persistent job queue, the jobs they interrupt are lost in memory")
+		}
+	}
+	authCfg, err := config.LoadAuthConfig(svc.cfg.Auth.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("error loading auth config: %w", err)
+	}
+	var keys *apikeys.Store
+	if svc.cfg.Auth.APIKeys.Enabled {
+		if keys, err = apikeys.Open(ctx, svc.cfg); err != nil {
+			return err
+		}
+		defer func() { _ = keys.Close() }()
+	}
+	var auditLog *audit.Log
+	if svc.cfg.Audit.Enabled {
+		if auditLog, err = audit.Open(svc.cfg); err != nil {
+			return err
+		}
+		defer func() { _ = auditLog.Close() }()
+	}
+	auditor, err := NewAuditor(auditLog, svc.cfg)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := newTLSConfig(ctx, svc.cfg)
+	if err != nil {
+		return err
+	}
+	clientRole := ""
+	if tlsConfig != nil {
+		clientRole = svc.cfg.TLS.ClientRole
+	}
+	tenants := svc.Tenants()
+	auth, err := NewAuthenticator(ctx, authCfg, keys, clientRole, tenants, svc.cfg.AllowInsecureTLS)
+	if err != nil {
+		return err
+	}
+	if auth == nil {
+		if tenants != nil {
+			return fmt.Errorf("tenants require API authentication: configure an auth config at %s or enable API keys", svc.cfg.Auth.ConfigPath)
+		}
+		logger.Warn("API authentication disabled: no auth config at %s and API keys disabled, requests are trusted", svc.cfg.Auth.ConfigPath)
+	}
+
+	limiter, err := NewRateLimiter(ctx, svc.cfg)
+	if err != nil {
+		return err
+	}
+	cors, err := NewCORS(svc.cfg)
+	if err != nil {
+		return err
+	}
+	profileStore, err := profiles.Open(svc.cfg)
+	if err != nil {
+		return err
+	}
+	sched, err := svc.OpenScheduler(ctx)
+	if err != nil {
+		return err
+	}
+	if sched != nil {
+		// Scheduled runs are cancelled on shutdown, and recorded as interrupted
+		defer func() { _ = sched.Close() }()
+		go sched.Run(ctx)
+	}
 
+	// Progress streams end when the server shuts down, they would hold it up
+	streams, endStreams := context.WithCancel(context.Background())
+	defer endStreams()
+	handlers := map[string]http.HandlerFunc{
+		"getLiveness":           LivenessHandler(),
+		"getReadiness":          ReadinessHandler(svc.NewHealthChecker()),
+		"preserve":              Handler(svc, svc.cfg),
+		"listPackages":          PackagesHandler(svc.Catalog()),
+		"getPackage":            PackageHandler(svc.Catalog()),
+		"getPackageTimeline":    TimelineHandler(svc.Catalog()),
+		"getPackageState":       StateHandler(svc.Catalog()),
+		"countPackageStates":    StatesHandler(svc.Catalog()),
+		"streamProgress":        endOnShutdown(streams, ProgressHandler(svc.Catalog())),
+		"streamPackageProgress": endOnShutdown(streams, PackageProgressHandler(svc.Catalog())),
+		// Descriptions are looked up in the AtoM instance of the service, not in the AtoM targets of the tenants
+		"searchDescriptions":     DescriptionsHandler(svc.cfg),
+		"resolveDescription":     ResolveDescriptionHandler(svc.cfg),
+		"createUpload":           CreateUploadHandler(svc),
+		"completeUpload":         CompleteUploadHandler(svc),
+		"abortUpload":            AbortUploadHandler(svc),
+		"submitBatch":            SubmitBatchHandler(svc),
+		"listBatches":            BatchesHandler(svc.Catalog()),
+		"getBatch":               BatchHandler(svc.Catalog()),
+		"listJobs":               JobsHandler(svc),
+		"getJob":                 endOnShutdown(streams, JobHandler(svc)),
+		"listJobEvents":          JobEventsHandler(svc.Catalog()),
+		"listJobArtifacts":       JobArtifactsHandler(svc.Catalog()),
+		"getJobArtifact":         JobArtifactHandler(svc.Catalog()),
+		"cancelJob":              CancelJobHandler(svc),
+		"retryJob":               RetryJobHandler(svc),
+		"getConcurrency":         ConcurrencyHandler(svc.Limits()),
+		"setConcurrency":         SetConcurrencyHandler(svc.Limits()),
+		"reloadConfig":           ReloadConfigHandler(svc),
+		"getRuntimeState":        RuntimeStateHandler(svc),
+		"getMetrics":             MetricsHandler(svc),
+		"getQuotas":              QuotasHandler(svc),
+		"startMaintenance":       StartMaintenanceHandler(svc),
+		"endMaintenance":         MaintenanceHandler(svc, svc.EndMaintenance),
+		"pauseIntake":            MaintenanceHandler(svc, svc.PauseIntake),
+		"resumeIntake":           MaintenanceHandler(svc, svc.ResumeIntake),
+		"drainWorkers":           MaintenanceHandler(svc, svc.DrainWorkers),
+		"resumeWorkers":          MaintenanceHandler(svc, svc.ResumeWorkers),
+		"listAPIKeys":            APIKeysHandler(keys),
+		"createAPIKey":           CreateAPIKeyHandler(keys, tenants),
+		"revokeAPIKey":           RevokeAPIKeyHandler(keys),
+		"syncPronom":             SyncPronomHandler(svc),
+		"listAuditLog":           AuditLogHandler(auditLog),
+		"exportAuditLog":         ExportAuditLogHandler(auditLog),
+		"listProfiles":           ProfilesHandler(profileStore),
+		"createProfile":          CreateProfileHandler(profileStore),
+		"getProfile":             ProfileHandler(profileStore),
+		"updateProfile":          UpdateProfileHandler(profileStore),
+		"deleteProfile":          DeleteProfileHandler(profileStore, tenants),
+		"listProfileVersions":    ProfileVersionsHandler(profileStore),
+		"setDefaultProfile":      SetDefaultProfileHandler(profileStore),
+		"assignWorkspaceProfile": AssignWorkspaceProfileHandler(profileStore),
+		"listSchedules":          SchedulesHandler(sched),
+		"createSchedule":         CreateScheduleHandler(sched),
+		"deleteSchedule":         DeleteScheduleHandler(sched),
+		"runSchedule":            TriggerScheduleHandler(sched),
+		"listScheduleRuns":       ScheduleRunsHandler(sched),
+	}
+	if svc.cfg.Flows.Enabled {
+		handlers["submitFlowJobs"] = FlowJobsHandler(svc)
+	}
+	var routes []apiRoute
+	for _, route := range apiRoutes() {
+		if handler := handlers[route.Operation]; handler != nil {
+			route.register(handler, auth, limiter, auditor, svc.IntakePaused)
+			routes = append(routes, route)
+		}
+	}
+	if svc.cfg.Tus.Enabled {
+		uploads, err := tus.Open(svc.cfg)
+		if err != nil {
+			return err
+		}
+		go svc.MaintainUploads(ctx, uploads)
+		handlers := tusHandlers(svc, uploads)
+		for _, route := range tusRoutes() {
+			route.register(handlers[route.Operation], auth, limiter, auditor, svc.IntakePaused)
+		}
+	}
+	// The document describes the registered routes, and is public like the probes
+	http.HandleFunc("GET /openapi.json", OpenAPIHandler(newOpenAPIDocument(routes)))
+	if svc.cfg.OAI.Enabled {
+		handler, err := OAIHandler(svc.Catalog(), svc.cfg)
+		if err != nil {
+			return err
+		}
+		if !svc.cfg.OAI.Public {
+			handler = auth.RequireGlobal(config.RoleViewer, handler)
+		}
+		http.HandleFunc("GET /oai", handler)
+		http.HandleFunc("POST /oai", handler)
+	}
+	if svc.cfg.ResourceSync.Enabled {
+		source, err := NewResourceSyncSource(svc)
+		if err != nil {
+			return err
+		}
+		protect := func(handler http.HandlerFunc) http.HandlerFunc {
+			handler = recoveryMiddleware(handler)
+			if svc.cfg.ResourceSync.Public {
+				return handler
+			}
+			return auth.RequireGlobal(config.RoleViewer, handler)
+		}
+		http.HandleFunc("GET /.well-known/resourcesync", protect(source.Description))
+		http.HandleFunc("GET /resourcesync/{location}/capabilitylist.xml", protect(source.CapabilityList))
+		http.HandleFunc("GET /resourcesync/{location}/resourcelist.xml", protect(source.ResourceList))
+		http.HandleFunc("GET /resourcesync/{location}/changelist.xml", protect(source.ChangeList))
+		http.HandleFunc("GET /resourcesync/{location}/aips/{uuid}/{path...}", protect(source.Resource))
+	}
 	// Create server with proper timeouts to address gosec G114
 	server := &http.Server{
 		Addr:         addr,
+		Handler:      cors.Wrap(http.DefaultServeMux), // Preflight requests are answered before the routes and authentication
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		TLSConfig:    tlsConfig,
 	}
+	server.RegisterOnShutdown(endStreams)
 
-	return server.ListenAndServe()
+	serveErr := make(chan error, 2)
+	var grpcServer *grpc.Server
+	if svc.cfg.GRPC.Enabled {
+		listener, err := net.Listen("tcp", svc.cfg.GRPC.Address)
+		if err != nil {
+			return fmt.Errorf("error listening on %s for the gRPC API: %w", svc.cfg.GRPC.Address, err)
+		}
+		grpcServer = NewGRPCServer(svc, auth, limiter, auditor, tlsConfig, streams)
+		go func() {
+			logger.Info(fmt.Sprintf("gRPC API listening on %s", svc.cfg.GRPC.Address))
+			if err := grpcServer.Serve(listener); err != nil {
+				serveErr <- fmt.Errorf("error serving the gRPC API: %w", err)
+			}
+		}()
+	}
+	go func() {
+		if tlsConfig != nil {
+			logger.Info(fmt.Sprintf("Server listening on %s (HTTPS)", addr))
+			// The certificate is served by the TLS config
+			serveErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		logger.Info(fmt.Sprintf("Server listening on %s", addr))
+		serveErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	drainTimeout := svc.cfg.Shutdown.DrainTimeout
+	logger.Info("Shutting down, running preservations have %s to complete", drainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), drainTimeout)
+	defer cancel()
+	shutdownErr := svc.Shutdown(drainCtx)
+
+	serverCtx, cancelServer := context.WithTimeout(context.WithoutCancel(ctx), serverShutdownTimeout)
+	defer cancelServer()
+	if err := server.Shutdown(serverCtx); err != nil {
+		logger.Warn("Requests still in progress after %s: %v", serverShutdownTimeout, err)
+	}
+	if grpcServer != nil {
+		stopGRPC(grpcServer, serverShutdownTimeout)
+	}
+	if shutdownErr != nil {
+		return fmt.Errorf("error shutting down: %w", shutdownErr)
+	}
+	logger.Info("Server stopped")
+	return nil
+}
+
+// endOnShutdown wraps a long-lived handler, such as a progress stream, so that its request context is cancelled
+// when the shutdown context is done.
+func endOnShutdown(shutdown context.Context, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		stop := context.AfterFunc(shutdown, cancel)
+		defer stop()
+		next(w, r.WithContext(ctx))
+	}
 }
@@ -3,45 +3,111 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/penwern/curate-preservation-core/internal/a3mclient"
+	"github.com/penwern/curate-preservation-core/internal/aipstore"
+	"github.com/penwern/curate-preservation-core/internal/catalog"
+	"github.com/penwern/curate-preservation-core/internal/limits"
+	"github.com/penwern/curate-preservation-core/internal/metrics"
 	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/internal/source"
+	"github.com/penwern/curate-preservation-core/internal/storageservice"
 	"github.com/penwern/curate-preservation-core/pkg/config"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/reporting"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
 )
 
 // Service is the root service for the preservation tool.
 type Service struct {
-	cfg *config.Config
-	svc *preservation.Preserver
+	cfg   *config.Config
+	svc   *preservation.Preserver
+	queue queue.Queue // Opened in serve and watch modes
+	// Jobs running on this instance, by job ID
+	running sync.Map
+	monitor *metrics.Monitor // Rolling metrics of this instance and their alerts
+	agents  *agentDispatcher // Set when the queued jobs are run by remote worker agents
+
+	// Graceful shutdown of the running preservations
+	mu        sync.Mutex
+	draining  bool           // New preservations are refused
+	active    sync.WaitGroup // Running preservations
+	consumers sync.WaitGroup // Running ProcessJobs calls, which release interrupted jobs
+	halt      context.Context
+	haltFunc  context.CancelCauseFunc // Interrupts the running preservations
+
+	// Maintenance by the administrators, guarded by mu
+	startedAt        time.Time
+	intakePausedAt   time.Time     // Zero unless submissions are refused
+	workersDrainedAt time.Time     // Zero unless the job workers hold queued jobs
+	drainWorkers     chan struct{} // Closed when the job workers are drained
+	resumeWorkers    chan struct{} // Closed when drained job workers resume
+	maintenance      *Maintenance  // nil outside of a maintenance window
+	// The job workers were drained by the maintenance window, and resume when it ends
+	maintenanceDrained bool
+
+	// Reloads of the configuration
+	reloadMu sync.Mutex
+	settings *config.Config // Settings of the last load, guarded by reloadMu
 }
 
 // ServiceArgs holds the arguments for the root service.
 type ServiceArgs struct {
-	AllowInsecureTLS bool                       `json:"allowInsecureTLS"`
-	CellsArchiveDir  string                     `json:"archiveDir"`
-	CellsNodes       []NodeAlias                `json:"nodes"` // Support for passing nodes directly from flows
-	CellsPaths       []string                   `json:"paths"`
-	CellsUsername    string                     `json:"username"`
-	Cleanup          bool                       `json:"cleanup"`
-	PathsResolved    bool                       `json:"pathsResolved"`
-	PreservationCfg  *config.PreservationConfig `json:"preservationCfg"`
-	AtomCfg          *config.AtomConfig         `json:"atomCfg"`
+	AllowInsecureTLS bool                       `json:"allowInsecureTLS,omitempty"`
+	CellsArchiveDir  string                     `json:"archiveDir,omitempty"`
+	CellsNodes       []NodeAlias                `json:"nodes,omitempty" validate:"dive"` // Support for passing nodes directly from flows
+	CellsPaths       []string                   `json:"paths,omitempty"`
+	CellsUsername    string                     `json:"username" validate:"required"`
+	Cleanup          bool                       `json:"cleanup,omitempty"`
+	PathsResolved    bool                       `json:"pathsResolved,omitempty"`
+	PreservationCfg  *config.PreservationConfig `json:"preservationCfg,omitempty"`
+	Profile          string                     `json:"profile,omitempty"`
+	Deselect         []string                   `json:"deselect,omitempty"` // Paths or patterns removed during appraisal
+	DryRun           bool                       `json:"dryRun,omitempty"`   // Plan the preservation without modifying anything
+	// AtoM settings are only validated when a DIP is deposited, as packages without a slug don't need them
+	AtomCfg *config.AtomConfig `json:"atomCfg,omitempty" validate:"-"`
+}
+
+// Validate checks the request: a username, paths or nodes, and a valid processing configuration if the request has
+// one. Invalid fields are returned as a *ValidationError.
+func (a *ServiceArgs) Validate() error {
+	verr := validateFields(a)
+	if len(a.CellsPaths) == 0 && len(a.CellsNodes) == 0 {
+		verr.add("paths", "required_without", "is required without nodes")
+	}
+	if a.PreservationCfg != nil && a.PreservationCfg.PIIScan != nil {
+		if err := a.PreservationCfg.PIIScan.Validate(); err != nil {
+			verr.add("preservationCfg.pii_scan", "regexp", err.Error())
+		}
+	}
+	return verr.err()
 }
 
 // NodeAlias represents a cells node.
 // Using this node alias until I find a proper way to serialize Node input into Cells SDK models.TreeNode
 // Currently the SDK models.TreeNode is not directly serializable.
 type NodeAlias struct {
-	Path string `json:"path"`
+	Path string `json:"path" validate:"required"`
 	UUID string `json:"uuid"`
 }
 
 // NewService creates a new preservation service.
 func NewService(ctx context.Context, cfg *config.Config) (*Service, error) {
+	// Report panics and failed preservations, when a DSN is configured
+	reportingOptions := reporting.Options{
+		DSN:         cfg.Sentry.DSN,
+		Environment: cfg.Sentry.Environment,
+		SampleRate:  cfg.Sentry.SampleRate,
+	}
+	if err := reporting.Init(reportingOptions); err != nil {
+		return nil, err
+	}
+
 	// Create a3m client with concurrency control
 	a3mOptions := a3mclient.ClientOptions{
 		MaxActiveProcessing: 1, // Currently only support 1 package at a time ;(
@@ -53,27 +119,149 @@ func NewService(ctx context.Context, cfg *config.Config) (*Service, error) {
 	}
 
 	s := &Service{
-		svc: preservation.NewPreserverWithA3MClient(ctx, cfg, a3mClient),
-		cfg: cfg,
+		svc:          preservation.NewPreserverWithA3MClient(ctx, cfg, a3mClient),
+		cfg:          cfg,
+		settings:     cfg,
+		startedAt:    time.Now().UTC(),
+		drainWorkers: make(chan struct{}),
 	}
+	if s.monitor, err = metrics.NewMonitor(cfg, s.queueDepth, s.notifyAlert); err != nil {
+		return nil, err
+	}
+	if cfg.Agents.Enabled {
+		s.agents = newAgentDispatcher(cfg.Agents.LeaseTimeout)
+	}
+	s.halt, s.haltFunc = context.WithCancelCause(context.Background())
 	return s, nil
 }
 
 // Close closes the preservation service.
 func (s *Service) Close() {
+	if s.queue != nil {
+		if err := s.queue.Close(); err != nil {
+			logger.Warn("Error closing job queue: %v", err)
+		}
+	}
 	s.svc.Close()
+	reporting.Flush()
+}
+
+// Catalog returns the store of package records. Returns nil if package records are disabled.
+func (s *Service) Catalog() *catalog.Store {
+	return s.svc.Catalog()
+}
+
+// Tenants returns the tenants of the service. Returns nil if tenants are not configured.
+func (s *Service) Tenants() *config.TenantsConfig {
+	return s.svc.Tenants()
+}
+
+// Limits returns the concurrency limits of the preservations and their stages.
+func (s *Service) Limits() *limits.Limits {
+	return s.svc.Limits()
 }
 
 // RunArgs runs the preservation service with the given arguments.
+// Returns ErrShuttingDown if the service shuts down, and a *MaintenanceError during a maintenance window.
 func (s *Service) RunArgs(ctx context.Context, args *ServiceArgs) error {
-	return s.Run(ctx, args.CellsUsername, args.CellsPaths, args.Cleanup, args.PathsResolved, args.PreservationCfg, args.AtomCfg)
+	// Preservations run immediately, they cannot be held until the maintenance ends
+	if err := s.checkMaintenance(); err != nil {
+		return err
+	}
+	ctx, done, err := s.track(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return s.Run(ctx, args.CellsUsername, args.CellsPaths, args.Profile, args.Deselect, args.Cleanup, args.PathsResolved, args.PreservationCfg, args.AtomCfg)
+}
+
+// PlanArgs plans the preservation of the packages of the given arguments, without modifying anything.
+// Returns ErrShuttingDown if the service shuts down.
+func (s *Service) PlanArgs(ctx context.Context, args *ServiceArgs) ([]*preservation.Plan, error) {
+	ctx, done, err := s.track(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return s.Plan(ctx, args.CellsUsername, args.CellsPaths, args.Profile, args.Deselect, args.PathsResolved, args.PreservationCfg, args.AtomCfg)
+}
+
+// Plan is a dry run of Run: it returns the actions the preservation of each package would take, in the order of the
+// paths. Packages are planned one at a time, as each is downloaded to identify its contents.
+func (s *Service) Plan(ctx context.Context, username string, paths []string, profile string, deselect []string, pathsResolved bool, presConfig *config.PreservationConfig, atomConfig *config.AtomConfig) ([]*preservation.Plan, error) {
+	userClient, err := s.svc.NewUserClient(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user client: %w", err)
+	}
+	plans := make([]*preservation.Plan, 0, len(paths))
+	for _, path := range paths {
+		plan, err := s.svc.Plan(ctx, presConfig, atomConfig, userClient, path, profile, deselect, pathsResolved)
+		if err != nil {
+			return nil, fmt.Errorf("error planning preservation of package '%s': %w", path, err)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// PackageResult is the outcome of the preservation of a package of a run.
+type PackageResult struct {
+	Path       string `json:"path"`
+	Status     string `json:"status"` // completed or failed
+	PackageID  string `json:"package_id,omitempty"`
+	AIPUUID    string `json:"aip_uuid,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	err        error
 }
 
 // Run runs the preservation service.
-func (s *Service) Run(ctx context.Context, username string, paths []string, cleanup, pathsResolved bool, presConfig *config.PreservationConfig, atomConfig *config.AtomConfig) error {
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(paths))
+// If presConfig is nil, the processing configuration is taken from the profile resolved for each package.
+func (s *Service) Run(ctx context.Context, username string, paths []string, profile string, deselect []string, cleanup, pathsResolved bool, presConfig *config.PreservationConfig, atomConfig *config.AtomConfig) error {
+	results, err := s.preserve(ctx, username, paths, profile, deselect, cleanup, pathsResolved, presConfig, atomConfig, 0)
+	if err != nil {
+		return err
+	}
+	return runError(results)
+}
+
+// PreserveArgs preserves the packages of the given arguments like RunArgs, up to parallel packages at a time within
+// the global concurrency limit, or every package at once if parallel is 0. Returns the outcome of each package, in the
+// order of the paths, and the error of the run if a package failed.
+// Returns ErrShuttingDown if the service shuts down, and a *MaintenanceError during a maintenance window.
+func (s *Service) PreserveArgs(ctx context.Context, args *ServiceArgs, parallel int) ([]*PackageResult, error) {
+	if err := s.checkMaintenance(); err != nil {
+		return nil, err
+	}
+	ctx, done, err := s.track(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	results, err := s.preserve(ctx, args.CellsUsername, args.CellsPaths, args.Profile, args.Deselect, args.Cleanup, args.PathsResolved, args.PreservationCfg, args.AtomCfg, parallel)
+	if err != nil {
+		return nil, err
+	}
+	return results, runError(results)
+}
+
+// ExpandPaths expands the Cells paths of a user that are glob patterns, such as personal-files/box-*, to the paths of
+// the packages they match.
+func (s *Service) ExpandPaths(ctx context.Context, username string, paths []string) ([]string, error) {
+	if !preservation.HasPattern(paths) {
+		return paths, nil
+	}
+	userClient, err := s.svc.NewUserClient(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user client: %w", err)
+	}
+	return s.svc.ExpandPaths(ctx, userClient, paths)
+}
 
+// preserve preserves packages, up to parallel at a time or every package at once if parallel is 0, and returns their
+// outcomes in the order of the paths.
+func (s *Service) preserve(ctx context.Context, username string, paths []string, profile string, deselect []string, cleanup, pathsResolved bool, presConfig *config.PreservationConfig, atomConfig *config.AtomConfig, parallel int) ([]*PackageResult, error) {
 	if s.cfg.LogLevel == "debug" {
 		// Pretty print the configuration
 		jsonCfg, err := json.MarshalIndent(s.cfg, "", "  ")
@@ -95,54 +283,385 @@ func (s *Service) Run(ctx context.Context, username string, paths []string, clea
 		logger.Debug("Atom Configuration:\n%s", string(jsonAtomCfg))
 	}
 
-	// Number of concurrent operations
-	maxWorkers := 10
-	semaphore := make(chan struct{}, maxWorkers)
-
-	const maxRetries = 1
+	// Packages failing with a transient error are preserved again
+	retry := s.cfg.Retry.Jobs
+	attempts := max(retry.MaxAttempts, 1)
 
 	// Create a user client per submission
 	userClient, err := s.svc.NewUserClient(ctx, username)
 	if err != nil {
-		return fmt.Errorf("failed to get user client: %w", err)
+		return nil, fmt.Errorf("failed to get user client: %w", err)
 	}
 
-	for _, packagePath := range paths {
-		wg.Add(1)
-		go func(path string) {
-			defer wg.Done()
+	run := func(path string) (runErr error) {
+		// Add panic recovery to prevent crashes
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic recovered in preservation goroutine for path '%s': %v", path, r)
+				reporting.CapturePanic(r, reporting.Context{CellsPath: path, Profile: profile, Username: username})
+				runErr = fmt.Errorf("panic occurred during preservation: %v", r)
+			}
+		}()
 
-			// Add panic recovery to prevent crashes
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("Panic recovered in preservation goroutine for path '%s': %v", path, r)
-					errChan <- fmt.Errorf("panic occurred during preservation: %v", r)
-				}
-			}()
-
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			for i := range maxRetries {
-				if err := s.svc.Run(ctx, presConfig, atomConfig, userClient, path, cleanup, pathsResolved); err != nil {
-					logger.Error("Error running preservation for package '%s' (attempt %d/%d): %v", path, i+1, maxRetries, err)
-					if i+1 == maxRetries {
-						errChan <- err
-					}
-				} else {
-					// Success, exit retry loop
-					break
-				}
+		for i := range attempts {
+			// The outputs of attempts failing with a transient error are not kept, the package is preserved again
+			attemptCtx := ctx
+			if i+1 < attempts {
+				attemptCtx = preservation.WithRetry(ctx)
+			}
+			// Packages beyond the global concurrency limit wait for a running preservation to end
+			err := s.Limits().Do(ctx, limits.Global, func() error {
+				return s.svc.Run(attemptCtx, presConfig, atomConfig, userClient, path, profile, deselect, cleanup, pathsResolved)
+			})
+			if err == nil {
+				return nil
 			}
-		}(packagePath)
+			logger.Error("Error running preservation for package '%s' (attempt %d/%d): %v", path, i+1, attempts, err)
+			if i+1 == attempts || !utils.IsTransientError(err) || ctx.Err() != nil {
+				return err
+			}
+			delay := retry.Delay(i + 1)
+			logger.Info("Retrying preservation of package '%s' in %s", path, delay)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+		}
+		return nil
 	}
 
+	if parallel <= 0 {
+		parallel = len(paths)
+	}
+	slots := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	results := make([]*PackageResult, len(paths))
+	for i, packagePath := range paths {
+		result := &PackageResult{Path: packagePath}
+		results[i] = result
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			started := time.Now()
+			result.err = run(result.Path)
+			s.finishResult(result, username, started)
+		}()
+	}
 	wg.Wait()
-	close(errChan)
+	return results, nil
+}
 
-	if err := <-errChan; err != nil {
-		return fmt.Errorf("preservation process completed with errors")
+// finishResult sets the outcome of the preservation of a package, with its package record if one was created.
+func (s *Service) finishResult(result *PackageResult, username string, started time.Time) {
+	result.DurationMs = time.Since(started).Milliseconds()
+	result.Status = JobStatusCompleted
+	if result.err != nil {
+		result.Status = JobStatusFailed
+		result.Error = result.err.Error()
+	}
+	store := s.Catalog()
+	if store == nil {
+		return
 	}
+	records, err := store.List()
+	if err != nil {
+		logger.Error("Error listing package records: %v", err)
+		return
+	}
+	// Records are listed most recent first
+	for _, rec := range records {
+		if rec.CellsPath == result.Path && rec.Username == username && !rec.CreatedAt.Before(started) {
+			result.PackageID = rec.ID
+			result.AIPUUID = rec.AIPUUID
+			if result.err != nil && rec.Error != "" {
+				// The record has the error of the failed stage
+				result.Error = rec.Error
+			}
+			return
+		}
+	}
+}
 
+// runError returns the error of a run: the error of the first package that failed, or nil if every package was
+// preserved.
+func runError(results []*PackageResult) error {
+	for _, result := range results {
+		err := result.err
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, preservation.ErrCancelled) || errors.Is(err, preservation.ErrInterrupted) || errors.Is(err, preservation.ErrTenantAccess) || errors.Is(err, preservation.ErrQuotaExceeded) {
+			return err
+		}
+		// The class of the failure is kept for the exit status of the commands
+		return utils.Classify(utils.FailureClass(err), errors.New("preservation process completed with errors"))
+	}
 	return nil
 }
+
+// ListStorageServiceAIPs lists the AIPs stored in the Archivematica Storage Service.
+// If pipelineUUID is set, only AIPs from that pipeline are listed.
+func (s *Service) ListStorageServiceAIPs(ctx context.Context, pipelineUUID string) ([]storageservice.Package, error) {
+	client, err := s.svc.StorageServiceClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return client.ListAIPs(ctx, pipelineUUID)
+}
+
+// MirrorAIPs fetches AIPs from the Archivematica Storage Service, verifies them, and uploads them to the archive workspace.
+// Returns the Cells paths of the mirrored AIPs.
+func (s *Service) MirrorAIPs(ctx context.Context, username string, aipUUIDs []string) ([]string, error) {
+	userClient, err := s.svc.NewUserClient(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user client: %w", err)
+	}
+	paths := make([]string, 0, len(aipUUIDs))
+	for _, aipUUID := range aipUUIDs {
+		path, err := s.svc.MirrorAIP(ctx, userClient, aipUUID)
+		if err != nil {
+			return paths, fmt.Errorf("error mirroring AIP %s: %w", aipUUID, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// PlanMirrorAIPs is a dry run of MirrorAIPs: it checks that the AIPs are stored in the Storage Service and returns the
+// actions mirroring them would take.
+func (s *Service) PlanMirrorAIPs(ctx context.Context, aipUUIDs []string) ([]preservation.PlannedAction, error) {
+	var actions []preservation.PlannedAction
+	for _, aipUUID := range aipUUIDs {
+		planned, err := s.svc.PlanMirrorAIP(ctx, aipUUID)
+		if err != nil {
+			return actions, fmt.Errorf("error planning the mirror of AIP %s: %w", aipUUID, err)
+		}
+		actions = append(actions, planned...)
+	}
+	return actions, nil
+}
+
+// ListStoredAIPs lists the UUIDs of the AIPs in a storage location. An empty location selects the first location.
+func (s *Service) ListStoredAIPs(ctx context.Context, location string) ([]string, error) {
+	store, err := s.svc.AIPStore(location)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.ListAIPs(ctx)
+}
+
+// FetchAIP downloads an AIP from a storage location to a local directory for reingest, verifying its files.
+// Returns the local path of the AIP.
+func (s *Service) FetchAIP(ctx context.Context, location, aipUUID, destDir string) (string, error) {
+	store, err := s.svc.AIPStore(location)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+	return store.FetchAIP(ctx, aipUUID, destDir)
+}
+
+// PlanFetchAIP is a dry run of FetchAIP: it reads the manifest of an AIP in a storage location and returns the actions
+// fetching it would take, without downloading its files.
+func (s *Service) PlanFetchAIP(ctx context.Context, location, aipUUID, destDir string) ([]preservation.PlannedAction, error) {
+	store, err := s.svc.AIPStore(location)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	files, err := store.Files(ctx, aipUUID)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	return []preservation.PlannedAction{
+		{Stage: catalog.EventDownload, Action: fmt.Sprintf("Download AIP %s from %s to %s: %d files, %d bytes", aipUUID, store.Name(), destDir, len(files), size)},
+		{Stage: catalog.EventFixity, Action: "Verify the files against the manifest of the AIP"},
+	}, nil
+}
+
+// RestoreAIP requests the restore of an AIP archived in a storage location and returns its restore progress.
+// With wait, it returns once the AIP is restored, calling progress after every status check.
+func (s *Service) RestoreAIP(ctx context.Context, location, aipUUID string, wait bool, progress func(*aipstore.RestoreStatus)) (*aipstore.RestoreStatus, error) {
+	store, err := s.svc.AIPStore(location)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if !wait {
+		return store.RestoreAIP(ctx, aipUUID)
+	}
+	var status *aipstore.RestoreStatus
+	err = store.WaitForRestore(ctx, aipUUID, func(st *aipstore.RestoreStatus) {
+		status = st
+		if progress != nil {
+			progress(st)
+		}
+	})
+	return status, err
+}
+
+// PlanRestoreAIP is a dry run of RestoreAIP: it reads the manifest of an AIP in a storage location and returns the
+// actions restoring it would take, without requesting the restore.
+func (s *Service) PlanRestoreAIP(ctx context.Context, location, aipUUID string, wait bool) ([]preservation.PlannedAction, error) {
+	store, err := s.svc.AIPStore(location)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	entries, err := store.Manifest(ctx, aipUUID)
+	if err != nil {
+		return nil, err
+	}
+	actions := []preservation.PlannedAction{{
+		Stage:  catalog.EventStorage,
+		Action: fmt.Sprintf("Request the restore of the archived files of AIP %s in %s: %d files in its manifest", aipUUID, store.Name(), len(entries)),
+	}}
+	if wait {
+		actions = append(actions, preservation.PlannedAction{Stage: catalog.EventStorage, Action: "Wait until the AIP is restored"})
+	}
+	return actions, nil
+}
+
+// VerifyAIP checks the fixity of an AIP in a storage location. Failures are notified.
+func (s *Service) VerifyAIP(ctx context.Context, location, aipUUID string) (*aipstore.FixityReport, error) {
+	return s.svc.VerifyAIP(ctx, location, aipUUID)
+}
+
+// MigrateLayout moves the AIPs of a storage location to another layout, or every AIP of the location if none is
+// given, updating the replicas of the package records. Returns the migration of each AIP, and the errors of the AIPs
+// that could not be migrated.
+func (s *Service) MigrateLayout(ctx context.Context, location, layout string, aipUUIDs []string, progress func(aipUUID string, n, total int)) ([]*preservation.MigrationResult, error) {
+	return s.svc.MigrateLayout(ctx, location, layout, aipUUIDs, progress)
+}
+
+// PlanMigrateLayout is a dry run of MigrateLayout: it returns the actions moving the AIPs would take.
+func (s *Service) PlanMigrateLayout(ctx context.Context, location, layout string, aipUUIDs []string) ([]preservation.PlannedAction, error) {
+	return s.svc.PlanMigrateLayout(ctx, location, layout, aipUUIDs)
+}
+
+// CheckPackageFixity checks the fixity of the stored AIP of a package in each of its storage locations, recording the
+// checks in the package record. Failures are notified.
+func (s *Service) CheckPackageFixity(ctx context.Context, id string) ([]*preservation.FixityResult, error) {
+	return s.svc.CheckPackageFixity(ctx, id)
+}
+
+// CheckAllFixity checks the fixity of the stored AIPs of every recorded package, like CheckPackageFixity.
+func (s *Service) CheckAllFixity(ctx context.Context) ([]*preservation.FixityResult, error) {
+	return s.svc.CheckAllFixity(ctx)
+}
+
+// PlanPackageFixity is a dry run of CheckPackageFixity: it returns the checks it would make and record.
+func (s *Service) PlanPackageFixity(id string) ([]preservation.PlannedAction, error) {
+	return s.svc.PlanPackageFixity(id)
+}
+
+// PlanAllFixity is a dry run of CheckAllFixity: it returns the checks it would make and record.
+func (s *Service) PlanAllFixity() ([]preservation.PlannedAction, error) {
+	return s.svc.PlanAllFixity()
+}
+
+// ListSource lists a directory of a transfer source, relative to its root directory.
+func (s *Service) ListSource(ctx context.Context, sourceName, dir string) ([]source.Entry, error) {
+	client, err := s.svc.TransferSource(sourceName)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return client.List(ctx, dir)
+}
+
+// PullTransfers pulls transfers from a transfer source into its destination folder in Cells.
+// Returns the Cells paths of the pulled transfers.
+func (s *Service) PullTransfers(ctx context.Context, username, sourceName string, transferPaths []string) ([]string, error) {
+	userClient, err := s.svc.NewUserClient(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user client: %w", err)
+	}
+	paths := make([]string, 0, len(transferPaths))
+	for _, transferPath := range transferPaths {
+		path, err := s.svc.PullTransfer(ctx, userClient, sourceName, transferPath)
+		if err != nil {
+			return paths, fmt.Errorf("error pulling %s: %w", transferPath, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// PreserveFromSource pulls transfers from a transfer source and preserves them as normal.
+func (s *Service) PreserveFromSource(ctx context.Context, username, sourceName string, transferPaths []string, profile string) error {
+	paths, err := s.PullTransfers(ctx, username, sourceName, transferPaths)
+	if err != nil {
+		return err
+	}
+	atomCfg, err := config.GetAtomConfig(s.cfg, nil)
+	if err != nil {
+		return fmt.Errorf("error loading AtoM configuration: %w", err)
+	}
+	return s.Run(ctx, username, paths, profile, nil, s.cfg.Cleanup, false, nil, atomCfg)
+}
+
+// PlanPullTransfers is a dry run of PullTransfers, or of PreserveFromSource with preserve: it checks that the transfers
+// exist in the transfer source and returns the actions pulling, and preserving, them would take. The preservation of
+// the transfers cannot be planned further before they are pulled.
+func (s *Service) PlanPullTransfers(ctx context.Context, sourceName string, transferPaths []string, preserve bool, profile string) ([]preservation.PlannedAction, error) {
+	var actions []preservation.PlannedAction
+	for _, transferPath := range transferPaths {
+		planned, err := s.svc.PlanPullTransfer(ctx, sourceName, transferPath)
+		if err != nil {
+			return actions, fmt.Errorf("error planning the pull of %s: %w", transferPath, err)
+		}
+		actions = append(actions, planned...)
+		if preserve {
+			action := "Preserve " + transferPath + " with the profile of its destination folder"
+			if profile != "" {
+				action = "Preserve " + transferPath + " with profile " + profile
+			}
+			actions = append(actions, preservation.PlannedAction{Stage: catalog.EventPreservation, Action: action})
+		}
+	}
+	return actions, nil
+}
+
+// CreateUpload starts a presigned upload of a transfer to the intake source.
+func (s *Service) CreateUpload(ctx context.Context, name string, size int64) (*source.Upload, error) {
+	return s.svc.CreateUpload(ctx, name, size)
+}
+
+// CompleteUpload assembles an uploaded transfer and queues its preservation, as the given user and for the tenant of
+// the context if it has one. Progress is reported in the package records.
+func (s *Service) CompleteUpload(ctx context.Context, req *CompleteUploadRequest) error {
+	callback, err := s.Callback(req.CallbackURL, req.Reference)
+	if err != nil {
+		return err
+	}
+	if err := s.svc.CompleteUpload(ctx, req.Path, req.UploadID, req.Parts); err != nil {
+		return err
+	}
+	intake := s.svc.Intake()
+	tenant := preservation.TenantFromContext(ctx)
+	return s.Enqueue(ctx, &queue.Job{
+		ID:       tenantJobID(tenant, "intake:"+req.Path),
+		Username: req.Username,
+		Tenant:   tenant,
+		Path:     req.Path,
+		Source:   intake.Source,
+		Profile:  req.Profile,
+		Callback: callback,
+		Priority: req.Priority,
+	})
+}
+
+// AbortUpload cancels an upload to the intake source.
+func (s *Service) AbortUpload(ctx context.Context, req *AbortUploadRequest) error {
+	return s.svc.AbortUpload(ctx, req.Path, req.UploadID)
+}
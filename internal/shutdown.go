@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// interruptTimeout is the time interrupted preservations have to record their state and remove their partial
+// outputs, once the drain window is over.
+const interruptTimeout = 30 * time.Second
+
+// ErrShuttingDown is returned when a preservation is submitted while the service shuts down.
+var ErrShuttingDown = errors.New("service is shutting down")
+
+// track registers a preservation starting on this instance and returns its context, cancelled with
+// preservation.ErrInterrupted if it still runs at the end of the drain window, and the function to call when it
+// ends. Returns ErrShuttingDown once the service shuts down.
+func (s *Service) track(ctx context.Context) (context.Context, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return nil, nil, ErrShuttingDown
+	}
+	s.active.Add(1)
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(s.halt, func() { cancel(context.Cause(s.halt)) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+		s.active.Done()
+	}, nil
+}
+
+// ShuttingDown reports whether the service shuts down and refuses new preservations.
+func (s *Service) ShuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// Shutdown stops the service gracefully: new preservations are refused and the running ones are given until the
+// context is done to complete. Preservations still running are then interrupted: they record their package as
+// interrupted and remove their partial outputs, and their jobs are queued again. Job consumption must be stopped
+// by cancelling the context of ProcessJobs, Shutdown waits for it to return.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	if s.agents != nil {
+		s.agents.stop()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		// The queue releases interrupted jobs once their handler returns
+		s.consumers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logger.Info("All preservations completed")
+		return nil
+	case <-ctx.Done():
+	}
+
+	logger.Warn("Drain window over, interrupting the running preservations")
+	s.haltFunc(preservation.ErrInterrupted)
+	select {
+	case <-done:
+		logger.Info("Running preservations interrupted")
+		return nil
+	case <-time.After(interruptTimeout):
+		return fmt.Errorf("preservations still running %s after their interruption", interruptTimeout)
+	}
+}
@@ -0,0 +1,375 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	driveFolderType = "application/vnd.google-apps.folder"
+	driveNativeType = "application/vnd.google-apps."
+
+	// driveMetadataSuffix is appended to the name of a Google Docs file for its Drive metadata.
+	driveMetadataSuffix = ".drive.json"
+)
+
+// driveExport is a preservable format a Google Docs file type is exported to.
+type driveExport struct {
+	format    string // Export format in the configuration
+	mimeTypes []string
+	extension string
+}
+
+// driveExports are the export formats of the Google Docs file types. Drive lists some OpenDocument formats under
+// more than one MIME type.
+var driveExports = map[string][]driveExport{
+	"application/vnd.google-apps.document": {
+		{"pdf", []string{"application/pdf"}, ".pdf"},
+		{"odf", []string{"application/vnd.oasis.opendocument.text"}, ".odt"},
+	},
+	"application/vnd.google-apps.spreadsheet": {
+		{"pdf", []string{"application/pdf"}, ".pdf"},
+		{"odf", []string{"application/vnd.oasis.opendocument.spreadsheet", "application/x-vnd.oasis.opendocument.spreadsheet"}, ".ods"},
+	},
+	"application/vnd.google-apps.presentation": {
+		{"pdf", []string{"application/pdf"}, ".pdf"},
+		{"odf", []string{"application/vnd.oasis.opendocument.presentation"}, ".odp"},
+	},
+	"application/vnd.google-apps.drawing": {
+		{"pdf", []string{"application/pdf"}, ".pdf"},
+		{"odf", []string{"image/svg+xml"}, ".svg"},
+	},
+}
+
+// driveConn reads transfers from Google Drive. Drive addresses files by ID, and names are not unique within a
+// folder, so paths are resolved by listing the folders and files with the same name are told apart by their ID.
+// Google Docs files are listed as their exports and their Drive metadata as JSON.
+type driveConn struct {
+	service *drive.Service
+	client  *http.Client // Authorized client of the export links
+	drive   string       // Shared drive ID, empty for My Drive
+	root    string       // Folder ID of the root path
+	formats map[string]bool
+
+	mu    sync.Mutex
+	items map[string]*driveItemEntry // Listed items by path
+}
+
+// driveItemEntry is a listed file or folder, or an export or the metadata of a Google Docs file.
+type driveItemEntry struct {
+	file     *drive.File
+	export   *driveExport
+	metadata []byte
+}
+
+func dialGoogleDrive(source *config.TransferSource, insecure bool) (*driveConn, error) {
+	cfg := source.GoogleDrive
+	ctx := context.Background()
+	if insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+	}
+	var (
+		client *http.Client
+		err    error
+	)
+	if cfg.CredentialsFile != "" {
+		key, err := os.ReadFile(filepath.Clean(cfg.CredentialsFile))
+		if err != nil {
+			return nil, fmt.Errorf("error reading credentials file: %w", err)
+		}
+		jwt, err := google.JWTConfigFromJSON(key, drive.DriveReadonlyScope)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing credentials file: %w", err)
+		}
+		jwt.Subject = cfg.Subject
+		client = jwt.Client(ctx)
+	} else {
+		if cfg.Subject != "" {
+			return nil, fmt.Errorf("subject requires a service account credentials file")
+		}
+		if client, err = google.DefaultClient(ctx, drive.DriveReadonlyScope); err != nil {
+			return nil, fmt.Errorf("error finding default credentials: %w", err)
+		}
+	}
+	opts := []option.ClientOption{option.WithHTTPClient(client)}
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+	service, err := drive.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &driveConn{
+		service: service,
+		client:  client,
+		root:    "root",
+		formats: map[string]bool{"pdf": true, "odf": true},
+		items:   map[string]*driveItemEntry{},
+	}
+	if len(cfg.ExportFormats) > 0 {
+		c.formats = map[string]bool{}
+		for _, format := range cfg.ExportFormats {
+			c.formats[format] = true
+		}
+	}
+	switch {
+	case cfg.FolderID != "":
+		c.root = cfg.FolderID
+	case cfg.SharedDrive != "":
+		if c.drive, err = c.findSharedDrive(ctx, cfg.SharedDrive); err != nil {
+			return nil, err
+		}
+		c.root = c.drive
+	}
+	root, err := service.Files.Get(c.root).SupportsAllDrives(true).Fields("id, name, mimeType").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("error reading root folder: %w", err)
+	}
+	c.items["/"] = &driveItemEntry{file: root}
+	return c, nil
+}
+
+// findSharedDrive returns the ID of a shared drive, by ID or name.
+func (c *driveConn) findSharedDrive(ctx context.Context, idOrName string) (string, error) {
+	var id string
+	err := c.service.Drives.List().PageSize(100).Pages(ctx, func(list *drive.DriveList) error {
+		for _, d := range list.Drives {
+			if id == "" && (d.Id == idOrName || d.Name == idOrName) {
+				id = d.Id
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error listing shared drives: %w", err)
+	}
+	if id == "" {
+		return "", fmt.Errorf("shared drive not found: %s", idOrName)
+	}
+	return id, nil
+}
+
+func (c *driveConn) ReadDir(dir string) ([]Entry, error) {
+	dir = path.Clean("/" + dir)
+	folder, err := c.lookup(dir)
+	if err != nil {
+		return nil, err
+	}
+	if folder.file.MimeType != driveFolderType {
+		return nil, fmt.Errorf("not a folder: %s", dir)
+	}
+
+	call := c.service.Files.List().
+		Q(fmt.Sprintf("'%s' in parents and trashed = false", folder.file.Id)).
+		Fields("nextPageToken, files(*)").
+		PageSize(1000).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true)
+	if c.drive != "" {
+		call = call.Corpora("drive").DriveId(c.drive)
+	}
+	var files []*drive.File
+	err = call.Pages(context.Background(), func(list *drive.FileList) error {
+		files = append(files, list.Files...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]int{}
+	for _, file := range files {
+		names[file.Name]++
+	}
+	items := map[string]*driveItemEntry{}
+	for _, file := range files {
+		name := file.Name
+		if names[name] > 1 {
+			// Files with the same name are told apart by their ID
+			ext := path.Ext(name)
+			name = fmt.Sprintf("%s (%s)%s", strings.TrimSuffix(name, ext), file.Id, ext)
+		}
+		name = strings.ReplaceAll(name, "/", "_")
+		c.addItems(items, path.Join(dir, name), file)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]Entry, 0, len(items))
+	for itemPath, item := range items {
+		c.items[itemPath] = item
+		entries = append(entries, driveEntry(itemPath, item))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// addItems adds the items of a listed file: the file itself, or the exports and metadata of a Google Docs file.
+func (c *driveConn) addItems(items map[string]*driveItemEntry, itemPath string, file *drive.File) {
+	if file.MimeType == driveFolderType || !strings.HasPrefix(file.MimeType, driveNativeType) {
+		items[itemPath] = &driveItemEntry{file: file}
+		return
+	}
+	// Google Docs files have no content of their own, forms and shortcuts only keep their metadata
+	metadata, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		logger.Error("Error encoding the metadata of %s: %v", itemPath, err)
+	} else {
+		items[itemPath+driveMetadataSuffix] = &driveItemEntry{file: file, metadata: metadata}
+	}
+	for _, export := range driveExports[file.MimeType] {
+		if !c.formats[export.format] {
+			continue
+		}
+		items[itemPath+export.extension] = &driveItemEntry{file: file, export: &export}
+	}
+}
+
+func (c *driveConn) Stat(remotePath string) (Entry, error) {
+	remotePath = path.Clean("/" + remotePath)
+	item, err := c.lookup(remotePath)
+	if err != nil {
+		return Entry{}, err
+	}
+	return driveEntry(remotePath, item), nil
+}
+
+// lookup returns the item of a path, listing its parent folder if it was not listed yet.
+func (c *driveConn) lookup(itemPath string) (*driveItemEntry, error) {
+	c.mu.Lock()
+	item, ok := c.items[itemPath]
+	c.mu.Unlock()
+	if ok {
+		return item, nil
+	}
+	if itemPath == "/" {
+		return nil, fmt.Errorf("root folder not found")
+	}
+	if _, err := c.ReadDir(path.Dir(itemPath)); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	item, ok = c.items[itemPath]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("file not found: %s", itemPath)
+	}
+	return item, nil
+}
+
+// OpenFrom downloads a file, or exports a Google Docs file. Exports cannot be resumed and start over.
+func (c *driveConn) OpenFrom(remotePath string, offset int64) (io.ReadCloser, error) {
+	item, err := c.lookup(path.Clean("/" + remotePath))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case item.metadata != nil:
+		return io.NopCloser(bytes.NewReader(item.metadata[min(offset, int64(len(item.metadata))):])), nil
+	case item.export != nil:
+		return c.export(item)
+	}
+	call := c.service.Files.Get(item.file.Id).SupportsAllDrives(true)
+	if offset > 0 {
+		call.Header().Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := call.Download()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// export exports a Google Docs file with its export link, which has no size limit, unlike the export API.
+func (c *driveConn) export(item *driveItemEntry) (io.ReadCloser, error) {
+	var link string
+	for _, mimeType := range item.export.mimeTypes {
+		if link = item.file.ExportLinks[mimeType]; link != "" {
+			break
+		}
+	}
+	if link == "" {
+		return nil, fmt.Errorf("%s cannot be exported to %s", item.file.Name, item.export.mimeTypes[0])
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("error exporting %s: %s", item.file.Name, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (c *driveConn) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// driveEntry returns the entry of an item. The size of exports is only known once they are exported.
+func driveEntry(itemPath string, item *driveItemEntry) Entry {
+	file := item.file
+	modTime, _ := time.Parse(time.RFC3339, file.ModifiedTime)
+	entry := Entry{
+		Path:     itemPath,
+		Size:     file.Size,
+		ModTime:  modTime,
+		IsDir:    file.MimeType == driveFolderType,
+		Metadata: driveMetadata(file),
+	}
+	switch {
+	case item.metadata != nil:
+		entry.Size = int64(len(item.metadata))
+	case item.export != nil:
+		entry.Size = -1
+	}
+	return entry
+}
+
+// driveMetadata returns the Dublin Core metadata of a file: its owner or the user who created it as creator,
+// the last editor as contributor, its modification date and its Drive URL as source.
+func driveMetadata(file *drive.File) map[string]string {
+	metadata := map[string]string{}
+	if len(file.Owners) > 0 && file.Owners[0].DisplayName != "" {
+		metadata["dc.creator"] = file.Owners[0].DisplayName
+	}
+	if editor := file.LastModifyingUser; editor != nil && editor.DisplayName != "" && editor.DisplayName != metadata["dc.creator"] {
+		metadata["dc.contributor"] = editor.DisplayName
+	}
+	if modTime, err := time.Parse(time.RFC3339, file.ModifiedTime); err == nil {
+		metadata["dc.date"] = modTime.UTC().Format("2006-01-02")
+	}
+	if file.WebViewLink != "" {
+		metadata["dc.source"] = file.WebViewLink
+	}
+	return metadata
+}
@@ -0,0 +1,64 @@
+package source
+
+import (
+	"context"
+	"io"
+	"path"
+
+	"github.com/penwern/curate-preservation-core/internal/rclone"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// rcloneConn reads transfers from an rclone remote, with the rclone command. Paths are relative to the remote path.
+type rcloneConn struct {
+	remote *rclone.Remote
+}
+
+func dialRclone(source *config.TransferSource, insecure bool) (*rcloneConn, error) {
+	remote, err := rclone.New(source.Rclone, insecure)
+	if err != nil {
+		return nil, err
+	}
+	// Check the remote is reachable, as the other protocols do when they connect
+	if _, err := remote.List(context.Background(), "", false); err != nil {
+		return nil, err
+	}
+	return &rcloneConn{remote: remote}, nil
+}
+
+// ReadDir checks the directory exists first, as rclone lists a missing directory of some remotes as empty.
+func (c *rcloneConn) ReadDir(dir string) ([]Entry, error) {
+	if _, err := c.remote.Stat(context.Background(), dir); err != nil {
+		return nil, err
+	}
+	entries, err := c.remote.List(context.Background(), dir, false)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, rcloneEntry(path.Join(dir, entry.Path), entry))
+	}
+	return result, nil
+}
+
+func (c *rcloneConn) Stat(remotePath string) (Entry, error) {
+	entry, err := c.remote.Stat(context.Background(), remotePath)
+	if err != nil {
+		return Entry{}, err
+	}
+	return rcloneEntry(remotePath, entry), nil
+}
+
+// OpenFrom streams the file from offset. Closing the reader stops rclone, so cancelled downloads do not linger.
+func (c *rcloneConn) OpenFrom(remotePath string, offset int64) (io.ReadCloser, error) {
+	return c.remote.Open(context.Background(), remotePath, offset)
+}
+
+func (c *rcloneConn) Close() error {
+	return nil
+}
+
+func rcloneEntry(remotePath string, entry rclone.Entry) Entry {
+	return Entry{Path: remotePath, Size: entry.Size, ModTime: entry.ModTime, IsDir: entry.IsDir}
+}
@@ -0,0 +1,172 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	// maxUploadParts is the largest number of parts of an S3 multipart upload.
+	maxUploadParts = 10000
+	// minPartSize is the smallest part size of an S3 multipart upload, except for the last part.
+	minPartSize = 5 * 1024 * 1024
+)
+
+// Upload is a multipart upload of a transfer to an s3 source. The client uploads each part to its presigned URL
+// and completes the upload with the ETags returned for the parts.
+type Upload struct {
+	Path      string       `json:"path"` // Transfer path relative to the source root directory
+	UploadID  string       `json:"upload_id"`
+	PartSize  int64        `json:"part_size"`
+	Parts     []UploadPart `json:"parts"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+// UploadPart is a part of an upload and the presigned URL it is PUT to.
+type UploadPart struct {
+	Number int    `json:"part_number"`
+	URL    string `json:"url"`
+}
+
+// CompletedPart is an uploaded part and the ETag returned for it.
+type CompletedPart struct {
+	Number int    `json:"part_number"`
+	ETag   string `json:"etag"`
+}
+
+// s3Conn reads transfers from an S3 compatible bucket. Directories are key prefixes.
+type s3Conn struct {
+	client *minio.Client
+	core   *minio.Core
+	bucket string
+}
+
+func dialS3(source *config.TransferSource, insecure bool) (*s3Conn, error) {
+	client, err := utils.NewS3Client(source.S3, insecure)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Conn{client: client, core: &minio.Core{Client: client}, bucket: source.S3.Bucket}, nil
+}
+
+func (c *s3Conn) ReadDir(dir string) ([]Entry, error) {
+	prefix := objectKey(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	var entries []Entry
+	for object := range c.client.ListObjects(context.Background(), c.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			entries = append(entries, Entry{Path: "/" + strings.TrimSuffix(object.Key, "/"), IsDir: true})
+			continue
+		}
+		entries = append(entries, Entry{Path: "/" + object.Key, Size: object.Size, ModTime: object.LastModified})
+	}
+	return entries, nil
+}
+
+// Stat returns the object under the path, or a directory if objects exist below it.
+func (c *s3Conn) Stat(remotePath string) (Entry, error) {
+	key := objectKey(remotePath)
+	info, err := c.client.StatObject(context.Background(), c.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return Entry{Path: remotePath, Size: info.Size, ModTime: info.LastModified}, nil
+	}
+	if resp := minio.ToErrorResponse(err); resp.Code != minio.NoSuchKey && resp.StatusCode != http.StatusNotFound {
+		return Entry{}, err
+	}
+	for object := range c.client.ListObjects(context.Background(), c.bucket, minio.ListObjectsOptions{Prefix: key + "/", MaxKeys: 1}) {
+		if object.Err != nil {
+			return Entry{}, object.Err
+		}
+		return Entry{Path: remotePath, IsDir: true}, nil
+	}
+	return Entry{}, fmt.Errorf("%s: %w", remotePath, os.ErrNotExist)
+}
+
+func (c *s3Conn) OpenFrom(remotePath string, offset int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if offset > 0 {
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+	return c.client.GetObject(context.Background(), c.bucket, objectKey(remotePath), opts)
+}
+
+func (c *s3Conn) Close() error {
+	return nil
+}
+
+// createUpload starts a multipart upload and presigns the URLs of its parts.
+// The part size is raised if the transfer would need more than the maximum number of parts.
+func (c *s3Conn) createUpload(ctx context.Context, remotePath string, size, partSize int64, expiry time.Duration) (*Upload, error) {
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	if size > partSize*maxUploadParts {
+		// Round up to whole MiB
+		partSize = ((size/maxUploadParts)/(1024*1024) + 1) * 1024 * 1024
+	}
+	count := int((size + partSize - 1) / partSize)
+	if count == 0 {
+		count = 1
+	}
+
+	key := objectKey(remotePath)
+	uploadID, err := c.core.NewMultipartUpload(ctx, c.bucket, key, minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	if err != nil {
+		return nil, fmt.Errorf("error starting upload: %w", err)
+	}
+	upload := &Upload{UploadID: uploadID, PartSize: partSize, ExpiresAt: time.Now().Add(expiry).UTC()}
+	for number := 1; number <= count; number++ {
+		params := url.Values{}
+		params.Set("partNumber", strconv.Itoa(number))
+		params.Set("uploadId", uploadID)
+		partURL, err := c.client.Presign(ctx, http.MethodPut, c.bucket, key, expiry, params)
+		if err != nil {
+			_ = c.core.AbortMultipartUpload(ctx, c.bucket, key, uploadID)
+			return nil, fmt.Errorf("error presigning part %d: %w", number, err)
+		}
+		upload.Parts = append(upload.Parts, UploadPart{Number: number, URL: partURL.String()})
+	}
+	return upload, nil
+}
+
+func (c *s3Conn) completeUpload(ctx context.Context, remotePath, uploadID string, parts []CompletedPart) error {
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+	if _, err := c.core.CompleteMultipartUpload(ctx, c.bucket, objectKey(remotePath), uploadID, completed, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("error completing upload: %w", err)
+	}
+	return nil
+}
+
+func (c *s3Conn) abortUpload(ctx context.Context, remotePath, uploadID string) error {
+	if err := c.core.AbortMultipartUpload(ctx, c.bucket, objectKey(remotePath), uploadID); err != nil {
+		return fmt.Errorf("error aborting upload: %w", err)
+	}
+	return nil
+}
+
+// objectKey returns the object key of an absolute remote path.
+func objectKey(remotePath string) string {
+	return strings.TrimPrefix(path.Clean(remotePath), "/")
+}
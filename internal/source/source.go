@@ -0,0 +1,366 @@
+// Package source pulls transfers from remote servers (SFTP, FTPS, WebDAV, S3, rclone remotes, SharePoint, Google Drive),
+// such as the delivery servers of digitisation vendors or institutional WebDAV shares. S3 sources also accept uploads
+// with presigned URLs. SharePoint and Google Drive sources also return the author and modification date of the files as
+// package metadata, and Google Docs files are exported to preservable formats.
+// Files are downloaded under a .partial name and resume from it when a download is interrupted.
+// Every file is checked against its remote size, and against the checksum sidecar files
+// (<file>.md5, .sha1, .sha256 or .sha512) delivered with it.
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// sidecarAlgorithms are the checksum algorithms of the sidecar files, by file extension.
+var sidecarAlgorithms = map[string]string{
+	".md5":    "md5",
+	".sha1":   "sha1",
+	".sha256": "sha256",
+	".sha512": "sha512",
+}
+
+// Entry is a file or directory on a remote server.
+type Entry struct {
+	Path    string    `json:"path"` // Relative to the source root directory
+	Size    int64     `json:"size"` // -1 if only known once downloaded, e.g. of exported Google Docs
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+
+	// Metadata is the Dublin Core metadata of the entry, keyed as in metadata.json (e.g. dc.creator), if the source has any
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Transfer is a downloaded transfer.
+type Transfer struct {
+	LocalPath string
+	// Metadata is the metadata of the transfer and its files, by path relative to the transfer ("" is the transfer)
+	Metadata map[string]map[string]string
+}
+
+// conn is a connection to a remote server. Paths are slash separated and absolute.
+type conn interface {
+	// ReadDir lists a directory. Entry paths are absolute.
+	ReadDir(dir string) ([]Entry, error)
+	// Stat returns the entry of a file or directory.
+	Stat(remotePath string) (Entry, error)
+	// OpenFrom opens a file for reading, starting at offset.
+	OpenFrom(remotePath string, offset int64) (io.ReadCloser, error)
+	// Close closes the connection.
+	Close() error
+}
+
+// Client pulls transfers from a transfer source.
+type Client struct {
+	source *config.TransferSource
+	conn   conn
+	retry  config.RetryPolicy // Retries of the file downloads on transient errors
+}
+
+// New connects to a transfer source. Downloads are retried on transient errors following the retry policy.
+func New(source *config.TransferSource, insecure bool, retry config.RetryPolicy) (*Client, error) {
+	if source == nil {
+		return nil, fmt.Errorf("transfer source cannot be nil")
+	}
+	var (
+		c   conn
+		err error
+	)
+	switch source.Protocol {
+	case config.SourceProtocolSFTP:
+		c, err = dialSFTP(source)
+	case config.SourceProtocolFTPS:
+		c, err = dialFTPS(source, insecure)
+	case config.SourceProtocolWebDAV:
+		c, err = dialWebDAV(source, insecure)
+	case config.SourceProtocolS3:
+		c, err = dialS3(source, insecure)
+	case config.SourceProtocolRclone:
+		c, err = dialRclone(source, insecure)
+	case config.SourceProtocolSharePoint:
+		c, err = dialSharePoint(source, insecure)
+	case config.SourceProtocolGoogleDrive:
+		c, err = dialGoogleDrive(source, insecure)
+	default:
+		err = fmt.Errorf("unsupported protocol: %s", source.Protocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to transfer source %s: %w", source.Name, err)
+	}
+	return &Client{source: source, conn: c, retry: retry}, nil
+}
+
+// Name returns the name of the transfer source.
+func (c *Client) Name() string {
+	return c.source.Name
+}
+
+// Close closes the connection to the transfer source.
+func (c *Client) Close() {
+	if err := c.conn.Close(); err != nil {
+		logger.Error("Error closing transfer source %s: %v", c.source.Name, err)
+	}
+}
+
+// List lists a directory relative to the source root directory.
+func (c *Client) List(_ context.Context, dir string) ([]Entry, error) {
+	entries, err := c.conn.ReadDir(c.remotePath(dir))
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", dir, err)
+	}
+	for i := range entries {
+		entries[i].Path = c.relativePath(entries[i].Path)
+	}
+	return entries, nil
+}
+
+// Stat returns the entry of a file or directory relative to the source root directory.
+func (c *Client) Stat(_ context.Context, transferPath string) (Entry, error) {
+	entry, err := c.conn.Stat(c.remotePath(transferPath))
+	if err != nil {
+		return Entry{}, fmt.Errorf("error reading %s: %w", transferPath, err)
+	}
+	entry.Path = c.relativePath(entry.Path)
+	return entry, nil
+}
+
+// Download downloads a file or directory, relative to the source root directory, into destDir and verifies it.
+func (c *Client) Download(ctx context.Context, transferPath, destDir string) (*Transfer, error) {
+	remote := c.remotePath(transferPath)
+	if remote == c.remotePath("") {
+		return nil, fmt.Errorf("transfer path cannot be the source root directory")
+	}
+	entry, err := c.conn.Stat(remote)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", transferPath, err)
+	}
+	transfer := &Transfer{
+		LocalPath: filepath.Join(destDir, path.Base(remote)),
+		Metadata:  map[string]map[string]string{},
+	}
+	transfer.addMetadata("", entry.Metadata)
+	if entry.IsDir {
+		err = c.downloadDir(ctx, transfer, remote, "")
+	} else {
+		entry.Path = remote
+		err = c.downloadFile(ctx, entry, transfer.LocalPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	verified, err := verifySidecars(transfer.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Downloaded %s from %s, %d files verified against checksum files", transferPath, c.source.Name, verified)
+	return transfer, nil
+}
+
+// downloadDir downloads a directory tree, at dir relative to the transfer.
+func (c *Client) downloadDir(ctx context.Context, transfer *Transfer, remoteDir, dir string) error {
+	localDir := filepath.Join(transfer.LocalPath, filepath.FromSlash(dir))
+	if err := utils.CreateDir(localDir); err != nil {
+		return err
+	}
+	entries, err := c.conn.ReadDir(remoteDir)
+	if err != nil {
+		return fmt.Errorf("error listing %s: %w", remoteDir, err)
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := path.Join(dir, path.Base(entry.Path))
+		transfer.addMetadata(name, entry.Metadata)
+		localPath := filepath.Join(transfer.LocalPath, filepath.FromSlash(name))
+		if entry.IsDir {
+			err = c.downloadDir(ctx, transfer, entry.Path, name)
+		} else {
+			err = c.downloadFile(ctx, entry, localPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadFile downloads a file under a .partial name, resuming a previous download, and renames it into place
+// once its size matches the remote file. Files already downloaded with the remote size are skipped.
+// Files of unknown size are downloaded again in full.
+func (c *Client) downloadFile(ctx context.Context, entry Entry, localPath string) error {
+	if info, err := os.Stat(localPath); err == nil && info.Size() == entry.Size {
+		logger.Debug("Already downloaded: %s", entry.Path)
+		return nil
+	}
+	partial := localPath + ".partial"
+	err := utils.RetryContext(ctx, c.retry, func() error {
+		var offset int64
+		if info, err := os.Stat(partial); err == nil && info.Size() <= entry.Size {
+			offset = info.Size()
+		}
+		flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if offset == 0 {
+			flags |= os.O_TRUNC
+		} else {
+			logger.Info("Resuming download of %s at %d bytes", entry.Path, offset)
+		}
+		file, err := os.OpenFile(filepath.Clean(partial), flags, 0o600)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				logger.Error("Failed to close %s: %v", partial, err)
+			}
+		}()
+		reader, err := c.conn.OpenFrom(entry.Path, offset)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := reader.Close(); err != nil {
+				logger.Debug("Failed to close remote file %s: %v", entry.Path, err)
+			}
+		}()
+		_, err = io.Copy(file, &contextReader{ctx: ctx, reader: reader})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %w", entry.Path, err)
+	}
+	info, err := os.Stat(partial)
+	if err != nil {
+		return err
+	}
+	if entry.Size >= 0 && info.Size() != entry.Size {
+		// Start over on the next attempt
+		if err := os.Remove(partial); err != nil {
+			logger.Error("Failed to remove partial file: %v", err)
+		}
+		return fmt.Errorf("size mismatch for %s: expected %d, got %d", entry.Path, entry.Size, info.Size())
+	}
+	return os.Rename(partial, localPath)
+}
+
+// addMetadata records the metadata of a path of the transfer.
+func (t *Transfer) addMetadata(name string, metadata map[string]string) {
+	if len(metadata) > 0 {
+		t.Metadata[name] = metadata
+	}
+}
+
+// CreateUpload starts a presigned multipart upload of a transfer of the given size.
+// Only s3 sources support uploads.
+func (c *Client) CreateUpload(ctx context.Context, transferPath string, size, partSize int64, expiry time.Duration) (*Upload, error) {
+	s3, err := c.s3()
+	if err != nil {
+		return nil, err
+	}
+	upload, err := s3.createUpload(ctx, c.remotePath(transferPath), size, partSize, expiry)
+	if err != nil {
+		return nil, err
+	}
+	upload.Path = c.relativePath(c.remotePath(transferPath))
+	return upload, nil
+}
+
+// CompleteUpload assembles the uploaded parts of a transfer.
+func (c *Client) CompleteUpload(ctx context.Context, transferPath, uploadID string, parts []CompletedPart) error {
+	s3, err := c.s3()
+	if err != nil {
+		return err
+	}
+	return s3.completeUpload(ctx, c.remotePath(transferPath), uploadID, parts)
+}
+
+// AbortUpload cancels an upload and discards its uploaded parts.
+func (c *Client) AbortUpload(ctx context.Context, transferPath, uploadID string) error {
+	s3, err := c.s3()
+	if err != nil {
+		return err
+	}
+	return s3.abortUpload(ctx, c.remotePath(transferPath), uploadID)
+}
+
+// s3 returns the connection of an s3 source.
+func (c *Client) s3() (*s3Conn, error) {
+	s3, ok := c.conn.(*s3Conn)
+	if !ok {
+		return nil, fmt.Errorf("transfer source %s does not support uploads", c.source.Name)
+	}
+	return s3, nil
+}
+
+// remotePath returns the absolute remote path of a path relative to the source root directory.
+// Paths cannot escape the root directory.
+func (c *Client) remotePath(p string) string {
+	return path.Join("/", c.source.RootDir, path.Clean("/"+p))
+}
+
+// relativePath returns the path of an absolute remote path relative to the source root directory.
+func (c *Client) relativePath(p string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(p, c.remotePath("")), "/")
+}
+
+// verifySidecars checks the files of a downloaded transfer against their checksum sidecar files.
+// Returns the number of files verified.
+func verifySidecars(root string) (int, error) {
+	verified := 0
+	err := filepath.WalkDir(root, func(sidecar string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		algorithm, ok := sidecarAlgorithms[strings.ToLower(filepath.Ext(sidecar))]
+		if !ok || d.IsDir() {
+			return nil
+		}
+		target := strings.TrimSuffix(sidecar, filepath.Ext(sidecar))
+		if _, err := os.Stat(target); err != nil {
+			// Not a sidecar, e.g. a checksum manifest of several files
+			return nil
+		}
+		data, err := os.ReadFile(filepath.Clean(sidecar))
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return fmt.Errorf("checksum file is empty: %s", sidecar)
+		}
+		checksum, err := utils.FileChecksum(target, algorithm)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(fields[0], checksum) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", target, fields[0], checksum)
+		}
+		verified++
+		return nil
+	})
+	return verified, err
+}
+
+// contextReader stops reading once the context is cancelled.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
@@ -0,0 +1,307 @@
+// Package storageservice provides a client for the Archivematica Storage Service API (v2).
+// It is used to fetch and verify AIPs processed by a full Archivematica pipeline and to register our AIPs there.
+package storageservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+const (
+	// PackageTypeAIP is the Storage Service package type of AIPs.
+	PackageTypeAIP = "AIP"
+	// StatusUploaded is the status of packages stored successfully.
+	StatusUploaded = "UPLOADED"
+
+	// pageSize is the number of packages requested per page.
+	pageSize = 100
+	// transferTimeout bounds package downloads.
+	transferTimeout = 6 * time.Hour
+)
+
+// ErrPackageNotFound is returned when a package does not exist in the Storage Service.
+var ErrPackageNotFound = errors.New("package not found")
+
+// Package is a package stored in the Storage Service.
+type Package struct {
+	UUID            string `json:"uuid"`
+	PackageType     string `json:"package_type"`
+	Status          string `json:"status"`
+	Size            int64  `json:"size"`
+	CurrentPath     string `json:"current_path"`
+	CurrentFullPath string `json:"current_full_path"`
+	CurrentLocation string `json:"current_location"`
+	OriginPipeline  string `json:"origin_pipeline"`
+	StoredDate      string `json:"stored_date"`
+}
+
+// Name returns the file name of the package.
+func (p *Package) Name() string {
+	return filepath.Base(p.CurrentPath)
+}
+
+// FixityResult is the result of a Storage Service fixity check.
+type FixityResult struct {
+	Success   bool            `json:"success"`
+	Message   string          `json:"message"`
+	Failures  json.RawMessage `json:"failures,omitempty"`
+	Timestamp string          `json:"timestamp,omitempty"`
+}
+
+// Client represents a Storage Service client.
+type Client struct {
+	httpClient     *utils.HTTPClient
+	downloadClient *utils.HTTPClient
+	config         *config.StorageServiceConfig
+}
+
+// NewClient creates a new Storage Service client.
+func NewClient(cfg *config.StorageServiceConfig, insecure bool) (*Client, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("storage service config cannot be nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid storage service config: %w", err)
+	}
+	return &Client{
+		httpClient:     utils.NewHTTPClient(60*time.Second, insecure),
+		downloadClient: utils.NewHTTPClient(transferTimeout, insecure),
+		config:         cfg,
+	}, nil
+}
+
+// Close closes the Storage Service client.
+func (c *Client) Close() {
+	c.httpClient.Close()
+	c.downloadClient.Close()
+}
+
+// ListAIPs lists the stored AIPs. If pipelineUUID is set, only AIPs from that pipeline are returned.
+func (c *Client) ListAIPs(ctx context.Context, pipelineUUID string) ([]Package, error) {
+	params := url.Values{}
+	params.Set("package_type", PackageTypeAIP)
+	params.Set("status", StatusUploaded)
+	params.Set("limit", fmt.Sprint(pageSize))
+	if pipelineUUID != "" {
+		params.Set("origin_pipeline__uuid", pipelineUUID)
+	}
+	next := "/api/v2/file/?" + params.Encode()
+
+	var packages []Package
+	for next != "" {
+		var page struct {
+			Meta struct {
+				Next string `json:"next"`
+			} `json:"meta"`
+			Objects []Package `json:"objects"`
+		}
+		if err := c.get(ctx, next, &page); err != nil {
+			return nil, fmt.Errorf("error listing AIPs: %w", err)
+		}
+		packages = append(packages, page.Objects...)
+		next = page.Meta.Next
+	}
+	return packages, nil
+}
+
+// Ping checks that the Storage Service can be reached and accepts the API key.
+func (c *Client) Ping(ctx context.Context) error {
+	var page struct {
+		Objects []json.RawMessage `json:"objects"`
+	}
+	if err := c.get(ctx, "/api/v2/location/?limit=1", &page); err != nil {
+		return fmt.Errorf("storage service at %s not reachable: %w", c.config.URL, err)
+	}
+	return nil
+}
+
+// GetPackage returns a package by UUID.
+func (c *Client) GetPackage(ctx context.Context, uuid string) (*Package, error) {
+	var pkg Package
+	if err := c.get(ctx, fmt.Sprintf("/api/v2/file/%s/", url.PathEscape(uuid)), &pkg); err != nil {
+		return nil, fmt.Errorf("error getting package %s: %w", uuid, err)
+	}
+	return &pkg, nil
+}
+
+// CheckFixity asks the Storage Service to verify the fixity of a stored package.
+func (c *Client) CheckFixity(ctx context.Context, uuid string) (*FixityResult, error) {
+	var result FixityResult
+	if err := c.get(ctx, fmt.Sprintf("/api/v2/file/%s/check_fixity/", url.PathEscape(uuid)), &result); err != nil {
+		return nil, fmt.Errorf("error checking fixity of package %s: %w", uuid, err)
+	}
+	return &result, nil
+}
+
+// Download downloads a package into destDir and returns its path.
+// The download is written under a temporary name and its size is checked against the package size.
+func (c *Client) Download(ctx context.Context, pkg *Package, destDir string) (string, error) {
+	dest := filepath.Join(destDir, pkg.Name())
+	resp, err := c.downloadClient.DoRequest(ctx, "GET", c.url(fmt.Sprintf("/api/v2/file/%s/download/", url.PathEscape(pkg.UUID))), nil, c.headers())
+	if err != nil {
+		return "", fmt.Errorf("error downloading package %s: %w", pkg.UUID, err)
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download package %s: %s", pkg.UUID, resp.Status)
+	}
+	// Uncompressed AIPs are streamed as a tarball
+	if strings.Contains(resp.Header.Get("Content-Type"), "x-tar") && filepath.Ext(dest) != ".tar" {
+		dest += ".tar"
+	}
+
+	partial := dest + ".partial"
+	file, err := os.OpenFile(filepath.Clean(partial), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	written, err := io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && filepath.Ext(dest) != ".tar" && pkg.Size > 0 && written != pkg.Size {
+		err = fmt.Errorf("downloaded %d bytes, expected %d", written, pkg.Size)
+	}
+	if err != nil {
+		if removeErr := os.Remove(partial); removeErr != nil {
+			logger.Error("Failed to remove partial download: %v", removeErr)
+		}
+		return "", fmt.Errorf("error downloading package %s: %w", pkg.UUID, err)
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// RegisterAIP registers an AIP with the Storage Service. The AIP is staged in the origin directory and the
+// Storage Service copies it from the origin location to the AIP store location.
+func (c *Client) RegisterAIP(ctx context.Context, aipUUID, aipPath string) error {
+	if !c.config.Register {
+		return nil
+	}
+	info, err := os.Stat(aipPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("only compressed AIPs can be registered: %s", aipPath)
+	}
+	name := filepath.Base(aipPath)
+	staged := filepath.Join(c.config.OriginDir, name)
+	if err := copyFile(aipPath, staged); err != nil {
+		return fmt.Errorf("error staging AIP: %w", err)
+	}
+
+	body := map[string]any{
+		"uuid":             aipUUID,
+		"origin_location":  fmt.Sprintf("/api/v2/location/%s/", c.config.OriginLocationUUID),
+		"origin_path":      name,
+		"current_location": fmt.Sprintf("/api/v2/location/%s/", c.config.AIPStoreLocationUUID),
+		"current_path":     name,
+		"package_type":     PackageTypeAIP,
+		"aip_subtype":      "Archival Information Package",
+		"size":             info.Size(),
+		"origin_pipeline":  fmt.Sprintf("/api/v2/pipeline/%s/", c.config.PipelineUUID),
+		"events":           []any{},
+		"agents":           []any{},
+	}
+	err = c.post(ctx, "/api/v2/file/", body)
+	// The Storage Service has copied the AIP (or failed), the staged copy is no longer needed
+	if removeErr := os.Remove(staged); removeErr != nil {
+		logger.Error("Failed to remove staged AIP: %v", removeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("error registering AIP %s: %w", aipUUID, err)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, path string, target any) error {
+	resp, err := c.httpClient.DoRequest(ctx, "GET", c.url(path), nil, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		closeBody(resp)
+		return ErrPackageNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		closeBody(resp)
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return utils.ParseResponse(resp, target)
+}
+
+func (c *Client) post(ctx context.Context, path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	headers := c.headers()
+	headers["Content-Type"] = "application/json"
+	resp, err := c.httpClient.DoRequest(ctx, "POST", c.url(path), bytes.NewReader(data), headers)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("POST %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// url returns the absolute URL of an API path. Paths returned by the API (e.g. meta.next) are already rooted.
+func (c *Client) url(path string) string {
+	return strings.TrimSuffix(c.config.URL, "/") + path
+}
+
+func (c *Client) headers() map[string]string {
+	return map[string]string{
+		"Authorization": fmt.Sprintf("ApiKey %s:%s", c.config.Username, c.config.APIKey),
+		"Accept":        "application/json",
+		"User-Agent":    "curate",
+	}
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		logger.Error("Failed to close response body: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// certReloader serves the certificate of the HTTP API and the CAs of the client certificates, reloading them when
+// their files change, e.g. when certbot renews the certificate.
+type certReloader struct {
+	certFile, keyFile, clientCAFile string
+	base                            *tls.Config
+
+	mu      sync.RWMutex
+	config  *tls.Config // base with the loaded certificate and client CAs
+	modTime map[string]time.Time
+}
+
+// newTLSConfig returns the TLS configuration of the HTTP API, reloading the certificate and client CAs in the
+// background until the context is done. Returns nil if no certificate is configured.
+func newTLSConfig(ctx context.Context, cfg *config.Config) (*tls.Config, error) {
+	c := cfg.TLS
+	if c.CertFile == "" {
+		if c.ClientAuth != "" && c.ClientAuth != "none" {
+			return nil, errors.New("client certificates require a server certificate (CA4M_TLS_CERT_FILE)")
+		}
+		return nil, nil
+	}
+	// The config of each connection replaces the config of the server, with its protocols
+	base := &tls.Config{MinVersion: tls.VersionTLS12, NextProtos: []string{"h2", "http/1.1"}}
+	switch c.ClientAuth {
+	case "optional":
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if base.ClientAuth != tls.NoClientCert && c.ClientCAFile == "" {
+		return nil, errors.New("client certificates require a CA file (CA4M_TLS_CLIENT_CA_FILE)")
+	}
+
+	r := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile, base: base}
+	if base.ClientAuth != tls.NoClientCert {
+		r.clientCAFile = c.ClientCAFile
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if c.ReloadInterval > 0 {
+		go r.watch(ctx, c.ReloadInterval)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.config, nil
+		},
+	}, nil
+}
+
+// load reads the certificate, its key and the client CAs.
+func (r *certReloader) load() error {
+	modTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate %s: %w", r.certFile, err)
+	}
+	config := r.base.Clone()
+	config.Certificates = []tls.Certificate{cert}
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(filepath.Clean(r.clientCAFile))
+		if err != nil {
+			return fmt.Errorf("error reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in client CA file %s", r.clientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = config
+	r.modTime = modTime
+	if cert.Leaf != nil {
+		logger.Info("Loaded TLS certificate for %v, valid until %s", cert.Leaf.DNSNames, cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// modTimes returns the modification times of the files. Symbolic links are followed, so that the certificates
+// linked to by certbot's live directory are checked.
+func (r *certReloader) modTimes() (map[string]time.Time, error) {
+	modTime := make(map[string]time.Time, 3)
+	for _, path := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading TLS file: %w", err)
+		}
+		modTime[path] = info.ModTime()
+	}
+	return modTime, nil
+}
+
+// watch reloads the files when they change, until the context is done. The current certificate is kept if the
+// new files cannot be loaded, e.g. when the certificate was written but not yet its key.
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modTime, err := r.modTimes()
+		if err != nil {
+			logger.Warn("Failed to check the TLS certificate: %v", err)
+			continue
+		}
+		r.mu.RLock()
+		changed := false
+		for path, t := range modTime {
+			changed = changed || !t.Equal(r.modTime[path])
+		}
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := r.load(); err != nil {
+			logger.Warn("Failed to reload the TLS certificate, keeping the current one: %v", err)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/internal/preservation"
+	"github.com/penwern/curate-preservation-core/internal/queue"
+	"github.com/penwern/curate-preservation-core/internal/tus"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	// tusContentType is the content type of the chunks of an upload.
+	tusContentType = "application/offset+octet-stream"
+	// tusChunkTimeout bounds the time a chunk is received in, beyond the timeouts of the other requests. Clients send
+	// chunks small enough for their bandwidth.
+	tusChunkTimeout = time.Hour
+	// tusPruneInterval is the interval at which expired uploads are removed.
+	tusPruneInterval = time.Hour
+)
+
+// UploadsService is the interface of the resumable uploads used by the tus handlers.
+type UploadsService interface {
+	UploadDestination(ctx context.Context) (string, error)
+	CheckPackageSize(ctx context.Context, cellsPath string, size int64) error
+	PreserveUpload(store *tus.Store, upload *tus.Upload)
+	Callback(callbackURL, reference string) (*queue.Callback, error)
+}
+
+// UploadDestination returns the Cells folder the uploads of the tenant of the context are copied to.
+func (s *Service) UploadDestination(ctx context.Context) (string, error) {
+	return s.svc.UploadDestination(ctx)
+}
+
+// PreserveUpload copies a complete upload to its Cells destination and queues its preservation, in the background.
+// The upload is removed once queued. Uploads that fail to be queued, e.g. when the service shuts down, are kept and
+// queued again by MaintainUploads.
+func (s *Service) PreserveUpload(store *tus.Store, upload *tus.Upload) {
+	ctx, done, err := s.track(preservation.WithTenant(context.Background(), upload.Tenant))
+	if err != nil {
+		logger.Warn("Upload %s of %s is preserved on the next start: %v", upload.ID, upload.Filename, err)
+		return
+	}
+	go func() {
+		defer done()
+		if err := s.queueUpload(ctx, store, upload); err != nil {
+			logger.Error("Failed to queue upload %s of %s: %v", upload.ID, upload.Filename, err)
+		}
+	}()
+}
+
+func (s *Service) queueUpload(ctx context.Context, store *tus.Store, upload *tus.Upload) error {
+	priority, err := queue.ParsePriority(upload.Metadata["priority"])
+	if err != nil {
+		return err
+	}
+	callback, err := s.Callback(upload.Metadata["callback_url"], upload.Metadata["reference"])
+	if err != nil {
+		return err
+	}
+	userClient, err := s.svc.NewUserClient(ctx, upload.Username)
+	if err != nil {
+		return fmt.Errorf("failed to get user client: %w", err)
+	}
+	path, err := s.svc.PushUpload(ctx, userClient, store.Path(upload))
+	if err != nil {
+		return err
+	}
+	err = s.Enqueue(ctx, &queue.Job{
+		ID:       tenantJobID(upload.Tenant, "tus:"+upload.ID),
+		Username: upload.Username,
+		Tenant:   upload.Tenant,
+		Path:     path,
+		Profile:  upload.Metadata["profile"],
+		Callback: callback,
+		Priority: priority,
+	})
+	if err != nil {
+		return err
+	}
+	return store.Remove(upload.ID)
+}
+
+// MaintainUploads queues the preservation of the uploads completed before the service stopped, then removes the
+// expired uploads every hour until the context is done.
+func (s *Service) MaintainUploads(ctx context.Context, store *tus.Store) {
+	completed, err := store.Completed()
+	if err != nil {
+		logger.Error("Failed to list the complete uploads: %v", err)
+	}
+	for _, upload := range completed {
+		s.PreserveUpload(store, upload)
+	}
+	ticker := time.NewTicker(tusPruneInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := store.Prune(time.Now()); err != nil {
+			logger.Error("Failed to remove expired uploads: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tusRoutes returns the routes of the resumable uploads. They follow the tus protocol rather than the JSON API, and
+// are not described in the OpenAPI document.
+func tusRoutes() []apiRoute {
+	return []apiRoute{
+		{Method: http.MethodOptions, Path: "/intake/tus", Operation: "getTusCapabilities"},
+		{Method: http.MethodPost, Path: "/intake/tus", Operation: "createTusUpload", Role: config.RoleSubmitter, Limited: true},
+		{Method: http.MethodHead, Path: "/intake/tus/{id}", Operation: "getTusUpload", Role: config.RoleSubmitter},
+		{Method: http.MethodPatch, Path: "/intake/tus/{id}", Operation: "writeTusUpload", Role: config.RoleSubmitter},
+		{Method: http.MethodDelete, Path: "/intake/tus/{id}", Operation: "terminateTusUpload", Role: config.RoleSubmitter},
+	}
+}
+
+// tusHandlers returns the handlers of the tus routes, by operation.
+func tusHandlers(svc UploadsService, store *tus.Store) map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"getTusCapabilities": TusOptionsHandler(store),
+		"createTusUpload":    CreateTusUploadHandler(svc, store),
+		"getTusUpload":       TusUploadHandler(store),
+		"writeTusUpload":     WriteTusUploadHandler(svc, store),
+		"terminateTusUpload": TerminateTusUploadHandler(store),
+	}
+}
+
+// TusOptionsHandler responds with the version, extensions and maximum size of the tus protocol supported.
+func TusOptionsHandler(store *tus.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Tus-Resumable", tus.Version)
+		w.Header().Set("Tus-Version", tus.Version)
+		w.Header().Set("Tus-Extension", tus.Extensions)
+		if maxSize := store.MaxSize(); maxSize > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// CreateTusUploadHandler creates an upload of the Upload-Length header. The Upload-Metadata header gives the filename
+// of the transfer, the username of the Cells user it is preserved as, and optionally its processing profile and job
+// priority. The request may carry the first chunk of the upload.
+func CreateTusUploadHandler(svc UploadsService, store *tus.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !tusResumable(w, r) {
+			return
+		}
+		if r.Header.Get("Upload-Defer-Length") != "" {
+			http.Error(w, "deferred upload length is not supported", http.StatusBadRequest)
+			return
+		}
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || length <= 0 {
+			http.Error(w, "invalid Upload-Length header", http.StatusBadRequest)
+			return
+		}
+		metadata, err := tus.ParseMetadata(r.Header.Get("Upload-Metadata"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		upload := &tus.Upload{
+			Filename: metadata["filename"],
+			Length:   length,
+			Metadata: metadata,
+			Username: metadata["username"],
+			Tenant:   preservation.TenantFromContext(r.Context()),
+		}
+		if upload.Filename == "" {
+			upload.Filename = metadata["name"]
+		}
+		if upload.Filename == "" || upload.Username == "" {
+			http.Error(w, "the filename and username metadata are required", http.StatusBadRequest)
+			return
+		}
+		if _, err := queue.ParsePriority(metadata["priority"]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := svc.Callback(metadata["callback_url"], metadata["reference"]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		destination, err := svc.UploadDestination(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), tusErrorStatus(err))
+			return
+		}
+		if err := svc.CheckPackageSize(r.Context(), destination, length); err != nil {
+			http.Error(w, err.Error(), tusErrorStatus(err))
+			return
+		}
+		if err := store.Create(upload); err != nil {
+			status := tusErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				logger.Error(fmt.Sprintf("Failed to create upload: %v", err))
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		logger.Info("Created upload %s of %s (%d bytes) for %s", upload.ID, upload.Filename, upload.Length, upload.Username)
+		w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+upload.ID)
+		if r.Header.Get("Content-Type") == tusContentType {
+			if upload, err = writeTusChunk(w, r, svc, store, upload.ID, 0); err != nil {
+				http.Error(w, err.Error(), tusErrorStatus(err))
+				return
+			}
+			w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		}
+		setTusExpiry(w, upload)
+		w.WriteHeader(http.StatusCreated)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// TusUploadHandler responds with the offset, length and metadata of an upload.
+func TusUploadHandler(store *tus.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !tusResumable(w, r) {
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		upload, err := tusUpload(r, store)
+		if err != nil {
+			// HEAD responses have no body
+			w.WriteHeader(tusErrorStatus(err))
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		if len(upload.Metadata) > 0 {
+			w.Header().Set("Upload-Metadata", tus.FormatMetadata(upload.Metadata))
+		}
+		setTusExpiry(w, upload)
+		w.WriteHeader(http.StatusOK)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// WriteTusUploadHandler writes a chunk to an upload, at the offset of the Upload-Offset header. Once the upload is
+// complete, its preservation is queued.
+func WriteTusUploadHandler(svc UploadsService, store *tus.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !tusResumable(w, r) {
+			return
+		}
+		if r.Header.Get("Content-Type") != tusContentType {
+			http.Error(w, "chunks must be sent as "+tusContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "invalid Upload-Offset header", http.StatusBadRequest)
+			return
+		}
+		upload, err := tusUpload(r, store)
+		if err != nil {
+			http.Error(w, err.Error(), tusErrorStatus(err))
+			return
+		}
+		if r.ContentLength > upload.Length-offset {
+			http.Error(w, "chunk exceeds the length of the upload", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if upload, err = writeTusChunk(w, r, svc, store, upload.ID, offset); err != nil {
+			http.Error(w, err.Error(), tusErrorStatus(err))
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		setTusExpiry(w, upload)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// TerminateTusUploadHandler removes an incomplete upload.
+func TerminateTusUploadHandler(store *tus.Store) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !tusResumable(w, r) {
+			return
+		}
+		upload, err := tusUpload(r, store)
+		if err == nil {
+			err = store.Terminate(upload.ID)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), tusErrorStatus(err))
+			return
+		}
+		logger.Info("Terminated upload %s of %s", upload.ID, upload.Filename)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return recoveryMiddleware(handler)
+}
+
+// tusResumable sets the Tus-Resumable header of the response, and refuses the requests of other protocol versions
+// with 412. Returns false if the request is refused.
+func tusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tus.Version)
+	if r.Header.Get("Tus-Resumable") != tus.Version {
+		w.Header().Set("Tus-Version", tus.Version)
+		http.Error(w, "unsupported tus version, "+tus.Version+" is supported", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// tusUpload returns the upload of the request. Returns preservation.ErrTenantAccess if it was created by another
+// tenant.
+func tusUpload(r *http.Request, store *tus.Store) (*tus.Upload, error) {
+	upload, err := store.Get(r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	if tenant := preservation.TenantFromContext(r.Context()); upload.Tenant != tenant {
+		return nil, fmt.Errorf("%w: upload %s is not an upload of tenant %s", preservation.ErrTenantAccess, upload.ID, tenant)
+	}
+	return upload, nil
+}
+
+// writeTusChunk writes the chunk in the body of the request to an upload, and queues the preservation of the upload
+// once it is complete. The chunk is given longer than the other requests to be received.
+func writeTusChunk(w http.ResponseWriter, r *http.Request, svc UploadsService, store *tus.Store, id string, offset int64) (*tus.Upload, error) {
+	controller := http.NewResponseController(w)
+	deadline := time.Now().Add(tusChunkTimeout)
+	if err := controller.SetReadDeadline(deadline); err != nil {
+		logger.Debug("Chunk of upload %s is read with the server timeout: %v", id, err)
+	}
+	if err := controller.SetWriteDeadline(deadline); err != nil {
+		logger.Debug("Chunk of upload %s is answered with the server timeout: %v", id, err)
+	}
+	upload, err := store.Write(id, offset, r.Body)
+	if err != nil {
+		if upload != nil && !errors.Is(err, tus.ErrOffsetMismatch) && !errors.Is(err, tus.ErrComplete) {
+			logger.Warn("Upload %s of %s interrupted at %d of %d bytes: %v", id, upload.Filename, upload.Offset, upload.Length, err)
+		}
+		return nil, err
+	}
+	if upload.Complete() {
+		logger.Info("Upload %s of %s complete (%d bytes), queuing its preservation", upload.ID, upload.Filename, upload.Length)
+		svc.PreserveUpload(store, upload)
+	}
+	return upload, nil
+}
+
+// setTusExpiry sets the Upload-Expires header of an incomplete upload.
+func setTusExpiry(w http.ResponseWriter, upload *tus.Upload) {
+	if !upload.Complete() {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	}
+}
+
+// tusErrorStatus returns the response status of an upload error.
+func tusErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, tus.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, tus.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tus.ErrOffsetMismatch), errors.Is(err, tus.ErrComplete):
+		return http.StatusConflict
+	case errors.Is(err, tus.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, tus.ErrLocked):
+		return http.StatusLocked
+	case errors.Is(err, preservation.ErrTenantAccess):
+		return http.StatusForbidden
+	case errors.Is(err, preservation.ErrQuotaExceeded):
+		return quotaErrorStatus(err)
+	default:
+		return http.StatusInternalServerError
+	}
+}
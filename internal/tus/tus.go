@@ -0,0 +1,370 @@
+// Package tus stores the resumable uploads of the tus protocol (https://tus.io) on disk. Each upload has its data
+// file, written at increasing offsets by the chunks sent by the client, and an info file with its length, offset and
+// metadata, so that an interrupted upload resumes where it stopped, after a restart as well. Incomplete uploads
+// expire once no chunk was received for a while.
+package tus
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/config"
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Version is the version of the tus protocol implemented.
+const Version = "1.0.0"
+
+// Extensions are the extensions of the protocol supported.
+const Extensions = "creation,creation-with-upload,termination,expiration"
+
+const infoSuffix = ".json"
+
+var (
+	// ErrInvalid is returned when an upload is created without a valid transfer name or length.
+	ErrInvalid = errors.New("invalid upload")
+	// ErrNotFound is returned when no upload has the ID, or it expired.
+	ErrNotFound = errors.New("upload not found")
+	// ErrOffsetMismatch is returned when a chunk does not start at the offset of the upload.
+	ErrOffsetMismatch = errors.New("offset does not match the offset of the upload")
+	// ErrTooLarge is returned when the length of an upload exceeds the maximum size.
+	ErrTooLarge = errors.New("upload exceeds the maximum size")
+	// ErrLocked is returned when a chunk is sent while another chunk of the upload is written.
+	ErrLocked = errors.New("upload is locked by another request")
+	// ErrComplete is returned when a complete upload is written to or terminated.
+	ErrComplete = errors.New("upload is complete")
+)
+
+// idPattern matches the IDs of the uploads, so that IDs read from URLs cannot name other files.
+var idPattern = regexp.MustCompile(`^[0-9a-f-]{36}$`)
+
+// Upload is a resumable upload of a transfer.
+type Upload struct {
+	ID        string            `json:"id"`
+	Filename  string            `json:"filename"`
+	Length    int64             `json:"length"` // Size of the transfer in bytes
+	Offset    int64             `json:"offset"` // Bytes received
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Username  string            `json:"username"`         // Cells user the transfer is preserved as
+	Tenant    string            `json:"tenant,omitempty"` // Tenant of the user who created the upload, if any
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"` // Incomplete uploads are removed after this time
+}
+
+// Complete reports whether every byte of the upload was received.
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// ParseMetadata parses the Upload-Metadata header: comma separated keys, each followed by a space and its base64
+// encoded value, or alone if it has no value.
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of metadata %q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// FormatMetadata formats metadata as an Upload-Metadata header.
+func FormatMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Store keeps the uploads in a directory: <id>.json is the info of an upload, and <id>/<filename> its data, so that
+// the transfer keeps its name once uploaded. The store is safe for concurrent use, a single request writes to an
+// upload at a time.
+type Store struct {
+	dir     string
+	maxSize int64         // Bytes, 0 for no limit
+	expiry  time.Duration // Time incomplete uploads are kept after their last chunk
+
+	mu      sync.Mutex
+	writing map[string]bool // Uploads a chunk is written to
+}
+
+// Open opens the upload store, in <DataDir>/uploads unless a directory is configured.
+func Open(cfg *config.Config) (*Store, error) {
+	dir := cfg.Tus.Dir
+	if dir == "" {
+		if cfg.DataDir == "" {
+			return nil, fmt.Errorf("no directory or data directory set for the uploads")
+		}
+		dir = filepath.Join(cfg.DataDir, "uploads")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating upload directory: %w", err)
+	}
+	return &Store{
+		dir:     dir,
+		maxSize: int64(cfg.Tus.MaxSizeGB) * 1024 * 1024 * 1024,
+		expiry:  cfg.Tus.Expiry,
+		writing: map[string]bool{},
+	}, nil
+}
+
+// MaxSize returns the maximum size of an upload in bytes, 0 if there is no limit.
+func (s *Store) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Path returns the data file of an upload.
+func (s *Store) Path(upload *Upload) string {
+	return filepath.Join(s.dir, upload.ID, upload.Filename)
+}
+
+// Create creates an empty upload of a transfer. Its ID, filename, creation and expiry times are set.
+func (s *Store) Create(upload *Upload) error {
+	name := path.Base(path.Clean("/" + upload.Filename))
+	if name == "/" || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("%w: invalid transfer name %q", ErrInvalid, upload.Filename)
+	}
+	if upload.Length <= 0 {
+		return fmt.Errorf("%w: length must be positive", ErrInvalid)
+	}
+	if s.maxSize > 0 && upload.Length > s.maxSize {
+		return ErrTooLarge
+	}
+	upload.ID = utils.NewUUID()
+	upload.Filename = name
+	upload.Offset = 0
+	upload.CreatedAt = time.Now().UTC()
+	upload.ExpiresAt = upload.CreatedAt.Add(s.expiry)
+
+	if err := os.Mkdir(filepath.Join(s.dir, upload.ID), 0o750); err != nil {
+		return fmt.Errorf("error creating upload: %w", err)
+	}
+	file, err := os.OpenFile(s.Path(upload), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("error creating upload: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error creating upload: %w", err)
+	}
+	return s.save(upload)
+}
+
+// Get returns an upload. Returns ErrNotFound if it does not exist or expired.
+func (s *Store) Get(id string) (*Upload, error) {
+	upload, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if !upload.Complete() && time.Now().After(upload.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return upload, nil
+}
+
+// Write appends a chunk to an upload, at the offset of the upload. The bytes received are kept even if reading the
+// chunk fails, so that the client resumes after them. Reading stops at the length of the upload. The expiry of the
+// upload is extended.
+func (s *Store) Write(id string, offset int64, chunk io.Reader) (*Upload, error) {
+	if !s.lock(id) {
+		return nil, ErrLocked
+	}
+	defer s.unlock(id)
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Complete() {
+		return upload, ErrComplete
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	file, err := os.OpenFile(s.Path(upload), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error opening upload: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	// Bytes written after the offset by an interrupted request were not recorded, the client sends them again
+	if err := file.Truncate(upload.Offset); err != nil {
+		return nil, fmt.Errorf("error writing upload: %w", err)
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error writing upload: %w", err)
+	}
+	n, copyErr := io.Copy(file, io.LimitReader(chunk, upload.Length-upload.Offset))
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("error writing upload: %w", err)
+	}
+	upload.Offset += n
+	upload.ExpiresAt = time.Now().UTC().Add(s.expiry)
+	if err := s.save(upload); err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return upload, fmt.Errorf("error reading chunk: %w", copyErr)
+	}
+	return upload, nil
+}
+
+// Terminate removes an incomplete upload. Complete uploads are being preserved and cannot be terminated.
+func (s *Store) Terminate(id string) error {
+	if !s.lock(id) {
+		return ErrLocked
+	}
+	defer s.unlock(id)
+	upload, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if upload.Complete() {
+		return ErrComplete
+	}
+	return s.Remove(id)
+}
+
+// Remove removes an upload and its data.
+func (s *Store) Remove(id string) error {
+	if !idPattern.MatchString(id) {
+		return ErrNotFound
+	}
+	if err := os.RemoveAll(filepath.Join(s.dir, id)); err != nil {
+		return fmt.Errorf("error removing upload: %w", err)
+	}
+	if err := os.Remove(filepath.Join(s.dir, id+infoSuffix)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing upload: %w", err)
+	}
+	return nil
+}
+
+// Completed returns the complete uploads, oldest first, e.g. to preserve the uploads whose preservation was not
+// queued before a restart.
+func (s *Store) Completed() ([]*Upload, error) {
+	uploads, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	var completed []*Upload
+	for _, upload := range uploads {
+		if upload.Complete() {
+			completed = append(completed, upload)
+		}
+	}
+	return completed, nil
+}
+
+// Prune removes the incomplete uploads that expired before a time. Returns the number of uploads removed.
+func (s *Store) Prune(now time.Time) (int, error) {
+	uploads, err := s.list()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, upload := range uploads {
+		if upload.Complete() || !now.After(upload.ExpiresAt) || !s.lock(upload.ID) {
+			continue
+		}
+		err := s.Remove(upload.ID)
+		s.unlock(upload.ID)
+		if err != nil {
+			return removed, err
+		}
+		logger.Info("Removed expired upload %s of %s (%d of %d bytes)", upload.ID, upload.Filename, upload.Offset, upload.Length)
+		removed++
+	}
+	return removed, nil
+}
+
+// list returns the uploads of the store, oldest first. Unreadable info files are skipped.
+func (s *Store) list() ([]*Upload, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload directory: %w", err)
+	}
+	var uploads []*Upload
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), infoSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		upload, err := s.load(id)
+		if err != nil {
+			logger.Warn("Skipping upload %s: %v", id, err)
+			continue
+		}
+		uploads = append(uploads, upload)
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].CreatedAt.Before(uploads[j].CreatedAt) })
+	return uploads, nil
+}
+
+func (s *Store) load(id string) (*Upload, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, id+infoSuffix))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload: %w", err)
+	}
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("error reading upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// save writes the info of an upload, replacing the previous info at once.
+func (s *Store) save(upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, upload.ID+infoSuffix)
+	if err := os.WriteFile(name+".tmp", data, 0o640); err != nil {
+		return fmt.Errorf("error writing upload: %w", err)
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return fmt.Errorf("error writing upload: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writing[id] {
+		return false
+	}
+	s.writing[id] = true
+	return true
+}
+
+func (s *Store) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.writing, id)
+}
@@ -0,0 +1,556 @@
+// Package validation checks packages delivered for preservation or stored as AIPs, in a directory or an archive: the
+// structure of an A3M AIP, the BagIt bag wrapping it (RFC 8493) and the references of its METS file. Problems are
+// collected in a report rather than returned, so that every problem of a package is reported at once.
+package validation
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// Checks run by Validate.
+const (
+	CheckStructure = "structure" // Layout of an A3M AIP: a single METS file, objects and logs
+	CheckBagIt     = "bagit"     // Declaration, manifests, payload completeness and fixity of the bag
+	CheckMETS      = "mets"      // Files, checksums and identifiers referenced by the METS file
+	checkArchive   = "archive"   // Extraction of an archive, reported with the other checks
+)
+
+// Checks lists the checks run by Validate, in the order they are run.
+var Checks = []string{CheckStructure, CheckBagIt, CheckMETS}
+
+// metsName matches the METS file of an A3M AIP, named after the AIP UUID.
+var metsName = regexp.MustCompile(`^METS\.([0-9a-fA-F-]{36})\.xml$`)
+
+// Issue is a problem found in a package.
+type Issue struct {
+	Check    string `json:"check"`
+	Path     string `json:"path,omitempty"` // Slash separated, relative to the root of the package
+	Message  string `json:"message"`
+	Mismatch bool   `json:"mismatch,omitempty"` // The files do not match a checksum of a manifest or the Payload-Oxum
+}
+
+// Report is the result of the validation of a package.
+type Report struct {
+	Path     string   `json:"path"`
+	Valid    bool     `json:"valid"` // No error was found, there may be warnings
+	Checks   []string `json:"checks"`
+	Files    int      `json:"files"` // Files of the payload, or of the package if it is not a bag
+	Errors   []Issue  `json:"errors,omitempty"`
+	Warnings []Issue  `json:"warnings,omitempty"`
+}
+
+// Mismatched reports whether an error of the report is a checksum or Payload-Oxum mismatch.
+func (r *Report) Mismatched() bool {
+	return slices.ContainsFunc(r.Errors, func(issue Issue) bool { return issue.Mismatch })
+}
+
+// Validate runs checks against a package directory or archive, every check if none is given. Archives are
+// extracted to a temporary directory with the path safety of the service. The package is the directory holding
+// bagit.txt, which can be the only directory of the archive or directory. Returns an error if the package cannot be
+// read, the problems of the package are in the report.
+func Validate(ctx context.Context, packagePath string, checks ...string) (*Report, error) {
+	if len(checks) == 0 {
+		checks = Checks
+	}
+	for _, check := range checks {
+		if !slices.Contains(Checks, check) {
+			return nil, fmt.Errorf("unknown check %q, expected one of %s", check, strings.Join(Checks, ", "))
+		}
+	}
+	info, err := os.Stat(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{report: &Report{Path: packagePath, Checks: checks}, checksums: map[string]string{}}
+	root := packagePath
+	if !info.IsDir() {
+		tmp, err := os.MkdirTemp("", "validate-*")
+		if err != nil {
+			return nil, fmt.Errorf("error creating extraction directory: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(tmp) }()
+		if _, err := utils.ExtractArchive(ctx, packagePath, tmp); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			v.errorf(checkArchive, "", "%v", err)
+			return v.finish(), nil
+		}
+		root = tmp
+	}
+	v.root = packageRoot(root)
+	v.bag = exists(filepath.Join(v.root, "bagit.txt"))
+	v.payload = v.root
+	if v.bag {
+		v.payload = filepath.Join(v.root, "data")
+	}
+	if v.files, err = listFiles(v.payload); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error listing files: %w", err)
+	}
+	v.report.Files = len(v.files)
+
+	for _, check := range Checks {
+		if !slices.Contains(checks, check) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		switch check {
+		case CheckStructure:
+			v.checkStructure()
+		case CheckBagIt:
+			v.checkBag(ctx)
+		case CheckMETS:
+			v.checkMETS(ctx)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return v.finish(), nil
+}
+
+// validator holds the state of the validation of a package.
+type validator struct {
+	report    *Report
+	root      string            // Directory of the package
+	bag       bool              // The package is a bag, with bagit.txt
+	payload   string            // Directory of the payload: data in a bag, the package otherwise
+	files     []string          // Files of the payload, slash separated relative to it
+	checksums map[string]string // Checksums computed, by algorithm and path relative to the package
+}
+
+func (v *validator) errorf(check, path, format string, args ...any) {
+	v.report.Errors = append(v.report.Errors, Issue{Check: check, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// mismatchf records an error of files not matching a checksum or the Payload-Oxum.
+func (v *validator) mismatchf(check, path, format string, args ...any) {
+	v.report.Errors = append(v.report.Errors, Issue{Check: check, Path: path, Message: fmt.Sprintf(format, args...), Mismatch: true})
+}
+
+func (v *validator) warnf(check, path, format string, args ...any) {
+	v.report.Warnings = append(v.report.Warnings, Issue{Check: check, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) finish() *Report {
+	v.report.Valid = len(v.report.Errors) == 0
+	return v.report
+}
+
+// rel returns the path of a file of the payload relative to the package.
+func (v *validator) rel(payloadPath string) string {
+	if v.bag {
+		return path.Join("data", payloadPath)
+	}
+	return payloadPath
+}
+
+// checksum returns the checksum of a file of the package, computed once for each algorithm.
+func (v *validator) checksum(rel, algorithm string) (string, error) {
+	key := algorithm + "\x00" + rel
+	if sum, ok := v.checksums[key]; ok {
+		return sum, nil
+	}
+	sum, err := utils.FileChecksum(filepath.Join(v.root, filepath.FromSlash(rel)), algorithm)
+	if err != nil {
+		return "", err
+	}
+	v.checksums[key] = sum
+	return sum, nil
+}
+
+// metsFiles returns the METS files of the AIP at the root of the payload.
+func (v *validator) metsFiles() []string {
+	var mets []string
+	for _, file := range v.files {
+		if metsName.MatchString(file) {
+			mets = append(mets, file)
+		}
+	}
+	return mets
+}
+
+// checkStructure checks the layout of an A3M AIP: a single METS file named after the AIP UUID, the objects and the
+// logs.
+func (v *validator) checkStructure() {
+	mets := v.metsFiles()
+	switch len(mets) {
+	case 0:
+		v.errorf(CheckStructure, v.rel(""), "no METS.<uuid>.xml file")
+	case 1:
+		uuid := metsName.FindStringSubmatch(mets[0])[1]
+		if !strings.HasSuffix(strings.ToLower(filepath.Base(v.root)), strings.ToLower(uuid)) {
+			v.warnf(CheckStructure, v.rel(mets[0]), "AIP directory %s is not named after the UUID of the METS file", filepath.Base(v.root))
+		}
+	default:
+		v.errorf(CheckStructure, v.rel(""), "%d METS files, expected one: %s", len(mets), strings.Join(mets, ", "))
+	}
+	if !isDir(filepath.Join(v.payload, "objects")) {
+		v.errorf(CheckStructure, v.rel("objects"), "no objects directory")
+	} else if !slices.ContainsFunc(v.files, func(file string) bool { return strings.HasPrefix(file, "objects/") }) {
+		v.errorf(CheckStructure, v.rel("objects"), "objects directory is empty")
+	}
+	if !isDir(filepath.Join(v.payload, "logs")) {
+		v.warnf(CheckStructure, v.rel("logs"), "no logs directory")
+	}
+}
+
+// checkBag validates the bag: its declaration, the completeness and fixity of its payload against every payload
+// manifest, the tag manifests and the Payload-Oxum of bag-info.txt.
+func (v *validator) checkBag(ctx context.Context) {
+	if !v.bag {
+		v.errorf(CheckBagIt, "bagit.txt", "not a bag: no bagit.txt")
+		return
+	}
+	declaration, err := readTags(filepath.Join(v.root, "bagit.txt"))
+	if err != nil {
+		v.errorf(CheckBagIt, "bagit.txt", "%v", err)
+	}
+	for _, tag := range []string{"BagIt-Version", "Tag-File-Character-Encoding"} {
+		if err == nil && declaration[tag] == "" {
+			v.errorf(CheckBagIt, "bagit.txt", "missing %s", tag)
+		}
+	}
+	if !isDir(v.payload) {
+		v.errorf(CheckBagIt, "data", "no payload directory")
+		return
+	}
+
+	manifests, _ := filepath.Glob(filepath.Join(v.root, "manifest-*.txt"))
+	if len(manifests) == 0 {
+		v.errorf(CheckBagIt, "", "no payload manifest")
+	}
+	for _, manifest := range manifests {
+		listed := v.checkManifest(ctx, filepath.Base(manifest), true)
+		if listed == nil {
+			continue
+		}
+		for _, file := range v.files {
+			if !listed[v.rel(file)] {
+				v.errorf(CheckBagIt, v.rel(file), "payload file not listed in %s", filepath.Base(manifest))
+			}
+		}
+	}
+	tagManifests, _ := filepath.Glob(filepath.Join(v.root, "tagmanifest-*.txt"))
+	for _, manifest := range tagManifests {
+		v.checkManifest(ctx, filepath.Base(manifest), false)
+	}
+
+	if !exists(filepath.Join(v.root, "bag-info.txt")) {
+		return
+	}
+	info, err := readTags(filepath.Join(v.root, "bag-info.txt"))
+	if err != nil {
+		v.errorf(CheckBagIt, "bag-info.txt", "%v", err)
+		return
+	}
+	if oxum := info["Payload-Oxum"]; oxum != "" {
+		octets, count, ok := strings.Cut(oxum, ".")
+		wantOctets, err1 := strconv.ParseInt(octets, 10, 64)
+		wantCount, err2 := strconv.Atoi(count)
+		if !ok || err1 != nil || err2 != nil {
+			v.errorf(CheckBagIt, "bag-info.txt", "invalid Payload-Oxum %q", oxum)
+			return
+		}
+		var size int64
+		for _, file := range v.files {
+			if info, err := os.Stat(filepath.Join(v.payload, filepath.FromSlash(file))); err == nil {
+				size += info.Size()
+			}
+		}
+		if wantOctets != size || wantCount != len(v.files) {
+			v.mismatchf(CheckBagIt, "bag-info.txt", "Payload-Oxum %s does not match the payload: %d.%d", oxum, size, len(v.files))
+		}
+	}
+}
+
+// checkManifest checks that the files of a manifest exist and match their checksums. Payload manifests only list
+// files of the payload. Returns the listed files, nil if the manifest cannot be used.
+func (v *validator) checkManifest(ctx context.Context, name string, payload bool) map[string]bool {
+	algorithm := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(name, "tag"), "manifest-"), ".txt")
+	if !slices.Contains(utils.SupportedChecksumAlgorithms, algorithm) {
+		v.warnf(CheckBagIt, name, "unsupported checksum algorithm %s, manifest not checked", algorithm)
+		return nil
+	}
+	f, err := os.Open(filepath.Join(v.root, name))
+	if err != nil {
+		v.errorf(CheckBagIt, name, "%v", err)
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	listed := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			v.errorf(CheckBagIt, name, "line %d: expected a checksum and a path", line)
+			continue
+		}
+		// Paths can have spaces, and encode line breaks and percent signs
+		rel := strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+		rel = strings.NewReplacer("%0A", "\n", "%0a", "\n", "%0D", "\r", "%0d", "\r", "%25", "%").Replace(rel)
+		rel = path.Clean(strings.TrimPrefix(filepath.ToSlash(rel), "./"))
+		if !filepath.IsLocal(rel) {
+			v.errorf(CheckBagIt, name, "line %d: path %s is outside the bag", line, rel)
+			continue
+		}
+		if payload && !strings.HasPrefix(rel, "data/") {
+			v.errorf(CheckBagIt, name, "line %d: path %s is outside the payload", line, rel)
+			continue
+		}
+		listed[rel] = true
+		sum, err := v.checksum(rel, algorithm)
+		if errors.Is(err, fs.ErrNotExist) {
+			v.errorf(CheckBagIt, rel, "listed in %s but missing", name)
+			continue
+		}
+		if err != nil {
+			v.errorf(CheckBagIt, rel, "%v", err)
+			continue
+		}
+		if !strings.EqualFold(sum, fields[0]) {
+			v.mismatchf(CheckBagIt, rel, "%s checksum mismatch: expected %s, got %s", algorithm, fields[0], sum)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		v.errorf(CheckBagIt, name, "%v", err)
+		return nil
+	}
+	return listed
+}
+
+// metsDocument is what the METS check reads from a METS file.
+type metsDocument struct {
+	ids   map[string]bool // Identifiers of the elements
+	files []metsFile
+	refs  []metsRef // References to identifiers
+}
+
+type metsFile struct {
+	id, checksum, checksumType string
+	hrefs                      []string
+}
+
+type metsRef struct {
+	element, attr, id string
+}
+
+// checkMETS checks the references of the METS files: the files of the file section exist and match their checksums,
+// the structural maps and metadata references point to existing identifiers, and every object is in the file
+// section.
+func (v *validator) checkMETS(ctx context.Context) {
+	mets := v.metsFiles()
+	if len(mets) == 0 {
+		v.errorf(CheckMETS, v.rel(""), "no METS.<uuid>.xml file to check")
+		return
+	}
+	referenced := map[string]bool{}
+	for _, name := range mets {
+		doc, err := readMETS(filepath.Join(v.payload, filepath.FromSlash(name)))
+		if err != nil {
+			v.errorf(CheckMETS, v.rel(name), "%v", err)
+			continue
+		}
+		for _, file := range doc.files {
+			if len(file.hrefs) == 0 {
+				v.errorf(CheckMETS, v.rel(name), "file %s has no location", file.id)
+			}
+			for _, href := range file.hrefs {
+				if ctx.Err() != nil {
+					return
+				}
+				target := path.Clean(href)
+				if !filepath.IsLocal(target) {
+					v.errorf(CheckMETS, v.rel(name), "file %s is outside the AIP: %s", file.id, href)
+					continue
+				}
+				referenced[target] = true
+				if !exists(filepath.Join(v.payload, filepath.FromSlash(target))) {
+					v.errorf(CheckMETS, v.rel(target), "file %s of %s is missing", file.id, name)
+					continue
+				}
+				algorithm := strings.ReplaceAll(strings.ToLower(file.checksumType), "-", "")
+				if file.checksum == "" || !slices.Contains(utils.SupportedChecksumAlgorithms, algorithm) {
+					continue
+				}
+				sum, err := v.checksum(v.rel(target), algorithm)
+				if err != nil {
+					v.errorf(CheckMETS, v.rel(target), "%v", err)
+					continue
+				}
+				if !strings.EqualFold(sum, file.checksum) {
+					v.errorf(CheckMETS, v.rel(target), "%s checksum of file %s does not match %s: expected %s, got %s", algorithm, file.id, name, file.checksum, sum)
+				}
+			}
+		}
+		for _, ref := range doc.refs {
+			if !doc.ids[ref.id] {
+				v.errorf(CheckMETS, v.rel(name), "%s %s references unknown identifier %s", ref.element, ref.attr, ref.id)
+			}
+		}
+	}
+	for _, file := range v.files {
+		if strings.HasPrefix(file, "objects/") && !referenced[file] {
+			v.warnf(CheckMETS, v.rel(file), "object not in the file section of the METS file")
+		}
+	}
+}
+
+// readMETS reads the identifiers, files and references of a METS file. Elements are matched by local name, whatever
+// their namespace prefix.
+func readMETS(metsPath string) (*metsDocument, error) {
+	f, err := os.Open(filepath.Clean(metsPath))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	doc := &metsDocument{ids: map[string]bool{}}
+	var file *metsFile
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			attrs := map[string]string{}
+			for _, attr := range t.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			if id := attrs["ID"]; id != "" {
+				doc.ids[id] = true
+			}
+			for _, attr := range []string{"ADMID", "DMDID", "FILEID"} {
+				for _, id := range strings.Fields(attrs[attr]) {
+					doc.refs = append(doc.refs, metsRef{element: t.Name.Local, attr: attr, id: id})
+				}
+			}
+			switch t.Name.Local {
+			case "file":
+				doc.files = append(doc.files, metsFile{id: attrs["ID"], checksum: attrs["CHECKSUM"], checksumType: attrs["CHECKSUMTYPE"]})
+				file = &doc.files[len(doc.files)-1]
+			case "FLocat":
+				if file != nil && attrs["href"] != "" {
+					file.hrefs = append(file.hrefs, attrs["href"])
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "file" {
+				file = nil
+			}
+		}
+	}
+	if len(doc.ids) == 0 {
+		return nil, errors.New("not a METS document: no identified element")
+	}
+	return doc, nil
+}
+
+// packageRoot returns the directory holding bagit.txt: dir, or its only subdirectory, recursively. Returns dir if
+// there is no bag declaration.
+func packageRoot(dir string) string {
+	for current := dir; ; {
+		if exists(filepath.Join(current, "bagit.txt")) {
+			return current
+		}
+		entries, err := os.ReadDir(current)
+		if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+			break
+		}
+		current = filepath.Join(current, entries[0].Name())
+		if exists(filepath.Join(current, "bagit.txt")) || isDir(filepath.Join(current, "objects")) {
+			return current
+		}
+	}
+	return dir
+}
+
+// readTags reads the tags of a tag file, such as bagit.txt or bag-info.txt. Continuation lines, indented, are joined
+// to the value of their tag.
+func readTags(tagPath string) (map[string]string, error) {
+	f, err := os.Open(filepath.Clean(tagPath))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	tags := map[string]string{}
+	var last string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "\uFEFF")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			tags[last] += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag line %q", line)
+		}
+		last = strings.TrimSpace(name)
+		tags[last] = strings.TrimSpace(value)
+	}
+	return tags, scanner.Err()
+}
+
+// listFiles returns the regular files under root, slash separated relative to it.
+func listFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
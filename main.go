@@ -11,6 +11,6 @@ import (
 func main() {
 	if err := cmd.RootCmd.Execute(); err != nil {
 		logger.Error("Error executing command: %v", err)
-		os.Exit(1)
+		os.Exit(cmd.ExitUsage)
 	}
 }
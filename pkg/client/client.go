@@ -0,0 +1,177 @@
+// Package client is a Go client of the HTTP API of the preservation service, for integrators such as the Curate UI.
+// Its types and methods are generated from the OpenAPI document the service serves at /openapi.json.
+package client
+
+//go:generate go run ../../internal/openapi/clientgen -o client_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the API of a preservation service.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// Option configures a client.
+type Option func(*Client)
+
+// WithToken sets the bearer token of the requests, an API key or a token of the OpenID Connect provider.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient sets the HTTP client the requests are sent with, http.DefaultClient by default.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// New returns a client of the service at a base URL, e.g. http://localhost:6905.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is the error of a request the service did not accept.
+type Error struct {
+	StatusCode int    // HTTP status code of the response
+	Status     string // HTTP status of the response, e.g. "404 Not Found"
+	Message    string // Body of the response, or the detail of its problem
+	// Problem holds the problem details of invalid submissions, with the errors of their fields
+	Problem *Problem
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("service returned %s: %s", e.Status, e.Message)
+}
+
+// do sends a request with a JSON body if body is not nil, and decodes the JSON response into out if it is not nil.
+// An empty response leaves out unchanged. Responses with a status other than 2xx are returned as an *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	// Some routes only respond with a body for some requests, e.g. dry runs
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// send sends a request with a JSON body if body is not nil. Responses with a status other than 2xx are returned as
+// an *Error, the caller is responsible for closing the body of the others.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	apiErr := &Error{StatusCode: resp.StatusCode, Status: resp.Status}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/problem+json" {
+		problem := &Problem{}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(problem); err == nil {
+			apiErr.Problem = problem
+			apiErr.Message = problem.Detail
+			return nil, apiErr
+		}
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	apiErr.Message = strings.TrimSpace(string(msg))
+	return nil, apiErr
+}
+
+// GetJobArtifact calls GET /jobs/{id}/artifacts/{name}: Download an artifact of the package preserved by a job.
+// Requires the viewer role. The caller is responsible for closing the artifact.
+func (c *Client) GetJobArtifact(ctx context.Context, id string, name string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/jobs/"+escapePath(id)+"/artifacts/"+escapePath(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ExportAuditLogParams are the query parameters of ExportAuditLog.
+type ExportAuditLogParams struct {
+	// RFC 3339 time
+	Since string
+	// RFC 3339 time
+	Until    string
+	Username string
+	// Operation of the API, e.g. cancelJob
+	Action string
+	// success, denied or failure
+	Outcome string
+	// jsonl (JSON lines) or csv, jsonl by default
+	Format string
+}
+
+// ExportAuditLog calls GET /admin/audit/export: Export the entries of the audit log, oldest first. Requires the
+// admin role, and is not available to users bound to a tenant. The caller is responsible for closing the
+// export.
+func (c *Client) ExportAuditLog(ctx context.Context, params *ExportAuditLogParams) (io.ReadCloser, error) {
+	query := url.Values{}
+	if params != nil {
+		for name, value := range map[string]string{
+			"since": params.Since, "until": params.Until, "username": params.Username, "action": params.Action,
+			"outcome": params.Outcome, "format": params.Format,
+		} {
+			if value != "" {
+				query.Set(name, value)
+			}
+		}
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/admin/audit/export", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// escapePath escapes a value for a segment of a path, slashes included.
+func escapePath(v string) string {
+	return url.PathEscape(v)
+}
@@ -0,0 +1,9 @@
+package config
+
+// AccessCopyConfig configures the upload of DIP access copies to Cells and the share link created for them.
+type AccessCopyConfig struct {
+	Destination  string `json:"destination" validate:"required" comment:"Cells folder the access copies are uploaded to, e.g. common-files/Access Copies"`
+	ShareLink    bool   `json:"share_link,omitempty" comment:"Create a public share link for the uploaded access copies"`
+	ExpireDays   int    `json:"expire_days,omitempty" validate:"min=0" comment:"Days until the share link expires (0 never expires)"`
+	MaxDownloads int    `json:"max_downloads,omitempty" validate:"min=0" comment:"Maximum number of downloads of the share link (0 is unlimited)"`
+}
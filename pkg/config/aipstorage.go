@@ -0,0 +1,211 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+)
+
+const (
+	// StorageBackendLocal stores AIPs in a local (or mounted) directory.
+	StorageBackendLocal = "local"
+	// StorageBackendS3 stores AIPs in an S3 compatible bucket (AWS, MinIO, Wasabi).
+	StorageBackendS3 = "s3"
+	// StorageBackendAzure stores AIPs as block blobs in an Azure Blob Storage container.
+	StorageBackendAzure = "azure"
+	// StorageBackendGCS stores AIPs in a Google Cloud Storage bucket.
+	StorageBackendGCS = "gcs"
+	// StorageBackendRclone stores AIPs in any remote supported by rclone, with the rclone command.
+	StorageBackendRclone = "rclone"
+
+	// StorageLayoutFlat stores each AIP under <prefix>/<aip uuid>/. This is the default.
+	StorageLayoutFlat = "flat"
+	// StorageLayoutQuad stores each AIP under <prefix>/<uuid split in quads>/, like the Archivematica Storage Service.
+	StorageLayoutQuad = "quad"
+
+	// StorageTierHot is the tier for frequently read AIPs (Azure Hot, S3 and GCS STANDARD).
+	StorageTierHot = "hot"
+	// StorageTierCool is the tier for infrequently read AIPs (Azure Cool, S3 STANDARD_IA, GCS NEARLINE).
+	StorageTierCool = "cool"
+	// StorageTierCold is the tier for rarely read AIPs (Azure Cold, S3 GLACIER_IR, GCS COLDLINE).
+	StorageTierCold = "cold"
+	// StorageTierArchive is the offline tier (Azure Archive, S3 GLACIER or DEEP_ARCHIVE, GCS ARCHIVE).
+	// Archived AIPs in Azure and S3 must be restored before they can be read.
+	StorageTierArchive = "archive"
+
+	defaultRestoreDays         = 7
+	defaultRestorePollMinutes  = 15
+	defaultRestoreTimeoutHours = 72
+)
+
+// StorageLayouts are the layouts of the stored AIPs, the default first.
+var StorageLayouts = []string{StorageLayoutFlat, StorageLayoutQuad}
+
+// AIPStorageConfig holds the storage locations AIPs are replicated to once they are stored in Cells.
+type AIPStorageConfig struct {
+	Locations []*StorageLocation `json:"locations" validate:"required,min=1,dive" comment:"AIP storage locations"`
+}
+
+// StorageLocation is a location AIPs are stored in. Only the settings of its backend are used.
+type StorageLocation struct {
+	Name    string              `json:"name" validate:"required" comment:"Name of the location"`
+	Backend string              `json:"backend" validate:"required,oneof=local s3 azure gcs rclone" comment:"Storage backend (local, s3, azure, gcs, rclone)"`
+	Prefix  string              `json:"prefix,omitempty" comment:"Path prefix of the stored AIPs"`
+	Layout  string              `json:"layout,omitempty" validate:"omitempty,oneof=flat quad" comment:"Layout of the stored AIPs below the prefix (flat, quad)"`
+	Local   *LocalStorageConfig `json:"local,omitempty" validate:"required_if=Backend local" comment:"Local directory settings"`
+	S3      *S3StorageConfig    `json:"s3,omitempty" validate:"required_if=Backend s3" comment:"S3 bucket settings"`
+	Azure   *AzureStorageConfig `json:"azure,omitempty" validate:"required_if=Backend azure" comment:"Azure Blob Storage container settings"`
+	GCS     *GCSStorageConfig   `json:"gcs,omitempty" validate:"required_if=Backend gcs" comment:"Google Cloud Storage bucket settings"`
+	Rclone  *RcloneConfig       `json:"rclone,omitempty" validate:"required_if=Backend rclone" comment:"rclone remote settings"`
+}
+
+// LocalStorageConfig holds the settings of a local storage location.
+type LocalStorageConfig struct {
+	Dir string `json:"dir" validate:"required" comment:"Directory the AIPs are stored in"`
+}
+
+// S3StorageConfig holds the settings of an S3 compatible storage location.
+// Without an access key, credentials are read from the AWS environment variables, credentials file or instance role.
+type S3StorageConfig struct {
+	Endpoint        string `json:"endpoint,omitempty" comment:"S3 endpoint (host[:port]), defaults to AWS"`
+	Region          string `json:"region,omitempty" comment:"Bucket region"`
+	Bucket          string `json:"bucket" validate:"required" comment:"Bucket name"`
+	AccessKeyID     string `json:"access_key_id,omitempty" comment:"Access key ID"`
+	SecretAccessKey string `json:"secret_access_key,omitempty" validate:"required_with=AccessKeyID" comment:"Secret access key"`
+	Insecure        bool   `json:"insecure,omitempty" comment:"Connect over plain HTTP (development only)"`
+	PathStyle       bool   `json:"path_style,omitempty" comment:"Use path style bucket addressing (MinIO)"`
+	StorageClass    string `json:"storage_class,omitempty" comment:"Storage class of the stored objects, e.g. STANDARD_IA"`
+	PartSizeMB      int    `json:"part_size_mb,omitempty" validate:"omitempty,min=5" comment:"Multipart upload part size in MiB (default 64)"`
+	ArchiveClass    string `json:"archive_class,omitempty" validate:"omitempty,oneof=GLACIER DEEP_ARCHIVE" comment:"Storage class of the archive tier (GLACIER, DEEP_ARCHIVE), default GLACIER"`
+	// Restore of objects in the GLACIER and DEEP_ARCHIVE storage classes
+	Restore *S3RestoreConfig `json:"restore,omitempty" comment:"Restore of archived objects"`
+}
+
+// S3RestoreConfig holds the settings of the restore of archived S3 objects before they are read.
+type S3RestoreConfig struct {
+	Days         int    `json:"days,omitempty" validate:"omitempty,min=1" comment:"Days the restored copies are kept (default 7)"`
+	Tier         string `json:"tier,omitempty" validate:"omitempty,oneof=Standard Bulk Expedited" comment:"Retrieval tier (Standard, Bulk, Expedited), default Standard"`
+	PollMinutes  int    `json:"poll_minutes,omitempty" validate:"omitempty,min=1" comment:"Minutes between restore status checks (default 15)"`
+	TimeoutHours int    `json:"timeout_hours,omitempty" validate:"omitempty,min=1" comment:"Hours to wait for a restore (default 72)"`
+}
+
+// RestoreDays returns the number of days restored copies are kept.
+func (r *S3RestoreConfig) RestoreDays() int {
+	if r == nil || r.Days == 0 {
+		return defaultRestoreDays
+	}
+	return r.Days
+}
+
+// RetrievalTier returns the retrieval tier of restores.
+func (r *S3RestoreConfig) RetrievalTier() string {
+	if r == nil || r.Tier == "" {
+		return "Standard"
+	}
+	return r.Tier
+}
+
+// PollInterval returns the time between restore status checks.
+func (r *S3RestoreConfig) PollInterval() time.Duration {
+	if r == nil || r.PollMinutes == 0 {
+		return defaultRestorePollMinutes * time.Minute
+	}
+	return time.Duration(r.PollMinutes) * time.Minute
+}
+
+// Timeout returns how long to wait for a restore to complete.
+func (r *S3RestoreConfig) Timeout() time.Duration {
+	if r == nil || r.TimeoutHours == 0 {
+		return defaultRestoreTimeoutHours * time.Hour
+	}
+	return time.Duration(r.TimeoutHours) * time.Hour
+}
+
+// AzureStorageConfig holds the settings of an Azure Blob Storage location.
+// Either a connection string or an account name and key are required.
+type AzureStorageConfig struct {
+	ConnectionString string `json:"connection_string,omitempty" comment:"Storage account connection string"`
+	AccountName      string `json:"account_name,omitempty" validate:"required_without=ConnectionString" comment:"Storage account name"`
+	AccountKey       string `json:"account_key,omitempty" validate:"required_without=ConnectionString" comment:"Storage account key"`
+	Endpoint         string `json:"endpoint,omitempty" validate:"omitempty,url" comment:"Blob service URL, defaults to https://<account>.blob.core.windows.net/"`
+	Container        string `json:"container" validate:"required" comment:"Container name"`
+	AccessTier       string `json:"access_tier,omitempty" validate:"omitempty,oneof=hot cool cold archive" comment:"Default access tier of the stored blobs (hot, cool, cold, archive)"`
+	BlockSizeMB      int    `json:"block_size_mb,omitempty" validate:"omitempty,min=1,max=4000" comment:"Block size in MiB (default 8)"`
+}
+
+// GCSStorageConfig holds the settings of a Google Cloud Storage location.
+// Without a credentials file, the application default credentials are used.
+type GCSStorageConfig struct {
+	Bucket          string `json:"bucket" validate:"required" comment:"Bucket name"`
+	CredentialsFile string `json:"credentials_file,omitempty" comment:"Service account key file"`
+	Endpoint        string `json:"endpoint,omitempty" validate:"omitempty,url" comment:"Storage API endpoint, e.g. of an emulator (development only)"`
+	StorageClass    string `json:"storage_class,omitempty" comment:"Storage class of the stored objects, e.g. NEARLINE"`
+	ChunkSizeMB     int    `json:"chunk_size_mb,omitempty" validate:"omitempty,min=1" comment:"Resumable upload chunk size in MiB (default 16)"`
+}
+
+// RcloneConfig holds the settings of an rclone remote, used by rclone storage locations and transfer sources.
+// The remote is defined in the rclone config file, on the fly, or with options set as environment variables.
+type RcloneConfig struct {
+	Remote     string            `json:"remote" validate:"required,contains=:" comment:"Remote and root path, e.g. b2:example-preservation/aips or :sftp,host=nas.example.org:/aips"`
+	Binary     string            `json:"binary,omitempty" comment:"rclone command (default rclone)"`
+	ConfigFile string            `json:"config_file,omitempty" comment:"rclone config file the remote is defined in, defaults to rclone's"`
+	Options    map[string]string `json:"options,omitempty" comment:"Options of the named remote, e.g. type and credentials, passed as RCLONE_CONFIG_<REMOTE>_<OPTION>"`
+	Flags      []string          `json:"flags,omitempty" comment:"Extra rclone flags, e.g. --transfers=8 or --bwlimit=10M"`
+}
+
+// Validate validates the AIPStorageConfig.
+func (a *AIPStorageConfig) Validate() error {
+	if err := validator.New().Struct(a); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, location := range a.Locations {
+		if names[location.Name] {
+			return fmt.Errorf("duplicate storage location: %s", location.Name)
+		}
+		names[location.Name] = true
+	}
+	return nil
+}
+
+// Location returns the storage location with the given name, or nil if it does not exist.
+func (a *AIPStorageConfig) Location(name string) *StorageLocation {
+	for _, location := range a.Locations {
+		if location.Name == name {
+			return location
+		}
+	}
+	return nil
+}
+
+// LoadAIPStorageConfig loads the AIP storage configuration from a file.
+// Returns nil if the file does not exist, in which case AIPs are only stored in Cells.
+func LoadAIPStorageConfig(path string) (*AIPStorageConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg AIPStorageConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid AIP storage config: %w", err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+)
+
+// ArchivesSpaceConfig holds the configuration for registering AIPs as ArchivesSpace digital objects.
+type ArchivesSpaceConfig struct {
+	URL          string                              `json:"url" validate:"required,url" comment:"ArchivesSpace backend API URL"`
+	Username     string                              `json:"username" validate:"required" comment:"ArchivesSpace username"`
+	Password     string                              `json:"password" validate:"required" comment:"ArchivesSpace password"`
+	Repositories map[string]*ArchivesSpaceRepository `json:"repositories,omitempty" validate:"dive" comment:"Settings by ArchivesSpace repository ID"`
+}
+
+// ArchivesSpaceRepository holds the digital object settings of an ArchivesSpace repository.
+type ArchivesSpaceRepository struct {
+	FileURIBase string `json:"file_uri_base,omitempty" validate:"omitempty,url" comment:"Base URI prepended to the Cells path of the AIP for file versions"`
+	Publish     bool   `json:"publish,omitempty" comment:"Publish created digital objects"`
+	Rights      string `json:"rights,omitempty" comment:"Default use restrictions when the package has no dc.rights"`
+	Disabled    bool   `json:"disabled,omitempty" comment:"Do not create digital objects in this repository"`
+}
+
+// Validate validates the ArchivesSpaceConfig.
+func (a *ArchivesSpaceConfig) Validate() error {
+	return validator.New().Struct(a)
+}
+
+// Repository returns the settings of a repository, or the zero settings if it isn't configured.
+func (a *ArchivesSpaceConfig) Repository(id string) ArchivesSpaceRepository {
+	if repo, ok := a.Repositories[id]; ok && repo != nil {
+		return *repo
+	}
+	return ArchivesSpaceRepository{}
+}
+
+// LoadArchivesSpaceConfig loads the ArchivesSpace configuration from a file.
+// Returns nil if the file does not exist, in which case the integration is disabled.
+func LoadArchivesSpaceConfig(path string) (*ArchivesSpaceConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg ArchivesSpaceConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid ArchivesSpace config: %w", err)
+	}
+	return &cfg, nil
+}
@@ -10,6 +10,17 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+)
+
+const (
+	// DescriptionModeOff deposits DIPs under the target description as is. This is the default.
+	DescriptionModeOff = "off"
+	// DescriptionModeCreate creates a description for the package below the target description, or updates it if it
+	// already exists, and deposits the DIP under it.
+	DescriptionModeCreate = "create"
+	// DescriptionModeUpdate updates the target description from the package metadata.
+	DescriptionModeUpdate = "update"
 )
 
 // AtomConfig holds the configuration for the AtoM service.
@@ -18,10 +29,15 @@ type AtomConfig struct {
 	APIKey        string `json:"api_key,omitempty" validate:"required" comment:"AtoM API key for authentication"`
 	LoginEmail    string `json:"login_email,omitempty" validate:"required,email" comment:"AtoM login email"`
 	LoginPassword string `json:"login_password,omitempty" validate:"required" comment:"AtoM login password"`
-	RsyncTarget   string `json:"rsync_target,omitempty" validate:"required" comment:"Rsync target for DIP transfer"`
+	RsyncTarget   string `json:"rsync_target,omitempty" validate:"required_unless=DeliveryMethod sftp" comment:"Rsync target for DIP transfer"`
 	RsyncCommand  string `json:"rsync_command,omitempty" comment:"Custom rsync command (optional)"`
 	Slug          string `json:"slug,omitempty" validate:"required" comment:"AtoM digital object slug"`
 
+	DeliveryMethod string      `json:"delivery_method,omitempty" validate:"omitempty,oneof=rsync sftp" comment:"DIP delivery method (rsync, sftp). Defaults to rsync"`
+	SFTP           *SFTPConfig `json:"sftp,omitempty" validate:"required_if=DeliveryMethod sftp" comment:"SFTP target for DIP delivery"`
+
+	DescriptionMode string `json:"description_mode,omitempty" validate:"omitempty,oneof=off create update" comment:"Describe packages in AtoM from their metadata (off, create, update). Defaults to off"`
+
 	mu sync.RWMutex // Mutex for thread-safe access
 }
 
@@ -63,6 +79,9 @@ func LoadAtomConfig(path string) (*AtomConfig, error) {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("unmarshaling config: %w", err)
 	}
+	if err := secrets.Resolve(&config); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
@@ -96,10 +115,78 @@ func (a *AtomConfig) MergeWithFile(path string) error {
 	if a.RsyncCommand == "" {
 		a.RsyncCommand = fileConfig.RsyncCommand
 	}
+	if a.DeliveryMethod == "" {
+		a.DeliveryMethod = fileConfig.DeliveryMethod
+	}
+	if a.SFTP == nil {
+		a.SFTP = fileConfig.SFTP
+	}
+	if a.DescriptionMode == "" {
+		a.DescriptionMode = fileConfig.DescriptionMode
+	}
 
 	return nil
 }
 
+// ApplyTarget overrides the connection settings with the non-empty values of an AtoM target.
+// The target slug is only used when no slug is set.
+func (a *AtomConfig) ApplyTarget(target *AtomConfig) {
+	if target == nil {
+		return
+	}
+	target.mu.RLock()
+	defer target.mu.RUnlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&a.Host, target.Host},
+		{&a.APIKey, target.APIKey},
+		{&a.LoginEmail, target.LoginEmail},
+		{&a.LoginPassword, target.LoginPassword},
+		{&a.RsyncTarget, target.RsyncTarget},
+		{&a.RsyncCommand, target.RsyncCommand},
+		{&a.DeliveryMethod, target.DeliveryMethod},
+		{&a.DescriptionMode, target.DescriptionMode},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if target.SFTP != nil {
+		a.SFTP = target.SFTP.Clone()
+	}
+	if a.Slug == "" {
+		a.Slug = target.Slug
+	}
+}
+
+// Clone returns a copy of the config that can be modified independently.
+func (a *AtomConfig) Clone() *AtomConfig {
+	if a == nil {
+		return DefaultAtomConfig()
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return &AtomConfig{
+		Host:          a.Host,
+		APIKey:        a.APIKey,
+		LoginEmail:    a.LoginEmail,
+		LoginPassword: a.LoginPassword,
+		RsyncTarget:   a.RsyncTarget,
+		RsyncCommand:  a.RsyncCommand,
+		Slug:          a.Slug,
+
+		DeliveryMethod: a.DeliveryMethod,
+		SFTP:           a.SFTP.Clone(),
+
+		DescriptionMode: a.DescriptionMode,
+	}
+}
+
 // GetAtomConfig loads the AtoM configuration with proper priority:
 // 1. CLI flags (highest priority)
 // 2. Config file
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// RoleViewer can read package records and look up archival descriptions.
+	RoleViewer = "viewer"
+	// RoleSubmitter can also submit preservations and upload transfers.
+	RoleSubmitter = "submitter"
+	// RoleOperator can also cancel jobs.
+	RoleOperator = "operator"
+	// RoleAdmin can use every endpoint.
+	RoleAdmin = "admin"
+
+	// defaultRolesClaim is the claim holding the groups or roles of a user.
+	defaultRolesClaim = "roles"
+	// defaultUsernameClaim is the claim identifying the user in logs.
+	defaultUsernameClaim = "preferred_username"
+)
+
+// Roles lists the API roles, each granting the permissions of the previous ones.
+var Roles = []string{RoleViewer, RoleSubmitter, RoleOperator, RoleAdmin}
+
+// AuthConfig holds the OpenID Connect provider whose bearer tokens are accepted by the HTTP API.
+type AuthConfig struct {
+	Issuer        string   `json:"issuer" validate:"required,http_url" comment:"Issuer URL of the OpenID Connect provider, discovered at /.well-known/openid-configuration"`
+	Audiences     []string `json:"audiences" validate:"required,min=1" comment:"Accepted audiences (client IDs) of the tokens"`
+	RolesClaim    string   `json:"roles_claim,omitempty" comment:"Claim holding the groups or roles of the user, nested claims separated by dots (default roles)"`
+	UsernameClaim string   `json:"username_claim,omitempty" comment:"Claim identifying the user in logs (default preferred_username)"`
+	TenantClaim   string   `json:"tenant_claim,omitempty" comment:"Claim holding the tenant of the user, nested claims separated by dots (default none, users see every tenant)"`
+	// Roles maps each API role to the claim values granting it
+	Roles       map[string][]string `json:"roles" validate:"required,min=1,dive,keys,oneof=viewer submitter operator admin,endkeys,min=1" comment:"Claim values granting each role (viewer, submitter, operator, admin)"`
+	DefaultRole string              `json:"default_role,omitempty" validate:"omitempty,oneof=viewer submitter operator admin" comment:"Role of authenticated users without a mapped claim value (default none)"`
+	// GlobalRoles are the claim values letting users without a tenant claim use the whole service when there are
+	// tenants, other users without one are refused
+	GlobalRoles []string `json:"global_roles,omitempty" comment:"Claim values of the roles claim granting users without a tenant claim the whole service, when there are tenants (default none)"`
+}
+
+// Validate validates the AuthConfig.
+func (a *AuthConfig) Validate() error {
+	return validator.New().Struct(a)
+}
+
+// ClaimRoles returns the roles claim, defaulting to roles.
+func (a *AuthConfig) ClaimRoles() string {
+	if a.RolesClaim == "" {
+		return defaultRolesClaim
+	}
+	return a.RolesClaim
+}
+
+// ClaimUsername returns the username claim, defaulting to preferred_username.
+func (a *AuthConfig) ClaimUsername() string {
+	if a.UsernameClaim == "" {
+		return defaultUsernameClaim
+	}
+	return a.UsernameClaim
+}
+
+// RoleFor returns the highest role granted by the given claim values, or the default role.
+func (a *AuthConfig) RoleFor(values []string) string {
+	role := a.DefaultRole
+	for _, r := range Roles {
+		for _, value := range a.Roles[r] {
+			if slices.Contains(values, value) {
+				role = r
+			}
+		}
+	}
+	return role
+}
+
+// GrantsGlobal reports whether the given claim values let a user without a tenant claim use the whole service.
+func (a *AuthConfig) GrantsGlobal(values []string) bool {
+	return slices.ContainsFunc(values, func(value string) bool { return slices.Contains(a.GlobalRoles, value) })
+}
+
+// HasRole reports whether a role grants the permissions of the required role.
+func HasRole(role, required string) bool {
+	return role != "" && slices.Index(Roles, role) >= slices.Index(Roles, required)
+}
+
+// LoadAuthConfig loads the OpenID Connect settings of the HTTP API from a file.
+// Returns nil if the file does not exist, in which case the API is not authenticated.
+func LoadAuthConfig(path string) (*AuthConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg AuthConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+	return &cfg, nil
+}
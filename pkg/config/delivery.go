@@ -0,0 +1,30 @@
+package config
+
+const (
+	// DeliveryRsync delivers DIPs to the AtoM host with rsync. This is the default.
+	DeliveryRsync = "rsync"
+	// DeliverySFTP delivers DIPs to the AtoM host over SFTP.
+	DeliverySFTP = "sftp"
+)
+
+// SFTPConfig holds the SFTP target and credentials for DIP delivery.
+// One of Password or PrivateKeyPath must be set.
+type SFTPConfig struct {
+	Address               string `json:"address,omitempty" validate:"required,hostname_port" comment:"SFTP server address (host:port)"`
+	Username              string `json:"username,omitempty" validate:"required" comment:"SFTP username"`
+	Password              string `json:"password,omitempty" validate:"required_without=PrivateKeyPath" comment:"SFTP password"`
+	PrivateKeyPath        string `json:"private_key_path,omitempty" validate:"required_without=Password" comment:"Path to the SSH private key"`
+	PrivateKeyPassphrase  string `json:"private_key_passphrase,omitempty" comment:"Passphrase of the SSH private key"`
+	KnownHostsPath        string `json:"known_hosts_path,omitempty" validate:"required_without=InsecureIgnoreHostKey" comment:"Path to the known_hosts file used to verify the server"`
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key,omitempty" comment:"Skip server host key verification (development only)"`
+	RemoteDir             string `json:"remote_dir,omitempty" validate:"required" comment:"AtoM uploads directory watched for DIPs"`
+}
+
+// Clone returns a copy of the config.
+func (s *SFTPConfig) Clone() *SFTPConfig {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	return &clone
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
 	"github.com/spf13/viper"
 )
 
@@ -30,79 +32,744 @@ type Config struct {
 		CecPath          string `mapstructure:"cec_path" validate:"file" comment:"Cells cec binary path"`
 	} `mapstructure:"cells"`
 
+	Events struct {
+		Enabled     bool          `mapstructure:"enabled" comment:"Preserve packages uploaded into the watched Cells folders"`
+		Paths       []string      `mapstructure:"paths" validate:"required_if=Enabled true" comment:"Watched Cells folders (resolved paths, e.g. common-files/preserve). Each folder or file created inside is a package"`
+		Username    string        `mapstructure:"username" validate:"required_if=Enabled true" comment:"Cells user the triggered preservations run as"`
+		Profile     string        `mapstructure:"profile" comment:"Processing profile of the triggered preservations. Empty selects the profile by path"`
+		SettleDelay time.Duration `mapstructure:"settle_delay" comment:"Time without new events before an uploaded package is preserved"`
+	} `mapstructure:"events"`
+
+	// Local hot folder the transfers dropped into are preserved from
+	HotFolder struct {
+		Enabled      bool          `mapstructure:"enabled" comment:"Preserve the transfers dropped into the hot folder"`
+		Dir          string        `mapstructure:"dir" validate:"required_if=Enabled true" comment:"Watched local directory. Each folder or file created inside is a transfer"`
+		Destination  string        `mapstructure:"destination" validate:"required_if=Enabled true" comment:"Cells folder the transfers are copied to and preserved from"`
+		Username     string        `mapstructure:"username" validate:"required_if=Enabled true" comment:"Cells user the transfers are copied and preserved as"`
+		Profile      string        `mapstructure:"profile" comment:"Processing profile of the transfers. Empty selects the profile by path"`
+		SettleDelay  time.Duration `mapstructure:"settle_delay" validate:"min=0" comment:"Time a transfer must stay unchanged before it is submitted"`
+		PollInterval time.Duration `mapstructure:"poll_interval" validate:"min=1s" comment:"Interval at which the hot folder is scanned"`
+		ProcessedDir string        `mapstructure:"processed_dir" comment:"Directory preserved transfers are moved to (defaults to <dir>/processed)"`
+		FailedDir    string        `mapstructure:"failed_dir" comment:"Directory failed transfers are moved to (defaults to <dir>/failed)"`
+	} `mapstructure:"hot_folder"`
+
+	Queue struct {
+		Backend string `mapstructure:"backend" validate:"oneof=memory sqlite postgres nats" comment:"Job queue of watched uploads and intake transfers (memory, sqlite, postgres, nats)"`
+		SQLite  struct {
+			Path string `mapstructure:"path" comment:"SQLite database of the jobs. Empty uses jobs.db in the data directory"`
+		} `mapstructure:"sqlite"`
+		Postgres struct {
+			URL   string        `mapstructure:"url" comment:"Postgres connection URL"`
+			Lease time.Duration `mapstructure:"lease" validate:"min=30s" comment:"Time without progress before a job is run again by another instance"`
+		} `mapstructure:"postgres"`
+		NATS struct {
+			URL             string        `mapstructure:"url" comment:"NATS server URLs, comma separated"`
+			CredsFile       string        `mapstructure:"creds_file" comment:"NATS user credentials file"`
+			Stream          string        `mapstructure:"stream" comment:"JetStream stream holding the jobs"`
+			Subject         string        `mapstructure:"subject" comment:"Subject the jobs are published to"`
+			Consumer        string        `mapstructure:"consumer" comment:"Durable consumer shared by the service instances"`
+			Replicas        int           `mapstructure:"replicas" validate:"min=0,max=5" comment:"Stream replicas in a NATS cluster"`
+			AckWait         time.Duration `mapstructure:"ack_wait" validate:"min=30s" comment:"Time without progress before a job is redelivered to another instance"`
+			MaxDeliver      int           `mapstructure:"max_deliver" validate:"min=-1" comment:"Deliveries of a job before it is given up (-1 unlimited)"`
+			DuplicateWindow time.Duration `mapstructure:"duplicate_window" comment:"Window in which a job with the same ID is only queued once"`
+		} `mapstructure:"nats"`
+		PriorityAging time.Duration `mapstructure:"priority_aging" comment:"Wait after which a job is run before the jobs queued since with a priority one level higher (0 for strict priorities)"`
+	} `mapstructure:"queue"`
+
+	// Retry policies of failed jobs, and of the stages of the pipeline on transient errors
+	Retry struct {
+		Jobs          RetryPolicy `mapstructure:"jobs" comment:"Packages failing with a transient error, preserved again from the start"`
+		Download      RetryPolicy `mapstructure:"download" comment:"Package downloads from Cells and transfer sources"`
+		Packaging     RetryPolicy `mapstructure:"packaging" comment:"Package submissions to A3M"`
+		Storage       RetryPolicy `mapstructure:"storage" comment:"AIP writes to the AIP storage locations"`
+		Dissemination RetryPolicy `mapstructure:"dissemination" comment:"DIP deposits to AtoM"`
+	} `mapstructure:"retry"`
+
+	// Concurrency limits, 0 for no limit. They can be changed while the service runs with the admin API
+	Concurrency struct {
+		Global        int `mapstructure:"global" validate:"min=0" comment:"Packages preserved at the same time"`
+		Download      int `mapstructure:"download" validate:"min=0" comment:"Package downloads from Cells and transfer sources"`
+		Preprocessing int `mapstructure:"preprocessing" validate:"min=0" comment:"Transfer constructions and virus scans"`
+		Normalization int `mapstructure:"normalization" validate:"min=0" comment:"Packages processed by A3M"`
+		Extraction    int `mapstructure:"extraction" validate:"min=0" comment:"Extractions of the AIPs generated by A3M"`
+		Compression   int `mapstructure:"compression" validate:"min=0" comment:"AIP compressions"`
+		Storage       int `mapstructure:"storage" validate:"min=0" comment:"AIP uploads to Cells and the AIP storage locations"`
+		Dissemination int `mapstructure:"dissemination" validate:"min=0" comment:"DIP migrations and deposits to AtoM"`
+	} `mapstructure:"concurrency"`
+
+	Shutdown struct {
+		DrainTimeout time.Duration `mapstructure:"drain_timeout" validate:"min=0" comment:"Time running preservations have to complete on shutdown before they are interrupted and queued again"`
+	} `mapstructure:"shutdown"`
+
+	// Reloads of the configuration in serve mode, on SIGHUP and when the files change
+	ConfigReload struct {
+		Interval time.Duration `mapstructure:"interval" validate:"min=0" comment:"Interval at which the .env and config files are checked for changes (0 only reloads on SIGHUP)"`
+	} `mapstructure:"config_reload"`
+
+	// Dependency checks of the readiness endpoint
+	Health struct {
+		Timeout        time.Duration `mapstructure:"timeout" validate:"min=1s" comment:"Time each dependency check has to complete"`
+		CacheTTL       time.Duration `mapstructure:"cache_ttl" validate:"min=0" comment:"Time a readiness report is reused, so that frequent probes don't load the dependencies"`
+		MinFreeSpaceGB int           `mapstructure:"min_free_space_gb" validate:"min=0" comment:"Free space in GiB the processing and data directories need to be ready (0 disables the check)"`
+	} `mapstructure:"health"`
+
+	// Recurring tasks of serve mode, from the schedules file and the admin API
+	Scheduler struct {
+		Enabled           bool     `mapstructure:"enabled" comment:"Run the scheduled tasks in serve mode. Enable it on a single instance"`
+		ConfigPath        string   `mapstructure:"config_path" comment:"Path to schedules file"`
+		Path              string   `mapstructure:"path" comment:"SQLite database of the schedules created with the API and of the run history (defaults to <data_dir>/schedules.db)"`
+		HistoryLimit      int      `mapstructure:"history_limit" validate:"min=1" comment:"Runs kept in the history of each schedule"`
+		SignatureCommands []string `mapstructure:"signature_commands" comment:"Commands run by the signature update task, e.g. freshclam --quiet"`
+	} `mapstructure:"scheduler"`
+
 	Atom struct {
 		ConfigPath string `mapstructure:"config_path" comment:"Path to AtoM configuration file"`
 	} `mapstructure:"atom"`
 
+	ArchivesSpace struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to ArchivesSpace configuration file"`
+	} `mapstructure:"archivesspace"`
+
+	StorageService struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to Archivematica Storage Service configuration file"`
+	} `mapstructure:"storage_service"`
+
+	AIPStorage struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to AIP storage locations file"`
+	} `mapstructure:"aip_storage"`
+
+	Repositories struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to access repositories file"`
+	} `mapstructure:"repositories"`
+
+	Sources struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to transfer sources file"`
+	} `mapstructure:"sources"`
+
+	Notifications struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to notifications file"`
+	} `mapstructure:"notifications"`
+
+	Tenants struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to tenants file of serve mode"`
+	} `mapstructure:"tenants"`
+
+	Quotas struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to quotas file of the tenants and Cells workspaces"`
+	} `mapstructure:"quotas"`
+
+	Auth struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to OpenID Connect authentication file of the HTTP API"`
+		APIKeys    struct {
+			Enabled bool   `mapstructure:"enabled" comment:"Accept API keys as bearer tokens, and require authentication even without an OpenID Connect provider"`
+			Path    string `mapstructure:"path" comment:"SQLite database of the API keys (defaults to <data_dir>/api_keys.db)"`
+		} `mapstructure:"api_keys"`
+	} `mapstructure:"auth"`
+
+	// HTTPS of the HTTP API, served over plain HTTP without a certificate
+	TLS struct {
+		CertFile       string        `mapstructure:"cert_file" validate:"required_with=KeyFile" comment:"Certificate file of the HTTP API, with its intermediates"`
+		KeyFile        string        `mapstructure:"key_file" validate:"required_with=CertFile" comment:"Private key file of the certificate"`
+		ReloadInterval time.Duration `mapstructure:"reload_interval" validate:"min=0" comment:"Interval at which renewed certificates are reloaded (0 disables reloads)"`
+		ClientAuth     string        `mapstructure:"client_auth" validate:"oneof=none optional require" comment:"Client certificate verification: none, optional or require"`
+		ClientCAFile   string        `mapstructure:"client_ca_file" comment:"CA certificates client certificates are verified against"`
+		ClientRole     string        `mapstructure:"client_role" validate:"omitempty,oneof=viewer submitter operator admin" comment:"API role of callers with a verified client certificate and no bearer token (default none)"`
+	} `mapstructure:"tls"`
+
+	// Token buckets of the submission endpoints, per API key, user or client address
+	RateLimit struct {
+		Enabled        bool          `mapstructure:"enabled" comment:"Limit the requests of each client to the submission endpoints"`
+		Requests       int           `mapstructure:"requests" validate:"min=1" comment:"Requests a client can send per period"`
+		Period         time.Duration `mapstructure:"period" validate:"min=1s" comment:"Period of the request rate"`
+		Burst          int           `mapstructure:"burst" validate:"min=1" comment:"Requests a client can send at once, after being idle"`
+		TrustedProxies []string      `mapstructure:"trusted_proxies" validate:"dive,cidr|ip" comment:"Addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For header gives the client address"`
+	} `mapstructure:"rate_limit"`
+
+	// Cross-origin requests to the HTTP API, from browser frontends served from another origin such as the Curate UI
+	CORS struct {
+		AllowedOrigins   []string      `mapstructure:"allowed_origins" validate:"dive,eq=*|http_url" comment:"Origins browsers may call the HTTP API from, e.g. https://curate.example.org, or * for any (empty disables CORS)"`
+		AllowedMethods   []string      `mapstructure:"allowed_methods" comment:"Methods cross-origin requests may use"`
+		AllowedHeaders   []string      `mapstructure:"allowed_headers" comment:"Request headers cross-origin requests may send"`
+		ExposedHeaders   []string      `mapstructure:"exposed_headers" comment:"Response headers the frontends may read"`
+		AllowCredentials bool          `mapstructure:"allow_credentials" comment:"Let cross-origin requests send cookies and client certificates (requires explicit origins)"`
+		MaxAge           time.Duration `mapstructure:"max_age" validate:"min=0" comment:"Time browsers may cache the answer to a preflight request"`
+	} `mapstructure:"cors"`
+
+	// Append-only log of the actions taken through the authenticated routes of the HTTP API
+	Audit struct {
+		Enabled       bool   `mapstructure:"enabled" comment:"Record the actions taken through the HTTP API in an append-only audit log"`
+		Dir           string `mapstructure:"dir" comment:"Directory of the daily audit log files (defaults to <data_dir>/audit)"`
+		RetentionDays int    `mapstructure:"retention_days" validate:"min=0" comment:"Days the audit log files are kept (0 keeps them forever)"`
+		Reads         bool   `mapstructure:"reads" comment:"Also record the reads that are not denied, not only the changes"`
+	} `mapstructure:"audit"`
+
+	// Rolling metrics of the queue and the pipeline stages, and the warnings notified when they cross a threshold
+	Metrics struct {
+		Window                  time.Duration `mapstructure:"window" validate:"min=1m" comment:"Rolling window of the stage durations and queue waits"`
+		CheckInterval           time.Duration `mapstructure:"check_interval" validate:"min=1s" comment:"Interval at which the metrics are checked against their thresholds"`
+		QueueDepthThreshold     int           `mapstructure:"queue_depth_threshold" validate:"min=0" comment:"Queued jobs above which a warning is notified (0 disables the alert)"`
+		QueueWaitThreshold      time.Duration `mapstructure:"queue_wait_threshold" validate:"min=0" comment:"95th percentile of the queue waits above which a warning is notified (0 disables the alert)"`
+		StageDurationThresholds []string      `mapstructure:"stage_duration_thresholds" comment:"95th percentile of the stage durations above which a warning is notified, as stage=duration, e.g. packaging=2h"`
+	} `mapstructure:"metrics"`
+
+	// Resumable uploads of transfers to the service with the tus protocol
+	Tus struct {
+		Enabled     bool          `mapstructure:"enabled" comment:"Accept resumable uploads of transfers with the tus protocol at /intake/tus"`
+		Dir         string        `mapstructure:"dir" comment:"Directory of the uploads in progress (defaults to <data_dir>/uploads)"`
+		Destination string        `mapstructure:"destination" validate:"required_if=Enabled true" comment:"Cells folder completed uploads are copied to and preserved from (tenants use their intake folder)"`
+		MaxSizeGB   int           `mapstructure:"max_size_gb" validate:"min=0" comment:"Maximum size of an upload in GiB (0 for no limit)"`
+		Expiry      time.Duration `mapstructure:"expiry" validate:"min=1m" comment:"Time an incomplete upload is kept after its last chunk"`
+	} `mapstructure:"tus"`
+
+	// Job submission and status API over gRPC, alongside the HTTP API and with the same authentication
+	GRPC struct {
+		Enabled bool   `mapstructure:"enabled" comment:"Serve the job submission and status API over gRPC"`
+		Address string `mapstructure:"address" validate:"required_if=Enabled true" comment:"Address the gRPC API listens on, over TLS when the HTTP API is"`
+	} `mapstructure:"grpc"`
+
+	// Remote worker agents pulling the queued jobs over the gRPC API, to run them near their data
+	Agents struct {
+		Enabled      bool          `mapstructure:"enabled" comment:"Hand the queued jobs to remote worker agents over the gRPC API instead of running them in serve mode"`
+		LeaseTimeout time.Duration `mapstructure:"lease_timeout" validate:"min=10s" comment:"Time without news from an agent after which its job is queued again"`
+	} `mapstructure:"agents"`
+
+	// Worker agent mode (--agent), running the jobs of a coordinator
+	Agent struct {
+		Coordinator string `mapstructure:"coordinator" comment:"Address of the gRPC API of the coordinator, e.g. preservation.example.org:6906"`
+		Token       string `mapstructure:"token" comment:"API key or bearer token of the agent, with the admin role"`
+		Name        string `mapstructure:"name" comment:"Name of the agent in the logs of the coordinator (defaults to the host name)"`
+		Jobs        int    `mapstructure:"jobs" validate:"min=1" comment:"Jobs the agent runs at once"`
+		TLS         bool   `mapstructure:"tls" comment:"Connect to the coordinator over TLS"`
+		CAFile      string `mapstructure:"ca_file" comment:"CA certificates the certificate of the coordinator is verified against (defaults to the system CAs)"`
+	} `mapstructure:"agent"`
+
+	// API of a running service, called by the jobs command
+	Client struct {
+		Server string `mapstructure:"server" validate:"omitempty,http_url" comment:"URL of the HTTP API of the service managed by the jobs command"`
+		Token  string `mapstructure:"token" comment:"API key or bearer token of the jobs command, with the operator role to cancel and retry jobs"`
+	} `mapstructure:"client"`
+
+	Secrets struct {
+		CacheTTL time.Duration `mapstructure:"cache_ttl" comment:"Time resolved secrets are reused before they are fetched again (0 disables the cache)"`
+		Vault    struct {
+			Address      string `mapstructure:"address" comment:"Vault address (defaults to VAULT_ADDR)"`
+			Token        string `mapstructure:"token" comment:"Vault token (defaults to VAULT_TOKEN)"`
+			Namespace    string `mapstructure:"namespace" comment:"Vault Enterprise namespace"`
+			RoleID       string `mapstructure:"role_id" comment:"AppRole role ID, used when no token is set"`
+			SecretID     string `mapstructure:"secret_id" comment:"AppRole secret ID"`
+			AppRoleMount string `mapstructure:"approle_mount" comment:"Mount path of the AppRole auth method"`
+		} `mapstructure:"vault"`
+		AWS struct {
+			Region string `mapstructure:"region" comment:"AWS Secrets Manager region (defaults to the AWS configuration)"`
+		} `mapstructure:"aws"`
+	} `mapstructure:"secrets"`
+
+	OAI struct {
+		Enabled              bool   `mapstructure:"enabled" comment:"Serve the metadata of preserved packages over OAI-PMH at /oai"`
+		Public               bool   `mapstructure:"public" comment:"Let harvesters use the OAI-PMH endpoint without authentication"`
+		BaseURL              string `mapstructure:"base_url" validate:"required_if=Enabled true,omitempty,url" comment:"Public URL of the OAI-PMH endpoint, e.g. https://preservation.example.org/oai"`
+		RepositoryName       string `mapstructure:"repository_name" comment:"Repository name reported to harvesters"`
+		RepositoryIdentifier string `mapstructure:"repository_identifier" comment:"Namespace of the OAI identifiers, e.g. preservation.example.org (defaults to the base URL host)"`
+		AdminEmail           string `mapstructure:"admin_email" validate:"required_if=Enabled true,omitempty,email" comment:"Administrator e-mail reported to harvesters"`
+		PageSize             int    `mapstructure:"page_size" validate:"min=1" comment:"Records or identifiers per list response"`
+	} `mapstructure:"oai"`
+
+	ResourceSync struct {
+		Enabled bool   `mapstructure:"enabled" comment:"Publish ResourceSync lists of the AIP storage locations"`
+		Public  bool   `mapstructure:"public" comment:"Let mirrors read the ResourceSync lists and AIP files without authentication"`
+		BaseURL string `mapstructure:"base_url" validate:"required_if=Enabled true,omitempty,url" comment:"Public URL of the service, e.g. https://preservation.example.org"`
+	} `mapstructure:"resourcesync"`
+
+	Flows struct {
+		Enabled        bool     `mapstructure:"enabled" comment:"Accept preservation jobs from Cells Flows at /flows/jobs"`
+		CallbackSecret string   `mapstructure:"callback_secret" comment:"Secret the completion callbacks are signed with (deprecated, use callbacks.secret)"`
+		CallbackURLs   []string `mapstructure:"callback_urls" comment:"URL prefixes completion callbacks may be sent to (deprecated, use callbacks.urls)"`
+	} `mapstructure:"flows"`
+
+	// Completion callbacks of the jobs submitted with a callback URL
+	Callbacks struct {
+		Secret string   `mapstructure:"secret" comment:"Secret the job completion callbacks are signed with (defaults to flows.callback_secret)"`
+		URLs   []string `mapstructure:"urls" comment:"URL prefixes job completion callbacks may be sent to (defaults to flows.callback_urls, then the Cells address)"`
+	} `mapstructure:"callbacks"`
+
+	Sentry struct {
+		DSN         string  `mapstructure:"dsn" validate:"omitempty,url" comment:"Sentry or GlitchTip DSN panics and failed preservations are reported to (empty disables reporting)"`
+		Environment string  `mapstructure:"environment" comment:"Environment the reports are tagged with"`
+		SampleRate  float64 `mapstructure:"sample_rate" validate:"min=0,max=1" comment:"Fraction of the errors reported"`
+	} `mapstructure:"sentry"`
+
+	Profiles struct {
+		ConfigPath  string `mapstructure:"config_path" comment:"Path to processing profiles file"`
+		VersionsDir string `mapstructure:"versions_dir" comment:"Directory of the previous versions of the profiles changed with the API (defaults to <data_dir>/profile_versions)"`
+	} `mapstructure:"profiles"`
+
+	Thumbnails struct {
+		ConvertPath  string `mapstructure:"convert_path" comment:"ImageMagick convert binary used for image thumbnails"`
+		PdftoppmPath string `mapstructure:"pdftoppm_path" comment:"Poppler pdftoppm binary used for PDF thumbnails"`
+		FfmpegPath   string `mapstructure:"ffmpeg_path" comment:"FFmpeg binary used for video keyframe thumbnails"`
+	} `mapstructure:"thumbnails"`
+
+	PRONOM struct {
+		SfPath     string `mapstructure:"sf_path" comment:"siegfried binary whose signature file is updated by the PRONOM sync"`
+		ReleaseURL string `mapstructure:"release_url" validate:"url" comment:"URL the PRONOM releases (DROID signature files) are downloaded from"`
+	} `mapstructure:"pronom"`
+
+	FormatPolicies struct {
+		ConfigPath string `mapstructure:"config_path" comment:"Path to format policy registry file"`
+	} `mapstructure:"format_policies"`
+
+	Reports struct {
+		PDFCommand string `mapstructure:"pdf_command" comment:"Command converting the HTML preservation reports to PDF, {input} and {output} are replaced by the paths of the files"`
+	} `mapstructure:"reports"`
+
+	ClamAV struct {
+		Address string `mapstructure:"address" comment:"ClamAV daemon address (tcp://host:port or unix:///path)"`
+	} `mapstructure:"clamav"`
+
 	Premis struct {
 		Organization string `mapstructure:"organization" comment:"Premis Agent Organization"`
 	}
 
 	Cleanup           bool   `mapstructure:"cleanup" comment:"Cleanup completed packages"`
+	KeepFailed        bool   `mapstructure:"keep_failed" comment:"Keep the processing outputs of failed packages so they can be resumed"`
 	AllowInsecureTLS  bool   `mapstructure:"allow_insecure_tls" comment:"Allow insecure TLS connections"`
 	LogLevel          string `mapstructure:"log_level" validate:"oneof=debug info warn error fatal panic" comment:"Log level"`
 	LogFilePath       string `mapstructure:"log_file_path" comment:"Path to log file"`
+	LogSyslogAddress  string `mapstructure:"log_syslog_address" validate:"omitempty,url" comment:"Syslog server logs are also sent to (udp://host:514, tcp://host:601, tls://host:6514 or unix:///dev/log)"`
+	LogSyslogFacility string `mapstructure:"log_syslog_facility" validate:"oneof=kern user mail daemon auth syslog lpr news uucp cron authpriv ftp local0 local1 local2 local3 local4 local5 local6 local7" comment:"Syslog facility"`
+	LogSyslogAppName  string `mapstructure:"log_syslog_app_name" comment:"Syslog app name and journald identifier"`
+	LogJournald       bool   `mapstructure:"log_journald" comment:"Also send logs to systemd-journald"`
 	ProcessingBaseDir string `mapstructure:"processing_base_dir" validate:"dir" comment:"Base directory for processing"`
+	DataDir           string `mapstructure:"data_dir" comment:"Directory for persistent package records and reports"`
+	UUIDVersion       int    `mapstructure:"uuid_version" validate:"oneof=4 7" comment:"UUID version for package and event identifiers (4 random, 7 time-ordered)"`
 }
 
+// processEnv holds the environment variables set before the .env file is loaded, which take precedence over it.
+var processEnv map[string]bool
+
+// dotenv holds the environment variables set by the last load of the .env file.
+var dotenv map[string]bool
+
 // Init initializes Viper configuration
 func Init() {
+	processEnv = map[string]bool{}
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		processEnv[name] = true
+	}
+
 	viper.SetEnvPrefix(envPrefix)
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
 
 	// Set default values
-	setDefaults()
+	setDefaults(viper.GetViper())
 }
 
 // setDefaults sets the default values for the configuration
-func setDefaults() {
-	viper.SetDefault("a3m.address", "localhost:7000")
-	viper.SetDefault("a3m.completed_dir", "/home/a3m/.local/share/a3m/share/completed")
-	viper.SetDefault("a3m.dips_dir", "/home/a3m/.local/share/a3m/share/dips")
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("a3m.address", "localhost:7000")
+	v.SetDefault("a3m.completed_dir", "/home/a3m/.local/share/a3m/share/completed")
+	v.SetDefault("a3m.dips_dir", "/home/a3m/.local/share/a3m/share/dips")
+
+	v.SetDefault("cells.address", "https://localhost:8080")
+	v.SetDefault("cells.admin_token", "")
+	v.SetDefault("cells.archive_workspace", "common-files")
+	v.SetDefault("cells.cec_path", "/usr/local/bin/cec")
+
+	v.SetDefault("events.enabled", false)
+	v.SetDefault("events.paths", []string{})
+	v.SetDefault("events.username", "")
+	v.SetDefault("events.profile", "")
+	v.SetDefault("events.settle_delay", "1m")
+	v.SetDefault("hot_folder.enabled", false)
+	v.SetDefault("hot_folder.dir", "")
+	v.SetDefault("hot_folder.destination", "")
+	v.SetDefault("hot_folder.username", "")
+	v.SetDefault("hot_folder.profile", "")
+	v.SetDefault("hot_folder.settle_delay", "1m")
+	v.SetDefault("hot_folder.poll_interval", "10s")
+	v.SetDefault("hot_folder.processed_dir", "")
+	v.SetDefault("hot_folder.failed_dir", "")
+
+	v.SetDefault("queue.backend", "sqlite")
+	v.SetDefault("queue.sqlite.path", "")
+	v.SetDefault("queue.postgres.url", "")
+	v.SetDefault("queue.postgres.lease", "5m")
+	v.SetDefault("queue.nats.url", "")
+	v.SetDefault("queue.nats.creds_file", "")
+	v.SetDefault("queue.nats.stream", "CURATE_PRESERVATION")
+	v.SetDefault("queue.nats.subject", "curate.preservation.jobs")
+	v.SetDefault("queue.nats.consumer", "curate-preservation-workers")
+	v.SetDefault("queue.nats.replicas", 1)
+	v.SetDefault("queue.nats.ack_wait", "5m")
+	v.SetDefault("queue.nats.max_deliver", 3)
+	v.SetDefault("queue.nats.duplicate_window", "10m")
+	v.SetDefault("queue.priority_aging", "30m")
+
+	v.SetDefault("retry.jobs.max_attempts", 3)
+	v.SetDefault("retry.jobs.initial_delay", "1m")
+	v.SetDefault("retry.jobs.max_delay", "15m")
+	v.SetDefault("retry.download.max_attempts", 3)
+	v.SetDefault("retry.download.initial_delay", "2s")
+	v.SetDefault("retry.download.max_delay", "1m")
+	v.SetDefault("retry.packaging.max_attempts", 3)
+	v.SetDefault("retry.packaging.initial_delay", "2s")
+	v.SetDefault("retry.packaging.max_delay", "1m")
+	v.SetDefault("retry.storage.max_attempts", 3)
+	v.SetDefault("retry.storage.initial_delay", "1s")
+	v.SetDefault("retry.storage.max_delay", "1m")
+	v.SetDefault("retry.dissemination.max_attempts", 3)
+	v.SetDefault("retry.dissemination.initial_delay", "5s")
+	v.SetDefault("retry.dissemination.max_delay", "1m")
+
+	v.SetDefault("concurrency.global", 10)
+	v.SetDefault("concurrency.download", 0)
+	v.SetDefault("concurrency.preprocessing", 0)
+	v.SetDefault("concurrency.normalization", 0)
+	v.SetDefault("concurrency.extraction", 0)
+	v.SetDefault("concurrency.compression", 0)
+	v.SetDefault("concurrency.storage", 0)
+	v.SetDefault("concurrency.dissemination", 0)
+
+	v.SetDefault("shutdown.drain_timeout", "5m")
+
+	v.SetDefault("config_reload.interval", "1m")
+
+	v.SetDefault("health.timeout", "5s")
+	v.SetDefault("health.cache_ttl", "5s")
+	v.SetDefault("health.min_free_space_gb", 5)
+
+	v.SetDefault("scheduler.enabled", false)
+	v.SetDefault("scheduler.config_path", "./schedules_config.json")
+	v.SetDefault("scheduler.path", "")
+	v.SetDefault("scheduler.history_limit", 100)
+	v.SetDefault("scheduler.signature_commands", []string{})
+
+	v.SetDefault("atom.config_path", "./atom_config.json")
+
+	v.SetDefault("archivesspace.config_path", "./archivesspace_config.json")
+
+	v.SetDefault("storage_service.config_path", "./storage_service_config.json")
+
+	v.SetDefault("aip_storage.config_path", "./aip_storage_config.json")
+
+	v.SetDefault("repositories.config_path", "./repositories_config.json")
+
+	v.SetDefault("sources.config_path", "./sources_config.json")
+
+	v.SetDefault("notifications.config_path", "./notifications_config.json")
+
+	v.SetDefault("tenants.config_path", "./tenants_config.json")
+	v.SetDefault("quotas.config_path", "./quotas_config.json")
+
+	v.SetDefault("auth.config_path", "./auth_config.json")
+	v.SetDefault("auth.api_keys.enabled", false)
+	v.SetDefault("auth.api_keys.path", "")
+
+	v.SetDefault("tls.cert_file", "")
+	v.SetDefault("tls.key_file", "")
+	v.SetDefault("tls.reload_interval", "1m")
+	v.SetDefault("tls.client_auth", "none")
+	v.SetDefault("tls.client_ca_file", "")
+	v.SetDefault("tls.client_role", "")
+
+	v.SetDefault("rate_limit.enabled", false)
+	v.SetDefault("rate_limit.requests", 60)
+	v.SetDefault("rate_limit.period", "1m")
+	v.SetDefault("rate_limit.burst", 10)
+	v.SetDefault("rate_limit.trusted_proxies", []string{})
+
+	v.SetDefault("cors.allowed_origins", []string{})
+	v.SetDefault("cors.allowed_methods", []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"})
+	v.SetDefault("cors.allowed_headers", []string{"Authorization", "Content-Type", "Tus-Resumable", "Upload-Length", "Upload-Defer-Length", "Upload-Metadata", "Upload-Offset"})
+	v.SetDefault("cors.exposed_headers", []string{"Location", "Retry-After", "Content-Disposition", "Tus-Resumable", "Tus-Version", "Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires"})
+	v.SetDefault("cors.allow_credentials", false)
+	v.SetDefault("cors.max_age", "10m")
+
+	v.SetDefault("audit.enabled", false)
+	v.SetDefault("audit.dir", "")
+	v.SetDefault("audit.retention_days", 365)
+	v.SetDefault("audit.reads", false)
+
+	v.SetDefault("metrics.window", "1h")
+	v.SetDefault("metrics.check_interval", "1m")
+	v.SetDefault("metrics.queue_depth_threshold", 0)
+	v.SetDefault("metrics.queue_wait_threshold", "0s")
+	v.SetDefault("metrics.stage_duration_thresholds", []string{})
+
+	v.SetDefault("tus.enabled", false)
+	v.SetDefault("tus.dir", "")
+	v.SetDefault("tus.destination", "")
+	v.SetDefault("tus.max_size_gb", 0)
+	v.SetDefault("tus.expiry", "24h")
+
+	v.SetDefault("grpc.enabled", false)
+	v.SetDefault("grpc.address", ":6906")
+
+	v.SetDefault("agents.enabled", false)
+	v.SetDefault("agents.lease_timeout", "2m")
+
+	v.SetDefault("agent.coordinator", "")
+	v.SetDefault("agent.token", "")
+	v.SetDefault("agent.name", "")
+	v.SetDefault("agent.jobs", 1)
+	v.SetDefault("agent.tls", false)
+	v.SetDefault("agent.ca_file", "")
+
+	v.SetDefault("client.server", "http://localhost:6905")
+	v.SetDefault("client.token", "")
+
+	v.SetDefault("secrets.cache_ttl", "5m")
+	v.SetDefault("secrets.vault.address", "")
+	v.SetDefault("secrets.vault.token", "")
+	v.SetDefault("secrets.vault.namespace", "")
+	v.SetDefault("secrets.vault.role_id", "")
+	v.SetDefault("secrets.vault.secret_id", "")
+	v.SetDefault("secrets.vault.approle_mount", "approle")
+	v.SetDefault("secrets.aws.region", "")
+
+	v.SetDefault("oai.enabled", false)
+	v.SetDefault("oai.public", true)
+	v.SetDefault("oai.base_url", "")
+	v.SetDefault("oai.repository_name", "Curate Preservation")
+	v.SetDefault("oai.repository_identifier", "")
+	v.SetDefault("oai.admin_email", "")
+	v.SetDefault("oai.page_size", 100)
+
+	v.SetDefault("resourcesync.enabled", false)
+	v.SetDefault("resourcesync.public", false)
+	v.SetDefault("resourcesync.base_url", "")
 
-	viper.SetDefault("cells.address", "https://localhost:8080")
-	viper.SetDefault("cells.admin_token", "")
-	viper.SetDefault("cells.archive_workspace", "common-files")
-	viper.SetDefault("cells.cec_path", "/usr/local/bin/cec")
+	v.SetDefault("flows.enabled", false)
+	v.SetDefault("flows.callback_secret", "")
+	v.SetDefault("flows.callback_urls", []string{})
 
-	viper.SetDefault("atom.config_path", "./atom_config.json")
+	v.SetDefault("callbacks.secret", "")
+	v.SetDefault("callbacks.urls", []string{})
 
-	viper.SetDefault("premis.organization", "")
+	v.SetDefault("sentry.dsn", "")
+	v.SetDefault("sentry.environment", "production")
+	v.SetDefault("sentry.sample_rate", 1.0)
 
-	viper.SetDefault("cleanup", true)
-	viper.SetDefault("allow_insecure_tls", false)
-	viper.SetDefault("log_level", "info")
-	viper.SetDefault("log_file_path", "/var/log/curate/curate-preservation-core.log")
-	viper.SetDefault("processing_base_dir", "/tmp/preservation")
+	v.SetDefault("profiles.config_path", "./profiles.json")
+	v.SetDefault("profiles.versions_dir", "")
+
+	v.SetDefault("clamav.address", "")
+
+	v.SetDefault("thumbnails.convert_path", "convert")
+	v.SetDefault("thumbnails.pdftoppm_path", "pdftoppm")
+	v.SetDefault("thumbnails.ffmpeg_path", "ffmpeg")
+
+	viper.SetDefault("pronom.sf_path", "sf")
+	viper.SetDefault("pronom.release_url", "https://cdn.nationalarchives.gov.uk/documents")
+
+	viper.SetDefault("format_policies.config_path", "./format_policies_config.json")
+
+	v.SetDefault("reports.pdf_command", "chromium --headless --disable-gpu --no-pdf-header-footer --print-to-pdf={output} {input}")
+
+	v.SetDefault("premis.organization", "")
+
+	v.SetDefault("cleanup", true)
+	v.SetDefault("keep_failed", true)
+	v.SetDefault("allow_insecure_tls", false)
+	v.SetDefault("log_level", "info")
+	v.SetDefault("log_file_path", "/var/log/curate/curate-preservation-core.log")
+	v.SetDefault("log_syslog_address", "")
+	v.SetDefault("log_syslog_facility", "local0")
+	v.SetDefault("log_syslog_app_name", "curate-preservation-core")
+	v.SetDefault("log_journald", false)
+	v.SetDefault("processing_base_dir", "/tmp/preservation")
+	v.SetDefault("data_dir", "/var/lib/curate/preservation")
+	v.SetDefault("uuid_version", 4)
+}
+
+// DataDir returns the data directory set in the environment variables or .env file, for shell completions. Unlike
+// Load, nothing is logged and the other settings are neither resolved nor validated.
+func DataDir() (string, error) {
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(); err != nil {
+			return "", fmt.Errorf("error loading .env file: %w", err)
+		}
+	}
+	return viper.GetString("data_dir"), nil
+}
+
+// EnvName returns the environment variable of a setting, e.g. CA4M_CELLS_ADMIN_TOKEN for cells.admin_token.
+func EnvName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// Setting returns the value of a setting from the environment variables, or its default. Unlike Read, the .env file
+// is not loaded and secret references are not resolved.
+func Setting(key string) string {
+	return viper.GetString(key)
 }
 
 // Load loads the configuration from the environment variables and .env file
 func Load() (*Config, error) {
+	cfg, err := Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the configuration
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Reload reads the .env file again, then loads the configuration like Load. The variables of the .env file replace
+// the ones it set before, and the variables removed from it are unset, while the variables of the process environment
+// still take precedence. The new configuration is validated before the environment is changed, so an invalid .env
+// file leaves the current settings in place.
+func Reload() (*Config, error) {
+	values := map[string]string{}
+	if _, err := os.Stat(".env"); err == nil {
+		if values, err = godotenv.Read(); err != nil {
+			return nil, fmt.Errorf("error loading .env file: %w", err)
+		}
+	}
+	// The .env variables only apply where no other variable is set
+	for name := range values {
+		if _, ok := os.LookupEnv(name); ok && !dotenv[name] {
+			delete(values, name)
+		}
+	}
+
+	// Read and validate the new settings without changing the environment
+	scratch := viper.New()
+	setDefaults(scratch)
+	for _, key := range scratch.AllKeys() {
+		name := EnvName(key)
+		if value, ok := values[name]; ok {
+			scratch.Set(key, value)
+		} else if value, ok := os.LookupEnv(name); ok && !dotenv[name] {
+			scratch.Set(key, value)
+		}
+	}
+	cfg, err := unmarshal(scratch)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	for name := range dotenv {
+		if _, ok := values[name]; !ok {
+			if err := os.Unsetenv(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	loaded := make(map[string]bool, len(values))
+	for name, value := range values {
+		if err := os.Setenv(name, value); err != nil {
+			return nil, err
+		}
+		loaded[name] = true
+	}
+	dotenv = loaded
+	return cfg, nil
+}
+
+// Read reads the configuration from the environment variables and .env file, and resolves its secret references,
+// without validating it.
+func Read() (*Config, error) {
 	// Load .env if it exists
 	if _, err := os.Stat(".env"); err == nil {
 		logger.Info("Loading .env file")
-		if err := godotenv.Load(); err != nil {
+		if err := loadDotenv(); err != nil {
 			return nil, fmt.Errorf("error loading .env file: %w", err)
 		}
 	}
 
+	return unmarshal(viper.GetViper())
+}
+
+// unmarshal unmarshals the configuration of a Viper instance, and resolves its secret references.
+func unmarshal(v *viper.Viper) (*Config, error) {
 	// Unmarshal the configuration
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("error unmarshalling configuration: %v", err)
 	}
 
-	// Validate the configuration
-	if err := validate(&cfg); err != nil {
+	// Resolve the secret references of the settings and configuration files
+	configureSecrets(&cfg)
+	if err := secrets.Resolve(&cfg); err != nil {
 		return nil, err
 	}
 
 	return &cfg, nil
 }
 
-// validate validates the configuration
-func validate(cfg *Config) error {
+// LoadClient loads the settings of the commands calling the API of a running service from the environment variables
+// and .env file. Only the client settings are resolved and validated, the settings of the service are not needed.
+func LoadClient() (*Config, error) {
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(); err != nil {
+			return nil, fmt.Errorf("error loading .env file: %w", err)
+		}
+	}
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("error unmarshalling configuration: %v", err)
+	}
+	configureSecrets(&cfg)
+	if err := secrets.Resolve(&cfg.Client); err != nil {
+		return nil, err
+	}
+	if err := validator.New().Var(cfg.Client.Server, "http_url"); err != nil {
+		return nil, fmt.Errorf("invalid client server URL %q", cfg.Client.Server)
+	}
+	return &cfg, nil
+}
+
+// loadDotenv loads the .env file in the environment, without overriding the variables already set, and records the
+// variables it set for Reload.
+func loadDotenv() error {
+	values, err := godotenv.Read()
+	if err != nil {
+		return err
+	}
+	if dotenv == nil {
+		dotenv = map[string]bool{}
+	}
+	for name, value := range values {
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+		dotenv[name] = true
+	}
+	return nil
+}
+
+// configureSecrets sets the secret managers settings used to resolve secret references.
+func configureSecrets(cfg *Config) {
+	secrets.Configure(secrets.Config{
+		CacheTTL: cfg.Secrets.CacheTTL,
+		Vault: secrets.VaultConfig{
+			Address:      cfg.Secrets.Vault.Address,
+			Token:        cfg.Secrets.Vault.Token,
+			Namespace:    cfg.Secrets.Vault.Namespace,
+			RoleID:       cfg.Secrets.Vault.RoleID,
+			SecretID:     cfg.Secrets.Vault.SecretID,
+			AppRoleMount: cfg.Secrets.Vault.AppRoleMount,
+		},
+		AWSRegion: cfg.Secrets.AWS.Region,
+		Insecure:  cfg.AllowInsecureTLS,
+	})
+}
+
+// Validate validates the configuration
+func (c *Config) Validate() error {
 	validate := validator.New()
-	return validate.Struct(cfg)
+	return validate.Struct(c)
 }
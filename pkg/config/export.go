@@ -0,0 +1,16 @@
+package config
+
+const (
+	// ExportFormatOPEX exports AIPs as Preservica OPEX packages.
+	ExportFormatOPEX = "opex"
+
+	// DefaultSecurityDescriptor is the Preservica security tag of exported packages.
+	DefaultSecurityDescriptor = "open"
+)
+
+// ExportConfig configures the export of AIPs to other preservation systems.
+type ExportConfig struct {
+	Format             string `json:"format" validate:"required,oneof=opex" comment:"Export format (opex)"`
+	TargetDir          string `json:"target_dir" validate:"required" comment:"Directory the exported packages are written to, e.g. a Preservica incremental ingest folder"`
+	SecurityDescriptor string `json:"security_descriptor,omitempty" comment:"Preservica security tag of exported packages (default open)"`
+}
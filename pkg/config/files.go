@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// File is a configuration file referenced by the settings.
+type File struct {
+	Name   string // Section of the settings referencing the file, e.g. atom
+	Path   string
+	Config any   // Loaded configuration, nil if the file is not configured or invalid
+	Err    error // Error reading or validating the file
+}
+
+// Configured reports whether the file exists.
+func (f *File) Configured() bool {
+	return f.Config != nil || f.Err != nil
+}
+
+// Files loads and validates the configuration files referenced by the settings. Files that don't exist are not
+// configured: their integration is disabled, or their defaults are used.
+func Files(cfg *Config) []File {
+	loaders := []struct {
+		name string
+		path string
+		load func(path string) (any, error)
+	}{
+		{"scheduler", cfg.Scheduler.ConfigPath, loadFile(LoadSchedulesConfig)},
+		{"atom", cfg.Atom.ConfigPath, loadAtomFile},
+		{"archivesspace", cfg.ArchivesSpace.ConfigPath, loadFile(LoadArchivesSpaceConfig)},
+		{"storage_service", cfg.StorageService.ConfigPath, loadFile(LoadStorageServiceConfig)},
+		{"aip_storage", cfg.AIPStorage.ConfigPath, loadFile(LoadAIPStorageConfig)},
+		{"repositories", cfg.Repositories.ConfigPath, loadFile(LoadRepositoriesConfig)},
+		{"sources", cfg.Sources.ConfigPath, loadFile(LoadSourcesConfig)},
+		{"notifications", cfg.Notifications.ConfigPath, loadFile(LoadNotificationsConfig)},
+		{"tenants", cfg.Tenants.ConfigPath, loadFile(LoadTenantsConfig)},
+		{"quotas", cfg.Quotas.ConfigPath, loadFile(LoadQuotasConfig)},
+		{"auth", cfg.Auth.ConfigPath, loadFile(LoadAuthConfig)},
+		{"profiles", cfg.Profiles.ConfigPath, loadFile(LoadProfiles)},
+		{"format_policies", cfg.FormatPolicies.ConfigPath, loadFile(LoadFormatPoliciesConfig)},
+	}
+	files := make([]File, 0, len(loaders))
+	for _, loader := range loaders {
+		file := File{Name: loader.name, Path: loader.path}
+		if loader.path != "" {
+			if _, err := os.Stat(filepath.Clean(loader.path)); err == nil {
+				file.Config, file.Err = loader.load(loader.path)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				file.Err = fmt.Errorf("reading config file: %w", err)
+			}
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// loadFile adapts a configuration file loader, so that a missing configuration is a nil interface.
+func loadFile[T any](load func(path string) (*T, error)) func(path string) (any, error) {
+	return func(path string) (any, error) {
+		cfg, err := load(path)
+		if err != nil || cfg == nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+}
+
+// loadAtomFile loads the AtoM configuration file. Unlike the settings merged with it, a file must be complete.
+func loadAtomFile(path string) (any, error) {
+	cfg, err := LoadAtomConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid AtoM config: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Format policy actions.
+const (
+	// FormatPolicyPreserve keeps files of the format as they are.
+	FormatPolicyPreserve = "preserve"
+	// FormatPolicyNormalize normalizes files of the format to a preservation format.
+	FormatPolicyNormalize = "normalize"
+	// FormatPolicyReview refers files of the format to an archivist.
+	FormatPolicyReview = "review"
+	// FormatPolicyReject does not accept files of the format.
+	FormatPolicyReject = "reject"
+)
+
+// FormatPoliciesConfig is the format policy registry, the preservation policy of each PRONOM format.
+type FormatPoliciesConfig struct {
+	Policies []*FormatPolicy `json:"policies" validate:"dive" comment:"Format policies"`
+}
+
+// FormatPolicy is the preservation policy of a PRONOM format.
+type FormatPolicy struct {
+	PUID   string `json:"puid" validate:"required" comment:"PRONOM unique identifier, e.g. fmt/276"`
+	Action string `json:"action" validate:"required,oneof=preserve normalize review reject" comment:"Preservation action (preserve, normalize, review, reject)"`
+	Note   string `json:"note,omitempty" comment:"Rationale of the policy"`
+}
+
+// Validate validates the FormatPoliciesConfig.
+func (c *FormatPoliciesConfig) Validate() error {
+	if err := validator.New().Struct(c); err != nil {
+		return err
+	}
+	puids := map[string]bool{}
+	for _, policy := range c.Policies {
+		if puids[policy.PUID] {
+			return fmt.Errorf("duplicate format policy: %s", policy.PUID)
+		}
+		puids[policy.PUID] = true
+	}
+	return nil
+}
+
+// Policy returns the policy of the format with the given PUID, or nil if it has none.
+func (c *FormatPoliciesConfig) Policy(puid string) *FormatPolicy {
+	if c == nil {
+		return nil
+	}
+	for _, policy := range c.Policies {
+		if policy.PUID == puid {
+			return policy
+		}
+	}
+	return nil
+}
+
+// LoadFormatPoliciesConfig loads the format policy registry from a file.
+// Returns nil if the file does not exist, in which case no format has a policy.
+func LoadFormatPoliciesConfig(path string) (*FormatPoliciesConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg FormatPoliciesConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid format policies config: %w", err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+)
+
+const (
+	// NotifyEventCompleted is sent when a package is preserved.
+	NotifyEventCompleted = "preservation.completed"
+	// NotifyEventFailed is sent when the preservation of a package fails.
+	NotifyEventFailed = "preservation.failed"
+	// NotifyEventFixityFailed is sent when files are lost or modified by the pipeline, or a stored AIP fails its fixity check.
+	NotifyEventFixityFailed = "fixity.failed"
+	// NotifyEventQuarantined is sent when a package is held in quarantine: a virus was found, or it needs review for sensitive data.
+	NotifyEventQuarantined = "package.quarantined"
+	// NotifyEventStarted is sent when the preservation of a package starts. Only webhooks and brokers receive it.
+	NotifyEventStarted = "preservation.started"
+	// NotifyEventAIPStored is sent when an AIP is stored and verified in Cells. Only webhooks and brokers receive it.
+	NotifyEventAIPStored = "aip.stored"
+	// NotifyEventCancelled is sent when the preservation of a package is cancelled by a user. Only webhooks and
+	// brokers receive it.
+	NotifyEventCancelled = "preservation.cancelled"
+	// NotifyEventStateChanged is sent on every lifecycle transition of a package. Only webhooks and brokers receive it.
+	NotifyEventStateChanged = "package.state_changed"
+	// NotifyEventThresholdExceeded is sent when a metric of the service, such as the queue depth, goes above its alert
+	// threshold.
+	NotifyEventThresholdExceeded = "metrics.threshold_exceeded"
+	// NotifyEventThresholdRecovered is sent when a metric goes back below its alert threshold.
+	NotifyEventThresholdRecovered = "metrics.threshold_recovered"
+
+	// defaultWebhookAttempts is the default number of delivery attempts of a webhook event.
+	defaultWebhookAttempts = 5
+
+	// SMTPSecurityStartTLS upgrades the connection with STARTTLS. This is the default.
+	SMTPSecurityStartTLS = "starttls"
+	// SMTPSecurityTLS connects with implicit TLS, usually on port 465.
+	SMTPSecurityTLS = "tls"
+	// SMTPSecurityNone sends over plain SMTP, e.g. to a local relay.
+	SMTPSecurityNone = "none"
+
+	// KafkaSASLPlain authenticates to Kafka with SASL/PLAIN.
+	KafkaSASLPlain = "plain"
+	// KafkaSASLSCRAMSHA256 authenticates to Kafka with SASL/SCRAM-SHA-256.
+	KafkaSASLSCRAMSHA256 = "scram-sha-256"
+	// KafkaSASLSCRAMSHA512 authenticates to Kafka with SASL/SCRAM-SHA-512.
+	KafkaSASLSCRAMSHA512 = "scram-sha-512"
+
+	// NotifySeverityInfo is the severity of completed preservations and recovered metrics.
+	NotifySeverityInfo = "info"
+	// NotifySeverityWarning is the severity of packages held for review, non-strict manifest losses and metrics above
+	// their alert threshold.
+	NotifySeverityWarning = "warning"
+	// NotifySeverityError is the severity of failures.
+	NotifySeverityError = "error"
+)
+
+// NotifyEvents lists the notification event types of the email and chat channels.
+var NotifyEvents = []string{
+	NotifyEventCompleted, NotifyEventFailed, NotifyEventFixityFailed, NotifyEventQuarantined, NotifyEventThresholdExceeded,
+	NotifyEventThresholdRecovered,
+}
+
+// notifySeverities ranks the notification severities.
+var notifySeverities = map[string]int{NotifySeverityInfo: 1, NotifySeverityWarning: 2, NotifySeverityError: 3}
+
+// NotificationsConfig holds the channels notified of package outcomes.
+type NotificationsConfig struct {
+	BaseURL string        `json:"base_url,omitempty" validate:"omitempty,http_url" comment:"URL of the preservation API, used to link notifications to package records"`
+	Email   *EmailConfig  `json:"email,omitempty" comment:"SMTP email notifications"`
+	Slack   []*ChatConfig `json:"slack,omitempty" validate:"dive" comment:"Slack channels, by incoming webhook"`
+	Teams   []*ChatConfig `json:"teams,omitempty" validate:"dive" comment:"Microsoft Teams channels, by incoming webhook or workflow"`
+	// Webhooks receive the events as signed JSON
+	Webhooks       []*WebhookConfig `json:"webhooks,omitempty" validate:"dive" comment:"Outbound webhooks"`
+	DeadLetterFile string           `json:"dead_letter_file,omitempty" comment:"File undeliverable webhook events are appended to (default <data dir>/webhook-dead-letters.jsonl)"`
+	// Message brokers receive the events as JSON messages, for data platforms consuming the package lifecycle
+	Kafka    []*KafkaConfig    `json:"kafka,omitempty" validate:"dive" comment:"Kafka topics"`
+	RabbitMQ []*RabbitMQConfig `json:"rabbitmq,omitempty" validate:"dive" comment:"RabbitMQ exchanges"`
+}
+
+// KafkaConfig is a Kafka topic the events are published to, keyed by package so the events of a package stay in order.
+type KafkaConfig struct {
+	Name    string           `json:"name" validate:"required" comment:"Name of the publisher"`
+	Brokers []string         `json:"brokers" validate:"required,min=1,dive,hostname_port" comment:"Bootstrap brokers (host:port)"`
+	Topic   string           `json:"topic" validate:"required" comment:"Topic the events are published to"`
+	Events  []string         `json:"events,omitempty" validate:"dive,oneof=preservation.started preservation.completed preservation.failed fixity.failed package.quarantined aip.stored package.state_changed metrics.threshold_exceeded metrics.threshold_recovered" comment:"Events published (default all)"`
+	TLS     bool             `json:"tls,omitempty" comment:"Connect to the brokers over TLS"`
+	SASL    *KafkaSASLConfig `json:"sasl,omitempty" comment:"SASL authentication"`
+}
+
+// KafkaSASLConfig holds the SASL credentials of a Kafka cluster.
+type KafkaSASLConfig struct {
+	Mechanism string `json:"mechanism" validate:"required,oneof=plain scram-sha-256 scram-sha-512" comment:"SASL mechanism (plain, scram-sha-256, scram-sha-512)"`
+	Username  string `json:"username" validate:"required" comment:"SASL user"`
+	Password  string `json:"password" validate:"required" comment:"SASL password"`
+}
+
+// RabbitMQConfig is a RabbitMQ exchange the events are published to, with the event type as routing key.
+type RabbitMQConfig struct {
+	Name         string   `json:"name" validate:"required" comment:"Name of the publisher"`
+	URL          string   `json:"url" validate:"required,url,startswith=amqp" comment:"AMQP URL (amqp:// or amqps://), with credentials and virtual host"`
+	Exchange     string   `json:"exchange" validate:"required" comment:"Exchange the events are published to, declared durable if missing"`
+	ExchangeType string   `json:"exchange_type,omitempty" validate:"omitempty,oneof=topic fanout direct headers" comment:"Type of the exchange (default topic)"`
+	Events       []string `json:"events,omitempty" validate:"dive,oneof=preservation.started preservation.completed preservation.failed fixity.failed package.quarantined aip.stored package.state_changed metrics.threshold_exceeded metrics.threshold_recovered" comment:"Events published (default all)"`
+}
+
+// WebhookConfig is an endpoint receiving the events as JSON, signed with HMAC-SHA256.
+type WebhookConfig struct {
+	Name        string            `json:"name" validate:"required" comment:"Name of the webhook"`
+	URL         string            `json:"url" validate:"required,http_url" comment:"Endpoint URL"`
+	Secret      string            `json:"secret" validate:"required,min=16" comment:"Shared secret the events are signed with"`
+	Events      []string          `json:"events,omitempty" validate:"dive,oneof=preservation.started preservation.completed preservation.failed fixity.failed package.quarantined aip.stored package.state_changed metrics.threshold_exceeded metrics.threshold_recovered" comment:"Events sent to the webhook (default all)"`
+	Headers     map[string]string `json:"headers,omitempty" comment:"Additional request headers"`
+	MaxAttempts int               `json:"max_attempts,omitempty" validate:"omitempty,min=1,max=20" comment:"Delivery attempts before an event is dead-lettered (default 5)"`
+}
+
+// Attempts returns the number of delivery attempts of an event.
+func (w *WebhookConfig) Attempts() int {
+	if w.MaxAttempts == 0 {
+		return defaultWebhookAttempts
+	}
+	return w.MaxAttempts
+}
+
+// ChatConfig is a chat channel notified through an incoming webhook.
+type ChatConfig struct {
+	Name        string   `json:"name" validate:"required" comment:"Name of the channel"`
+	WebhookURL  string   `json:"webhook_url" validate:"required,http_url" comment:"Incoming webhook URL"`
+	Events      []string `json:"events,omitempty" validate:"dive,oneof=preservation.completed preservation.failed fixity.failed package.quarantined metrics.threshold_exceeded metrics.threshold_recovered" comment:"Events posted to the channel (default all)"`
+	MinSeverity string   `json:"min_severity,omitempty" validate:"omitempty,oneof=info warning error" comment:"Lowest severity posted to the channel (info, warning, error), default info"`
+}
+
+// Accepts reports whether an event of the given type and severity is posted to the channel.
+func (c *ChatConfig) Accepts(eventType, severity string) bool {
+	return NotifyEnabled(c.Events, eventType) && notifySeverities[severity] >= notifySeverities[c.MinSeverity]
+}
+
+// EmailConfig holds the SMTP server and the recipients of email notifications.
+type EmailConfig struct {
+	Host     string `json:"host" validate:"required" comment:"SMTP server host"`
+	Port     int    `json:"port,omitempty" validate:"omitempty,min=1,max=65535" comment:"SMTP server port (default 587, 465 with implicit TLS)"`
+	Security string `json:"security,omitempty" validate:"omitempty,oneof=starttls tls none" comment:"Connection security (starttls, tls, none), default starttls"`
+	Username string `json:"username,omitempty" comment:"SMTP user"`
+	Password string `json:"password,omitempty" validate:"required_with=Username" comment:"SMTP password"`
+	From     string `json:"from" validate:"required" comment:"Sender address, optionally with a name (Curate <curate@example.org>)"`
+	// Recipients receive the notifications of every package
+	Recipients []string `json:"recipients,omitempty" validate:"dive,email" comment:"Recipients of all notifications"`
+	Events     []string `json:"events,omitempty" validate:"dive,oneof=preservation.completed preservation.failed fixity.failed package.quarantined metrics.threshold_exceeded metrics.threshold_recovered" comment:"Events sent to the recipients (default all)"`
+	// Tenants receive the notifications of their own packages only
+	Tenants   []*NotificationTenant     `json:"tenants,omitempty" validate:"dive" comment:"Recipients by Cells user or path"`
+	Templates map[string]*EmailTemplate `json:"templates,omitempty" validate:"dive" comment:"Message templates by event type"`
+}
+
+// NotificationTenant is a group of packages, by Cells user or path, and the recipients notified of them.
+type NotificationTenant struct {
+	Name       string   `json:"name" validate:"required" comment:"Name of the tenant"`
+	Users      []string `json:"users,omitempty" validate:"required_without=Paths" comment:"Cells users whose packages belong to the tenant"`
+	Paths      []string `json:"paths,omitempty" validate:"required_without=Users" comment:"Cells path prefixes of the packages of the tenant"`
+	Recipients []string `json:"recipients" validate:"required,min=1,dive,email" comment:"Recipients of the tenant's notifications"`
+	Events     []string `json:"events,omitempty" validate:"dive,oneof=preservation.completed preservation.failed fixity.failed package.quarantined" comment:"Events sent to the tenant (default all)"`
+}
+
+// EmailTemplate is a Go text/template for the subject and body of an email, executed with the notification event.
+type EmailTemplate struct {
+	Subject string `json:"subject,omitempty" comment:"Subject template"`
+	Body    string `json:"body,omitempty" comment:"Body template"`
+}
+
+// Matches reports whether a package of the given user and Cells path belongs to the tenant.
+func (t *NotificationTenant) Matches(username, cellsPath string) bool {
+	if slices.Contains(t.Users, username) {
+		return true
+	}
+	cellsPath = strings.Trim(cellsPath, "/")
+	for _, prefix := range t.Paths {
+		prefix = strings.Trim(prefix, "/")
+		if cellsPath == prefix || strings.HasPrefix(cellsPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate validates the NotificationsConfig.
+func (n *NotificationsConfig) Validate() error {
+	if err := validator.New().Struct(n); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, webhook := range n.Webhooks {
+		if names[webhook.Name] {
+			return fmt.Errorf("duplicate webhook: %s", webhook.Name)
+		}
+		names[webhook.Name] = true
+	}
+	brokers := map[string]bool{}
+	for _, kafka := range n.Kafka {
+		if brokers[kafka.Name] {
+			return fmt.Errorf("duplicate broker publisher: %s", kafka.Name)
+		}
+		brokers[kafka.Name] = true
+	}
+	for _, rabbitmq := range n.RabbitMQ {
+		if brokers[rabbitmq.Name] {
+			return fmt.Errorf("duplicate broker publisher: %s", rabbitmq.Name)
+		}
+		brokers[rabbitmq.Name] = true
+	}
+	if n.Email != nil {
+		if _, err := mail.ParseAddress(n.Email.From); err != nil {
+			return fmt.Errorf("invalid email sender: %w", err)
+		}
+		for eventType, tmpl := range n.Email.Templates {
+			if !slices.Contains(NotifyEvents, eventType) {
+				return fmt.Errorf("email template for unknown event: %s", eventType)
+			}
+			if _, err := template.New("subject").Parse(tmpl.Subject); err != nil {
+				return fmt.Errorf("email template %s: %w", eventType, err)
+			}
+			if _, err := template.New("body").Parse(tmpl.Body); err != nil {
+				return fmt.Errorf("email template %s: %w", eventType, err)
+			}
+		}
+	}
+	return nil
+}
+
+// NotifyEnabled reports whether an event is sent, given the events configured for a channel. No events selects all.
+func NotifyEnabled(events []string, eventType string) bool {
+	return len(events) == 0 || slices.Contains(events, eventType)
+}
+
+// LoadNotificationsConfig loads the notification channels from a file.
+// Returns nil if the file does not exist, in which case no notifications are sent.
+func LoadNotificationsConfig(path string) (*NotificationsConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg NotificationsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid notifications config: %w", err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Built-in PII pattern sets.
+const (
+	PIIPatternEmail      = "email"
+	PIIPatternUKNINO     = "uk_nino"
+	PIIPatternCreditCard = "credit_card"
+)
+
+// PIIPatternSets lists the built-in PII pattern sets.
+var PIIPatternSets = []string{PIIPatternEmail, PIIPatternUKNINO, PIIPatternCreditCard}
+
+// DefaultPIIMaxFileSize is the size above which files are not scanned for PII.
+const DefaultPIIMaxFileSize = 50 << 20
+
+// PIIScanConfig configures the sensitive data detection stage.
+// Packages with findings are flagged for review and their DIP is held back.
+type PIIScanConfig struct {
+	Patterns       []string          `json:"patterns,omitempty" validate:"dive,oneof=email uk_nino credit_card" comment:"Built-in pattern sets to use (email, uk_nino, credit_card). All if empty"`
+	CustomPatterns map[string]string `json:"custom_patterns,omitempty" comment:"Additional regular expressions by name"`
+	Allowlist      []string          `json:"allowlist,omitempty" comment:"Regular expressions for matches to ignore (e.g. organisational email addresses)"`
+	MaxFileSize    int64             `json:"max_file_size,omitempty" validate:"gte=0" comment:"Files larger than this many bytes are skipped (default 50MB)"`
+}
+
+// Validate ensures the custom patterns and allowlist are valid regular expressions.
+func (c *PIIScanConfig) Validate() error {
+	for name, pattern := range c.CustomPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid PII pattern %q: %w", name, err)
+		}
+	}
+	for _, pattern := range c.Allowlist {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid PII allowlist pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
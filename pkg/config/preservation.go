@@ -11,8 +11,24 @@ type PreservationConfig struct {
 	// ProcessType            string 	// eark or standard
 	// ImageNormalizationTiff bool 		// Unused yet?
 	// TODO: Change this to AIP Compression Algo and Level (with algo option None)
-	CompressAip bool                              `json:"compress_aip" comment:"Compress AIP"`
-	A3mConfig   *transferservice.ProcessingConfig `json:"a3m_config" comment:"A3M processing configuration"`
+	CompressAip        bool                              `json:"compress_aip" comment:"Compress AIP"`
+	A3mConfig          *transferservice.ProcessingConfig `json:"a3m_config" comment:"A3M processing configuration"`
+	Profile            string                            `json:"profile,omitempty" comment:"Name of the processing profile the configuration was built from"`
+	ChecksumAlgorithms []string                          `json:"checksum_algorithms,omitempty" validate:"dive,oneof=md5 sha1 sha256 sha512" comment:"Checksum algorithms for transfer fixity files"`
+	AVScan             bool                              `json:"av_scan,omitempty" comment:"Scan transfers for viruses with ClamAV"`
+	GenerateDIP        *bool                             `json:"generate_dip,omitempty" comment:"Generate and deposit a DIP when an AtoM slug is present"`
+	ManifestCheck      string                            `json:"manifest_check,omitempty" validate:"omitempty,oneof=warn strict off" comment:"Input and AIP manifest comparison (warn, strict, off)"`
+	DuplicateCheck     string                            `json:"duplicate_check,omitempty" validate:"omitempty,oneof=warn skip off" comment:"Detection of transfers whose content was already preserved (warn, skip, off)"`
+	PIIScan            *PIIScanConfig                    `json:"pii_scan,omitempty" comment:"Scan text files for sensitive data and hold back the DIP for review"`
+	Thumbnails         *ThumbnailConfig                  `json:"thumbnails,omitempty" comment:"Generate thumbnails and previews for DIP objects"`
+	Export             *ExportConfig                     `json:"export,omitempty" comment:"Export AIPs to another preservation system format"`
+	AccessCopies       *AccessCopyConfig                 `json:"access_copies,omitempty" comment:"Upload DIP access copies to Cells and share them"`
+	StorageTier        string                            `json:"storage_tier,omitempty" validate:"omitempty,oneof=hot cool cold archive" comment:"Tier of the AIP copies in the storage locations (hot, cool, cold, archive)"`
+}
+
+// DIPEnabled reports whether DIP generation is allowed. DIPs are generated by default.
+func (cfg *PreservationConfig) DIPEnabled() bool {
+	return cfg.GenerateDIP == nil || *cfg.GenerateDIP
 }
 
 // DefaultPreservationConfig returns a default configuration for the preservation service.
@@ -59,6 +75,17 @@ func (cfg *PreservationConfig) MergeWithDefaults() PreservationConfig {
 
 	// Handle top level fields
 	result.CompressAip = cfg.CompressAip || defaults.CompressAip
+	result.Profile = cfg.Profile
+	result.ChecksumAlgorithms = cfg.ChecksumAlgorithms
+	result.AVScan = cfg.AVScan
+	result.GenerateDIP = cfg.GenerateDIP
+	result.ManifestCheck = cfg.ManifestCheck
+	result.DuplicateCheck = cfg.DuplicateCheck
+	result.PIIScan = cfg.PIIScan
+	result.Thumbnails = cfg.Thumbnails
+	result.Export = cfg.Export
+	result.AccessCopies = cfg.AccessCopies
+	result.StorageTier = cfg.StorageTier
 
 	// Handle A3M config
 	if cfg.A3mConfig != nil {
@@ -0,0 +1,295 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	transferservice "github.com/penwern/curate-preservation-core/common/proto/a3m/gen/go/a3m/api/transferservice/v1beta1"
+	"github.com/spf13/viper"
+)
+
+const (
+	// ContainerFormatDirectory stores the AIP as an extracted directory.
+	ContainerFormatDirectory = "directory"
+	// ContainerFormatZip stores the AIP as a ZIP archive.
+	ContainerFormatZip = "zip"
+
+	// ManifestCheckWarn logs files dropped, renamed or modified by the pipeline. This is the default.
+	ManifestCheckWarn = "warn"
+	// ManifestCheckStrict fails the preservation if any file is dropped or modified by the pipeline.
+	ManifestCheckStrict = "strict"
+	// ManifestCheckOff disables the manifest comparison.
+	ManifestCheckOff = "off"
+
+	// DuplicateCheckWarn records and logs transfers whose content was already preserved. This is the default.
+	DuplicateCheckWarn = "warn"
+	// DuplicateCheckSkip fails the preservation of transfers whose content was already preserved, before processing.
+	DuplicateCheckSkip = "skip"
+	// DuplicateCheckOff disables the detection of transfers already preserved.
+	DuplicateCheckOff = "off"
+)
+
+// ProcessingProfile is a named set of processing options.
+// Unset fields fall back to the built-in preservation defaults.
+type ProcessingProfile struct {
+	Name               string                            `json:"-"`
+	Description        string                            `json:"description,omitempty" comment:"Human readable description of the profile"`
+	Normalize          *bool                             `json:"normalize,omitempty" comment:"Normalize files for preservation and access"`
+	ContainerFormat    string                            `json:"container_format,omitempty" validate:"omitempty,oneof=directory zip" comment:"AIP container format (directory, zip)"`
+	ChecksumAlgorithms []string                          `json:"checksum_algorithms,omitempty" validate:"dive,oneof=md5 sha1 sha256 sha512" comment:"Checksum algorithms for transfer fixity files"`
+	AVScan             bool                              `json:"av_scan,omitempty" comment:"Scan transfers for viruses with ClamAV"`
+	GenerateDIP        *bool                             `json:"generate_dip,omitempty" comment:"Generate and deposit a DIP when an AtoM slug is present"`
+	ManifestCheck      string                            `json:"manifest_check,omitempty" validate:"omitempty,oneof=warn strict off" comment:"Input and AIP manifest comparison (warn, strict, off)"`
+	DuplicateCheck     string                            `json:"duplicate_check,omitempty" validate:"omitempty,oneof=warn skip off" comment:"Detection of transfers whose content was already preserved (warn, skip, off)"`
+	PIIScan            *PIIScanConfig                    `json:"pii_scan,omitempty" comment:"Scan text files for sensitive data and hold back the DIP for review"`
+	Thumbnails         *ThumbnailConfig                  `json:"thumbnails,omitempty" comment:"Generate thumbnails and previews for DIP objects"`
+	Export             *ExportConfig                     `json:"export,omitempty" comment:"Export AIPs to another preservation system format"`
+	AccessCopies       *AccessCopyConfig                 `json:"access_copies,omitempty" comment:"Upload DIP access copies to Cells and share them"`
+	StorageTier        string                            `json:"storage_tier,omitempty" validate:"omitempty,oneof=hot cool cold archive" comment:"Tier of the AIP copies in the storage locations (hot, cool, cold, archive)"`
+	Atom               *AtomConfig                       `json:"atom,omitempty" validate:"-" comment:"AtoM target for DIP deposit"`
+	A3mConfig          *transferservice.ProcessingConfig `json:"a3m_config,omitempty" validate:"-" comment:"Advanced A3M processing configuration"`
+	Version            int                               `json:"version,omitempty" validate:"min=0" comment:"Version of the profile, incremented when it is changed with the API"`
+	UpdatedAt          *time.Time                        `json:"updated_at,omitempty" comment:"Time the profile was last changed with the API"`
+	UpdatedBy          string                            `json:"updated_by,omitempty" comment:"User who last changed the profile with the API"`
+}
+
+// ProfileRegistry holds the named processing profiles and their workspace assignments.
+type ProfileRegistry struct {
+	Default    string                        `json:"default,omitempty" comment:"Name of the default profile"`
+	Profiles   map[string]*ProcessingProfile `json:"profiles" validate:"dive" comment:"Processing profiles by name"`
+	Workspaces map[string]string             `json:"workspaces,omitempty" comment:"Cells workspace slug to profile name"`
+	Policies   []*Policy                     `json:"policies,omitempty" validate:"dive" comment:"Processing profiles and AtoM targets by Cells workspace or folder"`
+}
+
+// Policy assigns a processing profile, an AtoM target and a storage tier to the packages under a Cells workspace or folder.
+// Each can be omitted, in which case the profile selected otherwise and its settings apply.
+type Policy struct {
+	Path        string      `json:"path" validate:"required" comment:"Cells workspace slug or folder path, e.g. common-files/Digitized Photographs"`
+	Profile     string      `json:"profile,omitempty" comment:"Name of the processing profile"`
+	Atom        *AtomConfig `json:"atom,omitempty" validate:"-" comment:"AtoM target for DIP deposit, overriding the profile's target"`
+	StorageTier string      `json:"storage_tier,omitempty" validate:"omitempty,oneof=hot cool cold archive" comment:"Tier of the AIP copies in the storage locations, overriding the profile's tier"`
+}
+
+// matches reports whether a package path is the policy path or is inside it.
+func (p *Policy) matches(cellsPath string) bool {
+	policyPath := strings.Trim(p.Path, "/")
+	cellsPath = strings.Trim(cellsPath, "/")
+	return cellsPath == policyPath || strings.HasPrefix(cellsPath, policyPath+"/")
+}
+
+// AtomTarget returns the AtoM target of a package, the policy's target settings override the profile's.
+func (p *Policy) AtomTarget(profile *ProcessingProfile) *AtomConfig {
+	var profileTarget *AtomConfig
+	if profile != nil {
+		profileTarget = profile.Atom
+	}
+	if p == nil || p.Atom == nil {
+		return profileTarget
+	}
+	if profileTarget == nil {
+		return p.Atom
+	}
+	target := &AtomConfig{}
+	target.ApplyTarget(profileTarget)
+	target.ApplyTarget(p.Atom)
+	if p.Atom.Slug != "" {
+		target.Slug = p.Atom.Slug
+	}
+	return target
+}
+
+// LoadProfiles loads the profile registry from a file.
+// An empty registry is returned if the file does not exist.
+func LoadProfiles(path string) (*ProfileRegistry, error) {
+	registry := &ProfileRegistry{Profiles: map[string]*ProcessingProfile{}}
+	if path == "" {
+		return registry, nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return registry, nil
+		}
+		return nil, fmt.Errorf("reading profiles file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, registry); err != nil {
+		return nil, fmt.Errorf("unmarshaling profiles: %w", err)
+	}
+	if registry.Profiles == nil {
+		registry.Profiles = map[string]*ProcessingProfile{}
+	}
+	for name, profile := range registry.Profiles {
+		if profile == nil {
+			return nil, fmt.Errorf("profile %q is empty", name)
+		}
+		profile.Name = name
+	}
+
+	if err := registry.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profiles: %w", err)
+	}
+	return registry, nil
+}
+
+// SaveProfiles writes the profile registry to a file, replacing it atomically.
+func SaveProfiles(path string, registry *ProfileRegistry) error {
+	data, err := json.MarshalIndent(registry, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshaling profiles: %w", err)
+	}
+	tmp := filepath.Clean(path) + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("writing profiles file: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Clean(path)); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("replacing profiles file: %w", err)
+	}
+	return nil
+}
+
+// GetProfiles loads the profile registry from the configured profiles path.
+func GetProfiles(cfg *Config) (*ProfileRegistry, error) {
+	return LoadProfiles(cfg.Profiles.ConfigPath)
+}
+
+// ProfileNames returns the names of the profiles of the profiles file set in the environment variables or .env file,
+// for shell completions. Unlike Load, nothing is logged and the other settings are neither resolved nor validated.
+func ProfileNames() ([]string, error) {
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(); err != nil {
+			return nil, fmt.Errorf("error loading .env file: %w", err)
+		}
+	}
+	registry, err := LoadProfiles(viper.GetString("profiles.config_path"))
+	if err != nil {
+		return nil, err
+	}
+	return registry.Names(), nil
+}
+
+// Validate validates the registry and ensures all profile references exist.
+func (r *ProfileRegistry) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(r); err != nil {
+		return err
+	}
+	if r.Default != "" {
+		if _, ok := r.Profiles[r.Default]; !ok {
+			return fmt.Errorf("default profile %q not found", r.Default)
+		}
+	}
+	for name, profile := range r.Profiles {
+		if profile.PIIScan != nil {
+			if err := profile.PIIScan.Validate(); err != nil {
+				return fmt.Errorf("profile %q: %w", name, err)
+			}
+		}
+	}
+	for _, policy := range r.Policies {
+		if _, ok := r.Profiles[policy.Profile]; policy.Profile != "" && !ok {
+			return fmt.Errorf("profile %q of policy %q not found", policy.Profile, policy.Path)
+		}
+	}
+	for workspace, name := range r.Workspaces {
+		if _, ok := r.Profiles[name]; !ok {
+			return fmt.Errorf("profile %q assigned to workspace %q not found", name, workspace)
+		}
+	}
+	return nil
+}
+
+// Names returns the sorted profile names.
+func (r *ProfileRegistry) Names() []string {
+	names := make([]string, 0, len(r.Profiles))
+	for name := range r.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve selects the profile for a package.
+// Priority: explicitly requested profile, the profile of the most specific policy matching the package path,
+// the profile assigned to the package's Cells workspace, then the default profile.
+// Returns nil if no profile applies, in which case the built-in defaults are used.
+func (r *ProfileRegistry) Resolve(name, cellsPath string) (*ProcessingProfile, error) {
+	profile, _, err := r.ResolvePolicy(name, cellsPath)
+	return profile, err
+}
+
+// ResolvePolicy selects the profile for a package like Resolve, and returns the most specific policy matching
+// the package path. The policy is returned even when the profile was requested explicitly, its AtoM target still applies.
+// Returns a nil policy if no policy matches.
+func (r *ProfileRegistry) ResolvePolicy(name, cellsPath string) (*ProcessingProfile, *Policy, error) {
+	policy := r.Policy(cellsPath)
+
+	if name != "" {
+		profile, ok := r.Profiles[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("profile not found: %s", name)
+		}
+		return profile, policy, nil
+	}
+
+	if policy != nil && policy.Profile != "" {
+		return r.Profiles[policy.Profile], policy, nil
+	}
+
+	workspace := strings.Split(strings.TrimPrefix(cellsPath, "/"), "/")[0]
+	if assigned, ok := r.Workspaces[workspace]; ok {
+		return r.Profiles[assigned], policy, nil
+	}
+
+	if r.Default != "" {
+		return r.Profiles[r.Default], policy, nil
+	}
+	return nil, policy, nil
+}
+
+// Policy returns the policy with the longest path matching the package path, or nil if none matches.
+func (r *ProfileRegistry) Policy(cellsPath string) *Policy {
+	var match *Policy
+	for _, policy := range r.Policies {
+		if policy.matches(cellsPath) && (match == nil || len(strings.Trim(policy.Path, "/")) > len(strings.Trim(match.Path, "/"))) {
+			match = policy
+		}
+	}
+	return match
+}
+
+// PreservationConfig builds the preservation configuration described by the profile.
+func (p *ProcessingProfile) PreservationConfig() PreservationConfig {
+	if p == nil {
+		return DefaultPreservationConfig()
+	}
+
+	cfg := (&PreservationConfig{A3mConfig: p.A3mConfig}).MergeWithDefaults()
+	cfg.Profile = p.Name
+	if p.Normalize != nil {
+		cfg.A3mConfig.Normalize = *p.Normalize
+	}
+	if p.ContainerFormat != "" {
+		cfg.CompressAip = p.ContainerFormat == ContainerFormatZip
+	}
+	cfg.ChecksumAlgorithms = p.ChecksumAlgorithms
+	cfg.AVScan = p.AVScan
+	cfg.GenerateDIP = p.GenerateDIP
+	cfg.ManifestCheck = p.ManifestCheck
+	cfg.DuplicateCheck = p.DuplicateCheck
+	cfg.PIIScan = p.PIIScan
+	cfg.Thumbnails = p.Thumbnails
+	cfg.Export = p.Export
+	cfg.AccessCopies = p.AccessCopies
+	cfg.StorageTier = p.StorageTier
+	return cfg
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// OverQuotaReject refuses the submissions over quota. This is the default.
+	OverQuotaReject = "reject"
+	// OverQuotaQueue queues the submissions over quota, their jobs are held until the quota allows them to run.
+	OverQuotaQueue = "queue"
+)
+
+// QuotasConfig holds the quotas of the tenants and of the Cells workspaces. A package is held to the quota of its
+// tenant and to the quota of its workspace.
+type QuotasConfig struct {
+	Tenants    map[string]*Quota `json:"tenants,omitempty" validate:"dive" comment:"Quotas by tenant name"`
+	Workspaces map[string]*Quota `json:"workspaces,omitempty" validate:"dive" comment:"Quotas by Cells workspace slug, for the packages of every tenant"`
+}
+
+// Quota limits the storage and processing used by the packages of a tenant or a workspace. Zero values are not
+// limited.
+type Quota struct {
+	StoredBytes  int64  `json:"stored_bytes,omitempty" validate:"min=0" comment:"Total size of the AIPs preserved, in bytes"`
+	JobsPerDay   int    `json:"jobs_per_day,omitempty" validate:"min=0" comment:"Preservations started per UTC day"`
+	PackageBytes int64  `json:"package_bytes,omitempty" validate:"min=0" comment:"Size of a single package, in bytes"`
+	OverQuota    string `json:"over_quota,omitempty" validate:"omitempty,oneof=reject queue" comment:"Submissions over the stored bytes or jobs per day quota are rejected, or queued until the quota allows them (reject, queue)"`
+}
+
+// Queues reports whether the submissions over quota are queued rather than rejected.
+func (q *Quota) Queues() bool {
+	return q.OverQuota == OverQuotaQueue
+}
+
+// Validate validates the QuotasConfig.
+func (q *QuotasConfig) Validate() error {
+	if err := validator.New().Struct(q); err != nil {
+		return err
+	}
+	for name, quota := range q.Tenants {
+		if quota == nil {
+			return fmt.Errorf("quota of tenant %q is empty", name)
+		}
+	}
+	for name, quota := range q.Workspaces {
+		if quota == nil {
+			return fmt.Errorf("quota of workspace %q is empty", name)
+		}
+	}
+	return nil
+}
+
+// LoadQuotasConfig loads the quotas from a file.
+// Returns nil if the file does not exist, in which case nothing is limited.
+func LoadQuotasConfig(path string) (*QuotasConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg QuotasConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid quotas config: %w", err)
+	}
+	return &cfg, nil
+}
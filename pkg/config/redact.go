@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Redacted is shown in place of the secrets of the settings and configuration files.
+const Redacted = "REDACTED"
+
+// secretKeyParts are the parts of the keys whose values are secrets, such as tokens, passwords and API keys.
+var secretKeyParts = []string{"token", "password", "passphrase", "secret", "api_key", "apikey", "account_key"}
+
+// Settings returns the settings of a configuration as nested maps keyed by their names in the environment
+// variables, e.g. settings["cells"]["admin_token"] for CA4M_CELLS_ADMIN_TOKEN, with its secrets redacted.
+func (c *Config) Settings() map[string]any {
+	settings, _ := redact("", settingsValue(reflect.ValueOf(c).Elem())).(map[string]any)
+	return settings
+}
+
+// Changed returns the keys of the settings whose values differ in another configuration, e.g. concurrency.global,
+// sorted.
+func (c *Config) Changed(other *Config) []string {
+	old := map[string]any{}
+	flattenSettings("", settingsValue(reflect.ValueOf(c).Elem()), old)
+	updated := map[string]any{}
+	flattenSettings("", settingsValue(reflect.ValueOf(other).Elem()), updated)
+	var keys []string
+	for key, value := range updated {
+		if !reflect.DeepEqual(old[key], value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// flattenSettings adds the values of nested settings to a map, keyed by their dotted keys.
+func flattenSettings(prefix string, v any, values map[string]any) {
+	fields, ok := v.(map[string]any)
+	if !ok {
+		values[prefix] = v
+		return
+	}
+	for name, value := range fields {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		flattenSettings(name, value, values)
+	}
+}
+
+// Redact returns a configuration file as it is encoded in JSON, with its secrets redacted.
+func Redact(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return redact("", decoded), nil
+}
+
+// settingsValue returns a value of the settings as decoded from JSON, keying structs by their mapstructure tags.
+func settingsValue(v reflect.Value) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := map[string]any{}
+		t := v.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Tag.Get("mapstructure")
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			fields[name] = settingsValue(v.Field(i))
+		}
+		return fields
+	case reflect.Slice:
+		values := make([]any, v.Len())
+		for i := range v.Len() {
+			values[i] = settingsValue(v.Index(i))
+		}
+		return values
+	default:
+		return v.Interface()
+	}
+}
+
+// redact redacts the non-empty strings of the secret keys of a decoded value, and the passwords of its URLs.
+func redact(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			v[k] = redact(k, value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = redact(key, value)
+		}
+		return v
+	case string:
+		if v != "" && isSecretKey(key) {
+			return Redacted
+		}
+		return redactURLs(v)
+	default:
+		return v
+	}
+}
+
+// isSecretKey reports whether the values of a key are secrets. Keys are matched without case, with dashes read as
+// underscores, so that headers such as Authorization or X-API-Key are redacted too.
+func isSecretKey(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	switch key {
+	case "dsn", "key", "pass", "authorization":
+		return true
+	}
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURLs redacts the passwords of a URL, or of a comma separated list of URLs such as the NATS servers.
+func redactURLs(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		u, err := url.Parse(strings.TrimSpace(part))
+		if err != nil || u.User == nil {
+			continue
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), Redacted)
+			parts[i] = u.String()
+		}
+	}
+	return strings.Join(parts, ",")
+}
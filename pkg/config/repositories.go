@@ -0,0 +1,124 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+)
+
+const (
+	// RepositoryBackendFedora deposits access copies into a Fedora 6 repository (Samvera, Islandora).
+	RepositoryBackendFedora = "fedora"
+	// RepositoryBackendDSpace deposits access copies into a DSpace collection with SWORD v2.
+	RepositoryBackendDSpace = "dspace"
+	// RepositoryBackendDataverse deposits access copies into a Dataverse collection as datasets.
+	RepositoryBackendDataverse = "dataverse"
+)
+
+// RepositoriesConfig holds the repositories the access copies of preserved packages are deposited into.
+type RepositoriesConfig struct {
+	Repositories []*RepositoryConfig `json:"repositories" validate:"required,min=1,dive" comment:"Access repositories"`
+}
+
+// RepositoryConfig is a repository access copies are deposited into. Only the settings of its backend are used.
+type RepositoryConfig struct {
+	Name      string           `json:"name" validate:"required" comment:"Name of the repository"`
+	Backend   string           `json:"backend" validate:"required,oneof=fedora dspace dataverse" comment:"Repository backend (fedora, dspace, dataverse)"`
+	Profiles  []string         `json:"profiles,omitempty" comment:"Processing profiles whose packages are deposited (all if empty)"`
+	Fedora    *FedoraConfig    `json:"fedora,omitempty" validate:"required_if=Backend fedora" comment:"Fedora repository settings"`
+	DSpace    *DSpaceConfig    `json:"dspace,omitempty" validate:"required_if=Backend dspace" comment:"DSpace repository settings"`
+	Dataverse *DataverseConfig `json:"dataverse,omitempty" validate:"required_if=Backend dataverse" comment:"Dataverse repository settings"`
+}
+
+// FedoraConfig holds the settings of a Fedora 6 repository.
+// Requests are authenticated with the username and password, or the bearer token if set.
+type FedoraConfig struct {
+	URL       string `json:"url" validate:"required,url" comment:"Fedora REST API endpoint, e.g. https://fedora.example.org/fcrepo/rest"`
+	Container string `json:"container,omitempty" comment:"Path of the container the packages are deposited into, created if needed (default the repository root)"`
+	Username  string `json:"username,omitempty" comment:"Fedora username"`
+	Password  string `json:"password,omitempty" validate:"required_with=Username" comment:"Fedora password"`
+	Token     string `json:"token,omitempty" comment:"Bearer token, used instead of the username and password"`
+}
+
+// DSpaceConfig holds the settings of a DSpace collection packages are deposited into with SWORD v2.
+type DSpaceConfig struct {
+	CollectionURL string `json:"collection_url" validate:"required,url" comment:"SWORD v2 collection URL, e.g. https://dspace.example.org/server/swordv2/collection/123456789/2"`
+	Username      string `json:"username" validate:"required" comment:"DSpace user (e-mail)"`
+	Password      string `json:"password" validate:"required" comment:"DSpace password"`
+	OnBehalfOf    string `json:"on_behalf_of,omitempty" comment:"DSpace user the items are deposited on behalf of"`
+}
+
+// DataverseConfig holds the settings of a Dataverse collection packages are deposited into as datasets.
+// The contact is required by the Dataverse citation metadata block, the contact name is also the author
+// of datasets whose package has no creator.
+type DataverseConfig struct {
+	URL          string `json:"url" validate:"required,url" comment:"Dataverse installation URL, e.g. https://dataverse.example.org"`
+	Collection   string `json:"collection" validate:"required" comment:"Alias of the Dataverse collection the datasets are created in"`
+	APIToken     string `json:"api_token" validate:"required" comment:"API token of the depositing user"`
+	ContactName  string `json:"contact_name" validate:"required" comment:"Dataset contact name"`
+	ContactEmail string `json:"contact_email" validate:"required,email" comment:"Dataset contact e-mail"`
+	Subject      string `json:"subject,omitempty" comment:"Dataset subject, from the Dataverse subject vocabulary (default Other)"`
+	Publish      bool   `json:"publish,omitempty" comment:"Publish datasets once their files are uploaded, registering their DOI (default false, datasets are left as drafts)"`
+}
+
+// Validate validates the RepositoriesConfig.
+func (r *RepositoriesConfig) Validate() error {
+	if err := validator.New().Struct(r); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, repository := range r.Repositories {
+		if names[repository.Name] {
+			return fmt.Errorf("duplicate repository: %s", repository.Name)
+		}
+		names[repository.Name] = true
+	}
+	return nil
+}
+
+// Repository returns the repository with the given name, or nil if it does not exist.
+func (r *RepositoriesConfig) Repository(name string) *RepositoryConfig {
+	for _, repository := range r.Repositories {
+		if repository.Name == name {
+			return repository
+		}
+	}
+	return nil
+}
+
+// Accepts reports whether the packages of a processing profile are deposited into the repository.
+func (r *RepositoryConfig) Accepts(profile string) bool {
+	return len(r.Profiles) == 0 || slices.Contains(r.Profiles, profile)
+}
+
+// LoadRepositoriesConfig loads the access repositories from a file.
+// Returns nil if the file does not exist, in which case access copies are not deposited.
+func LoadRepositoriesConfig(path string) (*RepositoriesConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg RepositoriesConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid repositories config: %w", err)
+	}
+	return &cfg, nil
+}
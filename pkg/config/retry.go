@@ -0,0 +1,25 @@
+package config
+
+import "time"
+
+// RetryPolicy is how an operation failing with a transient error is retried, with exponential backoff.
+type RetryPolicy struct {
+	MaxAttempts  int           `mapstructure:"max_attempts" validate:"min=1" comment:"Attempts, including the first"`
+	InitialDelay time.Duration `mapstructure:"initial_delay" validate:"min=0" comment:"Delay before the first retry, doubled after each attempt"`
+	MaxDelay     time.Duration `mapstructure:"max_delay" validate:"min=0" comment:"Longest delay between attempts (0 for no limit)"`
+}
+
+// Delay returns the delay before a retry, from 1 for the first retry.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// TaskFixitySweep checks the fixity of every AIP in the storage locations.
+	TaskFixitySweep = "fixity_sweep"
+	// TaskStorageAudit compares the AIPs in the storage locations with the replicas of the package records.
+	TaskStorageAudit = "storage_audit"
+	// TaskSignatureUpdate runs the signature update commands and reloads the ClamAV signatures.
+	TaskSignatureUpdate = "signature_update"
+)
+
+// ScheduledTasks lists the tasks that can be scheduled.
+var ScheduledTasks = []string{TaskFixitySweep, TaskStorageAudit, TaskSignatureUpdate}
+
+// scheduleNamePattern restricts schedule names to the characters safe in URL paths.
+var scheduleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// SchedulesConfig holds the recurring tasks of serve mode. Schedules can also be created with the admin API.
+type SchedulesConfig struct {
+	Schedules []*Schedule `json:"schedules" validate:"dive" comment:"Scheduled tasks"`
+}
+
+// Schedule runs a task at the times of a cron expression.
+type Schedule struct {
+	Name           string   `json:"name" validate:"required" comment:"Name of the schedule, lowercase letters, digits, - and _"`
+	Cron           string   `json:"cron" validate:"required" comment:"Standard cron expression (minute hour day month weekday) or descriptor such as @daily, in the local time zone unless prefixed with CRON_TZ="`
+	Task           string   `json:"task" validate:"required,oneof=fixity_sweep storage_audit signature_update" comment:"Task run (fixity_sweep, storage_audit, signature_update)"`
+	Locations      []string `json:"locations,omitempty" comment:"Storage locations of fixity sweeps and storage audits (default every location)"`
+	TimeoutMinutes int      `json:"timeout_minutes,omitempty" validate:"omitempty,min=1" comment:"Minutes a run has before it is cancelled (default no timeout)"`
+	Disabled       bool     `json:"disabled,omitempty" comment:"Only run the task when triggered with the admin API"`
+}
+
+// Validate validates the Schedule.
+func (s *Schedule) Validate() error {
+	if err := validator.New().Struct(s); err != nil {
+		return err
+	}
+	if !scheduleNamePattern.MatchString(s.Name) {
+		return fmt.Errorf("invalid schedule name %q: use lowercase letters, digits, - and _", s.Name)
+	}
+	if _, err := cron.ParseStandard(s.Cron); err != nil {
+		return fmt.Errorf("schedule %s: invalid cron expression %q: %w", s.Name, s.Cron, err)
+	}
+	return nil
+}
+
+// Validate validates the SchedulesConfig.
+func (c *SchedulesConfig) Validate() error {
+	names := map[string]bool{}
+	for _, schedule := range c.Schedules {
+		if schedule == nil {
+			return fmt.Errorf("empty schedule")
+		}
+		if err := schedule.Validate(); err != nil {
+			return err
+		}
+		if names[schedule.Name] {
+			return fmt.Errorf("duplicate schedule: %s", schedule.Name)
+		}
+		names[schedule.Name] = true
+	}
+	return nil
+}
+
+// LoadSchedulesConfig loads the scheduled tasks from a file.
+// Returns nil if the file does not exist, in which case only the schedules created with the API run.
+func LoadSchedulesConfig(path string) (*SchedulesConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg SchedulesConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid schedules config: %w", err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+)
+
+const (
+	// SourceProtocolSFTP pulls transfers over SFTP.
+	SourceProtocolSFTP = "sftp"
+	// SourceProtocolFTPS pulls transfers over FTP with explicit TLS (AUTH TLS), or implicit TLS if enabled.
+	SourceProtocolFTPS = "ftps"
+	// SourceProtocolWebDAV pulls transfers from a WebDAV share, such as the Cells WebDAV endpoint.
+	SourceProtocolWebDAV = "webdav"
+	// SourceProtocolS3 pulls transfers from an S3 compatible bucket. It is the only protocol supporting presigned uploads.
+	SourceProtocolS3 = "s3"
+	// SourceProtocolRclone pulls transfers from any remote supported by rclone, with the rclone command.
+	SourceProtocolRclone = "rclone"
+	// SourceProtocolSharePoint pulls transfers from a SharePoint Online document library or a OneDrive, with Microsoft Graph.
+	SourceProtocolSharePoint = "sharepoint"
+	// SourceProtocolGoogleDrive pulls transfers from Google Drive folders and shared drives, exporting Google Docs,
+	// Sheets, Slides and Drawings to preservable formats.
+	SourceProtocolGoogleDrive = "gdrive"
+
+	// defaultIntakeExpiryHours is the default lifetime of presigned upload URLs.
+	defaultIntakeExpiryHours = 24
+	// defaultIntakePartSizeMB is the default part size of presigned uploads.
+	defaultIntakePartSizeMB = 256
+)
+
+// SourcesConfig holds the remote servers transfers can be pulled from.
+type SourcesConfig struct {
+	Sources []*TransferSource `json:"sources" validate:"required,min=1,dive" comment:"Transfer sources"`
+	Intake  *IntakeConfig     `json:"intake,omitempty" comment:"Presigned upload intake for large transfers"`
+}
+
+// IntakeConfig enables the intake of large transfers: the API issues presigned URLs the client uploads the transfer
+// parts to, straight into the bucket of an s3 transfer source, and the transfer is preserved from there.
+type IntakeConfig struct {
+	Source      string `json:"source" validate:"required" comment:"Name of the s3 transfer source uploads are written to"`
+	ExpiryHours int    `json:"expiry_hours,omitempty" validate:"omitempty,min=1,max=168" comment:"Lifetime of the presigned URLs in hours (default 24)"`
+	PartSizeMB  int    `json:"part_size_mb,omitempty" validate:"omitempty,min=5,max=5120" comment:"Upload part size in MiB (default 256)"`
+	MaxSizeGB   int    `json:"max_size_gb,omitempty" validate:"omitempty,min=1" comment:"Largest accepted transfer in GiB (0 is unlimited)"`
+}
+
+// Expiry returns the lifetime of the presigned URLs.
+func (i *IntakeConfig) Expiry() time.Duration {
+	hours := i.ExpiryHours
+	if hours == 0 {
+		hours = defaultIntakeExpiryHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// PartSize returns the upload part size in bytes.
+func (i *IntakeConfig) PartSize() int64 {
+	size := i.PartSizeMB
+	if size == 0 {
+		size = defaultIntakePartSizeMB
+	}
+	return int64(size) * 1024 * 1024
+}
+
+// TransferSource is a remote server transfers are pulled from, e.g. the delivery server of a digitisation vendor.
+// Pulled transfers are uploaded to the destination Cells folder and preserved from there.
+type TransferSource struct {
+	Name        string `json:"name" validate:"required" comment:"Name of the source"`
+	Protocol    string `json:"protocol" validate:"required,oneof=sftp ftps webdav s3 rclone sharepoint gdrive" comment:"Protocol (sftp, ftps, webdav, s3, rclone, sharepoint, gdrive)"`
+	Host        string `json:"host,omitempty" validate:"required_if=Protocol sftp,required_if=Protocol ftps" comment:"Server host name (sftp, ftps)"`
+	Port        int    `json:"port,omitempty" validate:"omitempty,min=1,max=65535" comment:"Server port (default 22 for sftp, 21 for ftps, 990 with implicit TLS)"`
+	Username    string `json:"username,omitempty" validate:"required_if=Protocol sftp,required_if=Protocol ftps" comment:"Login user"`
+	Password    string `json:"password,omitempty" comment:"Login password"`
+	RootDir     string `json:"root_dir,omitempty" comment:"Remote directory the transfer paths are relative to"`
+	Destination string `json:"destination" validate:"required" comment:"Cells folder pulled transfers are uploaded to, e.g. common-files/Vendor Deliveries"`
+
+	// SFTP
+	PrivateKeyFile      string `json:"private_key_file,omitempty" comment:"SSH private key file (sftp)"`
+	KnownHostsFile      string `json:"known_hosts_file,omitempty" comment:"SSH known_hosts file the server key is checked against (sftp)"`
+	InsecureSkipHostKey bool   `json:"insecure_skip_host_key,omitempty" comment:"Skip the server key check (sftp, testing only)"`
+
+	// FTPS
+	ImplicitTLS bool `json:"implicit_tls,omitempty" comment:"Use implicit TLS instead of AUTH TLS (ftps)"`
+
+	// WebDAV
+	URL   string `json:"url,omitempty" validate:"required_if=Protocol webdav,omitempty,http_url" comment:"WebDAV share URL, e.g. https://cells.example.org/dav (webdav)"`
+	Token string `json:"token,omitempty" comment:"Bearer token sent instead of the user and password, e.g. a Cells personal access token (webdav)"`
+
+	// S3
+	S3 *S3StorageConfig `json:"s3,omitempty" validate:"required_if=Protocol s3" comment:"Bucket settings, root_dir is the key prefix (s3)"`
+
+	// rclone
+	Rclone *RcloneConfig `json:"rclone,omitempty" validate:"required_if=Protocol rclone" comment:"rclone remote settings, root_dir is relative to the remote path (rclone)"`
+
+	// SharePoint
+	SharePoint *SharePointConfig `json:"sharepoint,omitempty" validate:"required_if=Protocol sharepoint" comment:"Document library settings, root_dir is a folder of the library (sharepoint)"`
+
+	// Google Drive
+	GoogleDrive *GoogleDriveConfig `json:"gdrive,omitempty" validate:"required_if=Protocol gdrive" comment:"Drive settings, root_dir is a folder of the drive (gdrive)"`
+}
+
+// GoogleDriveConfig holds the settings of a Google Drive source: the My Drive of the signed in account or of an
+// impersonated Workspace user, a shared drive, or a folder shared with the account.
+type GoogleDriveConfig struct {
+	CredentialsFile string   `json:"credentials_file,omitempty" comment:"Service account key file (default application default credentials)"`
+	Subject         string   `json:"subject,omitempty" comment:"Workspace user impersonated with domain-wide delegation, e.g. archivist@example.org"`
+	SharedDrive     string   `json:"shared_drive,omitempty" validate:"excluded_with=FolderID" comment:"Shared drive ID or name"`
+	FolderID        string   `json:"folder_id,omitempty" comment:"ID of the folder root_dir is relative to, e.g. a folder shared with the service account"`
+	ExportFormats   []string `json:"export_formats,omitempty" validate:"omitempty,dive,oneof=pdf odf" comment:"Formats Google Docs, Sheets, Slides and Drawings are exported to (pdf, odf; default both)"`
+	Endpoint        string   `json:"endpoint,omitempty" validate:"omitempty,url" comment:"Drive API endpoint (development only)"`
+}
+
+// SharePointConfig holds the settings of a SharePoint Online document library or OneDrive, read with Microsoft Graph.
+// The service signs in as an Entra ID app registration with the Sites.Read.All or Files.Read.All application permission.
+type SharePointConfig struct {
+	TenantID     string `json:"tenant_id" validate:"required" comment:"Entra ID tenant ID or domain"`
+	ClientID     string `json:"client_id" validate:"required" comment:"Application (client) ID of the app registration"`
+	ClientSecret string `json:"client_secret" validate:"required" comment:"Client secret of the app registration"`
+	Site         string `json:"site,omitempty" validate:"required_without=User,excluded_with=User" comment:"SharePoint site, e.g. example.sharepoint.com:/sites/Archives"`
+	User         string `json:"user,omitempty" comment:"User whose OneDrive is read, e.g. archivist@example.org"`
+	Library      string `json:"library,omitempty" comment:"Document library name (default the default library of the site or OneDrive)"`
+	GraphURL     string `json:"graph_url,omitempty" validate:"omitempty,http_url" comment:"Microsoft Graph endpoint, for national clouds (default https://graph.microsoft.com/v1.0)"`
+	LoginURL     string `json:"login_url,omitempty" validate:"omitempty,http_url" comment:"Entra ID sign in endpoint, for national clouds (default https://login.microsoftonline.com)"`
+}
+
+// Validate validates the SourcesConfig.
+func (s *SourcesConfig) Validate() error {
+	if err := validator.New().Struct(s); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, source := range s.Sources {
+		if names[source.Name] {
+			return fmt.Errorf("duplicate transfer source: %s", source.Name)
+		}
+		names[source.Name] = true
+		if source.Protocol == SourceProtocolSFTP && source.KnownHostsFile == "" && !source.InsecureSkipHostKey {
+			return fmt.Errorf("transfer source %s: known_hosts_file is required for sftp", source.Name)
+		}
+		if source.Protocol == SourceProtocolWebDAV && source.Username == "" && source.Token == "" {
+			return fmt.Errorf("transfer source %s: username or token is required for webdav", source.Name)
+		}
+	}
+	if s.Intake != nil {
+		source := s.Source(s.Intake.Source)
+		if source == nil {
+			return fmt.Errorf("intake source not found: %s", s.Intake.Source)
+		}
+		if source.Protocol != SourceProtocolS3 {
+			return fmt.Errorf("intake source %s must use the s3 protocol", source.Name)
+		}
+	}
+	return nil
+}
+
+// Source returns the transfer source with the given name, or nil if it does not exist.
+func (s *SourcesConfig) Source(name string) *TransferSource {
+	for _, source := range s.Sources {
+		if source.Name == name {
+			return source
+		}
+	}
+	return nil
+}
+
+// LoadSourcesConfig loads the transfer sources from a file.
+// Returns nil if the file does not exist, in which case transfers are only taken from Cells.
+func LoadSourcesConfig(path string) (*SourcesConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg SourcesConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sources config: %w", err)
+	}
+	return &cfg, nil
+}
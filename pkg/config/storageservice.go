@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+)
+
+// StorageServiceConfig holds the configuration for the Archivematica Storage Service.
+// Registration settings are only required when Register is set.
+type StorageServiceConfig struct {
+	URL      string `json:"url" validate:"required,url" comment:"Storage Service URL"`
+	Username string `json:"username" validate:"required" comment:"Storage Service username"`
+	APIKey   string `json:"api_key" validate:"required" comment:"Storage Service API key"`
+
+	Register             bool   `json:"register,omitempty" comment:"Register preserved AIPs in the Storage Service"`
+	PipelineUUID         string `json:"pipeline_uuid,omitempty" validate:"required_if=Register true,omitempty,uuid" comment:"Pipeline the registered AIPs originate from"`
+	OriginLocationUUID   string `json:"origin_location_uuid,omitempty" validate:"required_if=Register true,omitempty,uuid" comment:"Storage Service location of the origin directory"`
+	OriginDir            string `json:"origin_dir,omitempty" validate:"required_if=Register true" comment:"Local directory backing the origin location, AIPs are staged here for the Storage Service"`
+	AIPStoreLocationUUID string `json:"aip_store_location_uuid,omitempty" validate:"required_if=Register true,omitempty,uuid" comment:"AIP storage location the registered AIPs are stored in"`
+}
+
+// Validate validates the StorageServiceConfig.
+func (s *StorageServiceConfig) Validate() error {
+	return validator.New().Struct(s)
+}
+
+// LoadStorageServiceConfig loads the Storage Service configuration from a file.
+// Returns nil if the file does not exist, in which case the integration is disabled.
+func LoadStorageServiceConfig(path string) (*StorageServiceConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg StorageServiceConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Storage Service config: %w", err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/penwern/curate-preservation-core/pkg/secrets"
+)
+
+// tenantNamePattern restricts tenant names to the characters safe in job IDs and storage keys.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// TenantsConfig holds the tenants sharing the service in serve mode. API keys and users bound to a tenant only see
+// the jobs and packages of their tenant, and can only preserve packages under its paths.
+type TenantsConfig struct {
+	Tenants []*Tenant `json:"tenants" validate:"required,min=1,dive" comment:"Tenants of the service"`
+}
+
+// Tenant is an organisation sharing the service, with its own Cells folders, processing profiles, AIP storage
+// prefix and AtoM target.
+type Tenant struct {
+	Name           string      `json:"name" validate:"required" comment:"Name of the tenant, lowercase letters, digits, - and _"`
+	Paths          []string    `json:"paths" validate:"required,min=1,dive,required" comment:"Cells workspaces or folders of the tenant's packages, e.g. tenant-a-files"`
+	Profiles       []string    `json:"profiles,omitempty" comment:"Processing profiles the tenant's packages can use (default every profile)"`
+	DefaultProfile string      `json:"default_profile,omitempty" comment:"Processing profile of the tenant's packages when none is requested, instead of the policies and defaults of the profiles file"`
+	StoragePrefix  string      `json:"storage_prefix,omitempty" comment:"Prefix of the tenant's AIPs in the storage locations, below the location prefix (default the tenant name)"`
+	IntakeFolder   string      `json:"intake_folder,omitempty" comment:"Cells folder the transfers uploaded by the tenant are pulled to, under its paths (uploads are refused without it)"`
+	Atom           *AtomConfig `json:"atom,omitempty" validate:"-" comment:"AtoM target of the tenant's DIPs, overriding the targets of the profiles and policies"`
+}
+
+// Validate validates the TenantsConfig. Tenants cannot share paths or storage prefixes, so that every package and
+// AIP belongs to a single tenant.
+func (t *TenantsConfig) Validate() error {
+	if err := validator.New().Struct(t); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	prefixes := map[string]string{}
+	for _, tenant := range t.Tenants {
+		if !tenantNamePattern.MatchString(tenant.Name) {
+			return fmt.Errorf("invalid tenant name %q: use lowercase letters, digits, - and _", tenant.Name)
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("duplicate tenant: %s", tenant.Name)
+		}
+		names[tenant.Name] = true
+		prefix := tenant.Prefix()
+		if other, ok := prefixes[prefix]; ok {
+			return fmt.Errorf("tenants %s and %s share the storage prefix %s", other, tenant.Name, prefix)
+		}
+		prefixes[prefix] = tenant.Name
+		if tenant.DefaultProfile != "" && !tenant.AllowsProfile(tenant.DefaultProfile) {
+			return fmt.Errorf("tenant %s: default profile %q is not one of its profiles", tenant.Name, tenant.DefaultProfile)
+		}
+		if tenant.IntakeFolder != "" && !tenant.Contains(tenant.IntakeFolder) {
+			return fmt.Errorf("tenant %s: intake folder %s is not under its paths", tenant.Name, tenant.IntakeFolder)
+		}
+	}
+	for i, tenant := range t.Tenants {
+		for _, other := range t.Tenants[i+1:] {
+			for _, p := range tenant.Paths {
+				if slices.ContainsFunc(other.Paths, func(o string) bool { return pathContains(o, p) || pathContains(p, o) }) {
+					return fmt.Errorf("tenants %s and %s share the path %s", tenant.Name, other.Name, p)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Tenant returns the tenant with the given name, or nil if it does not exist.
+func (t *TenantsConfig) Tenant(name string) *Tenant {
+	if t == nil {
+		return nil
+	}
+	for _, tenant := range t.Tenants {
+		if tenant.Name == name {
+			return tenant
+		}
+	}
+	return nil
+}
+
+// Contains reports whether a Cells package path is one of the tenant's paths or is inside one.
+func (t *Tenant) Contains(cellsPath string) bool {
+	return slices.ContainsFunc(t.Paths, func(p string) bool { return pathContains(p, cellsPath) })
+}
+
+// AllowsProfile reports whether the tenant's packages can use a processing profile.
+func (t *Tenant) AllowsProfile(name string) bool {
+	return len(t.Profiles) == 0 || slices.Contains(t.Profiles, name)
+}
+
+// Prefix returns the prefix of the tenant's AIPs in the storage locations.
+func (t *Tenant) Prefix() string {
+	if prefix := strings.Trim(t.StoragePrefix, "/"); prefix != "" {
+		return prefix
+	}
+	return t.Name
+}
+
+// pathContains reports whether a Cells path is the parent path or is inside it.
+func pathContains(parent, cellsPath string) bool {
+	parent = strings.Trim(parent, "/")
+	cellsPath = strings.Trim(cellsPath, "/")
+	return cellsPath == parent || strings.HasPrefix(cellsPath, parent+"/")
+}
+
+// LoadTenantsConfig loads the tenants from a file.
+// Returns nil if the file does not exist, in which case the service has a single tenant.
+func LoadTenantsConfig(path string) (*TenantsConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg TenantsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid tenants config: %w", err)
+	}
+	return &cfg, nil
+}
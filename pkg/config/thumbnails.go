@@ -0,0 +1,11 @@
+package config
+
+// DefaultThumbnailSize is the default bounding box, in pixels, of generated thumbnails.
+const DefaultThumbnailSize = 200
+
+// ThumbnailConfig configures the thumbnails and previews generated for DIP objects.
+type ThumbnailConfig struct {
+	Size        int  `json:"size,omitempty" validate:"gte=0" comment:"Thumbnail bounding box in pixels (default 200)"`
+	PreviewSize int  `json:"preview_size,omitempty" validate:"gte=0" comment:"Preview bounding box in pixels. No previews are generated if 0"`
+	Overwrite   bool `json:"overwrite,omitempty" comment:"Replace thumbnails already generated by A3M"`
+}
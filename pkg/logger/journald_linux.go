@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// journalSocket is the socket of the native journald protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// Journald returns an output sending entries to systemd-journald with the native protocol, with their priority,
+// identifier and source location as journal fields.
+func Journald(identifier string) Output {
+	return func(level zapcore.LevelEnabler) (zapcore.Core, error) {
+		if _, err := os.Stat(journalSocket); err != nil {
+			return nil, fmt.Errorf("journald is not available: %w", err)
+		}
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+		if err != nil {
+			return nil, fmt.Errorf("error opening journald socket: %w", err)
+		}
+		addr := &net.UnixAddr{Name: journalSocket, Net: "unixgram"}
+		write := func(ent zapcore.Entry, msg []byte) error {
+			var data bytes.Buffer
+			appendJournalField(&data, "MESSAGE", msg)
+			appendJournalField(&data, "PRIORITY", []byte(strconv.Itoa(syslogSeverity(ent.Level))))
+			if identifier != "" {
+				appendJournalField(&data, "SYSLOG_IDENTIFIER", []byte(identifier))
+			}
+			if ent.Caller.Defined {
+				appendJournalField(&data, "CODE_FILE", []byte(ent.Caller.File))
+				appendJournalField(&data, "CODE_LINE", []byte(strconv.Itoa(ent.Caller.Line)))
+				appendJournalField(&data, "CODE_FUNC", []byte(ent.Caller.Function))
+			}
+			return sendJournal(conn, addr, data.Bytes())
+		}
+		return newEntryCore(level, write), nil
+	}
+}
+
+// appendJournalField appends a field in the native journal format. Values with newlines are length prefixed.
+func appendJournalField(data *bytes.Buffer, name string, value []byte) {
+	data.WriteString(name)
+	if bytes.IndexByte(value, '\n') < 0 {
+		data.WriteByte('=')
+		data.Write(value)
+	} else {
+		data.WriteByte('\n')
+		_ = binary.Write(data, binary.LittleEndian, uint64(len(value)))
+		data.Write(value)
+	}
+	data.WriteByte('\n')
+}
+
+// sendJournal sends an entry in a datagram. Entries too large for a datagram are passed as a file descriptor.
+func sendJournal(conn *net.UnixConn, addr *net.UnixAddr, data []byte) error {
+	_, _, err := conn.WriteMsgUnix(data, nil, addr)
+	if err == nil || (!errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS)) {
+		return err
+	}
+	file, err := os.CreateTemp("/dev/shm", "journal-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	if err := os.Remove(file.Name()); err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), addr)
+	return err
+}
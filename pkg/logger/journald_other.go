@@ -0,0 +1,16 @@
+//go:build !linux
+
+package logger
+
+import (
+	"errors"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Journald returns an output sending entries to systemd-journald, which is only available on Linux.
+func Journald(_ string) Output {
+	return func(_ zapcore.LevelEnabler) (zapcore.Core, error) {
+		return nil, errors.New("journald is only available on Linux")
+	}
+}
@@ -1,9 +1,12 @@
 // Package logger provides a simple logging utility using Uber's Zap library.
-// It supports different log levels and structured logging.
+// It supports different log levels and structured logging, written to the console, a log file, and optionally
+// syslog (RFC 5424) and systemd-journald.
 // It is designed to be used across the application for consistent logging.
 package logger
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -15,8 +18,40 @@ import (
 // Global logger instance
 var log *zap.SugaredLogger
 
-// Initialize sets up the logger with the given log level and log file path
-func Initialize(level string, logFilePath string) {
+// console is where the console entries are written, stdout unless set with SetConsole.
+var console io.Writer = os.Stdout
+
+// consoleLevel is the level below which console entries are not written, whatever the level of the logger, as set
+// with SetConsoleLevel.
+var consoleLevel = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+
+// onFatal is called with the message of a fatal error before the logger exits, if set with OnFatal.
+var onFatal func(msg string)
+
+// SetConsole sets where the console entries are written, e.g. stderr when stdout carries the output of a command.
+// It applies to the next initialization of the logger.
+func SetConsole(w io.Writer) {
+	console = w
+}
+
+// SetConsoleLevel stops writing the console entries below a level, e.g. while a progress display shows the stages of
+// a preservation, until it is reset with an empty level. Other outputs still write them. It applies at once.
+func SetConsoleLevel(level string) {
+	if level == "" {
+		consoleLevel.SetLevel(zapcore.DebugLevel)
+		return
+	}
+	consoleLevel.SetLevel(parseLevel(level))
+}
+
+// OnFatal sets a function called with the message of a fatal error before the logger exits.
+func OnFatal(fn func(msg string)) {
+	onFatal = fn
+}
+
+// Initialize sets up the logger with the given log level and log file path, and the additional outputs.
+// Outputs that cannot be opened are skipped with a warning.
+func Initialize(level string, logFilePath string, outputs ...Output) {
 	// Use default log file path if not provided
 	if logFilePath == "" {
 		logFilePath = "/var/log/curate/curate-preservation-core.log"
@@ -39,24 +74,7 @@ func Initialize(level string, logFilePath string) {
 		panic("failed to create log directory: " + err.Error())
 	}
 
-	// Parse log level
-	var zapLevel zapcore.Level
-	switch level {
-	case "debug", "Debug", "DEBUG":
-		zapLevel = zapcore.DebugLevel
-	case "info", "Info", "INFO":
-		zapLevel = zapcore.InfoLevel
-	case "warn", "Warn", "WARN":
-		zapLevel = zapcore.WarnLevel
-	case "error", "Error", "ERROR":
-		zapLevel = zapcore.ErrorLevel
-	case "fatal", "Fatal", "FATAL":
-		zapLevel = zapcore.FatalLevel
-	case "panic", "Panic", "PANIC":
-		zapLevel = zapcore.PanicLevel
-	default:
-		zapLevel = zapcore.InfoLevel
-	}
+	zapLevel := parseLevel(level)
 
 	// Console encoder config (minimal fields for journald)
 	consoleEncoderConfig := zap.NewProductionEncoderConfig()
@@ -76,7 +94,7 @@ func Initialize(level string, logFilePath string) {
 	fileEncoder := zapcore.NewConsoleEncoder(fileEncoderConfig)
 
 	// Outputs
-	consoleSyncer := zapcore.AddSync(os.Stdout)
+	consoleSyncer := zapcore.AddSync(console)
 	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
 	if err != nil {
 		panic("failed to open log file: " + err.Error())
@@ -84,14 +102,52 @@ func Initialize(level string, logFilePath string) {
 	fileSyncer := zapcore.AddSync(file)
 
 	// Cores
-	consoleCore := zapcore.NewCore(consoleEncoder, consoleSyncer, zapLevel)
+	consoleCore := zapcore.NewCore(consoleEncoder, consoleSyncer, zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= zapLevel && consoleLevel.Enabled(l)
+	}))
 	fileCore := zapcore.NewCore(fileEncoder, fileSyncer, zapLevel)
 
+	// Additional outputs
+	cores := []zapcore.Core{consoleCore, fileCore}
+	var outputErrs []error
+	for _, output := range outputs {
+		outputCore, err := output(zapLevel)
+		if err != nil {
+			outputErrs = append(outputErrs, err)
+			continue
+		}
+		cores = append(cores, outputCore)
+	}
+
 	// Tee core
-	core := zapcore.NewTee(consoleCore, fileCore)
+	core := zapcore.NewTee(cores...)
 
 	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1))
 	log = logger.Sugar()
+
+	for _, err := range outputErrs {
+		Warn("Error opening log output: %v", err)
+	}
+}
+
+// parseLevel parses a log level, info if it is unknown.
+func parseLevel(level string) zapcore.Level {
+	switch level {
+	case "debug", "Debug", "DEBUG":
+		return zapcore.DebugLevel
+	case "info", "Info", "INFO":
+		return zapcore.InfoLevel
+	case "warn", "Warn", "WARN":
+		return zapcore.WarnLevel
+	case "error", "Error", "ERROR":
+		return zapcore.ErrorLevel
+	case "fatal", "Fatal", "FATAL":
+		return zapcore.FatalLevel
+	case "panic", "Panic", "PANIC":
+		return zapcore.PanicLevel
+	default:
+		return zapcore.InfoLevel
+	}
 }
 
 // GetLogger returns the global logger instance
@@ -124,9 +180,23 @@ func Error(msg string, args ...any) {
 
 // Fatal logs a fatal message and exits
 func Fatal(msg string, args ...any) {
+	if onFatal != nil {
+		onFatal(fmt.Sprintf(msg, args...))
+	}
 	GetLogger().Fatalf(msg, args...)
 }
 
+// Exit logs an error message like Fatal and exits with the given status.
+func Exit(code int, msg string, args ...any) {
+	if onFatal != nil {
+		onFatal(fmt.Sprintf(msg, args...))
+	}
+	l := GetLogger()
+	l.Errorf(msg, args...)
+	_ = l.Sync()
+	os.Exit(code)
+}
+
 // Panic logs a panic message and exits
 func Panic(msg string, args ...any) {
 	GetLogger().Panicf(msg, args...)
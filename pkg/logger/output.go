@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Output is an additional log output, such as syslog or journald. It returns the core writing the entries
+// enabled by the level.
+type Output func(level zapcore.LevelEnabler) (zapcore.Core, error)
+
+// entryCore is a core writing each entry as a message with its own header, e.g. its syslog priority.
+// The message is the entry and its fields, as written to the console.
+type entryCore struct {
+	zapcore.LevelEnabler
+	enc   zapcore.Encoder
+	write func(ent zapcore.Entry, msg []byte) error
+}
+
+func newEntryCore(level zapcore.LevelEnabler, write func(ent zapcore.Entry, msg []byte) error) *entryCore {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	encoderConfig.LevelKey = ""
+	encoderConfig.CallerKey = ""
+	encoderConfig.SkipLineEnding = true
+	return &entryCore{LevelEnabler: level, enc: zapcore.NewConsoleEncoder(encoderConfig), write: write}
+}
+
+func (c *entryCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, field := range fields {
+		field.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *entryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *entryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	return c.write(ent, buf.Bytes())
+}
+
+func (c *entryCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,166 @@
+package logger
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Syslog facilities, by name.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogDialTimeout bounds the connection to the syslog server.
+const syslogDialTimeout = 10 * time.Second
+
+// Syslog returns an output sending RFC 5424 messages to a syslog server: udp://host:514, tcp://host:601,
+// tls://host:6514 or unix:///dev/log. Stream transports frame messages with octet counting (RFC 6587).
+func Syslog(address, facility, appName string) Output {
+	return func(level zapcore.LevelEnabler) (zapcore.Core, error) {
+		code, ok := syslogFacilities[facility]
+		if !ok {
+			return nil, fmt.Errorf("unknown syslog facility: %s", facility)
+		}
+		w, err := newSyslogWriter(address)
+		if err != nil {
+			return nil, err
+		}
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			hostname = "-"
+		}
+		header := fmt.Sprintf("%s %s %d - -", hostname, nilValue(appName), os.Getpid())
+		write := func(ent zapcore.Entry, msg []byte) error {
+			pri := code*8 + syslogSeverity(ent.Level)
+			line := fmt.Appendf(nil, "<%d>1 %s %s ", pri, ent.Time.Format("2006-01-02T15:04:05.000000Z07:00"), header)
+			return w.write(append(line, msg...))
+		}
+		return newEntryCore(level, write), nil
+	}
+}
+
+// syslogSeverity maps a log level to its syslog severity.
+func syslogSeverity(level zapcore.Level) int {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return 7
+	case level == zapcore.InfoLevel:
+		return 6
+	case level == zapcore.WarnLevel:
+		return 4
+	case level == zapcore.ErrorLevel:
+		return 3
+	default:
+		return 2
+	}
+}
+
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// syslogWriter writes messages to a syslog server, reconnecting once when a write fails.
+type syslogWriter struct {
+	network string
+	address string
+	stream  bool
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogWriter(address string) (*syslogWriter, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address: %w", err)
+	}
+	w := &syslogWriter{network: u.Scheme, address: u.Host}
+	switch u.Scheme {
+	case "udp":
+		if u.Port() == "" {
+			w.address = net.JoinHostPort(u.Hostname(), "514")
+		}
+	case "tcp":
+		w.stream = true
+		if u.Port() == "" {
+			w.address = net.JoinHostPort(u.Hostname(), "601")
+		}
+	case "tls":
+		w.stream = true
+		if u.Port() == "" {
+			w.address = net.JoinHostPort(u.Hostname(), "6514")
+		}
+	case "unix":
+		w.address = u.Path
+	default:
+		return nil, fmt.Errorf("unsupported syslog address %q: use udp://, tcp://, tls:// or unix://", address)
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *syslogWriter) connect() error {
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch w.network {
+	case "tls":
+		dialer := &net.Dialer{Timeout: syslogDialTimeout}
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.address, &tls.Config{MinVersion: tls.VersionTLS12})
+	case "unix":
+		// Local daemons listen on a datagram socket, fall back to a stream socket
+		w.stream = false
+		conn, err = net.DialTimeout("unixgram", w.address, syslogDialTimeout)
+		if err != nil {
+			w.stream = true
+			conn, err = net.DialTimeout("unix", w.address, syslogDialTimeout)
+		}
+	default:
+		conn, err = net.DialTimeout(w.network, w.address, syslogDialTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to syslog %s: %w", w.address, err)
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *syslogWriter) write(msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		if err := w.send(msg); err == nil {
+			return nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.connect(); err != nil {
+		return err
+	}
+	return w.send(msg)
+}
+
+func (w *syslogWriter) send(msg []byte) error {
+	if w.stream {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	_, err := w.conn.Write(msg)
+	return err
+}
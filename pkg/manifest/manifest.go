@@ -0,0 +1,316 @@
+// Package manifest provides file tree manifests and their comparison.
+// A manifest records the relative path, size and checksum of every file in a tree.
+// Comparing the manifest of a package before and after processing reports files that were dropped, renamed or modified by the pipeline.
+package manifest
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+	"github.com/penwern/curate-preservation-core/pkg/utils"
+)
+
+// DefaultAlgorithm is the checksum algorithm used for manifests.
+const DefaultAlgorithm = "sha256"
+
+// Entry is a single file in a manifest.
+type Entry struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// Manifest is the set of files in a tree, keyed by slash separated relative path.
+type Manifest struct {
+	Algorithm string            `json:"algorithm"`
+	Entries   map[string]*Entry `json:"entries"`
+}
+
+// Rename records a file whose content was found under a different path.
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Report is the result of comparing an input manifest to an output manifest.
+type Report struct {
+	Dropped  []string `json:"dropped,omitempty"`
+	Renamed  []Rename `json:"renamed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	Added    []string `json:"added,omitempty"`
+	Matched  int      `json:"matched"`
+}
+
+// New returns an empty manifest.
+func New(algorithm string) *Manifest {
+	if algorithm == "" {
+		algorithm = DefaultAlgorithm
+	}
+	return &Manifest{Algorithm: algorithm, Entries: map[string]*Entry{}}
+}
+
+// FromDir builds a manifest of all regular files under root.
+// Entry paths are relative to root and prefixed with prefix.
+func FromDir(ctx context.Context, root, prefix, algorithm string) (*Manifest, error) {
+	m := New(algorithm)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := utils.FileChecksum(p, m.Algorithm)
+		if err != nil {
+			return err
+		}
+		m.add(path.Join(prefix, filepath.ToSlash(rel)), info.Size(), sum)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error building manifest for %s: %w", root, err)
+	}
+	return m, nil
+}
+
+// FromZip builds a manifest of the files in a ZIP archive without extracting it.
+// Entry paths are the archive paths prefixed with prefix.
+func FromZip(ctx context.Context, src, prefix, algorithm string) (*Manifest, error) {
+	m := New(algorithm)
+	reader, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip file %q: %w", src, err)
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			logger.Error("Failed to close zip reader: %v", err)
+		}
+	}()
+
+	for _, file := range reader.File {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		sum, err := zipEntryChecksum(file, m.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		m.add(path.Join(prefix, path.Clean(file.Name)), int64(file.UncompressedSize64), sum) // #nosec G115 -- sizes above 8EB are not realistic
+	}
+	return m, nil
+}
+
+// FromPath builds a manifest for a downloaded package: a directory, a ZIP archive or a single file.
+// ZIP archives are described as their extracted contents under the archive name without extension,
+// matching how packages are laid out during preprocessing.
+func FromPath(ctx context.Context, src, prefix, algorithm string) (*Manifest, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("error checking path: %w", err)
+	}
+	name := filepath.Base(src)
+	switch {
+	case info.IsDir():
+		return FromDir(ctx, src, path.Join(prefix, name), algorithm)
+	case info.Mode().IsRegular() && utils.IsZipFile(src) && utils.IsActualArchive(src):
+		return FromZip(ctx, src, path.Join(prefix, strings.TrimSuffix(name, filepath.Ext(name))), algorithm)
+	case info.Mode().IsRegular():
+		m := New(algorithm)
+		sum, err := utils.FileChecksum(src, m.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		m.add(path.Join(prefix, name), info.Size(), sum)
+		return m, nil
+	default:
+		return nil, fmt.Errorf("file type not supported: %s", src)
+	}
+}
+
+// Compare compares the manifest of the input tree to the manifest of the output tree.
+// Files are matched by path first, then by checksum to detect renames.
+func (m *Manifest) Compare(output *Manifest) (*Report, error) {
+	if m.Algorithm != output.Algorithm {
+		return nil, fmt.Errorf("manifest algorithms differ: %s != %s", m.Algorithm, output.Algorithm)
+	}
+
+	report := &Report{}
+	claimed := map[string]bool{}
+
+	// Index unmatched output files by checksum to find renames
+	byChecksum := map[string][]string{}
+	for _, p := range output.Paths() {
+		if _, ok := m.Entries[p]; !ok {
+			byChecksum[output.Entries[p].Checksum] = append(byChecksum[output.Entries[p].Checksum], p)
+		}
+	}
+
+	for _, p := range m.Paths() {
+		in := m.Entries[p]
+		if out, ok := output.Entries[p]; ok {
+			claimed[p] = true
+			if out.Checksum == in.Checksum {
+				report.Matched++
+			} else {
+				report.Modified = append(report.Modified, p)
+			}
+			continue
+		}
+		candidates := byChecksum[in.Checksum]
+		if len(candidates) > 0 {
+			report.Renamed = append(report.Renamed, Rename{From: p, To: candidates[0]})
+			claimed[candidates[0]] = true
+			byChecksum[in.Checksum] = candidates[1:]
+			continue
+		}
+		report.Dropped = append(report.Dropped, p)
+	}
+
+	for _, p := range output.Paths() {
+		if !claimed[p] {
+			report.Added = append(report.Added, p)
+		}
+	}
+	return report, nil
+}
+
+// Remove removes entries from the manifest, e.g. files deliberately excluded from the package.
+func (m *Manifest) Remove(paths ...string) {
+	for _, p := range paths {
+		delete(m.Entries, p)
+	}
+}
+
+// Fingerprint returns a digest of the files of the package under prefix, identifying the same content submitted
+// again. Paths are taken below the root of the package, so that the name of the package does not change its
+// fingerprint. Returns an empty string if the manifest has no files.
+func (m *Manifest) Fingerprint(prefix string) string {
+	if len(m.Entries) == 0 {
+		return ""
+	}
+	h, err := utils.NewHash(m.Algorithm)
+	if err != nil {
+		return ""
+	}
+	lines := make([]string, 0, len(m.Entries))
+	for p, entry := range m.Entries {
+		_, rel, _ := strings.Cut(strings.TrimPrefix(p, prefix+"/"), "/")
+		lines = append(lines, fmt.Sprintf("%s\x00%d\x00%s\n", rel, entry.Size, entry.Checksum))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		_, _ = io.WriteString(h, line)
+	}
+	return m.Algorithm + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Paths returns the sorted entry paths.
+func (m *Manifest) Paths() []string {
+	paths := make([]string, 0, len(m.Entries))
+	for p := range m.Entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Write writes the manifest as JSON.
+func (m *Manifest) Write(filePath string) error {
+	return writeJSON(filePath, m)
+}
+
+// Read reads a manifest written as JSON.
+func Read(filePath string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Clean(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filePath, err)
+	}
+	if m.Entries == nil {
+		m.Entries = map[string]*Entry{}
+	}
+	return &m, nil
+}
+
+// HasLoss reports whether any input file was dropped or modified.
+func (r *Report) HasLoss() bool {
+	return len(r.Dropped) > 0 || len(r.Modified) > 0
+}
+
+// Summary returns a one line summary of the report.
+func (r *Report) Summary() string {
+	return fmt.Sprintf("matched=%d renamed=%d modified=%d dropped=%d added=%d",
+		r.Matched, len(r.Renamed), len(r.Modified), len(r.Dropped), len(r.Added))
+}
+
+// Write writes the report as JSON.
+func (r *Report) Write(filePath string) error {
+	return writeJSON(filePath, r)
+}
+
+func (m *Manifest) add(p string, size int64, checksum string) {
+	m.Entries[p] = &Entry{Path: p, Size: size, Checksum: checksum}
+}
+
+func zipEntryChecksum(file *zip.File, algorithm string) (string, error) {
+	h, err := utils.NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %q in archive: %w", file.Name, err)
+	}
+	defer func() {
+		if err := rc.Close(); err != nil {
+			logger.Error("Failed to close file reader for %q: %v", file.Name, err)
+		}
+	}()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", fmt.Errorf("failed to read %q in archive: %w", file.Name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeJSON(filePath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0o600); err != nil {
+		return fmt.Errorf("error writing %s: %w", filePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Package reporting sends panics and failed preservations to Sentry, or a Sentry compatible service such as
+// GlitchTip, with the context of the package (package ID, stage, processing profile), so failures are seen as they
+// happen rather than found in the log files. Reporting is disabled until Init is called with a DSN.
+package reporting
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/penwern/curate-preservation-core/pkg/version"
+)
+
+// flushTimeout bounds the wait for the reports being sent when the service stops.
+const flushTimeout = 5 * time.Second
+
+// Options are the settings of the error reporting.
+type Options struct {
+	DSN         string
+	Environment string
+	SampleRate  float64
+}
+
+// Context is the context of a reported error. Empty fields are left out.
+type Context struct {
+	PackageID string
+	Stage     string // Failed stage, e.g. the timeline event type of the stage
+	Profile   string
+	CellsPath string
+	Username  string
+	AIPUUID   string
+	Request   string // HTTP request of a panic in a handler, e.g. POST /preserve
+}
+
+// Init enables reporting to the project of the DSN. Without a DSN, reporting stays disabled.
+func Init(opts Options) error {
+	if opts.DSN == "" {
+		return nil
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              opts.DSN,
+		Environment:      opts.Environment,
+		Release:          "curate-preservation-core@" + version.Version(),
+		SampleRate:       opts.SampleRate,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		return fmt.Errorf("error initializing error reporting: %w", err)
+	}
+	return nil
+}
+
+// Enabled reports whether errors are reported.
+func Enabled() bool {
+	return sentry.CurrentHub().Client() != nil
+}
+
+// CaptureError reports an error. Errors of the same stage are grouped, as they are all captured from the same place.
+func CaptureError(err error, c Context) {
+	if err == nil || !Enabled() {
+		return
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		c.apply(scope)
+		if c.Stage != "" {
+			scope.SetFingerprint([]string{"stage", c.Stage, "{{ default }}"})
+		}
+		hub.CaptureException(err)
+	})
+}
+
+// CapturePanic reports a recovered panic with the stack of the panicking goroutine. Call it from the deferred
+// function that recovered the panic.
+func CapturePanic(value any, c Context) {
+	if value == nil || !Enabled() {
+		return
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		c.apply(scope)
+		scope.SetLevel(sentry.LevelFatal)
+		hub.Recover(value)
+	})
+}
+
+// Flush waits for the reports being sent.
+func Flush() {
+	if Enabled() {
+		sentry.Flush(flushTimeout)
+	}
+}
+
+// apply sets the context on a scope: the package ID, stage and profile as searchable tags, the rest as context.
+func (c Context) apply(scope *sentry.Scope) {
+	tags := map[string]string{"package_id": c.PackageID, "stage": c.Stage, "profile": c.Profile}
+	for key, value := range tags {
+		if value != "" {
+			scope.SetTag(key, value)
+		}
+	}
+	pkg := sentry.Context{}
+	for key, value := range map[string]string{"cells_path": c.CellsPath, "aip_uuid": c.AIPUUID, "request": c.Request} {
+		if value != "" {
+			pkg[key] = value
+		}
+	}
+	if len(pkg) > 0 {
+		scope.SetContext("package", pkg)
+	}
+	if c.Username != "" {
+		scope.SetUser(sentry.User{Username: c.Username})
+	}
+}
@@ -0,0 +1,43 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// awsProvider reads the current version of AWS Secrets Manager secrets.
+type awsProvider struct {
+	client *secretsmanager.Client
+}
+
+// newAWSProvider creates a Secrets Manager client from the default AWS configuration
+// (environment, shared config files, or the role of the instance or task).
+func newAWSProvider(region string) (*awsProvider, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS configuration: %w", err)
+	}
+	return &awsProvider{client: secretsmanager.NewFromConfig(cfg)}, nil
+}
+
+// fetch reads a secret by name or ARN, or a key of a JSON secret.
+func (p *awsProvider) fetch(ctx context.Context, ref string) (string, error) {
+	id, key := splitKey(ref)
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", fmt.Errorf("error reading AWS secret %s: %w", id, err)
+	}
+	secret := string(out.SecretBinary)
+	if out.SecretString != nil {
+		secret = *out.SecretString
+	}
+	return jsonKey(secret, key)
+}
@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// gcpProvider reads GCP Secret Manager secret versions.
+type gcpProvider struct {
+	service *secretmanager.Service
+}
+
+// newGCPProvider creates a Secret Manager client with the application default credentials.
+func newGCPProvider() (*gcpProvider, error) {
+	service, err := secretmanager.NewService(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCP Secret Manager client: %w", err)
+	}
+	return &gcpProvider{service: service}, nil
+}
+
+// fetch reads a secret version, e.g. projects/<project>/secrets/<secret>/versions/<version>, or a key of a JSON secret.
+// The latest version is read if the name has no version.
+func (p *gcpProvider) fetch(ctx context.Context, ref string) (string, error) {
+	name, key := splitKey(ref)
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	resp, err := p.service.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("error reading GCP secret %s: %w", name, err)
+	}
+	if resp.Payload == nil {
+		return "", fmt.Errorf("GCP secret %s has no payload", name)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("error decoding GCP secret %s: %w", name, err)
+	}
+	return jsonKey(string(data), key)
+}
@@ -0,0 +1,263 @@
+// Package secrets resolves secret references in configuration values from HashiCorp Vault,
+// AWS Secrets Manager and GCP Secret Manager.
+//
+// A string value is a reference when it starts with the prefix of a secret manager:
+//
+//	vault:<path>#<key>         a key of a Vault KV secret, e.g. vault:secret/data/curate/atom#api_key
+//	aws-sm:<secret id>[#<key>] an AWS Secrets Manager secret, or a key of a JSON secret
+//	gcp-sm:<name>[#<key>]      a GCP Secret Manager secret version, or a key of a JSON secret
+//
+// Other values are left as is.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+const (
+	// SchemeVault references a key of a HashiCorp Vault KV (v1 or v2) secret.
+	SchemeVault = "vault"
+	// SchemeAWS references an AWS Secrets Manager secret.
+	SchemeAWS = "aws-sm"
+	// SchemeGCP references a GCP Secret Manager secret version.
+	SchemeGCP = "gcp-sm"
+
+	// resolveTimeout bounds the resolution of the references of a configuration.
+	resolveTimeout = 30 * time.Second
+)
+
+// Config holds the settings of the secret managers.
+type Config struct {
+	// CacheTTL is how long resolved secrets are reused before they are fetched again. Zero disables the cache.
+	CacheTTL time.Duration
+	Vault    VaultConfig
+	// AWSRegion is the region of AWS Secrets Manager, the default AWS configuration is used if empty.
+	AWSRegion string
+	Insecure  bool
+}
+
+// provider fetches the value of a secret reference, without its scheme.
+type provider interface {
+	fetch(ctx context.Context, path string) (string, error)
+}
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// resolver resolves references with the configured providers, caching their values.
+type resolver struct {
+	config Config
+
+	mu        sync.Mutex
+	providers map[string]provider
+	cache     map[string]cachedSecret
+}
+
+var (
+	defaultMu       sync.RWMutex
+	defaultResolver = newResolver(Config{CacheTTL: 5 * time.Minute})
+)
+
+// Configure sets the settings of the secret managers. Cached secrets are dropped.
+func Configure(cfg Config) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultResolver = newResolver(cfg)
+}
+
+func newResolver(cfg Config) *resolver {
+	return &resolver{config: cfg, providers: map[string]provider{}, cache: map[string]cachedSecret{}}
+}
+
+// IsReference reports whether a value is a secret reference.
+func IsReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	return ok && (scheme == SchemeVault || scheme == SchemeAWS || scheme == SchemeGCP)
+}
+
+// Resolve replaces the secret references of the exported string fields of a configuration,
+// following pointers, structs, slices and maps. v must be a pointer.
+func Resolve(v any) error {
+	defaultMu.RLock()
+	r := defaultResolver
+	defaultMu.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	return r.resolveValue(ctx, reflect.ValueOf(v), "")
+}
+
+// resolveValue walks a value, replacing the references it holds. path names the field in errors.
+func (r *resolver) resolveValue(ctx context.Context, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.resolveValue(ctx, v.Elem(), path)
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := r.resolveValue(ctx, v.Field(i), joinPath(path, t.Field(i).Name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			if err := r.resolveValue(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elemPath := fmt.Sprintf("%s[%v]", path, iter.Key())
+			// Map values are not addressable, strings are replaced in the map
+			if iter.Value().Kind() == reflect.String {
+				value, err := r.resolveString(ctx, iter.Value().String(), elemPath)
+				if err != nil {
+					return err
+				}
+				v.SetMapIndex(iter.Key(), reflect.ValueOf(value).Convert(iter.Value().Type()))
+				continue
+			}
+			if err := r.resolveValue(ctx, iter.Value(), elemPath); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		value, err := r.resolveString(ctx, v.String(), path)
+		if err != nil {
+			return err
+		}
+		v.SetString(value)
+	}
+	return nil
+}
+
+// resolveString returns the secret of a reference, or the value if it is not a reference.
+func (r *resolver) resolveString(ctx context.Context, value, path string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	secret, err := r.lookup(ctx, value)
+	if err != nil {
+		return "", fmt.Errorf("error resolving secret of %s: %w", path, err)
+	}
+	return secret, nil
+}
+
+// lookup returns the value of a reference from the cache or its secret manager.
+// A secret manager that cannot be reached falls back to the last value fetched.
+func (r *resolver) lookup(ctx context.Context, ref string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cached, found := r.cache[ref]
+	if found && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+	scheme, rest, _ := strings.Cut(ref, ":")
+	p, err := r.provider(scheme)
+	if err != nil {
+		return "", err
+	}
+	value, err := p.fetch(ctx, rest)
+	if err != nil {
+		if found {
+			logger.Warn("Error refreshing secret %s, using the cached value: %v", ref, err)
+			return cached.value, nil
+		}
+		return "", err
+	}
+	if r.config.CacheTTL > 0 {
+		r.cache[ref] = cachedSecret{value: value, expires: time.Now().Add(r.config.CacheTTL)}
+	}
+	return value, nil
+}
+
+// provider returns the provider of a scheme, creating its client on first use.
+func (r *resolver) provider(scheme string) (provider, error) {
+	if p, ok := r.providers[scheme]; ok {
+		return p, nil
+	}
+	var (
+		p   provider
+		err error
+	)
+	switch scheme {
+	case SchemeVault:
+		p, err = newVaultProvider(r.config.Vault, r.config.Insecure)
+	case SchemeAWS:
+		p, err = newAWSProvider(r.config.AWSRegion)
+	case SchemeGCP:
+		p, err = newGCPProvider()
+	default:
+		err = fmt.Errorf("unsupported secret manager: %s", scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.providers[scheme] = p
+	return p, nil
+}
+
+// splitKey splits a reference into its secret and optional key.
+func splitKey(ref string) (string, string) {
+	secret, key, _ := strings.Cut(ref, "#")
+	return secret, key
+}
+
+// jsonKey returns a key of a JSON object secret, or the whole secret if no key is given.
+func jsonKey(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, cannot read key %s", key)
+	}
+	return fieldValue(fields, key)
+}
+
+// fieldValue returns a field of a secret as a string.
+func fieldValue(fields map[string]any, key string) (string, error) {
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret", key)
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	default:
+		// Numbers and booleans are kept as written
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,177 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultAppRoleMount is the mount path of the AppRole auth method.
+const defaultAppRoleMount = "approle"
+
+// VaultConfig holds the address and credentials of a Vault server.
+// The token is used if set, otherwise the service logs in with AppRole.
+type VaultConfig struct {
+	Address      string
+	Token        string
+	Namespace    string
+	RoleID       string
+	SecretID     string
+	AppRoleMount string
+}
+
+// vaultProvider reads keys of KV secrets through the Vault HTTP API.
+type vaultProvider struct {
+	config VaultConfig
+	client *http.Client
+
+	token   string
+	expires time.Time
+}
+
+// vaultResponse is the response of a secret read or a login.
+type vaultResponse struct {
+	Data map[string]any `json:"data"`
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// newVaultProvider creates a Vault provider, defaulting to the VAULT_ADDR and VAULT_TOKEN environment variables.
+func newVaultProvider(cfg VaultConfig, insecure bool) (*vaultProvider, error) {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if cfg.AppRoleMount == "" {
+		cfg.AppRoleMount = defaultAppRoleMount
+	}
+	if cfg.Address == "" {
+		return nil, errors.New("vault address is not configured")
+	}
+	if cfg.Token == "" && (cfg.RoleID == "" || cfg.SecretID == "") {
+		return nil, errors.New("vault token or AppRole credentials are not configured")
+	}
+	return &vaultProvider{
+		config: cfg,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+			},
+		},
+		token: cfg.Token,
+	}, nil
+}
+
+// fetch reads a key of the secret at a path, e.g. secret/data/curate/atom#api_key for a KV v2 engine mounted at secret.
+func (p *vaultProvider) fetch(ctx context.Context, ref string) (string, error) {
+	path, key := splitKey(ref)
+	if key == "" {
+		return "", fmt.Errorf("vault reference %s has no #key", ref)
+	}
+	token, err := p.authenticate(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	resp, status, err := p.do(ctx, http.MethodGet, path, token, nil)
+	if status == http.StatusForbidden && p.config.Token == "" {
+		// The AppRole token expired or was revoked, log in again
+		if token, err = p.authenticate(ctx, true); err != nil {
+			return "", err
+		}
+		resp, _, err = p.do(ctx, http.MethodGet, path, token, nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	fields := resp.Data
+	// KV v2 nests the secret in data.data, with its version in data.metadata
+	if nested, ok := fields["data"].(map[string]any); ok {
+		if _, versioned := fields["metadata"]; versioned {
+			fields = nested
+		}
+	}
+	return fieldValue(fields, key)
+}
+
+// authenticate returns the token of the provider, logging in with AppRole when no token is configured.
+func (p *vaultProvider) authenticate(ctx context.Context, renew bool) (string, error) {
+	if p.config.Token != "" {
+		return p.config.Token, nil
+	}
+	if !renew && p.token != "" && time.Now().Before(p.expires) {
+		return p.token, nil
+	}
+	body, err := json.Marshal(map[string]string{"role_id": p.config.RoleID, "secret_id": p.config.SecretID})
+	if err != nil {
+		return "", err
+	}
+	resp, _, err := p.do(ctx, http.MethodPost, "auth/"+strings.Trim(p.config.AppRoleMount, "/")+"/login", "", body)
+	if err != nil {
+		return "", fmt.Errorf("error logging in to vault with AppRole: %w", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", errors.New("vault AppRole login returned no token")
+	}
+	p.token = resp.Auth.ClientToken
+	// Renew a little before the lease ends
+	p.expires = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second * 9 / 10)
+	return p.token, nil
+}
+
+// do sends a request to the Vault API and decodes its response. The status code is returned with API errors.
+func (p *vaultProvider) do(ctx context.Context, method, path, token string, body []byte) (*vaultResponse, int, error) {
+	url := strings.TrimRight(p.config.Address, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.config.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error requesting vault: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, res.StatusCode, fmt.Errorf("error reading vault response: %w", err)
+	}
+	var resp vaultResponse
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, res.StatusCode, fmt.Errorf("error decoding vault response: %w", err)
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		if len(resp.Errors) > 0 {
+			return nil, res.StatusCode, fmt.Errorf("vault returned %d for %s: %s", res.StatusCode, path, strings.Join(resp.Errors, "; "))
+		}
+		return nil, res.StatusCode, fmt.Errorf("vault returned %d for %s", res.StatusCode, path)
+	}
+	return &resp, res.StatusCode, nil
+}
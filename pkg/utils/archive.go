@@ -9,9 +9,11 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -22,6 +24,9 @@ import (
 
 const maxExtractFileSize = 5 << 30 // 5GB limit for extracted files
 
+// ErrExtractLimit is returned when an archive exceeds a limit of its extraction options.
+var ErrExtractLimit = Classify(ErrPolicy, errors.New("archive exceeds extraction limit"))
+
 // sanitizeFileMode ensures mode is within safe bounds to prevent overflow
 func sanitizeFileMode(mode int64) os.FileMode {
 	if mode < 0 || mode > 0o777 {
@@ -54,6 +59,126 @@ func safeJoin(destDir, fileName string) (string, error) {
 	return filePath, nil
 }
 
+// ----------------------------
+// Extraction Options
+// ----------------------------
+
+// ExtractOptions selects and limits the entries extracted from an archive. The zero value extracts every entry, as
+// the service does. Entries are checked against path traversal whether they are selected or not.
+type ExtractOptions struct {
+	// Include are slash separated paths or glob patterns of the entries to extract, every entry if empty. Patterns
+	// without a slash also match base names at any depth, and a matching directory selects its contents.
+	Include []string
+	// Exclude are patterns of the entries not to extract, matched like Include.
+	Exclude []string
+	// MaxFiles is the number of files extracted at most, 0 for no limit.
+	MaxFiles int
+	// MaxFileSize is the size of a file at most, 0 for the default limit, which truncates larger files instead.
+	MaxFileSize int64
+	// MaxTotalSize is the size of the files extracted at most, 0 for no limit.
+	MaxTotalSize int64
+	// DryRun checks and lists the entries without writing anything.
+	DryRun bool
+	// OnEntry is called with each selected entry, before it is extracted.
+	OnEntry func(ArchiveEntry)
+}
+
+// ArchiveEntry is an entry of an archive selected for extraction.
+type ArchiveEntry struct {
+	Name string `json:"name"` // Slash separated, relative to the destination
+	Size int64  `json:"size"` // Size declared by the archive
+	Dir  bool   `json:"dir,omitempty"`
+}
+
+// extraction tracks the entries of an archive against its options.
+type extraction struct {
+	opts    ExtractOptions
+	files   int
+	size    int64 // Declared size of the selected files
+	written int64 // Bytes written to the files
+}
+
+// newExtraction validates the patterns of the options.
+func newExtraction(opts ExtractOptions) (*extraction, error) {
+	for _, pattern := range append(slices.Clone(opts.Include), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid extraction pattern %q: %w", pattern, err)
+		}
+	}
+	return &extraction{opts: opts}, nil
+}
+
+// admit reports whether an entry is selected, and checks the selected files against the limits.
+func (e *extraction) admit(name string, size int64, dir bool) (bool, error) {
+	name = path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "./"))
+	if (len(e.opts.Include) > 0 && !matchEntry(name, e.opts.Include)) || matchEntry(name, e.opts.Exclude) {
+		return false, nil
+	}
+	if !dir {
+		e.files++
+		e.size += size
+		switch {
+		case e.opts.MaxFiles > 0 && e.files > e.opts.MaxFiles:
+			return false, fmt.Errorf("%w: more than %d files", ErrExtractLimit, e.opts.MaxFiles)
+		case e.opts.MaxFileSize > 0 && size > e.opts.MaxFileSize:
+			return false, fmt.Errorf("%w: %s is %d bytes, more than %d", ErrExtractLimit, name, size, e.opts.MaxFileSize)
+		case e.opts.MaxTotalSize > 0 && e.size > e.opts.MaxTotalSize:
+			return false, fmt.Errorf("%w: files are more than %d bytes", ErrExtractLimit, e.opts.MaxTotalSize)
+		}
+	}
+	if e.opts.OnEntry != nil {
+		e.opts.OnEntry(ArchiveEntry{Name: name, Size: size, Dir: dir})
+	}
+	return true, nil
+}
+
+// copy writes the contents of a file entry. Files larger than the default limit are truncated, the limits of the
+// options are enforced on the bytes written, in case an archive declares smaller sizes than its contents.
+func (e *extraction) copy(dst io.Writer, src io.Reader, name string) error {
+	limit, strict := int64(maxExtractFileSize), false
+	if e.opts.MaxFileSize > 0 {
+		limit, strict = e.opts.MaxFileSize, true
+	}
+	if e.opts.MaxTotalSize > 0 && e.opts.MaxTotalSize-e.written < limit {
+		limit, strict = e.opts.MaxTotalSize-e.written, true
+	}
+	if !strict {
+		n, err := io.Copy(dst, io.LimitReader(src, limit))
+		e.written += n
+		return err
+	}
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	e.written += n
+	if err != nil {
+		return err
+	}
+	if n > limit {
+		return fmt.Errorf("%w: %s is larger than declared or allowed", ErrExtractLimit, name)
+	}
+	return nil
+}
+
+// matchEntry reports whether an entry, or one of its directories, matches one of the patterns.
+func matchEntry(name string, patterns []string) bool {
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			pattern = strings.Trim(pattern, "/")
+			if pattern == "" {
+				continue
+			}
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+			if !strings.Contains(pattern, "/") {
+				if ok, _ := path.Match(pattern, path.Base(p)); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 // ----------------------------
 // Detection Functions
 // ----------------------------
@@ -151,6 +276,10 @@ func IsActualArchive(path string) bool {
 // It validates file paths (ZipSlip check), uses os.Mkdir for directories,
 // and returns the computed package name (dest/packageName).
 func ExtractZip(ctx context.Context, src, dest string) (string, error) {
+	return extractZip(ctx, src, dest, &extraction{})
+}
+
+func extractZip(ctx context.Context, src, dest string, e *extraction) (string, error) {
 	reader, err := zip.OpenReader(src)
 	if err != nil {
 		return "", fmt.Errorf("failed to open zip file %q: %w", src, err)
@@ -162,8 +291,10 @@ func ExtractZip(ctx context.Context, src, dest string) (string, error) {
 	}()
 
 	// Ensure destination exists.
-	if err := CreateDir(dest); err != nil {
-		return "", fmt.Errorf("failed to create destination directory %q: %w", dest, err)
+	if !e.opts.DryRun {
+		if err := CreateDir(dest); err != nil {
+			return "", fmt.Errorf("failed to create destination directory %q: %w", dest, err)
+		}
 	}
 	cleanDest := filepath.Clean(dest) + string(os.PathSeparator)
 
@@ -177,6 +308,12 @@ func ExtractZip(ctx context.Context, src, dest string) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("invalid file path %q: %w", file.Name, err)
 		}
+		if ok, err := e.admit(file.Name, file.FileInfo().Size(), file.FileInfo().IsDir()); err != nil || !ok || e.opts.DryRun {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
 		if file.FileInfo().IsDir() {
 			if err := CreateDir(filePath); err != nil {
 				return "", fmt.Errorf("failed to create directory %q: %w", filePath, err)
@@ -207,7 +344,7 @@ func ExtractZip(ctx context.Context, src, dest string) (string, error) {
 				logger.Error("Failed to close file reader for %q: %v", file.Name, err)
 			}
 		}()
-		if _, err := io.Copy(outFile, io.LimitReader(rc, maxExtractFileSize)); err != nil {
+		if err := e.copy(outFile, rc, file.Name); err != nil {
 			return "", fmt.Errorf("failed to copy contents to %q: %w", filePath, err)
 		}
 	}
@@ -219,6 +356,10 @@ func ExtractZip(ctx context.Context, src, dest string) (string, error) {
 
 // Extract7z extracts the 7z archive at src into dest using similar logic.
 func Extract7z(ctx context.Context, src, dest string) (string, error) {
+	return extract7z(ctx, src, dest, &extraction{})
+}
+
+func extract7z(ctx context.Context, src, dest string, e *extraction) (string, error) {
 	r, err := sevenzip.OpenReader(src)
 	if err != nil {
 		return "", fmt.Errorf("opening archive: %w", err)
@@ -230,7 +371,7 @@ func Extract7z(ctx context.Context, src, dest string) (string, error) {
 	}()
 
 	// Ensure destination exists. Parents must exist.
-	if _, err := os.Stat(dest); os.IsNotExist(err) {
+	if _, err := os.Stat(dest); os.IsNotExist(err) && !e.opts.DryRun {
 		if err := os.Mkdir(dest, 0o750); err != nil {
 			return "", fmt.Errorf("creating destination directory: %w", err)
 		}
@@ -247,6 +388,16 @@ func Extract7z(ctx context.Context, src, dest string) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if ok, err := e.admit(file.Name, file.FileHeader.FileInfo().Size(), file.FileHeader.FileInfo().IsDir()); err != nil || !ok || e.opts.DryRun {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		// Directories of the entry may not be selected
+		if err := CreateDir(filepath.Dir(outPath)); err != nil {
+			return "", fmt.Errorf("creating parent directories for %q: %w", outPath, err)
+		}
 		if file.FileHeader.FileInfo().IsDir() {
 			if err := os.Mkdir(outPath, file.Mode()); err != nil && !os.IsExist(err) {
 				return "", fmt.Errorf("creating directory %q: %w", outPath, err)
@@ -254,13 +405,6 @@ func Extract7z(ctx context.Context, src, dest string) (string, error) {
 			continue
 		}
 
-		parentDir := filepath.Dir(outPath)
-		if _, err := os.Stat(parentDir); os.IsNotExist(err) {
-			if err := os.Mkdir(parentDir, 0o750); err != nil {
-				return "", fmt.Errorf("creating parent directories for %q: %w", outPath, err)
-			}
-		}
-
 		rc, err := file.Open()
 		if err != nil {
 			return "", fmt.Errorf("opening file %q from archive: %w", file.Name, err)
@@ -280,7 +424,7 @@ func Extract7z(ctx context.Context, src, dest string) (string, error) {
 				logger.Error("Failed to close output file %q: %v", outPath, err)
 			}
 		}()
-		if _, err := io.Copy(outFile, io.LimitReader(rc, maxExtractFileSize)); err != nil {
+		if err := e.copy(outFile, rc, file.Name); err != nil {
 			return "", fmt.Errorf("copying contents to %q: %w", outPath, err)
 		}
 	}
@@ -293,6 +437,10 @@ func Extract7z(ctx context.Context, src, dest string) (string, error) {
 // ExtractTar extracts a TAR or TAR.GZ archive at src into dest.
 // It performs a ZipSlip-like check and returns the computed package name.
 func ExtractTar(ctx context.Context, src, dest string) (string, error) {
+	return extractTar(ctx, src, dest, &extraction{})
+}
+
+func extractTar(ctx context.Context, src, dest string, e *extraction) (string, error) {
 	file, err := os.Open(src) // #nosec G304 -- src is controlled and validated by caller or context
 	if err != nil {
 		return "", err
@@ -320,7 +468,7 @@ func ExtractTar(ctx context.Context, src, dest string) (string, error) {
 	}
 
 	// Ensure destination exists. Parents must exist.
-	if _, err := os.Stat(dest); os.IsNotExist(err) {
+	if _, err := os.Stat(dest); os.IsNotExist(err) && !e.opts.DryRun {
 		if err := os.Mkdir(dest, 0o750); err != nil {
 			return "", err
 		}
@@ -344,6 +492,19 @@ func ExtractTar(ctx context.Context, src, dest string) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if header.Typeflag != tar.TypeDir && header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if ok, err := e.admit(header.Name, header.Size, header.Typeflag == tar.TypeDir); err != nil || !ok || e.opts.DryRun {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		// Directories of the entry may not be selected
+		if err := CreateDir(filepath.Dir(filePath)); err != nil {
+			return "", err
+		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
@@ -351,12 +512,6 @@ func ExtractTar(ctx context.Context, src, dest string) (string, error) {
 				return "", err
 			}
 		case tar.TypeReg:
-			parentDir := filepath.Dir(filePath)
-			if _, err := os.Stat(parentDir); os.IsNotExist(err) {
-				if err := os.Mkdir(parentDir, 0o750); err != nil {
-					return "", err
-				}
-			}
 			// #nosec G304 -- filePath is validated by safeJoin
 			outFile, err := os.Create(filePath)
 			if err != nil {
@@ -367,7 +522,7 @@ func ExtractTar(ctx context.Context, src, dest string) (string, error) {
 					logger.Error("Failed to close output file %q: %v", filePath, err)
 				}
 			}()
-			if _, err := io.Copy(outFile, io.LimitReader(tarReader, maxExtractFileSize)); err != nil {
+			if err := e.copy(outFile, tarReader, header.Name); err != nil {
 				return "", err
 			}
 		}
@@ -382,22 +537,31 @@ func ExtractTar(ctx context.Context, src, dest string) (string, error) {
 // It supports 7z, tar, and zip formats.
 // It returns the path to the extracted archive.
 func ExtractArchive(ctx context.Context, src, dest string) (string, error) {
+	return ExtractArchiveWithOptions(ctx, src, dest, ExtractOptions{})
+}
+
+// ExtractArchiveWithOptions extracts the entries of an archive selected by the options from src to dest, within
+// their limits, with the path safety of ExtractArchive. Entries extracted before a limit is exceeded are kept.
+func ExtractArchiveWithOptions(ctx context.Context, src, dest string, opts ExtractOptions) (string, error) {
+	e, err := newExtraction(opts)
+	if err != nil {
+		return "", err
+	}
 	var aipPath string
-	var err error
 
 	switch {
 	case Is7zFile(src):
-		aipPath, err = Extract7z(ctx, src, dest)
+		aipPath, err = extract7z(ctx, src, dest, e)
 		if err != nil {
 			return "", fmt.Errorf("error extracting 7zip: %w", err)
 		}
 	case IsTarFile(src):
-		aipPath, err = ExtractTar(ctx, src, dest)
+		aipPath, err = extractTar(ctx, src, dest, e)
 		if err != nil {
 			return "", fmt.Errorf("error extracting tar: %w", err)
 		}
 	case IsZipFile(src):
-		aipPath, err = ExtractZip(ctx, src, dest)
+		aipPath, err = extractZip(ctx, src, dest, e)
 		if err != nil {
 			return "", fmt.Errorf("error extracting zip: %w", err)
 		}
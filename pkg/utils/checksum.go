@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/md5"  // #nosec G501 -- MD5 is offered for fixity interoperability, not security
+	"crypto/sha1" // #nosec G505 -- SHA1 is offered for fixity interoperability, not security
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/penwern/curate-preservation-core/pkg/logger"
+)
+
+// SupportedChecksumAlgorithms lists the checksum algorithms that can be used for fixity.
+var SupportedChecksumAlgorithms = []string{"md5", "sha1", "sha256", "sha512"}
+
+// NewHash returns a new hash for the given checksum algorithm name.
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New(), nil // #nosec G401 -- see import comment
+	case "sha1":
+		return sha1.New(), nil // #nosec G401 -- see import comment
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	}
+}
+
+// FileChecksum computes the hex encoded checksum of a file using the given algorithm.
+func FileChecksum(path, algorithm string) (string, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("Failed to close file: %v", err)
+		}
+	}()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"errors"
+	"net"
+
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Failure classes, the major kinds of failures of preservations and commands. Errors of a class match it with
+// errors.Is, so that callers, such as the exit status of the commands, branch on the kind of failure rather than on
+// error messages.
+var (
+	// ErrValidation is the class of invalid settings, configuration files, profiles, requests and packages.
+	ErrValidation = errors.New("validation failed")
+	// ErrStorage is the class of failures to store, upload or fetch packages.
+	ErrStorage = errors.New("storage failed")
+	// ErrNetwork is the class of unreachable or unavailable services.
+	ErrNetwork = errors.New("network failure")
+	// ErrIntegrity is the class of checksum, fixity and manifest mismatches.
+	ErrIntegrity = errors.New("integrity check failed")
+	// ErrPolicy is the class of packages refused by a policy: infected, duplicate, over quota, not accessible to the
+	// tenant, or submitted during a maintenance window.
+	ErrPolicy = errors.New("refused by policy")
+)
+
+// FailureClasses lists the failure classes.
+var FailureClasses = []error{ErrValidation, ErrStorage, ErrNetwork, ErrIntegrity, ErrPolicy}
+
+// ClassError is an error of a failure class. Its message is the message of the error.
+type ClassError struct {
+	Class error
+	Err   error
+}
+
+func (e *ClassError) Error() string        { return e.Err.Error() }
+func (e *ClassError) Unwrap() error        { return e.Err }
+func (e *ClassError) Is(target error) bool { return target == e.Class }
+
+// Classify marks an error as of a failure class, unless it already has one. Returns nil if err is nil, and err if
+// class is nil.
+func Classify(class, err error) error {
+	if err == nil || class == nil || explicitClass(err) != nil {
+		return err
+	}
+	return &ClassError{Class: class, Err: err}
+}
+
+// FailureClass returns the failure class of an error, or nil if it has none. Errors marked by Classify have the class
+// of the failure closest to its cause. Otherwise validation errors of the settings are of the validation class, and
+// network errors and unavailable gRPC services of the network class.
+func FailureClass(err error) error {
+	if err == nil {
+		return nil
+	}
+	if class := explicitClass(err); class != nil {
+		return class
+	}
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return ErrValidation
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrNetwork
+	}
+	if s, ok := status.FromError(err); ok && (s.Code() == codes.Unavailable || s.Code() == codes.DeadlineExceeded) {
+		return ErrNetwork
+	}
+	return nil
+}
+
+// explicitClass returns the class an error was marked with, or nil.
+func explicitClass(err error) error {
+	var classified *ClassError
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+	for _, class := range FailureClasses {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+	return nil
+}
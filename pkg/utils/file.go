@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/google/uuid"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
 )
 
@@ -39,7 +38,7 @@ func CreateDir(path string) error {
 	return nil
 }
 
-// MakeUniqueDir creates a new directory in the provided base directory with a unique name using UUID.
+// MakeUniqueDir creates a new directory in the provided base directory with a unique name using the configured UUID version.
 // It returns the path to the new directory.
 func MakeUniqueDir(ctx context.Context, baseDirPath string) (string, error) {
 	// Ensure baseDirPath exists and is a directory
@@ -55,7 +54,7 @@ func MakeUniqueDir(ctx context.Context, baseDirPath string) (string, error) {
 	}
 	var uniqueDirPath string
 	for range 5 {
-		uid := uuid.New().String()
+		uid := NewUUID()
 		if uid == "" {
 			return "", fmt.Errorf("failed to generate UUID")
 		}
@@ -1,11 +1,13 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"net"
 	"strings"
 	"time"
 
+	"github.com/penwern/curate-preservation-core/pkg/config"
 	"github.com/penwern/curate-preservation-core/pkg/logger"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -18,12 +20,59 @@ const (
 	DefaultInitialDelay = 1 * time.Second
 )
 
+// DefaultRetryPolicy is the retry policy of WithRetry.
+var DefaultRetryPolicy = config.RetryPolicy{MaxAttempts: DefaultRetryAttempts, InitialDelay: DefaultInitialDelay}
+
+// PermanentError is an error that is never retried, whatever its cause, e.g. an invalid configuration or an
+// infected package.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// TransientError is an error that is always retried, e.g. a service reporting that it is busy.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// Permanent marks an error as permanent. Returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Transient marks an error as transient. Returns nil if err is nil.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
 // IsTransientError checks if an error is transient (e.g., network issues).
+// Errors marked permanent and cancellations are never transient, errors marked transient always are.
 func IsTransientError(err error) bool {
 	if err == nil {
 		return false
 	}
 
+	// Check for classified errors and cancellations
+	var permanent *PermanentError
+	if errors.As(err, &permanent) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var transient *TransientError
+	if errors.As(err, &transient) {
+		return true
+	}
+
 	// Check for network-related errors
 	var netErr net.Error
 	if errors.As(err, &netErr) {
@@ -91,3 +140,32 @@ func Retry(attempts int, delay time.Duration, operation func() error, isTransien
 	logger.Error("Failed after %d attempts: %v", attempts, err)
 	return err // Return the last error after exhausting retries
 }
+
+// RetryContext retries a function on transient errors following a retry policy. It stops waiting and returns the
+// last error when the context is cancelled.
+func RetryContext(ctx context.Context, policy config.RetryPolicy, operation func() error) error {
+	attempts := max(policy.MaxAttempts, 1)
+	var err error
+	for i := range attempts {
+		err = operation()
+		if err == nil {
+			return nil
+		}
+		if !IsTransientError(err) {
+			logger.Debug("Non-transient error occurred: %v", err)
+			return err
+		}
+		if i+1 == attempts {
+			break
+		}
+		delay := policy.Delay(i + 1)
+		logger.Error("Transient error occurred: %v. Retrying in %s (%d/%d)...", err, delay, i+1, attempts)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+	logger.Error("Failed after %d attempts: %v", attempts, err)
+	return err
+}
@@ -18,6 +18,11 @@ var allowedRsyncFlags = map[string]bool{
 	"--compress": true,
 	"--progress": true,
 	"-e":         true, // for SSH options
+
+	"--delay-updates":   true,
+	"--checksum":        true,
+	"--dry-run":         true,
+	"--itemize-changes": true,
 }
 
 // validateRsyncArg checks if an rsync argument is safe to use
@@ -112,3 +117,41 @@ func RsyncFile(ctx context.Context, src, dest string, extraArgs []string) error
 	}
 	return nil
 }
+
+// RsyncVerify compares src to dest by checksum without transferring anything.
+// It returns the itemized paths of the files that differ or are missing at dest.
+// Only the SSH options (-e) of extraArgs are used.
+func RsyncVerify(ctx context.Context, src, dest string, extraArgs []string) ([]string, error) {
+	if src == "" || dest == "" {
+		return nil, fmt.Errorf("source and destination paths cannot be empty")
+	}
+	src = filepath.Clean(src)
+	dest = filepath.Clean(dest)
+
+	cmdArgs := []string{"-a", "--checksum", "--dry-run", "--itemize-changes"}
+	for i, arg := range extraArgs {
+		if arg == "-e" && i+1 < len(extraArgs) {
+			if err := validateRsyncArg(extraArgs[i+1]); err != nil {
+				return nil, fmt.Errorf("invalid argument: %w", err)
+			}
+			cmdArgs = append(cmdArgs, arg, extraArgs[i+1])
+		}
+	}
+	cmdArgs = append(cmdArgs, src, dest)
+
+	// #nosec G204 -- the SSH options are validated by validateRsyncArg function above
+	output, err := exec.CommandContext(ctx, "rsync", cmdArgs...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("rsync failed: %w\nOutput: %s", err, string(output))
+	}
+
+	// Itemized lines are "YXcstpoguax path", where X is f for files
+	var changed []string
+	for line := range strings.Lines(string(output)) {
+		line = strings.TrimRight(line, "\n")
+		if len(line) > 12 && line[1] == 'f' {
+			changed = append(changed, line[12:])
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/penwern/curate-preservation-core/pkg/config"
+)
+
+// defaultS3Endpoint is used when no endpoint is configured.
+const defaultS3Endpoint = "s3.amazonaws.com"
+
+// NewS3Client creates a client for an S3 compatible bucket (AWS, MinIO, Wasabi).
+// Without an access key, credentials are read from the AWS environment variables, credentials file or instance role.
+func NewS3Client(cfg *config.S3StorageConfig, insecure bool) (*minio.Client, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("s3 storage config cannot be nil")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+	if cfg.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	}
+	opts := &minio.Options{
+		Creds:  creds,
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	}
+	if cfg.PathStyle {
+		opts.BucketLookup = minio.BucketLookupPath
+	}
+	if insecure {
+		transport, err := minio.DefaultTransport(opts.Secure)
+		if err != nil {
+			return nil, err
+		}
+		// #nosec G402 -- InsecureSkipVerify is configurable via AllowInsecureTLS for development/testing environments
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		opts.Transport = transport
+	}
+	client, err := minio.New(endpoint, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating S3 client: %w", err)
+	}
+	return client, nil
+}
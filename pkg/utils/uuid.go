@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// uuidVersion is the UUID version used for generated identifiers.
+var uuidVersion atomic.Int32
+
+func init() {
+	uuidVersion.Store(4)
+}
+
+// SetUUIDVersion sets the UUID version used for generated identifiers.
+// Version 4 generates random UUIDs, version 7 generates time-ordered UUIDs that sort chronologically.
+// Existing identifiers are opaque strings and remain valid whichever version is configured.
+func SetUUIDVersion(version int) error {
+	switch version {
+	case 4, 7:
+		uuidVersion.Store(int32(version)) // #nosec G115 -- version is 4 or 7
+		return nil
+	default:
+		return fmt.Errorf("unsupported UUID version: %d", version)
+	}
+}
+
+// NewUUID returns a new identifier using the configured UUID version.
+// Falls back to a random UUID if a time-ordered UUID cannot be generated.
+func NewUUID() string {
+	if uuidVersion.Load() == 7 {
+		if id, err := uuid.NewV7(); err == nil {
+			return id.String()
+		}
+	}
+	return uuid.NewString()
+}